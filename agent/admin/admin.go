@@ -0,0 +1,185 @@
+package admin
+
+import (
+	"agent/collector"
+	"agent/reporter"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSocket 默认管理套接字路径，由 systemd RuntimeDirectory 创建
+const DefaultSocket = "/run/yunwei-agent/admin.sock"
+
+// ==================== 服务端 ====================
+
+// Server 本地管理接口，仅监听 unix socket
+type Server struct {
+	socketPath string
+	reporter   *reporter.Reporter
+	collector  *collector.Collector
+	httpServer *http.Server
+}
+
+// NewServer 创建管理接口
+func NewServer(socketPath string, rep *reporter.Reporter, coll *collector.Collector) *Server {
+	s := &Server{
+		socketPath: socketPath,
+		reporter:   rep,
+		collector:  coll,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/collect", s.handleCollect)
+	mux.HandleFunc("/test-connection", s.handleTestConnection)
+	s.httpServer = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	return s
+}
+
+// Start 开始监听
+func (s *Server) Start() error {
+	if err := os.MkdirAll(filepath.Dir(s.socketPath), 0750); err != nil {
+		return fmt.Errorf("创建套接字目录失败: %w", err)
+	}
+	// 清理上次异常退出残留的套接字
+	if err := os.Remove(s.socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("清理旧套接字失败: %w", err)
+	}
+
+	ln, err := net.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("监听管理套接字失败: %w", err)
+	}
+	if err := os.Chmod(s.socketPath, 0660); err != nil {
+		ln.Close()
+		return fmt.Errorf("设置套接字权限失败: %w", err)
+	}
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(os.Stderr, "管理接口退出: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// Stop 停止监听
+func (s *Server) Stop(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	os.Remove(s.socketPath)
+	return err
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.reporter.Status())
+}
+
+func (s *Server) handleCollect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.collector.Collect())
+}
+
+func (s *Server) handleTestConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, s.reporter.TestConnection(r.Context()))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// ==================== 客户端 ====================
+
+// Client 管理接口客户端
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient 创建客户端
+func NewClient(socketPath string) *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// Available 管理接口是否可连接（Agent 是否在运行）
+func Available(socketPath string) bool {
+	conn, err := net.DialTimeout("unix", socketPath, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Status 查询运行状态
+func (c *Client) Status(ctx context.Context) (*reporter.Status, error) {
+	var st reporter.Status
+	if err := c.do(ctx, http.MethodGet, "/status", &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Collect 触发一次采集
+func (c *Client) Collect(ctx context.Context) (*collector.CollectResult, error) {
+	var result collector.CollectResult
+	if err := c.do(ctx, http.MethodGet, "/collect", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TestConnection 使用运行中 Agent 的配置测试连接
+func (c *Client) TestConnection(ctx context.Context) (*reporter.ConnectionReport, error) {
+	var report reporter.ConnectionReport
+	if err := c.do(ctx, http.MethodPost, "/test-connection", &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, "http://agent"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接管理接口失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("管理接口返回 %d: %s", resp.StatusCode, body)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -26,6 +26,7 @@ type ExecuteResult struct {
 	Success   bool     `json:"success"`
 	Output    string   `json:"output"`
 	Error     string   `json:"error"`
+	ExitCode  int      `json:"exitCode"` // 被信号终止或未能启动时为 -1
 	Duration  int64    `json:"duration"` // 毫秒
 	StartTime time.Time `json:"startTime"`
 	EndTime   time.Time `json:"endTime"`
@@ -55,6 +56,10 @@ func (e *Executor) Execute(ctx context.Context, command string, timeout int) *Ex
 	err := cmd.Run()
 	result.EndTime = time.Now()
 	result.Duration = result.EndTime.Sub(result.StartTime).Milliseconds()
+	result.ExitCode = -1
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	}
 
 	if err != nil {
 		result.Success = false
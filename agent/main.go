@@ -1,44 +1,171 @@
 package main
 
 import (
+	"agent/admin"
 	"agent/collector"
 	"agent/executor"
 	"agent/reporter"
+	"agent/service"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 )
 
-var (
-	serverAddr   = flag.String("server", "localhost:50051", "gRPC server address")
-	agentName    = flag.String("name", "", "Agent name")
-	interval     = flag.Int("interval", 10, "Metrics collection interval in seconds")
-	dockerEnable = flag.Bool("docker", true, "Enable Docker monitoring")
-	portsEnable  = flag.Bool("ports", true, "Enable port monitoring")
-)
+// version 构建时通过 -ldflags "-X main.version=..." 注入
+var version = "dev"
 
-func main() {
-	flag.Parse()
+// runFlags 运行参数
+type runFlags struct {
+	serverAddr   *string
+	agentName    *string
+	interval     *int
+	dockerEnable *bool
+	portsEnable  *bool
+	tlsEnable    *bool
+	caFile       *string
+	certFile     *string
+	keyFile      *string
+	serverName   *string
+	secretFile   *string
+	enrollToken  *string
+	tenant       *string
+	adminSocket  *string
+}
 
-	// 生成 Agent ID
-	agentID := *agentName
-	if agentID == "" {
-		hostname, _ := os.Hostname()
-		agentID = hostname
+// registerRunFlags 注册运行参数，install 和 test-connection 共用
+func registerRunFlags(fs *flag.FlagSet) *runFlags {
+	return &runFlags{
+		serverAddr:   fs.String("server", "localhost:50051", "gRPC server address"),
+		agentName:    fs.String("name", "", "Agent name"),
+		interval:     fs.Int("interval", 10, "Metrics collection interval in seconds"),
+		dockerEnable: fs.Bool("docker", true, "Enable Docker monitoring"),
+		portsEnable:  fs.Bool("ports", true, "Enable port monitoring"),
+		tlsEnable:    fs.Bool("tls", false, "Enable TLS"),
+		caFile:       fs.String("ca", "", "CA certificate to verify the server"),
+		certFile:     fs.String("cert", "", "Client certificate (mTLS)"),
+		keyFile:      fs.String("key", "", "Client private key (mTLS)"),
+		serverName:   fs.String("server-name", "", "Override TLS server name"),
+		secretFile:   fs.String("secret-file", service.StateDir+"/agent.key", "File holding the agent secret"),
+		enrollToken:  fs.String("enroll-token", "", "Enrollment token for first registration"),
+		tenant:       fs.String("tenant", "", "Tenant ID of the server, used when registration creates the server"),
+		adminSocket:  fs.String("admin-socket", admin.DefaultSocket, "Local admin API unix socket"),
 	}
+}
+
+// agentID 生成 Agent ID
+func (f *runFlags) agentID() string {
+	if *f.agentName != "" {
+		return *f.agentName
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// transport 连接配置
+func (f *runFlags) transport() *reporter.TransportConfig {
+	return &reporter.TransportConfig{
+		TLS:         *f.tlsEnable,
+		CAFile:      *f.caFile,
+		CertFile:    *f.certFile,
+		KeyFile:     *f.keyFile,
+		ServerName:  *f.serverName,
+		SecretFile:  *f.secretFile,
+		EnrollToken: *f.enrollToken,
+	}
+}
+
+// configVersion 按生效参数计算配置版本，便于确认节点是否已应用新配置
+func configVersion(fs *flag.FlagSet) string {
+	h := sha256.New()
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "enroll-token" {
+			return
+		}
+		fmt.Fprintf(h, "%s=%s\n", f.Name, f.Value.String())
+	})
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		var err error
+		switch os.Args[1] {
+		case "run":
+			runAgent(os.Args[2:])
+		case "install":
+			err = cmdInstall(os.Args[2:])
+		case "uninstall":
+			err = cmdUninstall(os.Args[2:])
+		case "status":
+			err = cmdStatus(os.Args[2:])
+		case "collect":
+			err = cmdCollect(os.Args[2:])
+		case "test-connection":
+			err = cmdTestConnection(os.Args[2:])
+		case "version":
+			fmt.Println(version)
+		case "help":
+			usage()
+		default:
+			fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", os.Args[1])
+			usage()
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	runAgent(os.Args[1:])
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `用法: yunwei-agent [command] [flags]
+
+命令:
+  run               运行 Agent（默认）
+  install           安装为 systemd 服务，其余参数写入 ExecStart
+  uninstall         卸载 systemd 服务，--purge 同时删除用户和数据
+  status            查看运行中 Agent 的状态
+  collect --once    采集一次并以 JSON 输出
+  test-connection   测试到服务端的连接、TLS 与认证
+  version           输出版本
+
+运行 "yunwei-agent run -h" 查看运行参数
+`)
+}
+
+// ==================== 运行 ====================
+
+func runAgent(args []string) {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	rf := registerRunFlags(fs)
+	fs.Parse(args)
+
+	agentID := rf.agentID()
+	cfgVersion := configVersion(fs)
 
 	log.Printf("===========================================")
 	log.Printf("  AI-Ops Agent 启动")
 	log.Printf("===========================================")
 	log.Printf("  Agent ID:  %s", agentID)
-	log.Printf("  Server:    %s", *serverAddr)
-	log.Printf("  Interval:  %d seconds", *interval)
-	log.Printf("  Docker:    %v", *dockerEnable)
-	log.Printf("  Ports:     %v", *portsEnable)
+	log.Printf("  Version:   %s (config %s)", version, cfgVersion)
+	log.Printf("  Server:    %s", *rf.serverAddr)
+	log.Printf("  TLS:       %v", *rf.tlsEnable)
+	log.Printf("  Interval:  %d seconds", *rf.interval)
+	log.Printf("  Docker:    %v", *rf.dockerEnable)
+	log.Printf("  Ports:     %v", *rf.portsEnable)
 	log.Printf("===========================================")
 
 	// 创建上下文
@@ -47,15 +174,25 @@ func main() {
 
 	// 创建采集器
 	coll := collector.NewCollector(&collector.Config{
-		EnableDocker: *dockerEnable,
-		EnablePorts:  *portsEnable,
+		EnableDocker: *rf.dockerEnable,
+		EnablePorts:  *rf.portsEnable,
 	})
 
 	// 创建执行器
 	exec := executor.NewExecutor()
 
 	// 创建上报器
-	rep := reporter.NewReporter(*serverAddr, agentID, coll, exec)
+	rep := reporter.NewReporter(*rf.serverAddr, agentID, coll, exec)
+	rep.SetTransport(rf.transport())
+	rep.SetVersion(version, cfgVersion)
+
+	// 启动本地管理接口
+	adminServer := admin.NewServer(*rf.adminSocket, rep, coll)
+	if err := adminServer.Start(); err != nil {
+		log.Printf("管理接口启动失败: %v", err)
+	} else {
+		log.Printf("管理接口: %s", *rf.adminSocket)
+	}
 
 	// 连接服务器
 	for i := 0; i < 5; i++ {
@@ -63,16 +200,26 @@ func main() {
 			log.Printf("连接服务器失败: %v, %d秒后重试...", err, 5)
 			time.Sleep(5 * time.Second)
 		} else {
-			log.Printf("已连接到服务器: %s", *serverAddr)
+			log.Printf("已连接到服务器: %s", *rf.serverAddr)
 			break
 		}
 	}
 
+	// 首次启动先注册并保存密钥，之后的请求才能通过签名认证
+	for !rep.Enrolled() {
+		if err := rep.Enroll(ctx, *rf.tenant); err != nil {
+			log.Printf("注册失败: %v, %d秒后重试...", err, 10)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+		log.Printf("密钥已保存: %s", *rf.secretFile)
+	}
+
 	// 启动心跳
 	go startHeartbeat(ctx, rep, agentID)
 
 	// 启动指标采集
-	go startMetricsCollection(ctx, rep, coll, *interval)
+	go startMetricsCollection(ctx, rep, coll, *rf.interval)
 
 	// 启动任务执行器
 	go startTaskExecutor(ctx, rep)
@@ -84,10 +231,176 @@ func main() {
 
 	log.Println("Agent 正在关闭...")
 	cancel()
-	time.Sleep(1 * time.Second)
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), time.Second)
+	adminServer.Stop(shutdownCtx)
+	cancelShutdown()
+	rep.Close()
 	log.Println("Agent 已停止")
 }
 
+// ==================== 子命令 ====================
+
+// cmdInstall 安装服务，除 --no-start 外的参数原样作为运行参数
+func cmdInstall(args []string) error {
+	opts := service.InstallOptions{Start: true}
+	for _, arg := range args {
+		if arg == "-no-start" || arg == "--no-start" {
+			opts.Start = false
+			continue
+		}
+		opts.Args = append(opts.Args, arg)
+	}
+
+	// 先校验运行参数，避免写出无法启动的 unit
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	registerRunFlags(fs)
+	if err := fs.Parse(opts.Args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("无法识别的参数: %s", strings.Join(fs.Args(), " "))
+	}
+
+	return service.Install(opts, os.Stdout)
+}
+
+func cmdUninstall(args []string) error {
+	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	purge := fs.Bool("purge", false, "Also remove the service user, config and state directories")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return service.Uninstall(*purge, os.Stdout)
+}
+
+func cmdStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	socket := fs.String("admin-socket", admin.DefaultSocket, "Local admin API unix socket")
+	asJSON := fs.Bool("json", false, "Print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !admin.Available(*socket) {
+		return fmt.Errorf("Agent 未运行或管理接口不可用: %s", *socket)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	st, err := admin.NewClient(*socket).Status(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(st)
+	}
+
+	fmt.Printf("Agent ID:        %s\n", st.AgentID)
+	fmt.Printf("Version:         %s\n", st.Version)
+	fmt.Printf("Config Version:  %s\n", st.ConfigVersion)
+	fmt.Printf("Server:          %s (tls=%v)\n", st.Server, st.TLS)
+	fmt.Printf("Connection:      %s\n", st.Connection)
+	fmt.Printf("Uptime:          %s\n", st.Uptime)
+	fmt.Printf("Last Heartbeat:  %s\n", formatTime(st.LastHeartbeat))
+	fmt.Printf("Last Report:     %s\n", formatTime(st.LastReport))
+	fmt.Printf("Spool Depth:     %d\n", st.SpoolDepth)
+	if st.LastError != "" {
+		fmt.Printf("Last Error:      %s (%s)\n", st.LastError, formatTime(st.LastErrorAt))
+	}
+	return nil
+}
+
+// cmdCollect 优先由运行中的 Agent 采集，未运行时在本进程采集
+func cmdCollect(args []string) error {
+	fs := flag.NewFlagSet("collect", flag.ContinueOnError)
+	once := fs.Bool("once", false, "Collect once and exit")
+	socket := fs.String("admin-socket", admin.DefaultSocket, "Local admin API unix socket")
+	dockerEnable := fs.Bool("docker", true, "Enable Docker monitoring")
+	portsEnable := fs.Bool("ports", true, "Enable port monitoring")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*once {
+		return fmt.Errorf("目前仅支持 collect --once")
+	}
+
+	if admin.Available(*socket) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		result, err := admin.NewClient(*socket).Collect(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(result)
+	}
+
+	coll := collector.NewCollector(&collector.Config{
+		EnableDocker: *dockerEnable,
+		EnablePorts:  *portsEnable,
+	})
+	return printJSON(coll.Collect())
+}
+
+// cmdTestConnection 未指定参数且 Agent 在运行时使用其配置，否则按命令行参数测试
+func cmdTestConnection(args []string) error {
+	fs := flag.NewFlagSet("test-connection", flag.ContinueOnError)
+	rf := registerRunFlags(fs)
+	asJSON := fs.Bool("json", false, "Print as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var report *reporter.ConnectionReport
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "json" && f.Name != "admin-socket" {
+			explicit = true
+		}
+	})
+	if !explicit && admin.Available(*rf.adminSocket) {
+		var err error
+		if report, err = admin.NewClient(*rf.adminSocket).TestConnection(ctx); err != nil {
+			return err
+		}
+	} else {
+		report = reporter.TestConnection(ctx, *rf.serverAddr, rf.agentID(), rf.transport())
+	}
+
+	if *asJSON {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Server: %s  Agent ID: %s  TLS: %v\n", report.Server, report.AgentID, report.TLS)
+		for _, step := range report.Steps {
+			mark := "OK  "
+			if !step.OK {
+				mark = "FAIL"
+			}
+			fmt.Printf("  [%s] %-12s %s\n", mark, step.Name, step.Detail)
+		}
+	}
+	if !report.OK() {
+		return fmt.Errorf("连接测试未通过")
+	}
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), time.Since(t).Truncate(time.Second))
+}
+
 // startHeartbeat 启动心跳
 func startHeartbeat(ctx context.Context, rep *reporter.Reporter, agentID string) {
 	ticker := time.NewTicker(30 * time.Second)
@@ -128,23 +441,16 @@ func startMetricsCollection(ctx context.Context, rep *reporter.Reporter, coll *c
 	}
 }
 
-// startTaskExecutor 启动任务执行器
+// startTaskExecutor 保持命令流，断开后间隔重连
 func startTaskExecutor(ctx context.Context, rep *reporter.Reporter) {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
-
 	for {
+		if err := rep.ServeCommands(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("命令流断开: %v, %d秒后重连...", err, 5)
+		}
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			tasks, err := rep.ReceiveTasks(ctx)
-			if err != nil {
-				continue
-			}
-			for _, task := range tasks {
-				go rep.ExecuteTask(ctx, task)
-			}
+		case <-time.After(5 * time.Second):
 		}
 	}
 }
@@ -0,0 +1,216 @@
+package prober
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxBodyBytes 响应体最多返回的字节数
+const maxBodyBytes = 64 << 10
+
+const defaultTimeout = 10 * time.Second
+
+// Spec 服务端下发的拨测参数，与服务端 synthetic.Spec 一致
+type Spec struct {
+	Type            string            `json:"type"` // http, tcp, dns, tls
+	Target          string            `json:"target"`
+	Timeout         int               `json:"timeout"` // 秒
+	Method          string            `json:"method,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body,omitempty"`
+	FollowRedirects bool              `json:"followRedirects,omitempty"`
+	SkipVerify      bool              `json:"skipVerify,omitempty"`
+	RecordType      string            `json:"recordType,omitempty"`
+	Resolver        string            `json:"resolver,omitempty"`
+}
+
+// Observation 拨测的原始结果，断言由服务端判断
+type Observation struct {
+	Error        string            `json:"error,omitempty"`
+	Latency      int64             `json:"latency"` // 毫秒
+	StatusCode   int               `json:"statusCode,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	Answers      []string          `json:"answers,omitempty"`
+	CertNotAfter *time.Time        `json:"certNotAfter,omitempty"`
+	CertSubject  string            `json:"certSubject,omitempty"`
+}
+
+// Run 执行一次拨测，目标不可达等错误记录在结果中
+func Run(ctx context.Context, s *Spec) *Observation {
+	timeout := time.Duration(s.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	obs := &Observation{}
+	var err error
+	switch s.Type {
+	case "http":
+		err = probeHTTP(ctx, s, obs)
+	case "tcp":
+		var conn net.Conn
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", s.Target)
+		if err == nil {
+			conn.Close()
+		}
+	case "tls":
+		err = probeTLS(ctx, s, obs)
+	case "dns":
+		err = probeDNS(ctx, s, obs)
+	default:
+		err = fmt.Errorf("不支持的拨测类型 %s", s.Type)
+	}
+	obs.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		obs.Error = err.Error()
+	}
+	return obs
+}
+
+func probeHTTP(ctx context.Context, s *Spec, obs *Observation) error {
+	method := s.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if s.Body != "" {
+		body = strings.NewReader(s.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.Target, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range s.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: s.SkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+	if !s.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	obs.StatusCode = resp.StatusCode
+	obs.Body = string(data)
+	obs.Headers = make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		obs.Headers[k] = resp.Header.Get(k)
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		obs.CertNotAfter = &cert.NotAfter
+		obs.CertSubject = cert.Subject.CommonName
+	}
+	return nil
+}
+
+func probeTLS(ctx context.Context, s *Spec, obs *Observation) error {
+	host, _, _ := net.SplitHostPort(s.Target)
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: host, InsecureSkipVerify: s.SkipVerify}}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("服务端未提供证书")
+	}
+	cert := state.PeerCertificates[0]
+	obs.CertNotAfter = &cert.NotAfter
+	obs.CertSubject = cert.Subject.CommonName
+	return nil
+}
+
+func probeDNS(ctx context.Context, s *Spec, obs *Observation) error {
+	resolver := &net.Resolver{}
+	if s.Resolver != "" {
+		resolver.PreferGo = true
+		resolver.Dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, s.Resolver)
+		}
+	}
+
+	var answers []string
+	switch s.RecordType {
+	case "", "A", "AAAA":
+		network := "ip4"
+		if s.RecordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, s.Target)
+		if err != nil {
+			return err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		records, err := resolver.LookupMX(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			answers = append(answers, r.Host)
+		}
+	case "TXT":
+		records, err := resolver.LookupTXT(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		answers = records
+	case "NS":
+		records, err := resolver.LookupNS(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			answers = append(answers, r.Host)
+		}
+	default:
+		return fmt.Errorf("不支持的记录类型 %s", s.RecordType)
+	}
+	if len(answers) == 0 {
+		return errors.New("没有解析结果")
+	}
+	obs.Answers = answers
+	return nil
+}
@@ -3,14 +3,18 @@ package reporter
 import (
 	"agent/collector"
 	"agent/executor"
+	"agent/prober"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 // Reporter 上报器
@@ -20,6 +24,18 @@ type Reporter struct {
 	collector  *collector.Collector
 	executor   *executor.Executor
 	conn       *grpc.ClientConn
+	transport  *TransportConfig
+
+	// 运行状态，供本地管理接口查询
+	mu            sync.Mutex
+	startedAt     time.Time
+	version       string
+	configVersion string
+	lastHeartbeat time.Time
+	lastReport    time.Time
+	lastError     string
+	lastErrorAt   time.Time
+	spool         []*MetricsRequest
 }
 
 // NewReporter 创建上报器
@@ -29,14 +45,31 @@ func NewReporter(serverAddr, agentID string, coll *collector.Collector, exec *ex
 		agentID:    agentID,
 		collector:  coll,
 		executor:   exec,
+		transport:  &TransportConfig{},
+		startedAt:  time.Now(),
 	}
 }
 
+// SetTransport 设置 TLS 与认证配置，需在 Connect 前调用
+func (r *Reporter) SetTransport(cfg *TransportConfig) {
+	if cfg != nil {
+		r.transport = cfg
+	}
+}
+
+// SetVersion 设置 Agent 版本和配置版本
+func (r *Reporter) SetVersion(version, configVersion string) {
+	r.mu.Lock()
+	r.version = version
+	r.configVersion = configVersion
+	r.mu.Unlock()
+}
+
 // Connect 连接服务器
 func (r *Reporter) Connect() error {
-	conn, err := grpc.NewClient(r.serverAddr, 
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := dial(context.Background(), r.serverAddr, r.transport, false)
 	if err != nil {
+		r.recordError(err)
 		return fmt.Errorf("连接失败: %w", err)
 	}
 	r.conn = conn
@@ -51,7 +84,59 @@ func (r *Reporter) Close() error {
 	return nil
 }
 
-// SendHeartbeat 发送心跳
+// Enrolled 是否已保存注册密钥
+func (r *Reporter) Enrolled() bool {
+	return r.transport.secret() != ""
+}
+
+// Enroll 使用注册令牌向服务端注册，并将返回的密钥写入密钥文件，此后的请求用该密钥签名
+// tenantID 为服务端新建服务器记录时的所属租户
+func (r *Reporter) Enroll(ctx context.Context, tenantID string) error {
+	if r.conn == nil {
+		return fmt.Errorf("未连接")
+	}
+
+	result := r.collector.Collect()
+
+	r.mu.Lock()
+	version := r.version
+	r.mu.Unlock()
+
+	req := &RegisterRequest{
+		AgentId:  r.agentID,
+		Ip:       localIP(r.serverAddr),
+		Hostname: result.Hostname,
+		Os:       result.OS,
+		Arch:     result.Arch,
+		CpuCores: uint32(result.CPUCores),
+		Version:  version,
+		TenantId: tenantID,
+	}
+
+	var resp RegisterResponse
+	if err := r.invoke(ctx, registerAgentMethod, req, &resp); err != nil {
+		r.recordError(err)
+		return err
+	}
+	if !resp.Success {
+		err := fmt.Errorf("服务端拒绝注册: %s", resp.Message)
+		r.recordError(err)
+		return err
+	}
+	if resp.Secret == "" {
+		err := fmt.Errorf("服务端未返回密钥")
+		r.recordError(err)
+		return err
+	}
+	if err := r.transport.saveSecret(resp.Secret); err != nil {
+		r.recordError(err)
+		return err
+	}
+	log.Printf("注册成功: server=%d, agent=%d", resp.ServerId, resp.AgentId)
+	return nil
+}
+
+// SendHeartbeat 发送心跳，服务端确认后才记为成功
 func (r *Reporter) SendHeartbeat(ctx context.Context) error {
 	if r.conn == nil {
 		return fmt.Errorf("未连接")
@@ -60,35 +145,41 @@ func (r *Reporter) SendHeartbeat(ctx context.Context) error {
 	// 采集当前状态
 	result := r.collector.Collect()
 
-	// 构建心跳请求
+	r.mu.Lock()
+	version := r.version
+	r.mu.Unlock()
+
 	req := &HeartbeatRequest{
-		AgentId:   r.agentID,
-		Timestamp: time.Now().Unix(),
-		Status: &AgentStatus{
-			CpuUsage:     result.CPUUsage,
-			MemoryUsage:  result.MemoryUsage,
-			DiskUsage:    result.DiskUsage,
-			ProcessCount: int32(result.ProcessCount),
-		},
+		AgentId:        r.agentID,
+		Version:        version,
+		Platform:       result.OS,
+		Arch:           result.Arch,
+		UptimeSeconds:  int64(time.Since(r.startedAt).Seconds()),
+		CpuUsage:       result.CPUUsage,
+		MemoryUsage:    result.MemoryUsage,
+		GoroutineCount: int32(runtime.NumGoroutine()),
 	}
 
-	// 发送心跳（这里简化处理，实际应使用 gRPC）
-	log.Printf("心跳: CPU=%.1f%%, 内存=%.1f%%, 磁盘=%.1f%%", 
-		result.CPUUsage, result.MemoryUsage, result.DiskUsage)
+	var resp HeartbeatResponse
+	if err := r.invoke(ctx, heartbeatMethod, req, &resp); err != nil {
+		r.recordError(err)
+		return err
+	}
+	if !resp.Success {
+		err := fmt.Errorf("服务端拒绝心跳: %s", resp.Message)
+		r.recordError(err)
+		return err
+	}
 
-	// TODO: 实际 gRPC 调用
-	// client := pb.NewAgentServiceClient(r.conn)
-	// _, err := client.Heartbeat(ctx, req)
+	r.mu.Lock()
+	r.lastHeartbeat = time.Now()
+	r.mu.Unlock()
 
 	return nil
 }
 
 // ReportMetrics 上报指标
 func (r *Reporter) ReportMetrics(ctx context.Context, result *collector.CollectResult) error {
-	if r.conn == nil {
-		return fmt.Errorf("未连接")
-	}
-
 	// 构建指标请求
 	req := &MetricsRequest{
 		AgentId:   r.agentID,
@@ -96,16 +187,64 @@ func (r *Reporter) ReportMetrics(ctx context.Context, result *collector.CollectR
 		Metrics:   r.buildMetrics(result),
 	}
 
-	// 发送指标（简化处理）
-	log.Printf("上报指标: %d 项", len(req.Metrics))
+	// 未连接时暂存，恢复后补报
+	if r.conn == nil {
+		r.spoolPush(req)
+		err := fmt.Errorf("未连接")
+		r.recordError(err)
+		return err
+	}
 
-	// TODO: 实际 gRPC 调用
-	// client := pb.NewAgentServiceClient(r.conn)
-	// _, err := client.ReportMetrics(ctx, req)
+	// 按时间顺序补报，遇到失败时其余批次连同本次一起放回暂存
+	batches := append(r.spoolDrain(), req)
+	for i, batch := range batches {
+		if err := r.sendMetrics(ctx, batch); err != nil {
+			for _, rest := range batches[i:] {
+				r.spoolPush(rest)
+			}
+			r.recordError(err)
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.lastReport = time.Now()
+	r.mu.Unlock()
 
 	return nil
 }
 
+// sendMetrics 发送一次指标，服务端按 server_metrics 的字段解析 MetricsJson
+func (r *Reporter) sendMetrics(ctx context.Context, req *MetricsRequest) error {
+	fields := make(map[string]interface{}, len(req.Metrics)+1)
+	for _, m := range req.Metrics {
+		if key, ok := metricFields[m.Name]; ok {
+			fields[key] = m.Value
+		}
+	}
+	// 使用采集时间，补报的数据不会被记到当前时刻
+	fields["createdAt"] = time.Unix(req.Timestamp, 0)
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	var resp MetricsResponse
+	if err := r.invoke(ctx, reportMetricsMethod, &reportMetricsRequest{AgentId: req.AgentId, MetricsJson: string(data)}, &resp); err != nil {
+		return err
+	}
+	if !resp.Success {
+		return fmt.Errorf("服务端未接收指标: %s", resp.Message)
+	}
+	return nil
+}
+
+// invoke 附加认证元数据后调用服务端一元接口
+func (r *Reporter) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	return r.conn.Invoke(authContext(ctx, r.agentID, method, r.transport), method, req, resp)
+}
+
 // buildMetrics 构建指标列表
 func (r *Reporter) buildMetrics(result *collector.CollectResult) []*Metric {
 	var metrics []*Metric
@@ -175,47 +314,120 @@ func (r *Reporter) buildMetrics(result *collector.CollectResult) []*Metric {
 	return metrics
 }
 
-// ReceiveTasks 接收任务
-func (r *Reporter) ReceiveTasks(ctx context.Context) ([]*Task, error) {
+// ServeCommands 打开命令流，执行服务端下发的命令和拨测并回报结果，流断开时返回
+func (r *Reporter) ServeCommands(ctx context.Context) error {
 	if r.conn == nil {
-		return nil, fmt.Errorf("未连接")
+		return fmt.Errorf("未连接")
 	}
 
-	// TODO: 实际 gRPC 调用
-	// client := pb.NewAgentServiceClient(r.conn)
-	// resp, err := client.ReceiveTasks(ctx, &TaskRequest{AgentId: r.agentID})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := r.conn.NewStream(authContext(ctx, r.agentID, commandStreamMethod, r.transport),
+		&grpc.StreamDesc{StreamName: "CommandStream", ServerStreams: true, ClientStreams: true}, commandStreamMethod)
+	if err != nil {
+		r.recordError(err)
+		return err
+	}
 
-	return nil, nil
+	cs := &commandStream{stream: stream}
+	// 首条消息不带 CommandId，仅用于登记会话
+	if err := cs.send(&CommandStreamRequest{AgentId: r.agentID}); err != nil {
+		r.recordError(err)
+		return err
+	}
+	log.Printf("命令流已建立")
+
+	for {
+		var resp CommandStreamResponse
+		if err := stream.RecvMsg(&resp); err != nil {
+			if ctx.Err() == nil {
+				r.recordError(err)
+			}
+			return err
+		}
+		// 其余消息是服务端对回报的确认
+		if resp.Message != "execute" || resp.CommandId == "" {
+			continue
+		}
+		cs.send(&CommandStreamRequest{AgentId: r.agentID, CommandId: resp.CommandId, Status: commandStatusAccepted})
+		go r.handleCommand(ctx, cs, &resp)
+	}
 }
 
-// ExecuteTask 执行任务
-func (r *Reporter) ExecuteTask(ctx context.Context, task *Task) error {
-	log.Printf("执行任务 [%d]: %s", task.Id, task.Action)
+// handleCommand 执行一条下发的命令并回报最终状态
+func (r *Reporter) handleCommand(ctx context.Context, cs *commandStream, cmd *CommandStreamResponse) {
+	task := &Task{Type: cmd.Type, Action: cmd.Command, Timeout: cmd.Timeout}
+	log.Printf("执行命令 [%s]: type=%s", cmd.CommandId, task.Type)
+	result := r.runTask(ctx, task)
 
-	startTime := time.Now()
-	result := r.executor.Execute(ctx, task.Action, int(task.Timeout))
-
-	// 上报任务结果
-	taskResult := &TaskResult{
-		TaskId:      task.Id,
-		AgentId:     r.agentID,
-		Success:     result.Success,
-		Output:      result.Output,
-		Error:       result.Error,
-		Duration:    result.Duration,
-		CompletedAt: time.Now().Unix(),
+	status := commandStatusSuccess
+	output := result.Output
+	if !result.Success {
+		status = commandStatusFailed
+		if result.Error != "" {
+			output = strings.TrimRight(output, "\n") + "\n" + result.Error
+		}
+	}
+	// 服务端拒收超过上限的回报，保留末尾，错误信息通常在最后
+	if len(output) > maxCommandOutput {
+		output = output[len(output)-maxCommandOutput:]
+		for len(output) > 0 && !utf8.RuneStart(output[0]) {
+			output = output[1:]
+		}
 	}
+	log.Printf("命令完成 [%s]: status=%s, duration=%dms", cmd.CommandId, status, result.Duration)
 
-	// TODO: 上报结果
-	log.Printf("任务完成 [%d]: success=%v, duration=%dms", 
-		task.Id, result.Success, time.Since(startTime).Milliseconds())
+	err := cs.send(&CommandStreamRequest{
+		AgentId:   r.agentID,
+		CommandId: cmd.CommandId,
+		Status:    status,
+		Output:    output,
+		ExitCode:  int32(result.ExitCode),
+	})
+	if err != nil {
+		log.Printf("回报命令结果失败 [%s]: %v", cmd.CommandId, err)
+	}
+}
 
-	// 如果任务执行失败，记录错误
-	if !result.Success {
-		log.Printf("任务执行失败 [%d]: %s", task.Id, result.Error)
+// runTask 按任务类型执行拨测或 Shell 命令
+func (r *Reporter) runTask(ctx context.Context, task *Task) *executor.ExecuteResult {
+	if task.Type != TaskTypeProbe {
+		return r.executor.Execute(ctx, task.Action, int(task.Timeout))
 	}
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(task.Timeout)*time.Second)
+		defer cancel()
+	}
+	return r.runProbe(ctx, task.Action)
+}
 
-	return nil
+// commandStream 命令流，回报可能来自多个执行中的命令，发送需串行
+type commandStream struct {
+	mu     sync.Mutex
+	stream grpc.ClientStream
+}
+
+func (c *commandStream) send(req *CommandStreamRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stream.SendMsg(req)
+}
+
+// runProbe 执行拨测任务，Action 为拨测参数(JSON)，观测结果以 JSON 作为输出交由服务端判断
+func (r *Reporter) runProbe(ctx context.Context, action string) *executor.ExecuteResult {
+	result := &executor.ExecuteResult{StartTime: time.Now()}
+	var spec prober.Spec
+	if err := json.Unmarshal([]byte(action), &spec); err != nil {
+		result.Error = "拨测参数错误: " + err.Error()
+	} else {
+		output, _ := json.Marshal(prober.Run(ctx, &spec))
+		result.Success = true
+		result.Output = string(output)
+	}
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime).Milliseconds()
+	return result
 }
 
 // SendLog 发送日志
@@ -274,16 +486,46 @@ func (r *Reporter) ReportPorts(ctx context.Context, ports []collector.PortInfo)
 // Proto 结构定义（简化版本）
 
 type HeartbeatRequest struct {
-	AgentId   string        `json:"agentId"`
-	Timestamp int64         `json:"timestamp"`
-	Status    *AgentStatus  `json:"status"`
+	AgentId        string  `json:"agentId"`
+	Ip             string  `json:"ip"`
+	Port           int32   `json:"port"`
+	Version        string  `json:"version"`
+	Platform       string  `json:"platform"`
+	Arch           string  `json:"arch"`
+	UptimeSeconds  int64   `json:"uptimeSeconds"`
+	CpuUsage       float64 `json:"cpuUsage"`
+	MemoryUsage    float64 `json:"memoryUsage"`
+	GoroutineCount int32   `json:"goroutineCount"`
 }
 
-type AgentStatus struct {
-	CpuUsage     float64 `json:"cpuUsage"`
-	MemoryUsage  float64 `json:"memoryUsage"`
-	DiskUsage    float64 `json:"diskUsage"`
-	ProcessCount int32   `json:"processCount"`
+type HeartbeatResponse struct {
+	Success       bool   `json:"success"`
+	Message       string `json:"message"`
+	NeedUpgrade   bool   `json:"needUpgrade"`
+	UpgradeTaskId uint32 `json:"upgradeTaskId"`
+	TargetVersion string `json:"targetVersion"`
+}
+
+// RegisterRequest 注册请求
+type RegisterRequest struct {
+	AgentId  string `json:"agentId"`
+	Ip       string `json:"ip"`
+	Hostname string `json:"hostname"`
+	Os       string `json:"os"`
+	Arch     string `json:"arch"`
+	Kernel   string `json:"kernel"`
+	CpuCores uint32 `json:"cpuCores"`
+	Version  string `json:"version"`
+	TenantId string `json:"tenantId"`
+}
+
+// RegisterResponse 注册响应，Secret 为之后签名请求使用的密钥
+type RegisterResponse struct {
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+	ServerId uint32 `json:"serverId"`
+	AgentId  uint32 `json:"agentId"`
+	Secret   string `json:"secret"`
 }
 
 type MetricsRequest struct {
@@ -298,6 +540,39 @@ type Metric struct {
 	Type  string  `json:"type"`
 }
 
+// reportMetricsRequest ReportMetrics 接口的请求，MetricsJson 为一条 server_metrics 记录
+type reportMetricsRequest struct {
+	AgentId     string `json:"agentId"`
+	MetricsJson string `json:"metricsJson"`
+}
+
+type MetricsResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// metricFields 指标名对应服务端 server_metrics 记录的 JSON 字段，未列出的指标不上报
+var metricFields = map[string]string{
+	"cpu_usage":     "cpuUsage",
+	"cpu_user":      "cpuUser",
+	"cpu_system":    "cpuSystem",
+	"memory_usage":  "memoryUsage",
+	"memory_used":   "memoryUsed",
+	"memory_free":   "memoryFree",
+	"disk_usage":    "diskUsage",
+	"disk_used":     "diskUsed",
+	"disk_free":     "diskFree",
+	"net_in":        "netIn",
+	"net_out":       "netOut",
+	"load1":         "load1",
+	"load5":         "load5",
+	"load15":        "load15",
+	"process_count": "processCount",
+}
+
+// TaskTypeProbe 拨测任务，其余类型作为 Shell 命令执行
+const TaskTypeProbe = "probe"
+
 type Task struct {
 	Id        int64  `json:"id"`
 	Type      string `json:"type"`
@@ -306,14 +581,33 @@ type Task struct {
 	CreatedAt int64  `json:"createdAt"`
 }
 
-type TaskResult struct {
-	TaskId      int64  `json:"taskId"`
-	AgentId     string `json:"agentId"`
-	Success     bool   `json:"success"`
-	Output      string `json:"output"`
-	Error       string `json:"error"`
-	Duration    int64  `json:"duration"`
-	CompletedAt int64  `json:"completedAt"`
+// 命令流中回报的状态，accepted 表示已收到，其余为最终结果
+const (
+	commandStatusAccepted = "accepted"
+	commandStatusSuccess  = "success"
+	commandStatusFailed   = "failed"
+)
+
+// maxCommandOutput 单条命令回报的输出上限，与服务端校验一致
+const maxCommandOutput = 1 << 20
+
+// CommandStreamRequest Agent 在命令流中回报的命令状态
+type CommandStreamRequest struct {
+	AgentId   string `json:"agentId"`
+	CommandId string `json:"commandId"`
+	Status    string `json:"status"`
+	Output    string `json:"output"`
+	ExitCode  int32  `json:"exitCode"`
+}
+
+// CommandStreamResponse 服务端在命令流中下发的消息，Message 为 execute 时是待执行的命令
+type CommandStreamResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	CommandId string `json:"commandId"`
+	Type      string `json:"type,omitempty"`
+	Command   string `json:"command,omitempty"`
+	Timeout   int32  `json:"timeout,omitempty"`
 }
 
 type LogEntry struct {
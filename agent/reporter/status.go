@@ -0,0 +1,78 @@
+package reporter
+
+import (
+	"time"
+)
+
+// maxSpoolSize 断线期间最多暂存的指标批次，超出后丢弃最旧的
+const maxSpoolSize = 1000
+
+// Status Agent 运行状态
+type Status struct {
+	AgentID       string    `json:"agentId"`
+	Version       string    `json:"version"`
+	ConfigVersion string    `json:"configVersion"`
+	Server        string    `json:"server"`
+	TLS           bool      `json:"tls"`
+	Connection    string    `json:"connection"` // IDLE, CONNECTING, READY, TRANSIENT_FAILURE, SHUTDOWN, DISCONNECTED
+	StartedAt     time.Time `json:"startedAt"`
+	Uptime        string    `json:"uptime"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+	LastReport    time.Time `json:"lastReport"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorAt   time.Time `json:"lastErrorAt"`
+	SpoolDepth    int       `json:"spoolDepth"`
+}
+
+// Status 获取运行状态
+func (r *Reporter) Status() *Status {
+	connection := "DISCONNECTED"
+	if r.conn != nil {
+		connection = r.conn.GetState().String()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Status{
+		AgentID:       r.agentID,
+		Version:       r.version,
+		ConfigVersion: r.configVersion,
+		Server:        r.serverAddr,
+		TLS:           r.transport.TLS,
+		Connection:    connection,
+		StartedAt:     r.startedAt,
+		Uptime:        time.Since(r.startedAt).Truncate(time.Second).String(),
+		LastHeartbeat: r.lastHeartbeat,
+		LastReport:    r.lastReport,
+		LastError:     r.lastError,
+		LastErrorAt:   r.lastErrorAt,
+		SpoolDepth:    len(r.spool),
+	}
+}
+
+// recordError 记录最近一次错误
+func (r *Reporter) recordError(err error) {
+	r.mu.Lock()
+	r.lastError = err.Error()
+	r.lastErrorAt = time.Now()
+	r.mu.Unlock()
+}
+
+// spoolPush 暂存未能上报的指标
+func (r *Reporter) spoolPush(req *MetricsRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.spool) >= maxSpoolSize {
+		r.spool = r.spool[1:]
+	}
+	r.spool = append(r.spool, req)
+}
+
+// spoolDrain 取出全部暂存指标
+func (r *Reporter) spoolDrain() []*MetricsRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := r.spool
+	r.spool = nil
+	return pending
+}
@@ -0,0 +1,290 @@
+package reporter
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// 服务端认证元数据，与服务端约定一致
+const (
+	metadataAgentID     = "x-agent-id"
+	metadataTimestamp   = "x-agent-timestamp"
+	metadataSignature   = "x-agent-signature"
+	metadataEnrollToken = "x-enroll-token"
+)
+
+// 服务端接口
+const (
+	heartbeatMethod     = "/AgentService/Heartbeat"
+	reportMetricsMethod = "/AgentService/ReportMetrics"
+	commandStreamMethod = "/AgentService/CommandStream"
+	registerAgentMethod = "/AgentService/RegisterAgent"
+	// checkUpgradeMethod 连接测试使用的只读接口
+	checkUpgradeMethod = "/AgentService/CheckUpgrade"
+)
+
+// TransportConfig 连接配置
+type TransportConfig struct {
+	TLS         bool   // 启用 TLS
+	CAFile      string // 校验服务端证书的 CA，为空时使用系统根证书
+	CertFile    string // 客户端证书，服务端为 mtls 模式时必填
+	KeyFile     string
+	ServerName  string // 覆盖证书校验的主机名
+	SecretFile  string // 注册后保存的 Agent 密钥
+	EnrollToken string // 首次注册令牌
+}
+
+// jsonCodec 服务端消息为普通结构体，使用 JSON 编解码
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                               { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// credentials 构建传输层凭证
+func (c *TransportConfig) credentials() (credentials.TransportCredentials, error) {
+	if !c.TLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		caPEM, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA 文件中没有有效证书: %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// secret 读取 Agent 密钥
+func (c *TransportConfig) secret() string {
+	if c.SecretFile == "" {
+		return ""
+	}
+	data, err := os.ReadFile(c.SecretFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// saveSecret 保存注册返回的密钥，仅运行用户可读
+func (c *TransportConfig) saveSecret(secret string) error {
+	if c.SecretFile == "" {
+		return fmt.Errorf("未配置密钥文件")
+	}
+	if err := os.MkdirAll(filepath.Dir(c.SecretFile), 0700); err != nil {
+		return fmt.Errorf("创建密钥目录失败: %w", err)
+	}
+	// 先写临时文件再改名，避免中途退出留下不完整的密钥
+	tmp := c.SecretFile + ".tmp"
+	os.Remove(tmp)
+	if err := os.WriteFile(tmp, []byte(secret+"\n"), 0600); err != nil {
+		return fmt.Errorf("写入密钥失败: %w", err)
+	}
+	if err := os.Rename(tmp, c.SecretFile); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入密钥失败: %w", err)
+	}
+	return nil
+}
+
+// localIP 连接服务端时使用的本机地址，服务端据此关联服务器记录
+func localIP(addr string) string {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if udp, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return udp.IP.String()
+	}
+	return ""
+}
+
+// dial 建立连接，block 为 true 时等待握手完成并返回握手错误
+func dial(ctx context.Context, addr string, cfg *TransportConfig, block bool) (*grpc.ClientConn, error) {
+	creds, err := cfg.credentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(jsonCodec{}.Name())),
+	}
+	if block {
+		opts = append(opts, grpc.WithBlock(), grpc.WithReturnConnectionError())
+	}
+	return grpc.DialContext(ctx, addr, opts...)
+}
+
+// signRequest 请求签名: hex(HMAC-SHA256(secret, agentID + "\n" + timestamp + "\n" + method))
+func signRequest(secret, agentID string, timestamp int64, method string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(agentID + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + method))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authContext 附加认证元数据
+func authContext(ctx context.Context, agentID, method string, cfg *TransportConfig) context.Context {
+	pairs := []string{metadataAgentID, agentID}
+	if secret := cfg.secret(); secret != "" {
+		ts := time.Now().Unix()
+		pairs = append(pairs,
+			metadataTimestamp, strconv.FormatInt(ts, 10),
+			metadataSignature, signRequest(secret, agentID, ts, method))
+	}
+	if cfg.EnrollToken != "" {
+		pairs = append(pairs, metadataEnrollToken, cfg.EnrollToken)
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// ==================== 连接测试 ====================
+
+// CheckStep 连接测试步骤
+type CheckStep struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// ConnectionReport 连接测试结果
+type ConnectionReport struct {
+	Server        string      `json:"server"`
+	AgentID       string      `json:"agentId"`
+	TLS           bool        `json:"tls"`
+	TLSVersion    string      `json:"tlsVersion,omitempty"`
+	Reachable     bool        `json:"reachable"`
+	Authenticated bool        `json:"authenticated"`
+	LatencyMs     int64       `json:"latencyMs"`
+	Steps         []CheckStep `json:"steps"`
+}
+
+// OK 全部检查通过
+func (c *ConnectionReport) OK() bool {
+	return c.Reachable && c.Authenticated
+}
+
+func (c *ConnectionReport) step(name string, ok bool, format string, args ...interface{}) {
+	c.Steps = append(c.Steps, CheckStep{Name: name, OK: ok, Detail: fmt.Sprintf(format, args...)})
+}
+
+// TestConnection 使用当前配置测试连接
+func (r *Reporter) TestConnection(ctx context.Context) *ConnectionReport {
+	return TestConnection(ctx, r.serverAddr, r.agentID, r.transport)
+}
+
+// TestConnection 测试到服务端的连接、TLS 握手和认证
+func TestConnection(ctx context.Context, addr, agentID string, cfg *TransportConfig) *ConnectionReport {
+	report := &ConnectionReport{Server: addr, AgentID: agentID, TLS: cfg.TLS}
+
+	if _, err := cfg.credentials(); err != nil {
+		report.step("credentials", false, "%v", err)
+		return report
+	}
+	if cfg.TLS {
+		report.step("credentials", true, "证书加载成功")
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	conn, err := dial(dialCtx, addr, cfg, true)
+	if err != nil {
+		report.step("connect", false, "%v", err)
+		return report
+	}
+	defer conn.Close()
+	report.Reachable = true
+	report.LatencyMs = time.Since(start).Milliseconds()
+	report.step("connect", true, "握手耗时 %dms", report.LatencyMs)
+
+	// 用只读接口验证认证
+	callCtx, cancelCall := context.WithTimeout(ctx, 10*time.Second)
+	defer cancelCall()
+	var p peer.Peer
+	var resp struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	err = conn.Invoke(authContext(callCtx, agentID, checkUpgradeMethod, cfg), checkUpgradeMethod,
+		map[string]string{"agentId": agentID}, &resp, grpc.Peer(&p))
+
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		report.TLSVersion = tls.VersionName(info.State.Version)
+		report.step("tls", true, "%s, 服务端证书 %s", report.TLSVersion, peerCertSubject(info))
+	}
+
+	if err != nil {
+		st := status.Convert(err)
+		switch st.Code() {
+		case codes.Unauthenticated:
+			hint := ""
+			if cfg.secret() == "" && cfg.CertFile == "" {
+				hint = "（未找到 Agent 密钥或客户端证书）"
+			}
+			report.step("auth", false, "认证失败: %s%s", st.Message(), hint)
+		case codes.PermissionDenied:
+			report.step("auth", false, "无权限: %s", st.Message())
+		case codes.ResourceExhausted:
+			report.Authenticated = true
+			report.step("auth", true, "认证通过，但被限流: %s", st.Message())
+		default:
+			report.step("auth", false, "%s: %s", st.Code(), st.Message())
+		}
+		return report
+	}
+
+	report.Authenticated = true
+	report.step("auth", true, "认证通过")
+	return report
+}
+
+func peerCertSubject(info credentials.TLSInfo) string {
+	if len(info.State.PeerCertificates) == 0 {
+		return "-"
+	}
+	return info.State.PeerCertificates[0].Subject.CommonName
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// 安装路径
+const (
+	ServiceName = "yunwei-agent"
+	ServiceUser = "yunwei-agent"
+	BinaryPath  = "/usr/local/bin/yunwei-agent"
+	ConfigDir   = "/etc/yunwei-agent"
+	StateDir    = "/var/lib/yunwei-agent"
+	UnitPath    = "/etc/systemd/system/yunwei-agent.service"
+)
+
+// InstallOptions 安装选项
+type InstallOptions struct {
+	Args  []string // 运行参数，写入 ExecStart
+	Start bool     // 安装后立即启动
+}
+
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=YunWei Ops Agent
+Documentation=https://github.com/fredphp/yunwei
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+User={{.User}}
+Group={{.User}}
+{{- range .SupplementaryGroups}}
+SupplementaryGroups={{.}}
+{{- end}}
+ExecStart={{.ExecStart}}
+Restart=always
+RestartSec=5
+RuntimeDirectory={{.Name}}
+RuntimeDirectoryMode=0750
+StateDirectory={{.Name}}
+ConfigurationDirectory={{.Name}}
+NoNewPrivileges=true
+ProtectSystem=full
+ProtectHome=read-only
+PrivateTmp=true
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// Install 安装为 systemd 服务：创建专用用户、复制二进制、写入 unit 并启用
+func Install(opts InstallOptions, out io.Writer) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return fmt.Errorf("未找到 systemctl，当前系统不支持 systemd")
+	}
+
+	if err := ensureUser(out); err != nil {
+		return err
+	}
+
+	for _, dir := range []string{ConfigDir, StateDir} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return fmt.Errorf("创建目录 %s 失败: %w", dir, err)
+		}
+		if err := run("chown", ServiceUser+":"+ServiceUser, dir); err != nil {
+			return err
+		}
+	}
+
+	if err := copyBinary(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "已安装二进制: %s\n", BinaryPath)
+
+	unit, err := renderUnit(opts.Args)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(UnitPath, unit, 0644); err != nil {
+		return fmt.Errorf("写入 unit 文件失败: %w", err)
+	}
+	fmt.Fprintf(out, "已写入 unit: %s\n", UnitPath)
+
+	if err := run("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	enableArgs := []string{"enable"}
+	if opts.Start {
+		enableArgs = append(enableArgs, "--now")
+	}
+	if err := run("systemctl", append(enableArgs, ServiceName)...); err != nil {
+		return err
+	}
+	if opts.Start {
+		fmt.Fprintf(out, "服务已启用并启动: %s\n", ServiceName)
+	} else {
+		fmt.Fprintf(out, "服务已启用: %s\n", ServiceName)
+	}
+	return nil
+}
+
+// Uninstall 停止并移除服务，purge 时同时删除用户和数据目录
+func Uninstall(purge bool, out io.Writer) error {
+	if err := requireRoot(); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(UnitPath); err == nil {
+		// 服务可能已停止，忽略 disable 的错误
+		run("systemctl", "disable", "--now", ServiceName)
+		if err := os.Remove(UnitPath); err != nil {
+			return fmt.Errorf("删除 unit 文件失败: %w", err)
+		}
+		if err := run("systemctl", "daemon-reload"); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "已移除服务: %s\n", ServiceName)
+	}
+
+	if err := os.Remove(BinaryPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除二进制失败: %w", err)
+	}
+
+	if !purge {
+		return nil
+	}
+	for _, dir := range []string{ConfigDir, StateDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("删除目录 %s 失败: %w", dir, err)
+		}
+	}
+	if _, err := user.Lookup(ServiceUser); err == nil {
+		if err := run("userdel", ServiceUser); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "已删除用户: %s\n", ServiceUser)
+	}
+	return nil
+}
+
+// renderUnit 生成 unit 文件内容
+func renderUnit(args []string) ([]byte, error) {
+	execStart := BinaryPath
+	for _, arg := range args {
+		execStart += " " + quoteArg(arg)
+	}
+
+	var groups []string
+	if _, err := user.LookupGroup("docker"); err == nil {
+		// Docker 监控需要访问 docker.sock
+		groups = append(groups, "docker")
+	}
+
+	var buf bytes.Buffer
+	err := unitTemplate.Execute(&buf, map[string]interface{}{
+		"Name":                ServiceName,
+		"User":                ServiceUser,
+		"ExecStart":           execStart,
+		"SupplementaryGroups": groups,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成 unit 失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// quoteArg 按 systemd 规则给含空白或引号的参数加引号
+func quoteArg(arg string) string {
+	if !strings.ContainsAny(arg, " \t\"'\\$%") {
+		return arg
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(arg) + `"`
+}
+
+// ensureUser 创建系统用户
+func ensureUser(out io.Writer) error {
+	if _, err := user.Lookup(ServiceUser); err == nil {
+		return nil
+	}
+	if err := run("useradd", "--system", "--no-create-home", "--home-dir", StateDir,
+		"--shell", "/usr/sbin/nologin", "--user-group", ServiceUser); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "已创建用户: %s\n", ServiceUser)
+	return nil
+}
+
+// copyBinary 把当前可执行文件复制到安装路径
+func copyBinary() error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("获取可执行文件路径失败: %w", err)
+	}
+	self, _ = filepath.EvalSymlinks(self)
+	if self == BinaryPath {
+		return nil
+	}
+
+	src, err := os.Open(self)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// 先写临时文件再改名，避免覆盖正在运行的二进制
+	tmp := BinaryPath + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("写入二进制失败: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("写入二进制失败: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, BinaryPath)
+}
+
+func requireRoot() error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("需要 root 权限")
+	}
+	return nil
+}
+
+func run(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s 失败: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
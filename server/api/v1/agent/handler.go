@@ -8,6 +8,7 @@ import (
         "yunwei/model/agent"
         "yunwei/model/common/response"
         agentService "yunwei/service/agent"
+        haService "yunwei/service/ha"
 
         "github.com/gin-gonic/gin"
 )
@@ -203,6 +204,47 @@ func BatchOperation(c *gin.Context) {
         response.OkWithData(result, c)
 }
 
+// ExecuteCommand 在 Agent 上执行命令
+// Agent 的命令流可能连接在集群中任一节点，由 Agent 路由转发到所在节点执行
+func ExecuteCommand(c *gin.Context) {
+        id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+        if err != nil {
+                response.FailWithMessage("无效的ID", c)
+                return
+        }
+
+        var req struct {
+                Command string `json:"command" binding:"required"`
+                Timeout int    `json:"timeout"`
+        }
+        if err := c.ShouldBindJSON(&req); err != nil {
+                response.FailWithMessage("参数错误", c)
+                return
+        }
+
+        ag, err := agentManager.GetAgent(uint(id))
+        if err != nil {
+                response.FailWithMessage("Agent不存在", c)
+                return
+        }
+        if ag.Status == agent.AgentStatusDisabled {
+                response.FailWithMessage("Agent已禁用", c)
+                return
+        }
+
+        result, err := haService.GetHAManager().GetAgentRouter().ExecuteCommand(c.Request.Context(), &haService.AgentCommand{
+                AgentID: ag.AgentID,
+                Command: req.Command,
+                Timeout: req.Timeout,
+        })
+        if err != nil {
+                response.FailWithMessage("执行失败: "+err.Error(), c)
+                return
+        }
+
+        response.OkWithData(result, c)
+}
+
 // ==================== 版本管理 ====================
 
 // GetVersionList 获取版本列表
@@ -0,0 +1,97 @@
+package ai
+
+import (
+	"errors"
+	"strconv"
+
+	"yunwei/model/common/response"
+	"yunwei/service/ai/diagnose"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StartDiagnosis 对服务器发起多步诊断，在后台执行，通过 GetDiagnosis 查看每一步和结论
+func StartDiagnosis(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	var req struct {
+		Question string `json:"question"`
+		MaxSteps int    `json:"maxSteps"`
+	}
+	// 请求体可为空
+	_ = c.ShouldBindJSON(&req)
+
+	userID, username := utils.CurrentUser(c)
+	d, err := diagnose.GetService().Start(diagnose.Request{
+		ServerID: uint(id),
+		Question: req.Question,
+		MaxSteps: req.MaxSteps,
+		UserID:   userID,
+		Username: username,
+	})
+	if err != nil {
+		response.FailWithMessage("发起诊断失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(d, c)
+}
+
+// GetDiagnoses 诊断记录
+func GetDiagnoses(c *gin.Context) {
+	serverID, _ := strconv.ParseUint(c.Query("serverId"), 10, 32)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	list, total, err := diagnose.GetService().List(diagnose.Filter{
+		ServerID: uint(serverID),
+		Status:   c.Query("status"),
+		Page:     page,
+		PageSize: pageSize,
+	})
+	if err != nil {
+		response.FailWithMessage("查询失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithPage(list, total, page, pageSize, c)
+}
+
+// GetDiagnosis 诊断详情：每一步的工具调用和最终决策
+func GetDiagnosis(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	d, err := diagnose.GetService().Get(uint(id))
+	if err != nil {
+		response.FailWithMessage("诊断不存在", c)
+		return
+	}
+	response.OkWithData(d, c)
+}
+
+// CancelDiagnosis 取消进行中的诊断
+func CancelDiagnosis(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	if err := diagnose.GetService().Cancel(uint(id)); err != nil {
+		if errors.Is(err, diagnose.ErrNotRunning) {
+			response.FailWithMessage("诊断已结束", c)
+			return
+		}
+		response.FailWithMessage("取消失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithMessage("已取消", c)
+}
+
+// GetDiagnoseTools 模型可调用的诊断工具
+func GetDiagnoseTools(c *gin.Context) {
+	response.OkWithData(diagnose.Tools, c)
+}
@@ -0,0 +1,27 @@
+package ai
+
+import (
+	"yunwei/model/common/response"
+	"yunwei/service/ai/llm"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetProviders 大模型提供方及其熔断状态
+func GetProviders(c *gin.Context) {
+	response.OkWithData(llm.GetManager().Status(), c)
+}
+
+// GetRoutes 各功能实际使用的降级链，传 tenantId 时查看该租户的路由
+func GetRoutes(c *gin.Context) {
+	tenantID := c.Query("tenantId")
+	features := llm.Features
+	if f := c.Query("feature"); f != "" {
+		features = []string{f}
+	}
+	routes := make([]llm.Route, 0, len(features))
+	for _, f := range features {
+		routes = append(routes, llm.GetManager().Route(f, tenantID))
+	}
+	response.OkWithData(routes, c)
+}
@@ -46,6 +46,7 @@ func GetReleaseSteps(c *gin.Context) {
 // StartCanary 开始灰度发布
 func StartCanary(c *gin.Context) {
         var req struct {
+                TenantID    string              `json:"tenantId"`
                 ClusterID   uint                `json:"clusterId" binding:"required"`
                 Namespace   string              `json:"namespace" binding:"required"`
                 ServiceName string              `json:"serviceName" binding:"required"`
@@ -58,7 +59,7 @@ func StartCanary(c *gin.Context) {
         }
 
         manager := canary.NewCanaryManager()
-        release, err := manager.StartCanary(req.ClusterID, req.Namespace, req.ServiceName, req.NewImage, req.Config)
+        release, err := manager.StartCanary(req.TenantID, req.ClusterID, req.Namespace, req.ServiceName, req.NewImage, req.Config)
         if err != nil {
                 response.FailWithMessage(err.Error(), c)
                 return
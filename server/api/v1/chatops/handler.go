@@ -0,0 +1,313 @@
+package chatops
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/chatops"
+	"yunwei/service/security"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audit 记录聊天账号绑定的变更
+func audit(c *gin.Context, action security.AuditAction, command string) {
+	userID, username := utils.CurrentUser(c)
+	security.NewAuditService().LogFromGin(c, security.LogParams{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Resource: "chat_identity",
+		Command:  command,
+		Result:   "success",
+		Details:  map[string]interface{}{},
+	})
+}
+
+// truncate 按字符截断回复，Telegram 回调提示最多 200 个字符
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// ==================== Telegram ====================
+
+type telegramUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+}
+
+func (u telegramUser) sender() chatops.Sender {
+	name := u.Username
+	if name == "" {
+		name = u.FirstName
+	}
+	return chatops.Sender{Platform: chatops.PlatformTelegram, ID: strconv.FormatInt(u.ID, 10), Name: name}
+}
+
+type telegramUpdate struct {
+	Message *struct {
+		MessageID int64        `json:"message_id"`
+		Text      string       `json:"text"`
+		From      telegramUser `json:"from"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+	} `json:"message"`
+	CallbackQuery *struct {
+		ID   string       `json:"id"`
+		Data string       `json:"data"`
+		From telegramUser `json:"from"`
+	} `json:"callback_query"`
+}
+
+// TelegramWebhook 接收 Telegram 机器人的 Update：内联按钮回调和以 / 开头的命令。
+// 结果直接在响应中以 Bot API 方法返回，无需再调用 Telegram 接口
+func TelegramWebhook(c *gin.Context) {
+	if err := chatops.VerifyTelegram(c.GetHeader("X-Telegram-Bot-Api-Secret-Token")); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	var update telegramUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	switch {
+	case update.CallbackQuery != nil:
+		q := update.CallbackQuery
+		text, err := chatops.GetService().Perform(q.From.sender(), q.Data)
+		if err != nil {
+			text = err.Error()
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"method":            "answerCallbackQuery",
+			"callback_query_id": q.ID,
+			"text":              truncate(text, 200),
+			"show_alert":        err != nil,
+		})
+	case update.Message != nil && len(update.Message.Text) > 0 && update.Message.Text[0] == '/':
+		m := update.Message
+		c.JSON(http.StatusOK, gin.H{
+			"method":              "sendMessage",
+			"chat_id":             m.Chat.ID,
+			"text":                chatops.GetService().Command(m.From.sender(), m.Text),
+			"reply_to_message_id": m.MessageID,
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{})
+	}
+}
+
+// ==================== 钉钉 ====================
+
+type dingtalkMessage struct {
+	Text struct {
+		Content string `json:"content"`
+	} `json:"text"`
+	SenderID      string `json:"senderId"`
+	SenderStaffID string `json:"senderStaffId"`
+	SenderNick    string `json:"senderNick"`
+}
+
+// DingTalkWebhook 接收钉钉机器人收到的消息，包括消息链接按钮发回的 /act 操作，
+// 回复在响应中直接返回
+func DingTalkWebhook(c *gin.Context) {
+	if err := chatops.VerifyDingTalk(c.GetHeader("timestamp"), c.GetHeader("sign"), time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	var msg dingtalkMessage
+	if err := c.ShouldBindJSON(&msg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	// 企业内部机器人有 senderStaffId（企业内 userid），其他机器人只有加密的 senderId
+	id := msg.SenderStaffID
+	if id == "" {
+		id = msg.SenderID
+	}
+	sender := chatops.Sender{Platform: chatops.PlatformDingTalk, ID: id, Name: msg.SenderNick}
+	reply := gin.H{
+		"msgtype": "text",
+		"text":    gin.H{"content": chatops.GetService().Command(sender, msg.Text.Content)},
+	}
+	if msg.SenderStaffID != "" {
+		reply["at"] = gin.H{"atUserIds": []string{msg.SenderStaffID}}
+	}
+	c.JSON(http.StatusOK, reply)
+}
+
+// ==================== 飞书 ====================
+
+type feishuCallback struct {
+	// 配置回调地址时的 URL 验证
+	Type      string `json:"type"`
+	Token     string `json:"token"`
+	Challenge string `json:"challenge"`
+
+	// 2.0 版本的卡片回传交互（card.action.trigger）
+	Header struct {
+		EventType string `json:"event_type"`
+		Token     string `json:"token"`
+	} `json:"header"`
+	Event struct {
+		Operator struct {
+			OpenID string `json:"open_id"`
+		} `json:"operator"`
+		Action struct {
+			Value struct {
+				Action string `json:"action"`
+			} `json:"value"`
+		} `json:"action"`
+	} `json:"event"`
+}
+
+// FeishuWebhook 接收飞书卡片按钮的回传交互，结果以 toast 提示。
+// 飞书的消息事件无法在响应中回复，因此飞书中只能使用按钮，不支持命令
+func FeishuWebhook(c *gin.Context) {
+	var cb feishuCallback
+	if err := c.ShouldBindJSON(&cb); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	if cb.Type == "url_verification" {
+		if err := chatops.VerifyFeishu(cb.Token); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"challenge": cb.Challenge})
+		return
+	}
+	if err := chatops.VerifyFeishu(cb.Header.Token); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if cb.Header.EventType != "card.action.trigger" || cb.Event.Action.Value.Action == "" {
+		c.JSON(http.StatusOK, gin.H{})
+		return
+	}
+
+	sender := chatops.Sender{Platform: chatops.PlatformFeishu, ID: cb.Event.Operator.OpenID}
+	text, err := chatops.GetService().Perform(sender, cb.Event.Action.Value.Action)
+	toast := gin.H{"type": "success", "content": text}
+	if err != nil {
+		toast = gin.H{"type": "error", "content": err.Error()}
+	}
+	c.JSON(http.StatusOK, gin.H{"toast": toast})
+}
+
+// ==================== 账号绑定 ====================
+
+// GetIdentities 获取聊天账号绑定列表
+func GetIdentities(c *gin.Context) {
+	var identities []chatops.Identity
+	query := global.DB.Order("id")
+	if platform := c.Query("platform"); platform != "" {
+		query = query.Where("platform = ?", platform)
+	}
+	if userID := c.Query("userId"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	query.Find(&identities)
+	response.OkWithData(identities, c)
+}
+
+// CreateIdentity 绑定聊天账号，同一聊天账号只能绑定一个用户
+func CreateIdentity(c *gin.Context) {
+	var i chatops.Identity
+	if err := c.ShouldBindJSON(&i); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	i.ID = 0
+	if err := i.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	var count int64
+	global.DB.Model(&chatops.Identity{}).Where("platform = ? AND external_id = ?", i.Platform, i.ExternalID).Count(&count)
+	if count > 0 {
+		response.FailWithMessage("该聊天账号已绑定", c)
+		return
+	}
+	if err := global.DB.First(&security.User{}, i.UserID).Error; err != nil {
+		response.FailWithMessage("用户不存在", c)
+		return
+	}
+	if err := global.DB.Create(&i).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	audit(c, security.AuditActionCreate, fmt.Sprintf("#%d %s %s → 用户#%d", i.ID, i.Platform, i.ExternalID, i.UserID))
+
+	response.OkWithData(i, c)
+}
+
+// UpdateIdentity 修改绑定的用户或备注，平台和聊天账号不可修改
+func UpdateIdentity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	var i chatops.Identity
+	if err := global.DB.First(&i, id).Error; err != nil {
+		response.FailWithMessage("绑定不存在", c)
+		return
+	}
+	platform, externalID := i.Platform, i.ExternalID
+	if err := c.ShouldBindJSON(&i); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	i.ID, i.Platform, i.ExternalID = uint(id), platform, externalID
+	if err := i.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.First(&security.User{}, i.UserID).Error; err != nil {
+		response.FailWithMessage("用户不存在", c)
+		return
+	}
+	if err := global.DB.Select("external_name", "user_id", "comment").Updates(&i).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s %s → 用户#%d", i.ID, i.Platform, i.ExternalID, i.UserID))
+
+	response.OkWithData(i, c)
+}
+
+// DeleteIdentity 解除绑定
+func DeleteIdentity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	var i chatops.Identity
+	if err := global.DB.First(&i, id).Error; err != nil {
+		response.FailWithMessage("绑定不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&i).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	audit(c, security.AuditActionDelete, fmt.Sprintf("#%d %s %s", i.ID, i.Platform, i.ExternalID))
+
+	response.OkWithMessage("删除成功", c)
+}
@@ -1,12 +1,16 @@
 package cost
 
 import (
+        "fmt"
         "strconv"
         "time"
 
+        "yunwei/config"
         costModel "yunwei/model/cost"
         "yunwei/model/common/response"
         costService "yunwei/service/cost"
+        "yunwei/service/mail"
+        "yunwei/service/notify"
 
         "github.com/gin-gonic/gin"
 )
@@ -570,6 +574,85 @@ func (h *Handler) ExportCostReport(c *gin.Context) {
         _ = format
 }
 
+// EmailCostReportRequest 邮件发送成本报告请求
+type EmailCostReportRequest struct {
+        To        []string `json:"to"` // 为空时发给通知配置中的默认邮件收件人
+        StartDate string   `json:"start_date"`
+        EndDate   string   `json:"end_date"`
+        Providers []string `json:"providers"`
+}
+
+// EmailCostReport 以邮件发送成本报告，CSV 明细作为附件
+func (h *Handler) EmailCostReport(c *gin.Context) {
+        var req EmailCostReportRequest
+        if err := c.ShouldBindJSON(&req); err != nil {
+                response.FailWithMessage(err.Error(), c)
+                return
+        }
+
+        now := time.Now()
+        query := costService.CostQuery{
+                StartDate: now.AddDate(0, -1, 0),
+                EndDate:   now,
+                Providers: req.Providers,
+        }
+        if req.StartDate != "" {
+                t, err := time.ParseInLocation("2006-01-02", req.StartDate, time.Local)
+                if err != nil {
+                        response.FailWithMessage("开始日期格式错误", c)
+                        return
+                }
+                query.StartDate = t
+        }
+        if req.EndDate != "" {
+                t, err := time.ParseInLocation("2006-01-02", req.EndDate, time.Local)
+                if err != nil {
+                        response.FailWithMessage("结束日期格式错误", c)
+                        return
+                }
+                query.EndDate = t.AddDate(0, 0, 1)
+        }
+
+        stats, err := h.statisticsSvc.GetCostStatistics(c.Request.Context(), query)
+        if err != nil {
+                response.FailWithMessage(err.Error(), c)
+                return
+        }
+        csv, err := h.statisticsSvc.ExportCostReport(c.Request.Context(), query, "csv")
+        if err != nil {
+                response.FailWithMessage(err.Error(), c)
+                return
+        }
+
+        period := fmt.Sprintf("%s ~ %s", query.StartDate.Format("2006-01-02"), query.EndDate.AddDate(0, 0, -1).Format("2006-01-02"))
+        report := notify.ReportTemplate{
+                Title:     "成本报告 " + period,
+                Summary:   fmt.Sprintf("统计周期内总成本 %.2f %s，日均 %.2f，涉及资源 %d 个", stats.TotalCost, stats.Currency, stats.AvgDailyCost, stats.ResourceCount),
+                Timestamp: now,
+        }
+        for _, g := range stats.ByProvider {
+                report.Details = append(report.Details, fmt.Sprintf("%s: %.2f (%.1f%%)", g.Name, g.Cost, g.Percent))
+        }
+        attachment := mail.Attachment{
+                Filename:    fmt.Sprintf("cost-report-%s.csv", now.Format("20060102")),
+                ContentType: "text/csv",
+                Data:        []byte(csv),
+        }
+        to := req.To
+        if len(to) == 0 {
+                to = config.CONFIG.Alerting.Notify.EmailTo
+        }
+        if len(to) == 0 {
+                response.FailWithMessage("未指定收件人", c)
+                return
+        }
+        if err := notify.SendEmailReport(to, report, attachment); err != nil {
+                response.FailWithMessage("发送失败: "+err.Error(), c)
+                return
+        }
+        response.OkWithMessage("成本报告已发送", c)
+}
+
 // ==================== 告警 ====================
 
 // GetAlertRules 获取告警规则
@@ -686,6 +769,7 @@ func RegisterRoutes(r *gin.RouterGroup, h *Handler) {
         r.POST("/reports", h.GenerateReport)
         r.GET("/reports/:id", h.GetReport)
         r.GET("/export", h.ExportCostReport)
+        r.POST("/reports/email", h.EmailCostReport)
 
         // 告警
         r.GET("/alerts/rules", h.GetAlertRules)
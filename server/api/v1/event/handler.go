@@ -0,0 +1,153 @@
+package event
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/detector"
+	"yunwei/service/event"
+	"yunwei/service/metrics/query"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTime 解析时间参数，支持 Unix 秒和 RFC3339
+func parseTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseUint 解析可选的 ID 参数，未传时为 0
+func parseUint(c *gin.Context, key string) (uint, bool) {
+	v := c.Query(key)
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的 "+key, c)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseWindow 解析变更查询窗口，未传时使用配置的默认窗口
+func parseWindow(c *gin.Context) (time.Duration, bool) {
+	v := c.Query("window")
+	if v == "" {
+		return 0, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 || d > 7*24*time.Hour {
+		response.FailWithMessage("window 应为 1m~168h 之间的时长，如 30m、2h", c)
+		return 0, false
+	}
+	return d, true
+}
+
+// GetTimeline 事件时间线，按服务器、分组、类型和时间范围过滤
+func GetTimeline(c *gin.Context) {
+	f := event.Filter{
+		TenantID:      c.Query("tenantId"),
+		IncludeGlobal: c.Query("includeGlobal") == "true",
+	}
+	var ok bool
+	if f.ServerID, ok = parseUint(c, "serverId"); !ok {
+		return
+	}
+	if f.GroupID, ok = parseUint(c, "groupId"); !ok {
+		return
+	}
+	if t := c.Query("type"); t != "" {
+		f.Types = strings.Split(t, ",")
+	}
+	for key, dst := range map[string]*time.Time{"start": &f.Start, "end": &f.End} {
+		if v := c.Query(key); v != "" {
+			t, err := parseTime(v)
+			if err != nil {
+				response.FailWithMessage("无效的 "+key, c)
+				return
+			}
+			*dst = t
+		}
+	}
+	f.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	f.PageSize, _ = strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+
+	events, total, err := event.GetService().Timeline(f)
+	if err != nil {
+		response.FailWithMessage("查询事件失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithPage(events, total, f.Page, f.PageSize, c)
+}
+
+// GetChanges 服务器在指定时间之前的变更，at 默认为当前时间
+func GetChanges(c *gin.Context) {
+	serverID, ok := parseUint(c, "serverId")
+	if !ok {
+		return
+	}
+	window, ok := parseWindow(c)
+	if !ok {
+		return
+	}
+	at := time.Now()
+	if v := c.Query("at"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			response.FailWithMessage("无效的 at", c)
+			return
+		}
+		at = t
+	}
+
+	changes, err := event.GetService().ChangesBefore(serverID, c.Query("tenantId"), at, window)
+	if err != nil {
+		response.FailWithMessage("查询变更失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(changes, c)
+}
+
+// GetAlertChanges 告警触发前的变更：告警所在服务器、分组以及全局的部署、配置修改、命令执行等
+func GetAlertChanges(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	window, ok := parseWindow(c)
+	if !ok {
+		return
+	}
+	var alert detector.Alert
+	if err := global.DB.First(&alert, id).Error; err != nil {
+		response.FailWithMessage("告警不存在", c)
+		return
+	}
+
+	at := alert.CreatedAt
+	if alert.FiredAt != nil {
+		at = *alert.FiredAt
+	}
+	if window == 0 {
+		window = event.GetService().ChangeWindow()
+	}
+	changes, err := event.GetService().ChangesBefore(alert.ServerID, alert.MatchLabels()[query.LabelTenant], at, window)
+	if err != nil {
+		response.FailWithMessage("查询变更失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(gin.H{
+		"alertId": alert.ID,
+		"firedAt": at,
+		"window":  window.String(),
+		"changes": changes,
+	}, c)
+}
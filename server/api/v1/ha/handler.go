@@ -1,8 +1,12 @@
 package ha
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	"yunwei/global"
@@ -13,17 +17,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var (
-	haManager     *haService.HAManager
-	haManagerOnce sync.Once
-)
-
 // getHAManager 获取 HA 管理器实例（延迟初始化）
 func getHAManager() *haService.HAManager {
-	haManagerOnce.Do(func() {
-		haManager = haService.NewHAManager()
-	})
-	return haManager
+	return haService.GetHAManager()
 }
 
 // ==================== 集群状态 ====================
@@ -445,3 +441,60 @@ func GetLeaderElectionRecords(c *gin.Context) {
 	global.DB.Order("created_at DESC").Limit(10).Find(&records)
 	response.OkWithData(records, c)
 }
+
+// ==================== Agent 路由 ====================
+
+// GetAgentLocations 获取 Agent 所在节点
+func GetAgentLocations(c *gin.Context) {
+	locations, err := getHAManager().GetAgentRouter().ListLocations(c.Query("nodeId"))
+	if err != nil {
+		response.FailWithMessage("获取 Agent 位置失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(locations, c)
+}
+
+// ClusterAuth 校验节点间请求签名
+func ClusterAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, haService.ForwardError{Code: haService.ForwardCodeFailed, Message: err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		err = haService.VerifyClusterRequest(
+			c.GetHeader(haService.ClusterHeaderNode),
+			c.GetHeader(haService.ClusterHeaderTimestamp),
+			c.GetHeader(haService.ClusterHeaderSignature),
+			body,
+		)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, haService.ForwardError{Code: haService.ForwardCodeFailed, Message: err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ForwardAgentCommand 执行其他节点转发来的 Agent 命令
+func ForwardAgentCommand(c *gin.Context) {
+	var cmd haService.AgentCommand
+	if err := json.NewDecoder(c.Request.Body).Decode(&cmd); err != nil {
+		c.JSON(http.StatusBadRequest, haService.ForwardError{Code: haService.ForwardCodeFailed, Message: "参数错误"})
+		return
+	}
+	cmd.AgentID = c.Param("agentId")
+
+	result, err := getHAManager().GetAgentRouter().ExecuteLocal(c.Request.Context(), &cmd)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, haService.ErrAgentNotConnected) || errors.Is(err, haService.ErrNoDispatcher) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, haService.NewForwardError(err))
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
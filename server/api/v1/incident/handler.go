@@ -0,0 +1,415 @@
+package incident
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/event"
+	"yunwei/service/incident"
+	"yunwei/service/security"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audit 记录故障处理操作
+func audit(c *gin.Context, action security.AuditAction, command string) {
+	userID, username := utils.CurrentUser(c)
+	security.NewAuditService().LogFromGin(c, security.LogParams{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Resource: "incident",
+		Command:  command,
+		Result:   "success",
+		Details:  map[string]interface{}{},
+	})
+}
+
+// loadIncident 按路径参数加载故障
+func loadIncident(c *gin.Context) (*incident.Incident, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return nil, false
+	}
+	var inc incident.Incident
+	if err := global.DB.First(&inc, id).Error; err != nil {
+		response.FailWithMessage("故障不存在", c)
+		return nil, false
+	}
+	return &inc, true
+}
+
+// GetIncidents 故障列表，status 为 open 时只返回处理中的
+func GetIncidents(c *gin.Context) {
+	f := incident.Filter{
+		TenantID: c.Query("tenantId"),
+		Status:   c.Query("status"),
+		Severity: c.Query("severity"),
+	}
+	if v := c.Query("serverId"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			response.FailWithMessage("无效的 serverId", c)
+			return
+		}
+		f.ServerID = uint(id)
+	}
+	f.Page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	f.PageSize, _ = strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+
+	list, total, err := incident.GetService().List(f)
+	if err != nil {
+		response.FailWithMessage("查询故障失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithPage(list, total, f.Page, f.PageSize, c)
+}
+
+// GetIncident 故障详情，包含角色、关联记录和复盘报告
+func GetIncident(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	svc := incident.GetService()
+	response.OkWithData(gin.H{
+		"incident":   inc,
+		"roles":      svc.Roles(inc),
+		"links":      svc.Links(inc),
+		"postmortem": svc.GetPostmortem(inc),
+	}, c)
+}
+
+// CreateIncident 手动创建故障，message 作为第一条进展
+func CreateIncident(c *gin.Context) {
+	var req struct {
+		incident.Incident
+		Servers []uint `json:"servers"`
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	inc := req.Incident
+	inc.Servers = ""
+	inc.AddServers(req.Servers...)
+	if strings.TrimSpace(req.Message) == "" {
+		req.Message = "创建故障"
+	}
+	userID, username := utils.CurrentUser(c)
+	if err := incident.GetService().Create(&inc, req.Message, userID, username); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	audit(c, security.AuditActionCreate, fmt.Sprintf("#%d %s severity=%s", inc.ID, inc.Title, inc.Severity))
+
+	response.OkWithData(inc, c)
+}
+
+// UpdateIncident 修改标题、影响描述和涉及的服务器，状态、级别和角色通过各自的接口修改
+func UpdateIncident(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title   string `json:"title"`
+		Summary string `json:"summary"`
+		Servers []uint `json:"servers"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	inc.Title, inc.Summary, inc.Servers = req.Title, req.Summary, ""
+	inc.AddServers(req.Servers...)
+	if err := inc.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Model(inc).Select("title", "summary", "servers").Updates(inc).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s", inc.ID, inc.Title))
+
+	response.OkWithData(inc, c)
+}
+
+// DeleteIncident 删除故障及其进展、关联和复盘报告
+func DeleteIncident(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	if err := incident.GetService().Delete(inc); err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	audit(c, security.AuditActionDelete, fmt.Sprintf("#%d %s", inc.ID, inc.Title))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// PostStatus 更新故障状态，关闭时起草复盘报告
+func PostStatus(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Status  string `json:"status" binding:"required"`
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	userID, username := utils.CurrentUser(c)
+	update, err := incident.GetService().PostStatus(inc, req.Status, req.Message, userID, username)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s status=%s", inc.ID, inc.Title, req.Status))
+
+	response.OkWithData(update, c)
+}
+
+// AddNote 记录处理过程
+func AddNote(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Message string `json:"message" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	userID, username := utils.CurrentUser(c)
+	update, err := incident.GetService().AddNote(inc, req.Message, userID, username)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	response.OkWithData(update, c)
+}
+
+// SetSeverity 调整故障级别
+func SetSeverity(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Severity string `json:"severity" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	userID, username := utils.CurrentUser(c)
+	if err := incident.GetService().SetSeverity(inc, req.Severity, userID, username); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s severity=%s", inc.ID, inc.Title, req.Severity))
+
+	response.OkWithData(inc, c)
+}
+
+// AssignRole 指派故障角色，userId 为 0 时取消指挥官以外的角色
+func AssignRole(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Role   string `json:"role" binding:"required"`
+		UserID uint   `json:"userId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	userID, username := utils.CurrentUser(c)
+	svc := incident.GetService()
+	if err := svc.AssignRole(inc, req.Role, req.UserID, userID, username); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s role=%s user=%d", inc.ID, inc.Title, req.Role, req.UserID))
+
+	response.OkWithData(svc.Roles(inc), c)
+}
+
+// GetLinks 故障关联的记录
+func GetLinks(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	response.OkWithData(incident.GetService().Links(inc), c)
+}
+
+// AddLink 关联事件流中的记录，按事件 ID 或事件类型加来源记录 ID 指定，如 {"kind":"heal","sourceId":12}
+func AddLink(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		EventID  uint   `json:"eventId"`
+		Kind     string `json:"kind"`
+		SourceID uint   `json:"sourceId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+
+	svc := incident.GetService()
+	var ev *event.Event
+	switch {
+	case req.EventID > 0:
+		var e event.Event
+		if err := global.DB.First(&e, req.EventID).Error; err != nil {
+			response.FailWithMessage("事件不存在", c)
+			return
+		}
+		ev = &e
+	case req.Kind != "" && req.SourceID > 0:
+		e, err := svc.FindEvent(req.Kind, req.SourceID)
+		if err != nil {
+			response.FailWithMessage("事件流中没有该记录", c)
+			return
+		}
+		ev = e
+	default:
+		response.FailWithMessage("请指定 eventId，或 kind 和 sourceId", c)
+		return
+	}
+
+	_, username := utils.CurrentUser(c)
+	link, err := svc.LinkEvent(inc, ev, username)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s link=%s/%d", inc.ID, inc.Title, link.Kind, link.SourceID))
+
+	response.OkWithData(link, c)
+}
+
+// GetTimeline 故障时间线
+func GetTimeline(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	timeline, err := incident.GetService().Timeline(inc)
+	if err != nil {
+		response.FailWithMessage("获取时间线失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(timeline, c)
+}
+
+// GetPostmortem 复盘报告，尚未起草时返回空
+func GetPostmortem(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	response.OkWithData(incident.GetService().GetPostmortem(inc), c)
+}
+
+// SavePostmortem 保存人工编辑的复盘报告
+func SavePostmortem(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req incident.Postmortem
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	_, username := utils.CurrentUser(c)
+	pm, err := incident.GetService().SavePostmortem(inc, &req, username)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s postmortem", inc.ID, inc.Title))
+
+	response.OkWithData(pm, c)
+}
+
+// GeneratePostmortem 重新起草复盘报告，覆盖已有内容
+func GeneratePostmortem(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	pm, err := incident.GetService().DraftPostmortem(inc, true)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, fmt.Sprintf("#%d %s postmortem regenerate", inc.ID, inc.Title))
+
+	response.OkWithData(pm, c)
+}
+
+// ExportPostmortem 导出复盘报告，format 为 markdown(默认)或 pdf
+func ExportPostmortem(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	svc := incident.GetService()
+	pm := svc.GetPostmortem(inc)
+	if pm == nil {
+		response.FailWithMessage("复盘报告尚未起草", c)
+		return
+	}
+	if pm.Status == incident.PostmortemGenerating {
+		response.FailWithMessage("复盘报告正在起草中", c)
+		return
+	}
+
+	var (
+		data        []byte
+		err         error
+		contentType string
+		ext         string
+	)
+	switch format := c.DefaultQuery("format", "markdown"); format {
+	case "markdown", "md":
+		data, err = svc.Markdown(inc, pm)
+		contentType, ext = "text/markdown; charset=utf-8", "md"
+	case "pdf":
+		data, err = svc.PDF(inc, pm)
+		contentType, ext = "application/pdf", "pdf"
+	default:
+		response.FailWithMessage("不支持的导出格式 "+format, c)
+		return
+	}
+	if err != nil {
+		response.FailWithMessage("导出失败: "+err.Error(), c)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=incident-%d-postmortem.%s", inc.ID, ext))
+	c.Data(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,260 @@
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	metricsService "yunwei/service/metrics"
+	"yunwei/service/metrics/query"
+	tenantService "yunwei/service/tenant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Handler 指标查询API处理器
+// 响应格式与 Prometheus HTTP API 一致，可直接作为 Grafana 的 Prometheus 数据源
+type Handler struct {
+	engine *query.Engine
+}
+
+// NewHandler 创建处理器
+func NewHandler() *Handler {
+	return &Handler{engine: query.GetEngine()}
+}
+
+// ==================== 查询 ====================
+
+// Query 瞬时查询
+// 参数: query, time(秒级时间戳或RFC3339，默认当前时间)
+func (h *Handler) Query(c *gin.Context) {
+	qs := param(c, "query")
+	ts := time.Now()
+	if s := param(c, "time"); s != "" {
+		t, err := query.ParseTime(s)
+		if err != nil {
+			badData(c, err.Error())
+			return
+		}
+		ts = t
+	}
+
+	expr, err := query.Parse(qs)
+	if err != nil {
+		badData(c, err.Error())
+		return
+	}
+	v, err := h.engine.InstantExpr(expr, ts, queryOptions(c))
+	if err != nil {
+		execError(c, err.Error())
+		return
+	}
+	success(c, query.NewQueryData(v))
+}
+
+// QueryRange 区间查询
+// 参数: query, start, end, step(秒数或时长如 1m)
+func (h *Handler) QueryRange(c *gin.Context) {
+	start, err := query.ParseTime(param(c, "start"))
+	if err != nil {
+		badData(c, "start 参数无效")
+		return
+	}
+	end, err := query.ParseTime(param(c, "end"))
+	if err != nil {
+		badData(c, "end 参数无效")
+		return
+	}
+	step, err := query.ParseStep(param(c, "step"))
+	if err != nil {
+		badData(c, "step 参数无效")
+		return
+	}
+
+	expr, err := query.Parse(param(c, "query"))
+	if err != nil {
+		badData(c, err.Error())
+		return
+	}
+	m, err := h.engine.RangeExpr(expr, start, end, step, queryOptions(c))
+	if err != nil {
+		execError(c, err.Error())
+		return
+	}
+	success(c, query.NewQueryData(m))
+}
+
+// ==================== 元数据 ====================
+
+// Labels 标签名列表
+func (h *Handler) Labels(c *gin.Context) {
+	success(c, []string{
+		"__name__",
+		query.LabelGroup,
+		query.LabelHost,
+		query.LabelServer,
+		query.LabelServerID,
+		query.LabelTag,
+		query.LabelTenant,
+	})
+}
+
+// LabelValues 标签取值列表
+func (h *Handler) LabelValues(c *gin.Context) {
+	name := c.Param("name")
+	if name == "__name__" {
+		names := metricsService.BuiltinMetricNames()
+		sort.Strings(names)
+		success(c, names)
+		return
+	}
+
+	targets, err := h.engine.Targets(queryOptions(c).TenantID)
+	if err != nil {
+		execError(c, err.Error())
+		return
+	}
+	seen := make(map[string]bool)
+	values := []string{}
+	add := func(v string) {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	for _, t := range targets {
+		if name == query.LabelTag {
+			for _, tag := range t.Tags {
+				add(tag)
+			}
+			continue
+		}
+		add(t.Labels[name])
+	}
+	sort.Strings(values)
+	success(c, values)
+}
+
+// Series 按选择器列出序列标签
+// 参数: match[]，可重复
+func (h *Handler) Series(c *gin.Context) {
+	matches := c.QueryArray("match[]")
+	if len(matches) == 0 {
+		matches = c.PostFormArray("match[]")
+	}
+	if len(matches) == 0 {
+		badData(c, "至少需要一个 match[] 参数")
+		return
+	}
+
+	targets, err := h.engine.Targets(queryOptions(c).TenantID)
+	if err != nil {
+		execError(c, err.Error())
+		return
+	}
+
+	seen := make(map[string]bool)
+	result := []query.Labels{}
+	for _, m := range matches {
+		expr, err := query.Parse(m)
+		if err != nil {
+			badData(c, err.Error())
+			return
+		}
+		vs, ok := expr.(*query.VectorSelector)
+		if !ok {
+			badData(c, "match[] 必须是指标选择器: "+m)
+			return
+		}
+		for _, l := range query.SelectSeries(vs, targets) {
+			if key := l.String(); !seen[key] {
+				seen[key] = true
+				result = append(result, l)
+			}
+		}
+	}
+	success(c, result)
+}
+
+// BuildInfo 版本信息，Grafana 用于识别数据源类型
+func (h *Handler) BuildInfo(c *gin.Context) {
+	success(c, gin.H{
+		"version":   "2.40.0",
+		"revision":  "yunwei",
+		"branch":    "yunwei",
+		"goVersion": "",
+	})
+}
+
+// ==================== 辅助函数 ====================
+
+// param 同时支持 GET 查询参数和 POST 表单
+func param(c *gin.Context, name string) string {
+	if v, ok := c.GetQuery(name); ok {
+		return v
+	}
+	return c.PostForm(name)
+}
+
+// queryOptions 根据租户上下文限定可查询的服务器，租户上下文由路由上的 UserTenantMiddleware 设置
+func queryOptions(c *gin.Context) query.Options {
+	opts := query.Options{}
+	if tc := tenantService.GetTenantContext(c); tc != nil {
+		opts.TenantID = tc.TenantID
+	}
+	if res, err := metricsService.ParseResolution(c.Query("resolution")); err == nil {
+		opts.Resolution = res
+	}
+	return opts
+}
+
+func success(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"data":   data,
+	})
+}
+
+func badData(c *gin.Context, msg string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"status":    "error",
+		"errorType": "bad_data",
+		"error":     msg,
+	})
+}
+
+func execError(c *gin.Context, msg string) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"status":    "error",
+		"errorType": "execution",
+		"error":     msg,
+	})
+}
+
+// RegisterRoutes 注册路由
+// /query 与 /query_range 供前端使用；/prometheus/api/v1/* 为 Grafana 数据源地址
+// （在 Grafana 中将数据源 URL 配置为 <host>/api/v1/metrics/prometheus）
+func RegisterRoutes(r *gin.RouterGroup, h *Handler) {
+	r.GET("/query", h.Query)
+	r.POST("/query", h.Query)
+	r.GET("/query_range", h.QueryRange)
+	r.POST("/query_range", h.QueryRange)
+	r.GET("/labels", h.Labels)
+	r.GET("/label/:name/values", h.LabelValues)
+	r.GET("/series", h.Series)
+	r.POST("/series", h.Series)
+
+	prom := r.Group("/prometheus/api/v1")
+	{
+		prom.GET("/query", h.Query)
+		prom.POST("/query", h.Query)
+		prom.GET("/query_range", h.QueryRange)
+		prom.POST("/query_range", h.QueryRange)
+		prom.GET("/labels", h.Labels)
+		prom.POST("/labels", h.Labels)
+		prom.GET("/label/:name/values", h.LabelValues)
+		prom.GET("/series", h.Series)
+		prom.POST("/series", h.Series)
+		prom.GET("/status/buildinfo", h.BuildInfo)
+	}
+}
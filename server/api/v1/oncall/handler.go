@@ -0,0 +1,365 @@
+package oncall
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/oncall"
+	"yunwei/service/security"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audit 记录值班配置变更
+func audit(c *gin.Context, action security.AuditAction, resource, command string) {
+	userID, username := utils.CurrentUser(c)
+	security.NewAuditService().LogFromGin(c, security.LogParams{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Resource: resource,
+		Command:  command,
+		Result:   "success",
+		Details:  map[string]interface{}{},
+	})
+}
+
+func paramID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// queryTime 解析 at 参数(RFC3339)，为空时取当前时间
+func queryTime(c *gin.Context) (time.Time, bool) {
+	at := c.Query("at")
+	if at == "" {
+		return time.Now(), true
+	}
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		response.FailWithMessage("时间格式错误，应为 RFC3339", c)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ==================== 当前值班 ====================
+
+// GetCurrentOnCall 查询所有值班表当前的值班人
+func GetCurrentOnCall(c *gin.Context) {
+	at, ok := queryTime(c)
+	if !ok {
+		return
+	}
+	result, err := oncall.NewService(global.DB).Current(c.Query("tenantId"), at)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	response.OkWithData(result, c)
+}
+
+// GetScheduleOnCall 查询值班表在指定时刻的值班人
+func GetScheduleOnCall(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	at, ok := queryTime(c)
+	if !ok {
+		return
+	}
+	result, err := oncall.NewService(global.DB).OnCallAt(id, at)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	response.OkWithData(result, c)
+}
+
+// ==================== 值班表 ====================
+
+// GetSchedules 获取值班表列表
+func GetSchedules(c *gin.Context) {
+	var schedules []oncall.Schedule
+	query := global.DB.Order("id")
+	if tenantID := c.Query("tenantId"); tenantID != "" {
+		query = query.Where("tenant_id = ?", tenantID)
+	}
+	query.Find(&schedules)
+	response.OkWithData(schedules, c)
+}
+
+// CreateSchedule 创建值班表
+func CreateSchedule(c *gin.Context) {
+	var s oncall.Schedule
+	if err := c.ShouldBindJSON(&s); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	s.ID = 0
+	if err := s.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Create(&s).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	audit(c, security.AuditActionCreate, "oncall_schedule",
+		fmt.Sprintf("#%d %s %s %s 参与人%s", s.ID, s.Name, s.RotationType, s.HandoffTime, s.Participants))
+
+	response.OkWithData(s, c)
+}
+
+// UpdateSchedule 更新值班表
+func UpdateSchedule(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var s oncall.Schedule
+	if err := global.DB.First(&s, id).Error; err != nil {
+		response.FailWithMessage("值班表不存在", c)
+		return
+	}
+	if err := c.ShouldBindJSON(&s); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	s.ID = id
+	if err := s.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Select("name", "tenant_id", "timezone", "participants", "rotation_type", "rotation_hours",
+		"handoff_time", "start_date", "manager_id", "comment").Updates(&s).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, "oncall_schedule",
+		fmt.Sprintf("#%d %s %s %s 参与人%s", s.ID, s.Name, s.RotationType, s.HandoffTime, s.Participants))
+
+	response.OkWithData(s, c)
+}
+
+// DeleteSchedule 删除值班表，仍被升级策略引用时拒绝
+func DeleteSchedule(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var s oncall.Schedule
+	if err := global.DB.First(&s, id).Error; err != nil {
+		response.FailWithMessage("值班表不存在", c)
+		return
+	}
+
+	var policies []oncall.EscalationPolicy
+	global.DB.Find(&policies)
+	for _, p := range policies {
+		steps, err := p.ParseSteps()
+		if err != nil {
+			continue
+		}
+		for _, step := range steps {
+			for _, t := range step.Targets {
+				if t.Type != oncall.TargetUser && t.ID == id {
+					response.FailWithMessage(fmt.Sprintf("值班表仍被升级策略「%s」引用", p.Name), c)
+					return
+				}
+			}
+		}
+	}
+
+	global.DB.Where("schedule_id = ?", id).Delete(&oncall.Override{})
+	if err := global.DB.Delete(&s).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	audit(c, security.AuditActionDelete, "oncall_schedule", fmt.Sprintf("#%d %s", s.ID, s.Name))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// ==================== 替班 ====================
+
+// GetOverrides 获取值班表的替班，默认只返回未结束的
+func GetOverrides(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var overrides []oncall.Override
+	query := global.DB.Where("schedule_id = ?", id)
+	if c.Query("all") != "true" {
+		query = query.Where("ends_at > ?", time.Now())
+	}
+	query.Order("starts_at").Find(&overrides)
+	response.OkWithData(overrides, c)
+}
+
+// CreateOverride 添加替班
+func CreateOverride(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var s oncall.Schedule
+	if err := global.DB.First(&s, id).Error; err != nil {
+		response.FailWithMessage("值班表不存在", c)
+		return
+	}
+
+	var o oncall.Override
+	if err := c.ShouldBindJSON(&o); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	o.ID = 0
+	o.ScheduleID = id
+	if !o.EndsAt.After(o.StartsAt) {
+		response.FailWithMessage("结束时间必须晚于开始时间", c)
+		return
+	}
+	if oncall.NewService(global.DB).Contact(o.UserID) == nil {
+		response.FailWithMessage("替班用户不存在或已禁用", c)
+		return
+	}
+	o.CreatedBy, _ = utils.CurrentUser(c)
+
+	if err := global.DB.Create(&o).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	audit(c, security.AuditActionCreate, "oncall_override",
+		fmt.Sprintf("值班表 %s 用户 %d [%s ~ %s] %s", s.Name, o.UserID,
+			o.StartsAt.Format(time.RFC3339), o.EndsAt.Format(time.RFC3339), o.Comment))
+
+	response.OkWithData(o, c)
+}
+
+// DeleteOverride 删除替班
+func DeleteOverride(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var o oncall.Override
+	if err := global.DB.First(&o, id).Error; err != nil {
+		response.FailWithMessage("替班不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&o).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	audit(c, security.AuditActionDelete, "oncall_override",
+		fmt.Sprintf("#%d 值班表 %d 用户 %d", o.ID, o.ScheduleID, o.UserID))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// ==================== 升级策略 ====================
+
+// GetPolicies 获取升级策略列表，按匹配顺序排列
+func GetPolicies(c *gin.Context) {
+	var policies []oncall.EscalationPolicy
+	global.DB.Order("priority, id").Find(&policies)
+	response.OkWithData(policies, c)
+}
+
+// CreatePolicy 创建升级策略
+func CreatePolicy(c *gin.Context) {
+	var p oncall.EscalationPolicy
+	if err := c.ShouldBindJSON(&p); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	p.ID = 0
+	if err := p.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Create(&p).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	audit(c, security.AuditActionCreate, "escalation_policy",
+		fmt.Sprintf("#%d %s levels=%s matchers=%s steps=%s", p.ID, p.Name, p.Levels, p.Matchers, p.Steps))
+
+	response.OkWithData(p, c)
+}
+
+// UpdatePolicy 更新升级策略，进行中的升级按新的级别继续
+func UpdatePolicy(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var p oncall.EscalationPolicy
+	if err := global.DB.First(&p, id).Error; err != nil {
+		response.FailWithMessage("升级策略不存在", c)
+		return
+	}
+	if err := c.ShouldBindJSON(&p); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	p.ID = id
+	if err := p.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Select("name", "tenant_id", "priority", "levels", "matchers", "steps",
+		"enabled", "comment").Updates(&p).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, "escalation_policy",
+		fmt.Sprintf("#%d %s levels=%s matchers=%s steps=%s enabled=%t", p.ID, p.Name, p.Levels, p.Matchers, p.Steps, p.Enabled))
+
+	response.OkWithData(p, c)
+}
+
+// DeletePolicy 删除升级策略，进行中的升级停在当前级别
+func DeletePolicy(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	var p oncall.EscalationPolicy
+	if err := global.DB.First(&p, id).Error; err != nil {
+		response.FailWithMessage("升级策略不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&p).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	audit(c, security.AuditActionDelete, "escalation_policy", fmt.Sprintf("#%d %s", p.ID, p.Name))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// GetEscalations 获取事件升级进度
+func GetEscalations(c *gin.Context) {
+	var escalations []oncall.Escalation
+	query := global.DB.Model(&oncall.Escalation{})
+	if incidentID := c.Query("incidentId"); incidentID != "" {
+		query = query.Where("incident_id = ?", incidentID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Order("id DESC").Limit(100).Find(&escalations)
+	response.OkWithData(escalations, c)
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/notify"
+	"yunwei/service/routing"
+	"yunwei/service/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 通知通道 ====================
+
+// GetNotifyChannels 获取通知通道实例列表
+func GetNotifyChannels(c *gin.Context) {
+	var channels []notify.ChannelInstance
+	db := global.DB.Order("tenant_id, id")
+	if tenantID, ok := c.GetQuery("tenantId"); ok {
+		db = db.Where("tenant_id = ?", tenantID)
+	}
+	if typ := c.Query("type"); typ != "" {
+		db = db.Where("type = ?", typ)
+	}
+	db.Find(&channels)
+	response.OkWithData(channels, c)
+}
+
+// GetNotifyChannelTypes 获取已注册的通道类型
+func GetNotifyChannelTypes(c *gin.Context) {
+	response.OkWithData(notify.ChannelTypes(), c)
+}
+
+// CreateNotifyChannel 创建通知通道实例，同一租户下名称唯一
+func CreateNotifyChannel(c *gin.Context) {
+	var ch notify.ChannelInstance
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	ch.ID = 0
+	if err := ch.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	var count int64
+	global.DB.Model(&notify.ChannelInstance{}).Where("tenant_id = ? AND name = ?", ch.TenantID, ch.Name).Count(&count)
+	if count > 0 {
+		response.FailWithMessage("通道名称已存在", c)
+		return
+	}
+	if err := global.DB.Create(&ch).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	notify.GetRegistry().Invalidate()
+	auditChange(c, security.AuditActionCreate, "notify_channel", fmt.Sprintf("#%d %s type=%s tenant=%s", ch.ID, ch.Name, ch.Type, ch.TenantID))
+
+	response.OkWithData(ch, c)
+}
+
+// UpdateNotifyChannel 更新通知通道实例，名称和所属租户被接收人引用，不可修改
+func UpdateNotifyChannel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var ch notify.ChannelInstance
+	if err := global.DB.First(&ch, id).Error; err != nil {
+		response.FailWithMessage("通知通道不存在", c)
+		return
+	}
+	name, tenantID := ch.Name, ch.TenantID
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	ch.ID, ch.Name, ch.TenantID = uint(id), name, tenantID
+	if err := ch.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Select("type", "config", "is_default", "enabled", "comment").Updates(&ch).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	notify.GetRegistry().Invalidate()
+	auditChange(c, security.AuditActionUpdate, "notify_channel", fmt.Sprintf("#%d %s type=%s tenant=%s", ch.ID, ch.Name, ch.Type, ch.TenantID))
+
+	response.OkWithData(ch, c)
+}
+
+// DeleteNotifyChannel 删除通知通道实例，仍被接收人引用时拒绝
+func DeleteNotifyChannel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var ch notify.ChannelInstance
+	if err := global.DB.First(&ch, id).Error; err != nil {
+		response.FailWithMessage("通知通道不存在", c)
+		return
+	}
+	// 全局通道可被任一租户的接收人引用，租户通道可被本租户和全局接收人引用
+	var receivers []routing.Receiver
+	db := global.DB
+	if ch.TenantID != "" {
+		db = db.Where("tenant_id IN ?", []string{ch.TenantID, ""})
+	}
+	db.Find(&receivers)
+	for _, r := range receivers {
+		configs, _ := r.ParseChannels()
+		for _, cfg := range configs {
+			if cfg.Ref == ch.Name {
+				response.FailWithMessage(fmt.Sprintf("通道仍被接收人「%s」引用", r.Name), c)
+				return
+			}
+		}
+	}
+	if err := global.DB.Delete(&ch).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	notify.GetRegistry().Invalidate()
+	auditChange(c, security.AuditActionDelete, "notify_channel", fmt.Sprintf("#%d %s type=%s tenant=%s", ch.ID, ch.Name, ch.Type, ch.TenantID))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// TestNotifyChannel 向通道发送一条测试消息，停用的通道也可测试
+func TestNotifyChannel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var inst notify.ChannelInstance
+	if err := global.DB.First(&inst, id).Error; err != nil {
+		response.FailWithMessage("通知通道不存在", c)
+		return
+	}
+	cfg, err := inst.ChannelConfig()
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	ch, err := notify.NewChannel(cfg)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	msg := notify.NewMessage("测试通知", fmt.Sprintf("这是通知通道「%s」的测试消息，发送时间 %s", inst.Name, time.Now().Format("2006-01-02 15:04:05")))
+	msg.TenantID = inst.TenantID
+	err = ch.Send(msg)
+	if errors.Is(err, notify.ErrSkipped) {
+		response.FailWithMessage("该类型的通道只接收告警和事件，不能发送测试消息", c)
+		return
+	}
+	if err != nil {
+		response.FailWithMessage("发送失败: "+err.Error(), c)
+		return
+	}
+
+	response.OkWithMessage("测试消息已加入发送队列，可在通知发件箱中查看发送结果", c)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/model/server"
+	"yunwei/service/detector"
+	"yunwei/service/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 抑制规则 ====================
+
+// GetInhibitRules 获取抑制规则列表
+func GetInhibitRules(c *gin.Context) {
+	var rules []detector.InhibitRule
+	global.DB.Order("id").Find(&rules)
+	response.OkWithData(rules, c)
+}
+
+// CreateInhibitRule 创建抑制规则
+func CreateInhibitRule(c *gin.Context) {
+	var r detector.InhibitRule
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	r.ID = 0
+	if err := r.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Create(&r).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	auditChange(c, security.AuditActionCreate, "inhibit_rule",
+		fmt.Sprintf("#%d %s source={%s} target={%s} equal=%s", r.ID, r.Name, r.SourceMatchers, r.TargetMatchers, r.Equal))
+
+	response.OkWithData(r, c)
+}
+
+// UpdateInhibitRule 更新抑制规则
+func UpdateInhibitRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r detector.InhibitRule
+	if err := global.DB.First(&r, id).Error; err != nil {
+		response.FailWithMessage("抑制规则不存在", c)
+		return
+	}
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	r.ID = uint(id)
+	if err := r.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Select("name", "source_matchers", "target_matchers", "equal", "enabled", "comment").
+		Updates(&r).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	auditChange(c, security.AuditActionUpdate, "inhibit_rule",
+		fmt.Sprintf("#%d %s source={%s} target={%s} equal=%s enabled=%t", r.ID, r.Name, r.SourceMatchers, r.TargetMatchers, r.Equal, r.Enabled))
+
+	response.OkWithData(r, c)
+}
+
+// DeleteInhibitRule 删除抑制规则
+func DeleteInhibitRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r detector.InhibitRule
+	if err := global.DB.First(&r, id).Error; err != nil {
+		response.FailWithMessage("抑制规则不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&r).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	auditChange(c, security.AuditActionDelete, "inhibit_rule", fmt.Sprintf("#%d %s", r.ID, r.Name))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// ==================== 服务器依赖关系 ====================
+
+// GetServerRelations 获取服务器的上下游关系
+func GetServerRelations(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var upstream, downstream []server.ServerRelation
+	global.DB.Where("server_id = ?", id).Order("id").Find(&upstream)
+	global.DB.Where("depends_on_id = ?", id).Order("id").Find(&downstream)
+
+	response.OkWithData(gin.H{
+		"upstream":   upstream,
+		"downstream": downstream,
+	}, c)
+}
+
+// CreateServerRelation 添加服务器依赖关系：路径中的服务器依赖 dependsOnId
+func CreateServerRelation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r server.ServerRelation
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	r.ID = 0
+	r.ServerID = uint(id)
+	if r.ServerID == 0 || r.DependsOnID == 0 || r.ServerID == r.DependsOnID {
+		response.FailWithMessage("需要两台不同的服务器", c)
+		return
+	}
+	switch r.Type {
+	case "":
+		r.Type = server.RelationDependsOn
+	case server.RelationDependsOn, server.RelationRunsOn, server.RelationBehind:
+	default:
+		response.FailWithMessage("不支持的关系类型", c)
+		return
+	}
+
+	var count int64
+	global.DB.Model(&server.Server{}).Where("id IN ?", []uint{r.ServerID, r.DependsOnID}).Count(&count)
+	if count != 2 {
+		response.FailWithMessage("服务器不存在", c)
+		return
+	}
+	global.DB.Model(&server.ServerRelation{}).Where("server_id = ? AND depends_on_id = ?", r.ServerID, r.DependsOnID).Count(&count)
+	if count > 0 {
+		response.FailWithMessage("关系已存在", c)
+		return
+	}
+
+	if err := global.DB.Create(&r).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	auditChange(c, security.AuditActionCreate, "server_relation",
+		fmt.Sprintf("#%d 服务器 %d %s 服务器 %d", r.ID, r.ServerID, r.Type, r.DependsOnID))
+
+	response.OkWithData(r, c)
+}
+
+// DeleteServerRelation 删除服务器依赖关系
+func DeleteServerRelation(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("relationId"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r server.ServerRelation
+	if err := global.DB.Where("server_id = ? OR depends_on_id = ?", c.Param("id"), c.Param("id")).First(&r, id).Error; err != nil {
+		response.FailWithMessage("关系不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&r).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	auditChange(c, security.AuditActionDelete, "server_relation",
+		fmt.Sprintf("#%d 服务器 %d %s 服务器 %d", r.ID, r.ServerID, r.Type, r.DependsOnID))
+
+	response.OkWithMessage("删除成功", c)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/outbox"
+	"yunwei/service/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 通知发件箱 ====================
+
+// GetOutboxMessages 获取发件箱消息，可按状态、通道筛选
+func GetOutboxMessages(c *gin.Context) {
+	var messages []outbox.Message
+	query := global.DB.Model(&outbox.Message{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if channel := c.Query("channel"); channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if mergedInto := c.Query("mergedInto"); mergedInto != "" {
+		query = query.Where("merged_into = ?", mergedInto)
+	}
+
+	// 分页
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "20"))
+	var total int64
+
+	query.Count(&total)
+	query.Order("id DESC")
+	query.Offset((page - 1) * pageSize).Limit(pageSize).Find(&messages)
+
+	// 目标地址和错误信息中的 URL 可能带令牌，只返回脱敏后的视图
+	list := make([]outbox.MessageView, 0, len(messages))
+	for _, m := range messages {
+		list = append(list, m.View())
+	}
+
+	response.OkWithData(gin.H{
+		"list":     list,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	}, c)
+}
+
+// GetOutboxStats 获取发件箱各状态的消息数
+func GetOutboxStats(c *gin.Context) {
+	response.OkWithData(outbox.GetOutbox().Stats(), c)
+}
+
+// RetryOutboxMessage 重新发送死信消息，重试次数清零
+func RetryOutboxMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	if err := outbox.GetOutbox().Retry(uint(id)); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	auditChange(c, security.AuditActionUpdate, "notify_outbox", fmt.Sprintf("#%d retry", id))
+
+	response.OkWithMessage("已重新加入发送队列", c)
+}
+
+// DiscardOutboxMessage 丢弃死信消息
+func DiscardOutboxMessage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+	if err := outbox.GetOutbox().Discard(uint(id)); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	auditChange(c, security.AuditActionDelete, "notify_outbox", fmt.Sprintf("#%d discard", id))
+
+	response.OkWithMessage("已丢弃", c)
+}
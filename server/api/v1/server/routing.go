@@ -0,0 +1,371 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/metrics/query"
+	"yunwei/service/notify"
+	"yunwei/service/routing"
+	"yunwei/service/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 通知路由 ====================
+
+// routeNode 路由树节点
+type routeNode struct {
+	routing.Route
+	Children []*routeNode `json:"children"`
+}
+
+// GetNotifyRoutes 获取通知路由树，tenantId 为空时返回全局路由树
+func GetNotifyRoutes(c *gin.Context) {
+	var routes []routing.Route
+	global.DB.Where("tenant_id = ?", c.Query("tenantId")).Order("sort, id").Find(&routes)
+
+	nodes := make(map[uint]*routeNode, len(routes))
+	for i := range routes {
+		nodes[routes[i].ID] = &routeNode{Route: routes[i], Children: []*routeNode{}}
+	}
+	tree := []*routeNode{}
+	for i := range routes {
+		n := nodes[routes[i].ID]
+		if parent, ok := nodes[n.ParentID]; ok {
+			parent.Children = append(parent.Children, n)
+		} else {
+			tree = append(tree, n)
+		}
+	}
+	response.OkWithData(tree, c)
+}
+
+// checkRouteReceiver 路由引用的接收人需存在于同租户或全局
+func checkRouteReceiver(r *routing.Route) error {
+	if r.Receiver == "" {
+		return nil
+	}
+	var count int64
+	global.DB.Model(&routing.Receiver{}).Where("name = ? AND tenant_id IN ?", r.Receiver, []string{r.TenantID, ""}).Count(&count)
+	if count == 0 {
+		return fmt.Errorf("接收人 %s 不存在", r.Receiver)
+	}
+	return nil
+}
+
+// CreateNotifyRoute 创建通知路由，每个租户只能有一个根路由，子路由与上级属于同一租户
+func CreateNotifyRoute(c *gin.Context) {
+	var r routing.Route
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	r.ID = 0
+	if err := r.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+
+	if r.ParentID == 0 {
+		var count int64
+		global.DB.Model(&routing.Route{}).Where("tenant_id = ? AND parent_id = 0", r.TenantID).Count(&count)
+		if count > 0 {
+			response.FailWithMessage("该租户已有根路由", c)
+			return
+		}
+	} else {
+		var parent routing.Route
+		if err := global.DB.First(&parent, r.ParentID).Error; err != nil {
+			response.FailWithMessage("上级路由不存在", c)
+			return
+		}
+		r.TenantID = parent.TenantID
+	}
+	if err := checkRouteReceiver(&r); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+
+	if err := global.DB.Create(&r).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	routing.GetService().Invalidate()
+	auditChange(c, security.AuditActionCreate, "notify_route",
+		fmt.Sprintf("#%d %s parent=%d tenant=%s matchers={%s} levels=%s receiver=%s", r.ID, r.Name, r.ParentID, r.TenantID, r.Matchers, r.Levels, r.Receiver))
+
+	response.OkWithData(r, c)
+}
+
+// UpdateNotifyRoute 更新通知路由，所属租户和上级路由不可修改
+func UpdateNotifyRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r routing.Route
+	if err := global.DB.First(&r, id).Error; err != nil {
+		response.FailWithMessage("通知路由不存在", c)
+		return
+	}
+	tenantID, parentID := r.TenantID, r.ParentID
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	r.ID, r.TenantID, r.ParentID = uint(id), tenantID, parentID
+	if err := r.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := checkRouteReceiver(&r); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Select("name", "sort", "matchers", "levels", "continue", "receiver", "group_by",
+		"group_wait", "group_interval", "repeat_interval", "enabled", "comment").Updates(&r).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	routing.GetService().Invalidate()
+	auditChange(c, security.AuditActionUpdate, "notify_route",
+		fmt.Sprintf("#%d %s matchers={%s} levels=%s receiver=%s continue=%t enabled=%t", r.ID, r.Name, r.Matchers, r.Levels, r.Receiver, r.Continue, r.Enabled))
+
+	response.OkWithData(r, c)
+}
+
+// DeleteNotifyRoute 删除通知路由，有子路由时拒绝
+func DeleteNotifyRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r routing.Route
+	if err := global.DB.First(&r, id).Error; err != nil {
+		response.FailWithMessage("通知路由不存在", c)
+		return
+	}
+	var count int64
+	global.DB.Model(&routing.Route{}).Where("parent_id = ?", r.ID).Count(&count)
+	if count > 0 {
+		response.FailWithMessage("请先删除子路由", c)
+		return
+	}
+	if err := global.DB.Delete(&r).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	routing.GetService().Invalidate()
+	auditChange(c, security.AuditActionDelete, "notify_route", fmt.Sprintf("#%d %s", r.ID, r.Name))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// TestNotifyRouteRequest 路由测试请求
+type TestNotifyRouteRequest struct {
+	TenantID string            `json:"tenantId"`
+	Labels   map[string]string `json:"labels"`
+	Level    string            `json:"level"`
+}
+
+// TestNotifyRoute 用示例告警的标签和级别测试路由，返回命中的路由和接收人
+func TestNotifyRoute(c *gin.Context) {
+	var req TestNotifyRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	if req.Labels == nil {
+		req.Labels = map[string]string{}
+	}
+	if req.TenantID == "" {
+		req.TenantID = req.Labels[query.LabelTenant]
+	}
+
+	svc := routing.GetService()
+	matches := svc.Match(req.TenantID, req.Labels, req.Level)
+
+	type channelView struct {
+		Type string `json:"type"`
+	}
+	type matchView struct {
+		RouteID        uint          `json:"routeId"`
+		Path           string        `json:"path"`
+		Receiver       string        `json:"receiver"`
+		ReceiverFound  bool          `json:"receiverFound"`
+		Channels       []channelView `json:"channels"`
+		GroupBy        []string      `json:"groupBy"` // 为空表示按告警配置的默认维度分组
+		GroupWait      string        `json:"groupWait"`
+		GroupInterval  string        `json:"groupInterval"`
+		RepeatInterval string        `json:"repeatInterval"` // 为空表示使用默认值
+	}
+	views := make([]matchView, 0, len(matches))
+	fallback := true
+	for _, m := range matches {
+		v := matchView{
+			RouteID:       m.RouteID,
+			Path:          strings.Join(m.Path, " > "),
+			Receiver:      m.Receiver,
+			Channels:      []channelView{},
+			GroupBy:       m.GroupBy,
+			GroupWait:     m.GroupWait.String(),
+			GroupInterval: m.GroupInterval.String(),
+		}
+		if m.RepeatInterval > 0 {
+			v.RepeatInterval = m.RepeatInterval.String()
+		}
+		if rc := svc.Receiver(req.TenantID, m.Receiver); rc != nil {
+			v.ReceiverFound = true
+			fallback = false
+			channels, _ := rc.ParseChannels()
+			for _, ch := range channels {
+				v.Channels = append(v.Channels, channelView{Type: ch.Type})
+			}
+		}
+		views = append(views, v)
+	}
+
+	response.OkWithData(gin.H{
+		"matches":  views,
+		"fallback": fallback, // 未配置路由树或接收人都不存在，发往默认通道
+	}, c)
+}
+
+// ==================== 通知接收人 ====================
+
+// GetNotifyReceivers 获取通知接收人列表
+func GetNotifyReceivers(c *gin.Context) {
+	var receivers []routing.Receiver
+	db := global.DB.Order("id")
+	if tenantID, ok := c.GetQuery("tenantId"); ok {
+		db = db.Where("tenant_id = ?", tenantID)
+	}
+	db.Find(&receivers)
+	response.OkWithData(receivers, c)
+}
+
+// checkReceiverRefs 接收人引用的通道实例需存在于同租户或全局；全局接收人只能引用全局通道
+func checkReceiverRefs(r *routing.Receiver) error {
+	channels, _ := r.ParseChannels()
+	for _, ch := range channels {
+		if ch.Ref == "" {
+			continue
+		}
+		var count int64
+		global.DB.Model(&notify.ChannelInstance{}).Where("name = ? AND tenant_id IN ?", ch.Ref, []string{r.TenantID, ""}).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("通知通道 %s 不存在", ch.Ref)
+		}
+	}
+	return nil
+}
+
+// CreateNotifyReceiver 创建通知接收人，同一租户下名称唯一
+func CreateNotifyReceiver(c *gin.Context) {
+	var r routing.Receiver
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	r.ID = 0
+	if err := r.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := checkReceiverRefs(&r); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	var count int64
+	global.DB.Model(&routing.Receiver{}).Where("tenant_id = ? AND name = ?", r.TenantID, r.Name).Count(&count)
+	if count > 0 {
+		response.FailWithMessage("接收人名称已存在", c)
+		return
+	}
+	if err := global.DB.Create(&r).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	routing.GetService().Invalidate()
+	auditChange(c, security.AuditActionCreate, "notify_receiver", fmt.Sprintf("#%d %s tenant=%s", r.ID, r.Name, r.TenantID))
+
+	response.OkWithData(r, c)
+}
+
+// UpdateNotifyReceiver 更新接收人的通知通道，名称和所属租户被路由引用，不可修改
+func UpdateNotifyReceiver(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r routing.Receiver
+	if err := global.DB.First(&r, id).Error; err != nil {
+		response.FailWithMessage("接收人不存在", c)
+		return
+	}
+	name, tenantID := r.Name, r.TenantID
+	if err := c.ShouldBindJSON(&r); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	r.ID, r.Name, r.TenantID = uint(id), name, tenantID
+	if err := r.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := checkReceiverRefs(&r); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Select("channels", "comment").Updates(&r).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	routing.GetService().Invalidate()
+	auditChange(c, security.AuditActionUpdate, "notify_receiver", fmt.Sprintf("#%d %s tenant=%s", r.ID, r.Name, r.TenantID))
+
+	response.OkWithData(r, c)
+}
+
+// DeleteNotifyReceiver 删除通知接收人，仍被路由引用时拒绝
+func DeleteNotifyReceiver(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var r routing.Receiver
+	if err := global.DB.First(&r, id).Error; err != nil {
+		response.FailWithMessage("接收人不存在", c)
+		return
+	}
+	// 全局接收人可被任一租户的路由引用
+	var route routing.Route
+	db := global.DB.Where("receiver = ?", r.Name)
+	if r.TenantID != "" {
+		db = db.Where("tenant_id = ?", r.TenantID)
+	}
+	if err := db.First(&route).Error; err == nil {
+		response.FailWithMessage(fmt.Sprintf("接收人仍被通知路由「%s」引用", route.Name), c)
+		return
+	}
+	if err := global.DB.Delete(&r).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	routing.GetService().Invalidate()
+	auditChange(c, security.AuditActionDelete, "notify_receiver", fmt.Sprintf("#%d %s tenant=%s", r.ID, r.Name, r.TenantID))
+
+	response.OkWithMessage("删除成功", c)
+}
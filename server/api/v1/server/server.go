@@ -1,17 +1,21 @@
 package server
 
 import (
+        "encoding/json"
         "strconv"
+        "strings"
         "time"
 
-        "yunwei/config"
         "yunwei/global"
         "yunwei/model/common/response"
         "yunwei/model/server"
         "yunwei/service/ai/decision"
         "yunwei/service/ai/llm"
         "yunwei/service/detector"
+        metricsService "yunwei/service/metrics"
         "yunwei/service/optimizer"
+        "yunwei/service/silence"
+        "yunwei/utils"
 
         "github.com/gin-gonic/gin"
 )
@@ -79,6 +83,7 @@ func AddServer(c *gin.Context) {
                 PrivateKey  string `json:"privateKey"`
                 SshKeyID    *uint  `json:"sshKeyId"`
                 GroupID     uint   `json:"groupId"`
+                TenantID    string `json:"tenantId"` // 所属租户，为空表示平台服务器，指标按租户配额保留
                 Description string `json:"description"`
         }
 
@@ -111,6 +116,7 @@ func AddServer(c *gin.Context) {
                 PrivateKey:  req.PrivateKey,
                 SshKeyID:    req.SshKeyID,
                 GroupID:     req.GroupID,
+                TenantID:    req.TenantID,
                 Description: req.Description,
                 Status:      "pending",
         }
@@ -173,6 +179,7 @@ func DeleteServer(c *gin.Context) {
 }
 
 // GetServerMetrics 获取服务器指标
+// 不带时间参数时返回最近100条原始数据；带 start/end/range 时从时序存储查询，长时间范围自动使用聚合数据
 func GetServerMetrics(c *gin.Context) {
         id, err := strconv.ParseUint(c.Param("id"), 10, 32)
         if err != nil {
@@ -180,10 +187,92 @@ func GetServerMetrics(c *gin.Context) {
                 return
         }
 
-        var metrics []server.ServerMetric
-        global.DB.Where("server_id = ?", id).Order("created_at DESC").Limit(100).Find(&metrics)
+        if c.Query("start") == "" && c.Query("end") == "" && c.Query("range") == "" {
+                metrics, err := metricsService.RecentServerMetrics(uint(id), time.Hour, 100)
+                if err != nil {
+                        response.FailWithMessage("查询失败: "+err.Error(), c)
+                        return
+                }
+                response.OkWithData(metrics, c)
+                return
+        }
+
+        end := time.Now()
+        if v := c.Query("end"); v != "" {
+                if end, err = parseTimeParam(v); err != nil {
+                        response.FailWithMessage("无效的结束时间", c)
+                        return
+                }
+        }
+        start := end.Add(-time.Hour)
+        if v := c.Query("range"); v != "" {
+                d, err := parseRangeParam(v)
+                if err != nil {
+                        response.FailWithMessage("无效的时间范围", c)
+                        return
+                }
+                start = end.Add(-d)
+        }
+        if v := c.Query("start"); v != "" {
+                if start, err = parseTimeParam(v); err != nil {
+                        response.FailWithMessage("无效的开始时间", c)
+                        return
+                }
+        }
+
+        resolution, err := metricsService.ParseResolution(c.Query("resolution"))
+        if err != nil {
+                response.FailWithMessage(err.Error(), c)
+                return
+        }
+        if resolution == "" {
+                resolution = metricsService.AutoResolution(start, end)
+        }
+
+        var names []string
+        if v := c.Query("metrics"); v != "" {
+                names = strings.Split(v, ",")
+        }
+
+        series, err := metricsService.GetStore().Query(metricsService.Query{
+                ServerIDs:  []uint{uint(id)},
+                Metrics:    names,
+                Start:      start,
+                End:        end,
+                Resolution: resolution,
+                Aggregator: metricsService.Aggregator(c.DefaultQuery("agg", "avg")),
+        })
+        if err != nil {
+                response.FailWithMessage("查询指标失败: "+err.Error(), c)
+                return
+        }
+
+        response.OkWithData(gin.H{
+                "start":      start,
+                "end":        end,
+                "resolution": resolution,
+                "series":     series,
+        }, c)
+}
 
-        response.OkWithData(metrics, c)
+// parseTimeParam 解析时间参数，支持 Unix 秒和 RFC3339
+func parseTimeParam(v string) (time.Time, error) {
+        if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+                return time.Unix(sec, 0), nil
+        }
+        return time.Parse(time.RFC3339, v)
+}
+
+// parseRangeParam 解析时间范围参数，在 time.ParseDuration 基础上支持天(d)
+func parseRangeParam(v string) (time.Duration, error) {
+        if strings.HasSuffix(v, "d") {
+                days, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+                if err != nil {
+                        return 0, err
+                }
+                return time.Duration(days) * 24 * time.Hour, nil
+        }
+        return time.ParseDuration(v)
 }
 
 // GetServerLogs 获取服务器日志
@@ -399,19 +488,21 @@ func AIAnalyze(c *gin.Context) {
         }
 
         // 获取最新指标
-        var metric server.ServerMetric
-        global.DB.Where("server_id = ?", id).Order("created_at DESC").First(&metric)
-
-        // 创建决策引擎
-        llmClient := llm.NewGLM5Client(llm.GLM5Config{
-                APIKey: config.CONFIG.AI.APIKey,
-                BaseURL: config.CONFIG.AI.BaseURL,
-                Model:   config.CONFIG.AI.Model,
-        })
+        metric, err := metricsService.LatestServerMetric(srv.ID)
+        if err != nil {
+                metric = &server.ServerMetric{ServerID: srv.ID}
+        }
+
+        // 创建决策引擎，按服务器所属租户选择模型
+        llmClient := llm.For(llm.FeatureDecision, srv.TenantID)
+        if llmClient == nil {
+                response.FailWithMessage("未配置可用的 AI 模型", c)
+                return
+        }
         engine := decision.NewEngine(llmClient)
 
         // 执行分析
-        decision, err := engine.QuickAnalyze(&srv, &metric)
+        decision, err := engine.QuickAnalyze(&srv, metric)
         if err != nil {
                 response.FailWithMessage("AI分析失败: "+err.Error(), c)
                 return
@@ -420,6 +511,58 @@ func AIAnalyze(c *gin.Context) {
         response.OkWithData(decision, c)
 }
 
+// AIAnalyzeStream 流式 AI 分析服务器（SSE）。模型输出逐段以 delta 事件推送，
+// 输出结束后推送解析出的 decision 事件；客户端断开连接即取消分析
+func AIAnalyzeStream(c *gin.Context) {
+        id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+        if err != nil {
+                response.FailWithMessage("无效的ID", c)
+                return
+        }
+
+        var srv server.Server
+        if err := global.DB.First(&srv, id).Error; err != nil {
+                response.FailWithMessage("服务器不存在", c)
+                return
+        }
+
+        metric, err := metricsService.LatestServerMetric(srv.ID)
+        if err != nil {
+                metric = &server.ServerMetric{ServerID: srv.ID}
+        }
+
+        llmClient := llm.For(llm.FeatureDecision, srv.TenantID)
+        if llmClient == nil {
+                response.FailWithMessage("未配置可用的 AI 模型", c)
+                return
+        }
+        engine := decision.NewEngine(llmClient)
+
+        c.Header("Content-Type", "text/event-stream")
+        c.Header("Cache-Control", "no-cache")
+        c.Header("Connection", "keep-alive")
+        c.Header("X-Accel-Buffering", "no") // 关闭 nginx 缓冲，逐段送达
+        c.Status(200)
+        c.Writer.Flush()
+
+        ctx := c.Request.Context()
+        result, err := engine.QuickAnalyzeStream(ctx, &srv, metric, func(delta string) error {
+                c.SSEvent("delta", gin.H{"content": delta})
+                c.Writer.Flush()
+                return nil
+        })
+        if ctx.Err() != nil {
+                // 客户端已断开
+                return
+        }
+        if err != nil {
+                c.SSEvent("error", gin.H{"message": "AI分析失败: " + err.Error()})
+        } else {
+                c.SSEvent("decision", result)
+        }
+        c.Writer.Flush()
+}
+
 // GetAlerts 获取告警列表
 func GetAlerts(c *gin.Context) {
         var alerts []detector.Alert
@@ -435,13 +578,27 @@ func GetAlerts(c *gin.Context) {
         if serverId := c.Query("serverId"); serverId != "" {
                 query = query.Where("server_id = ?", serverId)
         }
+        if incidentId := c.Query("incidentId"); incidentId != "" {
+                query = query.Where("incident_id = ?", incidentId)
+        }
+        if inhibitedBy := c.Query("inhibitedBy"); inhibitedBy != "" {
+                query = query.Where("inhibited_by = ?", inhibitedBy)
+        }
 
         query.Order("created_at DESC").Limit(100).Find(&alerts)
 
+        // 标出被静默或处于维护窗口的告警
+        now := time.Now()
+        for i := range alerts {
+                if alerts[i].Status != detector.AlertStatusResolved {
+                        alerts[i].Silenced = silence.GetService().Silenced(alerts[i].MatchLabels(), now)
+                }
+        }
+
         response.OkWithData(alerts, c)
 }
 
-// AcknowledgeAlert 确认告警
+// AcknowledgeAlert 确认告警，同一事件下的告警一并确认并停止重复通知
 func AcknowledgeAlert(c *gin.Context) {
         id, err := strconv.ParseUint(c.Param("id"), 10, 32)
         if err != nil {
@@ -449,18 +606,136 @@ func AcknowledgeAlert(c *gin.Context) {
                 return
         }
 
-        var alert detector.Alert
-        if err := global.DB.First(&alert, id).Error; err != nil {
-                response.FailWithMessage("告警不存在", c)
+        incident, err := detector.GetAlertManager().AcknowledgeAlert(uint(id), c.GetUint("userID"), time.Now())
+        if err != nil {
+                response.FailWithMessage("确认失败: "+err.Error(), c)
+                return
+        }
+
+        response.OkWithData(incident, c)
+}
+
+// ResolveAlert 人工恢复告警
+func ResolveAlert(c *gin.Context) {
+        id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+        if err != nil {
+                response.FailWithMessage("无效的ID", c)
+                return
+        }
+
+        var req struct {
+                Note string `json:"note"`
+        }
+        c.ShouldBindJSON(&req)
+
+        if err := detector.GetAlertManager().Resolve(uint(id), time.Now(), c.GetUint("userID"), req.Note, false); err != nil {
+                response.FailWithMessage("处理失败: "+err.Error(), c)
+                return
+        }
+
+        response.OkWithMessage("告警已恢复", c)
+}
+
+// GetIncidents 获取告警事件列表
+func GetIncidents(c *gin.Context) {
+        var incidents []detector.Incident
+
+        query := global.DB.Model(&detector.Incident{})
+
+        if status := c.Query("status"); status != "" {
+                query = query.Where("status = ?", status)
+        }
+        if level := c.Query("level"); level != "" {
+                query = query.Where("level = ?", level)
+        }
+        if serverId := c.Query("serverId"); serverId != "" {
+                query = query.Where("server_id = ?", serverId)
+        }
+
+        query.Order("id DESC").Limit(100).Find(&incidents)
+
+        response.OkWithData(incidents, c)
+}
+
+// GetIncident 获取事件详情及其告警
+func GetIncident(c *gin.Context) {
+        id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+        if err != nil {
+                response.FailWithMessage("无效的ID", c)
+                return
+        }
+
+        var incident detector.Incident
+        if err := global.DB.First(&incident, id).Error; err != nil {
+                response.FailWithMessage("事件不存在", c)
+                return
+        }
+
+        var alerts []detector.Alert
+        global.DB.Where("incident_id = ?", incident.ID).Order("id").Find(&alerts)
+
+        // 被抑制告警的根因告警，以及本事件告警作为根因抑制的下游告警，都可能属于其他事件
+        var ids, rootIDs []uint
+        for _, a := range alerts {
+                ids = append(ids, a.ID)
+                if a.InhibitedBy != 0 {
+                        rootIDs = append(rootIDs, a.InhibitedBy)
+                }
+        }
+        roots := []detector.Alert{}
+        if len(rootIDs) > 0 {
+                global.DB.Preload("Server").Where("id IN ?", rootIDs).Find(&roots)
+        }
+        inhibited := []detector.Alert{}
+        if len(ids) > 0 {
+                global.DB.Preload("Server").Where("inhibited_by IN ? AND status <> ?", ids, detector.AlertStatusResolved).
+                        Order("id").Limit(200).Find(&inhibited)
+        }
+
+        response.OkWithData(gin.H{
+                "incident":  incident,
+                "alerts":    alerts,
+                "roots":     roots,
+                "inhibited": inhibited,
+        }, c)
+}
+
+// AcknowledgeIncident 确认事件
+func AcknowledgeIncident(c *gin.Context) {
+        id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+        if err != nil {
+                response.FailWithMessage("无效的ID", c)
+                return
+        }
+
+        incident, err := detector.GetAlertManager().AcknowledgeIncident(uint(id), c.GetUint("userID"), time.Now())
+        if err != nil {
+                response.FailWithMessage("确认失败: "+err.Error(), c)
                 return
         }
 
-        alert.Status = "acknowledged"
-        // alert.AcknowledgedBy = userID // 从JWT获取
+        response.OkWithData(incident, c)
+}
+
+// ResolveIncident 人工关闭事件
+func ResolveIncident(c *gin.Context) {
+        id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+        if err != nil {
+                response.FailWithMessage("无效的ID", c)
+                return
+        }
+
+        var req struct {
+                Note string `json:"note"`
+        }
+        c.ShouldBindJSON(&req)
 
-        global.DB.Save(&alert)
+        if err := detector.GetAlertManager().ResolveIncident(uint(id), c.GetUint("userID"), time.Now(), req.Note); err != nil {
+                response.FailWithMessage("处理失败: "+err.Error(), c)
+                return
+        }
 
-        response.OkWithData(alert, c)
+        response.OkWithMessage("事件已关闭", c)
 }
 
 // GetRules 获取检测规则
@@ -471,6 +746,32 @@ func GetRules(c *gin.Context) {
         response.OkWithData(rules, c)
 }
 
+// CreateRule 创建检测规则
+func CreateRule(c *gin.Context) {
+        var rule detector.DetectRule
+        if err := c.ShouldBindJSON(&rule); err != nil {
+                response.FailWithMessage("参数错误", c)
+                return
+        }
+        if rule.Name == "" {
+                response.FailWithMessage("规则名称不能为空", c)
+                return
+        }
+        if err := detector.ValidateRule(&rule); err != nil {
+                response.FailWithMessage("规则无效: "+err.Error(), c)
+                return
+        }
+        rule.ID = 0
+
+        if err := global.DB.Create(&rule).Error; err != nil {
+                response.FailWithMessage("创建失败: "+err.Error(), c)
+                return
+        }
+        detector.GetRuleEngine().Reload()
+
+        response.OkWithData(rule, c)
+}
+
 // UpdateRule 更新检测规则
 func UpdateRule(c *gin.Context) {
         id, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -491,11 +792,66 @@ func UpdateRule(c *gin.Context) {
                 return
         }
 
+        // 合并后校验，表达式类规则不允许保存无法求值的内容
+        merged := rule
+        raw, _ := json.Marshal(req)
+        if err := json.Unmarshal(raw, &merged); err != nil {
+                response.FailWithMessage("参数错误: "+err.Error(), c)
+                return
+        }
+        if merged.Expr != "" {
+                if err := detector.ValidateRule(&merged); err != nil {
+                        response.FailWithMessage("规则无效: "+err.Error(), c)
+                        return
+                }
+        }
+        delete(req, "id")
+
         global.DB.Model(&rule).Updates(req)
+        detector.GetRuleEngine().Reload()
 
         response.OkWithData(rule, c)
 }
 
+// DeleteRule 删除检测规则
+func DeleteRule(c *gin.Context) {
+        id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+        if err != nil {
+                response.FailWithMessage("无效的ID", c)
+                return
+        }
+
+        if err := global.DB.Delete(&detector.DetectRule{}, id).Error; err != nil {
+                response.FailWithMessage("删除失败: "+err.Error(), c)
+                return
+        }
+        detector.GetRuleEngine().Reload()
+
+        response.OkWithMessage("删除成功", c)
+}
+
+// TestRule 按当前数据试算规则，返回各序列的值和是否满足条件
+func TestRule(c *gin.Context) {
+        var rule detector.DetectRule
+        if err := c.ShouldBindJSON(&rule); err != nil {
+                response.FailWithMessage("参数错误", c)
+                return
+        }
+
+        series, err := detector.GetRuleEngine().Preview(rule, time.Now())
+        if err != nil {
+                response.FailWithMessage("规则无效: "+err.Error(), c)
+                return
+        }
+
+        response.OkWithData(series, c)
+}
+
+// GetRuleStatus 获取规则运行状态和各序列的 pending/firing 告警
+func GetRuleStatus(c *gin.Context) {
+        response.OkWithData(detector.GetRuleEngine().Rules(), c)
+}
+
 // GetAutoActions 获取自动操作记录
 func GetAutoActions(c *gin.Context) {
         var actions []optimizer.AutoAction
@@ -559,19 +915,13 @@ func ApproveDecision(c *gin.Context) {
                 return
         }
 
-        var dec decision.AIDecision
-        if err := global.DB.First(&dec, id).Error; err != nil {
-                response.FailWithMessage("决策不存在", c)
+        userID, username := utils.CurrentUser(c)
+        dec, err := decision.Approve(uint(id), userID, username)
+        if err != nil {
+                response.FailWithMessage(err.Error(), c)
                 return
         }
 
-        dec.Status = decision.DecisionStatusApproved
-        now := time.Now()
-        dec.ApprovedAt = &now
-        // dec.ApprovedBy = userID
-
-        global.DB.Save(&dec)
-
         response.OkWithData(dec, c)
 }
 
@@ -588,20 +938,13 @@ func RejectDecision(c *gin.Context) {
         }
         c.ShouldBindJSON(&req)
 
-        var dec decision.AIDecision
-        if err := global.DB.First(&dec, id).Error; err != nil {
-                response.FailWithMessage("决策不存在", c)
+        userID, username := utils.CurrentUser(c)
+        dec, err := decision.Reject(uint(id), userID, username, req.Reason)
+        if err != nil {
+                response.FailWithMessage(err.Error(), c)
                 return
         }
 
-        dec.Status = decision.DecisionStatusRejected
-        now := time.Now()
-        dec.RejectedAt = &now
-        dec.RejectReason = req.Reason
-        // dec.RejectedBy = userID
-
-        global.DB.Save(&dec)
-
         response.OkWithData(dec, c)
 }
 
@@ -631,6 +974,8 @@ func ExecuteDecision(c *gin.Context) {
         dec.ExecutedAt = &now
 
         global.DB.Save(&dec)
+        _, username := utils.CurrentUser(c)
+        decision.PublishEvent(&dec, "executed", username)
 
         response.OkWithData(dec, c)
 }
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/security"
+	"yunwei/service/silence"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// auditChange 记录告警相关配置的变更
+func auditChange(c *gin.Context, action security.AuditAction, resource, command string) {
+	userID, username := utils.CurrentUser(c)
+	security.NewAuditService().LogFromGin(c, security.LogParams{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Resource: resource,
+		Command:  command,
+		Result:   "success",
+		Details:  map[string]interface{}{},
+	})
+}
+
+// ==================== 静默 ====================
+
+// silenceView 静默及其当前状态
+type silenceView struct {
+	silence.Silence
+	State string `json:"state"` // pending, active, expired
+}
+
+// GetSilences 获取静默列表，active=true 时只返回未结束的
+func GetSilences(c *gin.Context) {
+	var silences []silence.Silence
+
+	now := time.Now()
+	query := global.DB.Model(&silence.Silence{})
+	if c.Query("active") == "true" {
+		query = query.Where("ends_at > ?", now)
+	}
+	query.Order("id DESC").Limit(200).Find(&silences)
+
+	views := make([]silenceView, 0, len(silences))
+	for _, s := range silences {
+		state := "active"
+		switch {
+		case !now.Before(s.EndsAt):
+			state = "expired"
+		case now.Before(s.StartsAt):
+			state = "pending"
+		}
+		views = append(views, silenceView{Silence: s, State: state})
+	}
+
+	response.OkWithData(views, c)
+}
+
+// CreateSilence 创建静默
+func CreateSilence(c *gin.Context) {
+	var s silence.Silence
+	if err := c.ShouldBindJSON(&s); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	s.ID = 0
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if err := s.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	s.CreatedBy, s.Creator = utils.CurrentUser(c)
+
+	if err := global.DB.Create(&s).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	silence.GetService().Invalidate()
+	auditChange(c, security.AuditActionCreate, "silence",
+		fmt.Sprintf("#%d %s [%s ~ %s] %s", s.ID, s.Matchers, s.StartsAt.Format(time.RFC3339), s.EndsAt.Format(time.RFC3339), s.Comment))
+
+	response.OkWithData(s, c)
+}
+
+// ExpireSilence 提前结束静默，记录保留以便追溯
+func ExpireSilence(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var s silence.Silence
+	if err := global.DB.First(&s, id).Error; err != nil {
+		response.FailWithMessage("静默不存在", c)
+		return
+	}
+	now := time.Now()
+	if !now.Before(s.EndsAt) {
+		response.FailWithMessage("静默已结束", c)
+		return
+	}
+	// 未开始的静默结束时间不能早于开始时间
+	if now.Before(s.StartsAt) {
+		s.StartsAt = now
+	}
+	global.DB.Model(&s).Updates(map[string]interface{}{"starts_at": s.StartsAt, "ends_at": now})
+	silence.GetService().Invalidate()
+	auditChange(c, security.AuditActionDelete, "silence", fmt.Sprintf("#%d %s", s.ID, s.Matchers))
+
+	response.OkWithMessage("静默已结束", c)
+}
+
+// CheckSilence 查询服务器当前命中的静默和维护窗口
+func CheckSilence(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("serverId"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的服务器ID", c)
+		return
+	}
+
+	now := time.Now()
+	svc := silence.GetService()
+	response.OkWithData(gin.H{
+		"notify":   svc.Silenced(svc.ServerLabels(uint(id)), now),
+		"heal":     svc.HealSuppressed(uint(id), now),
+		"autoExec": svc.AutoExecSuppressed(uint(id), now),
+	}, c)
+}
+
+// ==================== 维护窗口 ====================
+
+// maintenanceView 维护窗口及接下来的执行时间
+type maintenanceView struct {
+	silence.MaintenanceWindow
+	Active   bool           `json:"active"`
+	NextRuns [][2]time.Time `json:"nextRuns"`
+}
+
+// GetMaintenanceWindows 获取维护窗口列表
+func GetMaintenanceWindows(c *gin.Context) {
+	var windows []silence.MaintenanceWindow
+	global.DB.Order("id DESC").Find(&windows)
+
+	now := time.Now()
+	views := make([]maintenanceView, 0, len(windows))
+	for _, w := range windows {
+		v := maintenanceView{MaintenanceWindow: w}
+		if runs, err := w.NextRuns(now, 3); err == nil {
+			v.NextRuns = runs
+			v.Active = w.Enabled && len(runs) > 0 && !runs[0][0].After(now)
+		}
+		views = append(views, v)
+	}
+
+	response.OkWithData(views, c)
+}
+
+// CreateMaintenanceWindow 创建维护窗口
+func CreateMaintenanceWindow(c *gin.Context) {
+	var w silence.MaintenanceWindow
+	if err := c.ShouldBindJSON(&w); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	w.ID = 0
+	if err := w.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	w.CreatedBy, w.Creator = utils.CurrentUser(c)
+
+	if err := global.DB.Create(&w).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	silence.GetService().Invalidate()
+	auditChange(c, security.AuditActionCreate, "maintenance_window",
+		fmt.Sprintf("#%d %s %s [%s, %d分钟]", w.ID, w.Name, w.Matchers, w.Schedule, w.Duration))
+
+	response.OkWithData(w, c)
+}
+
+// UpdateMaintenanceWindow 更新维护窗口
+func UpdateMaintenanceWindow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var w silence.MaintenanceWindow
+	if err := global.DB.First(&w, id).Error; err != nil {
+		response.FailWithMessage("维护窗口不存在", c)
+		return
+	}
+	if err := c.ShouldBindJSON(&w); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	w.ID = uint(id)
+	if err := w.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+
+	if err := global.DB.Select("name", "matchers", "schedule", "duration", "enabled", "comment",
+		"suppress_heal", "suppress_auto_exec").Updates(&w).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	silence.GetService().Invalidate()
+	auditChange(c, security.AuditActionUpdate, "maintenance_window",
+		fmt.Sprintf("#%d %s %s [%s, %d分钟] enabled=%t", w.ID, w.Name, w.Matchers, w.Schedule, w.Duration, w.Enabled))
+
+	response.OkWithData(w, c)
+}
+
+// DeleteMaintenanceWindow 删除维护窗口
+func DeleteMaintenanceWindow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var w silence.MaintenanceWindow
+	if err := global.DB.First(&w, id).Error; err != nil {
+		response.FailWithMessage("维护窗口不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&w).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	silence.GetService().Invalidate()
+	auditChange(c, security.AuditActionDelete, "maintenance_window", fmt.Sprintf("#%d %s", w.ID, w.Name))
+
+	response.OkWithMessage("删除成功", c)
+}
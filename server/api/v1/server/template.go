@@ -0,0 +1,146 @@
+package server
+
+import (
+	"fmt"
+	"strconv"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/notify"
+	"yunwei/service/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 通知模板 ====================
+
+// GetNotifyTemplates 获取通知模板列表
+func GetNotifyTemplates(c *gin.Context) {
+	var templates []notify.Template
+	db := global.DB.Order("tenant_id, event, channel")
+	if tenantID, ok := c.GetQuery("tenantId"); ok {
+		db = db.Where("tenant_id = ?", tenantID)
+	}
+	if event := c.Query("event"); event != "" {
+		db = db.Where("event = ?", event)
+	}
+	db.Find(&templates)
+	response.OkWithData(templates, c)
+}
+
+// GetBuiltinNotifyTemplate 获取内置模板，作为自定义模板的起点
+func GetBuiltinNotifyTemplate(c *gin.Context) {
+	response.OkWithData(notify.BuiltinTemplate(c.Query("event"), c.Query("channel")), c)
+}
+
+// CreateNotifyTemplate 创建通知模板，同一租户、事件类型和通道只能有一个模板
+func CreateNotifyTemplate(c *gin.Context) {
+	var t notify.Template
+	if err := c.ShouldBindJSON(&t); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	t.ID = 0
+	if err := t.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	var count int64
+	global.DB.Model(&notify.Template{}).Where("tenant_id = ? AND event = ? AND channel = ?", t.TenantID, t.Event, t.Channel).Count(&count)
+	if count > 0 {
+		response.FailWithMessage("该事件类型和通道已有模板", c)
+		return
+	}
+	if err := global.DB.Create(&t).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	notify.GetTemplateService().Invalidate()
+	auditChange(c, security.AuditActionCreate, "notify_template", fmt.Sprintf("#%d tenant=%s event=%s channel=%s", t.ID, t.TenantID, t.Event, t.Channel))
+
+	response.OkWithData(t, c)
+}
+
+// UpdateNotifyTemplate 更新通知模板的内容，所属租户、事件类型和通道不可修改
+func UpdateNotifyTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var t notify.Template
+	if err := global.DB.First(&t, id).Error; err != nil {
+		response.FailWithMessage("通知模板不存在", c)
+		return
+	}
+	tenantID, event, channel := t.TenantID, t.Event, t.Channel
+	if err := c.ShouldBindJSON(&t); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	t.ID, t.TenantID, t.Event, t.Channel = uint(id), tenantID, event, channel
+	if err := t.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Select("title", "body", "enabled", "comment").Updates(&t).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	notify.GetTemplateService().Invalidate()
+	auditChange(c, security.AuditActionUpdate, "notify_template",
+		fmt.Sprintf("#%d tenant=%s event=%s channel=%s enabled=%t", t.ID, t.TenantID, t.Event, t.Channel, t.Enabled))
+
+	response.OkWithData(t, c)
+}
+
+// DeleteNotifyTemplate 删除通知模板，删除后恢复使用上一级模板
+func DeleteNotifyTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return
+	}
+
+	var t notify.Template
+	if err := global.DB.First(&t, id).Error; err != nil {
+		response.FailWithMessage("通知模板不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&t).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	notify.GetTemplateService().Invalidate()
+	auditChange(c, security.AuditActionDelete, "notify_template", fmt.Sprintf("#%d tenant=%s event=%s channel=%s", t.ID, t.TenantID, t.Event, t.Channel))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// PreviewNotifyTemplate 用示例数据渲染未保存的模板，邮件返回完整的 HTML 页面
+func PreviewNotifyTemplate(c *gin.Context) {
+	var t notify.Template
+	if err := c.ShouldBindJSON(&t); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	if t.Body == "" {
+		builtin := notify.BuiltinTemplate(t.Event, t.Channel)
+		t.Title, t.Body = builtin.Title, builtin.Body
+	}
+	if err := t.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	title, body, err := notify.PreviewTemplate(&t)
+	if err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	response.OkWithData(gin.H{
+		"title":  title,
+		"body":   body,
+		"sample": notify.SampleTemplateData(t.Event),
+	}, c)
+}
@@ -0,0 +1,207 @@
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/service/detector"
+	"yunwei/service/security"
+	"yunwei/service/slo"
+	"yunwei/service/synthetic"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audit 记录 SLO 的变更
+func audit(c *gin.Context, action security.AuditAction, o *slo.SLO) {
+	userID, username := utils.CurrentUser(c)
+	security.NewAuditService().LogFromGin(c, security.LogParams{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Resource: "slo",
+		Command: fmt.Sprintf("#%d %s service=%s objective=%v%% window=%dd blockDeploys=%v",
+			o.ID, o.Name, o.Service, o.Objective, o.WindowDays, o.BlockDeploys),
+		Result:  "success",
+		Details: map[string]interface{}{},
+	})
+}
+
+// loadSLO 按路径参数加载 SLO
+func loadSLO(c *gin.Context) (*slo.SLO, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return nil, false
+	}
+	var o slo.SLO
+	if err := global.DB.First(&o, id).Error; err != nil {
+		response.FailWithMessage("SLO 不存在", c)
+		return nil, false
+	}
+	return &o, true
+}
+
+// validateCheck 拨测来源的 SLO 须关联已存在的检查
+func validateCheck(o *slo.SLO) error {
+	if o.Source != slo.SourceSynthetic {
+		return nil
+	}
+	var count int64
+	global.DB.Model(&synthetic.Check{}).Where("id = ?", o.CheckID).Count(&count)
+	if count == 0 {
+		return errors.New("拨测检查不存在")
+	}
+	return nil
+}
+
+// resolveAlerts SLO 停用或删除后恢复其燃烧率告警
+func resolveAlerts(o *slo.SLO) {
+	detector.GetAlertManager().SyncSLO(detector.SLOInfo{ID: o.ID, Name: o.Name}, nil, time.Now())
+}
+
+// GetSLOs 获取 SLO 列表及最近一次求值的状态
+func GetSLOs(c *gin.Context) {
+	var items []slo.SLO
+	db := global.DB.Order("id")
+	if tenantID, ok := c.GetQuery("tenantId"); ok {
+		db = db.Where("tenant_id = ?", tenantID)
+	}
+	if service := c.Query("service"); service != "" {
+		db = db.Where("service = ?", service)
+	}
+	if status := c.Query("status"); status != "" {
+		db = db.Where("status = ?", status)
+	}
+	db.Find(&items)
+	response.OkWithData(items, c)
+}
+
+// GetSLO 获取 SLO
+func GetSLO(c *gin.Context) {
+	o, ok := loadSLO(c)
+	if !ok {
+		return
+	}
+	response.OkWithData(o, c)
+}
+
+// CreateSLO 创建 SLO 并立即求值一次
+func CreateSLO(c *gin.Context) {
+	var o slo.SLO
+	if err := c.ShouldBindJSON(&o); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	o.ID, o.Status, o.SLI, o.BudgetRemaining, o.LastEvalAt, o.LastError = 0, "", 0, 0, nil, ""
+	if err := o.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := validateCheck(&o); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Create(&o).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	audit(c, security.AuditActionCreate, &o)
+
+	if o.Enabled {
+		slo.GetService().Sync(&o, time.Now())
+	}
+	response.OkWithData(o, c)
+}
+
+// UpdateSLO 更新 SLO，修改后立即按新配置求值
+func UpdateSLO(c *gin.Context) {
+	o, ok := loadSLO(c)
+	if !ok {
+		return
+	}
+	id := o.ID
+	if err := c.ShouldBindJSON(o); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	o.ID = id
+	if err := o.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := validateCheck(o); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	err := global.DB.Model(o).Select(
+		"tenant_id", "name", "service", "description", "source", "check_id", "good_query", "total_query",
+		"objective", "window_days", "block_deploys", "enabled",
+	).Updates(o).Error
+	if err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	audit(c, security.AuditActionUpdate, o)
+
+	if o.Enabled {
+		slo.GetService().Sync(o, time.Now())
+	} else {
+		// 停用的 SLO 不再阻止发布
+		global.DB.Model(o).Update("status", "")
+		o.Status = ""
+		resolveAlerts(o)
+	}
+	response.OkWithData(o, c)
+}
+
+// DeleteSLO 删除 SLO，未恢复的燃烧率告警随之恢复
+func DeleteSLO(c *gin.Context) {
+	o, ok := loadSLO(c)
+	if !ok {
+		return
+	}
+	if err := global.DB.Delete(o).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	resolveAlerts(o)
+	audit(c, security.AuditActionDelete, o)
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// GetReport 获取 SLO 报告：当前窗口的达标比例、错误预算、各燃烧率规则和按天的预算消耗
+func GetReport(c *gin.Context) {
+	o, ok := loadSLO(c)
+	if !ok {
+		return
+	}
+	report, err := slo.GetService().Report(o, time.Now())
+	if err != nil {
+		response.FailWithMessage("生成报告失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(report, c)
+}
+
+// CheckGate 查询租户的服务当前能否发布，供外部流水线在发布前调用
+func CheckGate(c *gin.Context) {
+	service := c.Query("service")
+	if service == "" {
+		response.FailWithMessage("缺少服务名", c)
+		return
+	}
+	tenantID := c.Query("tenantId")
+	result := gin.H{"tenantId": tenantID, "service": service, "allowed": true}
+	if err := slo.GetService().CheckRelease(tenantID, service); err != nil {
+		result["allowed"] = false
+		result["reason"] = err.Error()
+	}
+	response.OkWithData(result, c)
+}
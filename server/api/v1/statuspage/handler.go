@@ -0,0 +1,595 @@
+package statuspage
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/common/response"
+	"yunwei/model/server"
+	"yunwei/service/security"
+	"yunwei/service/statuspage"
+	"yunwei/service/synthetic"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// audit 记录状态页和事件的变更
+func audit(c *gin.Context, action security.AuditAction, resource, command string) {
+	userID, username := utils.CurrentUser(c)
+	security.NewAuditService().LogFromGin(c, security.LogParams{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Resource: resource,
+		Command:  command,
+		Result:   "success",
+		Details:  map[string]interface{}{},
+	})
+}
+
+// parseID 解析路径参数中的 ID
+func parseID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// loadPage 按路径参数加载状态页
+func loadPage(c *gin.Context) (*statuspage.Page, bool) {
+	id, ok := parseID(c)
+	if !ok {
+		return nil, false
+	}
+	var p statuspage.Page
+	if err := global.DB.First(&p, id).Error; err != nil {
+		response.FailWithMessage("状态页不存在", c)
+		return nil, false
+	}
+	return &p, true
+}
+
+// ==================== 公开访问 ====================
+
+// servePage 按请求的格式输出状态页，不存在或未公开时返回 404
+func servePage(c *gin.Context, p *statuspage.Page, err error, asJSON bool) {
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.String(http.StatusNotFound, "404 page not found")
+		} else {
+			c.String(http.StatusInternalServerError, "状态页暂时不可用")
+		}
+		return
+	}
+	summary, err := statuspage.GetService().Summary(p, time.Now())
+	if err != nil {
+		c.String(http.StatusInternalServerError, "状态页暂时不可用")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=30")
+	if asJSON {
+		c.JSON(http.StatusOK, summary)
+		return
+	}
+	html, err := statuspage.Render(summary)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "状态页暂时不可用")
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+}
+
+// PublicPage 公开状态页(HTML)
+func PublicPage(c *gin.Context) {
+	p, err := statuspage.GetService().FindPublic(c.Param("slug"), "")
+	servePage(c, p, err, false)
+}
+
+// PublicSummary 公开状态页(JSON)
+func PublicSummary(c *gin.Context) {
+	p, err := statuspage.GetService().FindPublic(c.Param("slug"), "")
+	servePage(c, p, err, true)
+}
+
+// CustomDomain 未匹配路由的请求按 Host 查找绑定了自定义域名的状态页，根路径返回 HTML，/summary.json 返回 JSON
+func CustomDomain(c *gin.Context) {
+	path := c.Request.URL.Path
+	if c.Request.Method != http.MethodGet || (path != "/" && path != "/summary.json") {
+		c.String(http.StatusNotFound, "404 page not found")
+		return
+	}
+	host := c.Request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	p, err := statuspage.GetService().FindPublic("", host)
+	servePage(c, p, err, path == "/summary.json")
+}
+
+// ==================== 状态页 ====================
+
+// GetPages 获取状态页列表
+func GetPages(c *gin.Context) {
+	var pages []statuspage.Page
+	db := global.DB.Order("id")
+	if tenantID, ok := c.GetQuery("tenantId"); ok {
+		db = db.Where("tenant_id = ?", tenantID)
+	}
+	db.Find(&pages)
+	response.OkWithData(pages, c)
+}
+
+// GetPage 获取状态页
+func GetPage(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	response.OkWithData(p, c)
+}
+
+// GetPageSummary 获取状态页汇总，内部页也可查看
+func GetPageSummary(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	summary, err := statuspage.GetService().Summary(p, time.Now())
+	if err != nil {
+		response.FailWithMessage("获取失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(summary, c)
+}
+
+// validatePage 校验配置，标识和自定义域名不能与其他状态页重复
+func validatePage(p *statuspage.Page) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	var count int64
+	global.DB.Model(&statuspage.Page{}).Where("slug = ? AND id <> ?", p.Slug, p.ID).Count(&count)
+	if count > 0 {
+		return fmt.Errorf("标识 %s 已被使用", p.Slug)
+	}
+	if p.CustomDomain != "" {
+		global.DB.Model(&statuspage.Page{}).Where("custom_domain = ? AND id <> ?", p.CustomDomain, p.ID).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("域名 %s 已绑定其他状态页", p.CustomDomain)
+		}
+	}
+	return nil
+}
+
+// CreatePage 创建状态页
+func CreatePage(c *gin.Context) {
+	var p statuspage.Page
+	if err := c.ShouldBindJSON(&p); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	p.ID = 0
+	if err := validatePage(&p); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Create(&p).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	audit(c, security.AuditActionCreate, "status_page", fmt.Sprintf("#%d %s slug=%s public=%v", p.ID, p.Name, p.Slug, p.Public))
+
+	response.OkWithData(p, c)
+}
+
+// UpdatePage 更新状态页
+func UpdatePage(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	id := p.ID
+	if err := c.ShouldBindJSON(p); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	p.ID = id
+	if err := validatePage(p); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	err := global.DB.Model(p).Select("tenant_id", "name", "slug", "description", "public", "custom_domain", "enabled").
+		Updates(p).Error
+	if err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(p.ID)
+	audit(c, security.AuditActionUpdate, "status_page", fmt.Sprintf("#%d %s slug=%s public=%v", p.ID, p.Name, p.Slug, p.Public))
+
+	response.OkWithData(p, c)
+}
+
+// DeletePage 删除状态页及其组件和事件
+func DeletePage(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		var incidentIDs []uint
+		tx.Model(&statuspage.Incident{}).Where("page_id = ?", p.ID).Pluck("id", &incidentIDs)
+		if len(incidentIDs) > 0 {
+			if err := tx.Where("incident_id IN ?", incidentIDs).Delete(&statuspage.IncidentUpdate{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("page_id = ?", p.ID).Delete(&statuspage.Incident{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("page_id = ?", p.ID).Delete(&statuspage.Component{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(p).Error
+	})
+	if err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(p.ID)
+	audit(c, security.AuditActionDelete, "status_page", fmt.Sprintf("#%d %s slug=%s", p.ID, p.Name, p.Slug))
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// ==================== 组件 ====================
+
+// GetComponents 获取状态页的组件
+func GetComponents(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	var components []statuspage.Component
+	global.DB.Where("page_id = ?", p.ID).Order("sort_order, id").Find(&components)
+	response.OkWithData(components, c)
+}
+
+// validateComponent 组件关联的检查或分组须存在，租户状态页只能关联本租户的检查
+func validateComponent(p *statuspage.Page, comp *statuspage.Component) error {
+	if err := comp.Validate(); err != nil {
+		return err
+	}
+	if comp.Source == statuspage.SourceSynthetic {
+		var check synthetic.Check
+		if err := global.DB.First(&check, comp.CheckID).Error; err != nil {
+			return errors.New("拨测检查不存在")
+		}
+		if p.TenantID != "" && check.TenantID != p.TenantID {
+			return errors.New("不能关联其他租户的拨测检查")
+		}
+		return nil
+	}
+	var count int64
+	global.DB.Model(&server.Group{}).Where("id = ?", comp.GroupID).Count(&count)
+	if count == 0 {
+		return errors.New("服务器分组不存在")
+	}
+	return nil
+}
+
+// CreateComponent 添加组件
+func CreateComponent(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	var comp statuspage.Component
+	if err := c.ShouldBindJSON(&comp); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	comp.ID, comp.PageID = 0, p.ID
+	if err := validateComponent(p, &comp); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Create(&comp).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(p.ID)
+
+	response.OkWithData(comp, c)
+}
+
+// UpdateComponent 更新组件
+func UpdateComponent(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	var comp statuspage.Component
+	if err := global.DB.First(&comp, id).Error; err != nil {
+		response.FailWithMessage("组件不存在", c)
+		return
+	}
+	pageID := comp.PageID
+	if err := c.ShouldBindJSON(&comp); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	comp.ID, comp.PageID = id, pageID
+	var p statuspage.Page
+	global.DB.First(&p, pageID)
+	if err := validateComponent(&p, &comp); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	err := global.DB.Model(&comp).Select("name", "description", "source", "check_id", "group_id", "sort_order").
+		Updates(&comp).Error
+	if err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(pageID)
+
+	response.OkWithData(comp, c)
+}
+
+// DeleteComponent 删除组件
+func DeleteComponent(c *gin.Context) {
+	id, ok := parseID(c)
+	if !ok {
+		return
+	}
+	var comp statuspage.Component
+	if err := global.DB.First(&comp, id).Error; err != nil {
+		response.FailWithMessage("组件不存在", c)
+		return
+	}
+	if err := global.DB.Delete(&comp).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(comp.PageID)
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// ==================== 事件 ====================
+
+// loadIncident 按路径参数加载事件及其进展
+func loadIncident(c *gin.Context) (*statuspage.Incident, bool) {
+	id, ok := parseID(c)
+	if !ok {
+		return nil, false
+	}
+	var inc statuspage.Incident
+	err := global.DB.Preload("Updates", func(db *gorm.DB) *gorm.DB { return db.Order("id DESC") }).First(&inc, id).Error
+	if err != nil {
+		response.FailWithMessage("事件不存在", c)
+		return nil, false
+	}
+	return &inc, true
+}
+
+// validateIncidentComponents 受影响的组件须属于该状态页
+func validateIncidentComponents(inc *statuspage.Incident) error {
+	ids := inc.ComponentIDs()
+	if len(ids) == 0 {
+		inc.Components = ""
+		return nil
+	}
+	var count int64
+	global.DB.Model(&statuspage.Component{}).Where("page_id = ? AND id IN ?", inc.PageID, ids).Count(&count)
+	if int(count) != len(ids) {
+		return errors.New("受影响的组件不属于该状态页")
+	}
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	inc.Components = strings.Join(parts, ",")
+	return nil
+}
+
+// GetIncidents 获取状态页的事件，status 为 open 时只返回未解决的
+func GetIncidents(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	db := global.DB.Where("page_id = ?", p.ID)
+	switch status := c.Query("status"); status {
+	case "":
+	case "open":
+		db = db.Where("status <> ?", statuspage.IncidentResolved)
+	default:
+		db = db.Where("status = ?", status)
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var incidents []statuspage.Incident
+	db.Order("id DESC").Limit(limit).Find(&incidents)
+	response.OkWithData(incidents, c)
+}
+
+// GetIncident 获取事件及其进展
+func GetIncident(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	response.OkWithData(inc, c)
+}
+
+// CreateIncident 发布事件，message 作为第一条进展
+func CreateIncident(c *gin.Context) {
+	p, ok := loadPage(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		statuspage.Incident
+		Message string `json:"message"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		response.FailWithMessage("缺少事件说明", c)
+		return
+	}
+	inc := req.Incident
+	inc.ID, inc.PageID, inc.ResolvedAt, inc.Updates = 0, p.ID, nil, nil
+	if err := inc.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := validateIncidentComponents(&inc); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	inc.CreatedBy, inc.Creator = utils.CurrentUser(c)
+	now := time.Now()
+	if inc.Status == statuspage.IncidentResolved {
+		inc.ResolvedAt = &now
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Updates").Create(&inc).Error; err != nil {
+			return err
+		}
+		return tx.Create(&statuspage.IncidentUpdate{
+			IncidentID: inc.ID,
+			Status:     inc.Status,
+			Message:    req.Message,
+			CreatedBy:  inc.CreatedBy,
+			Creator:    inc.Creator,
+		}).Error
+	})
+	if err != nil {
+		response.FailWithMessage("发布失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(p.ID)
+	audit(c, security.AuditActionCreate, "status_page_incident", fmt.Sprintf("#%d %s page=%d impact=%s", inc.ID, inc.Title, p.ID, inc.Impact))
+
+	response.OkWithData(inc, c)
+}
+
+// UpdateIncident 修改事件标题、影响程度和受影响的组件，状态通过发布进展修改
+func UpdateIncident(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Title      string `json:"title"`
+		Impact     string `json:"impact"`
+		Components string `json:"components"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	inc.Title, inc.Impact, inc.Components = req.Title, req.Impact, req.Components
+	if err := inc.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := validateIncidentComponents(inc); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Model(inc).Select("title", "impact", "components").Updates(inc).Error; err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(inc.PageID)
+	audit(c, security.AuditActionUpdate, "status_page_incident", fmt.Sprintf("#%d %s impact=%s", inc.ID, inc.Title, inc.Impact))
+
+	response.OkWithData(inc, c)
+}
+
+// PostIncidentUpdate 发布事件进展并更新事件状态，状态为 resolved 时事件结束
+func PostIncidentUpdate(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Status  string `json:"status" binding:"required"`
+		Message string `json:"message" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	if err := statuspage.ValidateStatus(req.Status); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+
+	userID, username := utils.CurrentUser(c)
+	update := statuspage.IncidentUpdate{
+		IncidentID: inc.ID,
+		Status:     req.Status,
+		Message:    req.Message,
+		CreatedBy:  userID,
+		Creator:    username,
+	}
+	updates := map[string]interface{}{"status": req.Status, "resolved_at": nil}
+	if req.Status == statuspage.IncidentResolved {
+		updates["resolved_at"] = time.Now()
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&update).Error; err != nil {
+			return err
+		}
+		return tx.Model(&statuspage.Incident{}).Where("id = ?", inc.ID).Updates(updates).Error
+	})
+	if err != nil {
+		response.FailWithMessage("发布失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(inc.PageID)
+	audit(c, security.AuditActionUpdate, "status_page_incident", fmt.Sprintf("#%d %s status=%s", inc.ID, inc.Title, req.Status))
+
+	response.OkWithData(update, c)
+}
+
+// DeleteIncident 删除事件及其进展
+func DeleteIncident(c *gin.Context) {
+	inc, ok := loadIncident(c)
+	if !ok {
+		return
+	}
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("incident_id = ?", inc.ID).Delete(&statuspage.IncidentUpdate{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&statuspage.Incident{}, inc.ID).Error
+	})
+	if err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	statuspage.GetService().Invalidate(inc.PageID)
+	audit(c, security.AuditActionDelete, "status_page_incident", fmt.Sprintf("#%d %s", inc.ID, inc.Title))
+
+	response.OkWithMessage("删除成功", c)
+}
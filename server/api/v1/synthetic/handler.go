@@ -0,0 +1,380 @@
+package synthetic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/agent"
+	"yunwei/model/common/response"
+	"yunwei/service/cdn"
+	"yunwei/service/detector"
+	"yunwei/service/loadbalancer"
+	"yunwei/service/security"
+	"yunwei/service/synthetic"
+	"yunwei/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRange 可用率查询的最大时间范围
+const maxRange = 90 * 24 * time.Hour
+
+// audit 记录拨测检查的变更
+func audit(c *gin.Context, action security.AuditAction, check *synthetic.Check) {
+	userID, username := utils.CurrentUser(c)
+	security.NewAuditService().LogFromGin(c, security.LogParams{
+		UserID:   userID,
+		Username: username,
+		Action:   action,
+		Resource: "synthetic_check",
+		Command:  fmt.Sprintf("#%d %s %s %s locations=%s", check.ID, check.Name, check.Type, check.Target, check.Locations),
+		Result:   "success",
+		Details:  map[string]interface{}{},
+	})
+}
+
+// parseTime 解析时间参数，支持 Unix 秒和 RFC3339
+func parseTime(v string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseRange 解析时间范围参数，在 time.ParseDuration 基础上支持天(d)
+func parseRange(v string) (time.Duration, error) {
+	if strings.HasSuffix(v, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(v, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// validateLocations 拨测地点除 server 外须为已注册的 Agent
+func validateLocations(check *synthetic.Check) error {
+	var agentIDs []string
+	for _, l := range check.LocationList() {
+		if l != synthetic.LocationServer {
+			agentIDs = append(agentIDs, l)
+		}
+	}
+	if len(agentIDs) == 0 {
+		return nil
+	}
+	var found []string
+	global.DB.Model(&agent.Agent{}).Where("agent_id IN ?", agentIDs).Pluck("agent_id", &found)
+	known := make(map[string]bool, len(found))
+	for _, id := range found {
+		known[id] = true
+	}
+	for _, id := range agentIDs {
+		if !known[id] {
+			return fmt.Errorf("Agent %s 不存在", id)
+		}
+	}
+	return nil
+}
+
+// loadCheck 按路径参数加载检查
+func loadCheck(c *gin.Context) (*synthetic.Check, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的ID", c)
+		return nil, false
+	}
+	var check synthetic.Check
+	if err := global.DB.First(&check, id).Error; err != nil {
+		response.FailWithMessage("检查不存在", c)
+		return nil, false
+	}
+	return &check, true
+}
+
+// ==================== 检查 ====================
+
+// GetChecks 获取拨测检查列表
+func GetChecks(c *gin.Context) {
+	var checks []synthetic.Check
+	db := global.DB.Order("id")
+	if tenantID, ok := c.GetQuery("tenantId"); ok {
+		db = db.Where("tenant_id = ?", tenantID)
+	}
+	if typ := c.Query("type"); typ != "" {
+		db = db.Where("type = ?", typ)
+	}
+	if status := c.Query("status"); status != "" {
+		db = db.Where("status = ?", status)
+	}
+	if resource := c.Query("resource"); resource != "" {
+		db = db.Where("resource = ? AND resource_id = ?", resource, c.Query("resourceId"))
+	}
+	db.Find(&checks)
+	response.OkWithData(checks, c)
+}
+
+// GetCheck 获取拨测检查
+func GetCheck(c *gin.Context) {
+	check, ok := loadCheck(c)
+	if !ok {
+		return
+	}
+	response.OkWithData(check, c)
+}
+
+// CreateCheck 创建拨测检查，由 Leader 在下一个调度周期开始执行
+func CreateCheck(c *gin.Context) {
+	var check synthetic.Check
+	if err := c.ShouldBindJSON(&check); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	check.ID, check.Status, check.LastRunAt, check.LastError = 0, "", nil, ""
+	if err := check.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := validateLocations(&check); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := global.DB.Create(&check).Error; err != nil {
+		response.FailWithMessage("创建失败", c)
+		return
+	}
+	audit(c, security.AuditActionCreate, &check)
+
+	response.OkWithData(check, c)
+}
+
+// UpdateCheck 更新拨测检查，修改后立即按新配置执行
+func UpdateCheck(c *gin.Context) {
+	check, ok := loadCheck(c)
+	if !ok {
+		return
+	}
+	id := check.ID
+	if err := c.ShouldBindJSON(check); err != nil {
+		response.FailWithMessage("参数错误", c)
+		return
+	}
+	check.ID = id
+	if err := check.Validate(); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	if err := validateLocations(check); err != nil {
+		response.FailWithMessage(err.Error(), c)
+		return
+	}
+	err := global.DB.Model(check).Select(
+		"tenant_id", "name", "type", "target", "interval", "timeout", "locations", "fail_threshold", "level",
+		"assertions", "method", "headers", "body", "no_redirects", "skip_verify", "record_type", "resolver",
+		"resource", "resource_id", "enabled", "comment",
+	).Updates(check).Error
+	if err != nil {
+		response.FailWithMessage("更新失败", c)
+		return
+	}
+	global.DB.Model(check).Update("last_run_at", nil)
+	if !check.Enabled {
+		resolveAlert(check)
+	}
+	audit(c, security.AuditActionUpdate, check)
+
+	response.OkWithData(check, c)
+}
+
+// DeleteCheck 删除拨测检查及其结果，未恢复的告警随之恢复
+func DeleteCheck(c *gin.Context) {
+	check, ok := loadCheck(c)
+	if !ok {
+		return
+	}
+	if err := global.DB.Delete(check).Error; err != nil {
+		response.FailWithMessage("删除失败", c)
+		return
+	}
+	global.DB.Where("check_id = ?", check.ID).Delete(&synthetic.Result{})
+	resolveAlert(check)
+	audit(c, security.AuditActionDelete, check)
+
+	response.OkWithMessage("删除成功", c)
+}
+
+// resolveAlert 检查停用或删除后恢复其告警
+func resolveAlert(check *synthetic.Check) {
+	detector.GetAlertManager().SyncSynthetic(detector.SyntheticCheck{ID: check.ID, Name: check.Name}, nil, 1, time.Now())
+}
+
+// RunCheck 立即执行一次检查，结果同样计入可用率和告警
+func RunCheck(c *gin.Context) {
+	check, ok := loadCheck(c)
+	if !ok {
+		return
+	}
+	results, err := synthetic.GetRunner().Run(c.Request.Context(), check, time.Now())
+	if err != nil {
+		response.FailWithMessage("执行失败: "+err.Error(), c)
+		return
+	}
+	response.OkWithData(results, c)
+}
+
+// ==================== 结果与可用率 ====================
+
+// GetResults 获取检查最近的拨测结果，可按地点和成功与否筛选
+func GetResults(c *gin.Context) {
+	check, ok := loadCheck(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	db := global.DB.Where("check_id = ?", check.ID)
+	if location := c.Query("location"); location != "" {
+		db = db.Where("location = ?", location)
+	}
+	if success := c.Query("success"); success != "" {
+		db = db.Where("success = ?", success == "true")
+	}
+	var results []synthetic.Result
+	db.Order("id DESC").Limit(limit).Find(&results)
+	response.OkWithData(results, c)
+}
+
+// GetAvailability 获取检查的可用率历史，默认最近 24 小时；step 为分桶间隔，如 5m、1h
+func GetAvailability(c *gin.Context) {
+	check, ok := loadCheck(c)
+	if !ok {
+		return
+	}
+
+	var err error
+	end := time.Now()
+	if v := c.Query("end"); v != "" {
+		if end, err = parseTime(v); err != nil {
+			response.FailWithMessage("无效的结束时间", c)
+			return
+		}
+	}
+	start := end.Add(-24 * time.Hour)
+	if v := c.Query("range"); v != "" {
+		d, err := parseRange(v)
+		if err != nil || d <= 0 {
+			response.FailWithMessage("无效的时间范围", c)
+			return
+		}
+		start = end.Add(-d)
+	}
+	if v := c.Query("start"); v != "" {
+		if start, err = parseTime(v); err != nil {
+			response.FailWithMessage("无效的开始时间", c)
+			return
+		}
+	}
+	if !end.After(start) || end.Sub(start) > maxRange {
+		response.FailWithMessage("时间范围需在 90 天以内", c)
+		return
+	}
+	var step time.Duration
+	if v := c.Query("step"); v != "" {
+		if step, err = parseRange(v); err != nil {
+			response.FailWithMessage("无效的分桶间隔", c)
+			return
+		}
+	}
+
+	response.OkWithData(synthetic.GetRunner().Availability(check.ID, start, end, step), c)
+}
+
+// ==================== 优化验证 ====================
+
+// ValidateOptimization 用关联的拨测检查验证 CDN 或负载均衡优化的效果：
+// 对比优化记录完成时间（或 at 指定的时间）前后各 window（默认 1h）内的可用率和延迟
+func ValidateOptimization(c *gin.Context) {
+	resource := c.Query("resource")
+	resourceID, err := strconv.ParseUint(c.Query("resourceId"), 10, 32)
+	if err != nil {
+		response.FailWithMessage("无效的资源ID", c)
+		return
+	}
+
+	var at time.Time
+	if v := c.Query("recordId"); v != "" {
+		recordID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			response.FailWithMessage("无效的优化记录ID", c)
+			return
+		}
+		if at, err = optimizedAt(resource, uint(resourceID), uint(recordID)); err != nil {
+			response.FailWithMessage(err.Error(), c)
+			return
+		}
+	} else if v := c.Query("at"); v != "" {
+		if at, err = parseTime(v); err != nil {
+			response.FailWithMessage("无效的时间", c)
+			return
+		}
+	} else {
+		response.FailWithMessage("需指定 recordId 或 at", c)
+		return
+	}
+
+	window := time.Hour
+	if v := c.Query("window"); v != "" {
+		if window, err = parseRange(v); err != nil || window <= 0 || window > 7*24*time.Hour {
+			response.FailWithMessage("对比窗口需在 7 天以内", c)
+			return
+		}
+	}
+
+	response.OkWithData(gin.H{
+		"resource":    resource,
+		"resourceId":  resourceID,
+		"at":          at,
+		"window":      int64(window / time.Second),
+		"comparisons": synthetic.GetRunner().Compare(resource, uint(resourceID), at, window),
+	}, c)
+}
+
+// optimizedAt 优化记录的完成时间，未完成时取开始时间
+func optimizedAt(resource string, resourceID, recordID uint) (time.Time, error) {
+	var owner uint
+	var createdAt time.Time
+	var startedAt, completedAt *time.Time
+	switch resource {
+	case synthetic.ResourceCDNDomain:
+		var record cdn.CDNOptimizationRecord
+		if err := global.DB.First(&record, recordID).Error; err != nil {
+			return time.Time{}, errors.New("优化记录不存在")
+		}
+		owner, createdAt, startedAt, completedAt = record.DomainID, record.CreatedAt, record.StartedAt, record.CompletedAt
+	case synthetic.ResourceLoadBalancer:
+		var record loadbalancer.OptimizationRecord
+		if err := global.DB.First(&record, recordID).Error; err != nil {
+			return time.Time{}, errors.New("优化记录不存在")
+		}
+		owner, createdAt, startedAt, completedAt = record.LBID, record.CreatedAt, record.StartedAt, record.CompletedAt
+	default:
+		return time.Time{}, fmt.Errorf("不支持的关联资源 %s", resource)
+	}
+	if owner != resourceID {
+		return time.Time{}, errors.New("优化记录不属于该资源")
+	}
+	switch {
+	case completedAt != nil:
+		return *completedAt, nil
+	case startedAt != nil:
+		return *startedAt, nil
+	}
+	return createdAt, nil
+}
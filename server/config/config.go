@@ -7,12 +7,21 @@ import (
 var CONFIG Server
 
 type Server struct {
-        System   System
-        Mysql    Mysql
-        Redis    Redis
-        JWT      JWT
-        AI       AI
-        Security Security
+        System       System
+        Mysql        Mysql
+        Redis        Redis
+        JWT          JWT
+        AI           AI
+        Security     Security
+        Metrics      Metrics
+        Grpc         Grpc
+        Alerting     Alerting
+        Smtp         Smtp
+        NotifyOutbox NotifyOutbox `mapstructure:"notify-outbox"`
+        ChatOps      ChatOps      `mapstructure:"chatops"`
+        Synthetic    Synthetic    `mapstructure:"synthetic"`
+        Events       Events       `mapstructure:"events"`
+        Incidents    Incidents    `mapstructure:"incidents"`
 }
 
 type System struct {
@@ -20,6 +29,10 @@ type System struct {
         GrpcPort string `mapstructure:"grpc-port"`
         Env      string `mapstructure:"env"`
         Name     string `mapstructure:"name"`
+        // AdvertiseAddr 集群内其他节点访问本节点 API 的地址，为空时取内网 IP + 端口
+        AdvertiseAddr string `mapstructure:"advertise-addr"`
+        // MetricsToken 抓取 /metrics 需携带的 Bearer 令牌，为空时不开放该接口
+        MetricsToken string `mapstructure:"metrics-token"`
 }
 
 type Mysql struct {
@@ -53,6 +66,55 @@ type AI struct {
         MaxTokens   int    `mapstructure:"max-tokens"`
         Temperature float64 `mapstructure:"temperature"`
         AutoExecute bool   `mapstructure:"auto-execute"` // 是否自动执行低风险命令
+
+        // 多个大模型提供方，为空时用上面的 api-key、base-url、model 作为唯一的 GLM 提供方
+        Providers []LLMProvider         `mapstructure:"providers"`
+        Default   LLMRoute              `mapstructure:"default"`  // 默认路由，未指定提供方时用第一个
+        Features  map[string]LLMRoute   `mapstructure:"features"` // 按功能覆盖，如 decision、incident
+        Tenants   map[string]LLMTenant  `mapstructure:"tenants"`  // 按租户 ID 覆盖
+        Breaker   LLMBreaker            `mapstructure:"breaker"`
+        Diagnose  AIDiagnose            `mapstructure:"diagnose"`
+}
+
+// LLMProvider 大模型提供方
+type LLMProvider struct {
+        Name        string   `mapstructure:"name"`
+        Type        string   `mapstructure:"type"` // glm, openai, ollama, mock
+        BaseURL     string   `mapstructure:"base-url"`
+        APIKey      string   `mapstructure:"api-key"`
+        Model       string   `mapstructure:"model"`
+        MaxTokens   int      `mapstructure:"max-tokens"`
+        Temperature float64  `mapstructure:"temperature"`
+        Timeout     int      `mapstructure:"timeout"`   // 请求超时(秒)
+        Local       bool     `mapstructure:"local"`     // 部署在内网，数据不出本地
+        Responses   []string `mapstructure:"responses"` // mock 的预设回复
+}
+
+// LLMRoute 选择提供方的规则，未填的字段沿用上一级
+type LLMRoute struct {
+        Provider    string   `mapstructure:"provider"`
+        Fallback    []string `mapstructure:"fallback"`    // 首选失败或熔断时依次尝试
+        Model       string   `mapstructure:"model"`       // 覆盖首选提供方的型号
+        Temperature float64  `mapstructure:"temperature"` // 覆盖降级链上所有提供方的温度
+}
+
+// LLMTenant 租户的大模型配置
+type LLMTenant struct {
+        LocalOnly bool                `mapstructure:"local-only"` // 只用 local 的提供方，没有时该租户不调用大模型
+        Default   LLMRoute            `mapstructure:"default"`
+        Features  map[string]LLMRoute `mapstructure:"features"`
+}
+
+// LLMBreaker 提供方熔断
+type LLMBreaker struct {
+        FailureThreshold int `mapstructure:"failure-threshold"` // 连续失败多少次后熔断，默认 3
+        Cooldown         int `mapstructure:"cooldown"`          // 熔断时长(秒)，默认 60
+}
+
+// AIDiagnose 多步诊断
+type AIDiagnose struct {
+        MaxSteps    int `mapstructure:"max-steps"`    // 每次诊断最多调用工具的次数，默认 8
+        ToolTimeout int `mapstructure:"tool-timeout"` // 单次工具调用超时(秒)，默认 30
 }
 
 type Security struct {
@@ -63,6 +125,102 @@ type Security struct {
         AuditRetentionDays int  `mapstructure:"audit-retention-days"` // 审计日志保留天数
 }
 
+// Metrics 时序指标存储配置
+type Metrics struct {
+        Store                 string `mapstructure:"store"`                    // 存储后端: sql, tsdb
+        DataDir               string `mapstructure:"data-dir"`                 // TSDB 数据目录
+        QueueSize             int    `mapstructure:"queue-size"`               // 写入缓冲队列长度
+        BatchSize             int    `mapstructure:"batch-size"`               // 批量写入条数
+        FlushInterval         int    `mapstructure:"flush-interval"`           // 刷盘间隔(秒)
+        RawRetentionHours     int    `mapstructure:"raw-retention-hours"`      // 原始数据保留小时数
+        Rollup1mRetentionDays int    `mapstructure:"rollup-1m-retention-days"` // 1分钟聚合保留天数
+        Rollup5mRetentionDays int    `mapstructure:"rollup-5m-retention-days"` // 5分钟聚合保留天数
+        DefaultRetentionDays  int    `mapstructure:"default-retention-days"`   // 无租户配额时的保留天数
+}
+
+// Alerting 告警规则引擎配置
+type Alerting struct {
+        EvalInterval   int      `mapstructure:"eval-interval"`   // 规则默认求值间隔(秒)
+        GroupBy        []string `mapstructure:"group-by"`        // 告警合并为事件的维度: rule, server, group 或标签名
+        RepeatInterval int      `mapstructure:"repeat-interval"` // 未确认事件的重复通知间隔(分钟)
+        Notify         Notify   `mapstructure:"notify"`
+}
+
+// Notify 告警通知通道，留空的通道不启用
+type Notify struct {
+        TelegramToken   string   `mapstructure:"telegram-token"`
+        TelegramChatID  string   `mapstructure:"telegram-chat-id"`
+        WeChatWebhook   string   `mapstructure:"wechat-webhook"`
+        DingTalkWebhook string   `mapstructure:"dingtalk-webhook"`
+        FeishuWebhook   string   `mapstructure:"feishu-webhook"`
+        EmailTo         []string `mapstructure:"email-to"` // 邮件收件人，需同时配置 smtp
+        DrillReportTo   []string `mapstructure:"drill-report-to"` // 灾备演练报告收件人，为空时发给 email-to
+}
+
+// Smtp 邮件服务器，告警邮件和报表邮件共用
+type Smtp struct {
+        Host               string `mapstructure:"host"`
+        Port               int    `mapstructure:"port"`
+        Username           string `mapstructure:"username"`
+        Password           string `mapstructure:"password"`
+        From               string `mapstructure:"from"`                 // 发件地址，为空时使用 username
+        FromName           string `mapstructure:"from-name"`            // 发件人名称
+        Security           string `mapstructure:"security"`             // starttls, tls, none；为空时 465 端口用 tls，其他用 starttls
+        InsecureSkipVerify bool   `mapstructure:"insecure-skip-verify"` // 不校验服务器证书，仅用于自签名证书的内网服务器
+}
+
+// NotifyOutbox 通知发件箱，所有通知先写入数据库再由 Leader 异步发送
+type NotifyOutbox struct {
+        Workers         int            `mapstructure:"workers"`          // 并发发送数
+        MaxAttempts     int            `mapstructure:"max-attempts"`     // 最多尝试次数，超过后进入死信
+        DigestThreshold int            `mapstructure:"digest-threshold"` // 同一目标积压达到此条数时合并为摘要
+        DigestMax       int            `mapstructure:"digest-max"`       // 每条摘要最多合并的条数
+        RetentionDays   int            `mapstructure:"retention-days"`   // 已发送消息保留天数
+        RateLimits      map[string]int `mapstructure:"rate-limits"`      // 通道 → 每个目标每分钟条数，0 为不限流
+}
+
+// ChatOps 在 Telegram、钉钉、飞书中处理告警和审批
+type ChatOps struct {
+        Secret                  string `mapstructure:"secret"`                    // 消息按钮的签名密钥，为空时不启用
+        ActionTTL               int    `mapstructure:"action-ttl"`                // 按钮有效期(小时)
+        SilenceMinutes          int    `mapstructure:"silence-minutes"`           // 按钮创建的静默时长(分钟)
+        TelegramSecretToken     string `mapstructure:"telegram-secret-token"`     // Telegram setWebhook 时设置的 secret_token
+        DingTalkAppSecret       string `mapstructure:"dingtalk-app-secret"`       // 钉钉机器人所属应用的 AppSecret，校验回调签名
+        FeishuVerificationToken string `mapstructure:"feishu-verification-token"` // 飞书应用事件订阅的 Verification Token
+}
+
+// Synthetic 拨测，由 Leader 按各检查的间隔调度
+type Synthetic struct {
+        Workers       int `mapstructure:"workers"`        // 同时执行的检查数
+        RetentionDays int `mapstructure:"retention-days"` // 拨测结果保留天数
+}
+
+// Events 变更事件流，部署、告警、自愈、配置变更和命令执行统一记录
+type Events struct {
+        RetentionDays int `mapstructure:"retention-days"` // 事件保留天数
+        ChangeWindow  int `mapstructure:"change-window"`  // 查询告警前变更的默认时间窗口(分钟)，AI 分析同样使用
+}
+
+// Incidents 故障管理
+type Incidents struct {
+        AutoOpenLevel string `mapstructure:"auto-open-level"` // 告警事件达到该级别时自动创建故障，默认 critical，none 为不自动创建
+}
+
+// Grpc Agent gRPC 接入配置
+type Grpc struct {
+        Auth            string  `mapstructure:"auth"`              // 认证方式: hmac, mtls, none
+        EnrollToken     string  `mapstructure:"enroll-token"`      // 新 Agent 注册令牌，为空时拒绝注册
+        AllowOpenEnroll bool    `mapstructure:"allow-open-enroll"` // 未配置注册令牌时仍允许任意 Agent 注册，仅用于测试环境
+        TLSCert         string  `mapstructure:"tls-cert"`          // 服务端证书
+        TLSKey          string  `mapstructure:"tls-key"`           // 服务端私钥
+        ClientCA        string  `mapstructure:"client-ca"`         // mtls 模式下校验 Agent 证书的 CA
+        MaxClockSkew    int     `mapstructure:"max-clock-skew"`    // 签名时间戳允许偏差(秒)
+        RateLimit       float64 `mapstructure:"rate-limit"`        // 每个 Agent 每秒请求数
+        RateBurst       int     `mapstructure:"rate-burst"`        // 突发请求数
+        MaxInFlight     int     `mapstructure:"max-in-flight"`     // 每个 Agent 并发请求上限
+        MaxMessageSize  int     `mapstructure:"max-message-size"`  // 单条消息最大字节数
+}
+
 func Init() {
         v := viper.New()
         v.SetConfigFile("config/config.yaml")
@@ -101,6 +259,30 @@ func Init() {
                                 AuditEnabled:       true,
                                 AuditRetentionDays: 90,
                         },
+                        Metrics: Metrics{
+                                Store:                 "sql",
+                                DataDir:               "data/tsdb",
+                                QueueSize:             100000,
+                                BatchSize:             1000,
+                                FlushInterval:         5,
+                                RawRetentionHours:     48,
+                                Rollup1mRetentionDays: 7,
+                                Rollup5mRetentionDays: 30,
+                                DefaultRetentionDays:  30,
+                        },
+                        Grpc: Grpc{
+                                Auth:           "hmac",
+                                MaxClockSkew:   300,
+                                RateLimit:      10,
+                                RateBurst:      20,
+                                MaxInFlight:    8,
+                                MaxMessageSize: 4 << 20,
+                        },
+                        Alerting: Alerting{
+                                EvalInterval:   30,
+                                GroupBy:        []string{"rule", "server"},
+                                RepeatInterval: 240,
+                        },
                 }
                 return
         }
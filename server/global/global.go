@@ -126,6 +126,7 @@ func autoMigrate() {
                 &ha.HASession{},
                 &ha.ClusterEvent{},
                 &ha.NodeMetric{},
+                &ha.AgentLocation{},
         ); err != nil {
                 fmt.Println("HA表迁移警告: " + err.Error())
         }
@@ -0,0 +1,274 @@
+package grpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	agentModel "yunwei/model/agent"
+	agentService "yunwei/service/agent"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// 认证方式
+const (
+	AuthModeHMAC = "hmac"
+	AuthModeMTLS = "mtls"
+	AuthModeNone = "none"
+)
+
+// Agent 请求元数据
+// 签名 = hex(HMAC-SHA256(AgentSecret, agentID + "\n" + timestamp + "\n" + fullMethod))
+const (
+	MetadataAgentID     = "x-agent-id"
+	MetadataTimestamp   = "x-agent-timestamp"
+	MetadataSignature   = "x-agent-signature"
+	MetadataEnrollToken = "x-enroll-token"
+)
+
+// SignRequest 计算请求签名，Agent 端使用同样的算法
+func SignRequest(secret, agentID string, timestamp int64, fullMethod string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(agentID + "\n" + strconv.FormatInt(timestamp, 10) + "\n" + fullMethod))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AgentIdentity 已认证的 Agent 身份
+type AgentIdentity struct {
+	AgentID  string // Agent 唯一标识
+	ID       uint   // agents 表主键，新注册时为 0
+	ServerID uint
+	Method   string // 认证方式: hmac, mtls, enroll, none
+}
+
+type identityKey struct{}
+
+// withIdentity 将身份写入上下文
+func withIdentity(ctx context.Context, id *AgentIdentity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext 获取当前请求的 Agent 身份
+func IdentityFromContext(ctx context.Context) (*AgentIdentity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*AgentIdentity)
+	return id, ok
+}
+
+// cachedAgent Agent 认证信息缓存
+type cachedAgent struct {
+	found    bool
+	id       uint
+	serverID uint
+	secret   string
+	status   agentModel.AgentStatus
+	loadedAt time.Time
+}
+
+// AgentAuthenticator Agent 认证器
+type AgentAuthenticator struct {
+	mode         string
+	enrollToken  string
+	openEnroll   bool // 未配置注册令牌时是否允许注册
+	maxClockSkew time.Duration
+	manager      *agentService.AgentManager
+
+	mu    sync.RWMutex
+	cache map[string]*cachedAgent
+	ttl   time.Duration
+}
+
+// NewAgentAuthenticator 创建认证器
+func NewAgentAuthenticator(mode, enrollToken string, openEnroll bool, maxClockSkew time.Duration, manager *agentService.AgentManager) *AgentAuthenticator {
+	if mode == "" {
+		mode = AuthModeHMAC
+	}
+	if maxClockSkew <= 0 {
+		maxClockSkew = 5 * time.Minute
+	}
+	return &AgentAuthenticator{
+		mode:         mode,
+		enrollToken:  enrollToken,
+		openEnroll:   openEnroll,
+		maxClockSkew: maxClockSkew,
+		manager:      manager,
+		cache:        make(map[string]*cachedAgent),
+		ttl:          30 * time.Second,
+	}
+}
+
+// Invalidate 清除 Agent 缓存，注册、禁用或密钥变更后调用
+func (a *AgentAuthenticator) Invalidate(agentID string) {
+	a.mu.Lock()
+	delete(a.cache, agentID)
+	a.mu.Unlock()
+}
+
+// lookup 读取 Agent 认证信息，带短期缓存避免每个请求都查库
+func (a *AgentAuthenticator) lookup(agentID string) *cachedAgent {
+	a.mu.RLock()
+	c, ok := a.cache[agentID]
+	a.mu.RUnlock()
+	if ok && time.Since(c.loadedAt) < a.ttl {
+		return c
+	}
+
+	c = &cachedAgent{loadedAt: time.Now()}
+	if ag, err := a.manager.GetAgentByUUID(agentID); err == nil {
+		c.found = true
+		c.id = ag.ID
+		c.serverID = ag.ServerID
+		c.secret = ag.AgentSecret
+		c.status = ag.Status
+	}
+
+	a.mu.Lock()
+	a.cache[agentID] = c
+	a.mu.Unlock()
+	return c
+}
+
+// Authenticate 校验请求身份
+// claimedID 为请求体中的 AgentId，enrolling 表示这是注册请求
+func (a *AgentAuthenticator) Authenticate(ctx context.Context, fullMethod, claimedID string, enrolling bool) (*AgentIdentity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	agentID := claimedID
+	if v := firstMetadata(md, MetadataAgentID); v != "" {
+		if claimedID != "" && v != claimedID {
+			return nil, status.Error(codes.PermissionDenied, "请求中的 AgentId 与认证身份不一致")
+		}
+		agentID = v
+	}
+
+	// mTLS 模式下以客户端证书 CN 作为 Agent 身份
+	if a.mode == AuthModeMTLS {
+		cn, err := peerCommonName(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if agentID != "" && agentID != cn {
+			return nil, status.Error(codes.PermissionDenied, "客户端证书与 AgentId 不一致")
+		}
+		agentID = cn
+	}
+
+	if agentID == "" {
+		return nil, status.Error(codes.Unauthenticated, "缺少 Agent 标识")
+	}
+
+	c := a.lookup(agentID)
+	if !c.found {
+		if !enrolling {
+			return nil, status.Error(codes.Unauthenticated, "Agent 未注册")
+		}
+		return a.authenticateEnroll(md, agentID)
+	}
+
+	if c.status == agentModel.AgentStatusDisabled {
+		return nil, status.Error(codes.PermissionDenied, "Agent 已被禁用")
+	}
+
+	identity := &AgentIdentity{AgentID: agentID, ID: c.id, ServerID: c.serverID, Method: a.mode}
+	switch a.mode {
+	case AuthModeNone, AuthModeMTLS:
+		return identity, nil
+	}
+
+	if err := a.verifySignature(md, agentID, c.secret, fullMethod); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// authenticateEnroll 新 Agent 注册：mTLS 已由证书证明身份，其余模式校验注册令牌
+// 未配置令牌时拒绝注册，除非显式开启 allow-open-enroll
+func (a *AgentAuthenticator) authenticateEnroll(md metadata.MD, agentID string) (*AgentIdentity, error) {
+	identity := &AgentIdentity{AgentID: agentID, Method: "enroll"}
+	if a.mode == AuthModeMTLS {
+		return identity, nil
+	}
+	if a.enrollToken == "" {
+		if a.openEnroll {
+			return identity, nil
+		}
+		return nil, status.Error(codes.PermissionDenied, "服务端未配置注册令牌，拒绝注册")
+	}
+	token := firstMetadata(md, MetadataEnrollToken)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.enrollToken)) != 1 {
+		return nil, status.Error(codes.Unauthenticated, "注册令牌无效")
+	}
+	return identity, nil
+}
+
+// verifySignature 校验 HMAC 签名和时间戳
+func (a *AgentAuthenticator) verifySignature(md metadata.MD, agentID, secret, fullMethod string) error {
+	if secret == "" {
+		return status.Error(codes.Unauthenticated, "Agent 未分配密钥，请重新注册")
+	}
+
+	tsStr := firstMetadata(md, MetadataTimestamp)
+	sig := firstMetadata(md, MetadataSignature)
+	if tsStr == "" || sig == "" {
+		return status.Error(codes.Unauthenticated, "缺少签名")
+	}
+
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "时间戳无效")
+	}
+	skew := time.Since(time.Unix(ts, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > a.maxClockSkew {
+		return status.Error(codes.Unauthenticated, "签名已过期，请检查 Agent 时钟")
+	}
+
+	expected := SignRequest(secret, agentID, ts, fullMethod)
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return status.Error(codes.Unauthenticated, "签名校验失败")
+	}
+	return nil
+}
+
+// peerCommonName 读取已校验客户端证书的 CN
+func peerCommonName(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return "", status.Error(codes.Unauthenticated, "未建立 TLS 连接")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", status.Error(codes.Unauthenticated, "缺少有效的客户端证书")
+	}
+	cn := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	if cn == "" {
+		return "", status.Error(codes.Unauthenticated, "客户端证书缺少 CN")
+	}
+	return cn, nil
+}
+
+// peerAddr 请求来源地址
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
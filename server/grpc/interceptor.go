@@ -0,0 +1,185 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"yunwei/global"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 拒绝原因，用作指标标签
+const (
+	rejectAuth      = "auth"
+	rejectRateLimit = "rate_limit"
+	rejectInFlight  = "in_flight"
+	rejectInvalid   = "invalid"
+)
+
+// enrollMethod 新 Agent 注册不要求已有密钥
+const enrollMethod = "RegisterAgent"
+
+// interceptors Agent gRPC 拦截器
+// 顺序: panic 恢复与指标 -> 认证 -> 限流 -> 字段校验 -> 业务处理
+type interceptors struct {
+	auth *AgentAuthenticator
+	// limiter 按 Agent 限流；enrollLimiter 按来源 IP 限制注册请求
+	limiter       *AgentLimiter
+	enrollLimiter *AgentLimiter
+}
+
+// methodName 从 /AgentService/Heartbeat 中取出 Heartbeat
+func methodName(fullMethod string) string {
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[i+1:]
+	}
+	return fullMethod
+}
+
+// reject 记录拒绝原因并返回错误
+func reject(method, reason string, err error) error {
+	grpcRejectedTotal.WithLabelValues(method, reason).Inc()
+	return err
+}
+
+// recoverPanic 将 panic 转换为 Internal 错误，避免单个请求拖垮服务
+func recoverPanic(method string, err *error) {
+	if r := recover(); r != nil {
+		grpcPanicsTotal.WithLabelValues(method).Inc()
+		global.Logger.Error("Agent gRPC 处理异常",
+			zap.String("method", method),
+			zap.Any("panic", r),
+			zap.ByteString("stack", debug.Stack()))
+		*err = status.Error(codes.Internal, "服务内部错误")
+	}
+}
+
+// limitKey 限流键，已注册 Agent 按 AgentID，注册请求按来源 IP
+func (i *interceptors) limitKey(ctx context.Context, identity *AgentIdentity) (*AgentLimiter, string) {
+	if identity.ID != 0 {
+		return i.limiter, identity.AgentID
+	}
+	host := peerAddr(ctx)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return i.enrollLimiter, host
+}
+
+// Unary 一元请求拦截器
+func (i *interceptors) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	method := methodName(info.FullMethod)
+	start := time.Now()
+	defer func() {
+		grpcRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		grpcRequestsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+	}()
+	defer recoverPanic(method, &err)
+
+	identity, err := i.auth.Authenticate(ctx, info.FullMethod, agentIDOf(req), method == enrollMethod)
+	if err != nil {
+		global.Logger.Warn("Agent gRPC 认证失败",
+			zap.String("method", method),
+			zap.String("agentId", agentIDOf(req)),
+			zap.String("peer", peerAddr(ctx)),
+			zap.Error(err))
+		return nil, reject(method, rejectAuth, err)
+	}
+
+	limiter, key := i.limitKey(ctx, identity)
+	if !limiter.Allow(key) {
+		return nil, reject(method, rejectRateLimit, status.Error(codes.ResourceExhausted, "请求过于频繁，请稍后重试"))
+	}
+	release, ok := limiter.Acquire(key)
+	if !ok {
+		return nil, reject(method, rejectInFlight, status.Error(codes.ResourceExhausted, "并发请求过多，请稍后重试"))
+	}
+	defer release()
+
+	if err := validateRequest(req, identity); err != nil {
+		return nil, reject(method, rejectInvalid, err)
+	}
+
+	return handler(withIdentity(ctx, identity), req)
+}
+
+// Stream 流式请求拦截器
+// 建立流时完成认证，每条消息都做字段校验并按 Agent 限流；
+// 超出速率时阻塞读取而不是断开，Agent 端会因 HTTP/2 流控自然放慢发送
+func (i *interceptors) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	method := methodName(info.FullMethod)
+	start := time.Now()
+	defer func() {
+		grpcRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		grpcRequestsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+	}()
+	defer recoverPanic(method, &err)
+
+	ctx := ss.Context()
+	identity, err := i.auth.Authenticate(ctx, info.FullMethod, "", false)
+	if err != nil {
+		global.Logger.Warn("Agent gRPC 认证失败",
+			zap.String("method", method),
+			zap.String("peer", peerAddr(ctx)),
+			zap.Error(err))
+		return reject(method, rejectAuth, err)
+	}
+
+	// 长连接同样占用并发名额，防止单个 Agent 无限开流
+	release, ok := i.limiter.Acquire(identity.AgentID)
+	if !ok {
+		return reject(method, rejectInFlight, status.Error(codes.ResourceExhausted, "并发连接过多"))
+	}
+	defer release()
+
+	grpcActiveStreams.WithLabelValues(method).Inc()
+	defer grpcActiveStreams.WithLabelValues(method).Dec()
+
+	return handler(srv, &guardedStream{
+		ServerStream: ss,
+		ctx:          withIdentity(ctx, identity),
+		identity:     identity,
+		limiter:      i.limiter,
+		method:       method,
+	})
+}
+
+// guardedStream 对每条入站消息做校验和限流
+type guardedStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	identity *AgentIdentity
+	limiter  *AgentLimiter
+	method   string
+}
+
+func (s *guardedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *guardedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	grpcStreamMessagesTotal.WithLabelValues(s.method).Inc()
+
+	if err := validateRequest(m, s.identity); err != nil {
+		return reject(s.method, rejectInvalid, err)
+	}
+
+	waitStart := time.Now()
+	if err := s.limiter.Wait(s.ctx, s.identity.AgentID); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	if waited := time.Since(waitStart); waited > time.Millisecond {
+		grpcStreamThrottledSeconds.WithLabelValues(s.method).Add(waited.Seconds())
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package grpc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gRPC 服务端 Prometheus 指标
+var (
+	grpcRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "yunwei",
+		Subsystem: "agent_grpc",
+		Name:      "requests_total",
+		Help:      "Agent gRPC 请求总数",
+	}, []string{"method", "code"})
+
+	grpcRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "yunwei",
+		Subsystem: "agent_grpc",
+		Name:      "request_duration_seconds",
+		Help:      "Agent gRPC 请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	grpcRejectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "yunwei",
+		Subsystem: "agent_grpc",
+		Name:      "rejected_total",
+		Help:      "被拦截的 Agent gRPC 请求数",
+	}, []string{"method", "reason"})
+
+	grpcStreamMessagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "yunwei",
+		Subsystem: "agent_grpc",
+		Name:      "stream_messages_total",
+		Help:      "Agent gRPC 流式消息接收数",
+	}, []string{"method"})
+
+	grpcStreamThrottledSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "yunwei",
+		Subsystem: "agent_grpc",
+		Name:      "stream_throttled_seconds_total",
+		Help:      "流式消息因限流等待的累计时长",
+	}, []string{"method"})
+
+	grpcActiveStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "yunwei",
+		Subsystem: "agent_grpc",
+		Name:      "active_streams",
+		Help:      "当前活跃的 Agent gRPC 流",
+	}, []string{"method"})
+
+	grpcPanicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "yunwei",
+		Subsystem: "agent_grpc",
+		Name:      "panics_total",
+		Help:      "Agent gRPC 处理过程中恢复的 panic 数",
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		grpcRequestsTotal,
+		grpcRequestDuration,
+		grpcRejectedTotal,
+		grpcStreamMessagesTotal,
+		grpcStreamThrottledSeconds,
+		grpcActiveStreams,
+		grpcPanicsTotal,
+	)
+}
@@ -0,0 +1,166 @@
+package grpc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64 // 每秒补充令牌数
+	burst    float64
+	tokens   float64
+	last     time.Time
+	inFlight int
+	lastUsed time.Time
+}
+
+// reserve 取一个令牌，返回需要等待的时间，0 表示立即可用
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.lastUsed = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel 归还未使用的令牌
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens++
+	b.mu.Unlock()
+}
+
+// AgentLimiter 按 Agent 限流
+// 一元请求超限直接拒绝；流式消息超限则阻塞读取，通过 HTTP/2 流控向 Agent 施加背压
+type AgentLimiter struct {
+	rate        float64
+	burst       int
+	maxInFlight int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewAgentLimiter 创建限流器，rate<=0 时不限流
+func NewAgentLimiter(rate float64, burst, maxInFlight int) *AgentLimiter {
+	if burst <= 0 {
+		burst = int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	return &AgentLimiter{
+		rate:        rate,
+		burst:       burst,
+		maxInFlight: maxInFlight,
+		buckets:     make(map[string]*tokenBucket),
+	}
+}
+
+func (l *AgentLimiter) bucket(key string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		now := time.Now()
+		b = &tokenBucket{rate: l.rate, burst: float64(l.burst), tokens: float64(l.burst), last: now, lastUsed: now}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// Allow 非阻塞取令牌
+func (l *AgentLimiter) Allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	b := l.bucket(key)
+	if b.reserve(time.Now()) > 0 {
+		b.cancel()
+		return false
+	}
+	return true
+}
+
+// Wait 阻塞直到取得令牌或上下文取消
+func (l *AgentLimiter) Wait(ctx context.Context, key string) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	b := l.bucket(key)
+	delay := b.reserve(time.Now())
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// Acquire 占用一个并发名额，返回释放函数；超过上限返回 false
+func (l *AgentLimiter) Acquire(key string) (func(), bool) {
+	if l.maxInFlight <= 0 {
+		return func() {}, true
+	}
+	b := l.bucket(key)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight >= l.maxInFlight {
+		return nil, false
+	}
+	b.inFlight++
+	return func() {
+		b.mu.Lock()
+		b.inFlight--
+		b.mu.Unlock()
+	}, true
+}
+
+// cleanup 清理长时间未使用的限流桶
+func (l *AgentLimiter) cleanup(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for key, b := range l.buckets {
+		b.mu.Lock()
+		stale := b.inFlight == 0 && now.Sub(b.lastUsed) > idle
+		b.mu.Unlock()
+		if stale {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// StartCleanup 定期清理空闲限流桶
+func (l *AgentLimiter) StartCleanup(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				l.cleanup(10 * time.Minute)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
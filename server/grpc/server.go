@@ -2,17 +2,27 @@ package grpc
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"time"
 
+	"yunwei/config"
 	"yunwei/global"
 	agentModel "yunwei/model/agent"
 	"yunwei/model/server"
 	agentService "yunwei/service/agent"
+	haService "yunwei/service/ha"
+	"yunwei/service/metrics"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
 // AgentGRPCServer Agent gRPC服务
@@ -22,16 +32,30 @@ type AgentGRPCServer struct {
 	agentManager   *agentService.AgentManager
 	heartbeatMon   *agentService.HeartbeatMonitor
 	versionManager *agentService.VersionManager
+	auth           *AgentAuthenticator
+	sessions       *sessionRegistry
+	grpcServer     *grpc.Server
+	stopCh         chan struct{}
 }
 
 // NewAgentGRPCServer 创建gRPC服务
 func NewAgentGRPCServer(port string) *AgentGRPCServer {
 	am := agentService.NewAgentManager()
+	cfg := config.CONFIG.Grpc
+
+	// 命令流会话登记到集群路由，其他节点收到的命令请求会转发过来
+	router := haService.GetHAManager().GetAgentRouter()
+	sessions := newSessionRegistry(router)
+	router.SetDispatcher(sessions)
+
 	return &AgentGRPCServer{
 		port:           port,
 		agentManager:   am,
 		heartbeatMon:   am.GetHeartbeatMonitor(),
 		versionManager: am.GetVersionManager(),
+		auth:           NewAgentAuthenticator(cfg.Auth, cfg.EnrollToken, cfg.AllowOpenEnroll, time.Duration(cfg.MaxClockSkew)*time.Second, am),
+		sessions:       sessions,
+		stopCh:         make(chan struct{}),
 	}
 }
 
@@ -42,21 +66,94 @@ func (s *AgentGRPCServer) Start() error {
 		return fmt.Errorf("gRPC监听失败: %w", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	RegisterAgentServiceServer(grpcServer, s)
+	opts, err := s.serverOptions()
+	if err != nil {
+		lis.Close()
+		return err
+	}
+	s.grpcServer = grpc.NewServer(opts...)
+	RegisterAgentServiceServer(s.grpcServer, s)
 
 	// 启动心跳监控
 	s.agentManager.Start()
 
 	go func() {
-		grpcServer.Serve(lis)
+		s.grpcServer.Serve(lis)
 	}()
 
 	return nil
 }
 
+// serverOptions 按配置组装 TLS、消息大小和拦截器
+func (s *AgentGRPCServer) serverOptions() ([]grpc.ServerOption, error) {
+	cfg := config.CONFIG.Grpc
+
+	maxMsg := cfg.MaxMessageSize
+	if maxMsg <= 0 {
+		maxMsg = 4 << 20
+	}
+
+	limiter := NewAgentLimiter(cfg.RateLimit, cfg.RateBurst, cfg.MaxInFlight)
+	limiter.StartCleanup(s.stopCh)
+	// 注册请求按来源 IP 限流，每分钟最多 10 次
+	enrollLimiter := NewAgentLimiter(10.0/60, 10, 2)
+	enrollLimiter.StartCleanup(s.stopCh)
+
+	ic := &interceptors{auth: s.auth, limiter: limiter, enrollLimiter: enrollLimiter}
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(maxMsg),
+		grpc.ChainUnaryInterceptor(ic.Unary),
+		grpc.ChainStreamInterceptor(ic.Stream),
+	}
+
+	if cfg.TLSCert != "" || cfg.Auth == AuthModeMTLS {
+		creds, err := loadServerTLS(cfg.TLSCert, cfg.TLSKey, cfg.ClientCA, cfg.Auth == AuthModeMTLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	return opts, nil
+}
+
+// loadServerTLS 加载服务端证书，requireClientCert 时要求并校验 Agent 证书
+func loadServerTLS(certFile, keyFile, caFile string, requireClientCert bool) (credentials.TransportCredentials, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("启用 TLS 需要配置 tls-cert 和 tls-key")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载 gRPC 证书失败: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if requireClientCert {
+		if caFile == "" {
+			return nil, fmt.Errorf("mtls 模式需要配置 client-ca")
+		}
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 client-ca 失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("client-ca 中没有有效证书")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
 // Stop 停止服务
 func (s *AgentGRPCServer) Stop() {
+	close(s.stopCh)
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+	}
 	s.agentManager.Stop()
 }
 
@@ -108,7 +205,12 @@ func (s *AgentGRPCServer) ReportMetrics(ctx context.Context, req *MetricsRequest
 	}
 
 	metric.ServerID = srv.ID
-	global.DB.Create(&metric)
+	if metric.CreatedAt.IsZero() {
+		metric.CreatedAt = time.Now()
+	}
+	if err := metrics.IngestServerMetric(&metric); err != nil {
+		return &MetricsResponse{Success: false, Message: err.Error()}, nil
+	}
 
 	// 更新服务器状态
 	srv.CPUUsage = metric.CPUUsage
@@ -159,13 +261,17 @@ func (s *AgentGRPCServer) RegisterAgent(ctx context.Context, req *RegisterReques
 	if err != nil {
 		return &RegisterResponse{Success: false, Message: err.Error()}, nil
 	}
+	// 密钥可能已重新生成，清除认证缓存
+	s.auth.Invalidate(req.AgentId)
 
-	// 同时更新/创建 Server 记录
-	var srv server.Server
-	result := global.DB.Where("host = ?", req.Ip).First(&srv)
+	// 同时更新/创建 Server 记录，已绑定其他 Agent 的服务器不改绑
+	srv, err := s.agentManager.FindServer(req.AgentId, req.Ip)
+	if errors.Is(err, agentService.ErrServerBound) {
+		return &RegisterResponse{Success: false, Message: err.Error()}, nil
+	}
 
-	if result.Error != nil {
-		srv = server.Server{
+	if err != nil {
+		srv = &server.Server{
 			Name:     req.Hostname,
 			Hostname: req.Hostname,
 			Host:     req.Ip,
@@ -174,16 +280,21 @@ func (s *AgentGRPCServer) RegisterAgent(ctx context.Context, req *RegisterReques
 			Kernel:   req.Kernel,
 			CPUCores: int(req.CpuCores),
 			AgentID:  req.AgentId,
+			TenantID: req.TenantId,
 			Status:   "online",
 		}
-		global.DB.Create(&srv)
+		global.DB.Create(srv)
 	} else {
 		srv.AgentID = req.AgentId
 		srv.Hostname = req.Hostname
 		now := time.Now()
 		srv.LastHeartbeat = &now
 		srv.AgentOnline = true
-		global.DB.Save(&srv)
+		global.DB.Save(srv)
+	}
+	if ag.ServerID != srv.ID {
+		global.DB.Model(ag).Updates(map[string]interface{}{"server_id": srv.ID, "server_name": srv.Name})
+		s.auth.Invalidate(req.AgentId)
 	}
 
 	return &RegisterResponse{
@@ -325,7 +436,16 @@ func (s *AgentGRPCServer) StreamHeartbeat(stream AgentService_StreamHeartbeatSer
 }
 
 // CommandStream 命令流
+// 服务端通过响应下发命令，Agent 通过请求回报执行状态
 func (s *AgentGRPCServer) CommandStream(stream AgentService_CommandStreamServer) error {
+	identity, ok := IdentityFromContext(stream.Context())
+	if !ok {
+		return status.Error(codes.Unauthenticated, "未认证的命令流")
+	}
+
+	sess := s.sessions.open(identity.AgentID, stream)
+	defer s.sessions.close(sess)
+
 	for {
 		req, err := stream.Recv()
 		if err != nil {
@@ -333,11 +453,15 @@ func (s *AgentGRPCServer) CommandStream(stream AgentService_CommandStreamServer)
 		}
 
 		// 处理命令执行结果
-		// TODO: 实现命令结果处理
+		if req.CommandId == "" {
+			continue
+		}
+		sess.handle(req)
 
-		stream.Send(&CommandStreamResponse{
-			Success: true,
-			Message: "received",
+		sess.send(&CommandStreamResponse{
+			Success:   true,
+			Message:   "received",
+			CommandId: req.CommandId,
 		})
 	}
 }
@@ -421,7 +545,17 @@ func _AgentService_Heartbeat_Handler(srv interface{}, ctx context.Context, dec f
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return srv.(AgentServiceServer).Heartbeat(ctx, in)
+	if interceptor == nil {
+		return srv.(AgentServiceServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AgentService/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 func _AgentService_ReportMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -429,7 +563,17 @@ func _AgentService_ReportMetrics_Handler(srv interface{}, ctx context.Context, d
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return srv.(AgentServiceServer).ReportMetrics(ctx, in)
+	if interceptor == nil {
+		return srv.(AgentServiceServer).ReportMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AgentService/ReportMetrics",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).ReportMetrics(ctx, req.(*MetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 func _AgentService_RegisterAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -437,7 +581,17 @@ func _AgentService_RegisterAgent_Handler(srv interface{}, ctx context.Context, d
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return srv.(AgentServiceServer).RegisterAgent(ctx, in)
+	if interceptor == nil {
+		return srv.(AgentServiceServer).RegisterAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AgentService/RegisterAgent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).RegisterAgent(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 func _AgentService_ExecuteCommand_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -445,7 +599,17 @@ func _AgentService_ExecuteCommand_Handler(srv interface{}, ctx context.Context,
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return srv.(AgentServiceServer).ExecuteCommand(ctx, in)
+	if interceptor == nil {
+		return srv.(AgentServiceServer).ExecuteCommand(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AgentService/ExecuteCommand",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).ExecuteCommand(ctx, req.(*CommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 func _AgentService_CheckUpgrade_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -453,7 +617,17 @@ func _AgentService_CheckUpgrade_Handler(srv interface{}, ctx context.Context, de
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return srv.(AgentServiceServer).CheckUpgrade(ctx, in)
+	if interceptor == nil {
+		return srv.(AgentServiceServer).CheckUpgrade(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AgentService/CheckUpgrade",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).CheckUpgrade(ctx, req.(*CheckUpgradeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 func _AgentService_ReportUpgradeProgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -461,7 +635,17 @@ func _AgentService_ReportUpgradeProgress_Handler(srv interface{}, ctx context.Co
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return srv.(AgentServiceServer).ReportUpgradeProgress(ctx, in)
+	if interceptor == nil {
+		return srv.(AgentServiceServer).ReportUpgradeProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AgentService/ReportUpgradeProgress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).ReportUpgradeProgress(ctx, req.(*UpgradeProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 func _AgentService_GetAgentConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
@@ -469,7 +653,17 @@ func _AgentService_GetAgentConfig_Handler(srv interface{}, ctx context.Context,
 	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return srv.(AgentServiceServer).GetAgentConfig(ctx, in)
+	if interceptor == nil {
+		return srv.(AgentServiceServer).GetAgentConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/AgentService/GetAgentConfig",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AgentServiceServer).GetAgentConfig(ctx, req.(*AgentConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 func _AgentService_StreamHeartbeat_Handler(srv interface{}, stream grpc.ServerStream) error {
@@ -597,6 +791,7 @@ type RegisterRequest struct {
 	Kernel   string `json:"kernel"`
 	CpuCores uint32 `json:"cpuCores"`
 	Version  string `json:"version"`
+	TenantId string `json:"tenantId"` // 新建服务器记录时的所属租户，已有服务器的租户在控制台维护
 }
 
 // RegisterResponse 注册响应
@@ -634,10 +829,14 @@ type CommandStreamRequest struct {
 }
 
 // CommandStreamResponse 命令流响应
+// Message 为 execute 时表示下发命令，Type 为 probe 时 Command 是拨测参数
 type CommandStreamResponse struct {
 	Success   bool   `json:"success"`
 	Message   string `json:"message"`
 	CommandId string `json:"commandId"`
+	Type      string `json:"type,omitempty"`
+	Command   string `json:"command,omitempty"`
+	Timeout   int32  `json:"timeout,omitempty"`
 }
 
 // CheckUpgradeRequest 检查升级请求
@@ -0,0 +1,185 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/global"
+	haService "yunwei/service/ha"
+)
+
+// 命令流中 Agent 上报的中间状态，其余状态视为执行结束
+const (
+	commandStatusAccepted = "accepted"
+	commandStatusRunning  = "running"
+)
+
+// commandOutcome 命令最终结果
+type commandOutcome struct {
+	result *haService.AgentCommandResult
+	err    error
+}
+
+// pendingCommand 等待 Agent 回报的命令
+type pendingCommand struct {
+	startedAt time.Time
+	output    strings.Builder
+	done      chan commandOutcome
+}
+
+// agentSession Agent 命令流会话
+type agentSession struct {
+	id      string
+	agentID string
+	stream  AgentService_CommandStreamServer
+
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]*pendingCommand
+	closed  bool
+}
+
+// send 串行发送，gRPC 流不支持并发 Send
+func (s *agentSession) send(m *CommandStreamResponse) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	return s.stream.Send(m)
+}
+
+// handle 处理 Agent 回报的命令状态
+func (s *agentSession) handle(req *CommandStreamRequest) {
+	s.mu.Lock()
+	p, ok := s.pending[req.CommandId]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	p.output.WriteString(req.Output)
+	if req.Status == commandStatusAccepted || req.Status == commandStatusRunning {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.pending, req.CommandId)
+	output := p.output.String()
+	s.mu.Unlock()
+
+	p.done <- commandOutcome{result: &haService.AgentCommandResult{
+		CommandID: req.CommandId,
+		AgentID:   s.agentID,
+		Status:    req.Status,
+		Output:    output,
+		ExitCode:  int(req.ExitCode),
+		Duration:  time.Since(p.startedAt).Milliseconds(),
+	}}
+}
+
+// close 关闭会话，未完成的命令立即失败
+func (s *agentSession) close() {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	for _, p := range pending {
+		p.done <- commandOutcome{err: haService.ErrAgentDisconnected}
+	}
+}
+
+// sessionRegistry 本节点上的 Agent 命令流会话
+type sessionRegistry struct {
+	mu       sync.RWMutex
+	sessions map[string]*agentSession
+	router   *haService.AgentRouter
+	seq      uint64
+}
+
+func newSessionRegistry(router *haService.AgentRouter) *sessionRegistry {
+	return &sessionRegistry{
+		sessions: make(map[string]*agentSession),
+		router:   router,
+	}
+}
+
+// open 登记会话，同一 Agent 重连时替换旧会话
+func (r *sessionRegistry) open(agentID string, stream AgentService_CommandStreamServer) *agentSession {
+	r.mu.Lock()
+	r.seq++
+	sess := &agentSession{
+		id:      fmt.Sprintf("%s-%d", r.router.NodeID(), r.seq),
+		agentID: agentID,
+		stream:  stream,
+		pending: make(map[string]*pendingCommand),
+	}
+	old := r.sessions[agentID]
+	r.sessions[agentID] = sess
+	r.mu.Unlock()
+
+	if old != nil {
+		old.close()
+	}
+	if err := r.router.RegisterSession(agentID, sess.id); err != nil {
+		global.Logger.Warn(fmt.Sprintf("登记 Agent %s 位置失败: %v", agentID, err))
+	}
+	return sess
+}
+
+// close 注销会话
+func (r *sessionRegistry) close(sess *agentSession) {
+	r.mu.Lock()
+	if r.sessions[sess.agentID] == sess {
+		delete(r.sessions, sess.agentID)
+	}
+	r.mu.Unlock()
+
+	sess.close()
+	r.router.UnregisterSession(sess.agentID, sess.id)
+}
+
+// DispatchCommand 通过命令流下发命令并等待结果
+func (r *sessionRegistry) DispatchCommand(ctx context.Context, cmd *haService.AgentCommand) (*haService.AgentCommandResult, error) {
+	r.mu.RLock()
+	sess := r.sessions[cmd.AgentID]
+	r.mu.RUnlock()
+	if sess == nil {
+		return nil, haService.ErrAgentNotConnected
+	}
+
+	p := &pendingCommand{startedAt: time.Now(), done: make(chan commandOutcome, 1)}
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return nil, haService.ErrAgentDisconnected
+	}
+	sess.pending[cmd.CommandID] = p
+	sess.mu.Unlock()
+
+	err := sess.send(&CommandStreamResponse{
+		Success:   true,
+		Message:   "execute",
+		CommandId: cmd.CommandID,
+		Type:      cmd.Type,
+		Command:   cmd.Command,
+		Timeout:   int32(cmd.Timeout),
+	})
+	if err != nil {
+		sess.mu.Lock()
+		delete(sess.pending, cmd.CommandID)
+		sess.mu.Unlock()
+		return nil, fmt.Errorf("下发命令失败: %w", err)
+	}
+
+	select {
+	case out := <-p.done:
+		return out.result, out.err
+	case <-ctx.Done():
+		sess.mu.Lock()
+		delete(sess.pending, cmd.CommandID)
+		sess.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,156 @@
+package grpc
+
+import (
+	"fmt"
+	"math"
+	"net"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 字段长度上限
+const (
+	maxAgentIDLen    = 128
+	maxShortFieldLen = 256
+	maxMetricsJSON   = 1 << 20
+	maxOutputLen     = 1 << 20
+	maxCommandLen    = 64 << 10
+)
+
+// agentIDOf 取请求中的 AgentId
+func agentIDOf(req interface{}) string {
+	switch r := req.(type) {
+	case *HeartbeatRequest:
+		return r.AgentId
+	case *HeartbeatStreamRequest:
+		return r.AgentId
+	case *MetricsRequest:
+		return r.AgentId
+	case *RegisterRequest:
+		return r.AgentId
+	case *CommandRequest:
+		return r.AgentId
+	case *CommandStreamRequest:
+		return r.AgentId
+	case *CheckUpgradeRequest:
+		return r.AgentId
+	case *UpgradeProgressRequest:
+		return r.AgentId
+	case *AgentConfigRequest:
+		return r.AgentId
+	}
+	return ""
+}
+
+// validateRequest 校验请求字段，identity 为已认证的 Agent
+func validateRequest(req interface{}, identity *AgentIdentity) error {
+	if id := agentIDOf(req); id != "" && identity != nil && id != identity.AgentID {
+		return status.Error(codes.PermissionDenied, "不能代替其他 Agent 发送请求")
+	}
+
+	var err error
+	switch r := req.(type) {
+	case *HeartbeatRequest:
+		err = firstError(
+			checkLen("agentId", r.AgentId, 1, maxAgentIDLen),
+			checkIP(r.Ip),
+			checkLen("version", r.Version, 0, maxShortFieldLen),
+			checkPercent("cpuUsage", r.CpuUsage),
+			checkPercent("memoryUsage", r.MemoryUsage),
+			checkRange("port", float64(r.Port), 0, 65535),
+		)
+	case *HeartbeatStreamRequest:
+		err = firstError(
+			checkLen("agentId", r.AgentId, 1, maxAgentIDLen),
+			checkIP(r.Ip),
+			checkLen("version", r.Version, 0, maxShortFieldLen),
+			checkPercent("cpuUsage", r.CpuUsage),
+			checkPercent("memoryUsage", r.MemoryUsage),
+		)
+	case *MetricsRequest:
+		err = firstError(
+			checkLen("agentId", r.AgentId, 1, maxAgentIDLen),
+			checkLen("metricsJson", r.MetricsJson, 2, maxMetricsJSON),
+		)
+	case *RegisterRequest:
+		err = firstError(
+			checkLen("agentId", r.AgentId, 1, maxAgentIDLen),
+			checkIP(r.Ip),
+			checkLen("hostname", r.Hostname, 1, maxShortFieldLen),
+			checkLen("os", r.Os, 0, maxShortFieldLen),
+			checkLen("arch", r.Arch, 0, maxShortFieldLen),
+			checkLen("kernel", r.Kernel, 0, maxShortFieldLen),
+			checkLen("version", r.Version, 0, maxShortFieldLen),
+		)
+	case *CommandRequest:
+		err = firstError(
+			checkLen("agentId", r.AgentId, 1, maxAgentIDLen),
+			checkLen("command", r.Command, 1, maxCommandLen),
+			checkRange("timeout", float64(r.Timeout), 0, 86400),
+		)
+	case *CommandStreamRequest:
+		err = firstError(
+			checkLen("agentId", r.AgentId, 1, maxAgentIDLen),
+			checkLen("commandId", r.CommandId, 0, maxShortFieldLen),
+			checkLen("status", r.Status, 0, maxShortFieldLen),
+			checkLen("output", r.Output, 0, maxOutputLen),
+		)
+	case *CheckUpgradeRequest:
+		err = checkLen("agentId", r.AgentId, 1, maxAgentIDLen)
+	case *UpgradeProgressRequest:
+		err = firstError(
+			checkLen("agentId", r.AgentId, 1, maxAgentIDLen),
+			checkRange("taskId", float64(r.TaskId), 1, math.MaxUint32),
+			checkRange("progress", float64(r.Progress), 0, 100),
+			checkLen("message", r.Message, 0, maxOutputLen),
+			checkLen("output", r.Output, 0, maxOutputLen),
+		)
+	case *AgentConfigRequest:
+		err = checkLen("agentId", r.AgentId, 1, maxAgentIDLen)
+	}
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkLen(field, v string, min, max int) error {
+	if len(v) < min {
+		if min == 1 {
+			return fmt.Errorf("%s 不能为空", field)
+		}
+		return fmt.Errorf("%s 长度不能小于 %d", field, min)
+	}
+	if len(v) > max {
+		return fmt.Errorf("%s 长度超过上限 %d", field, max)
+	}
+	return nil
+}
+
+func checkRange(field string, v, min, max float64) error {
+	if math.IsNaN(v) || v < min || v > max {
+		return fmt.Errorf("%s 超出范围 [%g, %g]", field, min, max)
+	}
+	return nil
+}
+
+func checkPercent(field string, v float64) error {
+	return checkRange(field, v, 0, 100)
+}
+
+func checkIP(ip string) error {
+	if ip != "" && net.ParseIP(ip) == nil {
+		return fmt.Errorf("ip 格式无效: %.64s", ip)
+	}
+	return nil
+}
@@ -4,8 +4,26 @@ import (
         "yunwei/config"
         "yunwei/global"
         "yunwei/router"
+        agentGrpc "yunwei/grpc"
         schedulerHandler "yunwei/api/v1/scheduler"
+        "yunwei/service/detector"
+        "yunwei/service/event"
+        haService "yunwei/service/ha"
+        "yunwei/service/incident"
+        "yunwei/service/metrics"
+        "yunwei/service/notify"
+        "yunwei/service/oncall"
+        "yunwei/service/outbox"
+        "yunwei/service/slo"
+        "yunwei/service/synthetic"
+        "context"
+        "errors"
         "fmt"
+        "net/http"
+        "os"
+        "os/signal"
+        "syscall"
+        "time"
 
         "github.com/gin-gonic/gin"
 )
@@ -20,9 +38,69 @@ func main() {
         // 初始化日志
         global.InitLogger()
 
+        // 初始化时序指标存储
+        if err := metrics.InitMetricStore(); err != nil {
+                panic("指标存储初始化失败: " + err.Error())
+        }
+
         // 初始化任务中心
         schedulerHandler.InitJobCenter()
 
+        // 启动 HA 服务，Agent 路由依赖集群节点状态
+        if err := haService.GetHAManager().Start(context.Background()); err != nil {
+                panic("HA 服务启动失败: " + err.Error())
+        }
+
+        // 启动通知发件箱，通知先落库再由 Leader 异步发送，发送慢或失败不会阻塞告警和自愈流程
+        notifyOutbox := outbox.GetOutbox()
+        notifyOutbox.SetLeaderCheck(haService.GetHAManager().IsLeader)
+        notifyOutbox.Start(context.Background())
+
+        // 启动告警生命周期管理，未确认事件的重复通知由 Leader 发送；
+        // 事件先经升级策略确定值班人，再按通知路由发给命中的接收人，未配置路由时发到租户的默认通道
+        escalator := oncall.GetEscalator()
+        escalator.SetPager(notify.NewRouteNotifier())
+        escalator.SetLeaderCheck(haService.GetHAManager().IsLeader)
+        escalator.Start(context.Background())
+
+        // 达到级别的告警事件先自动创建故障，再交给升级策略通知；关闭故障后按租户选择的模型起草复盘报告
+        incidentService := incident.GetService()
+        incidentService.SetNext(escalator)
+
+        alertManager := detector.GetAlertManager()
+        alertManager.SetNotifier(incidentService)
+        alertManager.SetLeaderCheck(haService.GetHAManager().IsLeader)
+        alertManager.Start(context.Background())
+
+        // 启动告警规则引擎，集群中只在 Leader 上求值
+        ruleEngine := detector.GetRuleEngine()
+        ruleEngine.SetLeaderCheck(haService.GetHAManager().IsLeader)
+        ruleEngine.Start(context.Background())
+
+        // 启动拨测调度，集群中只在 Leader 上执行，失败的检查经告警生命周期管理通知
+        syntheticRunner := synthetic.GetRunner()
+        syntheticRunner.SetLeaderCheck(haService.GetHAManager().IsLeader)
+        syntheticRunner.Start(context.Background())
+
+        // 启动 SLO 求值，燃烧率告警只由 Leader 产生；错误预算耗尽的服务在灰度发布和部署时被拦截
+        sloService := slo.GetService()
+        sloService.SetLeaderCheck(haService.GetHAManager().IsLeader)
+        sloService.Start(context.Background())
+
+        // 启动事件流过期清理，只在 Leader 上执行；部署、告警、自愈等事件由各模块直接写入
+        eventService := event.GetService()
+        eventService.SetLeaderCheck(haService.GetHAManager().IsLeader)
+        eventService.Start(context.Background())
+
+        // 启动 Agent gRPC 服务
+        grpcPort := config.CONFIG.System.GrpcPort
+        if grpcPort == "" {
+                grpcPort = "50051"
+        }
+        if err := agentGrpc.NewAgentGRPCServer(grpcPort).Start(); err != nil {
+                panic("gRPC 服务启动失败: " + err.Error())
+        }
+
         // 设置 Gin 模式
         if config.CONFIG.System.Env == "production" {
                 gin.SetMode(gin.ReleaseMode)
@@ -45,7 +123,29 @@ func main() {
         ║     gRPC:  localhost:%s                                   ║
         ║                                                           ║
         ╚═══════════════════════════════════════════════════════════╝
-        `, config.CONFIG.System.Port, config.CONFIG.System.GrpcPort)
+        `, config.CONFIG.System.Port, grpcPort)
 
-        r.Run(":" + config.CONFIG.System.Port)
+        srv := &http.Server{Addr: ":" + config.CONFIG.System.Port, Handler: r}
+        go func() {
+                if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+                        panic("HTTP 服务启动失败: " + err.Error())
+                }
+        }()
+
+        // 等待退出信号
+        quit := make(chan os.Signal, 1)
+        signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+        <-quit
+        fmt.Println("服务正在关闭...")
+
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        srv.Shutdown(ctx)
+
+        // 写完管道队列中的样本和未关闭的聚合桶，之后才能关闭数据库
+        metrics.StopMetricStore()
+        if db, err := global.DB.DB(); err == nil {
+                db.Close()
+        }
+        fmt.Println("服务已停止")
 }
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BearerToken 校验固定的 Bearer 令牌，用于 Prometheus 等不走用户登录的抓取方
+func BearerToken(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		got := strings.TrimSpace(c.GetHeader("Authorization"))
+		if subtle.ConstantTimeCompare([]byte(got), expected) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,8 @@
+-- 服务器关联租户，用于按租户配额执行指标保留策略
+-- 执行时间: 2026-10-18
+
+ALTER TABLE servers ADD COLUMN tenant_id VARCHAR(36) COMMENT '租户ID';
+CREATE INDEX idx_servers_tenant_id ON servers(tenant_id);
+
+-- 原始指标按时间范围清理
+CREATE INDEX idx_server_metrics_server_created ON server_metrics(server_id, created_at);
@@ -0,0 +1,26 @@
+-- 告警规则支持表达式、作用范围、模板和恢复条件
+-- 执行时间: 2026-10-18
+
+ALTER TABLE detect_rules ADD COLUMN expr TEXT COMMENT '规则表达式';
+ALTER TABLE detect_rules ADD COLUMN scope VARCHAR(512) COMMENT '作用范围(标签匹配条件)';
+ALTER TABLE detect_rules ADD COLUMN tenant_id VARCHAR(36) COMMENT '租户ID';
+ALTER TABLE detect_rules ADD COLUMN labels TEXT COMMENT '附加标签(JSON)';
+ALTER TABLE detect_rules ADD COLUMN summary VARCHAR(255) COMMENT '标题模板';
+ALTER TABLE detect_rules ADD COLUMN annotations TEXT COMMENT '注释模板(JSON)';
+ALTER TABLE detect_rules ADD COLUMN resolve_threshold DOUBLE NULL COMMENT '恢复阈值';
+ALTER TABLE detect_rules ADD COLUMN keep_firing_for INT DEFAULT 0 COMMENT '条件消失后保持触发(秒)';
+ALTER TABLE detect_rules ADD COLUMN eval_interval INT DEFAULT 0 COMMENT '求值间隔(秒)';
+CREATE INDEX idx_detect_rules_tenant_id ON detect_rules(tenant_id);
+
+-- 告警记录补齐规则引擎写入的列
+ALTER TABLE alerts ADD COLUMN type VARCHAR(32);
+ALTER TABLE alerts ADD COLUMN threshold DOUBLE DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN acknowledged_by BIGINT UNSIGNED DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN auto_resolved TINYINT(1) DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN action_taken TEXT;
+ALTER TABLE alerts ADD COLUMN rule_id BIGINT UNSIGNED DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN fingerprint VARCHAR(64) COMMENT '规则+序列标签哈希';
+ALTER TABLE alerts ADD COLUMN labels TEXT COMMENT '序列标签(JSON)';
+ALTER TABLE alerts ADD COLUMN annotations TEXT COMMENT '注释(JSON)';
+ALTER TABLE alerts ADD COLUMN fired_at DATETIME NULL;
+CREATE INDEX idx_alerts_rule_fingerprint ON alerts(rule_id, fingerprint);
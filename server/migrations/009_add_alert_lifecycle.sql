@@ -0,0 +1,39 @@
+-- 告警生命周期：指纹去重、事件分组、重复通知
+-- 执行时间: 2026-10-18
+
+ALTER TABLE alerts ADD COLUMN acknowledged_at DATETIME(3) NULL COMMENT '确认时间';
+ALTER TABLE alerts ADD COLUMN incident_id BIGINT UNSIGNED DEFAULT 0 COMMENT '所属事件';
+ALTER TABLE alerts ADD COLUMN last_seen_at DATETIME(3) NULL COMMENT '最后一次检测到的时间';
+ALTER TABLE alerts ADD COLUMN occurrences INT DEFAULT 0 COMMENT '未恢复期间检测到的次数';
+CREATE INDEX idx_alerts_incident_id ON alerts(incident_id);
+
+-- 状态 active 更名为 firing
+ALTER TABLE alerts ALTER COLUMN status SET DEFAULT 'firing';
+UPDATE alerts SET status = 'firing' WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS incidents (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    group_key VARCHAR(64) COMMENT '分组标签哈希',
+    group_labels TEXT COMMENT '分组标签(JSON)',
+    title VARCHAR(255),
+    level VARCHAR(16),
+    status VARCHAR(16) COMMENT 'firing, acknowledged, resolved',
+    tenant_id VARCHAR(36),
+    server_id BIGINT UNSIGNED DEFAULT 0,
+    rule_id BIGINT UNSIGNED DEFAULT 0,
+    alert_count INT DEFAULT 0 COMMENT '关联告警总数',
+    active_count INT DEFAULT 0 COMMENT '未恢复告警数',
+    fired_at DATETIME(3) NULL,
+    acknowledged_at DATETIME(3) NULL,
+    acknowledged_by BIGINT UNSIGNED DEFAULT 0,
+    resolved_at DATETIME(3) NULL,
+    resolved_by BIGINT UNSIGNED DEFAULT 0,
+    last_notified_at DATETIME(3) NULL,
+    notify_count INT DEFAULT 0,
+    INDEX idx_incidents_group_key (group_key),
+    INDEX idx_incidents_status (status),
+    INDEX idx_incidents_tenant_id (tenant_id),
+    INDEX idx_incidents_server_id (server_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='告警事件';
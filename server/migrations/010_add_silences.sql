@@ -0,0 +1,35 @@
+-- 告警静默与周期性维护窗口
+-- 执行时间: 2026-10-18
+
+CREATE TABLE IF NOT EXISTS alert_silences (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    matchers TEXT NOT NULL COMMENT '标签匹配条件',
+    starts_at DATETIME(3) NULL,
+    ends_at DATETIME(3) NULL,
+    comment VARCHAR(255),
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    creator VARCHAR(64),
+    suppress_heal TINYINT(1) DEFAULT 0 COMMENT '暂停自愈',
+    suppress_auto_exec TINYINT(1) DEFAULT 0 COMMENT '暂停 AI 自动执行',
+    INDEX idx_alert_silences_ends_at (ends_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='告警静默';
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    name VARCHAR(64) NOT NULL,
+    matchers TEXT NOT NULL COMMENT '作用范围',
+    schedule VARCHAR(128) COMMENT '开始时间(cron)',
+    duration INT DEFAULT 0 COMMENT '持续时间(分钟)',
+    enabled TINYINT(1) DEFAULT 1,
+    comment VARCHAR(255),
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    creator VARCHAR(64),
+    suppress_heal TINYINT(1) DEFAULT 1 COMMENT '暂停自愈',
+    suppress_auto_exec TINYINT(1) DEFAULT 1 COMMENT '暂停 AI 自动执行'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='维护窗口';
+
+-- 自愈和工作流新增 skipped 状态，无需改表
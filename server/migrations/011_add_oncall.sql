@@ -0,0 +1,63 @@
+-- 值班表、替班与升级策略
+-- 执行时间: 2026-10-18
+
+CREATE TABLE IF NOT EXISTS oncall_schedules (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    name VARCHAR(64) NOT NULL,
+    tenant_id VARCHAR(36),
+    timezone VARCHAR(64) COMMENT '为空使用服务器时区',
+    participants TEXT COMMENT '轮换顺序，用户ID数组(JSON)',
+    rotation_type VARCHAR(16) DEFAULT 'weekly' COMMENT 'daily, weekly, custom',
+    rotation_hours INT DEFAULT 0 COMMENT 'custom 时每班时长(小时)',
+    handoff_time VARCHAR(5) DEFAULT '09:00' COMMENT '交接时间',
+    start_date DATETIME(3) NULL COMMENT '第一位参与人开始值班的日期',
+    manager_id BIGINT UNSIGNED DEFAULT 0,
+    comment VARCHAR(255),
+    INDEX idx_oncall_schedules_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='值班表';
+
+CREATE TABLE IF NOT EXISTS oncall_overrides (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    schedule_id BIGINT UNSIGNED NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    starts_at DATETIME(3) NULL,
+    ends_at DATETIME(3) NULL,
+    comment VARCHAR(255),
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    INDEX idx_oncall_overrides_schedule_id (schedule_id),
+    INDEX idx_oncall_overrides_ends_at (ends_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='替班';
+
+CREATE TABLE IF NOT EXISTS escalation_policies (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    name VARCHAR(64) NOT NULL,
+    tenant_id VARCHAR(36) COMMENT '为空对所有租户生效',
+    priority INT DEFAULT 0 COMMENT '越小越先匹配',
+    levels VARCHAR(64) COMMENT '告警级别，逗号分隔',
+    matchers TEXT COMMENT '标签匹配条件',
+    steps TEXT COMMENT '升级级别(JSON)',
+    enabled TINYINT(1) DEFAULT 1,
+    comment VARCHAR(255),
+    INDEX idx_escalation_policies_tenant_id (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='升级策略';
+
+CREATE TABLE IF NOT EXISTS incident_escalations (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    incident_id BIGINT UNSIGNED NOT NULL,
+    policy_id BIGINT UNSIGNED DEFAULT 0,
+    step INT DEFAULT 0 COMMENT '已通知到的级别，从 0 开始',
+    status VARCHAR(16) COMMENT 'active, acknowledged, resolved',
+    next_at DATETIME(3) NULL COMMENT '下一次升级时间',
+    last_paged_at DATETIME(3) NULL,
+    notified VARCHAR(255) COMMENT '当前级别通知到的人',
+    UNIQUE INDEX idx_incident_escalations_incident_id (incident_id),
+    INDEX idx_incident_escalations_status (status),
+    INDEX idx_incident_escalations_next_at (next_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='事件升级进度';
@@ -0,0 +1,28 @@
+-- 告警抑制规则、服务器依赖关系与 host_down 根因告警
+-- 执行时间: 2026-10-18
+
+ALTER TABLE alerts ADD COLUMN inhibited_by BIGINT UNSIGNED DEFAULT 0 COMMENT '抑制该告警的根因告警';
+CREATE INDEX idx_alerts_inhibited_by ON alerts(inhibited_by);
+
+CREATE TABLE IF NOT EXISTS alert_inhibit_rules (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    name VARCHAR(64) NOT NULL,
+    source_matchers TEXT NOT NULL COMMENT '来源告警匹配条件',
+    target_matchers TEXT NOT NULL COMMENT '被抑制告警匹配条件',
+    `equal` VARCHAR(255) COMMENT '需要相同取值的标签，逗号分隔',
+    enabled TINYINT(1) DEFAULT 1,
+    comment VARCHAR(255)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='告警抑制规则';
+
+CREATE TABLE IF NOT EXISTS server_relations (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    server_id BIGINT UNSIGNED NOT NULL COMMENT '受影响的服务器',
+    depends_on_id BIGINT UNSIGNED NOT NULL COMMENT '上游服务器',
+    type VARCHAR(32) DEFAULT 'depends_on' COMMENT 'depends_on, runs_on, behind',
+    comment VARCHAR(255),
+    INDEX idx_server_relations_server_id (server_id),
+    INDEX idx_server_relations_depends_on_id (depends_on_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='服务器依赖关系';
@@ -0,0 +1,38 @@
+-- 通知路由树与接收人，事件按路由分组并控制通知时间
+-- 执行时间: 2026-10-18
+
+ALTER TABLE incidents ADD COLUMN route_id BIGINT UNSIGNED DEFAULT 0 COMMENT '通知路由';
+ALTER TABLE incidents ADD COLUMN changed_at DATETIME(3) NULL COMMENT '最近一次有新告警加入的时间';
+
+CREATE TABLE IF NOT EXISTS notify_routes (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '' COMMENT '为空为全局路由树',
+    parent_id BIGINT UNSIGNED DEFAULT 0 COMMENT '上级路由，0 为根路由',
+    name VARCHAR(64) NOT NULL,
+    sort INT DEFAULT 0 COMMENT '同级路由的匹配顺序',
+    matchers TEXT COMMENT '标签匹配条件',
+    levels VARCHAR(64) COMMENT '告警级别，逗号分隔',
+    `continue` TINYINT(1) DEFAULT 0 COMMENT '匹配后继续尝试后面的同级路由',
+    receiver VARCHAR(64) COMMENT '接收人名称，为空继承上级',
+    group_by VARCHAR(255) COMMENT '分组维度，逗号分隔，为空继承上级',
+    group_wait VARCHAR(16) COMMENT '首次通知等待时间，如 30s',
+    group_interval VARCHAR(16) COMMENT '分组更新通知间隔，如 5m',
+    repeat_interval VARCHAR(16) COMMENT '重复提醒间隔，如 4h',
+    enabled TINYINT(1) DEFAULT 1,
+    comment VARCHAR(255),
+    INDEX idx_notify_routes_tenant_id (tenant_id),
+    INDEX idx_notify_routes_parent_id (parent_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='通知路由';
+
+CREATE TABLE IF NOT EXISTS notify_receivers (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '' COMMENT '为空为全局接收人',
+    name VARCHAR(64) NOT NULL,
+    channels TEXT COMMENT '通知通道(JSON)',
+    comment VARCHAR(255),
+    UNIQUE INDEX idx_notify_receivers_tenant_name (tenant_id, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='通知接收人';
@@ -0,0 +1,16 @@
+-- 通知模板，按租户、事件类型和通道自定义通知内容
+-- 执行时间: 2026-10-18
+
+CREATE TABLE IF NOT EXISTS notify_templates (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '' COMMENT '为空为全局模板',
+    event VARCHAR(32) NOT NULL COMMENT 'incident, firing, repeat, acknowledged, resolved, escalated, alert, patrol',
+    channel VARCHAR(16) NOT NULL COMMENT 'telegram, wechat, dingtalk, feishu, email, text',
+    title TEXT COMMENT '标题模板，为空使用内置标题',
+    body TEXT COMMENT '正文模板',
+    enabled TINYINT(1) DEFAULT 1,
+    comment VARCHAR(255),
+    UNIQUE INDEX idx_notify_templates_tenant_event_channel (tenant_id, event, channel)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='通知模板';
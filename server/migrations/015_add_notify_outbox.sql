@@ -0,0 +1,30 @@
+-- 通知发件箱，通知先落库再由 Leader 异步发送、重试
+-- 执行时间: 2026-10-18
+
+CREATE TABLE IF NOT EXISTS notify_outbox (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    channel VARCHAR(16) NOT NULL COMMENT 'telegram, wechat, dingtalk, feishu, email, webhook',
+    target VARCHAR(512) COMMENT 'webhook 地址、Telegram chatId 或逗号分隔的收件人',
+    secret VARCHAR(255) COMMENT 'Telegram bot token',
+    format VARCHAR(16) COMMENT 'Telegram parse_mode',
+    kind VARCHAR(16) COMMENT 'alert, patrol, message, digest 等',
+    title VARCHAR(255),
+    content MEDIUMTEXT,
+    html MEDIUMTEXT COMMENT '邮件 HTML 正文',
+    payload MEDIUMTEXT COMMENT '原样发送的 JSON 请求体',
+    mentions TEXT COMMENT '@ 的手机号或邮件抄送地址',
+    digest TINYINT(1) DEFAULT 0 COMMENT '积压时允许合并为摘要',
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' COMMENT 'pending, sending, sent, dead, merged',
+    next_attempt_at DATETIME(3) NULL,
+    locked_until DATETIME(3) NULL,
+    attempts INT DEFAULT 0,
+    max_attempts INT DEFAULT 0,
+    last_error TEXT,
+    sent_at DATETIME(3) NULL,
+    merged_into BIGINT UNSIGNED DEFAULT 0 COMMENT '合并到的摘要消息',
+    INDEX idx_notify_outbox_status_next (status, next_attempt_at),
+    INDEX idx_notify_outbox_channel (channel),
+    INDEX idx_notify_outbox_merged_into (merged_into)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='通知发件箱';
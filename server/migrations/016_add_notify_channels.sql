@@ -0,0 +1,16 @@
+-- 通知通道实例，按租户保存，接收人按名称引用，默认通道接收系统通知和未命中路由的事件
+-- 执行时间: 2026-10-18
+
+CREATE TABLE IF NOT EXISTS notify_channels (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '' COMMENT '为空为全局通道',
+    name VARCHAR(64) NOT NULL,
+    type VARCHAR(16) NOT NULL COMMENT 'telegram, wechat, dingtalk, feishu, email, slack, teams, webhook, pagerduty',
+    config TEXT COMMENT '通道参数(JSON)',
+    is_default TINYINT(1) DEFAULT 0 COMMENT '接收系统通知和未命中路由的事件',
+    enabled TINYINT(1) DEFAULT 1,
+    comment VARCHAR(255),
+    UNIQUE INDEX idx_notify_channels_tenant_name (tenant_id, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='通知通道实例';
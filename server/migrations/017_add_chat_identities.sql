@@ -0,0 +1,15 @@
+-- 聊天账号与平台用户的绑定，Telegram、钉钉、飞书中的按钮和命令以绑定的用户身份执行并校验权限
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS chat_identities (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    platform VARCHAR(16) NOT NULL COMMENT 'telegram, dingtalk, feishu',
+    external_id VARCHAR(128) NOT NULL COMMENT 'Telegram user id、钉钉 senderStaffId、飞书 open_id',
+    external_name VARCHAR(64) COMMENT '聊天中的显示名',
+    user_id BIGINT UNSIGNED NOT NULL,
+    comment VARCHAR(255),
+    UNIQUE INDEX idx_chat_identities_platform_external (platform, external_id),
+    INDEX idx_chat_identities_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='聊天账号绑定';
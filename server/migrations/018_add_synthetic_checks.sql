@@ -0,0 +1,46 @@
+-- 拨测检查及其结果，检查由 Leader 在控制节点和选定的 Agent 上执行，结果用于可用率统计和告警
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS synthetic_checks (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '',
+    name VARCHAR(64) NOT NULL,
+    type VARCHAR(8) NOT NULL COMMENT 'http, tcp, dns, tls',
+    target VARCHAR(512) NOT NULL COMMENT 'URL、host:port 或域名',
+    `interval` INT DEFAULT 60 COMMENT '执行间隔(秒)',
+    timeout INT DEFAULT 10 COMMENT '单次超时(秒)',
+    locations TEXT COMMENT '逗号分隔的拨测地点：server 或 Agent ID',
+    fail_threshold INT DEFAULT 0 COMMENT '失败地点数达到此值时告警，0 为 1',
+    level VARCHAR(16) COMMENT '告警级别',
+    assertions TEXT COMMENT '断言(JSON)',
+    method VARCHAR(8),
+    headers TEXT COMMENT '请求头(JSON)',
+    body TEXT,
+    no_redirects TINYINT(1) DEFAULT 0 COMMENT '不跟随重定向',
+    skip_verify TINYINT(1) DEFAULT 0 COMMENT '不校验证书',
+    record_type VARCHAR(8) COMMENT 'DNS 记录类型',
+    resolver VARCHAR(64) COMMENT 'DNS 服务器',
+    resource VARCHAR(32) DEFAULT '' COMMENT '关联资源：cdn_domain, load_balancer',
+    resource_id BIGINT UNSIGNED DEFAULT 0,
+    enabled TINYINT(1) DEFAULT 1,
+    comment VARCHAR(255),
+    status VARCHAR(8) DEFAULT '' COMMENT 'up, down',
+    last_run_at DATETIME(3) NULL,
+    last_error VARCHAR(512),
+    INDEX idx_synthetic_checks_tenant_id (tenant_id),
+    INDEX idx_synthetic_checks_resource (resource, resource_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='拨测检查';
+
+CREATE TABLE IF NOT EXISTS synthetic_results (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    check_id BIGINT UNSIGNED NOT NULL,
+    location VARCHAR(64) NOT NULL COMMENT 'server 或 Agent ID',
+    success TINYINT(1) DEFAULT 0,
+    latency BIGINT DEFAULT 0 COMMENT '毫秒',
+    status_code INT DEFAULT 0,
+    error VARCHAR(512) COMMENT '连接错误或未通过的断言',
+    INDEX idx_synthetic_results_check_time (check_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='拨测结果';
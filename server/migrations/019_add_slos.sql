@@ -0,0 +1,27 @@
+-- SLO 定义及最近一次求值的状态，错误预算耗尽且开启阻止发布时拦截灰度发布和部署
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS slos (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '',
+    name VARCHAR(64) NOT NULL,
+    service VARCHAR(128) DEFAULT '' COMMENT '服务名，对应灰度发布和部署方案中的服务',
+    description VARCHAR(255),
+    source VARCHAR(16) NOT NULL COMMENT 'synthetic, metric',
+    check_id BIGINT UNSIGNED DEFAULT 0 COMMENT '拨测检查',
+    good_query TEXT COMMENT '达标事件数查询，包含 $window',
+    total_query TEXT COMMENT '总事件数查询，包含 $window',
+    objective DOUBLE NOT NULL COMMENT '目标达标比例(%)',
+    window_days INT DEFAULT 30 COMMENT '滚动窗口：7、28、30 天',
+    block_deploys TINYINT(1) DEFAULT 0 COMMENT '错误预算耗尽时阻止发布',
+    enabled TINYINT(1) DEFAULT 1,
+    status VARCHAR(16) DEFAULT '' COMMENT 'ok, burning, exhausted, no_data',
+    sli DOUBLE DEFAULT 0 COMMENT '窗口内达标比例(%)',
+    budget_remaining DOUBLE DEFAULT 0 COMMENT '剩余错误预算(%)',
+    last_eval_at DATETIME(3) NULL,
+    last_error VARCHAR(512),
+    INDEX idx_slos_tenant_id (tenant_id),
+    INDEX idx_slos_service (service)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='服务等级目标';
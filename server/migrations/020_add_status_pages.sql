@@ -0,0 +1,59 @@
+-- 状态页、组件及手动发布的事件，组件状态由关联的拨测检查或服务器分组的告警得出
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS status_pages (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '',
+    name VARCHAR(64) NOT NULL,
+    slug VARCHAR(64) NOT NULL COMMENT '访问路径 /status/:slug',
+    description VARCHAR(255),
+    public TINYINT(1) DEFAULT 0 COMMENT '是否允许匿名访问',
+    custom_domain VARCHAR(255) DEFAULT '' COMMENT '自定义域名',
+    enabled TINYINT(1) DEFAULT 1,
+    UNIQUE INDEX idx_status_pages_slug (slug),
+    INDEX idx_status_pages_tenant_id (tenant_id),
+    INDEX idx_status_pages_custom_domain (custom_domain)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='状态页';
+
+CREATE TABLE IF NOT EXISTS status_page_components (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    page_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    description VARCHAR(255),
+    source VARCHAR(16) NOT NULL COMMENT 'synthetic, server_group',
+    check_id BIGINT UNSIGNED DEFAULT 0,
+    group_id BIGINT UNSIGNED DEFAULT 0,
+    sort_order INT DEFAULT 0,
+    INDEX idx_status_page_components_page_id (page_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='状态页组件';
+
+CREATE TABLE IF NOT EXISTS status_page_incidents (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    page_id BIGINT UNSIGNED NOT NULL,
+    title VARCHAR(128) NOT NULL,
+    status VARCHAR(16) NOT NULL COMMENT 'investigating, identified, monitoring, resolved',
+    impact VARCHAR(16) COMMENT 'minor, major, critical',
+    components VARCHAR(255) COMMENT '逗号分隔的受影响组件 ID',
+    resolved_at DATETIME(3) NULL,
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    creator VARCHAR(64),
+    INDEX idx_status_page_incidents_page_id (page_id),
+    INDEX idx_status_page_incidents_status (status)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='状态页事件';
+
+CREATE TABLE IF NOT EXISTS status_page_incident_updates (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    incident_id BIGINT UNSIGNED NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    message TEXT,
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    creator VARCHAR(64),
+    INDEX idx_status_page_incident_updates_incident_id (incident_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='状态页事件进展';
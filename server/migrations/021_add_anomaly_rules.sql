@@ -0,0 +1,10 @@
+-- 告警规则支持异常检测：按序列学习季节基线，偏离超过灵敏度时告警
+-- 执行时间: 2026-10-19
+
+ALTER TABLE detect_rules ADD COLUMN anomaly_algorithm VARCHAR(16) COMMENT 'mad, holt_winters';
+ALTER TABLE detect_rules ADD COLUMN anomaly_seasonality VARCHAR(16) COMMENT 'hour_of_day, hour_of_week';
+ALTER TABLE detect_rules ADD COLUMN anomaly_sensitivity DOUBLE DEFAULT 0 COMMENT '偏离几倍正常波动算异常';
+ALTER TABLE detect_rules ADD COLUMN anomaly_min_deviation DOUBLE DEFAULT 0 COMMENT '与基线的最小绝对差';
+ALTER TABLE detect_rules ADD COLUMN anomaly_direction VARCHAR(8) COMMENT 'up, down, both';
+ALTER TABLE detect_rules ADD COLUMN anomaly_baseline_days INT DEFAULT 0 COMMENT '学习基线的历史天数';
+ALTER TABLE detect_rules ADD COLUMN anomaly_warmup_days INT DEFAULT 0 COMMENT '预热天数';
@@ -0,0 +1,23 @@
+-- 统一事件流：部署、灰度发布、告警、自愈、配置变更、命令执行、AI 决策和 Agent 升级写入同一张表，按服务器、分组和时间查询
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS events (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    occurred_at DATETIME(3) NOT NULL,
+    tenant_id VARCHAR(36) DEFAULT '',
+    type VARCHAR(32) NOT NULL COMMENT 'deploy, canary, alert, heal, config, command, ai_decision, agent_upgrade',
+    action VARCHAR(32) DEFAULT '' COMMENT 'started, succeeded, failed, fired, resolved 等',
+    severity VARCHAR(16) DEFAULT 'info' COMMENT 'info, warning, critical',
+    title VARCHAR(255) NOT NULL,
+    detail TEXT,
+    labels TEXT COMMENT '附加标签(JSON)',
+    server_ids VARCHAR(1024) DEFAULT '' COMMENT '涉及的服务器，形如 ,1,2,；为空表示不限于具体服务器',
+    group_ids VARCHAR(255) DEFAULT '' COMMENT '涉及的服务器分组，形如 ,1,2,',
+    source VARCHAR(32) DEFAULT '' COMMENT '来源记录类型，如 deploy_task',
+    source_id BIGINT UNSIGNED DEFAULT 0,
+    actor VARCHAR(64) DEFAULT '' COMMENT '操作人，系统自动触发时为空',
+    INDEX idx_events_occurred_at (occurred_at),
+    INDEX idx_events_tenant_id (tenant_id),
+    INDEX idx_events_type (type)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='事件流';
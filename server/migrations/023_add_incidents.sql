@@ -0,0 +1,78 @@
+-- 故障管理：故障、处理进展、角色、关联记录和复盘报告
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS incident_records (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '',
+    title VARCHAR(255) NOT NULL,
+    severity VARCHAR(8) DEFAULT 'sev3' COMMENT 'sev1, sev2, sev3, sev4',
+    status VARCHAR(16) DEFAULT 'investigating' COMMENT 'investigating, identified, monitoring, resolved, closed',
+    summary TEXT COMMENT '影响和现状描述',
+    servers VARCHAR(1024) DEFAULT '' COMMENT '涉及的服务器 ID(JSON 数组)',
+    alert_group_id BIGINT UNSIGNED DEFAULT 0 COMMENT '自动创建时对应的告警事件',
+    commander_id BIGINT UNSIGNED DEFAULT 0,
+    commander VARCHAR(64) DEFAULT '',
+    started_at DATETIME(3) NULL,
+    resolved_at DATETIME(3) NULL,
+    closed_at DATETIME(3) NULL,
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    creator VARCHAR(64) DEFAULT '' COMMENT '自动创建时为空',
+    INDEX idx_incident_records_tenant_id (tenant_id),
+    INDEX idx_incident_records_status (status),
+    INDEX idx_incident_records_alert_group_id (alert_group_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='故障';
+
+CREATE TABLE IF NOT EXISTS incident_updates (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    incident_id BIGINT UNSIGNED NOT NULL,
+    kind VARCHAR(16) DEFAULT '' COMMENT 'status, note, severity, role, link, system',
+    status VARCHAR(16) DEFAULT '' COMMENT '这条进展之后的故障状态',
+    message TEXT,
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    creator VARCHAR(64) DEFAULT '',
+    INDEX idx_incident_updates_incident_id (incident_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='故障进展';
+
+CREATE TABLE IF NOT EXISTS incident_roles (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    incident_id BIGINT UNSIGNED NOT NULL,
+    role VARCHAR(16) NOT NULL COMMENT 'communications, operations, scribe；指挥官记在故障上',
+    user_id BIGINT UNSIGNED DEFAULT 0,
+    username VARCHAR(64) DEFAULT '',
+    UNIQUE INDEX idx_incident_role (incident_id, role)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='故障角色';
+
+CREATE TABLE IF NOT EXISTS incident_links (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    incident_id BIGINT UNSIGNED NOT NULL,
+    kind VARCHAR(32) NOT NULL COMMENT '事件类型，如 alert, heal, ai_decision, command',
+    source_id BIGINT UNSIGNED DEFAULT 0,
+    title VARCHAR(255) DEFAULT '',
+    occurred_at DATETIME(3) NULL,
+    linked_by VARCHAR(64) DEFAULT '' COMMENT '手动关联的用户，自动关联时为空',
+    INDEX idx_incident_links_incident_id (incident_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='故障关联记录';
+
+CREATE TABLE IF NOT EXISTS incident_postmortems (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    incident_id BIGINT UNSIGNED NOT NULL,
+    status VARCHAR(16) DEFAULT '' COMMENT 'generating, draft, failed',
+    error VARCHAR(512) DEFAULT '',
+    summary TEXT,
+    impact TEXT,
+    root_cause TEXT,
+    actions_taken TEXT,
+    follow_ups TEXT,
+    generated_at DATETIME(3) NULL,
+    edited_by VARCHAR(64) DEFAULT '',
+    edited_at DATETIME(3) NULL,
+    UNIQUE INDEX idx_incident_postmortems_incident_id (incident_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='故障复盘报告';
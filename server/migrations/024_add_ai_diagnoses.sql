@@ -0,0 +1,41 @@
+-- 多步诊断：诊断记录和每一步的工具调用
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS ai_diagnoses (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    updated_at DATETIME(3) NULL,
+    tenant_id VARCHAR(36) DEFAULT '',
+    server_id BIGINT UNSIGNED NOT NULL,
+    question TEXT COMMENT '发起人描述的现象',
+    status VARCHAR(16) DEFAULT 'running' COMMENT 'running, completed, failed, cancelled',
+    provider VARCHAR(64) DEFAULT '' COMMENT '使用的大模型提供方',
+    max_steps INT DEFAULT 0 COMMENT '最多调用工具的次数',
+    tool_calls INT DEFAULT 0,
+    decision_id BIGINT UNSIGNED DEFAULT 0 COMMENT '诊断得出的 AI 决策',
+    error TEXT,
+    finished_at DATETIME(3) NULL,
+    created_by BIGINT UNSIGNED DEFAULT 0,
+    creator VARCHAR(64) DEFAULT '',
+    INDEX idx_ai_diagnoses_tenant_id (tenant_id),
+    INDEX idx_ai_diagnoses_server_id (server_id),
+    INDEX idx_ai_diagnoses_status (status),
+    INDEX idx_ai_diagnoses_decision_id (decision_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='AI 多步诊断';
+
+CREATE TABLE IF NOT EXISTS ai_diagnosis_steps (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    created_at DATETIME(3) NULL,
+    diagnosis_id BIGINT UNSIGNED NOT NULL,
+    seq INT DEFAULT 0,
+    kind VARCHAR(16) DEFAULT '' COMMENT 'tool, invalid, final',
+    thought TEXT COMMENT '模型说明的调用理由',
+    tool VARCHAR(32) DEFAULT '',
+    args TEXT COMMENT '工具参数(JSON)',
+    command TEXT COMMENT '在服务器上执行的命令',
+    output MEDIUMTEXT,
+    result VARCHAR(16) DEFAULT '' COMMENT 'success, failed, forbidden',
+    error TEXT,
+    duration BIGINT DEFAULT 0 COMMENT '毫秒',
+    INDEX idx_ai_diagnosis_steps_diagnosis_id (diagnosis_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='AI 诊断步骤';
@@ -0,0 +1,17 @@
+-- 指标降采样聚合：1m/5m/1h 精度的 min/max/avg/p95
+-- 执行时间: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS metric_rollups (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    server_id BIGINT UNSIGNED NOT NULL,
+    metric VARCHAR(64) NOT NULL,
+    resolution VARCHAR(8) NOT NULL COMMENT '1m, 5m, 1h',
+    bucket_time DATETIME(3) NULL COMMENT '时间桶起始时间',
+    min DOUBLE DEFAULT 0,
+    max DOUBLE DEFAULT 0,
+    avg DOUBLE DEFAULT 0,
+    p95 DOUBLE DEFAULT 0,
+    count BIGINT DEFAULT 0,
+    UNIQUE INDEX idx_rollup_series (server_id, metric, resolution, bucket_time),
+    INDEX idx_metric_rollups_bucket_time (bucket_time)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='指标降采样聚合';
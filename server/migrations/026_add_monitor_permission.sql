@@ -0,0 +1,11 @@
+-- 指标查询接口权限：已初始化过权限数据的库补充 monitor:view，并授予管理员、运维人员和只读用户
+-- 执行时间: 2026-10-19
+
+INSERT INTO `permissions` (`created_at`, `updated_at`, `name`, `code`, `description`, `group`)
+SELECT NOW(3), NOW(3), '查看监控指标', 'monitor:view', '', '监控指标'
+FROM DUAL WHERE NOT EXISTS (SELECT 1 FROM `permissions` WHERE `code` = 'monitor:view');
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+SELECT r.id, p.id FROM `roles` r, `permissions` p
+WHERE r.code IN ('admin', 'operator', 'viewer') AND p.code = 'monitor:view'
+AND NOT EXISTS (SELECT 1 FROM `role_permissions` rp WHERE rp.role_id = r.id AND rp.permission_id = p.id);
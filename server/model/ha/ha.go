@@ -350,3 +350,22 @@ type NodeMetric struct {
 func (NodeMetric) TableName() string {
 	return "node_metrics"
 }
+
+// AgentLocation Agent 会话位置，记录 Agent 命令流连接在哪个控制节点上
+type AgentLocation struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	AgentID   string `json:"agentId" gorm:"type:varchar(128);uniqueIndex;not null;comment:Agent标识"`
+	NodeID    string `json:"nodeId" gorm:"type:varchar(64);index;comment:所在节点ID"`
+	NodeAddr  string `json:"nodeAddr" gorm:"type:varchar(128);comment:节点内部API地址"`
+	SessionID string `json:"sessionId" gorm:"type:varchar(64);comment:会话ID"`
+
+	ConnectedAt time.Time `json:"connectedAt" gorm:"comment:连接时间"`
+	LastSeenAt  time.Time `json:"lastSeenAt" gorm:"index;comment:最后活跃时间"`
+}
+
+func (AgentLocation) TableName() string {
+	return "ha_agent_locations"
+}
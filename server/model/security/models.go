@@ -197,6 +197,9 @@ var PredefinedPermissions = []OperationPermission{
         {Code: "ai:approve", Name: "审批AI决策", Group: "AI运维", RiskLevel: 4},
         {Code: "ai:config", Name: "AI配置", Group: "AI运维", RiskLevel: 4},
 
+        // ==================== 监控指标 ====================
+        {Code: "monitor:view", Name: "查看监控指标", Group: "监控指标", RiskLevel: 1},
+
         // ==================== 告警管理 ====================
         {Code: "alert:view", Name: "查看告警", Group: "告警管理", RiskLevel: 1},
         {Code: "alert:handle", Name: "处理告警", Group: "告警管理", RiskLevel: 3},
@@ -284,6 +287,8 @@ var PredefinedRoles = []PredefinedRole{
                         "command:execute", "command:approve",
                         // AI运维
                         "ai:analyze", "ai:execute", "ai:approve",
+                        // 监控指标
+                        "monitor:view",
                         // 告警管理
                         "alert:view", "alert:handle", "alert:config",
                         "alert_rule:view", "alert_rule:edit",
@@ -330,6 +335,8 @@ var PredefinedRoles = []PredefinedRole{
                         "command:execute",
                         // AI运维 - 分析
                         "ai:analyze",
+                        // 监控指标
+                        "monitor:view",
                         // 告警管理 - 查看和处理
                         "alert:view", "alert:handle",
                         "alert_rule:view",
@@ -356,6 +363,7 @@ var PredefinedRoles = []PredefinedRole{
                         "ha:view",
                         "backup:view",
                         "cost:view",
+                        "monitor:view",
                         "alert:view", "alert_rule:view",
                         "audit:view",
                 },
@@ -0,0 +1,25 @@
+package server
+
+import "time"
+
+// 服务器关系类型
+const (
+	RelationDependsOn = "depends_on" // 依赖，如应用依赖数据库
+	RelationRunsOn    = "runs_on"    // 运行在，如虚拟机运行在宿主机上
+	RelationBehind    = "behind"     // 位于其后，如后端位于负载均衡之后
+)
+
+// ServerRelation 服务器之间的依赖关系：DependsOnID 故障时 ServerID 受影响
+type ServerRelation struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	ServerID    uint   `json:"serverId" gorm:"index;not null;comment:受影响的服务器"`
+	DependsOnID uint   `json:"dependsOnId" gorm:"index;not null;comment:上游服务器"`
+	Type        string `json:"type" gorm:"type:varchar(32);default:'depends_on';comment:关系类型"`
+	Comment     string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (ServerRelation) TableName() string {
+	return "server_relations"
+}
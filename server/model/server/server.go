@@ -31,6 +31,9 @@ type Server struct {
         GroupID     uint   `json:"groupId" gorm:"comment:分组ID"`
         Group       *Group `json:"group" gorm:"foreignKey:GroupID"`
         
+        // 租户
+        TenantID    string `json:"tenantId" gorm:"type:varchar(36);index;comment:租户ID"`
+        
         // 系统信息
         OS          string `json:"os" gorm:"type:varchar(64);comment:操作系统"`
         Arch        string `json:"arch" gorm:"type:varchar(32);comment:架构"`
@@ -124,6 +127,25 @@ func (ServerMetric) TableName() string {
         return "server_metrics"
 }
 
+// MetricRollup 指标降采样聚合 (1m/5m/1h)
+type MetricRollup struct {
+        ID         uint      `json:"id" gorm:"primarykey"`
+        ServerID   uint      `json:"serverId" gorm:"uniqueIndex:idx_rollup_series,priority:1;not null"`
+        Metric     string    `json:"metric" gorm:"type:varchar(64);uniqueIndex:idx_rollup_series,priority:2;not null"`
+        Resolution string    `json:"resolution" gorm:"type:varchar(8);uniqueIndex:idx_rollup_series,priority:3;not null"`
+        BucketTime time.Time `json:"bucketTime" gorm:"uniqueIndex:idx_rollup_series,priority:4;index"`
+
+        Min   float64 `json:"min"`
+        Max   float64 `json:"max"`
+        Avg   float64 `json:"avg"`
+        P95   float64 `json:"p95"`
+        Count int     `json:"count"`
+}
+
+func (MetricRollup) TableName() string {
+        return "metric_rollups"
+}
+
 // ServerLog 服务器日志
 type ServerLog struct {
         ID        uint      `json:"id" gorm:"primarykey"`
@@ -14,7 +14,17 @@ import (
         haApi "yunwei/api/v1/ha"
         backupApi "yunwei/api/v1/backup"
         costApi "yunwei/api/v1/cost"
+        metricsApi "yunwei/api/v1/metrics"
+        oncallApi "yunwei/api/v1/oncall"
+        chatopsApi "yunwei/api/v1/chatops"
+        syntheticApi "yunwei/api/v1/synthetic"
+        sloApi "yunwei/api/v1/slo"
+        statuspageApi "yunwei/api/v1/statuspage"
+        eventApi "yunwei/api/v1/event"
+        incidentApi "yunwei/api/v1/incident"
+        aiApi "yunwei/api/v1/ai"
         "yunwei/api/v1/system"
+        "yunwei/config"
         "yunwei/middleware"
         "yunwei/global"
         tenantApi "yunwei/api/v1/tenant"
@@ -22,6 +32,7 @@ import (
         "yunwei/websocket"
 
         "github.com/gin-gonic/gin"
+        "github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func InitRouter(r *gin.Engine) {
@@ -46,6 +57,21 @@ func InitRouter(r *gin.Engine) {
                         public.POST("/register", auth.Register)
                 }
 
+                // 集群节点间接口，使用节点签名认证
+                internal := v1.Group("/internal/cluster")
+                internal.Use(haApi.ClusterAuth())
+                {
+                        internal.POST("/agents/:agentId/commands", haApi.ForwardAgentCommand)
+                }
+
+                // 聊天平台回调，由各平台的签名或令牌认证
+                chatopsHooks := v1.Group("/chatops")
+                {
+                        chatopsHooks.POST("/telegram", chatopsApi.TelegramWebhook)
+                        chatopsHooks.POST("/dingtalk", chatopsApi.DingTalkWebhook)
+                        chatopsHooks.POST("/feishu", chatopsApi.FeishuWebhook)
+                }
+
                 // 需要认证的接口
                 authGroup := v1.Group("")
                 authGroup.Use(middleware.JWTAuth())
@@ -116,6 +142,11 @@ func InitRouter(r *gin.Engine) {
                                 // 编辑服务器 - 需要 server:edit 权限 (管理员)
                                 servers.PUT("/:id", middleware.RequirePermission("server:edit"), server.UpdateServer)
 
+                                // 依赖关系 - 用于告警拓扑抑制
+                                servers.GET("/:id/relations", server.GetServerRelations)
+                                servers.POST("/:id/relations", middleware.RequirePermission("server:edit"), server.CreateServerRelation)
+                                servers.DELETE("/:id/relations/:relationId", middleware.RequirePermission("server:edit"), server.DeleteServerRelation)
+
                                 // 删除服务器 - 需要 server:delete 权限 (管理员)
                                 servers.DELETE("/:id", middleware.RequirePermission("server:delete"), server.DeleteServer)
 
@@ -124,6 +155,8 @@ func InitRouter(r *gin.Engine) {
 
                                 // AI分析 - 需要 server:analyze 权限 (管理员、运维)
                                 servers.POST("/:id/analyze", middleware.RequirePermission("server:analyze"), server.AIAnalyze)
+                                servers.POST("/:id/analyze/stream", middleware.RequirePermission("server:analyze"), server.AIAnalyzeStream)
+                                servers.POST("/:id/diagnose", middleware.RequirePermission("server:analyze"), aiApi.StartDiagnosis)
                         }
 
                         // SSH 测试 - 需要 server:ssh 权限
@@ -164,13 +197,205 @@ func InitRouter(r *gin.Engine) {
                         {
                                 alerts.GET("", middleware.RequirePermission("alert:view"), server.GetAlerts)
                                 alerts.POST("/:id/acknowledge", middleware.RequirePermission("alert:handle"), server.AcknowledgeAlert)
+                                alerts.POST("/:id/resolve", middleware.RequirePermission("alert:handle"), server.ResolveAlert)
+                        }
+
+                        // ==================== 告警事件 ====================
+                        // 按指纹聚合的告警组，与 /incident 下人工处理的故障不是一回事
+                        alertGroups := authGroup.Group("/alert-groups")
+                        {
+                                alertGroups.GET("", middleware.RequirePermission("alert:view"), server.GetIncidents)
+                                alertGroups.GET("/:id", middleware.RequirePermission("alert:view"), server.GetIncident)
+                                alertGroups.POST("/:id/acknowledge", middleware.RequirePermission("alert:handle"), server.AcknowledgeIncident)
+                                alertGroups.POST("/:id/resolve", middleware.RequirePermission("alert:handle"), server.ResolveIncident)
+                        }
+
+                        // ==================== 静默与维护窗口 ====================
+                        silences := authGroup.Group("/silences")
+                        {
+                                silences.GET("", middleware.RequirePermission("alert:view"), server.GetSilences)
+                                silences.GET("/check", middleware.RequirePermission("alert:view"), server.CheckSilence)
+                                silences.POST("", middleware.RequirePermission("alert:handle"), server.CreateSilence)
+                                silences.DELETE("/:id", middleware.RequirePermission("alert:handle"), server.ExpireSilence)
+                        }
+                        maintenance := authGroup.Group("/maintenance-windows")
+                        {
+                                maintenance.GET("", middleware.RequirePermission("alert:view"), server.GetMaintenanceWindows)
+                                maintenance.POST("", middleware.RequirePermission("alert_rule:edit"), server.CreateMaintenanceWindow)
+                                maintenance.PUT("/:id", middleware.RequirePermission("alert_rule:edit"), server.UpdateMaintenanceWindow)
+                                maintenance.DELETE("/:id", middleware.RequirePermission("alert_rule:edit"), server.DeleteMaintenanceWindow)
+                        }
+
+                        // ==================== 抑制规则 ====================
+                        inhibitRules := authGroup.Group("/inhibit-rules")
+                        {
+                                inhibitRules.GET("", middleware.RequirePermission("alert_rule:view"), server.GetInhibitRules)
+                                inhibitRules.POST("", middleware.RequirePermission("alert_rule:edit"), server.CreateInhibitRule)
+                                inhibitRules.PUT("/:id", middleware.RequirePermission("alert_rule:edit"), server.UpdateInhibitRule)
+                                inhibitRules.DELETE("/:id", middleware.RequirePermission("alert_rule:edit"), server.DeleteInhibitRule)
+                        }
+
+                        // ==================== 通知路由 ====================
+                        notifyRoutes := authGroup.Group("/notify-routes")
+                        {
+                                notifyRoutes.GET("", middleware.RequirePermission("alert:config"), server.GetNotifyRoutes)
+                                notifyRoutes.POST("", middleware.RequirePermission("alert:config"), server.CreateNotifyRoute)
+                                notifyRoutes.POST("/test", middleware.RequirePermission("alert:config"), server.TestNotifyRoute)
+                                notifyRoutes.PUT("/:id", middleware.RequirePermission("alert:config"), server.UpdateNotifyRoute)
+                                notifyRoutes.DELETE("/:id", middleware.RequirePermission("alert:config"), server.DeleteNotifyRoute)
+                        }
+                        notifyReceivers := authGroup.Group("/notify-receivers")
+                        {
+                                notifyReceivers.GET("", middleware.RequirePermission("alert:config"), server.GetNotifyReceivers)
+                                notifyReceivers.POST("", middleware.RequirePermission("alert:config"), server.CreateNotifyReceiver)
+                                notifyReceivers.PUT("/:id", middleware.RequirePermission("alert:config"), server.UpdateNotifyReceiver)
+                                notifyReceivers.DELETE("/:id", middleware.RequirePermission("alert:config"), server.DeleteNotifyReceiver)
+                        }
+                        notifyChannels := authGroup.Group("/notify-channels")
+                        {
+                                notifyChannels.GET("", middleware.RequirePermission("alert:config"), server.GetNotifyChannels)
+                                notifyChannels.GET("/types", middleware.RequirePermission("alert:config"), server.GetNotifyChannelTypes)
+                                notifyChannels.POST("", middleware.RequirePermission("alert:config"), server.CreateNotifyChannel)
+                                notifyChannels.PUT("/:id", middleware.RequirePermission("alert:config"), server.UpdateNotifyChannel)
+                                notifyChannels.DELETE("/:id", middleware.RequirePermission("alert:config"), server.DeleteNotifyChannel)
+                                notifyChannels.POST("/:id/test", middleware.RequirePermission("alert:config"), server.TestNotifyChannel)
+                        }
+                        chatIdentities := authGroup.Group("/chatops/identities")
+                        {
+                                chatIdentities.GET("", middleware.RequirePermission("user:view"), chatopsApi.GetIdentities)
+                                chatIdentities.POST("", middleware.RequirePermission("user:edit"), chatopsApi.CreateIdentity)
+                                chatIdentities.PUT("/:id", middleware.RequirePermission("user:edit"), chatopsApi.UpdateIdentity)
+                                chatIdentities.DELETE("/:id", middleware.RequirePermission("user:edit"), chatopsApi.DeleteIdentity)
+                        }
+                        notifyTemplates := authGroup.Group("/notify-templates")
+                        {
+                                notifyTemplates.GET("", middleware.RequirePermission("alert:config"), server.GetNotifyTemplates)
+                                notifyTemplates.GET("/builtin", middleware.RequirePermission("alert:config"), server.GetBuiltinNotifyTemplate)
+                                notifyTemplates.POST("", middleware.RequirePermission("alert:config"), server.CreateNotifyTemplate)
+                                notifyTemplates.POST("/preview", middleware.RequirePermission("alert:config"), server.PreviewNotifyTemplate)
+                                notifyTemplates.PUT("/:id", middleware.RequirePermission("alert:config"), server.UpdateNotifyTemplate)
+                                notifyTemplates.DELETE("/:id", middleware.RequirePermission("alert:config"), server.DeleteNotifyTemplate)
+                        }
+                        notifyOutbox := authGroup.Group("/notify-outbox")
+                        {
+                                notifyOutbox.GET("", middleware.RequirePermission("alert:view"), server.GetOutboxMessages)
+                                notifyOutbox.GET("/stats", middleware.RequirePermission("alert:view"), server.GetOutboxStats)
+                                notifyOutbox.POST("/:id/retry", middleware.RequirePermission("alert:config"), server.RetryOutboxMessage)
+                                notifyOutbox.DELETE("/:id", middleware.RequirePermission("alert:config"), server.DiscardOutboxMessage)
+                        }
+
+                        // ==================== 拨测 ====================
+                        synthetic := authGroup.Group("/synthetic")
+                        {
+                                synthetic.GET("/checks", middleware.RequirePermission("alert:view"), syntheticApi.GetChecks)
+                                synthetic.GET("/checks/:id", middleware.RequirePermission("alert:view"), syntheticApi.GetCheck)
+                                synthetic.POST("/checks", middleware.RequirePermission("alert:config"), syntheticApi.CreateCheck)
+                                synthetic.PUT("/checks/:id", middleware.RequirePermission("alert:config"), syntheticApi.UpdateCheck)
+                                synthetic.DELETE("/checks/:id", middleware.RequirePermission("alert:config"), syntheticApi.DeleteCheck)
+                                synthetic.POST("/checks/:id/run", middleware.RequirePermission("alert:config"), syntheticApi.RunCheck)
+                                synthetic.GET("/checks/:id/results", middleware.RequirePermission("alert:view"), syntheticApi.GetResults)
+                                synthetic.GET("/checks/:id/availability", middleware.RequirePermission("alert:view"), syntheticApi.GetAvailability)
+                                synthetic.GET("/validate", middleware.RequirePermission("alert:view"), syntheticApi.ValidateOptimization)
+                        }
+
+                        // ==================== SLO ====================
+                        sloGroup := authGroup.Group("/slo")
+                        {
+                                sloGroup.GET("/slos", middleware.RequirePermission("alert:view"), sloApi.GetSLOs)
+                                sloGroup.GET("/slos/:id", middleware.RequirePermission("alert:view"), sloApi.GetSLO)
+                                sloGroup.POST("/slos", middleware.RequirePermission("alert:config"), sloApi.CreateSLO)
+                                sloGroup.PUT("/slos/:id", middleware.RequirePermission("alert:config"), sloApi.UpdateSLO)
+                                sloGroup.DELETE("/slos/:id", middleware.RequirePermission("alert:config"), sloApi.DeleteSLO)
+                                sloGroup.GET("/slos/:id/report", middleware.RequirePermission("alert:view"), sloApi.GetReport)
+                                sloGroup.GET("/gate", middleware.RequirePermission("alert:view"), sloApi.CheckGate)
+                        }
+
+                        // ==================== 状态页 ====================
+                        statusPage := authGroup.Group("/statuspage")
+                        {
+                                statusPage.GET("/pages", middleware.RequirePermission("alert:view"), statuspageApi.GetPages)
+                                statusPage.GET("/pages/:id", middleware.RequirePermission("alert:view"), statuspageApi.GetPage)
+                                statusPage.POST("/pages", middleware.RequirePermission("alert:config"), statuspageApi.CreatePage)
+                                statusPage.PUT("/pages/:id", middleware.RequirePermission("alert:config"), statuspageApi.UpdatePage)
+                                statusPage.DELETE("/pages/:id", middleware.RequirePermission("alert:config"), statuspageApi.DeletePage)
+                                statusPage.GET("/pages/:id/summary", middleware.RequirePermission("alert:view"), statuspageApi.GetPageSummary)
+
+                                statusPage.GET("/pages/:id/components", middleware.RequirePermission("alert:view"), statuspageApi.GetComponents)
+                                statusPage.POST("/pages/:id/components", middleware.RequirePermission("alert:config"), statuspageApi.CreateComponent)
+                                statusPage.PUT("/components/:id", middleware.RequirePermission("alert:config"), statuspageApi.UpdateComponent)
+                                statusPage.DELETE("/components/:id", middleware.RequirePermission("alert:config"), statuspageApi.DeleteComponent)
+
+                                statusPage.GET("/pages/:id/incidents", middleware.RequirePermission("alert:view"), statuspageApi.GetIncidents)
+                                statusPage.POST("/pages/:id/incidents", middleware.RequirePermission("alert:handle"), statuspageApi.CreateIncident)
+                                statusPage.GET("/incidents/:id", middleware.RequirePermission("alert:view"), statuspageApi.GetIncident)
+                                statusPage.PUT("/incidents/:id", middleware.RequirePermission("alert:handle"), statuspageApi.UpdateIncident)
+                                statusPage.POST("/incidents/:id/updates", middleware.RequirePermission("alert:handle"), statuspageApi.PostIncidentUpdate)
+                                statusPage.DELETE("/incidents/:id", middleware.RequirePermission("alert:handle"), statuspageApi.DeleteIncident)
+                        }
+
+                        // ==================== 事件时间线 ====================
+                        events := authGroup.Group("/events")
+                        {
+                                events.GET("", middleware.RequirePermission("alert:view"), eventApi.GetTimeline)
+                                events.GET("/changes", middleware.RequirePermission("alert:view"), eventApi.GetChanges)
+                                events.GET("/alerts/:id/changes", middleware.RequirePermission("alert:view"), eventApi.GetAlertChanges)
+                        }
+
+                        // ==================== 故障管理 ====================
+                        incidentGroup := authGroup.Group("/incident")
+                        {
+                                incidentGroup.GET("/incidents", middleware.RequirePermission("alert:view"), incidentApi.GetIncidents)
+                                incidentGroup.POST("/incidents", middleware.RequirePermission("alert:handle"), incidentApi.CreateIncident)
+                                incidentGroup.GET("/incidents/:id", middleware.RequirePermission("alert:view"), incidentApi.GetIncident)
+                                incidentGroup.PUT("/incidents/:id", middleware.RequirePermission("alert:handle"), incidentApi.UpdateIncident)
+                                incidentGroup.DELETE("/incidents/:id", middleware.RequirePermission("alert:handle"), incidentApi.DeleteIncident)
+
+                                incidentGroup.POST("/incidents/:id/status", middleware.RequirePermission("alert:handle"), incidentApi.PostStatus)
+                                incidentGroup.POST("/incidents/:id/notes", middleware.RequirePermission("alert:handle"), incidentApi.AddNote)
+                                incidentGroup.PUT("/incidents/:id/severity", middleware.RequirePermission("alert:handle"), incidentApi.SetSeverity)
+                                incidentGroup.PUT("/incidents/:id/roles", middleware.RequirePermission("alert:handle"), incidentApi.AssignRole)
+                                incidentGroup.GET("/incidents/:id/links", middleware.RequirePermission("alert:view"), incidentApi.GetLinks)
+                                incidentGroup.POST("/incidents/:id/links", middleware.RequirePermission("alert:handle"), incidentApi.AddLink)
+                                incidentGroup.GET("/incidents/:id/timeline", middleware.RequirePermission("alert:view"), incidentApi.GetTimeline)
+
+                                incidentGroup.GET("/incidents/:id/postmortem", middleware.RequirePermission("alert:view"), incidentApi.GetPostmortem)
+                                incidentGroup.PUT("/incidents/:id/postmortem", middleware.RequirePermission("alert:handle"), incidentApi.SavePostmortem)
+                                incidentGroup.POST("/incidents/:id/postmortem/generate", middleware.RequirePermission("alert:handle"), incidentApi.GeneratePostmortem)
+                                incidentGroup.GET("/incidents/:id/postmortem/export", middleware.RequirePermission("alert:view"), incidentApi.ExportPostmortem)
+                        }
+
+                        // ==================== 值班与升级 ====================
+                        oncall := authGroup.Group("/oncall")
+                        {
+                                oncall.GET("/current", middleware.RequirePermission("alert:view"), oncallApi.GetCurrentOnCall)
+
+                                oncall.GET("/schedules", middleware.RequirePermission("alert:view"), oncallApi.GetSchedules)
+                                oncall.POST("/schedules", middleware.RequirePermission("alert:config"), oncallApi.CreateSchedule)
+                                oncall.PUT("/schedules/:id", middleware.RequirePermission("alert:config"), oncallApi.UpdateSchedule)
+                                oncall.DELETE("/schedules/:id", middleware.RequirePermission("alert:config"), oncallApi.DeleteSchedule)
+                                oncall.GET("/schedules/:id/oncall", middleware.RequirePermission("alert:view"), oncallApi.GetScheduleOnCall)
+
+                                oncall.GET("/schedules/:id/overrides", middleware.RequirePermission("alert:view"), oncallApi.GetOverrides)
+                                oncall.POST("/schedules/:id/overrides", middleware.RequirePermission("alert:handle"), oncallApi.CreateOverride)
+                                oncall.DELETE("/overrides/:id", middleware.RequirePermission("alert:handle"), oncallApi.DeleteOverride)
+
+                                oncall.GET("/policies", middleware.RequirePermission("alert:view"), oncallApi.GetPolicies)
+                                oncall.POST("/policies", middleware.RequirePermission("alert:config"), oncallApi.CreatePolicy)
+                                oncall.PUT("/policies/:id", middleware.RequirePermission("alert:config"), oncallApi.UpdatePolicy)
+                                oncall.DELETE("/policies/:id", middleware.RequirePermission("alert:config"), oncallApi.DeletePolicy)
+
+                                oncall.GET("/escalations", middleware.RequirePermission("alert:view"), oncallApi.GetEscalations)
                         }
 
                         // ==================== 检测规则 ====================
                         rules := authGroup.Group("/rules")
                         {
                                 rules.GET("", middleware.RequirePermission("alert_rule:view"), server.GetRules)
+                                rules.GET("/status", middleware.RequirePermission("alert_rule:view"), server.GetRuleStatus)
+                                rules.POST("", middleware.RequirePermission("alert_rule:edit"), server.CreateRule)
+                                rules.POST("/test", middleware.RequirePermission("alert_rule:view"), server.TestRule)
                                 rules.PUT("/:id", middleware.RequirePermission("alert_rule:edit"), server.UpdateRule)
+                                rules.DELETE("/:id", middleware.RequirePermission("alert_rule:edit"), server.DeleteRule)
                         }
 
                         // ==================== 自动操作 ====================
@@ -189,6 +414,19 @@ func InitRouter(r *gin.Engine) {
                                 decisions.POST("/:id/execute", middleware.RequirePermission("ai:execute"), server.ExecuteDecision)
                         }
 
+                        // ==================== 大模型提供方 ====================
+                        aiGroup := authGroup.Group("/ai")
+                        {
+                                aiGroup.GET("/providers", middleware.RequirePermission("ai:config"), aiApi.GetProviders)
+                                aiGroup.GET("/routes", middleware.RequirePermission("ai:config"), aiApi.GetRoutes)
+
+                                // 多步诊断
+                                aiGroup.GET("/diagnose/tools", middleware.RequirePermission("ai:analyze"), aiApi.GetDiagnoseTools)
+                                aiGroup.GET("/diagnoses", middleware.RequirePermission("ai:analyze"), aiApi.GetDiagnoses)
+                                aiGroup.GET("/diagnoses/:id", middleware.RequirePermission("ai:analyze"), aiApi.GetDiagnosis)
+                                aiGroup.POST("/diagnoses/:id/cancel", middleware.RequirePermission("server:analyze"), aiApi.CancelDiagnosis)
+                        }
+
                         // ==================== Kubernetes 管理 ====================
                         k8s := authGroup.Group("/kubernetes")
                         {
@@ -438,6 +676,7 @@ func InitRouter(r *gin.Engine) {
                                 agentGroup.POST("/:id/disable", middleware.RequirePermission("agent:operate"), agentApi.DisableAgent)
                                 agentGroup.POST("/:id/enable", middleware.RequirePermission("agent:operate"), agentApi.EnableAgent)
                                 agentGroup.POST("/batch", middleware.RequirePermission("agent:operate"), agentApi.BatchOperation)
+                                agentGroup.POST("/:id/command", middleware.RequirePermission("agent:operate"), agentApi.ExecuteCommand)
                                 agentGroup.POST("/upgrades", middleware.RequirePermission("agent:upgrade"), agentApi.CreateUpgradeTask)
                                 agentGroup.POST("/upgrades/batch", middleware.RequirePermission("agent:upgrade"), agentApi.CreateBatchUpgrade)
                                 agentGroup.POST("/upgrades/:id/execute", middleware.RequirePermission("agent:upgrade"), agentApi.ExecuteUpgrade)
@@ -470,6 +709,7 @@ func InitRouter(r *gin.Engine) {
                                 haGroup.GET("/failover", middleware.RequirePermission("ha:view"), haApi.GetFailoverRecords)
                                 haGroup.GET("/events", middleware.RequirePermission("ha:view"), haApi.GetClusterEvents)
                                 haGroup.GET("/tasks/running", middleware.RequirePermission("ha:view"), haApi.GetRunningTasks)
+                                haGroup.GET("/agents", middleware.RequirePermission("ha:view"), haApi.GetAgentLocations)
 
                                 // 操作权限 (管理员)
                                 haGroup.POST("/nodes/:id/enable", middleware.RequirePermission("ha:operate"), haApi.EnableNode)
@@ -500,6 +740,15 @@ func InitRouter(r *gin.Engine) {
                                 costApi.RegisterRoutes(costGroup, costApi.NewHandler())
                         }
 
+                        // ==================== 指标查询 ====================
+                        // Prometheus 兼容查询接口，租户用户只能查询所属租户的服务器
+                        metricsGroup := authGroup.Group("/metrics",
+                                middleware.RequirePermission("monitor:view"),
+                                tenantService.NewIsolationService(global.DB).UserTenantMiddleware())
+                        {
+                                metricsApi.RegisterRoutes(metricsGroup, metricsApi.NewHandler())
+                        }
+
                         // ==================== 多租户系统 ====================
                         tenantGroup := authGroup.Group("")
                         {
@@ -519,4 +768,14 @@ func InitRouter(r *gin.Engine) {
                         "message": "Yunwei Server is running",
                 })
         })
+
+        // 服务自身 Prometheus 指标，需配置抓取令牌
+        if token := config.CONFIG.System.MetricsToken; token != "" {
+                r.GET("/metrics", middleware.BearerToken(token), gin.WrapH(promhttp.Handler()))
+        }
+
+        // 公开状态页，绑定了自定义域名的状态页通过 NoRoute 按 Host 访问
+        r.GET("/status/:slug", statuspageApi.PublicPage)
+        r.GET("/status/:slug/summary.json", statuspageApi.PublicSummary)
+        r.NoRoute(statuspageApi.CustomDomain)
 }
@@ -8,14 +8,14 @@ import (
 	"yunwei/global"
 	"yunwei/model/agent"
 	"yunwei/model/server"
-	"yunwei/service/notifier"
+	"yunwei/service/notify"
 )
 
 // HeartbeatMonitor 心跳监控器
 type HeartbeatMonitor struct {
 	heartbeatTimeout   time.Duration // 心跳超时时间
 	checkInterval      time.Duration // 检查间隔
-	notifier           *notifier.NotifierService
+	notifier           notify.Notifier
 	offlineAgents      map[uint]*OfflineContext // 离线 Agent 上下文
 	mu                 sync.RWMutex
 	stopCh             chan struct{}
@@ -50,7 +50,7 @@ func (m *HeartbeatMonitor) SetCheckInterval(interval time.Duration) {
 }
 
 // SetNotifier 设置通知服务
-func (m *HeartbeatMonitor) SetNotifier(n *notifier.NotifierService) {
+func (m *HeartbeatMonitor) SetNotifier(n notify.Notifier) {
 	m.notifier = n
 }
 
@@ -137,7 +137,7 @@ func (m *HeartbeatMonitor) handleAgentOnline(ag *agent.Agent, now time.Time) {
 
 		// 发送通知
 		if m.notifier != nil {
-			m.notifier.Broadcast(
+			m.notifier.SendMessage(
 				fmt.Sprintf("🟢 Agent 恢复上线 - %s", ag.ServerName),
 				fmt.Sprintf("Agent ID: %s\n版本: %s", ag.AgentID, ag.Version),
 			)
@@ -172,7 +172,7 @@ func (m *HeartbeatMonitor) handleAgentOffline(ag *agent.Agent, now time.Time) {
 
 		// 发送告警
 		if m.notifier != nil {
-			m.notifier.Broadcast(
+			m.notifier.SendMessage(
 				fmt.Sprintf("🔴 Agent 离线告警 - %s", ag.ServerName),
 				fmt.Sprintf("Agent ID: %s\n离线时间: %s\n离线次数: %d",
 					ag.AgentID, now.Format("2006-01-02 15:04:05"), ag.OfflineCount),
@@ -280,7 +280,7 @@ func (m *HeartbeatMonitor) attemptRecovery(ag *agent.Agent) {
 
 	// 发送通知
 	if m.notifier != nil {
-		m.notifier.Broadcast(
+		m.notifier.SendMessage(
 			fmt.Sprintf("✅ Agent 自动恢复成功 - %s", ag.ServerName),
 			fmt.Sprintf("Agent ID: %s\n恢复时间: %s", ag.AgentID, endTime.Format("2006-01-02 15:04:05")),
 		)
@@ -373,7 +373,7 @@ func (m *HeartbeatMonitor) ProcessHeartbeat(req *HeartbeatRequest) (*HeartbeatRe
 
 		// 发送通知
 		if m.notifier != nil {
-			m.notifier.Broadcast(
+			m.notifier.SendMessage(
 				fmt.Sprintf("🟢 Agent 恢复上线 - %s", ag.ServerName),
 				fmt.Sprintf("Agent ID: %s\n版本: %s", ag.AgentID, ag.Version),
 			)
@@ -4,6 +4,7 @@ import (
         "crypto/md5"
         "encoding/hex"
         "encoding/json"
+        "errors"
         "fmt"
         "strings"
         "time"
@@ -11,16 +12,21 @@ import (
         "yunwei/global"
         "yunwei/model/agent"
         "yunwei/model/server"
-        "yunwei/service/notifier"
+        "yunwei/service/notify"
+
+        "gorm.io/gorm"
 )
 
+// ErrServerBound 服务器已绑定其他 Agent
+var ErrServerBound = errors.New("服务器已绑定其他 Agent，请先删除原 Agent")
+
 // AgentManager Agent 管理器
 type AgentManager struct {
         versionManager   *VersionManager
         upgradeEngine    *UpgradeEngine
         grayRelease      *GrayReleaseEngine
         heartbeatMonitor *HeartbeatMonitor
-        notifier         *notifier.NotifierService
+        notifier         notify.Notifier
 }
 
 // NewAgentManager 创建 Agent 管理器
@@ -35,7 +41,7 @@ func NewAgentManager() *AgentManager {
                 upgradeEngine:    ue,
                 grayRelease:      gr,
                 heartbeatMonitor: hm,
-                notifier:         notifier.NewNotifierService(),
+                notifier:         notify.Default(),
         }
 
         // 设置通知服务
@@ -83,9 +89,11 @@ func (m *AgentManager) RegisterAgent(req *RegisterRequest) (*agent.Agent, error)
                 return &existing, nil
         }
 
-        // 查找关联的服务器
-        var srv server.Server
-        err = global.DB.Where("host = ? OR agent_id = ?", req.IP, req.AgentID).First(&srv).Error
+        // 查找关联的服务器，已绑定其他 Agent 的服务器不能凭注册请求改绑
+        srv, err := m.FindServer(req.AgentID, req.IP)
+        if errors.Is(err, ErrServerBound) {
+                return nil, err
+        }
 
         agentSecret := m.generateSecret()
 
@@ -112,7 +120,7 @@ func (m *AgentManager) RegisterAgent(req *RegisterRequest) (*agent.Agent, error)
                 srv.AgentOnline = true
                 now := time.Now()
                 srv.LastHeartbeat = &now
-                global.DB.Save(&srv)
+                global.DB.Save(srv)
         }
 
         // 解析版本号
@@ -132,7 +140,7 @@ func (m *AgentManager) RegisterAgent(req *RegisterRequest) (*agent.Agent, error)
 
         // 发送通知
         if m.notifier != nil {
-                m.notifier.Broadcast(
+                m.notifier.SendMessage(
                         fmt.Sprintf("🆕 Agent 新注册 - %s", ag.ServerName),
                         fmt.Sprintf("Agent ID: %s\n平台: %s/%s\n版本: %s",
                                 ag.AgentID, ag.Platform, ag.Arch, ag.Version),
@@ -142,6 +150,29 @@ func (m *AgentManager) RegisterAgent(req *RegisterRequest) (*agent.Agent, error)
         return ag, nil
 }
 
+// FindServer 查找 Agent 对应的服务器：优先按 AgentID，其次按 IP 匹配
+// IP 匹配到的服务器仍绑定着其他已存在的 Agent 时返回 ErrServerBound
+func (m *AgentManager) FindServer(agentID, ip string) (*server.Server, error) {
+        var srv server.Server
+        if err := global.DB.Where("agent_id = ?", agentID).First(&srv).Error; err == nil {
+                return &srv, nil
+        }
+        if ip == "" {
+                return nil, gorm.ErrRecordNotFound
+        }
+        if err := global.DB.Where("host = ?", ip).First(&srv).Error; err != nil {
+                return nil, err
+        }
+        if srv.AgentID != "" && srv.AgentID != agentID {
+                var count int64
+                global.DB.Model(&agent.Agent{}).Where("agent_id = ?", srv.AgentID).Count(&count)
+                if count > 0 {
+                        return nil, ErrServerBound
+                }
+        }
+        return &srv, nil
+}
+
 // RegisterRequest 注册请求
 type RegisterRequest struct {
         AgentID  string `json:"agentId" binding:"required"`
@@ -243,6 +274,10 @@ func (m *AgentManager) DeleteAgent(id uint) error {
         global.DB.Where("agent_id = ?", id).Delete(&agent.AgentMetric{})
         global.DB.Where("agent_id = ?", id).Delete(&agent.AgentRecoverRecord{})
 
+        // 解除服务器绑定，之后新 Agent 可以重新注册到该服务器
+        global.DB.Model(&server.Server{}).Where("agent_id = ?", ag.AgentID).
+                Updates(map[string]interface{}{"agent_id": "", "agent_online": false})
+
         return global.DB.Delete(&agent.Agent{}, id).Error
 }
 
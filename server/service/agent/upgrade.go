@@ -7,13 +7,14 @@ import (
 
         "yunwei/global"
         "yunwei/model/agent"
-        "yunwei/service/notifier"
+        "yunwei/service/event"
+        "yunwei/service/notify"
 )
 
 // UpgradeEngine 升级引擎
 type UpgradeEngine struct {
         versionManager *VersionManager
-        notifier       *notifier.NotifierService
+        notifier       notify.Notifier
         mu             sync.RWMutex
         pendingTasks   map[uint]*agent.AgentUpgradeTask // 正在进行的升级任务
 }
@@ -22,13 +23,13 @@ type UpgradeEngine struct {
 func NewUpgradeEngine() *UpgradeEngine {
         return &UpgradeEngine{
                 versionManager: NewVersionManager(""),
-                notifier:       notifier.NewNotifierService(),
+                notifier:       notify.Default(),
                 pendingTasks:   make(map[uint]*agent.AgentUpgradeTask),
         }
 }
 
 // SetNotifier 设置通知服务
-func (e *UpgradeEngine) SetNotifier(n *notifier.NotifierService) {
+func (e *UpgradeEngine) SetNotifier(n notify.Notifier) {
         e.notifier = n
 }
 
@@ -251,6 +252,8 @@ func (e *UpgradeEngine) ExecuteUpgrade(taskID uint) error {
         e.pendingTasks[taskID] = &task
         e.mu.Unlock()
 
+        publishEvent(&task, "started", event.SeverityInfo, "开始")
+
         // 发送升级指令给 Agent (通过 gRPC 或 WebSocket)
         go e.sendUpgradeCommand(&ag, &task)
 
@@ -376,10 +379,11 @@ func (e *UpgradeEngine) HandleUpgradeSuccess(taskID uint, output string) error {
 
         // 记录事件
         e.recordTaskEvent(taskID, "success", nil, "agent", "升级成功")
+        publishEvent(&task, "succeeded", event.SeverityInfo, "成功")
 
         // 发送通知
         if e.notifier != nil {
-                e.notifier.Broadcast(
+                e.notifier.SendMessage(
                         fmt.Sprintf("✅ Agent 升级成功 - %s", task.ServerName),
                         fmt.Sprintf("版本: %s -> %s\n耗时: %dms", task.FromVersion, task.ToVersion, task.Duration),
                 )
@@ -419,10 +423,11 @@ func (e *UpgradeEngine) handleUpgradeFailed(task *agent.AgentUpgradeTask, errMsg
         e.recordTaskEvent(task.ID, "failed", map[string]interface{}{
                 "error": errMsg,
         }, "system", "升级失败")
+        publishEvent(task, "failed", event.SeverityWarning, "失败")
 
         // 发送通知
         if e.notifier != nil {
-                e.notifier.Broadcast(
+                e.notifier.SendMessage(
                         fmt.Sprintf("❌ Agent 升级失败 - %s", task.ServerName),
                         fmt.Sprintf("版本: %s -> %s\n错误: %s", task.FromVersion, task.ToVersion, errMsg),
                 )
@@ -455,6 +460,25 @@ func (e *UpgradeEngine) recordTaskEvent(taskID uint, eventType string, data map[
         // TODO: 实现事件记录
 }
 
+// publishEvent 升级任务状态变化写入事件流，回滚任务与升级任务共用
+func publishEvent(task *agent.AgentUpgradeTask, action, severity, result string) {
+        kind := "升级"
+        if task.TaskType == "rollback" {
+                kind = "回滚"
+        }
+        event.Publish(&event.Event{
+                Type:     event.TypeAgentUpgrade,
+                Action:   action,
+                Severity: severity,
+                Title:    fmt.Sprintf("%s Agent %s%s: %s -> %s", task.ServerName, kind, result, task.FromVersion, task.ToVersion),
+                Detail:   task.Error,
+                Labels:   event.MakeLabels("from", task.FromVersion, "to", task.ToVersion, "task_type", task.TaskType),
+                Servers:  []uint{task.ServerID},
+                Source:   "agent_upgrade_task",
+                SourceID: task.ID,
+        })
+}
+
 // ==================== 升级回滚 ====================
 
 // RollbackUpgrade 回滚升级
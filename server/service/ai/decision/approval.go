@@ -0,0 +1,48 @@
+package decision
+
+import (
+	"errors"
+	"time"
+
+	"yunwei/global"
+)
+
+// ErrNotPending 决策不存在或已被审批
+var ErrNotPending = errors.New("决策不存在或已处理")
+
+// Approve 批准待审批的决策并发布审批事件，控制台和 ChatOps 共用
+func Approve(id, userID uint, username string) (*AIDecision, error) {
+	return review(id, "approved", username, map[string]interface{}{
+		"status":      DecisionStatusApproved,
+		"approved_by": userID,
+		"approved_at": time.Now(),
+	})
+}
+
+// Reject 拒绝待审批的决策
+func Reject(id, userID uint, username, reason string) (*AIDecision, error) {
+	return review(id, "rejected", username, map[string]interface{}{
+		"status":        DecisionStatusRejected,
+		"rejected_by":   userID,
+		"rejected_at":   time.Now(),
+		"reject_reason": reason,
+	})
+}
+
+// review 只更新仍在等待审批的决策，多人同时审批或旧消息的按钮不会覆盖已有结果
+func review(id uint, action, actor string, updates map[string]interface{}) (*AIDecision, error) {
+	res := global.DB.Model(&AIDecision{}).
+		Where("id = ? AND status = ?", id, DecisionStatusPending).Updates(updates)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNotPending
+	}
+	var dec AIDecision
+	if err := global.DB.First(&dec, id).Error; err != nil {
+		return nil, err
+	}
+	PublishEvent(&dec, action, actor)
+	return &dec, nil
+}
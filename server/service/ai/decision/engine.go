@@ -1,6 +1,7 @@
 package decision
 
 import (
+        "context"
         "encoding/json"
         "fmt"
         "strings"
@@ -9,7 +10,9 @@ import (
         "yunwei/model/server"
         "yunwei/service/ai/llm"
         "yunwei/service/detector"
+        "yunwei/service/event"
         "yunwei/service/optimizer"
+        "yunwei/service/silence"
 )
 
 // DecisionType 决策类型
@@ -33,6 +36,16 @@ const (
         DecisionStatusFailed    DecisionStatus = "failed"
 )
 
+// DecisionFormat 要求模型按此 JSON 格式给出结论，由 Decide 解析
+const DecisionFormat = `{
+  "summary": "一句话总结当前状态",
+  "analysis": "详细分析问题原因",
+  "suggestions": "优化建议列表",
+  "commands": ["可执行的Shell命令1", "可执行的Shell命令2"],
+  "risk_level": "low/medium/high",
+  "auto_execute": true/false
+}`
+
 // AIDecision AI 决策记录
 type AIDecision struct {
         ID        uint      `json:"id" gorm:"primarykey"`
@@ -73,14 +86,14 @@ func (AIDecision) TableName() string {
 
 // Engine 决策引擎
 type Engine struct {
-        llmClient   *llm.GLM5Client
+        llmClient   llm.Provider
         detector    *detector.Detector
         optimizer   *optimizer.Optimizer
         actionGen   *optimizer.AIActionGenerator
 }
 
 // NewEngine 创建决策引擎
-func NewEngine(llmClient *llm.GLM5Client) *Engine {
+func NewEngine(llmClient llm.Provider) *Engine {
         return &Engine{
                 llmClient: llmClient,
                 detector:  detector.NewDetector(),
@@ -161,15 +174,20 @@ func (e *Engine) Analyze(summary ServerStatusSummary, alerts []detector.Detectio
         // 构建 prompt
         prompt := e.buildAnalysisPrompt(summary, alerts)
 
-        // 调用 GLM5
+        // 调用大模型
         response, err := e.llmClient.QuickChat(prompt)
         if err != nil {
                 return nil, fmt.Errorf("AI分析失败: %w", err)
         }
 
+        return e.Decide(summary.ServerID, response, alerts), nil
+}
+
+// Decide 由按 DecisionFormat 回复的模型结论生成决策，并按告警级别和静默决定是否自动执行
+func (e *Engine) Decide(serverID uint, response string, alerts []detector.DetectionResult) *AIDecision {
         // 解析响应
         decision := &AIDecision{
-                ServerID: summary.ServerID,
+                ServerID: serverID,
                 Type:     DecisionTypeManual, // 默认需要人工确认
                 Status:   DecisionStatusPending,
         }
@@ -188,7 +206,15 @@ func (e *Engine) Analyze(summary ServerStatusSummary, alerts []detector.Detectio
                 }
         }
 
-        return decision, nil
+        // 静默或维护窗口内不自动执行，改为人工确认
+        if decision.Type == DecisionTypeAuto {
+                if m := silence.GetService().AutoExecSuppressed(serverID, time.Now()); m != nil {
+                        decision.Type = DecisionTypeManual
+                        decision.Suggestions = strings.TrimSpace(decision.Suggestions + "\n处于" + m.String() + "，已转为人工确认")
+                }
+        }
+
+        return decision
 }
 
 // buildAnalysisPrompt 构建分析提示词
@@ -222,22 +248,30 @@ func (e *Engine) buildAnalysisPrompt(summary ServerStatusSummary, alerts []detec
                 }
         }
 
+        // 近期变更，帮助判断问题是否由部署、配置修改等引起
+        if changes := recentChanges(summary.ServerID); changes != "" {
+                sb.WriteString("\n## 最近变更\n")
+                sb.WriteString(changes)
+        }
+
         // 请求格式
         sb.WriteString("\n## 请按以下格式回复\n")
         sb.WriteString("```json\n")
-        sb.WriteString(`{
-  "summary": "一句话总结当前状态",
-  "analysis": "详细分析问题原因",
-  "suggestions": "优化建议列表",
-  "commands": ["可执行的Shell命令1", "可执行的Shell命令2"],
-  "risk_level": "low/medium/high",
-  "auto_execute": true/false
-}` + "\n")
+        sb.WriteString(DecisionFormat + "\n")
         sb.WriteString("```\n")
 
         return sb.String()
 }
 
+// recentChanges 服务器在默认变更窗口内的变更摘要，没有变更或查询失败时返回空
+func recentChanges(serverID uint) string {
+        changes, err := event.GetService().ChangesBefore(serverID, "", time.Now(), 0)
+        if err != nil || len(changes) == 0 {
+                return ""
+        }
+        return event.Summarize(changes)
+}
+
 // parseAIResponse 解析AI响应
 func (e *Engine) parseAIResponse(response string, decision *AIDecision) {
         // 提取JSON
@@ -353,6 +387,28 @@ func (e *Engine) hasDangerousCommands(commandsJSON string) bool {
 
 // QuickAnalyze 快速分析（简化版）
 func (e *Engine) QuickAnalyze(srv *server.Server, metric *server.ServerMetric) (*AIDecision, error) {
+        response, err := e.llmClient.QuickChat(e.quickPrompt(srv, metric))
+        if err != nil {
+                return nil, err
+        }
+        return e.quickDecision(srv, response), nil
+}
+
+// QuickAnalyzeStream 流式快速分析，模型输出的每段内容回调 onDelta，输出结束后解析出决策；
+// ctx 取消时中止并返回 ctx 的错误
+func (e *Engine) QuickAnalyzeStream(ctx context.Context, srv *server.Server, metric *server.ServerMetric, onDelta llm.StreamHandler) (*AIDecision, error) {
+        resp, err := e.llmClient.ChatStream(ctx, []llm.Message{{Role: "user", Content: e.quickPrompt(srv, metric)}}, onDelta)
+        if err != nil {
+                return nil, err
+        }
+        if len(resp.Choices) == 0 {
+                return nil, llm.ErrNoResponse
+        }
+        return e.quickDecision(srv, resp.Choices[0].Message.Content), nil
+}
+
+// quickPrompt 快速分析的提示词
+func (e *Engine) quickPrompt(srv *server.Server, metric *server.ServerMetric) string {
         _ = e.GenerateSummary(srv, metric, nil) // summary not used in quick analyze
 
         prompt := fmt.Sprintf(`当前服务器状态如下：
@@ -366,12 +422,14 @@ Docker容器数: %d
 2. 提供具体可执行的命令
 3. 说明命令的作用`,
                 metric.CPUUsage, metric.MemoryUsage, metric.Load1, 0)
-
-        response, err := e.llmClient.QuickChat(prompt)
-        if err != nil {
-                return nil, err
+        if changes := recentChanges(srv.ID); changes != "" {
+                prompt += "\n\n最近变更（请判断问题是否与这些变更有关）：\n" + changes
         }
+        return prompt
+}
 
+// quickDecision 由模型回复生成待确认的决策
+func (e *Engine) quickDecision(srv *server.Server, response string) *AIDecision {
         decision := &AIDecision{
                 ServerID:  srv.ID,
                 Type:      DecisionTypeManual,
@@ -387,7 +445,7 @@ Docker容器数: %d
                 decision.Commands = string(commandsJSON)
         }
 
-        return decision, nil
+        return decision
 }
 
 // ExecuteDecision 执行决策
@@ -415,10 +473,41 @@ func (e *Engine) ExecuteDecision(decision *AIDecision, executor CommandExecutor)
         decision.ExecutedAt = &now
         decision.ExecutionResult = strings.Join(results, "\n---\n")
         decision.Status = DecisionStatusExecuted
+        PublishEvent(decision, "executed", "")
 
         return nil
 }
 
+// decisionActionText 决策事件动作的中文描述
+var decisionActionText = map[string]string{
+        "approved": "已批准",
+        "rejected": "已拒绝",
+        "executed": "已执行",
+}
+
+// PublishEvent 决策的审批和执行写入事件流，actor 为操作人，自动执行时为空
+func PublishEvent(decision *AIDecision, action, actor string) {
+        detail := decision.Commands
+        if action == "rejected" {
+                detail = decision.RejectReason
+        }
+        ev := &event.Event{
+                Type:     event.TypeAIDecision,
+                Action:   action,
+                Severity: event.SeverityInfo,
+                Title:    fmt.Sprintf("AI 决策 #%d %s: %s", decision.ID, decisionActionText[action], decision.Summary),
+                Detail:   detail,
+                Labels:   event.MakeLabels("decision_type", string(decision.Type)),
+                Source:   "ai_decision",
+                SourceID: decision.ID,
+                Actor:    actor,
+        }
+        if decision.ServerID > 0 {
+                ev.Servers = []uint{decision.ServerID}
+        }
+        event.Publish(ev)
+}
+
 // CommandExecutor 命令执行器接口
 type CommandExecutor interface {
         Execute(command string) (string, error)
@@ -0,0 +1,81 @@
+package diagnose
+
+import (
+	"time"
+
+	"yunwei/service/ai/decision"
+)
+
+// 诊断状态
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Diagnosis 一次多步诊断：模型先调用只读工具收集证据，再给出结论
+type Diagnosis struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"`
+	ServerID uint   `json:"serverId" gorm:"index"`
+	Question string `json:"question" gorm:"type:text"` // 发起人描述的现象，可为空
+
+	Status     string     `json:"status" gorm:"type:varchar(16);index"`
+	Provider   string     `json:"provider" gorm:"type:varchar(64)"`
+	MaxSteps   int        `json:"maxSteps"`  // 最多调用工具的次数
+	ToolCalls  int        `json:"toolCalls"` // 实际调用工具的次数
+	DecisionID uint       `json:"decisionId" gorm:"index"`
+	Error      string     `json:"error" gorm:"type:text"`
+	FinishedAt *time.Time `json:"finishedAt"`
+
+	CreatedBy uint   `json:"createdBy"`
+	Creator   string `json:"creator" gorm:"type:varchar(64)"`
+
+	Steps    []Step               `json:"steps,omitempty" gorm:"-"`
+	Decision *decision.AIDecision `json:"decision,omitempty" gorm:"-"`
+}
+
+func (Diagnosis) TableName() string {
+	return "ai_diagnoses"
+}
+
+// 步骤类型
+const (
+	StepTool    = "tool"    // 调用工具
+	StepInvalid = "invalid" // 回复不符合约定格式，已要求模型重新回复
+	StepFinal   = "final"   // 给出结论
+)
+
+// 工具调用结果
+const (
+	ResultSuccess   = "success"
+	ResultFailed    = "failed"
+	ResultForbidden = "forbidden" // 未通过只读命令检查，没有执行
+)
+
+// Step 诊断的一步，每次工具调用都记录参数、实际执行的命令和输出
+type Step struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	CreatedAt   time.Time `json:"createdAt"`
+	DiagnosisID uint      `json:"diagnosisId" gorm:"index"`
+	Seq         int       `json:"seq"`
+
+	Kind    string `json:"kind" gorm:"type:varchar(16)"`
+	Thought string `json:"thought" gorm:"type:text"` // 模型说明的调用理由
+	Tool    string `json:"tool" gorm:"type:varchar(32)"`
+	Args    string `json:"args" gorm:"type:text"`    // 工具参数(JSON)
+	Command string `json:"command" gorm:"type:text"` // 在服务器上执行的命令，不涉及服务器的工具为空
+	Output  string `json:"output" gorm:"type:text"`
+	Result  string `json:"result" gorm:"type:varchar(16)"`
+	Error   string `json:"error" gorm:"type:text"`
+
+	Duration int64 `json:"duration"` // 毫秒
+}
+
+func (Step) TableName() string {
+	return "ai_diagnosis_steps"
+}
@@ -0,0 +1,388 @@
+package diagnose
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// shellMeta 诊断命令只能是单条命令，不允许管道、重定向、命令替换和多条命令
+const shellMeta = ";|&<>`$\\\n\r"
+
+// safeToken 每个参数只能包含这些字符，排除引号、通配符、~ 和花括号等会被 shell 展开或改写的字符
+var safeToken = regexp.MustCompile(`^[\w.,:%+@=/-]+$`)
+
+// 选项是否带值
+const (
+	argNone     = iota // 不带值
+	argRequired        // 带值：--opt=v、--opt v、-o v、-ov
+	argOptional        // 值可选，只能写成 --opt=v 或 -ov
+)
+
+// optionSpec 命令允许的选项，键为去掉前导 - 的选项名
+type optionSpec map[string]int
+
+// readOnlyCommands 诊断可以执行的命令及其参数检查，未列出的命令一律拒绝。
+// 只看命令名不够：cat /etc/shadow、ss -K、docker inspect 都以可查看的命令开头，
+// 因此每个命令还要检查全部参数；less、more 需要终端交互，不在其中
+var readOnlyCommands = map[string]func(args []string) error{
+	"ps":         checkPS,
+	"id":         anyArgs,
+	"df":         anyArgs,
+	"uptime":     flagsExcept(nil),
+	"w":          flagsExcept(nil),
+	"uname":      flagsExcept(nil),
+	"whoami":     flagsExcept(nil),
+	"free":       flagsExcept(nil, "s", "seconds"),
+	"netstat":    flagsExcept(nil, "c", "continuous"),
+	"hostname":   flagsExcept(nil, "F", "file", "b", "boot"),
+	"date":       flagsExcept(dateFormat, "s", "set", "f", "file", "r", "reference"),
+	"ss":         flagsExcept(anyOperand, "K", "kill", "D", "diag", "E", "events", "F", "filter"),
+	"ip":         checkIP,
+	"cat":        logFiles(catOptions),
+	"head":       logFiles(lineOptions),
+	"tail":       logFiles(lineOptions),
+	"journalctl": checkJournalctl,
+	"systemctl":  checkSystemctl,
+	"docker":     checkDocker,
+}
+
+// checkReadOnly 命令须是 readOnlyCommands 中的命令，且每个参数都通过该命令的检查
+func checkReadOnly(command string) error {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return fmt.Errorf("%w: 命令为空", ErrForbidden)
+	}
+	if strings.ContainsAny(command, shellMeta) {
+		return fmt.Errorf("%w: 只能执行单条命令，不能使用管道、重定向和命令替换", ErrForbidden)
+	}
+	fields := strings.Fields(command)
+	check, ok := readOnlyCommands[fields[0]]
+	if !ok {
+		return fmt.Errorf("%w: %s 不在诊断命令白名单中", ErrForbidden, fields[0])
+	}
+	for _, f := range fields[1:] {
+		if !safeToken.MatchString(f) {
+			return fmt.Errorf("%w: 参数 %q 含有不允许的字符", ErrForbidden, f)
+		}
+	}
+	if err := check(fields[1:]); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrForbidden, fields[0], err)
+	}
+	return nil
+}
+
+// anyArgs 命令本身只读，参数不会读写文件或改变状态
+func anyArgs([]string) error { return nil }
+
+func anyOperand(string) error { return nil }
+
+// psValueOptions ps 中带值的选项，其后的参数是选项值而不是 BSD 风格的选项
+var psValueOptions = map[string]bool{
+	"-o": true, "-O": true, "-p": true, "-q": true, "-u": true, "-U": true, "-g": true, "-G": true,
+	"-C": true, "-t": true, "-s": true, "--pid": true, "--ppid": true, "--user": true, "--group": true,
+	"--format": true, "--sort": true, "--cols": true, "--columns": true, "--rows": true, "--lines": true,
+}
+
+// checkPS BSD 风格的 e 选项（如 ps auxe）会输出进程的环境变量，可能含有密钥
+func checkPS(args []string) error {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if psValueOptions[a] {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(a, "-") && strings.ContainsRune(a, 'e') {
+			return fmt.Errorf("%s 会输出进程的环境变量", a)
+		}
+	}
+	return nil
+}
+
+// dateFormat date 只接受 +FORMAT 形式的操作数，其他操作数会设置系统时间
+func dateFormat(arg string) error {
+	if !strings.HasPrefix(arg, "+") {
+		return fmt.Errorf("只能使用 +FORMAT 参数")
+	}
+	return nil
+}
+
+// flagsExcept 只允许选项，排除 forbidden 中的选项（短选项合并写法也会检查）。
+// operand 为 nil 时不允许非选项参数
+func flagsExcept(operand func(string) error, forbidden ...string) func([]string) error {
+	deny := make(map[string]bool, len(forbidden))
+	for _, f := range forbidden {
+		deny[f] = true
+	}
+	return func(args []string) error {
+		for _, a := range args {
+			switch {
+			case strings.HasPrefix(a, "--"):
+				name := strings.SplitN(a[2:], "=", 2)[0]
+				if deny[name] {
+					return fmt.Errorf("不允许 --%s", name)
+				}
+			case strings.HasPrefix(a, "-") && len(a) > 1:
+				for _, c := range a[1:] {
+					if deny[string(c)] {
+						return fmt.Errorf("不允许 -%c", c)
+					}
+				}
+			case operand == nil:
+				return fmt.Errorf("不允许参数 %s", a)
+			default:
+				if err := operand(a); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// parseOptions 按 spec 拆分参数，返回非选项参数；spec 中没有的选项一律拒绝
+func parseOptions(args []string, spec optionSpec) ([]string, error) {
+	var operands []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			return append(operands, args[i+1:]...), nil
+		case strings.HasPrefix(a, "--"):
+			parts := strings.SplitN(a[2:], "=", 2)
+			kind, ok := spec[parts[0]]
+			if !ok {
+				return nil, fmt.Errorf("不允许 --%s", parts[0])
+			}
+			switch {
+			case len(parts) == 2 && kind == argNone:
+				return nil, fmt.Errorf("--%s 不带值", parts[0])
+			case len(parts) == 1 && kind == argRequired:
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("--%s 缺少值", parts[0])
+				}
+				i++
+			}
+		case strings.HasPrefix(a, "-") && len(a) > 1:
+			for j := 1; j < len(a); j++ {
+				name := string(a[j])
+				kind, ok := spec[name]
+				if !ok {
+					return nil, fmt.Errorf("不允许 -%s", name)
+				}
+				if kind == argNone {
+					continue
+				}
+				// 其余字符是该选项的值
+				if j+1 < len(a) {
+					break
+				}
+				if kind == argRequired {
+					if i+1 >= len(args) {
+						return nil, fmt.Errorf("-%s 缺少值", name)
+					}
+					i++
+				}
+			}
+		default:
+			operands = append(operands, a)
+		}
+	}
+	return operands, nil
+}
+
+var (
+	lineOptions = optionSpec{
+		"n": argRequired, "lines": argRequired, "c": argRequired, "bytes": argRequired,
+		"q": argNone, "quiet": argNone, "silent": argNone, "v": argNone, "verbose": argNone,
+	}
+	catOptions = optionSpec{
+		"n": argNone, "number": argNone, "b": argNone, "number-nonblank": argNone,
+		"A": argNone, "show-all": argNone, "E": argNone, "show-ends": argNone,
+		"T": argNone, "show-tabs": argNone, "v": argNone, "show-nonprinting": argNone,
+		"s": argNone, "squeeze-blank": argNone, "e": argNone, "t": argNone,
+	}
+)
+
+// logFiles cat、head、tail 只能查看 .log 文件，每个文件参数都要检查；没有 -f 选项，不会持续跟踪
+func logFiles(spec optionSpec) func([]string) error {
+	return func(args []string) error {
+		files, err := parseOptions(args, spec)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("须指定 .log 文件")
+		}
+		for _, f := range files {
+			if !logPath.MatchString(f) || strings.Contains(f, "..") {
+				return fmt.Errorf("%s 不是 .log 文件的绝对路径", f)
+			}
+		}
+		return nil
+	}
+}
+
+var (
+	ipOptions = optionSpec{
+		"s": argNone, "stats": argNone, "statistics": argNone, "d": argNone, "details": argNone,
+		"4": argNone, "6": argNone, "br": argNone, "brief": argNone, "j": argNone, "json": argNone,
+		"p": argNone, "pretty": argNone, "o": argNone, "oneline": argNone, "h": argNone, "human": argNone,
+		"c": argNone, "color": argNone, "r": argNone, "resolve": argNone,
+	}
+	ipObjects = map[string]bool{
+		"a": true, "addr": true, "address": true, "l": true, "link": true,
+		"r": true, "ro": true, "route": true, "ru": true, "rule": true,
+		"n": true, "neigh": true, "neighbor": true, "neighbour": true,
+		"m": true, "maddr": true, "maddress": true, "tunnel": true, "ntable": true,
+	}
+	ipVerbs = map[string]bool{"show": true, "list": true, "ls": true, "lst": true, "get": true}
+)
+
+// checkIP ip 只能查看对象，不能使用 -batch、-netns 等选项，对象后只能跟 show、list、get
+func checkIP(args []string) error {
+	var rest []string
+	for i, a := range args {
+		if !strings.HasPrefix(a, "-") {
+			rest = args[i:]
+			break
+		}
+		// ip 的选项都是单个 -，不能合并
+		if _, ok := ipOptions[strings.TrimLeft(a, "-")]; !ok {
+			return fmt.Errorf("不允许 %s", a)
+		}
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("须指定查看的对象")
+	}
+	if !ipObjects[rest[0]] {
+		return fmt.Errorf("不允许查看 %s", rest[0])
+	}
+	if len(rest) > 1 && !ipVerbs[rest[1]] {
+		return fmt.Errorf("%s 会修改网络配置或不是查看命令", rest[1])
+	}
+	return nil
+}
+
+var journalctlOptions = optionSpec{
+	"u": argRequired, "unit": argRequired, "t": argRequired, "identifier": argRequired,
+	"n": argRequired, "lines": argRequired, "p": argRequired, "priority": argRequired,
+	"S": argRequired, "since": argRequired, "U": argRequired, "until": argRequired,
+	"g": argRequired, "grep": argRequired, "case-sensitive": argOptional,
+	"o": argRequired, "output": argRequired, "output-fields": argRequired,
+	"b": argOptional, "boot": argOptional, "k": argNone, "dmesg": argNone,
+	"r": argNone, "reverse": argNone, "x": argNone, "catalog": argNone,
+	"q": argNone, "quiet": argNone, "a": argNone, "all": argNone, "l": argNone, "full": argNone,
+	"e": argNone, "pager-end": argNone,
+	"m": argNone, "merge": argNone, "system": argNone, "user": argNone,
+	"no-pager": argNone, "no-hostname": argNone, "utc": argNone,
+	"list-boots": argNone, "disk-usage": argNone,
+}
+
+// journalMatch journalctl 的匹配条件 FIELD=VALUE，+ 表示或
+var journalMatch = regexp.MustCompile(`^([A-Z_][A-Z0-9_]*=.*|\+)$`)
+
+// checkJournalctl 只允许查询类选项，-f、--setup-keys、--sync、--relinquish-var、--vacuum-* 等不在其中
+func checkJournalctl(args []string) error {
+	operands, err := parseOptions(args, journalctlOptions)
+	if err != nil {
+		return err
+	}
+	for _, o := range operands {
+		if !journalMatch.MatchString(o) {
+			return fmt.Errorf("不允许参数 %s", o)
+		}
+	}
+	return nil
+}
+
+var (
+	systemctlOptions = optionSpec{
+		"no-pager": argNone, "l": argNone, "full": argNone, "n": argRequired, "lines": argRequired,
+		"a": argNone, "all": argNone, "t": argRequired, "type": argRequired, "state": argRequired,
+		"failed": argNone, "plain": argNone, "no-legend": argNone,
+	}
+	// systemctlVerbs show、cat 会输出单元的 Environment，可能含有密钥，不在其中
+	systemctlVerbs = map[string]bool{
+		"status": true, "is-active": true, "is-enabled": true, "is-failed": true,
+		"list-units": true, "list-unit-files": true, "list-timers": true,
+	}
+)
+
+// checkSystemctl 只能查看服务状态，不能使用 -H、-M 连接其他主机
+func checkSystemctl(args []string) error {
+	operands, err := parseOptions(args, systemctlOptions)
+	if err != nil {
+		return err
+	}
+	if len(operands) == 0 || !systemctlVerbs[operands[0]] {
+		return fmt.Errorf("只能使用 status、is-active 等查看命令")
+	}
+	for _, u := range operands[1:] {
+		if !unitName.MatchString(u) {
+			return fmt.Errorf("服务名 %s 不合法", u)
+		}
+	}
+	return nil
+}
+
+// dockerCommand docker 子命令允许的选项和操作数个数，maxOperands 为 -1 时不限
+type dockerCommand struct {
+	options     optionSpec
+	minOperands int
+	maxOperands int
+}
+
+// dockerCommands inspect 会输出容器环境变量中的密钥，不在其中
+var dockerCommands = map[string]dockerCommand{
+	"ps": {options: optionSpec{
+		"a": argNone, "all": argNone, "q": argNone, "quiet": argNone, "s": argNone, "size": argNone,
+		"l": argNone, "latest": argNone, "n": argRequired, "last": argRequired,
+		"f": argRequired, "filter": argRequired, "no-trunc": argNone,
+	}},
+	"stats": {options: optionSpec{"no-stream": argNone, "a": argNone, "all": argNone, "no-trunc": argNone}, maxOperands: -1},
+	"logs": {options: optionSpec{
+		"n": argRequired, "tail": argRequired, "since": argRequired, "until": argRequired,
+		"t": argNone, "timestamps": argNone, "details": argNone,
+	}, minOperands: 1, maxOperands: 1},
+	"images": {options: optionSpec{
+		"a": argNone, "all": argNone, "q": argNone, "quiet": argNone, "no-trunc": argNone,
+		"f": argRequired, "filter": argRequired,
+	}, maxOperands: 1},
+	// top 后的参数会传给容器内的 ps，只允许容器名
+	"top":     {minOperands: 1, maxOperands: 1},
+	"version": {},
+	"info":    {},
+}
+
+// checkDocker 子命令须在 dockerCommands 中且不带全局选项；stats 须加 --no-stream，logs 没有 -f
+func checkDocker(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("缺少子命令")
+	}
+	sub, ok := dockerCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("不允许 docker %s", args[0])
+	}
+	operands, err := parseOptions(args[1:], sub.options)
+	if err != nil {
+		return err
+	}
+	if len(operands) < sub.minOperands || (sub.maxOperands >= 0 && len(operands) > sub.maxOperands) {
+		return fmt.Errorf("docker %s 参数个数不对", args[0])
+	}
+	for _, o := range operands {
+		if !unitName.MatchString(o) {
+			return fmt.Errorf("容器名 %s 不合法", o)
+		}
+	}
+	if args[0] == "stats" {
+		for _, a := range args[1:] {
+			if a == "--no-stream" {
+				return nil
+			}
+		}
+		return fmt.Errorf("docker stats 须加 --no-stream")
+	}
+	return nil
+}
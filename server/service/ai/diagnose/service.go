@@ -0,0 +1,483 @@
+package diagnose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/model/server"
+	"yunwei/service/ai/decision"
+	"yunwei/service/ai/llm"
+	"yunwei/service/detector"
+	metricsService "yunwei/service/metrics"
+	"yunwei/service/notify"
+	"yunwei/service/security"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultMaxSteps 未配置时每次诊断最多调用工具的次数
+	defaultMaxSteps = 8
+	// maxStepsLimit 发起诊断时可指定的步数上限
+	maxStepsLimit = 20
+	// defaultToolTimeout 未配置时单次工具调用的超时
+	defaultToolTimeout = 30 * time.Second
+	// maxInvalidReplies 连续不按格式回复超过这个次数后要求直接给出结论
+	maxInvalidReplies = 2
+)
+
+// ErrNotRunning 诊断已结束
+var ErrNotRunning = errors.New("诊断已结束")
+
+// Request 发起诊断
+type Request struct {
+	ServerID uint
+	Question string // 现象描述，可为空
+	MaxSteps int    // 为 0 时使用配置
+	UserID   uint
+	Username string
+}
+
+// Filter 诊断记录查询条件
+type Filter struct {
+	ServerID uint
+	Status   string
+	Page     int
+	PageSize int
+}
+
+// Service 多步诊断
+type Service struct {
+	db     *gorm.DB
+	cfg    config.AIDiagnose
+	runner CommandRunner
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc // 本节点上进行中的诊断
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局诊断服务
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB, config.CONFIG.AI.Diagnose)
+	})
+	return globalService
+}
+
+// NewService 创建诊断服务
+func NewService(db *gorm.DB, cfg config.AIDiagnose) *Service {
+	if cfg.MaxSteps <= 0 {
+		cfg.MaxSteps = defaultMaxSteps
+	}
+	return &Service{
+		db:      db,
+		cfg:     cfg,
+		runner:  agentRunner{},
+		running: make(map[uint]context.CancelFunc),
+	}
+}
+
+// SetCommandRunner 设置在服务器上执行命令的方式，默认通过 Agent
+func (s *Service) SetCommandRunner(r CommandRunner) {
+	s.runner = r
+}
+
+// Start 发起诊断并在后台执行，返回的记录可用 Get 查看进展
+func (s *Service) Start(req Request) (*Diagnosis, error) {
+	d, srv, p, err := s.create(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.running[d.ID] = cancel
+	s.mu.Unlock()
+	go func() {
+		defer cancel()
+		s.run(ctx, d, srv, p)
+	}()
+	return d, nil
+}
+
+// Diagnose 发起诊断并等待结束
+func (s *Service) Diagnose(ctx context.Context, req Request) (*Diagnosis, error) {
+	d, srv, p, err := s.create(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.running[d.ID] = cancel
+	s.mu.Unlock()
+	defer cancel()
+	s.run(ctx, d, srv, p)
+	return s.Get(d.ID)
+}
+
+// create 校验请求并写入诊断记录
+func (s *Service) create(req Request) (*Diagnosis, *server.Server, llm.Provider, error) {
+	var srv server.Server
+	if err := s.db.First(&srv, req.ServerID).Error; err != nil {
+		return nil, nil, nil, errors.New("服务器不存在")
+	}
+	p := llm.For(llm.FeatureDiagnose, srv.TenantID)
+	if p == nil {
+		return nil, nil, nil, errors.New("未配置可用的 AI 模型")
+	}
+	maxSteps := s.cfg.MaxSteps
+	if req.MaxSteps > 0 {
+		maxSteps = req.MaxSteps
+	}
+	if maxSteps > maxStepsLimit {
+		maxSteps = maxStepsLimit
+	}
+
+	d := &Diagnosis{
+		TenantID:  srv.TenantID,
+		ServerID:  srv.ID,
+		Question:  strings.TrimSpace(req.Question),
+		Status:    StatusRunning,
+		Provider:  p.Name(),
+		MaxSteps:  maxSteps,
+		CreatedBy: req.UserID,
+		Creator:   req.Username,
+	}
+	if err := s.db.Create(d).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	return d, &srv, p, nil
+}
+
+// Cancel 取消进行中的诊断。诊断在其他节点上运行时，由该节点在下一步开始前发现并停止
+func (s *Service) Cancel(id uint) error {
+	res := s.db.Model(&Diagnosis{}).Where("id = ? AND status = ?", id, StatusRunning).
+		Updates(map[string]interface{}{"status": StatusCancelled, "finished_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotRunning
+	}
+	s.mu.Lock()
+	cancel := s.running[id]
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+// Get 诊断记录，包括每一步和最终决策
+func (s *Service) Get(id uint) (*Diagnosis, error) {
+	var d Diagnosis
+	if err := s.db.First(&d, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Where("diagnosis_id = ?", id).Order("seq").Find(&d.Steps).Error; err != nil {
+		return nil, err
+	}
+	if d.DecisionID > 0 {
+		var dec decision.AIDecision
+		if err := s.db.First(&dec, d.DecisionID).Error; err == nil {
+			d.Decision = &dec
+		}
+	}
+	return &d, nil
+}
+
+// List 查询诊断记录，按发起时间倒序
+func (s *Service) List(f Filter) ([]Diagnosis, int64, error) {
+	db := s.db.Model(&Diagnosis{})
+	if f.ServerID > 0 {
+		db = db.Where("server_id = ?", f.ServerID)
+	}
+	if f.Status != "" {
+		db = db.Where("status = ?", f.Status)
+	}
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if f.PageSize <= 0 || f.PageSize > 100 {
+		f.PageSize = 20
+	}
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	var list []Diagnosis
+	err := db.Order("id DESC").Offset((f.Page - 1) * f.PageSize).Limit(f.PageSize).Find(&list).Error
+	return list, total, err
+}
+
+// reply 模型每一步的回复
+type reply struct {
+	Thought string          `json:"thought"`
+	Tool    string          `json:"tool"`
+	Args    json.RawMessage `json:"args"`
+	Final   json.RawMessage `json:"final"`
+}
+
+// parseReply 从回复中提取 JSON 对象
+func parseReply(content string) (*reply, bool) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start == -1 || end <= start {
+		return nil, false
+	}
+	var r reply
+	if err := json.Unmarshal([]byte(content[start:end+1]), &r); err != nil {
+		return nil, false
+	}
+	if len(r.Final) == 0 && r.Tool == "" {
+		return nil, false
+	}
+	return &r, true
+}
+
+// run 诊断循环：模型每次回复调用一个工具或给出结论，工具调用达到上限后要求直接给出结论
+func (s *Service) run(ctx context.Context, d *Diagnosis, srv *server.Server, p llm.Provider) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, d.ID)
+		s.mu.Unlock()
+	}()
+
+	timeout := time.Duration(s.cfg.ToolTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultToolTimeout
+	}
+	t := &target{srv: srv, runner: s.runner, timeout: timeout}
+	alerts := activeAlerts(srv.ID)
+	engine := decision.NewEngine(p)
+
+	messages := []llm.Message{
+		{Role: "system", Content: systemPrompt(srv, d.MaxSteps)},
+		{Role: "user", Content: contextPrompt(srv, alerts, d.Question)},
+	}
+	seq, invalid, forced := 0, 0, false
+	for {
+		if s.stopped(ctx, d) {
+			return
+		}
+		if !forced && (d.ToolCalls >= d.MaxSteps || invalid > maxInvalidReplies) {
+			forced = true
+			messages = append(messages, llm.Message{Role: "user", Content: "已不能再调用工具，请根据已收集的信息直接给出 final 结论。"})
+		}
+
+		// 流式调用只为能随时取消，内容在结束后统一解析
+		resp, err := p.ChatStream(ctx, messages, func(string) error { return nil })
+		if err == nil && len(resp.Choices) == 0 {
+			err = llm.ErrNoResponse
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				s.finish(d, StatusCancelled, "")
+			} else {
+				s.finish(d, StatusFailed, "调用大模型失败: "+err.Error())
+			}
+			return
+		}
+		content := resp.Choices[0].Message.Content
+		messages = append(messages, llm.Message{Role: "assistant", Content: content})
+		seq++
+
+		r, ok := parseReply(content)
+		switch {
+		case ok && len(r.Final) > 0:
+			s.conclude(d, srv, engine, &Step{Seq: seq, Thought: r.Thought}, string(r.Final), alerts)
+			return
+		case forced:
+			// 到达上限后仍未给出结论，按原文生成决策
+			s.conclude(d, srv, engine, &Step{Seq: seq}, content, alerts)
+			return
+		case !ok:
+			invalid++
+			s.record(d, srv, &Step{Seq: seq, Kind: StepInvalid, Output: content})
+			messages = append(messages, llm.Message{Role: "user", Content: "回复格式不正确。请只输出一个 JSON 对象，调用工具或给出 final 结论。"})
+			continue
+		}
+
+		invalid = 0
+		step := s.callTool(ctx, t, seq, r)
+		d.ToolCalls++
+		s.db.Model(d).Update("tool_calls", d.ToolCalls)
+		s.record(d, srv, step)
+
+		result := step.Output
+		if step.Error != "" {
+			result = "错误: " + step.Error + "\n" + result
+		}
+		messages = append(messages, llm.Message{Role: "user", Content: fmt.Sprintf("工具 %s 的结果（还可调用 %d 次）：\n%s",
+			r.Tool, d.MaxSteps-d.ToolCalls, truncateOutput(result))})
+	}
+}
+
+// callTool 执行一次工具调用
+func (s *Service) callTool(ctx context.Context, t *target, seq int, r *reply) *Step {
+	step := &Step{Seq: seq, Kind: StepTool, Thought: r.Thought, Tool: r.Tool, Args: string(r.Args), Result: ResultSuccess}
+	tool := findTool(r.Tool)
+	if tool == nil {
+		step.Result, step.Error = ResultFailed, "没有这个工具"
+		return step
+	}
+	start := time.Now()
+	tctx, cancel := context.WithTimeout(ctx, t.timeout)
+	output, command, err := tool.run(tctx, t, r.Args)
+	cancel()
+	step.Duration = time.Since(start).Milliseconds()
+	step.Output, step.Command = output, command
+	if err != nil {
+		step.Result, step.Error = ResultFailed, err.Error()
+		if errors.Is(err, ErrForbidden) {
+			step.Result = ResultForbidden
+		}
+	}
+	return step
+}
+
+// record 保存一步，工具调用同时写入审计日志
+func (s *Service) record(d *Diagnosis, srv *server.Server, step *Step) {
+	step.DiagnosisID = d.ID
+	if err := s.db.Create(step).Error; err != nil {
+		global.Logger.Warn(fmt.Sprintf("保存诊断 #%d 第 %d 步失败: %v", d.ID, step.Seq, err))
+	}
+	if step.Kind != StepTool {
+		return
+	}
+	command := step.Command
+	if command == "" {
+		command = step.Tool + " " + step.Args
+	}
+	s.db.Create(&security.AuditLog{
+		UserID:     d.CreatedBy,
+		Username:   d.Creator,
+		ServerID:   srv.ID,
+		ServerName: srv.Name,
+		Action:     string(security.AuditActionExecute),
+		Resource:   "ai_diagnosis",
+		Command:    fmt.Sprintf("诊断 #%d 第 %d 步: %s", d.ID, step.Seq, command),
+		Result:     step.Result,
+	})
+}
+
+// conclude 由结论生成决策，决策保存后等待人工确认或按规则自动执行
+func (s *Service) conclude(d *Diagnosis, srv *server.Server, engine *decision.Engine, step *Step, final string, alerts []detector.DetectionResult) {
+	dec := engine.Decide(d.ServerID, final, alerts)
+	if err := s.db.Create(dec).Error; err != nil {
+		s.finish(d, StatusFailed, "保存决策失败: "+err.Error())
+		return
+	}
+	if dec.Status == decision.DecisionStatusPending {
+		go func() {
+			if err := notify.ForTenant(d.TenantID).Send(notify.NewDecisionApproval(dec, srv.Name)); err != nil {
+				global.Logger.Warn(fmt.Sprintf("发送决策 #%d 审批通知失败: %v", dec.ID, err))
+			}
+		}()
+	}
+	step.Kind, step.Output, step.Result = StepFinal, final, ResultSuccess
+	step.DiagnosisID = d.ID
+	s.db.Create(step)
+	d.DecisionID = dec.ID
+	s.db.Model(d).Update("decision_id", dec.ID)
+	s.finish(d, StatusCompleted, "")
+}
+
+// finish 结束诊断。已被取消的诊断不再改状态
+func (s *Service) finish(d *Diagnosis, status, errMsg string) {
+	now := time.Now()
+	d.Status, d.Error, d.FinishedAt = status, errMsg, &now
+	s.db.Model(&Diagnosis{}).Where("id = ? AND status = ?", d.ID, StatusRunning).
+		Updates(map[string]interface{}{"status": status, "error": errMsg, "finished_at": now})
+}
+
+// stopped 诊断是否已被取消，可能是本节点取消了 ctx，也可能是其他节点改了状态
+func (s *Service) stopped(ctx context.Context, d *Diagnosis) bool {
+	if ctx.Err() != nil {
+		s.finish(d, StatusCancelled, "")
+		return true
+	}
+	var status string
+	s.db.Model(&Diagnosis{}).Where("id = ?", d.ID).Pluck("status", &status)
+	if status != "" && status != StatusRunning {
+		d.Status = status
+		return true
+	}
+	return false
+}
+
+// activeAlerts 服务器未恢复的告警，用于提示词和决定是否自动执行
+func activeAlerts(serverID uint) []detector.DetectionResult {
+	var alerts []detector.Alert
+	global.DB.Where("server_id = ? AND status <> ?", serverID, detector.AlertStatusResolved).
+		Order("created_at DESC").Limit(20).Find(&alerts)
+	results := make([]detector.DetectionResult, 0, len(alerts))
+	for _, a := range alerts {
+		results = append(results, detector.DetectionResult{
+			ServerID:    a.ServerID,
+			Type:        a.Type,
+			Level:       a.Level,
+			Title:       a.Title,
+			Message:     a.Message,
+			MetricValue: a.MetricValue,
+			Threshold:   a.Threshold,
+			Triggered:   true,
+		})
+	}
+	return results
+}
+
+// systemPrompt 说明可用工具和回复格式
+func systemPrompt(srv *server.Server, maxSteps int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("你是一名资深 Linux 运维工程师，正在排查服务器「%s」的问题。\n", srv.Name))
+	sb.WriteString("先调用工具收集证据，找到具体原因后再下结论；不要给出「检查日志」「排查进程」这类没有依据的泛泛建议，需要的信息请自己用工具查。\n\n")
+	sb.WriteString("## 可用工具（均为只读）\n")
+	for _, t := range Tools {
+		sb.WriteString(fmt.Sprintf("- %s：%s。参数示例：%s\n", t.Name, t.Description, t.Args))
+	}
+	sb.WriteString(fmt.Sprintf("\n最多调用 %d 次工具。\n\n", maxSteps))
+	sb.WriteString("## 回复格式\n")
+	sb.WriteString("每次只回复一个 JSON 对象，不要输出其他内容。\n")
+	sb.WriteString(`调用工具：{"thought": "为什么调用", "tool": "工具名", "args": {参数}}` + "\n")
+	sb.WriteString(`给出结论：{"thought": "依据", "final": 结论}` + "\n")
+	sb.WriteString("结论的格式如下，analysis 中写明依据的工具结果，commands 为解决问题的命令：\n")
+	sb.WriteString(decision.DecisionFormat + "\n")
+	return sb.String()
+}
+
+// contextPrompt 诊断开始时已知的服务器信息、当前指标和告警
+func contextPrompt(srv *server.Server, alerts []detector.DetectionResult, question string) string {
+	var sb strings.Builder
+	sb.WriteString("## 服务器\n")
+	sb.WriteString(fmt.Sprintf("- 名称: %s（%s）\n", srv.Name, srv.Host))
+	sb.WriteString(fmt.Sprintf("- 系统: %s %s，%d 核，内存 %d MB，磁盘 %d GB\n", srv.OS, srv.Arch, srv.CPUCores, srv.MemoryTotal, srv.DiskTotal))
+	if m, err := metricsService.LatestServerMetric(srv.ID); err == nil {
+		sb.WriteString(fmt.Sprintf("- 当前: CPU %.2f%%，内存 %.2f%%，磁盘 %.2f%%，负载 %.2f/%.2f/%.2f，进程 %d\n",
+			m.CPUUsage, m.MemoryUsage, m.DiskUsage, m.Load1, m.Load5, m.Load15, m.ProcessCount))
+	}
+	if len(alerts) > 0 {
+		sb.WriteString("\n## 当前告警\n")
+		for _, a := range alerts {
+			sb.WriteString(fmt.Sprintf("- [%s] %s: %s\n", a.Level, a.Title, a.Message))
+		}
+	}
+	if question != "" {
+		sb.WriteString("\n## 需要排查的现象\n")
+		sb.WriteString(question + "\n")
+	} else {
+		sb.WriteString("\n请排查服务器当前是否存在问题及其原因。\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,332 @@
+package diagnose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/server"
+	"yunwei/service/event"
+	"yunwei/service/executor"
+	metricsService "yunwei/service/metrics"
+)
+
+// ErrForbidden 命令未通过只读检查
+var ErrForbidden = errors.New("命令不允许执行")
+
+// maxToolOutput 返回给模型的工具输出最多保留的字符数
+const maxToolOutput = 4000
+
+// Tool 诊断工具，全部只读
+type Tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Args        string `json:"args"` // 参数示例，写入提示词
+
+	run func(ctx context.Context, t *target, args json.RawMessage) (output, command string, err error)
+}
+
+// Tools 可供模型调用的工具
+var Tools = []Tool{
+	{
+		Name:        "query_metrics",
+		Description: "查询最近一段时间的 CPU、内存、磁盘和负载指标，返回统计值和采样点",
+		Args:        `{"minutes": 60}`,
+		run:         queryMetrics,
+	},
+	{
+		Name:        "top_processes",
+		Description: "按 CPU 或内存占用列出前几个进程",
+		Args:        `{"sort": "cpu 或 mem", "limit": 15}`,
+		run:         topProcesses,
+	},
+	{
+		Name:        "tail_logs",
+		Description: "查看日志末尾：file 为 .log 文件的绝对路径，unit 为 systemd 服务，container 为容器名，三选一；都不填时查看系统 warning 以上的日志",
+		Args:        `{"file": "/var/log/nginx/error.log", "unit": "", "container": "", "lines": 100}`,
+		run:         tailLogs,
+	},
+	{
+		Name:        "list_containers",
+		Description: "列出服务器上的 Docker 容器及其状态、资源占用",
+		Args:        `{}`,
+		run:         listContainers,
+	},
+	{
+		Name:        "run_command",
+		Description: "执行一条只读的诊断命令，如 df -h、free -m、ss -tnp、systemctl status nginx；不能使用管道、重定向，只能执行白名单中的查看类命令",
+		Args:        `{"command": "df -h"}`,
+		run:         runCommand,
+	},
+	{
+		Name:        "recent_events",
+		Description: "查询最近的事件：发布、配置变更、告警、AI 决策执行等",
+		Args:        `{"hours": 24}`,
+		run:         recentEvents,
+	},
+}
+
+// findTool 按名称查找工具
+func findTool(name string) *Tool {
+	for i := range Tools {
+		if Tools[i].Name == name {
+			return &Tools[i]
+		}
+	}
+	return nil
+}
+
+// CommandRunner 在服务器上执行命令
+type CommandRunner interface {
+	Run(ctx context.Context, serverID uint, command string, timeout time.Duration) (string, error)
+}
+
+// agentRunner 通过服务器上的 Agent 执行命令，Agent 可能连接在集群中任一节点
+type agentRunner struct{}
+
+func (agentRunner) Run(ctx context.Context, serverID uint, command string, timeout time.Duration) (string, error) {
+	return executor.RunOnAgent(ctx, serverID, command, timeout)
+}
+
+// target 一次诊断中工具操作的服务器
+type target struct {
+	srv     *server.Server
+	runner  CommandRunner
+	timeout time.Duration
+}
+
+// exec 检查命令是否只读后在服务器上执行
+func (t *target) exec(ctx context.Context, command string) (string, error) {
+	if err := checkReadOnly(command); err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.runner.Run(ctx, t.srv.ID, command, t.timeout)
+}
+
+// decodeArgs 解析工具参数，模型没有给参数时保留默认值
+func decodeArgs(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("参数格式错误: %w", err)
+	}
+	return nil
+}
+
+// clamp 把 n 限制在 [min, max]，为 0 时取 def
+func clamp(n, def, min, max int) int {
+	if n == 0 {
+		n = def
+	}
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+func queryMetrics(ctx context.Context, t *target, raw json.RawMessage) (string, string, error) {
+	var args struct {
+		Minutes int `json:"minutes"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", "", err
+	}
+	minutes := clamp(args.Minutes, 60, 5, 24*60)
+	end := time.Now()
+	ms, err := metricsService.LoadServerMetrics(t.srv.ID, end.Add(-time.Duration(minutes)*time.Minute), end)
+	if err != nil {
+		return "", "", err
+	}
+	if len(ms) == 0 {
+		return fmt.Sprintf("最近 %d 分钟没有指标数据", minutes), "", nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("最近 %d 分钟共 %d 个采样点（%s ~ %s）\n", minutes, len(ms),
+		ms[0].CreatedAt.Format("01-02 15:04"), ms[len(ms)-1].CreatedAt.Format("01-02 15:04")))
+	series := []struct {
+		name string
+		unit string
+		get  func(m *server.ServerMetric) float64
+	}{
+		{"CPU", "%", func(m *server.ServerMetric) float64 { return m.CPUUsage }},
+		{"内存", "%", func(m *server.ServerMetric) float64 { return m.MemoryUsage }},
+		{"磁盘", "%", func(m *server.ServerMetric) float64 { return m.DiskUsage }},
+		{"1分钟负载", "", func(m *server.ServerMetric) float64 { return m.Load1 }},
+	}
+	for _, s := range series {
+		min, max, sum := s.get(&ms[0]), s.get(&ms[0]), 0.0
+		for i := range ms {
+			v := s.get(&ms[i])
+			sum += v
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		sb.WriteString(fmt.Sprintf("- %s: 最新 %.2f%s，最小 %.2f%s，平均 %.2f%s，最大 %.2f%s\n", s.name,
+			s.get(&ms[len(ms)-1]), s.unit, min, s.unit, sum/float64(len(ms)), s.unit, max, s.unit))
+	}
+
+	// 均匀抽取最多 12 个采样点，便于看出变化时间
+	sb.WriteString("采样点（时间 CPU 内存 磁盘 负载）：\n")
+	step := (len(ms) + 11) / 12
+	for i := 0; i < len(ms); i += step {
+		m := &ms[i]
+		sb.WriteString(fmt.Sprintf("%s %.1f %.1f %.1f %.2f\n", m.CreatedAt.Format("15:04"), m.CPUUsage, m.MemoryUsage, m.DiskUsage, m.Load1))
+	}
+	return sb.String(), "", nil
+}
+
+func topProcesses(ctx context.Context, t *target, raw json.RawMessage) (string, string, error) {
+	var args struct {
+		Sort  string `json:"sort"`
+		Limit int    `json:"limit"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", "", err
+	}
+	key := "-%cpu"
+	if args.Sort == "mem" || args.Sort == "memory" {
+		key = "-%mem"
+	}
+	limit := clamp(args.Limit, 15, 1, 50)
+	command := "ps aux --sort=" + key
+	output, err := t.exec(ctx, command)
+	// 不能用管道 head，在这里截取表头和前 limit 个进程
+	lines := strings.SplitN(output, "\n", limit+2)
+	if len(lines) > limit+1 {
+		lines = lines[:limit+1]
+	}
+	return strings.Join(lines, "\n"), command, err
+}
+
+// logPath 日志文件须是不含 .. 的绝对路径
+var logPath = regexp.MustCompile(`^/[\w./-]+\.log$`)
+
+// unitName systemd 服务名和容器名
+var unitName = regexp.MustCompile(`^[\w.@-]+$`)
+
+func tailLogs(ctx context.Context, t *target, raw json.RawMessage) (string, string, error) {
+	var args struct {
+		File      string `json:"file"`
+		Unit      string `json:"unit"`
+		Container string `json:"container"`
+		Lines     int    `json:"lines"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", "", err
+	}
+	lines := clamp(args.Lines, 100, 1, 500)
+
+	var command string
+	switch {
+	case args.File != "":
+		if !logPath.MatchString(args.File) || strings.Contains(args.File, "..") {
+			return "", "", fmt.Errorf("%w: file 须是 .log 文件的绝对路径", ErrForbidden)
+		}
+		command = fmt.Sprintf("tail -n %d %s", lines, args.File)
+	case args.Unit != "":
+		if !unitName.MatchString(args.Unit) {
+			return "", "", fmt.Errorf("%w: 服务名不合法", ErrForbidden)
+		}
+		command = fmt.Sprintf("journalctl -u %s -n %d --no-pager", args.Unit, lines)
+	case args.Container != "":
+		if !unitName.MatchString(args.Container) {
+			return "", "", fmt.Errorf("%w: 容器名不合法", ErrForbidden)
+		}
+		command = fmt.Sprintf("docker logs --tail %d %s", lines, args.Container)
+	default:
+		command = fmt.Sprintf("journalctl -p warning -n %d --no-pager", lines)
+	}
+	output, err := t.exec(ctx, command)
+	return output, command, err
+}
+
+func listContainers(ctx context.Context, t *target, raw json.RawMessage) (string, string, error) {
+	// 优先用 Agent 上报的最近一次采集结果，没有时直接在服务器上查看
+	var containers []server.DockerContainer
+	global.DB.Where("server_id = ?", t.srv.ID).Order("created_at DESC").Limit(200).Find(&containers)
+	if len(containers) == 0 {
+		command := "docker ps -a"
+		output, err := t.exec(ctx, command)
+		return output, command, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("采集时间 %s\n", containers[0].CreatedAt.Format("01-02 15:04:05")))
+	seen := make(map[string]bool)
+	for _, c := range containers {
+		if seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		sb.WriteString(fmt.Sprintf("- %s（%s）%s %s CPU %.1f%% 内存 %.1f%%\n", c.Name, c.Image, c.State, c.Status, c.CPUUsage, c.MemoryUsage))
+	}
+	return sb.String(), "", nil
+}
+
+func runCommand(ctx context.Context, t *target, raw json.RawMessage) (string, string, error) {
+	var args struct {
+		Command string `json:"command"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", "", err
+	}
+	command := strings.TrimSpace(args.Command)
+	output, err := t.exec(ctx, command)
+	return output, command, err
+}
+
+func recentEvents(ctx context.Context, t *target, raw json.RawMessage) (string, string, error) {
+	var args struct {
+		Hours int `json:"hours"`
+	}
+	if err := decodeArgs(raw, &args); err != nil {
+		return "", "", err
+	}
+	hours := clamp(args.Hours, 24, 1, 7*24)
+	events, _, err := event.GetService().Timeline(event.Filter{
+		ServerID:      t.srv.ID,
+		GroupID:       t.srv.GroupID,
+		Start:         time.Now().Add(-time.Duration(hours) * time.Hour),
+		IncludeGlobal: true,
+		PageSize:      50,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	// 不限于具体服务器的事件可能属于其他租户
+	visible := events[:0]
+	for _, e := range events {
+		if e.TenantID == "" || e.TenantID == t.srv.TenantID {
+			visible = append(visible, e)
+		}
+	}
+	if len(visible) == 0 {
+		return fmt.Sprintf("最近 %d 小时没有相关事件", hours), "", nil
+	}
+	return event.Summarize(visible), "", nil
+}
+
+// truncateOutput 截断过长的工具输出
+func truncateOutput(s string) string {
+	r := []rune(s)
+	if len(r) <= maxToolOutput {
+		return s
+	}
+	return string(r[:maxToolOutput]) + "\n…（输出过长，已截断）"
+}
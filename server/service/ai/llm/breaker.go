@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常调用
+	BreakerOpen     = "open"      // 连续失败后暂停调用，冷却结束前直接跳过
+	BreakerHalfOpen = "half_open" // 冷却结束，放行一个试探请求，成功后恢复，失败后重新熔断
+)
+
+// Breaker 提供方熔断器。同一提供方被多个功能共用，熔断状态也共用
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int // 连续失败次数
+	openedAt time.Time
+	probing  bool // 半开状态下已放行试探请求
+	lastErr  string
+}
+
+// NewBreaker 创建熔断器，连续失败 threshold 次后熔断 cooldown
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if cooldown <= 0 {
+		cooldown = time.Minute
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// Allow 是否可以调用
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state, b.probing = BreakerHalfOpen, true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success 记录一次成功调用
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state, b.failures, b.probing = BreakerClosed, 0, false
+}
+
+// Release 调用被调用方主动取消，不计成功也不计失败；半开状态下放开试探名额
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// Failure 记录一次失败调用
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.lastErr = err.Error()
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt, b.probing = BreakerOpen, time.Now(), false
+	}
+}
+
+// BreakerStatus 熔断器状态
+type BreakerStatus struct {
+	State     string     `json:"state"`
+	Failures  int        `json:"failures"`
+	OpenedAt  *time.Time `json:"openedAt,omitempty"`
+	RetryAt   *time.Time `json:"retryAt,omitempty"` // 熔断中时下次试探的时间
+	LastError string     `json:"lastError,omitempty"`
+}
+
+// Status 当前状态
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BreakerStatus{State: b.state, Failures: b.failures, LastError: b.lastErr}
+	if b.state != BreakerClosed {
+		opened, retry := b.openedAt, b.openedAt.Add(b.cooldown)
+		st.OpenedAt, st.RetryAt = &opened, &retry
+	}
+	return st
+}
@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"yunwei/global"
+)
+
+// ErrAllUnavailable 降级链上的提供方都不可用
+var ErrAllUnavailable = errors.New("没有可用的大模型")
+
+// Chain 降级链：按顺序调用提供方，失败或熔断中时换下一个。
+// 自身也实现 Provider，各功能拿到的都是降级链
+type Chain struct {
+	members []chainMember
+}
+
+type chainMember struct {
+	provider Provider
+	breaker  *Breaker // 为 nil 时不熔断
+}
+
+// NewChain 创建降级链
+func NewChain() *Chain {
+	return &Chain{}
+}
+
+// Add 追加提供方，breaker 为 nil 时该提供方不熔断
+func (c *Chain) Add(p Provider, breaker *Breaker) *Chain {
+	c.members = append(c.members, chainMember{provider: p, breaker: breaker})
+	return c
+}
+
+// Providers 降级链上的提供方名称
+func (c *Chain) Providers() []string {
+	names := make([]string, len(c.members))
+	for i, m := range c.members {
+		names[i] = m.provider.Name()
+	}
+	return names
+}
+
+// Name 首选提供方的名称
+func (c *Chain) Name() string {
+	if len(c.members) == 0 {
+		return ""
+	}
+	return c.members[0].provider.Name()
+}
+
+// Chat 依次尝试各提供方，返回第一个成功的结果
+func (c *Chain) Chat(messages []Message) (*ChatResponse, error) {
+	var errs []string
+	for i, m := range c.members {
+		name := m.provider.Name()
+		if m.breaker != nil && !m.breaker.Allow() {
+			errs = append(errs, name+": 熔断中")
+			continue
+		}
+		resp, err := m.provider.Chat(messages)
+		if err == nil {
+			if m.breaker != nil {
+				m.breaker.Success()
+			}
+			return resp, nil
+		}
+		if m.breaker != nil {
+			m.breaker.Failure(err)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		if i < len(c.members)-1 {
+			global.Logger.Warn(fmt.Sprintf("大模型 %s 调用失败，降级到下一个提供方: %v", name, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrAllUnavailable
+	}
+	return nil, fmt.Errorf("%w（%s）", ErrAllUnavailable, strings.Join(errs, "；"))
+}
+
+// ChatStream 依次尝试各提供方。已经输出过内容后不再降级，避免两个模型的回复拼在一起；
+// ctx 取消或 onDelta 出错属于调用方中止，不计入熔断
+func (c *Chain) ChatStream(ctx context.Context, messages []Message, onDelta StreamHandler) (*ChatResponse, error) {
+	var errs []string
+	for i, m := range c.members {
+		name := m.provider.Name()
+		if m.breaker != nil && !m.breaker.Allow() {
+			errs = append(errs, name+": 熔断中")
+			continue
+		}
+		started := false
+		var handlerErr error
+		resp, err := m.provider.ChatStream(ctx, messages, func(delta string) error {
+			started = true
+			if err := onDelta(delta); err != nil {
+				handlerErr = err
+				return err
+			}
+			return nil
+		})
+		if err == nil {
+			if m.breaker != nil {
+				m.breaker.Success()
+			}
+			return resp, nil
+		}
+		if handlerErr != nil || ctx.Err() != nil {
+			if m.breaker != nil {
+				m.breaker.Release()
+			}
+			if handlerErr != nil {
+				return nil, handlerErr
+			}
+			return nil, ctx.Err()
+		}
+		if m.breaker != nil {
+			m.breaker.Failure(err)
+		}
+		if started {
+			return nil, fmt.Errorf("大模型 %s 输出中断: %w", name, err)
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		if i < len(c.members)-1 {
+			global.Logger.Warn(fmt.Sprintf("大模型 %s 调用失败，降级到下一个提供方: %v", name, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, ErrAllUnavailable
+	}
+	return nil, fmt.Errorf("%w（%s）", ErrAllUnavailable, strings.Join(errs, "；"))
+}
+
+// QuickChat 快速聊天
+func (c *Chain) QuickChat(prompt string) (string, error) {
+	return quickChat(c, prompt)
+}
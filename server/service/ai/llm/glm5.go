@@ -1,16 +1,14 @@
 package llm
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"net/http"
 	"time"
 )
 
 // GLM5Config GLM5 配置
 type GLM5Config struct {
+	Name        string        `json:"name"` // 提供方名称，为空时为 glm
 	APIKey      string        `json:"apiKey"`
 	BaseURL     string        `json:"baseUrl"`
 	Model       string        `json:"model"`
@@ -21,8 +19,9 @@ type GLM5Config struct {
 
 // GLM5Client GLM5 API 客户端
 type GLM5Client struct {
-	config     GLM5Config
-	httpClient *http.Client
+	config       GLM5Config
+	httpClient   *http.Client
+	streamClient *http.Client
 }
 
 // Message 消息结构
@@ -40,17 +39,20 @@ type ChatRequest struct {
 	Stream      bool      `json:"stream,omitempty"`
 }
 
+// Choice 一条候选回复
+type Choice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
 // ChatResponse 聊天响应
 type ChatResponse struct {
-	ID      string `json:"id"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index        int     `json:"index"`
-		Message      Message `json:"message"`
-		FinishReason string  `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
+	ID      string   `json:"id"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   struct {
 		PromptTokens     int `json:"prompt_tokens"`
 		CompletionTokens int `json:"completion_tokens"`
 		TotalTokens      int `json:"total_tokens"`
@@ -76,7 +78,7 @@ func NewGLM5Client(config GLM5Config) *GLM5Client {
 		config.Temperature = 0.7
 	}
 	if config.Timeout == 0 {
-		config.Timeout = 60 * time.Second
+		config.Timeout = defaultTimeout
 	}
 
 	return &GLM5Client{
@@ -84,63 +86,40 @@ func NewGLM5Client(config GLM5Config) *GLM5Client {
 		httpClient: &http.Client{
 			Timeout: config.Timeout,
 		},
+		streamClient: newStreamClient(config.Timeout),
 	}
 }
 
+// Name 实现 Provider
+func (c *GLM5Client) Name() string {
+	if c.config.Name != "" {
+		return c.config.Name
+	}
+	return TypeGLM
+}
+
 // Chat 发送聊天请求
 func (c *GLM5Client) Chat(messages []Message) (*ChatResponse, error) {
-	req := ChatRequest{
+	return postChatCompletions(c.httpClient, c.config.BaseURL, c.config.APIKey, ChatRequest{
 		Model:       c.config.Model,
 		Messages:    messages,
 		MaxTokens:   c.config.MaxTokens,
 		Temperature: c.config.Temperature,
 		Stream:      false,
-	}
-
-	body, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("序列化请求失败: %w", err)
-	}
-
-	httpReq, err := http.NewRequest("POST", c.config.BaseURL+"/chat/completions", bytes.NewReader(body))
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+c.config.APIKey)
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("读取响应失败: %w", err)
-	}
-
-	var chatResp ChatResponse
-	if err := json.Unmarshal(respBody, &chatResp); err != nil {
-		return nil, fmt.Errorf("解析响应失败: %w", err)
-	}
-
-	if chatResp.Error != nil {
-		return nil, fmt.Errorf("API 错误: %s - %s", chatResp.Error.Code, chatResp.Error.Message)
-	}
+	})
+}
 
-	return &chatResp, nil
+// ChatStream 流式聊天
+func (c *GLM5Client) ChatStream(ctx context.Context, messages []Message, onDelta StreamHandler) (*ChatResponse, error) {
+	return streamChatCompletions(ctx, c.streamClient, c.config.BaseURL, c.config.APIKey, ChatRequest{
+		Model:       c.config.Model,
+		Messages:    messages,
+		MaxTokens:   c.config.MaxTokens,
+		Temperature: c.config.Temperature,
+	}, onDelta)
 }
 
 // QuickChat 快速聊天
 func (c *GLM5Client) QuickChat(prompt string) (string, error) {
-	resp, err := c.Chat([]Message{{Role: "user", Content: prompt}})
-	if err != nil {
-		return "", err
-	}
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("无响应内容")
-	}
-	return resp.Choices[0].Message.Content, nil
+	return quickChat(c, prompt)
 }
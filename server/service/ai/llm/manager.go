@@ -0,0 +1,289 @@
+package llm
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+)
+
+// Route 某个功能、某个租户实际使用的提供方
+type Route struct {
+	Feature     string   `json:"feature"`
+	TenantID    string   `json:"tenantId"`
+	Providers   []string `json:"providers"`   // 降级链，第一个为首选
+	Model       string   `json:"model"`       // 首选提供方的型号，为空时用提供方配置的型号
+	Temperature float64  `json:"temperature"` // 为 0 时用各提供方配置的温度
+	LocalOnly   bool     `json:"localOnly"`
+	Skipped     []string `json:"skipped,omitempty"` // 未配置或因只用本地模型被排除的提供方
+}
+
+// ProviderStatus 提供方配置和熔断状态
+type ProviderStatus struct {
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Model   string        `json:"model"`
+	Local   bool          `json:"local"`
+	Breaker BreakerStatus `json:"breaker"`
+}
+
+// Manager 按配置为各功能和租户组装降级链
+type Manager struct {
+	cfg      config.AI
+	order    []string // 提供方按配置顺序
+	configs  map[string]config.LLMProvider
+	breakers map[string]*Breaker
+
+	mu         sync.Mutex
+	registered map[string]Provider // 代码中注册的实例，优先于配置
+	chains     map[string]Provider
+}
+
+var (
+	globalManager *Manager
+	managerOnce   sync.Once
+)
+
+// GetManager 获取全局大模型管理
+func GetManager() *Manager {
+	managerOnce.Do(func() {
+		globalManager = NewManager(config.CONFIG.AI)
+	})
+	return globalManager
+}
+
+// For 功能和租户使用的大模型，未配置可用的提供方时返回 nil
+func For(feature, tenantID string) Provider {
+	return GetManager().For(feature, tenantID)
+}
+
+// NewManager 创建大模型管理
+func NewManager(cfg config.AI) *Manager {
+	m := &Manager{
+		cfg:        cfg,
+		configs:    make(map[string]config.LLMProvider),
+		breakers:   make(map[string]*Breaker),
+		registered: make(map[string]Provider),
+		chains:     make(map[string]Provider),
+	}
+	providers := cfg.Providers
+	if len(providers) == 0 && cfg.APIKey != "" {
+		providers = []config.LLMProvider{{
+			Name:        TypeGLM,
+			Type:        TypeGLM,
+			BaseURL:     cfg.BaseURL,
+			APIKey:      cfg.APIKey,
+			Model:       cfg.Model,
+			MaxTokens:   cfg.MaxTokens,
+			Temperature: cfg.Temperature,
+		}}
+	}
+	for _, p := range providers {
+		if p.Name == "" {
+			p.Name = p.Type
+		}
+		if _, ok := m.configs[p.Name]; ok || p.Name == "" {
+			global.Logger.Warn(fmt.Sprintf("大模型提供方名称为空或重复，已忽略: %q", p.Name))
+			continue
+		}
+		m.order = append(m.order, p.Name)
+		m.configs[p.Name] = p
+		m.breakers[p.Name] = NewBreaker(cfg.Breaker.FailureThreshold, time.Duration(cfg.Breaker.Cooldown)*time.Second)
+	}
+	return m
+}
+
+// Register 注册提供方实例，同名时替换配置中的提供方，主要用于测试中注入 MockClient。
+// 状态中的类型取实例的实际类型，替换配置时保留配置的型号
+func (m *Manager) Register(p Provider, local bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name := p.Name()
+	pc, ok := m.configs[name]
+	if !ok {
+		m.order = append(m.order, name)
+		m.breakers[name] = NewBreaker(m.cfg.Breaker.FailureThreshold, time.Duration(m.cfg.Breaker.Cooldown)*time.Second)
+		pc = config.LLMProvider{Name: name}
+	}
+	if t := providerType(p); t != "" {
+		pc.Type = t
+	}
+	pc.Local = local
+	m.configs[name] = pc
+	m.registered[name] = p
+	m.chains = make(map[string]Provider)
+}
+
+// providerType 实例对应的提供方类型，无法识别时返回空
+func providerType(p Provider) string {
+	switch p.(type) {
+	case *GLM5Client:
+		return TypeGLM
+	case *OpenAIClient:
+		return TypeOpenAI
+	case *OllamaClient:
+		return TypeOllama
+	case *MockClient:
+		return TypeMock
+	}
+	return ""
+}
+
+// Route 解析功能和租户的路由。优先级从低到高：默认、功能、租户默认、租户的功能；
+// 某一级换了提供方时，上一级指定的型号不再沿用
+func (m *Manager) Route(feature, tenantID string) Route {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.route(feature, tenantID)
+}
+
+func (m *Manager) route(feature, tenantID string) Route {
+	r := Route{Feature: feature, TenantID: tenantID}
+	var primary string
+	var fallback []string
+	if len(m.order) > 0 {
+		primary = m.order[0]
+	}
+	apply := func(lr config.LLMRoute) {
+		if lr.Provider != "" {
+			primary, r.Model = lr.Provider, ""
+		}
+		if lr.Model != "" {
+			r.Model = lr.Model
+		}
+		if len(lr.Fallback) > 0 {
+			fallback = lr.Fallback
+		}
+		if lr.Temperature > 0 {
+			r.Temperature = lr.Temperature
+		}
+	}
+	apply(m.cfg.Default)
+	apply(m.cfg.Features[feature])
+	if t, ok := m.cfg.Tenants[tenantID]; ok && tenantID != "" {
+		apply(t.Default)
+		apply(t.Features[feature])
+		r.LocalOnly = t.LocalOnly
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range append([]string{primary}, fallback...) {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		pc, ok := m.configs[name]
+		if !ok || (r.LocalOnly && !pc.Local) {
+			r.Skipped = append(r.Skipped, name)
+			continue
+		}
+		r.Providers = append(r.Providers, name)
+	}
+	if len(r.Providers) == 0 || r.Providers[0] != primary {
+		// 首选被排除时，型号覆盖只针对首选，不用于其他提供方
+		r.Model = ""
+	}
+	return r
+}
+
+// For 功能和租户使用的大模型：按路由组装的降级链，未配置可用的提供方时返回 nil
+func (m *Manager) For(feature, tenantID string) Provider {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := feature + "/" + tenantID
+	if p, ok := m.chains[key]; ok {
+		return p
+	}
+
+	r := m.route(feature, tenantID)
+	chain := NewChain()
+	for i, name := range r.Providers {
+		model := ""
+		if i == 0 {
+			model = r.Model
+		}
+		p, err := m.instance(name, model, r.Temperature)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("大模型提供方 %s 配置错误: %v", name, err))
+			continue
+		}
+		chain.Add(p, m.breakers[name])
+	}
+
+	var p Provider
+	if len(chain.members) > 0 {
+		p = chain
+	}
+	m.chains[key] = p
+	return p
+}
+
+// instance 按提供方配置创建客户端，model 和 temperature 非空时覆盖配置
+func (m *Manager) instance(name, model string, temperature float64) (Provider, error) {
+	if p, ok := m.registered[name]; ok {
+		return p, nil
+	}
+	pc := m.configs[name]
+	if model == "" {
+		model = pc.Model
+	}
+	if temperature == 0 {
+		temperature = pc.Temperature
+	}
+	timeout := time.Duration(pc.Timeout) * time.Second
+
+	switch pc.Type {
+	case TypeGLM, "":
+		return NewGLM5Client(GLM5Config{
+			Name:        name,
+			APIKey:      pc.APIKey,
+			BaseURL:     pc.BaseURL,
+			Model:       model,
+			MaxTokens:   pc.MaxTokens,
+			Temperature: temperature,
+			Timeout:     timeout,
+		}), nil
+	case TypeOpenAI:
+		return NewOpenAIClient(OpenAIConfig{
+			Name:        name,
+			APIKey:      pc.APIKey,
+			BaseURL:     pc.BaseURL,
+			Model:       model,
+			MaxTokens:   pc.MaxTokens,
+			Temperature: temperature,
+			Timeout:     timeout,
+		})
+	case TypeOllama:
+		return NewOllamaClient(OllamaConfig{
+			Name:        name,
+			BaseURL:     pc.BaseURL,
+			Model:       model,
+			MaxTokens:   pc.MaxTokens,
+			Temperature: temperature,
+			Timeout:     timeout,
+		})
+	case TypeMock:
+		return NewMockClient(name, pc.Responses...), nil
+	}
+	return nil, fmt.Errorf("不支持的类型 %s", pc.Type)
+}
+
+// Status 各提供方的配置和熔断状态
+func (m *Manager) Status() []ProviderStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]ProviderStatus, 0, len(m.order))
+	for _, name := range m.order {
+		pc := m.configs[name]
+		list = append(list, ProviderStatus{
+			Name:    name,
+			Type:    pc.Type,
+			Model:   pc.Model,
+			Local:   pc.Local,
+			Breaker: m.breakers[name].Status(),
+		})
+	}
+	return list
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mockDefaultReply 没有匹配规则也没有预设回复时的回复
+const mockDefaultReply = "mock response"
+
+// mockChunkRunes 流式回复时每段的字符数
+const mockChunkRunes = 4
+
+// MockClient 按脚本回复的模拟模型，不发起网络请求。
+// 先按规则匹配最后一条用户消息，未命中时依次返回预设回复，用完后重复最后一条
+type MockClient struct {
+	name string
+
+	mu      sync.Mutex
+	rules   []mockRule
+	replies []string
+	next    int
+	err     error
+	calls   [][]Message
+}
+
+type mockRule struct {
+	contains string
+	reply    string
+}
+
+// NewMockClient 创建模拟模型
+func NewMockClient(name string, replies ...string) *MockClient {
+	if name == "" {
+		name = TypeMock
+	}
+	return &MockClient{name: name, replies: replies}
+}
+
+// On 提示词包含 contains 时回复 reply，先添加的规则优先
+func (c *MockClient) On(contains, reply string) *MockClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = append(c.rules, mockRule{contains: contains, reply: reply})
+	return c
+}
+
+// FailWith 之后的请求都返回 err，传 nil 恢复正常，用于验证降级和熔断
+func (c *MockClient) FailWith(err error) *MockClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	return c
+}
+
+// Calls 收到的全部请求
+func (c *MockClient) Calls() [][]Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]Message(nil), c.calls...)
+}
+
+// Name 实现 Provider
+func (c *MockClient) Name() string {
+	return c.name
+}
+
+// Chat 按脚本回复
+func (c *MockClient) Chat(messages []Message) (*ChatResponse, error) {
+	reply, err := c.reply(messages)
+	if err != nil {
+		return nil, err
+	}
+	return c.response(reply), nil
+}
+
+// ChatStream 按脚本回复，每段 mockChunkRunes 个字符
+func (c *MockClient) ChatStream(ctx context.Context, messages []Message, onDelta StreamHandler) (*ChatResponse, error) {
+	reply, err := c.reply(messages)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(reply)
+	for i := 0; i < len(runes); i += mockChunkRunes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := i + mockChunkRunes
+		if end > len(runes) {
+			end = len(runes)
+		}
+		if err := onDelta(string(runes[i:end])); err != nil {
+			return nil, err
+		}
+	}
+	return c.response(reply), nil
+}
+
+func (c *MockClient) response(reply string) *ChatResponse {
+	return &ChatResponse{
+		Model:   c.name,
+		Created: time.Now().Unix(),
+		Choices: []Choice{{Message: Message{Role: "assistant", Content: reply}, FinishReason: "stop"}},
+	}
+}
+
+// reply 记录请求并选出回复
+func (c *MockClient) reply(messages []Message) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, append([]Message(nil), messages...))
+	if c.err != nil {
+		return "", c.err
+	}
+
+	var prompt string
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			prompt = messages[i].Content
+			break
+		}
+	}
+	reply := ""
+	matched := false
+	for _, r := range c.rules {
+		if strings.Contains(prompt, r.contains) {
+			reply, matched = r.reply, true
+			break
+		}
+	}
+	if !matched {
+		switch {
+		case len(c.replies) == 0:
+			reply = mockDefaultReply
+		case c.next < len(c.replies):
+			reply = c.replies[c.next]
+			c.next++
+		default:
+			reply = c.replies[len(c.replies)-1]
+		}
+	}
+
+	return reply, nil
+}
+
+// QuickChat 快速聊天
+func (c *MockClient) QuickChat(prompt string) (string, error) {
+	return quickChat(c, prompt)
+}
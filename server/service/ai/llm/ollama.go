@@ -0,0 +1,208 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OllamaConfig Ollama 配置
+type OllamaConfig struct {
+	Name        string        `json:"name"`
+	BaseURL     string        `json:"baseUrl"` // 如 http://127.0.0.1:11434
+	Model       string        `json:"model"`   // 如 qwen2.5:14b
+	MaxTokens   int           `json:"maxTokens"`
+	Temperature float64       `json:"temperature"`
+	Timeout     time.Duration `json:"timeout"`
+}
+
+// OllamaClient Ollama 原生接口客户端，数据不出内网
+type OllamaClient struct {
+	config       OllamaConfig
+	httpClient   *http.Client
+	streamClient *http.Client
+}
+
+// ollamaRequest /api/chat 请求
+type ollamaRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+	Options  struct {
+		Temperature float64 `json:"temperature,omitempty"`
+		NumPredict  int     `json:"num_predict,omitempty"`
+	} `json:"options"`
+}
+
+// ollamaResponse /api/chat 响应，流式时每行一个，最后一行 done 为 true 并带统计
+type ollamaResponse struct {
+	Model           string  `json:"model"`
+	CreatedAt       string  `json:"created_at"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+	Error           string  `json:"error"`
+}
+
+// NewOllamaClient 创建 Ollama 客户端
+func NewOllamaClient(config OllamaConfig) (*OllamaClient, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = "http://127.0.0.1:11434"
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if config.Model == "" {
+		return nil, errors.New("Ollama 需要指定 model")
+	}
+	if config.Timeout == 0 {
+		// 本地模型首次加载较慢
+		config.Timeout = 3 * defaultTimeout
+	}
+
+	return &OllamaClient{
+		config:       config,
+		httpClient:   &http.Client{Timeout: config.Timeout},
+		streamClient: newStreamClient(config.Timeout),
+	}, nil
+}
+
+// Name 实现 Provider
+func (c *OllamaClient) Name() string {
+	if c.config.Name != "" {
+		return c.config.Name
+	}
+	return TypeOllama
+}
+
+// request 构造 /api/chat 请求体
+func (c *OllamaClient) request(messages []Message, stream bool) ([]byte, error) {
+	req := ollamaRequest{Model: c.config.Model, Messages: messages, Stream: stream}
+	req.Options.Temperature = c.config.Temperature
+	req.Options.NumPredict = c.config.MaxTokens
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+	return body, nil
+}
+
+// Chat 发送聊天请求，响应转换为 OpenAI 格式
+func (c *OllamaClient) Chat(messages []Message) (*ChatResponse, error) {
+	body, err := c.request(messages, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Post(c.config.BaseURL+"/api/chat", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	var or ollamaResponse
+	if err := json.Unmarshal(respBody, &or); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("API 错误: HTTP %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+	if or.Error != "" {
+		return nil, fmt.Errorf("API 错误: %s", or.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API 错误: HTTP %d", resp.StatusCode)
+	}
+	return or.toChatResponse(or.Message.Content), nil
+}
+
+// ChatStream 流式聊天，Ollama 按行返回 JSON 而不是 SSE
+func (c *OllamaClient) ChatStream(ctx context.Context, messages []Message, onDelta StreamHandler) (*ChatResponse, error) {
+	body, err := c.request(messages, true)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.config.BaseURL+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	resp, err := c.streamClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxStreamLine))
+		var or ollamaResponse
+		if json.Unmarshal(respBody, &or) == nil && or.Error != "" {
+			return nil, fmt.Errorf("API 错误: %s", or.Error)
+		}
+		return nil, fmt.Errorf("API 错误: HTTP %d", resp.StatusCode)
+	}
+
+	var content strings.Builder
+	var last ollamaResponse
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var or ollamaResponse
+		if err := json.Unmarshal(line, &or); err != nil {
+			return nil, fmt.Errorf("解析响应失败: %w", err)
+		}
+		if or.Error != "" {
+			return nil, fmt.Errorf("API 错误: %s", or.Error)
+		}
+		if or.Message.Content != "" {
+			content.WriteString(or.Message.Content)
+			if err := onDelta(or.Message.Content); err != nil {
+				return nil, err
+			}
+		}
+		last = or
+		if or.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	return last.toChatResponse(content.String()), nil
+}
+
+// toChatResponse 转换为 OpenAI 格式，content 为完整回复
+func (or ollamaResponse) toChatResponse(content string) *ChatResponse {
+	chatResp := &ChatResponse{Model: or.Model, Created: time.Now().Unix()}
+	if t, err := time.Parse(time.RFC3339Nano, or.CreatedAt); err == nil {
+		chatResp.Created = t.Unix()
+	}
+	chatResp.Choices = []Choice{{Message: Message{Role: "assistant", Content: content}, FinishReason: or.DoneReason}}
+	chatResp.Usage.PromptTokens = or.PromptEvalCount
+	chatResp.Usage.CompletionTokens = or.EvalCount
+	chatResp.Usage.TotalTokens = or.PromptEvalCount + or.EvalCount
+	return chatResp
+}
+
+// QuickChat 快速聊天
+func (c *OllamaClient) QuickChat(prompt string) (string, error) {
+	return quickChat(c, prompt)
+}
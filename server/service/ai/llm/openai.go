@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIConfig OpenAI 兼容接口配置
+type OpenAIConfig struct {
+	Name        string        `json:"name"`
+	APIKey      string        `json:"apiKey"`  // 本地部署的服务可以为空
+	BaseURL     string        `json:"baseUrl"` // 到 /v1 为止，如 http://127.0.0.1:8000/v1
+	Model       string        `json:"model"`
+	MaxTokens   int           `json:"maxTokens"`
+	Temperature float64       `json:"temperature"`
+	Timeout     time.Duration `json:"timeout"`
+}
+
+// OpenAIClient OpenAI 兼容接口客户端，可对接 OpenAI、Azure 以外的各家兼容端点以及 vLLM、llama.cpp server 等本地服务
+type OpenAIClient struct {
+	config       OpenAIConfig
+	httpClient   *http.Client
+	streamClient *http.Client
+}
+
+// NewOpenAIClient 创建 OpenAI 兼容接口客户端
+func NewOpenAIClient(config OpenAIConfig) (*OpenAIClient, error) {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://api.openai.com/v1"
+	}
+	config.BaseURL = strings.TrimRight(config.BaseURL, "/")
+	if config.Model == "" {
+		return nil, errors.New("OpenAI 兼容接口需要指定 model")
+	}
+	if config.MaxTokens == 0 {
+		config.MaxTokens = 4096
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	return &OpenAIClient{
+		config:       config,
+		httpClient:   &http.Client{Timeout: config.Timeout},
+		streamClient: newStreamClient(config.Timeout),
+	}, nil
+}
+
+// Name 实现 Provider
+func (c *OpenAIClient) Name() string {
+	if c.config.Name != "" {
+		return c.config.Name
+	}
+	return TypeOpenAI
+}
+
+// Chat 发送聊天请求
+func (c *OpenAIClient) Chat(messages []Message) (*ChatResponse, error) {
+	return postChatCompletions(c.httpClient, c.config.BaseURL, c.config.APIKey, ChatRequest{
+		Model:       c.config.Model,
+		Messages:    messages,
+		MaxTokens:   c.config.MaxTokens,
+		Temperature: c.config.Temperature,
+	})
+}
+
+// ChatStream 流式聊天
+func (c *OpenAIClient) ChatStream(ctx context.Context, messages []Message, onDelta StreamHandler) (*ChatResponse, error) {
+	return streamChatCompletions(ctx, c.streamClient, c.config.BaseURL, c.config.APIKey, ChatRequest{
+		Model:       c.config.Model,
+		Messages:    messages,
+		MaxTokens:   c.config.MaxTokens,
+		Temperature: c.config.Temperature,
+	}, onDelta)
+}
+
+// QuickChat 快速聊天
+func (c *OpenAIClient) QuickChat(prompt string) (string, error) {
+	return quickChat(c, prompt)
+}
@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Provider 大模型提供方。各 AI 功能只依赖这个接口，具体用哪家模型、哪个型号由配置按功能和租户决定
+type Provider interface {
+	// Name 提供方名称，即配置中的 name
+	Name() string
+	// Chat 发送多轮对话
+	Chat(messages []Message) (*ChatResponse, error)
+	// QuickChat 发送单条提示词，返回回复文本
+	QuickChat(prompt string) (string, error)
+	// ChatStream 流式发送多轮对话，每收到一段内容调用 onDelta，结束后返回完整回复；
+	// ctx 取消或 onDelta 返回错误时中止
+	ChatStream(ctx context.Context, messages []Message, onDelta StreamHandler) (*ChatResponse, error)
+}
+
+// 提供方类型
+const (
+	TypeGLM    = "glm"    // 智谱 GLM
+	TypeOpenAI = "openai" // OpenAI 兼容接口，包括 vLLM、llama.cpp server、各家云厂商的兼容端点
+	TypeOllama = "ollama" // Ollama 本地模型
+	TypeMock   = "mock"   // 按脚本回复的模拟模型，用于测试和演示
+)
+
+// 使用大模型的功能，用于按功能选择提供方、型号和温度
+const (
+	FeatureDecision     = "decision"       // 服务器分析和 AI 决策
+	FeatureDiagnose     = "diagnose"       // 多步诊断，需要模型能稳定按格式调用工具
+	FeaturePrediction   = "prediction"     // 资源趋势预测
+	FeatureInspector    = "inspector"      // 智能巡检
+	FeatureWorkflow     = "workflow"       // 自愈工作流
+	FeatureCert         = "cert"           // 证书续期
+	FeatureCDN          = "cdn"            // CDN 优化
+	FeatureCanary       = "canary"         // 灰度发布分析
+	FeatureScaler       = "scaler"         // Kubernetes 扩缩容
+	FeatureLoadBalancer = "loadbalancer"   // 负载均衡优化
+	FeatureDeployPlan   = "deploy-planner" // 部署方案
+	FeatureIncident     = "incident"       // 故障复盘报告
+)
+
+// Features 全部功能，用于查看各功能的路由
+var Features = []string{
+	FeatureDecision, FeatureDiagnose, FeaturePrediction, FeatureInspector, FeatureWorkflow, FeatureCert, FeatureCDN,
+	FeatureCanary, FeatureScaler, FeatureLoadBalancer, FeatureDeployPlan, FeatureIncident,
+}
+
+// ErrNoResponse 模型返回了空结果
+var ErrNoResponse = errors.New("无响应内容")
+
+// quickChat 用 Chat 实现 QuickChat
+func quickChat(p Provider, prompt string) (string, error) {
+	resp, err := p.Chat([]Message{{Role: "user", Content: prompt}})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", ErrNoResponse
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// postChatCompletions 调用 OpenAI 协议的 /chat/completions，GLM 和 OpenAI 兼容端点共用
+func postChatCompletions(client *http.Client, baseURL, apiKey string, req ChatRequest) (*ChatResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+
+	var chatResp ChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("API 错误: HTTP %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("解析响应失败: %w", err)
+	}
+
+	if chatResp.Error != nil {
+		return nil, fmt.Errorf("API 错误: %s - %s", chatResp.Error.Code, chatResp.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API 错误: HTTP %d", resp.StatusCode)
+	}
+
+	return &chatResp, nil
+}
+
+// defaultTimeout 未配置超时时的请求超时
+const defaultTimeout = 60 * time.Second
@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StreamHandler 流式输出时每收到一段内容回调一次，返回错误时中止请求
+type StreamHandler func(delta string) error
+
+// maxStreamLine SSE 和 NDJSON 单行的最大长度
+const maxStreamLine = 1 << 20
+
+// newStreamClient 流式请求的 HTTP 客户端。生成时间不可预估，不设整体超时，
+// 只限制等待响应头的时间，中途取消通过 context
+func newStreamClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: timeout,
+		},
+	}
+}
+
+// readSSE 解析 Server-Sent Events，每个事件的 data 回调一次，多行 data 以换行拼接
+func readSSE(r io.Reader, onData func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		d := strings.Join(data, "\n")
+		data = data[:0]
+		return onData(d)
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// 注释，常用作心跳
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// errStreamDone 收到 [DONE]，结束读取
+var errStreamDone = errors.New("stream done")
+
+// streamChunk OpenAI 协议的流式分片
+type streamChunk struct {
+	ID      string `json:"id"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index int `json:"index"`
+		Delta struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// streamChatCompletions 以流式调用 OpenAI 协议的 /chat/completions，结束后返回拼接好的完整回复
+func streamChatCompletions(ctx context.Context, client *http.Client, baseURL, apiKey string, req ChatRequest, onDelta StreamHandler) (*ChatResponse, error) {
+	req.Stream = true
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	if apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// 出错时按普通 JSON 返回
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxStreamLine))
+		var errResp ChatResponse
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Error != nil {
+			return nil, fmt.Errorf("API 错误: %s - %s", errResp.Error.Code, errResp.Error.Message)
+		}
+		return nil, fmt.Errorf("API 错误: HTTP %d", resp.StatusCode)
+	}
+
+	result := &ChatResponse{}
+	var content strings.Builder
+	finish := ""
+	err = readSSE(resp.Body, func(data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+		var chunk streamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("解析响应失败: %w", err)
+		}
+		if chunk.Error != nil {
+			return fmt.Errorf("API 错误: %s - %s", chunk.Error.Code, chunk.Error.Message)
+		}
+		if result.ID == "" {
+			result.ID, result.Created, result.Model = chunk.ID, chunk.Created, chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage.PromptTokens = chunk.Usage.PromptTokens
+			result.Usage.CompletionTokens = chunk.Usage.CompletionTokens
+			result.Usage.TotalTokens = chunk.Usage.TotalTokens
+		}
+		for _, c := range chunk.Choices {
+			if c.Index != 0 {
+				continue
+			}
+			if c.FinishReason != nil {
+				finish = *c.FinishReason
+			}
+			if c.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(c.Delta.Content)
+			if err := onDelta(c.Delta.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errStreamDone {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	result.Choices = []Choice{{Message: Message{Role: "assistant", Content: content.String()}, FinishReason: finish}}
+	return result, nil
+}
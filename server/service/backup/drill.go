@@ -3,13 +3,18 @@ package backup
 import (
         "context"
         "encoding/json"
+        "errors"
         "fmt"
         "os/exec"
         "strings"
         "sync"
         "time"
 
+        "yunwei/config"
+        "yunwei/global"
         "yunwei/model/backup"
+        "yunwei/service/mail"
+        "yunwei/service/notify"
 )
 
 // DrillService 灾备演练服务
@@ -71,7 +76,24 @@ type StepResult struct {
 }
 
 // ExecuteDrill 执行灾备演练
+// 演练结束（完成或关键步骤失败）后把报告邮件发给 alerting.notify.drill-report-to，取消的演练不发送
 func (s *DrillService) ExecuteDrill(ctx context.Context, plan *backup.DrillPlan) (*DrillResult, error) {
+        result, err := s.runDrill(ctx, plan)
+        if result != nil && !errors.Is(err, errDrillCancelled) {
+                go func() {
+                        if err := s.EmailDrillReport(plan.ID, result, config.CONFIG.Alerting.Notify.DrillReportTo); err != nil {
+                                global.Logger.Warn(fmt.Sprintf("发送演练报告失败: drill=%d, %v", plan.ID, err))
+                        }
+                }()
+        }
+        return result, err
+}
+
+// errDrillCancelled 演练被取消
+var errDrillCancelled = errors.New("演练已取消")
+
+// runDrill 依次执行演练步骤并评分
+func (s *DrillService) runDrill(ctx context.Context, plan *backup.DrillPlan) (*DrillResult, error) {
         s.mu.Lock()
         s.activeDrills[plan.ID] = &DrillContext{
                 DrillID:   plan.ID,
@@ -116,7 +138,7 @@ func (s *DrillService) ExecuteDrill(ctx context.Context, plan *backup.DrillPlan)
                         s.mu.Unlock()
                         logBuilder.WriteString("[WARN] 演练已取消\n")
                         result.Log = logBuilder.String()
-                        return result, fmt.Errorf("演练已取消")
+                        return result, errDrillCancelled
                 }
                 s.mu.Unlock()
 
@@ -638,3 +660,43 @@ func (s *DrillService) GenerateDrillReport(drillID uint, result *DrillResult) (s
 
         return report.String(), nil
 }
+
+// EmailDrillReport 以邮件发送演练报告，完整报告作为 Markdown 附件；to 为空时发给默认邮件收件人
+func (s *DrillService) EmailDrillReport(drillID uint, result *DrillResult, to []string) error {
+        if len(to) == 0 {
+                to = config.CONFIG.Alerting.Notify.EmailTo
+        }
+        content, err := s.GenerateDrillReport(drillID, result)
+        if err != nil {
+                return err
+        }
+
+        status := "成功"
+        if !result.Success {
+                status = "失败"
+        }
+        report := notify.ReportTemplate{
+                Title:     fmt.Sprintf("灾备演练报告 #%d（%s）", drillID, status),
+                Summary:   fmt.Sprintf("评分 %d/100，总耗时 %d 秒", result.Score, result.Duration),
+                Details: []string{
+                        fmt.Sprintf("实际RTO: %d 秒（%s）", result.ActualRTO, metText(result.RTOMet)),
+                        fmt.Sprintf("实际RPO: %d 分钟（%s）", result.ActualRPO, metText(result.RPOMet)),
+                },
+                Recommendations: result.Improvements,
+                Timestamp:       time.Now(),
+        }
+        report.Details = append(report.Details, result.Findings...)
+
+        return notify.SendEmailReport(to, report, mail.Attachment{
+                Filename:    fmt.Sprintf("drill-report-%d.md", drillID),
+                ContentType: "text/markdown; charset=UTF-8",
+                Data:        []byte(content),
+        })
+}
+
+func metText(met bool) string {
+        if met {
+                return "达标"
+        }
+        return "未达标"
+}
@@ -9,7 +9,9 @@ import (
 
         "yunwei/global"
         "yunwei/service/ai/llm"
+        "yunwei/service/event"
         "yunwei/service/notify"
+        "yunwei/service/slo"
 )
 
 // DeployStatus 发布状态
@@ -39,6 +41,7 @@ type CanaryRelease struct {
         ID          uint      `json:"id" gorm:"primarykey"`
         CreatedAt   time.Time `json:"createdAt"`
         UpdatedAt   time.Time `json:"updatedAt"`
+        TenantID    string    `json:"tenantId" gorm:"type:varchar(36);index"`
 
         ClusterID   uint         `json:"clusterId" gorm:"index"`
         Namespace   string       `json:"namespace" gorm:"type:varchar(64)"`
@@ -153,9 +156,15 @@ func (CanaryConfig) TableName() string {
 
 // CanaryManager 灰度发布管理器
 type CanaryManager struct {
-        llmClient *llm.GLM5Client
+        llmClient llm.Provider
         notifier  notify.Notifier
         executor  CanaryExecutor
+        gate      BudgetGate
+}
+
+// BudgetGate 发布前的错误预算检查，服务的错误预算耗尽时返回错误
+type BudgetGate interface {
+        CheckRelease(tenantID, service string) error
 }
 
 // CanaryExecutor 灰度执行器接口
@@ -177,11 +186,11 @@ type CanaryMetrics struct {
 
 // NewCanaryManager 创建灰度发布管理器
 func NewCanaryManager() *CanaryManager {
-        return &CanaryManager{}
+        return &CanaryManager{notifier: notify.Default(), gate: slo.GetService(), llmClient: llm.For(llm.FeatureCanary, "")}
 }
 
 // SetLLMClient 设置 LLM 客户端
-func (m *CanaryManager) SetLLMClient(client *llm.GLM5Client) {
+func (m *CanaryManager) SetLLMClient(client llm.Provider) {
         m.llmClient = client
 }
 
@@ -195,8 +204,25 @@ func (m *CanaryManager) SetExecutor(executor CanaryExecutor) {
         m.executor = executor
 }
 
+// SetBudgetGate 设置错误预算检查，设为 nil 时不检查
+func (m *CanaryManager) SetBudgetGate(gate BudgetGate) {
+        m.gate = gate
+}
+
+// checkBudget 错误预算耗尽时阻止开始、推进和完成发布，回滚、暂停和中止不受影响
+func (m *CanaryManager) checkBudget(tenantID, serviceName string) error {
+        if m.gate == nil {
+                return nil
+        }
+        return m.gate.CheckRelease(tenantID, serviceName)
+}
+
 // StartCanary 开始灰度发布
-func (m *CanaryManager) StartCanary(clusterID uint, namespace, serviceName, newImage string, config CanaryConfig) (*CanaryRelease, error) {
+func (m *CanaryManager) StartCanary(tenantID string, clusterID uint, namespace, serviceName, newImage string, config CanaryConfig) (*CanaryRelease, error) {
+        if err := m.checkBudget(tenantID, serviceName); err != nil {
+                return nil, err
+        }
+
         // 获取当前版本
         currentVersion, err := m.executor.GetCurrentVersion(clusterID, namespace, serviceName)
         if err != nil {
@@ -204,6 +230,7 @@ func (m *CanaryManager) StartCanary(clusterID uint, namespace, serviceName, newI
         }
 
         release := &CanaryRelease{
+                TenantID:            tenantID,
                 ClusterID:           clusterID,
                 Namespace:           namespace,
                 ServiceName:         serviceName,
@@ -222,6 +249,8 @@ func (m *CanaryManager) StartCanary(clusterID uint, namespace, serviceName, newI
         }
 
         global.DB.Create(release)
+        publishEvent(release, "started", event.SeverityInfo,
+                fmt.Sprintf("开始灰度发布 %s，初始权重 %.1f%%", newImage, release.CanaryWeight), "")
 
         // 执行第一步
         return m.executeStep(release, config)
@@ -317,6 +346,9 @@ func (m *CanaryManager) Promote(releaseID uint) (*CanaryRelease, error) {
         if release.Status != DeployStatusRunning && release.Status != DeployStatusPaused {
                 return nil, fmt.Errorf("当前状态不允许推进")
         }
+        if err := m.checkBudget(release.TenantID, release.ServiceName); err != nil {
+                return nil, err
+        }
 
         // 获取配置
         var config CanaryConfig
@@ -333,6 +365,8 @@ func (m *CanaryManager) Promote(releaseID uint) (*CanaryRelease, error) {
         }
 
         global.DB.Save(&release)
+        publishEvent(&release, "promoted", event.SeverityInfo,
+                fmt.Sprintf("灰度权重推进到 %.1f%%", release.CanaryWeight), "")
 
         return m.executeStep(&release, config)
 }
@@ -343,12 +377,16 @@ func (m *CanaryManager) Complete(releaseID uint) (*CanaryRelease, error) {
         if err := global.DB.First(&release, releaseID).Error; err != nil {
                 return nil, fmt.Errorf("发布记录不存在")
         }
+        if err := m.checkBudget(release.TenantID, release.ServiceName); err != nil {
+                return nil, err
+        }
 
         // 提升为正式版本
         err := m.executor.PromoteCanary(release.ClusterID, release.Namespace, release.ServiceName)
         if err != nil {
                 release.Status = DeployStatusFailed
                 global.DB.Save(&release)
+                publishEvent(&release, "failed", event.SeverityWarning, "灰度版本提升为正式版本失败", err.Error())
                 return &release, fmt.Errorf("提升版本失败: %w", err)
         }
 
@@ -361,6 +399,7 @@ func (m *CanaryManager) Complete(releaseID uint) (*CanaryRelease, error) {
                 release.Duration = int64(completedAt.Sub(*release.StartedAt).Seconds())
         }
         global.DB.Save(&release)
+        publishEvent(&release, "succeeded", event.SeverityInfo, "灰度发布完成，已升级到 "+release.NewVersion, "")
 
         // 发送通知
         if m.notifier != nil {
@@ -393,6 +432,7 @@ func (m *CanaryManager) Rollback(releaseID uint, reason string) (*CanaryRelease,
         release.RollbackReason = reason
         release.RollbackAt = &rollbackAt
         global.DB.Save(&release)
+        publishEvent(&release, "rolled_back", event.SeverityWarning, "灰度发布已回滚到 "+release.CurrentVersion, reason)
 
         // 发送通知
         if m.notifier != nil {
@@ -433,6 +473,25 @@ func (m *CanaryManager) Abort(releaseID uint) (*CanaryRelease, error) {
         return m.Rollback(releaseID, "用户主动中止发布")
 }
 
+// publishEvent 灰度发布状态变化写入事件流。发布不对应具体服务器，以集群、命名空间和服务作为标签
+func publishEvent(release *CanaryRelease, action, severity, title, detail string) {
+        event.Publish(&event.Event{
+                Type:     event.TypeCanary,
+                Action:   action,
+                Severity: severity,
+                Title:    fmt.Sprintf("%s/%s %s", release.Namespace, release.ServiceName, title),
+                Detail:   detail,
+                Labels: event.MakeLabels(
+                        "cluster", fmt.Sprint(release.ClusterID),
+                        "namespace", release.Namespace,
+                        "service", release.ServiceName,
+                        "version", release.NewVersion,
+                ),
+                Source:   "canary_release",
+                SourceID: release.ID,
+        })
+}
+
 // CanaryDecision 灰度决策
 type CanaryDecision struct {
         ShouldPromote bool    `json:"shouldPromote"`
@@ -198,7 +198,7 @@ func (CDNOptimizationRecord) TableName() string {
 
 // CDNManager CDN 管理器
 type CDNManager struct {
-	llmClient *llm.GLM5Client
+	llmClient llm.Provider
 	notifier  notify.Notifier
 	executor  CDNExecutor
 }
@@ -257,11 +257,11 @@ type RegionStat struct {
 
 // NewCDNManager 创建 CDN 管理器
 func NewCDNManager() *CDNManager {
-	return &CDNManager{}
+	return &CDNManager{notifier: notify.Default(), llmClient: llm.For(llm.FeatureCDN, "")}
 }
 
 // SetLLMClient 设置 LLM 客户端
-func (m *CDNManager) SetLLMClient(client *llm.GLM5Client) {
+func (m *CDNManager) SetLLMClient(client llm.Provider) {
 	m.llmClient = client
 }
 
@@ -332,6 +332,9 @@ type CDNAction struct {
 
 // analyzeWithAI AI 分析
 func (m *CDNManager) analyzeWithAI(domain *CDNDomain, status *DomainStatus, metrics *DomainMetrics) (*CDNOptimizeDecision, error) {
+	if m.llmClient == nil {
+		return nil, fmt.Errorf("未配置可用的 AI 模型")
+	}
 	statusJSON, _ := json.Marshal(status)
 
 	prompt := fmt.Sprintf(`你是一个 CDN 优化专家。请分析以下 CDN 状态并给出优化建议。
@@ -137,7 +137,7 @@ func (RenewalRecord) TableName() string {
 
 // CertRenewalManager 证书续期管理器
 type CertRenewalManager struct {
-        llmClient *llm.GLM5Client
+        llmClient llm.Provider
         notifier  notify.Notifier
         executor  CertExecutor
 }
@@ -161,11 +161,11 @@ type CertInfo struct {
 
 // NewCertRenewalManager 创建证书续期管理器
 func NewCertRenewalManager() *CertRenewalManager {
-        return &CertRenewalManager{}
+        return &CertRenewalManager{notifier: notify.Default(), llmClient: llm.For(llm.FeatureCert, "")}
 }
 
 // SetLLMClient 设置 LLM 客户端
-func (m *CertRenewalManager) SetLLMClient(client *llm.GLM5Client) {
+func (m *CertRenewalManager) SetLLMClient(client llm.Provider) {
         m.llmClient = client
 }
 
@@ -0,0 +1,116 @@
+package chatops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunwei/config"
+)
+
+// 动作
+const (
+	VerbAck     = "ack"     // 确认
+	VerbSilence = "silence" // 静默
+	VerbApprove = "approve" // 批准
+	VerbReject  = "reject"  // 拒绝
+)
+
+// 动作对象，取简写以控制 Telegram callback_data 的长度（最多 64 字节）
+const (
+	KindIncident  = "inc"
+	KindAlert     = "alert"
+	KindDecision  = "dec"
+	KindExecution = "exec"
+)
+
+const defaultActionTTL = 24 * time.Hour
+
+// ErrDisabled 未配置签名密钥
+var ErrDisabled = errors.New("未启用 ChatOps")
+
+// Action 消息按钮携带的动作，签名后作为 Telegram callback_data、钉钉消息链接和飞书卡片按钮的值。
+// 签名防止伪造按钮操作任意对象，过期时间防止旧消息中的按钮被长期使用
+type Action struct {
+	Verb      string
+	Kind      string
+	ID        uint
+	ExpiresAt time.Time
+}
+
+// Enabled 是否启用了消息按钮
+func Enabled() bool {
+	return config.CONFIG.ChatOps.Secret != ""
+}
+
+// NewAction 按配置的有效期创建动作
+func NewAction(verb, kind string, id uint) Action {
+	ttl := defaultActionTTL
+	if h := config.CONFIG.ChatOps.ActionTTL; h > 0 {
+		ttl = time.Duration(h) * time.Hour
+	}
+	return Action{Verb: verb, Kind: kind, ID: id, ExpiresAt: time.Now().Add(ttl)}
+}
+
+func (a Action) payload() string {
+	return fmt.Sprintf("%s:%s:%d:%s", a.Verb, a.Kind, a.ID, strconv.FormatInt(a.ExpiresAt.Unix(), 36))
+}
+
+func signPayload(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Sign 签名动作，格式为 verb:kind:id:过期时间:签名
+func (a Action) Sign() (string, error) {
+	secret := config.CONFIG.ChatOps.Secret
+	if secret == "" {
+		return "", ErrDisabled
+	}
+	payload := a.payload()
+	return payload + ":" + signPayload(secret, payload), nil
+}
+
+// ParseAction 校验签名和有效期并解析动作
+func ParseAction(token string, now time.Time) (*Action, error) {
+	secret := config.CONFIG.ChatOps.Secret
+	if secret == "" {
+		return nil, ErrDisabled
+	}
+	i := strings.LastIndex(token, ":")
+	if i < 0 || !hmac.Equal([]byte(signPayload(secret, token[:i])), []byte(token[i+1:])) {
+		return nil, errors.New("操作签名无效")
+	}
+
+	parts := strings.Split(token[:i], ":")
+	if len(parts) != 4 {
+		return nil, errors.New("操作格式错误")
+	}
+	id, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return nil, errors.New("操作格式错误")
+	}
+	exp, err := strconv.ParseInt(parts[3], 36, 64)
+	if err != nil {
+		return nil, errors.New("操作格式错误")
+	}
+	a := &Action{Verb: parts[0], Kind: parts[1], ID: uint(id), ExpiresAt: time.Unix(exp, 0)}
+	if !now.Before(a.ExpiresAt) {
+		return nil, errors.New("操作已过期，请在控制台处理")
+	}
+	return a, nil
+}
+
+// Signature 签名部分，写入审计日志以便追溯审批来自哪条消息
+func Signature(token string) string {
+	if i := strings.LastIndex(token, ":"); i >= 0 {
+		return token[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package chatops
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"yunwei/service/security"
+
+	"gorm.io/gorm"
+)
+
+// 聊天平台
+const (
+	PlatformTelegram = "telegram"
+	PlatformDingTalk = "dingtalk"
+	PlatformFeishu   = "feishu"
+)
+
+// Identity 聊天账号与平台用户的绑定。聊天中的操作以绑定的用户身份执行，按其角色校验权限
+type Identity struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Platform     string `json:"platform" gorm:"type:varchar(16);not null;uniqueIndex:idx_chat_identities_platform_external"`
+	ExternalID   string `json:"externalId" gorm:"type:varchar(128);not null;uniqueIndex:idx_chat_identities_platform_external"` // Telegram user id、钉钉 senderStaffId、飞书 open_id
+	ExternalName string `json:"externalName" gorm:"type:varchar(64)"`                                                           // 聊天中的显示名，仅供查看
+	UserID       uint   `json:"userId" gorm:"index;not null"`
+	Comment      string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (Identity) TableName() string {
+	return "chat_identities"
+}
+
+// Validate 校验绑定
+func (i *Identity) Validate() error {
+	switch i.Platform {
+	case PlatformTelegram, PlatformDingTalk, PlatformFeishu:
+	default:
+		return fmt.Errorf("不支持的平台 %s", i.Platform)
+	}
+	if i.ExternalID == "" {
+		return errors.New("缺少聊天账号 ID")
+	}
+	if i.UserID == 0 {
+		return errors.New("缺少绑定的用户")
+	}
+	return nil
+}
+
+// Sender 回调中的聊天账号
+type Sender struct {
+	Platform string
+	ID       string
+	Name     string
+}
+
+func (s Sender) String() string {
+	if s.Name != "" {
+		return fmt.Sprintf("%s %s(%s)", s.Platform, s.Name, s.ID)
+	}
+	return s.Platform + " " + s.ID
+}
+
+// resolveUser 查找聊天账号绑定的平台用户，未绑定或已禁用时返回可直接回复给用户的错误
+func resolveUser(db *gorm.DB, sender Sender) (*security.User, error) {
+	var identity Identity
+	if err := db.Where("platform = ? AND external_id = ?", sender.Platform, sender.ID).First(&identity).Error; err != nil {
+		return nil, fmt.Errorf("账号 %s 未绑定平台用户，请联系管理员绑定", sender.ID)
+	}
+	var user security.User
+	if err := db.First(&user, identity.UserID).Error; err != nil || user.Status != 1 {
+		return nil, errors.New("绑定的平台用户不存在或已禁用")
+	}
+	return &user, nil
+}
@@ -0,0 +1,62 @@
+package chatops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+
+	"yunwei/config"
+)
+
+// dingtalkMaxSkew 钉钉回调时间戳与本机时间的最大偏差，与钉钉的要求一致
+const dingtalkMaxSkew = time.Hour
+
+// VerifyTelegram 校验 Telegram 回调请求头 X-Telegram-Bot-Api-Secret-Token，
+// 其值为 setWebhook 时设置的 secret_token
+func VerifyTelegram(secretToken string) error {
+	expected := config.CONFIG.ChatOps.TelegramSecretToken
+	if expected == "" {
+		return errors.New("未配置 chatops.telegram-secret-token")
+	}
+	if !hmac.Equal([]byte(secretToken), []byte(expected)) {
+		return errors.New("secret_token 校验失败")
+	}
+	return nil
+}
+
+// VerifyDingTalk 校验钉钉机器人回调的 timestamp、sign 请求头：
+// sign = Base64(HMAC-SHA256(AppSecret, timestamp + "\n" + AppSecret))，timestamp 为毫秒
+func VerifyDingTalk(timestamp, sign string, now time.Time) error {
+	secret := config.CONFIG.ChatOps.DingTalkAppSecret
+	if secret == "" {
+		return errors.New("未配置 chatops.dingtalk-app-secret")
+	}
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("时间戳无效")
+	}
+	if d := now.Sub(time.UnixMilli(ms)); d > dingtalkMaxSkew || d < -dingtalkMaxSkew {
+		return errors.New("签名已过期")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	if !hmac.Equal([]byte(base64.StdEncoding.EncodeToString(mac.Sum(nil))), []byte(sign)) {
+		return errors.New("签名校验失败")
+	}
+	return nil
+}
+
+// VerifyFeishu 校验飞书回调中的 Verification Token，应用需关闭 Encrypt Key 加密
+func VerifyFeishu(token string) error {
+	expected := config.CONFIG.ChatOps.FeishuVerificationToken
+	if expected == "" {
+		return errors.New("未配置 chatops.feishu-verification-token")
+	}
+	if !hmac.Equal([]byte(token), []byte(expected)) {
+		return errors.New("Verification Token 校验失败")
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package chatops
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/model/server"
+	"yunwei/service/ai/decision"
+	"yunwei/service/detector"
+	"yunwei/service/executor"
+	"yunwei/service/metrics"
+	"yunwei/service/metrics/query"
+	"yunwei/service/security"
+	"yunwei/service/silence"
+
+	"gorm.io/gorm"
+)
+
+const defaultSilenceDuration = time.Hour
+
+// Service 执行聊天中的按钮操作和命令
+type Service struct {
+	db    *gorm.DB
+	rbac  *security.RBACManager
+	audit *security.AuditService
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局 ChatOps 服务
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB)
+	})
+	return globalService
+}
+
+// NewService 创建 ChatOps 服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:    db,
+		rbac:  security.NewRBACManager(db),
+		audit: security.NewAuditService(),
+	}
+}
+
+// authorize 查找聊天账号绑定的用户并校验权限
+func (s *Service) authorize(sender Sender, permission string) (*security.User, error) {
+	user, err := resolveUser(s.db, sender)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsAdmin && !s.rbac.CheckPermission(user.ID, permission) {
+		return nil, fmt.Errorf("用户 %s 没有 %s 权限", user.Username, permission)
+	}
+	return user, nil
+}
+
+// actionPermission 各动作需要的权限，与控制台对应接口一致
+func actionPermission(a *Action) (string, error) {
+	switch {
+	case (a.Verb == VerbAck || a.Verb == VerbSilence) && (a.Kind == KindIncident || a.Kind == KindAlert):
+		return "alert:handle", nil
+	case (a.Verb == VerbApprove || a.Verb == VerbReject) && a.Kind == KindDecision:
+		return "ai:approve", nil
+	case (a.Verb == VerbApprove || a.Verb == VerbReject) && a.Kind == KindExecution:
+		return "command:approve", nil
+	}
+	return "", fmt.Errorf("不支持的操作 %s %s", a.Verb, a.Kind)
+}
+
+// Perform 执行按钮操作，返回回复给用户的结果
+func (s *Service) Perform(sender Sender, token string) (string, error) {
+	now := time.Now()
+	action, err := ParseAction(token, now)
+	if err != nil {
+		return "", err
+	}
+	permission, err := actionPermission(action)
+	if err != nil {
+		return "", err
+	}
+	user, err := s.authorize(sender, permission)
+	if err != nil {
+		return "", err
+	}
+
+	switch action.Verb {
+	case VerbAck:
+		return s.acknowledge(user, sender, action, now)
+	case VerbSilence:
+		return s.silence(user, sender, action, now)
+	default:
+		return s.approve(user, sender, action, token)
+	}
+}
+
+func (s *Service) logAction(user *security.User, sender Sender, action security.AuditAction, resource, command string) {
+	s.audit.Log(security.LogParams{
+		UserID:   user.ID,
+		Username: user.Username,
+		Action:   action,
+		Resource: resource,
+		Command:  command,
+		Result:   "success",
+		Details:  map[string]interface{}{"via": sender.String()},
+	})
+}
+
+// ==================== 确认与静默 ====================
+
+func (s *Service) acknowledge(user *security.User, sender Sender, a *Action, now time.Time) (string, error) {
+	var incident *detector.Incident
+	var err error
+	if a.Kind == KindIncident {
+		incident, err = detector.GetAlertManager().AcknowledgeIncident(a.ID, user.ID, now)
+	} else {
+		incident, err = detector.GetAlertManager().AcknowledgeAlert(a.ID, user.ID, now)
+	}
+	if err != nil {
+		return "", fmt.Errorf("确认失败: %w", err)
+	}
+
+	target := fmt.Sprintf("告警 #%d", a.ID)
+	if incident != nil {
+		target = fmt.Sprintf("事件 #%d %s", incident.ID, incident.Title)
+	}
+	s.logAction(user, sender, security.AuditActionUpdate, "incident", "确认"+target)
+	return fmt.Sprintf("%s 已由 %s 确认", target, user.Username), nil
+}
+
+func (s *Service) silence(user *security.User, sender Sender, a *Action, now time.Time) (string, error) {
+	var alerts []detector.Alert
+	if a.Kind == KindIncident {
+		s.db.Where("incident_id = ? AND status <> ?", a.ID, detector.AlertStatusResolved).Find(&alerts)
+		if len(alerts) == 0 {
+			s.db.Where("incident_id = ?", a.ID).Find(&alerts)
+		}
+	} else {
+		s.db.Where("id = ?", a.ID).Find(&alerts)
+	}
+	if len(alerts) == 0 {
+		return "", errors.New("告警不存在")
+	}
+
+	d := defaultSilenceDuration
+	if m := config.CONFIG.ChatOps.SilenceMinutes; m > 0 {
+		d = time.Duration(m) * time.Minute
+	}
+	sl := silence.Silence{
+		Matchers:  silenceMatchers(alerts),
+		StartsAt:  now,
+		EndsAt:    now.Add(d),
+		Comment:   "通过 " + sender.String() + " 创建",
+		CreatedBy: user.ID,
+		Creator:   user.Username,
+	}
+	if err := sl.Validate(); err != nil {
+		return "", fmt.Errorf("无法确定静默范围，请在控制台创建: %w", err)
+	}
+	if err := s.db.Create(&sl).Error; err != nil {
+		return "", errors.New("创建静默失败")
+	}
+	silence.GetService().Invalidate()
+	s.logAction(user, sender, security.AuditActionCreate, "silence",
+		fmt.Sprintf("#%d %s [%s ~ %s] %s", sl.ID, sl.Matchers, sl.StartsAt.Format(time.RFC3339), sl.EndsAt.Format(time.RFC3339), sl.Comment))
+	return fmt.Sprintf("已静默 %s 至 %s（%s）", sl.Matchers, sl.EndsAt.Format("15:04"), user.Username), nil
+}
+
+// silenceMatchers 取告警共同的规则、服务器和租户作为静默条件，只屏蔽本事件覆盖的范围
+func silenceMatchers(alerts []detector.Alert) string {
+	keys := []string{silence.LabelRule, query.LabelServerID, query.LabelTenant}
+	common := make(map[string]string, len(keys))
+	first := alerts[0].MatchLabels()
+	for _, k := range keys {
+		common[k] = first[k]
+	}
+	for _, a := range alerts[1:] {
+		labels := a.MatchLabels()
+		for _, k := range keys {
+			if labels[k] != common[k] {
+				common[k] = ""
+			}
+		}
+	}
+
+	var matchers []string
+	for _, k := range keys {
+		if v := common[k]; v != "" {
+			matchers = append(matchers, k+"="+strconv.Quote(v))
+		}
+	}
+	return strings.Join(matchers, ", ")
+}
+
+// ==================== 审批 ====================
+
+// approve 批准或拒绝待审批的 AI 决策或执行记录，与控制台调用相同的审批接口：
+// 只处理仍在等待审批的记录，批准的执行记录随即开始执行
+func (s *Service) approve(user *security.User, sender Sender, a *Action, token string) (string, error) {
+	approved := a.Verb == VerbApprove
+	reason := fmt.Sprintf("通过 %s 审批，签名 %s", sender, Signature(token))
+
+	var resource, name string
+	var err error
+	if a.Kind == KindDecision {
+		resource, name = "decision", "AI 决策"
+		if approved {
+			_, err = decision.Approve(a.ID, user.ID, user.Username)
+		} else {
+			_, err = decision.Reject(a.ID, user.ID, user.Username, reason)
+		}
+	} else {
+		resource, name = "execution", "执行记录"
+		if approved {
+			_, err = executor.NewExecutor().Approve(a.ID, user.ID)
+		} else {
+			err = executor.NewExecutor().Reject(a.ID, reason)
+		}
+	}
+	if errors.Is(err, decision.ErrNotPending) || errors.Is(err, executor.ErrNotPending) {
+		return "", fmt.Errorf("%s #%d 不存在或已处理", name, a.ID)
+	}
+	if err != nil {
+		return "", fmt.Errorf("审批失败: %w", err)
+	}
+
+	s.audit.LogApproval(user.ID, user.Username, resource, a.ID, approved, reason)
+	result := "批准"
+	if !approved {
+		result = "拒绝"
+	} else if a.Kind == KindExecution {
+		result = "批准，开始执行"
+	}
+	return fmt.Sprintf("%s #%d 已由 %s %s", name, a.ID, user.Username, result), nil
+}
+
+// ==================== 命令 ====================
+
+const helpText = `可用命令：
+/status <服务器> 查看服务器状态
+/alerts 查看未恢复的告警事件
+/help 显示本帮助`
+
+// Command 处理聊天中的文本命令，只提供只读查询；/act 为钉钉消息链接发回的按钮操作
+func (s *Service) Command(sender Sender, text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return helpText
+	}
+	// Telegram 群聊中的命令带机器人名，如 /status@yunwei_bot
+	cmd, _, _ := strings.Cut(strings.ToLower(fields[0]), "@")
+	args := fields[1:]
+
+	switch cmd {
+	case "/act":
+		if len(args) != 1 {
+			return "用法: /act <操作>"
+		}
+		reply, err := s.Perform(sender, args[0])
+		if err != nil {
+			return err.Error()
+		}
+		return reply
+	case "/status":
+		if len(args) != 1 {
+			return "用法: /status <服务器名称或IP>"
+		}
+		if _, err := s.authorize(sender, "server:view"); err != nil {
+			return err.Error()
+		}
+		return s.serverStatus(args[0])
+	case "/alerts":
+		if _, err := s.authorize(sender, "alert:view"); err != nil {
+			return err.Error()
+		}
+		return s.openIncidents()
+	case "/help", "/start":
+		return helpText
+	}
+	return "未知命令，发送 /help 查看可用命令"
+}
+
+func (s *Service) serverStatus(name string) string {
+	var srv server.Server
+	if err := s.db.Where("name = ? OR hostname = ? OR host = ?", name, name, name).First(&srv).Error; err != nil {
+		return "服务器 " + name + " 不存在"
+	}
+
+	cpu, mem, disk := srv.CPUUsage, srv.MemoryUsage, srv.DiskUsage
+	load1, load5, load15 := srv.Load1, srv.Load5, srv.Load15
+	if m, err := metrics.LatestServerMetric(srv.ID); err == nil {
+		cpu, mem, disk = m.CPUUsage, m.MemoryUsage, m.DiskUsage
+		load1, load5, load15 = m.Load1, m.Load5, m.Load15
+	}
+	agent := "离线"
+	if srv.AgentOnline {
+		agent = "在线"
+	}
+	var firing int64
+	s.db.Model(&detector.Alert{}).Where("server_id = ? AND status <> ?", srv.ID, detector.AlertStatusResolved).Count(&firing)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%s)\n", srv.Name, srv.Host)
+	fmt.Fprintf(&b, "状态: %s，Agent %s\n", srv.Status, agent)
+	fmt.Fprintf(&b, "CPU %.1f%%  内存 %.1f%%  磁盘 %.1f%%\n", cpu, mem, disk)
+	fmt.Fprintf(&b, "负载 %.2f / %.2f / %.2f\n", load1, load5, load15)
+	fmt.Fprintf(&b, "未恢复告警: %d", firing)
+	return b.String()
+}
+
+func (s *Service) openIncidents() string {
+	var incidents []detector.Incident
+	s.db.Where("status <> ?", detector.AlertStatusResolved).Order("id DESC").Limit(10).Find(&incidents)
+	if len(incidents) == 0 {
+		return "当前没有未恢复的告警事件"
+	}
+	var b strings.Builder
+	b.WriteString("未恢复的告警事件（最近 10 条）：")
+	for _, i := range incidents {
+		fmt.Fprintf(&b, "\n#%d [%s] %s（%s，%s 起）", i.ID, i.Level, i.Title, i.Status, i.FiredAt.Format("01-02 15:04"))
+	}
+	return b.String()
+}
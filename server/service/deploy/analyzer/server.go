@@ -9,6 +9,7 @@ import (
 
 	"yunwei/global"
 	"yunwei/model/server"
+	"yunwei/service/metrics"
 )
 
 // ServerResourceType 服务器资源类型
@@ -140,9 +141,7 @@ func (a *ServerResourceAnalyzer) AnalyzeServer(srv *server.Server) (*ServerCapab
 	}
 	
 	// 获取最新指标
-	var metric server.ServerMetric
-	result := global.DB.Where("server_id = ?", srv.ID).Order("created_at DESC").First(&metric)
-	if result.Error == nil {
+	if metric, err := metrics.LatestServerMetric(srv.ID); err == nil {
 		capability.CPULoad = metric.CPUUsage
 		capability.MemoryLoad = metric.MemoryUsage
 		capability.DiskLoad = metric.DiskUsage
@@ -8,9 +8,12 @@ import (
         "time"
 
         "yunwei/global"
+        "yunwei/model/server"
         "yunwei/service/deploy/config"
         "yunwei/service/deploy/planner"
+        "yunwei/service/event"
         "yunwei/service/notify"
+        "yunwei/service/slo"
 )
 
 // ExecutorStatus 执行器状态
@@ -88,6 +91,7 @@ func (TaskStep) TableName() string {
 type DeployExecutor struct {
         notifier notify.Notifier
         executor CommandExecutor
+        gate     BudgetGate
         mu       sync.Mutex
         paused   bool
 }
@@ -99,9 +103,14 @@ type CommandExecutor interface {
         DownloadFile(serverID uint, path string) (string, error)
 }
 
+// BudgetGate 部署前的错误预算检查，服务的错误预算耗尽时返回错误
+type BudgetGate interface {
+        CheckRelease(tenantID, service string) error
+}
+
 // NewDeployExecutor 创建部署执行器
 func NewDeployExecutor() *DeployExecutor {
-        return &DeployExecutor{}
+        return &DeployExecutor{notifier: notify.Default(), gate: slo.GetService()}
 }
 
 // SetNotifier 设置通知器
@@ -114,8 +123,53 @@ func (e *DeployExecutor) SetExecutor(executor CommandExecutor) {
         e.executor = executor
 }
 
+// SetBudgetGate 设置错误预算检查，设为 nil 时不检查
+func (e *DeployExecutor) SetBudgetGate(gate BudgetGate) {
+        e.gate = gate
+}
+
+// checkBudget 方案中任一服务的错误预算耗尽时阻止部署
+func (e *DeployExecutor) checkBudget(plan *planner.DeployPlan) error {
+        if e.gate == nil {
+                return nil
+        }
+        var services []planner.ServiceConfig
+        json.Unmarshal([]byte(plan.Services), &services)
+        tenants := planTenants(plan)
+        for _, svc := range services {
+                for _, tenantID := range tenants {
+                        if err := e.gate.CheckRelease(tenantID, svc.Name); err != nil {
+                                return err
+                        }
+                }
+        }
+        return nil
+}
+
+// planTenants 方案分配的服务器所属的租户，没有分配服务器时按全局检查
+func planTenants(plan *planner.DeployPlan) []string {
+        var assignments []planner.ServerAssignment
+        json.Unmarshal([]byte(plan.ServerAssignments), &assignments)
+        ids := make([]uint, 0, len(assignments))
+        for _, a := range assignments {
+                ids = append(ids, a.ServerID)
+        }
+        var tenants []string
+        if len(ids) > 0 {
+                global.DB.Model(&server.Server{}).Where("id IN ?", ids).Distinct().Pluck("tenant_id", &tenants)
+        }
+        if len(tenants) == 0 {
+                tenants = []string{""}
+        }
+        return tenants
+}
+
 // Execute 执行部署
 func (e *DeployExecutor) Execute(plan *planner.DeployPlan) (*DeployTask, error) {
+        if err := e.checkBudget(plan); err != nil {
+                return nil, err
+        }
+
         // 创建任务
         task := &DeployTask{
                 PlanID:   plan.ID,
@@ -154,6 +208,8 @@ func (e *DeployExecutor) Execute(plan *planner.DeployPlan) (*DeployTask, error)
         plan.Status = planner.StatusRunning
         global.DB.Save(plan)
         
+        publishEvent(plan, task, "started", event.SeverityInfo, "开始执行")
+        
         // 执行步骤
         go e.executeSteps(task, steps)
         
@@ -348,6 +404,14 @@ func (e *DeployExecutor) executeSteps(task *DeployTask, steps []TaskStep) {
         }
         
         global.DB.Save(task)
+        
+        var plan planner.DeployPlan
+        global.DB.First(&plan, task.PlanID)
+        if task.Status == StatusCompleted {
+                publishEvent(&plan, task, "succeeded", event.SeverityInfo, "执行完成")
+        } else {
+                publishEvent(&plan, task, "failed", event.SeverityWarning, "执行失败")
+        }
 }
 
 // Pause 暂停执行
@@ -413,10 +477,33 @@ func (e *DeployExecutor) Rollback(taskID uint) error {
         if e.notifier != nil {
                 e.notifier.SendMessage("部署回滚", fmt.Sprintf("部署方案 #%d 已回滚", task.PlanID))
         }
+        publishEvent(&plan, &task, "rolled_back", event.SeverityWarning, "已回滚")
         
         return nil
 }
 
+// publishEvent 部署任务状态变化写入事件流，涉及的服务器取自方案的服务器分配
+func publishEvent(plan *planner.DeployPlan, task *DeployTask, action, severity, verb string) {
+        var assignments []planner.ServerAssignment
+        json.Unmarshal([]byte(plan.ServerAssignments), &assignments)
+        servers := make([]uint, 0, len(assignments))
+        for _, a := range assignments {
+                servers = append(servers, a.ServerID)
+        }
+        
+        event.Publish(&event.Event{
+                Type:     event.TypeDeploy,
+                Action:   action,
+                Severity: severity,
+                Title:    fmt.Sprintf("部署方案 #%d %s %s", plan.ID, plan.Name, verb),
+                Detail:   task.Error,
+                Labels:   event.MakeLabels("plan", plan.Name),
+                Servers:  servers,
+                Source:   "deploy_task",
+                SourceID: task.ID,
+        })
+}
+
 // GetTask 获取任务
 func GetTask(id uint) (*DeployTask, error) {
         var task DeployTask
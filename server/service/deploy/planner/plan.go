@@ -181,16 +181,16 @@ type TopologyEdge struct {
 
 // DeployPlanner 部署规划器
 type DeployPlanner struct {
-	llmClient *llm.GLM5Client
+	llmClient llm.Provider
 }
 
 // NewDeployPlanner 创建部署规划器
 func NewDeployPlanner() *DeployPlanner {
-	return &DeployPlanner{}
+	return &DeployPlanner{llmClient: llm.For(llm.FeatureDeployPlan, "")}
 }
 
 // SetLLMClient 设置 LLM 客户端
-func (p *DeployPlanner) SetLLMClient(client *llm.GLM5Client) {
+func (p *DeployPlanner) SetLLMClient(client llm.Provider) {
 	p.llmClient = client
 }
 
@@ -0,0 +1,238 @@
+package detector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"yunwei/service/metrics"
+	"yunwei/service/metrics/query"
+	"yunwei/service/prediction"
+)
+
+// 异常方向
+const (
+	AnomalyDirectionUp   = "up"   // 只在高于基线时告警，如泄漏、突增
+	AnomalyDirectionDown = "down" // 只在低于基线时告警，如流量跌零
+	AnomalyDirectionBoth = "both"
+)
+
+const (
+	// defaultSensitivity 默认偏离 3 倍正常波动幅度算异常
+	defaultSensitivity = 3
+	// maxBaselineDays 学习基线的最长历史
+	maxBaselineDays = 56
+	// baselineRefresh 基线重新学习的间隔
+	baselineRefresh = time.Hour
+)
+
+// anomalyCond 异常检测规则的参数
+type anomalyCond struct {
+	algorithm    string
+	seasonality  prediction.Seasonality
+	sensitivity  float64
+	minDeviation float64
+	direction    string
+	window       time.Duration // 学习基线的历史长度
+	warmup       time.Duration // 序列历史不足该时长时不告警
+}
+
+// compileAnomaly 校验异常检测参数并补全默认值
+func compileAnomaly(rule *DetectRule) (*anomalyCond, error) {
+	a := &anomalyCond{
+		algorithm:    rule.AnomalyAlgorithm,
+		seasonality:  prediction.Seasonality(rule.AnomalySeasonality),
+		sensitivity:  rule.AnomalySensitivity,
+		minDeviation: rule.AnomalyMinDeviation,
+		direction:    rule.AnomalyDirection,
+	}
+
+	switch a.algorithm {
+	case "":
+		a.algorithm = prediction.AlgorithmMAD
+	case prediction.AlgorithmMAD, prediction.AlgorithmHoltWinters:
+	default:
+		return nil, fmt.Errorf("不支持的异常检测算法 %s", a.algorithm)
+	}
+
+	// 默认历史：按天的季节看两周，按周的季节看四周；预热期至少要让每个分桶有数据
+	baselineDays, warmupDays := 14, 3
+	switch a.seasonality {
+	case "":
+		a.seasonality = prediction.SeasonHourOfDay
+	case prediction.SeasonHourOfDay:
+	case prediction.SeasonHourOfWeek:
+		baselineDays, warmupDays = 28, 14
+	default:
+		return nil, fmt.Errorf("不支持的季节周期 %s", a.seasonality)
+	}
+	// Holt-Winters 初始化需要两个完整周期
+	minWarmup := 1
+	if a.algorithm == prediction.AlgorithmHoltWinters {
+		minWarmup = 2 * a.seasonality.Buckets() / 24
+		if warmupDays < minWarmup {
+			warmupDays = minWarmup
+		}
+	}
+	if rule.AnomalyBaselineDays != 0 {
+		baselineDays = rule.AnomalyBaselineDays
+	}
+	if rule.AnomalyWarmupDays != 0 {
+		warmupDays = rule.AnomalyWarmupDays
+	}
+	if baselineDays < 2 || baselineDays > maxBaselineDays {
+		return nil, fmt.Errorf("基线历史天数应在 2~%d 之间", maxBaselineDays)
+	}
+	if warmupDays < minWarmup {
+		return nil, fmt.Errorf("预热期至少 %d 天", minWarmup)
+	}
+	if warmupDays > baselineDays {
+		return nil, errors.New("预热期不能超过基线历史天数")
+	}
+	a.window = time.Duration(baselineDays) * 24 * time.Hour
+	a.warmup = time.Duration(warmupDays) * 24 * time.Hour
+
+	if a.sensitivity == 0 {
+		a.sensitivity = defaultSensitivity
+	}
+	if a.sensitivity < 0 {
+		return nil, errors.New("灵敏度必须大于 0")
+	}
+	if a.minDeviation < 0 {
+		return nil, errors.New("最小偏离不能为负数")
+	}
+
+	switch a.direction {
+	case "":
+		a.direction = AnomalyDirectionBoth
+	case AnomalyDirectionUp, AnomalyDirectionDown, AnomalyDirectionBoth:
+	default:
+		return nil, fmt.Errorf("不支持的异常方向 %s", a.direction)
+	}
+	return a, nil
+}
+
+// hit 偏离是否构成异常：超过灵敏度倍数的波动幅度，且绝对差不小于最小偏离
+func (a *anomalyCond) hit(value float64, d prediction.Deviation) bool {
+	if math.Abs(value-d.Expected) < a.minDeviation {
+		return false
+	}
+	switch a.direction {
+	case AnomalyDirectionUp:
+		return d.Score >= a.sensitivity
+	case AnomalyDirectionDown:
+		return d.Score <= -a.sensitivity
+	}
+	return math.Abs(d.Score) >= a.sensitivity
+}
+
+// resolution 学习基线时使用的存储精度，也是采样步长
+// Holt-Winters 按小时拟合；MAD 沿用查询按时间范围自动选择的精度，避免在聚合数据上重复采样
+func (a *anomalyCond) resolution(now time.Time) metrics.Resolution {
+	if a.algorithm == prediction.AlgorithmHoltWinters {
+		return metrics.Resolution1h
+	}
+	return metrics.AutoResolution(now.Add(-a.window), now)
+}
+
+// baselineSet 一条异常检测规则下各序列的基线
+type baselineSet struct {
+	learnedAt time.Time
+	series    map[string]*prediction.Baseline // 以告警指纹为键
+}
+
+// anomalySample 一条序列本轮的评分，dev 为 nil 表示仍在预热
+type anomalySample struct {
+	fp     string
+	labels map[string]string
+	value  float64
+	dev    *prediction.Deviation
+	hit    bool
+}
+
+// learnBaselines 从指标存储取规则表达式的历史，为每条序列学习基线
+func (e *RuleEngine) learnBaselines(c *compiledRule, now time.Time) (*baselineSet, error) {
+	a := c.anomaly
+	res := a.resolution(now)
+	step := res.Duration()
+	start := now.Add(-a.window).Truncate(step)
+	m, err := e.engine.RangeExpr(c.expr, start, now.Truncate(step), step, query.Options{TenantID: c.rule.TenantID, Resolution: res})
+	if err != nil {
+		return nil, err
+	}
+
+	set := &baselineSet{learnedAt: now, series: make(map[string]*prediction.Baseline, len(m))}
+	for _, s := range m {
+		b, err := prediction.LearnBaseline(s.Points, a.seasonality, a.algorithm, step)
+		if err != nil {
+			// 历史不足以学习基线的序列按预热处理
+			continue
+		}
+		set.series[fingerprint(c.rule.ID, c.seriesLabels(s.Metric))] = b
+	}
+	return set, nil
+}
+
+// scoreAnomaly 对当前值逐条序列评分，按查询结果的顺序返回
+func (e *RuleEngine) scoreAnomaly(c *compiledRule, set *baselineSet, now time.Time) ([]*anomalySample, error) {
+	val, err := e.engine.InstantExpr(c.expr, now, query.Options{TenantID: c.rule.TenantID})
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := val.(query.Vector)
+	if !ok {
+		return nil, fmt.Errorf("表达式结果类型 %s 不是瞬时向量", val.Type())
+	}
+
+	out := make([]*anomalySample, 0, len(vec))
+	seen := make(map[string]bool, len(vec))
+	for _, s := range vec {
+		labels := c.seriesLabels(s.Metric)
+		fp := fingerprint(c.rule.ID, labels)
+		if seen[fp] {
+			return nil, fmt.Errorf("表达式结果中有标签相同的序列 %s", formatLabels(labels))
+		}
+		seen[fp] = true
+
+		sample := &anomalySample{fp: fp, labels: labels, value: s.V}
+		// 新上线的主机、新指标在历史覆盖预热期之前不评分，避免基线未稳定时误报
+		if b, ok := set.series[fp]; ok && now.Sub(b.Since) >= c.anomaly.warmup {
+			if d, ok := b.Score(now, s.V); ok {
+				sample.dev = &d
+				sample.hit = c.anomaly.hit(s.V, d)
+			}
+		}
+		out = append(out, sample)
+	}
+	return out, nil
+}
+
+// evaluateAnomaly 异常检测规则的求值，基线每小时重新学习一次
+func (e *RuleEngine) evaluateAnomaly(g *ruleGroup, now time.Time) (map[string]*activeSeries, error) {
+	c := g.compiled
+	if g.baselines == nil || now.Sub(g.baselines.learnedAt) >= baselineRefresh {
+		set, err := e.learnBaselines(c, now)
+		if err != nil {
+			return nil, fmt.Errorf("学习基线失败: %w", err)
+		}
+		g.baselines = set
+	}
+
+	samples, err := e.scoreAnomaly(c, g.baselines, now)
+	if err != nil {
+		return nil, err
+	}
+	g.warmingUp = 0
+	active := make(map[string]*activeSeries)
+	for _, s := range samples {
+		if s.dev == nil {
+			g.warmingUp++
+			continue
+		}
+		if s.hit {
+			active[s.fp] = &activeSeries{labels: s.labels, value: s.value, dev: s.dev, hit: true}
+		}
+	}
+	return active, nil
+}
@@ -0,0 +1,384 @@
+package detector
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"yunwei/service/metrics"
+	"yunwei/service/metrics/query"
+	"yunwei/service/prediction"
+)
+
+// errNoExpression 规则既没有表达式，也不是能生成表达式的指标类规则
+var errNoExpression = errors.New("规则没有表达式")
+
+// forClause 匹配表达式末尾的 for 子句，如 "... > 90 for 3m"
+var forClause = regexp.MustCompile(`\s+for\s+([0-9][0-9a-z]*)\s*$`)
+
+// legacyMetrics 指标类规则类型对应的指标
+var legacyMetrics = map[AlertType]string{
+	AlertTypeCPUHigh:   metrics.MetricCPUUsage,
+	AlertTypeMemoryLow: metrics.MetricMemoryUsage,
+	AlertTypeDiskHigh:  metrics.MetricDiskUsage,
+	AlertTypeLoadHigh:  metrics.MetricLoad1,
+}
+
+// compiledRule 已编译的表达式规则
+type compiledRule struct {
+	rule        DetectRule
+	source      string // 生效的表达式文本（不含 for 子句）
+	expr        query.Expr
+	cond        *thresholdCond
+	anomaly     *anomalyCond // 异常检测规则的参数，其他规则为 nil
+	forDuration time.Duration
+	keepFiring  time.Duration
+	interval    time.Duration
+	labels      map[string]string
+	summary     *template.Template
+	annotations map[string]*template.Template
+}
+
+// thresholdCond 形如 <表达式> <比较> <数值> 的条件，拆开后才能按恢复阈值判断
+type thresholdCond struct {
+	value      query.Expr
+	op         string
+	threshold  float64
+	scalarLeft bool // 90 < cpu_usage 这种数值在左边的写法
+}
+
+// holds 值与阈值是否满足比较条件
+func (c *thresholdCond) holds(v, threshold float64) bool {
+	l, r := v, threshold
+	if c.scalarLeft {
+		l, r = threshold, v
+	}
+	switch c.op {
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	}
+	return false
+}
+
+// upward 值越大越接近触发
+func (c *thresholdCond) upward() bool {
+	gt := c.op == ">" || c.op == ">="
+	return gt != c.scalarLeft
+}
+
+// ruleExpr 规则生效的表达式，指标类旧规则按 Type 和 Threshold 生成
+func ruleExpr(rule *DetectRule) string {
+	if s := strings.TrimSpace(rule.Expr); s != "" {
+		return s
+	}
+	if name, ok := legacyMetrics[rule.Type]; ok {
+		return fmt.Sprintf("%s > %s", name, strconv.FormatFloat(rule.Threshold, 'f', -1, 64))
+	}
+	return ""
+}
+
+// splitFor 拆出 for 子句
+func splitFor(src string) (string, time.Duration, bool, error) {
+	m := forClause.FindStringSubmatchIndex(src)
+	if m == nil {
+		return src, 0, false, nil
+	}
+	d, err := query.ParseDuration(src[m[2]:m[3]])
+	if err != nil {
+		return "", 0, false, fmt.Errorf("无效的 for 时长: %s", src[m[2]:m[3]])
+	}
+	return src[:m[0]], d, true, nil
+}
+
+// ValidateRule 校验规则能否编译为表达式规则
+func ValidateRule(rule *DetectRule) error {
+	_, err := compileRule(*rule, time.Minute)
+	if errors.Is(err, errNoExpression) {
+		return fmt.Errorf("规则类型 %s 需要填写表达式", rule.Type)
+	}
+	return err
+}
+
+// compileRule 编译规则
+func compileRule(rule DetectRule, defaultInterval time.Duration) (*compiledRule, error) {
+	src := ruleExpr(&rule)
+	if src == "" {
+		return nil, errNoExpression
+	}
+
+	exprText, forDuration, hasFor, err := splitFor(src)
+	if err != nil {
+		return nil, err
+	}
+	if !hasFor {
+		forDuration = time.Duration(rule.Duration) * time.Second
+	}
+
+	expr, err := query.ParseRuleExpr(exprText)
+	if err != nil {
+		return nil, err
+	}
+	if expr.Type() != query.ValueTypeVector {
+		return nil, fmt.Errorf("告警表达式必须返回瞬时向量，实际为 %s", expr.Type())
+	}
+
+	// 作用范围和租户作为匹配条件加到每个选择器上
+	scope, err := query.ParseMatchers(rule.Scope)
+	if err != nil {
+		return nil, fmt.Errorf("作用范围格式错误: %w", err)
+	}
+	if rule.TenantID != "" {
+		m, _ := query.NewMatcher(query.MatchEqual, query.LabelTenant, rule.TenantID)
+		scope = append(scope, m)
+	}
+	if len(scope) > 0 {
+		query.Inspect(expr, func(e query.Expr) {
+			if vs, ok := e.(*query.VectorSelector); ok {
+				vs.Matchers = append(vs.Matchers, scope...)
+			}
+		})
+	}
+
+	c := &compiledRule{
+		rule:        rule,
+		source:      strings.TrimSpace(exprText),
+		expr:        expr,
+		cond:        splitThreshold(expr),
+		forDuration: forDuration,
+		keepFiring:  time.Duration(rule.KeepFiringFor) * time.Second,
+		interval:    defaultInterval,
+	}
+	if rule.EvalInterval > 0 {
+		c.interval = time.Duration(rule.EvalInterval) * time.Second
+	}
+
+	if rule.Type == AlertTypeAnomaly {
+		if c.cond != nil {
+			return nil, errors.New("异常检测规则的表达式只写指标，不带比较条件，如 avg(cpu_usage[5m])")
+		}
+		if rule.ResolveThreshold != nil {
+			return nil, errors.New("异常检测规则不支持恢复阈值，可以用 keepFiringFor 避免抖动")
+		}
+		if c.anomaly, err = compileAnomaly(&rule); err != nil {
+			return nil, err
+		}
+	}
+
+	if rule.ResolveThreshold != nil {
+		if c.cond == nil {
+			return nil, errors.New("恢复阈值只能用于 <表达式> <比较运算> <数值> 形式的规则")
+		}
+		r := *rule.ResolveThreshold
+		switch c.cond.op {
+		case "==", "!=":
+			return nil, fmt.Errorf("%s 条件不支持恢复阈值", c.cond.op)
+		}
+		if c.cond.upward() && r > c.cond.threshold || !c.cond.upward() && r < c.cond.threshold {
+			return nil, fmt.Errorf("恢复阈值 %g 应比触发阈值 %g 更宽松", r, c.cond.threshold)
+		}
+	}
+
+	if rule.Labels != "" {
+		if err := json.Unmarshal([]byte(rule.Labels), &c.labels); err != nil {
+			return nil, fmt.Errorf("附加标签必须是 JSON 对象: %w", err)
+		}
+	}
+	if c.summary, err = parseAnnotation("summary", rule.Summary); err != nil {
+		return nil, err
+	}
+	if rule.Annotations != "" {
+		var raw map[string]string
+		if err := json.Unmarshal([]byte(rule.Annotations), &raw); err != nil {
+			return nil, fmt.Errorf("注释必须是 JSON 对象: %w", err)
+		}
+		c.annotations = make(map[string]*template.Template, len(raw))
+		for k, v := range raw {
+			if c.annotations[k], err = parseAnnotation(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// splitThreshold 拆分顶层的 <表达式> <比较> <数值>
+func splitThreshold(expr query.Expr) *thresholdCond {
+	for {
+		p, ok := expr.(*query.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = p.Expr
+	}
+	be, ok := expr.(*query.BinaryExpr)
+	if !ok || be.ReturnBool {
+		return nil
+	}
+	switch be.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return nil
+	}
+	if n, ok := be.RHS.(*query.NumberLiteral); ok && be.LHS.Type() == query.ValueTypeVector {
+		return &thresholdCond{value: be.LHS, op: be.Op, threshold: n.Val}
+	}
+	if n, ok := be.LHS.(*query.NumberLiteral); ok && be.RHS.Type() == query.ValueTypeVector {
+		return &thresholdCond{value: be.RHS, op: be.Op, threshold: n.Val, scalarLeft: true}
+	}
+	return nil
+}
+
+// ==================== 告警内容 ====================
+
+// templateData 模板变量
+type templateData struct {
+	Labels    map[string]string
+	Value     float64
+	Threshold float64
+	Rule      string
+	Expected  float64 // 异常检测规则的基线期望值
+	Score     float64 // 异常检测规则的偏离倍数
+}
+
+var templateFuncs = template.FuncMap{
+	// humanize 保留两位小数
+	"humanize": func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	},
+}
+
+// parseAnnotation 编译注释模板，支持 Prometheus 风格的 $labels、$value
+func parseAnnotation(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	const prelude = "{{$labels := .Labels}}{{$value := .Value}}{{$threshold := .Threshold}}{{$expected := .Expected}}{{$score := .Score}}"
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(prelude + text)
+	if err != nil {
+		return nil, fmt.Errorf("模板 %s 格式错误: %w", name, err)
+	}
+	return t, nil
+}
+
+// render 渲染模板，出错时把错误写进结果，不影响告警生成
+func render(t *template.Template, data *templateData) string {
+	if t == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Sprintf("<模板错误: %v>", err)
+	}
+	return buf.String()
+}
+
+// content 生成告警标题、内容和注释，dev 为异常检测规则的偏离，其他规则为 nil
+func (c *compiledRule) content(labels map[string]string, value float64, dev *prediction.Deviation) (title, message string, annotations map[string]string) {
+	data := &templateData{Labels: labels, Value: value, Threshold: c.threshold(), Rule: c.rule.Name}
+	if dev != nil {
+		data.Expected, data.Score = dev.Expected, dev.Score
+	}
+
+	title = render(c.summary, data)
+	if title == "" {
+		title = c.rule.Name
+	}
+
+	annotations = make(map[string]string, len(c.annotations))
+	for k, t := range c.annotations {
+		annotations[k] = render(t, data)
+	}
+
+	message = annotations["description"]
+	if message == "" {
+		target := labels[query.LabelServer]
+		if target == "" {
+			target = formatLabels(labels)
+		}
+		if dev != nil {
+			message = fmt.Sprintf("%s: %s 当前值 %.2f，基线 %.2f，偏离 %.1f 倍正常波动", target, c.source, value, dev.Expected, dev.Score)
+		} else if c.cond != nil {
+			message = fmt.Sprintf("%s: %s 当前值 %.2f，阈值 %s %g", target, c.source, value, c.cond.op, c.cond.threshold)
+		} else {
+			message = fmt.Sprintf("%s: %s 当前值 %.2f", target, c.source, value)
+		}
+	}
+	return title, message, annotations
+}
+
+// threshold 规则的阈值，异常检测规则为灵敏度
+func (c *compiledRule) threshold() float64 {
+	if c.cond != nil {
+		return c.cond.threshold
+	}
+	if c.anomaly != nil {
+		return c.anomaly.sensitivity
+	}
+	return c.rule.Threshold
+}
+
+// seriesLabels 告警标签：序列标签去掉指标名，再叠加规则附加标签
+func (c *compiledRule) seriesLabels(metric query.Labels) map[string]string {
+	out := make(map[string]string, len(metric)+len(c.labels)+1)
+	for k, v := range metric {
+		if k == "__name__" {
+			continue
+		}
+		out[k] = v
+	}
+	for k, v := range c.labels {
+		out[k] = v
+	}
+	out["alertname"] = c.rule.Name
+	return out
+}
+
+// fingerprint 规则 + 标签的稳定哈希，用于跨求值周期识别同一条告警，规则改名不影响
+func fingerprint(ruleID uint, labels map[string]string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d", ruleID)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if k != "alertname" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "\xff%s\xff%s", k, labels[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// formatLabels 输出 {a="1", b="2"}
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
@@ -0,0 +1,294 @@
+package detector
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/server"
+	"yunwei/service/metrics/query"
+	"yunwei/service/silence"
+)
+
+// LabelRoot 标为 root="true" 的告警与 host_down 一样视为根因告警，参与拓扑抑制
+const LabelRoot = "root"
+
+// InhibitRule 抑制规则：存在匹配 Source 的告警时，匹配 Target 且 Equal 中各标签值相同的告警不再通知
+type InhibitRule struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Name           string `json:"name" gorm:"type:varchar(64);not null"`
+	SourceMatchers string `json:"sourceMatchers" gorm:"type:text;not null"` // 如 rule="host_down"
+	TargetMatchers string `json:"targetMatchers" gorm:"type:text;not null"` // 如 rule=~"nginx_down|docker_down"
+	Equal          string `json:"equal" gorm:"type:varchar(255)"`           // 逗号分隔的标签名，如 server_id
+	Enabled        bool   `json:"enabled" gorm:"default:true"`
+	Comment        string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (InhibitRule) TableName() string {
+	return "alert_inhibit_rules"
+}
+
+// Validate 校验抑制规则，来源和目标都不能为空，避免抑制全部告警
+func (r *InhibitRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("规则名称不能为空")
+	}
+	if _, err := silence.ParseMatchers(r.SourceMatchers); err != nil {
+		return errors.New("来源条件: " + err.Error())
+	}
+	if _, err := silence.ParseMatchers(r.TargetMatchers); err != nil {
+		return errors.New("目标条件: " + err.Error())
+	}
+	return nil
+}
+
+func (r *InhibitRule) equalLabels() []string {
+	var names []string
+	for _, n := range strings.Split(r.Equal, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+type compiledInhibitRule struct {
+	source []*query.Matcher
+	target []*query.Matcher
+	equal  []string
+}
+
+type openAlert struct {
+	id       uint
+	serverID uint
+	root     bool
+	labels   map[string]string
+}
+
+// inhibitor 一次通知判断用到的抑制上下文：未恢复告警、抑制规则和服务器拓扑
+type inhibitor struct {
+	rules  []compiledInhibitRule
+	open   []openAlert
+	roots  map[uint][]openAlert // 服务器ID → 该服务器上的根因告警，0 为不属于任何服务器的
+	upward map[uint][]uint      // 服务器ID → 直接依赖的上游服务器
+	group  map[uint]uint        // 服务器ID → 分组ID
+	parent map[uint]uint        // 分组ID → 父分组ID
+	groups map[string]uint      // 分组名 → 分组ID
+}
+
+// newInhibitor 加载抑制判断所需的数据，告警量大时只加载一次供整个事件使用
+func (m *AlertManager) newInhibitor() *inhibitor {
+	in := &inhibitor{
+		roots:  make(map[uint][]openAlert),
+		upward: make(map[uint][]uint),
+		group:  make(map[uint]uint),
+		parent: make(map[uint]uint),
+		groups: make(map[string]uint),
+	}
+
+	var rules []InhibitRule
+	m.db.Where("enabled = ?", true).Find(&rules)
+	for _, r := range rules {
+		source, err := silence.ParseMatchers(r.SourceMatchers)
+		if err != nil {
+			continue
+		}
+		target, err := silence.ParseMatchers(r.TargetMatchers)
+		if err != nil {
+			continue
+		}
+		in.rules = append(in.rules, compiledInhibitRule{source: source, target: target, equal: r.equalLabels()})
+	}
+
+	var alerts []Alert
+	m.db.Select("id", "server_id", "type", "labels").Where("status <> ?", AlertStatusResolved).Find(&alerts)
+	for i := range alerts {
+		a := openAlert{id: alerts[i].ID, serverID: alerts[i].ServerID, labels: alerts[i].MatchLabels()}
+		a.root = isRoot(&alerts[i], a.labels)
+		in.open = append(in.open, a)
+		if a.root {
+			in.roots[a.serverID] = append(in.roots[a.serverID], a)
+		}
+	}
+
+	// 没有根因告警时用不到拓扑
+	if len(in.roots) == 0 {
+		return in
+	}
+	var relations []server.ServerRelation
+	m.db.Find(&relations)
+	for _, r := range relations {
+		in.upward[r.ServerID] = append(in.upward[r.ServerID], r.DependsOnID)
+	}
+	var servers []server.Server
+	m.db.Select("id", "group_id").Find(&servers)
+	for _, s := range servers {
+		in.group[s.ID] = s.GroupID
+	}
+	var groups []server.Group
+	m.db.Select("id", "name", "parent_id").Find(&groups)
+	for _, g := range groups {
+		in.parent[g.ID] = g.ParentID
+		in.groups[g.Name] = g.ID
+	}
+	return in
+}
+
+func isRoot(a *Alert, labels map[string]string) bool {
+	return a.Type == AlertTypeHostDown || labels[LabelRoot] == "true"
+}
+
+// inhibitedBy 返回抑制该告警的根因告警ID，未被抑制时返回 0
+func (in *inhibitor) inhibitedBy(a *Alert) uint {
+	labels := a.MatchLabels()
+	root := isRoot(a, labels)
+
+	if id := in.byTopology(a, root); id != 0 {
+		return id
+	}
+	for _, r := range in.rules {
+		if !matchAll(r.target, labels) {
+			continue
+		}
+		for _, src := range in.open {
+			if src.id == a.ID || !matchAll(r.source, src.labels) {
+				continue
+			}
+			if equalLabels(r.equal, labels, src.labels) {
+				return src.id
+			}
+		}
+	}
+	return 0
+}
+
+// byTopology 按拓扑查找根因：同一服务器上的根因告警、上游服务器（沿依赖关系逐级向上）上的根因告警、
+// 以及所在分组（含上级分组）上不属于具体服务器的根因告警。
+// 根因告警只会被更早产生的根因告警抑制，避免互相依赖的两台服务器同时离线时都不通知
+func (in *inhibitor) byTopology(a *Alert, root bool) uint {
+	if a.ServerID == 0 || len(in.roots) == 0 {
+		return 0
+	}
+	pick := func(candidates []openAlert) uint {
+		for _, r := range candidates {
+			if r.id != a.ID && (!root || r.id < a.ID) {
+				return r.id
+			}
+		}
+		return 0
+	}
+
+	// 同一服务器上的根因告警只抑制非根因告警
+	if !root {
+		if id := pick(in.roots[a.ServerID]); id != 0 {
+			return id
+		}
+	}
+
+	visited := map[uint]bool{a.ServerID: true}
+	queue := append([]uint(nil), in.upward[a.ServerID]...)
+	for len(queue) > 0 {
+		sid := queue[0]
+		queue = queue[1:]
+		if visited[sid] {
+			continue
+		}
+		visited[sid] = true
+		if id := pick(in.roots[sid]); id != 0 {
+			return id
+		}
+		queue = append(queue, in.upward[sid]...)
+	}
+
+	// 分组级根因，如交换机故障：告警不属于服务器，但带有 group 标签
+	for _, r := range in.roots[0] {
+		gid, ok := in.groups[r.labels[query.LabelGroup]]
+		if !ok || (root && r.id >= a.ID) {
+			continue
+		}
+		for g, depth := in.group[a.ServerID], 0; g != 0 && depth < 32; g, depth = in.parent[g], depth+1 {
+			if g == gid {
+				return r.id
+			}
+		}
+	}
+	return 0
+}
+
+func matchAll(matchers []*query.Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalLabels(names []string, a, b map[string]string) bool {
+	for _, n := range names {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// Suppressed 告警是否全部被静默或抑制，不需要通知。
+// 同时把抑制关系写回告警的 inhibited_by，事件详情据此关联到根因告警
+func (m *AlertManager) Suppressed(alerts []Alert, now time.Time) bool {
+	if len(alerts) == 0 {
+		return false
+	}
+	in := m.newInhibitor()
+	svc := silence.GetService()
+	all := true
+	for i := range alerts {
+		by := in.inhibitedBy(&alerts[i])
+		if by != alerts[i].InhibitedBy {
+			m.db.Model(&Alert{}).Where("id = ?", alerts[i].ID).Update("inhibited_by", by)
+			alerts[i].InhibitedBy = by
+		}
+		if by == 0 && svc.Silenced(alerts[i].MatchLabels(), now) == nil {
+			all = false
+		}
+	}
+	return all
+}
+
+// ==================== 服务器在线状态 ====================
+
+// SyncHost 同步服务器在线状态：离线时触发 host_down 根因告警，恢复在线后自动恢复
+func (m *AlertManager) SyncHost(srv *server.Server, online bool, now time.Time) {
+	sid := strconv.FormatUint(uint64(srv.ID), 10)
+	fp := fingerprint(0, map[string]string{"type": string(AlertTypeHostDown), query.LabelServerID: sid})
+
+	if online {
+		var open []Alert
+		m.db.Select("id").Where("fingerprint = ? AND status <> ?", fp, AlertStatusResolved).Find(&open)
+		for _, a := range open {
+			if err := m.Resolve(a.ID, now, 0, "", true); err != nil {
+				global.Logger.Warn(fmt.Sprintf("告警 %d 自动恢复失败: %v", a.ID, err))
+			}
+		}
+		return
+	}
+
+	_, err := m.Fire(&Alert{
+		ServerID:    srv.ID,
+		Type:        AlertTypeHostDown,
+		Level:       AlertLevelCritical,
+		Title:       "服务器离线",
+		Message:     fmt.Sprintf("服务器 %s (%s) 的 Agent 未连接", srv.Name, srv.Host),
+		Fingerprint: fp,
+		Labels:      serverAlertLabels(srv, AlertTypeHostDown),
+	}, now)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("服务器 %s 离线告警写入失败: %v", srv.Name, err))
+	}
+}
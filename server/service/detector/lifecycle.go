@@ -0,0 +1,718 @@
+package detector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/model/server"
+	"yunwei/service/event"
+	"yunwei/service/metrics/query"
+	"yunwei/service/routing"
+
+	"gorm.io/gorm"
+)
+
+// 告警状态
+const (
+	AlertStatusFiring       = "firing"
+	AlertStatusAcknowledged = "acknowledged"
+	AlertStatusResolved     = "resolved"
+)
+
+// AlertEvent 通知事件
+type AlertEvent string
+
+const (
+	AlertEventFiring       AlertEvent = "firing"       // 新事件或事件升级
+	AlertEventRepeat       AlertEvent = "repeat"       // 未确认事件的重复提醒
+	AlertEventAcknowledged AlertEvent = "acknowledged" // 事件被确认
+	AlertEventResolved     AlertEvent = "resolved"     // 事件内告警全部恢复
+	AlertEventEscalated    AlertEvent = "escalated"    // 未确认事件升级到下一级值班人
+)
+
+// 分组维度，其他取值按同名标签分组
+const (
+	GroupByRule   = "rule"
+	GroupByServer = "server"
+	GroupByGroup  = "group"
+)
+
+// lifecycleTick 待发通知检查间隔，也是 group_wait、group_interval 的精度
+const lifecycleTick = 15 * time.Second
+
+// levelRank 告警级别排序，用于事件升级
+var levelRank = map[AlertLevel]int{
+	AlertLevelInfo:      1,
+	AlertLevelWarning:   2,
+	AlertLevelCritical:  3,
+	AlertLevelEmergency: 4,
+}
+
+// Incident 事件：同一分组（规则/服务器/分组）下的告警合并为一个事件，确认和通知以事件为单位
+type Incident struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	GroupKey    string     `json:"groupKey" gorm:"type:varchar(64);index"` // 分组标签的哈希
+	GroupLabels string     `json:"groupLabels" gorm:"type:text"`           // 分组标签(JSON)
+	Title       string     `json:"title" gorm:"type:varchar(255)"`
+	Level       AlertLevel `json:"level" gorm:"type:varchar(16)"`
+	Status      string     `json:"status" gorm:"type:varchar(16);index"` // firing, acknowledged, resolved
+	TenantID    string     `json:"tenantId" gorm:"type:varchar(36);index"`
+	ServerID    uint       `json:"serverId" gorm:"index"`
+	RuleID      uint       `json:"ruleId"`
+	RouteID     uint       `json:"routeId"` // 通知路由，决定分组和通知时间
+
+	AlertCount  int `json:"alertCount"`  // 关联告警总数
+	ActiveCount int `json:"activeCount"` // 未恢复告警数
+
+	FiredAt        time.Time  `json:"firedAt"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
+	AcknowledgedBy uint       `json:"acknowledgedBy"`
+	ResolvedAt     *time.Time `json:"resolvedAt"`
+	ResolvedBy     uint       `json:"resolvedBy"`
+
+	LastNotifiedAt *time.Time `json:"lastNotifiedAt"`
+	NotifyCount    int        `json:"notifyCount"`
+	ChangedAt      *time.Time `json:"changedAt"` // 最近一次有新告警加入的时间
+}
+
+func (Incident) TableName() string {
+	return "incidents"
+}
+
+// AlertNotifier 事件通知出口，由通知模块实现后注入
+type AlertNotifier interface {
+	NotifyIncident(event AlertEvent, incident *Incident, alerts []Alert) error
+}
+
+// AlertManager 告警生命周期：按指纹去重、分组为事件、重复通知、恢复与确认
+type AlertManager struct {
+	db             *gorm.DB
+	groupBy        []string
+	repeatInterval time.Duration
+
+	mu       sync.Mutex // 串行化告警写入，避免同一分组并发建出两个事件
+	notifier AlertNotifier
+	isLeader func() bool
+	cancel   context.CancelFunc
+}
+
+var (
+	globalAlertManager *AlertManager
+	alertManagerOnce   sync.Once
+)
+
+// GetAlertManager 获取全局告警生命周期管理器
+func GetAlertManager() *AlertManager {
+	alertManagerOnce.Do(func() {
+		cfg := config.CONFIG.Alerting
+		groupBy := cfg.GroupBy
+		if len(groupBy) == 0 {
+			groupBy = []string{GroupByRule, GroupByServer}
+		}
+		repeat := time.Duration(cfg.RepeatInterval) * time.Minute
+		if repeat <= 0 {
+			repeat = 4 * time.Hour
+		}
+		globalAlertManager = NewAlertManager(global.DB, groupBy, repeat)
+	})
+	return globalAlertManager
+}
+
+// NewAlertManager 创建告警生命周期管理器
+func NewAlertManager(db *gorm.DB, groupBy []string, repeatInterval time.Duration) *AlertManager {
+	return &AlertManager{
+		db:             db,
+		groupBy:        groupBy,
+		repeatInterval: repeatInterval,
+		isLeader:       func() bool { return true },
+	}
+}
+
+// SetNotifier 设置事件通知出口
+func (m *AlertManager) SetNotifier(n AlertNotifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = n
+}
+
+// SetLeaderCheck 设置 Leader 判断，重复通知只由 Leader 发送
+func (m *AlertManager) SetLeaderCheck(fn func() bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fn != nil {
+		m.isLeader = fn
+	}
+}
+
+// Start 启动重复通知检查
+func (m *AlertManager) Start(ctx context.Context) {
+	m.mu.Lock()
+	if m.cancel != nil {
+		m.mu.Unlock()
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(lifecycleTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				m.mu.Lock()
+				leader := m.isLeader()
+				m.mu.Unlock()
+				if leader {
+					m.notifyPending(now)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止重复通知检查
+func (m *AlertManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
+	}
+}
+
+// ==================== 触发与恢复 ====================
+
+// Fire 上报一次处于触发状态的告警。
+// 同指纹的告警未恢复时只刷新现值和最后出现时间，不新建记录、不重复通知；
+// 否则新建告警并归入所属分组的事件，新开事件或事件级别升高时发送通知。
+func (m *AlertManager) Fire(a *Alert, now time.Time) (*Alert, error) {
+	if a.Fingerprint == "" {
+		return nil, errors.New("告警缺少指纹")
+	}
+
+	m.mu.Lock()
+	var existing Alert
+	err := m.db.Where("fingerprint = ? AND status <> ?", a.Fingerprint, AlertStatusResolved).
+		Order("id DESC").First(&existing).Error
+	if err == nil {
+		err = m.db.Model(&Alert{}).Where("id = ?", existing.ID).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"occurrences":  gorm.Expr("occurrences + 1"),
+			"metric_value": a.MetricValue,
+			"message":      a.Message,
+		}).Error
+		m.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		existing.LastSeenAt = &now
+		existing.Occurrences++
+		existing.MetricValue = a.MetricValue
+		existing.Message = a.Message
+		return &existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		m.mu.Unlock()
+		return nil, err
+	}
+
+	var incident Incident
+	var event AlertEvent
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		incident, event, err = m.attach(tx, a, now)
+		if err != nil {
+			return err
+		}
+		a.IncidentID = incident.ID
+		if a.FiredAt == nil {
+			a.FiredAt = &now
+		}
+		a.LastSeenAt = &now
+		a.Occurrences = 1
+		return tx.Omit("Server").Create(a).Error
+	})
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if event != "" {
+		m.notify(event, &incident, now)
+	}
+	publishEvent(a, "fired", now)
+	return a, nil
+}
+
+// publishEvent 告警触发和恢复写入事件流，和部署、变更放在同一条时间线上
+func publishEvent(a *Alert, action string, now time.Time) {
+	severity := event.SeverityInfo
+	if action == "fired" {
+		severity = event.SeverityWarning
+		if a.Level == AlertLevelCritical || a.Level == AlertLevelEmergency {
+			severity = event.SeverityCritical
+		}
+	}
+	ev := &event.Event{
+		OccurredAt: now,
+		Type:       event.TypeAlert,
+		Action:     action,
+		Severity:   severity,
+		Title:      a.Title,
+		Detail:     a.Message,
+		Labels:     a.Labels,
+		Source:     "alert",
+		SourceID:   a.ID,
+	}
+	if a.ServerID > 0 {
+		ev.Servers = []uint{a.ServerID}
+	}
+	event.Publish(ev)
+}
+
+// attach 找到或新建告警所属的事件，返回需要立即发送的通知事件（无需通知时为空）。
+// 告警按命中的通知路由分组，不同路由下的告警不会合并到同一事件
+func (m *AlertManager) attach(tx *gorm.DB, a *Alert, now time.Time) (Incident, AlertEvent, error) {
+	groupBy := m.groupBy
+	var routeID uint
+	var groupWait time.Duration
+	if r := m.route(a); r != nil {
+		routeID = r.RouteID
+		groupWait = r.GroupWait
+		if len(r.GroupBy) > 0 {
+			groupBy = r.GroupBy
+		}
+	}
+	groupLabels := m.groupLabels(a, groupBy)
+	key := fingerprint(routeID, groupLabels)
+
+	var incident Incident
+	err := tx.Where("group_key = ? AND status <> ?", key, AlertStatusResolved).Order("id DESC").First(&incident).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		labelsJSON, _ := json.Marshal(groupLabels)
+		var labels map[string]string
+		json.Unmarshal([]byte(a.Labels), &labels)
+		incident = Incident{
+			GroupKey:    key,
+			GroupLabels: string(labelsJSON),
+			Title:       a.Title,
+			Level:       a.Level,
+			Status:      AlertStatusFiring,
+			TenantID:    labels[query.LabelTenant],
+			ServerID:    a.ServerID,
+			RuleID:      a.RuleID,
+			RouteID:     routeID,
+			AlertCount:  1,
+			ActiveCount: 1,
+			FiredAt:     now,
+		}
+		a.Status = AlertStatusFiring
+		event := AlertEventFiring
+		if groupWait > 0 {
+			// 等待 group_wait 收集同组告警，首次通知由 notifyPending 发送
+			event = ""
+		}
+		return incident, event, tx.Create(&incident).Error
+	}
+	if err != nil {
+		return incident, "", err
+	}
+
+	updates := map[string]interface{}{
+		"alert_count":  gorm.Expr("alert_count + 1"),
+		"active_count": gorm.Expr("active_count + 1"),
+		"changed_at":   now,
+	}
+	var event AlertEvent
+	if levelRank[a.Level] > levelRank[incident.Level] {
+		// 更高级别的告警加入时事件升级，已确认的事件重新进入触发状态
+		updates["level"] = a.Level
+		updates["title"] = a.Title
+		updates["status"] = AlertStatusFiring
+		incident.Level = a.Level
+		incident.Title = a.Title
+		incident.Status = AlertStatusFiring
+		event = AlertEventFiring
+	}
+	if err := tx.Model(&Incident{}).Where("id = ?", incident.ID).Updates(updates).Error; err != nil {
+		return incident, "", err
+	}
+	incident.AlertCount++
+	incident.ActiveCount++
+	incident.ChangedAt = &now
+
+	// 加入已确认事件的告警同样视为已确认
+	a.Status = incident.Status
+	if incident.Status == AlertStatusAcknowledged {
+		a.AcknowledgedBy = incident.AcknowledgedBy
+		a.AcknowledgedAt = &now
+	}
+	return incident, event, nil
+}
+
+// route 告警在通知路由树上命中的第一条路由，未配置路由树时为 nil
+func (m *AlertManager) route(a *Alert) *routing.Match {
+	labels := a.MatchLabels()
+	matches := routing.GetService().Match(labels[query.LabelTenant], labels, string(a.Level))
+	if len(matches) == 0 {
+		return nil
+	}
+	return &matches[0]
+}
+
+// groupLabels 告警在各分组维度上的取值
+func (m *AlertManager) groupLabels(a *Alert, groupBy []string) map[string]string {
+	var labels map[string]string
+	json.Unmarshal([]byte(a.Labels), &labels)
+
+	out := make(map[string]string, len(groupBy))
+	for _, dim := range groupBy {
+		switch dim {
+		case GroupByRule:
+			if a.RuleID > 0 {
+				out[GroupByRule] = strconv.FormatUint(uint64(a.RuleID), 10)
+			} else {
+				out[GroupByRule] = string(a.Type)
+			}
+		case GroupByServer:
+			out[GroupByServer] = strconv.FormatUint(uint64(a.ServerID), 10)
+		case GroupByGroup:
+			out[GroupByGroup] = labels[query.LabelGroup]
+		default:
+			out[dim] = labels[dim]
+		}
+	}
+	return out
+}
+
+// Resolve 恢复告警；事件内告警全部恢复后事件随之恢复并通知。
+// auto 为 true 表示条件消失自动恢复，否则为人工处理
+func (m *AlertManager) Resolve(alertID uint, now time.Time, userID uint, remark string, auto bool) error {
+	m.mu.Lock()
+	var alert Alert
+	var incident *Incident
+	var resolved bool
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&alert, alertID).Error; err != nil {
+			return err
+		}
+		if alert.Status == AlertStatusResolved {
+			return nil
+		}
+		resolved = true
+		updates := map[string]interface{}{
+			"status":        AlertStatusResolved,
+			"resolved_at":   now,
+			"resolved_by":   userID,
+			"auto_resolved": auto,
+		}
+		if remark != "" {
+			updates["action_taken"] = remark
+		}
+		if err := tx.Model(&Alert{}).Where("id = ?", alert.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		// 根因恢复后被它抑制的告警恢复通知，仍未恢复的由下一轮检查补发
+		if err := tx.Model(&Alert{}).Where("inhibited_by = ?", alert.ID).Update("inhibited_by", 0).Error; err != nil {
+			return err
+		}
+		if alert.IncidentID == 0 {
+			return nil
+		}
+		var err error
+		incident, err = m.refreshIncident(tx, alert.IncidentID, now, userID)
+		return err
+	})
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if incident != nil && incident.Status == AlertStatusResolved {
+		m.notify(AlertEventResolved, incident, now)
+	}
+	if resolved {
+		publishEvent(&alert, "resolved", now)
+	}
+	return nil
+}
+
+// refreshIncident 按未恢复告警数更新事件，全部恢复时关闭事件
+func (m *AlertManager) refreshIncident(tx *gorm.DB, incidentID uint, now time.Time, userID uint) (*Incident, error) {
+	var incident Incident
+	if err := tx.First(&incident, incidentID).Error; err != nil {
+		return nil, err
+	}
+	var active int64
+	if err := tx.Model(&Alert{}).Where("incident_id = ? AND status <> ?", incidentID, AlertStatusResolved).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{"active_count": active}
+	incident.ActiveCount = int(active)
+	if active == 0 && incident.Status != AlertStatusResolved {
+		updates["status"] = AlertStatusResolved
+		updates["resolved_at"] = now
+		updates["resolved_by"] = userID
+		incident.Status = AlertStatusResolved
+		incident.ResolvedAt = &now
+		incident.ResolvedBy = userID
+	}
+	if err := tx.Model(&Incident{}).Where("id = ?", incidentID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+// Sync 同步一次巡检检测的结果：触发的告警去重写入，同一服务器上本次未再触发的告警自动恢复。
+// 指标类告警由规则引擎负责，这里只处理进程、容器、端口等检测
+func (m *AlertManager) Sync(srv *server.Server, results []DetectionResult, now time.Time) {
+	seen := make(map[string]bool, len(results))
+	for _, r := range results {
+		if _, ok := legacyMetrics[r.Type]; ok || !r.Triggered {
+			continue
+		}
+		// 指纹只取类型和服务器ID，服务器改名不影响去重
+		fp := fingerprint(0, map[string]string{"type": string(r.Type), query.LabelServerID: strconv.FormatUint(uint64(srv.ID), 10)})
+		seen[fp] = true
+
+		level := r.Level
+		if level == "" {
+			level = AlertLevelWarning
+		}
+		_, err := m.Fire(&Alert{
+			ServerID:    srv.ID,
+			Type:        r.Type,
+			Level:       level,
+			Title:       r.Title,
+			Message:     r.Message,
+			MetricValue: r.MetricValue,
+			Threshold:   r.Threshold,
+			Fingerprint: fp,
+			Labels:      serverAlertLabels(srv, r.Type),
+		}, now)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("服务器 %s 告警写入失败: %v", srv.Name, err))
+		}
+	}
+
+	var open []Alert
+	m.db.Select("id", "fingerprint").
+		Where("server_id = ? AND rule_id = 0 AND fingerprint <> '' AND type <> ? AND status <> ?",
+			srv.ID, AlertTypeHostDown, AlertStatusResolved).
+		Find(&open)
+	for _, a := range open {
+		if seen[a.Fingerprint] {
+			continue
+		}
+		if err := m.Resolve(a.ID, now, 0, "", true); err != nil {
+			global.Logger.Warn(fmt.Sprintf("告警 %d 自动恢复失败: %v", a.ID, err))
+		}
+	}
+}
+
+// serverAlertLabels 巡检类告警的标签(JSON)
+func serverAlertLabels(srv *server.Server, t AlertType) string {
+	labels := map[string]string{
+		"alertname":         string(t),
+		"type":              string(t),
+		query.LabelServerID: strconv.FormatUint(uint64(srv.ID), 10),
+		query.LabelServer:   srv.Name,
+	}
+	if srv.Group != nil {
+		labels[query.LabelGroup] = srv.Group.Name
+	}
+	if srv.TenantID != "" {
+		labels[query.LabelTenant] = srv.TenantID
+	}
+	labelsJSON, _ := json.Marshal(labels)
+	return string(labelsJSON)
+}
+
+// ==================== 确认 ====================
+
+// AcknowledgeIncident 确认事件：事件及其未恢复的告警都标记为已确认，并停止重复通知
+func (m *AlertManager) AcknowledgeIncident(incidentID, userID uint, now time.Time) (*Incident, error) {
+	m.mu.Lock()
+	var incident Incident
+	changed := false
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&incident, incidentID).Error; err != nil {
+			return err
+		}
+		switch incident.Status {
+		case AlertStatusResolved:
+			return errors.New("事件已恢复")
+		case AlertStatusAcknowledged:
+			return nil
+		}
+		changed = true
+		incident.Status = AlertStatusAcknowledged
+		incident.AcknowledgedAt = &now
+		incident.AcknowledgedBy = userID
+		if err := tx.Model(&Incident{}).Where("id = ?", incident.ID).Updates(map[string]interface{}{
+			"status":          AlertStatusAcknowledged,
+			"acknowledged_at": now,
+			"acknowledged_by": userID,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Alert{}).Where("incident_id = ? AND status = ?", incident.ID, AlertStatusFiring).
+			Updates(map[string]interface{}{
+				"status":          AlertStatusAcknowledged,
+				"acknowledged_at": now,
+				"acknowledged_by": userID,
+			}).Error
+	})
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		m.notify(AlertEventAcknowledged, &incident, now)
+	}
+	return &incident, nil
+}
+
+// AcknowledgeAlert 确认告警，即确认其所属事件；早期没有事件的告警单独确认
+func (m *AlertManager) AcknowledgeAlert(alertID, userID uint, now time.Time) (*Incident, error) {
+	var alert Alert
+	if err := m.db.First(&alert, alertID).Error; err != nil {
+		return nil, err
+	}
+	if alert.IncidentID > 0 {
+		return m.AcknowledgeIncident(alert.IncidentID, userID, now)
+	}
+	if alert.Status == AlertStatusResolved {
+		return nil, errors.New("告警已恢复")
+	}
+	return nil, m.db.Model(&Alert{}).Where("id = ?", alert.ID).Updates(map[string]interface{}{
+		"status":          AlertStatusAcknowledged,
+		"acknowledged_at": now,
+		"acknowledged_by": userID,
+	}).Error
+}
+
+// ResolveIncident 人工关闭事件，其下未恢复的告警一并恢复。
+// 条件仍然成立的告警会在下一次求值时作为新告警重新触发
+func (m *AlertManager) ResolveIncident(incidentID, userID uint, now time.Time, remark string) error {
+	var ids []uint
+	if err := m.db.Model(&Alert{}).Where("incident_id = ? AND status <> ?", incidentID, AlertStatusResolved).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		// 没有未恢复告警的事件直接关闭
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.db.Model(&Incident{}).Where("id = ? AND status <> ?", incidentID, AlertStatusResolved).
+			Updates(map[string]interface{}{
+				"status":       AlertStatusResolved,
+				"resolved_at":  now,
+				"resolved_by":  userID,
+				"active_count": 0,
+			}).Error
+	}
+	for _, id := range ids {
+		if err := m.Resolve(id, now, userID, remark, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ==================== 通知 ====================
+
+// notifyPending 按事件所属路由的时间发送到期的通知：
+// 等待 group_wait 后的首次通知（含此前未能送达的）、有新告警加入且距上次通知已过 group_interval 的更新、
+// 以及超过 repeat_interval 仍未确认的重复提醒
+func (m *AlertManager) notifyPending(now time.Time) {
+	var incidents []Incident
+	m.db.Where("status = ?", AlertStatusFiring).Find(&incidents)
+	routes := routing.GetService()
+	for i := range incidents {
+		inc := &incidents[i]
+		groupWait, groupInterval, repeat := time.Duration(0), routing.DefaultGroupInterval, m.repeatInterval
+		if r, ok := routes.Route(inc.RouteID); ok {
+			groupWait, groupInterval = r.GroupWait, r.GroupInterval
+			if r.RepeatInterval > 0 {
+				repeat = r.RepeatInterval
+			}
+		}
+
+		var event AlertEvent
+		switch {
+		case inc.LastNotifiedAt == nil:
+			if !now.Before(inc.FiredAt.Add(groupWait)) {
+				event = AlertEventFiring
+			}
+		case inc.ChangedAt != nil && inc.ChangedAt.After(*inc.LastNotifiedAt) &&
+			!now.Before(inc.LastNotifiedAt.Add(groupInterval)):
+			event = AlertEventFiring
+		case !now.Before(inc.LastNotifiedAt.Add(repeat)):
+			event = AlertEventRepeat
+		}
+		if event != "" {
+			m.notify(event, inc, now)
+		}
+	}
+}
+
+// notify 发送事件通知并记录通知时间，失败时不记录，由下一轮检查重试
+func (m *AlertManager) notify(event AlertEvent, incident *Incident, now time.Time) {
+	m.mu.Lock()
+	n := m.notifier
+	m.mu.Unlock()
+	if n == nil {
+		return
+	}
+
+	var alerts []Alert
+	q := m.db.Where("incident_id = ?", incident.ID)
+	if event != AlertEventResolved {
+		q = q.Where("status <> ?", AlertStatusResolved)
+	}
+	q.Order("id").Find(&alerts)
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return levelRank[alerts[i].Level] > levelRank[alerts[j].Level]
+	})
+
+	switch event {
+	case AlertEventFiring, AlertEventRepeat:
+		// 全部告警被静默、处于维护窗口或被根因告警抑制时不通知，也不记录通知时间，结束后由下一轮检查补发
+		if m.Suppressed(alerts, now) {
+			return
+		}
+	default:
+		// 从未通知过的事件（如全程处于静默中）不发送确认和恢复通知
+		if incident.NotifyCount == 0 {
+			return
+		}
+	}
+
+	if err := n.NotifyIncident(event, incident, alerts); err != nil {
+		global.Logger.Warn(fmt.Sprintf("事件 %d 通知失败: %v", incident.ID, err))
+		return
+	}
+	if event == AlertEventFiring || event == AlertEventRepeat {
+		m.db.Model(&Incident{}).Where("id = ?", incident.ID).Updates(map[string]interface{}{
+			"last_notified_at": now,
+			"notify_count":     gorm.Expr("notify_count + 1"),
+		})
+	}
+}
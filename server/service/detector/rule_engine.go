@@ -0,0 +1,675 @@
+package detector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/service/metrics/query"
+	"yunwei/service/prediction"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// AlertState 规则在一条序列上的状态
+type AlertState string
+
+const (
+	AlertStatePending AlertState = "pending" // 条件满足，尚未达到持续时间
+	AlertStateFiring  AlertState = "firing"  // 已触发并写入告警记录
+)
+
+// 规则健康状态
+const (
+	RuleHealthUnknown = "unknown"
+	RuleHealthOK      = "ok"
+	RuleHealthError   = "error"
+)
+
+// schedulerTick 调度检查间隔，规则按各自的求值间隔到期后执行
+const schedulerTick = 5 * time.Second
+
+// ruleReloadInterval 从数据库重新加载规则的间隔
+const ruleReloadInterval = time.Minute
+
+var (
+	ruleEvaluations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "yunwei",
+		Subsystem: "alert_rule",
+		Name:      "evaluations_total",
+		Help:      "告警规则求值次数",
+	}, []string{"result"})
+	ruleEvalDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "yunwei",
+		Subsystem: "alert_rule",
+		Name:      "evaluation_duration_seconds",
+		Help:      "单条告警规则求值耗时",
+		Buckets:   prometheus.DefBuckets,
+	})
+	ruleAlerts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "yunwei",
+		Subsystem: "alert_rule",
+		Name:      "alerts",
+		Help:      "当前 pending/firing 状态的告警数",
+	}, []string{"state"})
+)
+
+func init() {
+	prometheus.MustRegister(ruleEvaluations, ruleEvalDuration, ruleAlerts)
+}
+
+// RuleAlert 规则在一条序列上的告警状态
+type RuleAlert struct {
+	RuleID      uint              `json:"ruleId"`
+	RuleName    string            `json:"ruleName"`
+	Fingerprint string            `json:"fingerprint"`
+	State       AlertState        `json:"state"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Value       float64           `json:"value"`
+	ActiveAt    time.Time         `json:"activeAt"`          // 首次满足条件的时间
+	FiredAt     *time.Time        `json:"firedAt,omitempty"` // 转为 firing 的时间
+	LastSeenAt  time.Time         `json:"lastSeenAt"`        // 最后一次满足条件的时间
+	Hits        int               `json:"hits"`              // 连续满足条件的求值次数
+	AlertID     uint              `json:"alertId,omitempty"` // 对应的告警记录
+
+	Deviation *prediction.Deviation `json:"deviation,omitempty"` // 异常检测规则的当前偏离
+}
+
+// RuleStatus 规则运行状态
+type RuleStatus struct {
+	RuleID         uint         `json:"ruleId"`
+	Name           string       `json:"name"`
+	Expr           string       `json:"expr"`
+	For            string       `json:"for"`
+	Interval       string       `json:"interval"`
+	Health         string       `json:"health"`
+	LastError      string       `json:"lastError,omitempty"`
+	LastEvaluation *time.Time   `json:"lastEvaluation,omitempty"`
+	EvalDurationMs int64        `json:"evalDurationMs"`
+	WarmingUp      int          `json:"warmingUp,omitempty"` // 异常检测规则中仍在预热、暂不告警的序列数
+	Alerts         []*RuleAlert `json:"alerts"`
+}
+
+// PreviewSeries 规则试算结果
+type PreviewSeries struct {
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+	Active bool              `json:"active"` // 当前是否满足触发条件
+	Title  string            `json:"title"`
+	Body   string            `json:"message"`
+
+	Deviation *prediction.Deviation `json:"deviation,omitempty"` // 异常检测规则的偏离
+	WarmingUp bool                  `json:"warmingUp,omitempty"` // 序列历史不足，暂不评分
+}
+
+// ruleGroup 单条规则的运行时状态
+type ruleGroup struct {
+	compiled     *compiledRule
+	updatedAt    time.Time
+	alerts       map[string]*RuleAlert
+	lastEval     time.Time
+	lastErr      string
+	evalDuration time.Duration
+	baselines    *baselineSet // 异常检测规则学习到的基线
+	warmingUp    int
+}
+
+// RuleEngine 告警规则引擎，定时对指标存储求值
+type RuleEngine struct {
+	db       *gorm.DB
+	engine   *query.Engine
+	alerts   *AlertManager
+	interval time.Duration // 规则默认求值间隔
+
+	mu         sync.Mutex
+	groups     map[uint]*ruleGroup
+	loadedAt   time.Time
+	isLeader   func() bool
+	wasLeader  bool
+	cancel     context.CancelFunc
+	evalLocker sync.Mutex // 保证同一时刻只有一轮求值
+}
+
+var (
+	globalRuleEngine *RuleEngine
+	ruleEngineOnce   sync.Once
+)
+
+// GetRuleEngine 获取全局规则引擎
+func GetRuleEngine() *RuleEngine {
+	ruleEngineOnce.Do(func() {
+		interval := time.Duration(config.CONFIG.Alerting.EvalInterval) * time.Second
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		globalRuleEngine = NewRuleEngine(global.DB, query.GetEngine(), GetAlertManager(), interval)
+	})
+	return globalRuleEngine
+}
+
+// NewRuleEngine 创建规则引擎
+func NewRuleEngine(db *gorm.DB, engine *query.Engine, alerts *AlertManager, interval time.Duration) *RuleEngine {
+	return &RuleEngine{
+		db:       db,
+		engine:   engine,
+		alerts:   alerts,
+		interval: interval,
+		groups:   make(map[uint]*ruleGroup),
+		isLeader: func() bool { return true },
+	}
+}
+
+// SetLeaderCheck 设置 Leader 判断，集群中只有 Leader 求值，避免重复告警
+func (e *RuleEngine) SetLeaderCheck(fn func() bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if fn != nil {
+		e.isLeader = fn
+	}
+}
+
+// Start 启动定时求值
+func (e *RuleEngine) Start(ctx context.Context) {
+	e.mu.Lock()
+	if e.cancel != nil {
+		e.mu.Unlock()
+		return
+	}
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(schedulerTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				e.tick(now)
+			}
+		}
+	}()
+}
+
+// Stop 停止定时求值
+func (e *RuleEngine) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+}
+
+// Reload 规则变更后立即重新加载，非 Leader 节点由 Leader 自行加载
+func (e *RuleEngine) Reload() error {
+	e.evalLocker.Lock()
+	defer e.evalLocker.Unlock()
+
+	e.mu.Lock()
+	leader := e.wasLeader
+	e.mu.Unlock()
+	if !leader {
+		return nil
+	}
+	return e.loadRules(time.Now())
+}
+
+// tick 一次调度：处理 Leader 切换、按需加载规则、执行到期规则
+func (e *RuleEngine) tick(now time.Time) {
+	e.evalLocker.Lock()
+	defer e.evalLocker.Unlock()
+
+	e.mu.Lock()
+	leader := e.isLeader()
+	becameLeader := leader && !e.wasLeader
+	lostLeader := !leader && e.wasLeader
+	e.wasLeader = leader
+	e.mu.Unlock()
+
+	if lostLeader {
+		// 状态以新 Leader 为准，本节点只丢弃内存状态，不改告警记录
+		e.mu.Lock()
+		e.groups = make(map[uint]*ruleGroup)
+		e.loadedAt = time.Time{}
+		e.mu.Unlock()
+		e.updateGauges()
+	}
+	if !leader {
+		return
+	}
+
+	if becameLeader || now.Sub(e.loadedAt) >= ruleReloadInterval {
+		if err := e.loadRules(now); err != nil {
+			global.Logger.Warn(fmt.Sprintf("加载告警规则失败: %v", err))
+			return
+		}
+		if becameLeader {
+			e.restore()
+		}
+	}
+
+	e.mu.Lock()
+	var due []*ruleGroup
+	for _, g := range e.groups {
+		if now.Sub(g.lastEval) >= g.compiled.interval {
+			due = append(due, g)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, g := range due {
+		e.evalGroup(g, now)
+	}
+	e.updateGauges()
+}
+
+// loadRules 加载启用的规则，未变化的规则保留运行状态
+func (e *RuleEngine) loadRules(now time.Time) error {
+	var rules []DetectRule
+	if err := e.db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+		return err
+	}
+
+	next := make(map[uint]*ruleGroup, len(rules))
+	e.mu.Lock()
+	for _, rule := range rules {
+		if old, ok := e.groups[rule.ID]; ok && old.updatedAt.Equal(rule.UpdatedAt) {
+			next[rule.ID] = old
+			continue
+		}
+		compiled, err := compileRule(rule, e.interval)
+		if errors.Is(err, errNoExpression) {
+			// 进程、容器、端口类规则仍由巡检时的 Detect 处理
+			continue
+		}
+		g := &ruleGroup{compiled: compiled, updatedAt: rule.UpdatedAt, alerts: make(map[string]*RuleAlert)}
+		if err != nil {
+			g.compiled = &compiledRule{rule: rule, source: rule.Expr, interval: e.interval}
+			g.lastErr = err.Error()
+		}
+		// 规则修改后沿用原有告警状态，下次求值时按新条件处理
+		if old, ok := e.groups[rule.ID]; ok {
+			g.alerts = old.alerts
+		}
+		next[rule.ID] = g
+	}
+
+	var removed []*ruleGroup
+	for id, g := range e.groups {
+		if _, ok := next[id]; !ok {
+			removed = append(removed, g)
+		}
+	}
+	e.groups = next
+	e.loadedAt = now
+	e.mu.Unlock()
+
+	// 规则删除或停用后，其告警视为恢复
+	for _, g := range removed {
+		for _, a := range g.alerts {
+			if a.State == AlertStateFiring {
+				e.resolveAlert(a, now, "规则已停用或删除")
+			}
+		}
+	}
+	return nil
+}
+
+// restore 从告警记录恢复 firing 状态，避免重启或切换 Leader 后重复告警
+func (e *RuleEngine) restore() {
+	var alerts []Alert
+	e.db.Where("rule_id > 0 AND fingerprint <> '' AND status IN ?", []string{AlertStatusFiring, AlertStatusAcknowledged}).Find(&alerts)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range alerts {
+		a := &alerts[i]
+		g, ok := e.groups[a.RuleID]
+		if !ok {
+			continue
+		}
+		var labels map[string]string
+		json.Unmarshal([]byte(a.Labels), &labels)
+		var annotations map[string]string
+		json.Unmarshal([]byte(a.Annotations), &annotations)
+		firedAt := a.CreatedAt
+		if a.FiredAt != nil {
+			firedAt = *a.FiredAt
+		}
+		g.alerts[a.Fingerprint] = &RuleAlert{
+			RuleID:      a.RuleID,
+			RuleName:    g.compiled.rule.Name,
+			Fingerprint: a.Fingerprint,
+			State:       AlertStateFiring,
+			Labels:      labels,
+			Annotations: annotations,
+			Value:       a.MetricValue,
+			ActiveAt:    firedAt,
+			FiredAt:     &firedAt,
+			LastSeenAt:  time.Now(),
+			AlertID:     a.ID,
+		}
+	}
+}
+
+// activeSeries 本轮满足条件（或因恢复阈值仍保持）的序列
+type activeSeries struct {
+	labels map[string]string
+	value  float64
+	dev    *prediction.Deviation
+	hit    bool // 满足触发条件；false 表示只是还没越过恢复阈值
+}
+
+// evaluate 求值并返回活跃序列，以指纹为键
+func (e *RuleEngine) evaluate(c *compiledRule, now time.Time, held map[string]*RuleAlert) (map[string]*activeSeries, error) {
+	expr := c.expr
+	if c.cond != nil {
+		expr = c.cond.value
+	}
+	val, err := e.engine.InstantExpr(expr, now, query.Options{TenantID: c.rule.TenantID})
+	if err != nil {
+		return nil, err
+	}
+	vec, ok := val.(query.Vector)
+	if !ok {
+		return nil, fmt.Errorf("表达式结果类型 %s 不是瞬时向量", val.Type())
+	}
+
+	active := make(map[string]*activeSeries, len(vec))
+	for _, s := range vec {
+		labels := c.seriesLabels(s.Metric)
+		fp := fingerprint(c.rule.ID, labels)
+		if _, dup := active[fp]; dup {
+			return nil, fmt.Errorf("表达式结果中有标签相同的序列 %s", formatLabels(labels))
+		}
+
+		if c.cond == nil {
+			active[fp] = &activeSeries{labels: labels, value: s.V, hit: true}
+			continue
+		}
+		if c.cond.holds(s.V, c.cond.threshold) {
+			active[fp] = &activeSeries{labels: labels, value: s.V, hit: true}
+			continue
+		}
+		// 已触发的告警在值越过恢复阈值前保持
+		if a, ok := held[fp]; ok && a.State == AlertStateFiring && c.rule.ResolveThreshold != nil &&
+			c.cond.holds(s.V, *c.rule.ResolveThreshold) {
+			active[fp] = &activeSeries{labels: labels, value: s.V}
+		}
+	}
+	return active, nil
+}
+
+// evalGroup 执行一条规则并推进各序列的状态
+func (e *RuleEngine) evalGroup(g *ruleGroup, now time.Time) {
+	c := g.compiled
+	if c.expr == nil {
+		// 编译失败的规则不求值，只保留错误信息
+		g.lastEval = now
+		ruleEvaluations.WithLabelValues("invalid").Inc()
+		return
+	}
+
+	start := time.Now()
+	var active map[string]*activeSeries
+	var err error
+	if c.anomaly != nil {
+		active, err = e.evaluateAnomaly(g, now)
+	} else {
+		active, err = e.evaluate(c, now, g.alerts)
+	}
+	g.evalDuration = time.Since(start)
+	g.lastEval = now
+	ruleEvalDuration.Observe(g.evalDuration.Seconds())
+	if err != nil {
+		// 求值失败时保持现有状态，不因查询故障误报恢复
+		g.lastErr = err.Error()
+		ruleEvaluations.WithLabelValues("error").Inc()
+		global.Logger.Warn(fmt.Sprintf("告警规则 %s 求值失败: %v", c.rule.Name, err))
+		return
+	}
+	g.lastErr = ""
+	ruleEvaluations.WithLabelValues("success").Inc()
+
+	minHits := c.rule.Count
+	if minHits < 1 {
+		minHits = 1
+	}
+
+	for fp, s := range active {
+		a, ok := g.alerts[fp]
+		if !ok {
+			if !s.hit {
+				continue
+			}
+			a = &RuleAlert{
+				RuleID:      c.rule.ID,
+				RuleName:    c.rule.Name,
+				Fingerprint: fp,
+				State:       AlertStatePending,
+				Labels:      s.labels,
+				ActiveAt:    now,
+			}
+			g.alerts[fp] = a
+		}
+
+		a.Value = s.value
+		a.Deviation = s.dev
+		a.LastSeenAt = now
+		if s.hit {
+			a.Hits++
+		}
+		_, _, a.Annotations = c.content(a.Labels, a.Value, a.Deviation)
+
+		switch {
+		case a.State == AlertStatePending && a.Hits >= minHits && now.Sub(a.ActiveAt) >= c.forDuration:
+			e.fireAlert(c, a, now)
+		case a.State == AlertStateFiring:
+			// 刷新告警记录的现值；人工关闭后条件仍成立时会作为新告警重新触发
+			e.fireAlert(c, a, now)
+		}
+	}
+
+	for fp, a := range g.alerts {
+		if _, ok := active[fp]; ok {
+			continue
+		}
+		if a.State == AlertStatePending {
+			delete(g.alerts, fp)
+			continue
+		}
+		a.Hits = 0
+		if now.Sub(a.LastSeenAt) >= c.keepFiring {
+			e.resolveAlert(a, now, "")
+			delete(g.alerts, fp)
+		}
+	}
+}
+
+// fireAlert 转为 firing 并写入告警记录，已 firing 时刷新记录
+func (e *RuleEngine) fireAlert(c *compiledRule, a *RuleAlert, now time.Time) {
+	title, message, annotations := c.content(a.Labels, a.Value, a.Deviation)
+	labelsJSON, _ := json.Marshal(a.Labels)
+	annotationsJSON, _ := json.Marshal(annotations)
+
+	level := c.rule.Level
+	if level == "" {
+		level = AlertLevelWarning
+	}
+	serverID, _ := strconv.ParseUint(a.Labels[query.LabelServerID], 10, 64)
+	// 异常检测告警的阈值记为基线期望值，和现值放在一起才能看出偏离
+	threshold := c.threshold()
+	if a.Deviation != nil {
+		threshold = a.Deviation.Expected
+	}
+
+	firedAt := now
+	if a.FiredAt != nil {
+		firedAt = *a.FiredAt
+	}
+	alert := Alert{
+		ServerID:    uint(serverID),
+		Type:        c.rule.Type,
+		Level:       level,
+		Title:       title,
+		Message:     message,
+		MetricValue: a.Value,
+		Threshold:   threshold,
+		RuleID:      c.rule.ID,
+		Fingerprint: a.Fingerprint,
+		Labels:      string(labelsJSON),
+		Annotations: string(annotationsJSON),
+		FiredAt:     &firedAt,
+	}
+	stored, err := e.alerts.Fire(&alert, now)
+	if err != nil {
+		// 写入失败时保持原状态，下次求值重试
+		global.Logger.Warn(fmt.Sprintf("告警规则 %s 写入告警失败: %v", c.rule.Name, err))
+		return
+	}
+
+	a.State = AlertStateFiring
+	a.FiredAt = &firedAt
+	a.AlertID = stored.ID
+}
+
+// resolveAlert 将告警记录标记为已恢复
+func (e *RuleEngine) resolveAlert(a *RuleAlert, now time.Time, remark string) {
+	if a.AlertID == 0 {
+		return
+	}
+	if err := e.alerts.Resolve(a.AlertID, now, 0, remark, true); err != nil {
+		global.Logger.Warn(fmt.Sprintf("告警 %d 恢复失败: %v", a.AlertID, err))
+	}
+}
+
+// updateGauges 刷新告警状态指标
+func (e *RuleEngine) updateGauges() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	counts := map[AlertState]float64{AlertStatePending: 0, AlertStateFiring: 0}
+	for _, g := range e.groups {
+		for _, a := range g.alerts {
+			counts[a.State]++
+		}
+	}
+	for state, n := range counts {
+		ruleAlerts.WithLabelValues(string(state)).Set(n)
+	}
+}
+
+// ==================== 查询 ====================
+
+// Rules 所有规则的运行状态
+func (e *RuleEngine) Rules() []*RuleStatus {
+	e.evalLocker.Lock()
+	defer e.evalLocker.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make([]*RuleStatus, 0, len(e.groups))
+	for _, g := range e.groups {
+		c := g.compiled
+		st := &RuleStatus{
+			RuleID:         c.rule.ID,
+			Name:           c.rule.Name,
+			Expr:           c.source,
+			For:            query.FormatDuration(c.forDuration),
+			Interval:       query.FormatDuration(c.interval),
+			Health:         RuleHealthUnknown,
+			LastError:      g.lastErr,
+			EvalDurationMs: g.evalDuration.Milliseconds(),
+			WarmingUp:      g.warmingUp,
+			Alerts:         make([]*RuleAlert, 0, len(g.alerts)),
+		}
+		if !g.lastEval.IsZero() {
+			t := g.lastEval
+			st.LastEvaluation = &t
+			st.Health = RuleHealthOK
+		}
+		if g.lastErr != "" {
+			st.Health = RuleHealthError
+		}
+		for _, a := range g.alerts {
+			cp := *a
+			st.Alerts = append(st.Alerts, &cp)
+		}
+		out = append(out, st)
+	}
+	return out
+}
+
+// Preview 对规则试算一次，不改变状态、不写告警
+func (e *RuleEngine) Preview(rule DetectRule, now time.Time) ([]*PreviewSeries, error) {
+	c, err := compileRule(rule, e.interval)
+	if errors.Is(err, errNoExpression) {
+		return nil, fmt.Errorf("规则类型 %s 需要填写表达式", rule.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.anomaly != nil {
+		return e.previewAnomaly(c, now)
+	}
+
+	expr := c.expr
+	if c.cond != nil {
+		expr = c.cond.value
+	}
+	val, err := e.engine.InstantExpr(expr, now, query.Options{TenantID: rule.TenantID})
+	if err != nil {
+		return nil, err
+	}
+	vec, _ := val.(query.Vector)
+
+	out := make([]*PreviewSeries, 0, len(vec))
+	for _, s := range vec {
+		labels := c.seriesLabels(s.Metric)
+		title, message, _ := c.content(labels, s.V, nil)
+		out = append(out, &PreviewSeries{
+			Labels: labels,
+			Value:  s.V,
+			Active: c.cond == nil || c.cond.holds(s.V, c.cond.threshold),
+			Title:  title,
+			Body:   message,
+		})
+	}
+	return out, nil
+}
+
+// previewAnomaly 现学基线并对当前值评分
+func (e *RuleEngine) previewAnomaly(c *compiledRule, now time.Time) ([]*PreviewSeries, error) {
+	set, err := e.learnBaselines(c, now)
+	if err != nil {
+		return nil, fmt.Errorf("学习基线失败: %w", err)
+	}
+	samples, err := e.scoreAnomaly(c, set, now)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*PreviewSeries, 0, len(samples))
+	for _, s := range samples {
+		title, message, _ := c.content(s.labels, s.value, s.dev)
+		out = append(out, &PreviewSeries{
+			Labels:    s.labels,
+			Value:     s.value,
+			Active:    s.hit,
+			Title:     title,
+			Body:      message,
+			Deviation: s.dev,
+			WarmingUp: s.dev == nil,
+		})
+	}
+	return out, nil
+}
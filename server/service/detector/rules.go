@@ -1,10 +1,15 @@
 package detector
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"yunwei/model/server"
+	"yunwei/service/metrics/query"
+	"yunwei/service/silence"
 )
 
 // AlertLevel 告警级别
@@ -31,6 +36,10 @@ const (
 	AlertTypeDockerDown    AlertType = "docker_down"
 	AlertTypeProcessDown   AlertType = "process_down"
 	AlertTypeNetworkAnomaly AlertType = "network_anomaly"
+	AlertTypeHostDown       AlertType = "host_down"
+	AlertTypeSyntheticFailed AlertType = "synthetic_failed"
+	AlertTypeSLOBurnRate     AlertType = "slo_burn_rate"
+	AlertTypeAnomaly         AlertType = "anomaly" // 表达式的值偏离季节基线
 )
 
 // Alert 告警
@@ -51,20 +60,51 @@ type Alert struct {
 	Threshold   float64 `json:"threshold"`
 
 	// 状态
-	Status         string     `json:"status" gorm:"type:varchar(16);default:'active'"` // active, acknowledged, resolved
+	Status         string     `json:"status" gorm:"type:varchar(16);default:'firing'"` // firing, acknowledged, resolved
 	AcknowledgedBy uint       `json:"acknowledgedBy"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt"`
 	ResolvedAt     *time.Time `json:"resolvedAt"`
 	ResolvedBy     uint       `json:"resolvedBy"`
 
 	// 处理信息
 	AutoResolved bool   `json:"autoResolved" gorm:"default:false"`
 	ActionTaken  string `json:"actionTaken" gorm:"type:text"`
+
+	// 表达式规则产生的告警
+	RuleID      uint       `json:"ruleId" gorm:"index"`
+	Fingerprint string     `json:"fingerprint" gorm:"type:varchar(64);index"` // 规则+序列标签的哈希
+	Labels      string     `json:"labels" gorm:"type:text"`                   // 序列标签(JSON)
+	Annotations string     `json:"annotations" gorm:"type:text"`              // 渲染后的注释(JSON)
+	FiredAt     *time.Time `json:"firedAt"`
+
+	// 生命周期
+	IncidentID  uint       `json:"incidentId" gorm:"index"` // 所属事件
+	LastSeenAt  *time.Time `json:"lastSeenAt"`              // 最后一次检测到的时间
+	Occurrences int        `json:"occurrences"`             // 未恢复期间检测到的次数
+	InhibitedBy uint       `json:"inhibitedBy" gorm:"index"` // 抑制该告警的根因告警
+
+	Silenced *silence.Match `json:"silenced,omitempty" gorm:"-"` // 命中的静默或维护窗口，查询时填充
 }
 
 func (Alert) TableName() string {
 	return "alerts"
 }
 
+// MatchLabels 用于静默匹配的标签：告警标签加上规则名 rule
+func (a *Alert) MatchLabels() map[string]string {
+	labels := make(map[string]string)
+	json.Unmarshal([]byte(a.Labels), &labels)
+	if labels[query.LabelServerID] == "" && a.ServerID > 0 {
+		labels[query.LabelServerID] = strconv.FormatUint(uint64(a.ServerID), 10)
+	}
+	name := labels["alertname"]
+	if name == "" {
+		name = string(a.Type)
+	}
+	labels[silence.LabelRule] = name
+	return labels
+}
+
 // DetectRule 检测规则
 type DetectRule struct {
 	ID        uint      `json:"id" gorm:"primarykey"`
@@ -96,6 +136,31 @@ type DetectRule struct {
 
 	// 描述
 	Description string `json:"description" gorm:"type:varchar(255)"`
+
+	// 表达式规则，如 avg(cpu_usage[5m]) > 90 for 3m，"for" 部分覆盖 Duration
+	// 为空时由 Type 和 Threshold 生成，只有指标类规则能生成表达式
+	Expr     string `json:"expr" gorm:"type:text"`
+	Scope    string `json:"scope" gorm:"type:varchar(512)"` // 作用范围，如 group="web",tag="prod"
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"`
+
+	// 告警内容，支持模板变量 {{ $labels.server }}、{{ $value }}
+	Labels      string `json:"labels" gorm:"type:text"`         // 附加标签(JSON 对象)
+	Summary     string `json:"summary" gorm:"type:varchar(255)"` // 告警标题模板
+	Annotations string `json:"annotations" gorm:"type:text"`    // 注释模板(JSON 对象)
+
+	// 恢复条件：阈值类表达式的值越过 ResolveThreshold 才恢复，条件消失后保持 KeepFiringFor 秒
+	ResolveThreshold *float64 `json:"resolveThreshold"`
+	KeepFiringFor    int      `json:"keepFiringFor"`
+	EvalInterval     int      `json:"evalInterval"` // 求值间隔(秒)，0 使用全局配置
+
+	// 异常检测（Type 为 anomaly）：Expr 只写指标表达式，按每条序列学习到的季节基线判断是否异常
+	AnomalyAlgorithm    string  `json:"anomalyAlgorithm" gorm:"type:varchar(16)"`   // mad（默认）, holt_winters
+	AnomalySeasonality  string  `json:"anomalySeasonality" gorm:"type:varchar(16)"` // hour_of_day（默认）, hour_of_week
+	AnomalySensitivity  float64 `json:"anomalySensitivity"`                         // 偏离几倍正常波动幅度算异常，默认 3
+	AnomalyMinDeviation float64 `json:"anomalyMinDeviation"`                        // 与基线的最小绝对差，过滤波动很小的序列
+	AnomalyDirection    string  `json:"anomalyDirection" gorm:"type:varchar(8)"`    // up, down, both（默认）
+	AnomalyBaselineDays int     `json:"anomalyBaselineDays"`                        // 学习基线的历史天数
+	AnomalyWarmupDays   int     `json:"anomalyWarmupDays"`                          // 序列历史不足该天数时不告警
 }
 
 func (DetectRule) TableName() string {
@@ -127,13 +192,43 @@ type ProcessInfo struct {
 // Detector 检测器
 type Detector struct {
 	rules []DetectRule
+
+	// 每台服务器每条规则的连续触发情况，用于 Count 和 Duration
+	mu      sync.Mutex
+	streaks map[string]*streak
+}
+
+// streak 连续触发记录
+type streak struct {
+	hits  int
+	since time.Time
 }
 
 // NewDetector 创建检测器
 func NewDetector() *Detector {
 	return &Detector{
-		rules: GetDefaultRules(),
+		rules:   GetDefaultRules(),
+		streaks: make(map[string]*streak),
+	}
+}
+
+// confirm 记录本次检测结果，连续触发达到 Count 次且持续 Duration 秒后才确认
+func (d *Detector) confirm(serverID uint, index int, rule DetectRule, triggered bool, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := fmt.Sprintf("%d/%d", serverID, index)
+	if !triggered {
+		delete(d.streaks, key)
+		return false
+	}
+	st, ok := d.streaks[key]
+	if !ok {
+		st = &streak{since: now}
+		d.streaks[key] = st
 	}
+	st.hits++
+	return st.hits >= rule.Count && now.Sub(st.since) >= time.Duration(rule.Duration)*time.Second
 }
 
 // GetDefaultRules 获取默认规则
@@ -290,8 +385,9 @@ func GetDefaultRules() []DetectRule {
 // Detect 执行检测
 func (d *Detector) Detect(srv *server.Server, metric *server.ServerMetric, processes []ProcessInfo, containers []server.DockerContainer, ports []server.PortInfo) []DetectionResult {
 	var results []DetectionResult
+	now := time.Now()
 
-	for _, rule := range d.rules {
+	for i, rule := range d.rules {
 		if !rule.Enabled {
 			continue
 		}
@@ -319,7 +415,7 @@ func (d *Detector) Detect(srv *server.Server, metric *server.ServerMetric, proce
 			result = d.detectPortAttack(rule, srv, ports)
 		}
 
-		if result.Triggered {
+		if d.confirm(srv.ID, i, rule, result.Triggered, now) {
 			results = append(results, result)
 		}
 	}
@@ -0,0 +1,101 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunwei/global"
+	"yunwei/service/metrics/query"
+)
+
+// SLOInfo 燃烧率告警需要的 SLO 信息
+type SLOInfo struct {
+	ID              uint
+	Name            string
+	Service         string
+	TenantID        string
+	Objective       string // 目标(%)
+	WindowDays      int
+	SLI             float64
+	BudgetRemaining float64
+}
+
+// SLOBurn 一条触发的燃烧率规则
+type SLOBurn struct {
+	Level       AlertLevel
+	LongWindow  string
+	ShortWindow string
+	Rate        float64 // 长短窗口中较低的燃烧率
+	Threshold   float64
+}
+
+// sloBurnLevels 燃烧率告警分为快速燃烧(critical)和慢速燃烧(warning)两条，分别触发和恢复
+var sloBurnLevels = []AlertLevel{AlertLevelCritical, AlertLevelWarning}
+
+// SyncSLO 同步 SLO 燃烧率告警：burns 为本轮触发的规则，没有某一级别的规则触发时该级别的告警自动恢复。
+// burns 为空时恢复该 SLO 的全部燃烧率告警，可用于 SLO 停用或删除
+func (m *AlertManager) SyncSLO(s SLOInfo, burns []SLOBurn, now time.Time) {
+	sid := strconv.FormatUint(uint64(s.ID), 10)
+	for _, level := range sloBurnLevels {
+		fp := fingerprint(0, map[string]string{"type": string(AlertTypeSLOBurnRate), "slo_id": sid, "level": string(level)})
+
+		var matched []SLOBurn
+		for _, b := range burns {
+			if b.Level == level {
+				matched = append(matched, b)
+			}
+		}
+		if len(matched) == 0 {
+			var open []Alert
+			m.db.Select("id").Where("fingerprint = ? AND status <> ?", fp, AlertStatusResolved).Find(&open)
+			for _, a := range open {
+				if err := m.Resolve(a.ID, now, 0, "", true); err != nil {
+					global.Logger.Warn(fmt.Sprintf("告警 %d 自动恢复失败: %v", a.ID, err))
+				}
+			}
+			continue
+		}
+
+		top := matched[0]
+		lines := make([]string, 0, len(matched))
+		for _, b := range matched {
+			if b.Rate/b.Threshold > top.Rate/top.Threshold {
+				top = b
+			}
+			lines = append(lines, fmt.Sprintf("%s/%s 窗口燃烧率 %.2f，阈值 %.2f", b.LongWindow, b.ShortWindow, b.Rate, b.Threshold))
+		}
+
+		labels := map[string]string{
+			"alertname": string(AlertTypeSLOBurnRate),
+			"type":      string(AlertTypeSLOBurnRate),
+			"slo":       s.Name,
+			"slo_id":    sid,
+			"level":     string(level),
+		}
+		if s.Service != "" {
+			labels["service"] = s.Service
+		}
+		if s.TenantID != "" {
+			labels[query.LabelTenant] = s.TenantID
+		}
+		labelsJSON, _ := json.Marshal(labels)
+
+		_, err := m.Fire(&Alert{
+			Type:  AlertTypeSLOBurnRate,
+			Level: level,
+			Title: "SLO 错误预算燃烧过快: " + s.Name,
+			Message: fmt.Sprintf("目标 %s%%（%d 天），当前达标 %.3f%%，剩余预算 %.2f%%\n%s",
+				s.Objective, s.WindowDays, s.SLI, s.BudgetRemaining, strings.Join(lines, "\n")),
+			MetricValue: top.Rate,
+			Threshold:   top.Threshold,
+			Fingerprint: fp,
+			Labels:      string(labelsJSON),
+		}, now)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("SLO %s 告警写入失败: %v", s.Name, err))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package detector
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"yunwei/global"
+	"yunwei/service/metrics/query"
+)
+
+// SyntheticCheck 拨测告警需要的检查信息
+type SyntheticCheck struct {
+	ID       uint
+	Name     string
+	Type     string
+	Target   string
+	TenantID string
+	Level    AlertLevel
+}
+
+// SyntheticFingerprint 拨测检查告警的指纹，可用于查询检查当前未恢复的告警
+func SyntheticFingerprint(checkID uint) string {
+	return fingerprint(0, map[string]string{"type": string(AlertTypeSyntheticFailed), "check_id": strconv.FormatUint(uint64(checkID), 10)})
+}
+
+// SyncSynthetic 同步一轮拨测的结果：failures 为失败地点及原因，失败地点数达到 threshold 时触发告警，
+// 否则自动恢复。告警带 check 和 check_id 标签，可按检查静默和路由
+func (m *AlertManager) SyncSynthetic(c SyntheticCheck, failures map[string]string, threshold int, now time.Time) {
+	cid := strconv.FormatUint(uint64(c.ID), 10)
+	fp := SyntheticFingerprint(c.ID)
+
+	if len(failures) == 0 || len(failures) < threshold {
+		var open []Alert
+		m.db.Select("id").Where("fingerprint = ? AND status <> ?", fp, AlertStatusResolved).Find(&open)
+		for _, a := range open {
+			if err := m.Resolve(a.ID, now, 0, "", true); err != nil {
+				global.Logger.Warn(fmt.Sprintf("告警 %d 自动恢复失败: %v", a.ID, err))
+			}
+		}
+		return
+	}
+
+	locations := make([]string, 0, len(failures))
+	for l := range failures {
+		locations = append(locations, l)
+	}
+	sort.Strings(locations)
+	lines := make([]string, 0, len(locations))
+	for _, l := range locations {
+		lines = append(lines, fmt.Sprintf("%s: %s", l, failures[l]))
+	}
+
+	labels := map[string]string{
+		"alertname":  string(AlertTypeSyntheticFailed),
+		"type":       string(AlertTypeSyntheticFailed),
+		"check":      c.Name,
+		"check_id":   cid,
+		"check_type": c.Type,
+		"target":     c.Target,
+	}
+	if c.TenantID != "" {
+		labels[query.LabelTenant] = c.TenantID
+	}
+	labelsJSON, _ := json.Marshal(labels)
+
+	level := c.Level
+	if level == "" {
+		level = AlertLevelWarning
+	}
+	_, err := m.Fire(&Alert{
+		Type:        AlertTypeSyntheticFailed,
+		Level:       level,
+		Title:       "拨测失败: " + c.Name,
+		Message:     fmt.Sprintf("%s %s 在 %d 个地点失败\n%s", c.Type, c.Target, len(failures), strings.Join(lines, "\n")),
+		MetricValue: float64(len(failures)),
+		Threshold:   float64(threshold),
+		Fingerprint: fp,
+		Labels:      string(labelsJSON),
+	}, now)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("拨测 %s 告警写入失败: %v", c.Name, err))
+	}
+}
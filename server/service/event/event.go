@@ -0,0 +1,117 @@
+package event
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 事件类型
+const (
+	TypeDeploy       = "deploy"        // 部署任务
+	TypeCanary       = "canary"        // 灰度发布
+	TypeAlert        = "alert"         // 告警触发、恢复
+	TypeHeal         = "heal"          // 自愈
+	TypeConfig       = "config"        // 配置变更，来自审计日志中的增删改
+	TypeCommand      = "command"       // 命令执行
+	TypeAIDecision   = "ai_decision"   // AI 决策的审批和执行
+	TypeAgentUpgrade = "agent_upgrade" // Agent 升级
+)
+
+// typeText 类型的中文名，用于时间线和 AI 提示词
+var typeText = map[string]string{
+	TypeDeploy:       "部署",
+	TypeCanary:       "灰度发布",
+	TypeAlert:        "告警",
+	TypeHeal:         "自愈",
+	TypeConfig:       "配置变更",
+	TypeCommand:      "命令执行",
+	TypeAIDecision:   "AI 决策",
+	TypeAgentUpgrade: "Agent 升级",
+}
+
+// changeTypes 视为「变更」的事件类型，告警本身不算
+var changeTypes = []string{TypeDeploy, TypeCanary, TypeHeal, TypeConfig, TypeCommand, TypeAIDecision, TypeAgentUpgrade}
+
+// 事件级别
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event 事件流中的一条事件。各子系统在状态变化时发布，时间线按服务器、分组和时间查询
+type Event struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"createdAt"`
+	OccurredAt time.Time `json:"occurredAt" gorm:"index"`
+
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"`
+	Type     string `json:"type" gorm:"type:varchar(32);index"`
+	Action   string `json:"action" gorm:"type:varchar(32)"` // 如 started, succeeded, failed, fired, resolved
+	Severity string `json:"severity" gorm:"type:varchar(16)"`
+	Title    string `json:"title" gorm:"type:varchar(255)"`
+	Detail   string `json:"detail" gorm:"type:text"`
+	Labels   string `json:"labels" gorm:"type:text"` // 附加标签(JSON 对象)
+
+	// 涉及的服务器和分组，存为 ",1,2," 便于按单个 ID 匹配；都为空表示不限于具体服务器，如集群发布、全局配置
+	ServerIDs string `json:"serverIds" gorm:"type:varchar(1024)"`
+	GroupIDs  string `json:"groupIds" gorm:"type:varchar(255)"`
+
+	// 事件来源记录，如 deploy_task #12
+	Source   string `json:"source" gorm:"type:varchar(32)"`
+	SourceID uint   `json:"sourceId"`
+	Actor    string `json:"actor" gorm:"type:varchar(64)"` // 操作人，系统自动触发时为空
+
+	Servers []uint `json:"-" gorm:"-"` // 发布时填写，写入前转为 ServerIDs 并补齐分组和租户
+}
+
+func (Event) TableName() string {
+	return "events"
+}
+
+// TypeText 类型的中文名
+func (e *Event) TypeText() string {
+	if t, ok := typeText[e.Type]; ok {
+		return t
+	}
+	return e.Type
+}
+
+// MakeLabels 由键值对生成标签 JSON，空值的键不写入
+func MakeLabels(kv ...string) string {
+	labels := make(map[string]string, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			labels[kv[i]] = kv[i+1]
+		}
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(labels)
+	return string(b)
+}
+
+// joinIDs 把 ID 列表存为 ",1,2,"，去重并保持顺序
+func joinIDs(ids []uint) string {
+	seen := make(map[uint]bool, len(ids))
+	var parts []string
+	for _, id := range ids {
+		if id == 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "," + strings.Join(parts, ",") + ","
+}
+
+// idPattern ID 列表中匹配单个 ID 的 LIKE 条件
+func idPattern(id uint) string {
+	return "%," + strconv.FormatUint(uint64(id), 10) + ",%"
+}
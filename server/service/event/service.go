@@ -0,0 +1,290 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/model/server"
+
+	"gorm.io/gorm"
+)
+
+const (
+	cleanupInterval = time.Hour
+	// maxChanges 「告警前变更」最多返回的事件数
+	maxChanges = 200
+	// promptDetailRunes 提示词中每条事件详情保留的字符数
+	promptDetailRunes = 120
+)
+
+// Filter 时间线查询条件
+type Filter struct {
+	TenantID      string
+	ServerID      uint
+	GroupID       uint
+	Types         []string
+	Start, End    time.Time
+	IncludeGlobal bool // 按服务器或分组查询时，同时返回不限于具体服务器的事件
+	Page          int
+	PageSize      int
+}
+
+// Service 事件流
+type Service struct {
+	db           *gorm.DB
+	retention    time.Duration
+	changeWindow time.Duration
+
+	mu       sync.Mutex
+	isLeader func() bool
+	cancel   context.CancelFunc
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局事件流
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB, config.CONFIG.Events)
+	})
+	return globalService
+}
+
+// NewService 创建事件流
+func NewService(db *gorm.DB, cfg config.Events) *Service {
+	s := &Service{
+		db:           db,
+		retention:    time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		changeWindow: time.Duration(cfg.ChangeWindow) * time.Minute,
+		isLeader:     func() bool { return true },
+	}
+	if s.retention <= 0 {
+		s.retention = 90 * 24 * time.Hour
+	}
+	if s.changeWindow <= 0 {
+		s.changeWindow = time.Hour
+	}
+	return s
+}
+
+// SetLeaderCheck 设置 Leader 判断，过期事件只由 Leader 清理
+func (s *Service) SetLeaderCheck(fn func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn != nil {
+		s.isLeader = fn
+	}
+}
+
+// Start 启动过期事件清理
+func (s *Service) Start(ctx context.Context) {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.mu.Lock()
+				leader := s.isLeader()
+				s.mu.Unlock()
+				if leader {
+					s.Cleanup(now.Add(-s.retention))
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止清理
+func (s *Service) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// ChangeWindow 默认的变更查询窗口
+func (s *Service) ChangeWindow() time.Duration {
+	return s.changeWindow
+}
+
+// Publish 发布事件到全局事件流。事件只用于追溯，写入失败只记日志，不影响发布方的流程
+func Publish(ev *Event) {
+	if err := GetService().Publish(ev); err != nil {
+		global.Logger.Warn(fmt.Sprintf("发布%s事件失败: %v", ev.TypeText(), err))
+	}
+}
+
+// Publish 写入事件，按涉及的服务器补齐分组和租户
+func (s *Service) Publish(ev *Event) error {
+	if s.db == nil {
+		return fmt.Errorf("事件流未初始化")
+	}
+	if ev.Type == "" || ev.Title == "" {
+		return fmt.Errorf("事件缺少类型或标题")
+	}
+	ev.ID = 0
+	if ev.OccurredAt.IsZero() {
+		ev.OccurredAt = time.Now()
+	}
+	if ev.Severity == "" {
+		ev.Severity = SeverityInfo
+	}
+	ev.Title = truncateRunes(ev.Title, 255)
+
+	if len(ev.Servers) > 0 {
+		var servers []server.Server
+		if err := s.db.Select("id", "group_id", "tenant_id").Where("id IN ?", ev.Servers).Find(&servers).Error; err != nil {
+			return err
+		}
+		groups := make([]uint, 0, len(servers))
+		for _, srv := range servers {
+			groups = append(groups, srv.GroupID)
+			if ev.TenantID == "" {
+				ev.TenantID = srv.TenantID
+			}
+		}
+		ev.ServerIDs = joinIDs(ev.Servers)
+		if ev.GroupIDs == "" {
+			ev.GroupIDs = joinIDs(groups)
+		}
+	}
+	return s.db.Create(ev).Error
+}
+
+// Timeline 按条件查询事件，按发生时间倒序
+func (s *Service) Timeline(f Filter) ([]Event, int64, error) {
+	db := s.db.Model(&Event{})
+	if f.TenantID != "" {
+		db = db.Where("tenant_id = ?", f.TenantID)
+	}
+	if len(f.Types) > 0 {
+		db = db.Where("type IN ?", f.Types)
+	}
+	if !f.Start.IsZero() {
+		db = db.Where("occurred_at >= ?", f.Start)
+	}
+	if !f.End.IsZero() {
+		db = db.Where("occurred_at <= ?", f.End)
+	}
+	if f.ServerID > 0 || f.GroupID > 0 {
+		var conds []string
+		var args []interface{}
+		if f.ServerID > 0 {
+			conds = append(conds, "server_ids LIKE ?")
+			args = append(args, idPattern(f.ServerID))
+		}
+		if f.GroupID > 0 {
+			conds = append(conds, "group_ids LIKE ?")
+			args = append(args, idPattern(f.GroupID))
+		}
+		if f.IncludeGlobal {
+			conds = append(conds, "(server_ids = '' AND group_ids = '')")
+		}
+		db = db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if f.PageSize <= 0 || f.PageSize > 500 {
+		f.PageSize = 100
+	}
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	var events []Event
+	err := db.Order("occurred_at DESC, id DESC").Offset((f.Page - 1) * f.PageSize).Limit(f.PageSize).Find(&events).Error
+	return events, total, err
+}
+
+// ChangesBefore 查询 at 之前 window 内与服务器相关的变更：该服务器、其所在分组以及不限于具体服务器的事件，
+// 不含告警本身。serverID 为 0 时只返回不限于具体服务器的事件；window 为 0 时使用默认窗口
+func (s *Service) ChangesBefore(serverID uint, tenantID string, at time.Time, window time.Duration) ([]Event, error) {
+	if window <= 0 {
+		window = s.changeWindow
+	}
+	db := s.db.Where("occurred_at BETWEEN ? AND ? AND type IN ?", at.Add(-window), at, changeTypes)
+
+	scope := "(server_ids = '' AND group_ids = '')"
+	var args []interface{}
+	if serverID > 0 {
+		var srv server.Server
+		if err := s.db.Select("id", "group_id", "tenant_id").First(&srv, serverID).Error; err == nil {
+			if tenantID == "" {
+				tenantID = srv.TenantID
+			}
+			scope += " OR server_ids LIKE ?"
+			args = append(args, idPattern(srv.ID))
+			if srv.GroupID > 0 {
+				scope += " OR group_ids LIKE ?"
+				args = append(args, idPattern(srv.GroupID))
+			}
+		}
+	}
+	db = db.Where("("+scope+")", args...)
+	if tenantID != "" {
+		db = db.Where("tenant_id IN ?", []string{tenantID, ""})
+	}
+
+	var events []Event
+	err := db.Order("occurred_at DESC, id DESC").Limit(maxChanges).Find(&events).Error
+	return events, err
+}
+
+// Cleanup 删除早于 before 的事件
+func (s *Service) Cleanup(before time.Time) int64 {
+	res := s.db.Where("occurred_at < ?", before).Delete(&Event{})
+	if res.Error != nil {
+		global.Logger.Warn(fmt.Sprintf("清理过期事件失败: %v", res.Error))
+	}
+	return res.RowsAffected
+}
+
+// Summarize 把事件整理为按时间先后排列的文本，用于 AI 分析的提示词
+func Summarize(events []Event) string {
+	var sb strings.Builder
+	for i := len(events) - 1; i >= 0; i-- {
+		e := &events[i]
+		sb.WriteString(fmt.Sprintf("- %s [%s] %s", e.OccurredAt.Format("01-02 15:04:05"), e.TypeText(), e.Title))
+		if e.Actor != "" {
+			sb.WriteString("（" + e.Actor + "）")
+		}
+		if d := strings.TrimSpace(e.Detail); d != "" {
+			sb.WriteString("：" + truncateRunes(strings.ReplaceAll(d, "\n", " "), promptDetailRunes))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// truncateRunes 按字符截断
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
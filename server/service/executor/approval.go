@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/agent"
+	haService "yunwei/service/ha"
+)
+
+// ErrNotPending 执行记录不存在或已被审批
+var ErrNotPending = errors.New("执行记录不存在或已处理")
+
+// defaultCommandTimeout 通过 Agent 执行单条命令的超时时间
+const defaultCommandTimeout = 60 * time.Second
+
+// RunOnAgent 通过服务器上的 Agent 执行命令，Agent 可能连接在集群中任一节点
+func RunOnAgent(ctx context.Context, serverID uint, command string, timeout time.Duration) (string, error) {
+	var ag agent.Agent
+	if err := global.DB.Where("server_id = ?", serverID).First(&ag).Error; err != nil {
+		return "", errors.New("服务器没有安装 Agent，无法执行命令")
+	}
+	if ag.Status == agent.AgentStatusDisabled {
+		return "", errors.New("Agent 已禁用")
+	}
+	result, err := haService.GetHAManager().GetAgentRouter().ExecuteCommand(ctx, &haService.AgentCommand{
+		AgentID: ag.AgentID,
+		Command: command,
+		Timeout: int(timeout / time.Second),
+	})
+	if err != nil {
+		return "", err
+	}
+	if result.Status != "success" {
+		return result.Output, fmt.Errorf("命令返回 %s（退出码 %d）", result.Status, result.ExitCode)
+	}
+	return result.Output, nil
+}
+
+// AgentRunner 通过 Agent 执行命令，审批通过的执行记录默认使用
+type AgentRunner struct{}
+
+func (AgentRunner) Run(serverID uint, command string) (string, error) {
+	// 多留出转发和回传结果的时间
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout+10*time.Second)
+	defer cancel()
+	return RunOnAgent(ctx, serverID, command, defaultCommandTimeout)
+}
+
+// runner 未通过 SetCommandRunner 指定时通过 Agent 执行
+func (e *Executor) runner() CommandRunner {
+	if e.sshExecutor != nil {
+		return e.sshExecutor
+	}
+	return AgentRunner{}
+}
+
+// Approve 批准待审批的执行记录并开始执行，控制台和 ChatOps 共用
+func (e *Executor) Approve(recordID, userID uint) (*ExecutionRecord, error) {
+	res := global.DB.Model(&ExecutionRecord{}).
+		Where("id = ? AND status = ? AND approved_by = 0", recordID, ExecutionStatusPending).
+		Updates(map[string]interface{}{"approved_by": userID, "approved_at": time.Now()})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNotPending
+	}
+
+	var record ExecutionRecord
+	if err := global.DB.First(&record, recordID).Error; err != nil {
+		return nil, err
+	}
+	if err := e.ExecuteWithApproval(&record, e.runner(), userID); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Reject 拒绝待审批的执行记录，记录标记为已取消
+func (e *Executor) Reject(recordID uint, reason string) error {
+	res := global.DB.Model(&ExecutionRecord{}).
+		Where("id = ? AND status = ? AND approved_by = 0", recordID, ExecutionStatusPending).
+		Updates(map[string]interface{}{"status": ExecutionStatusCancelled, "error": "审批被拒绝: " + reason})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotPending
+	}
+	return nil
+}
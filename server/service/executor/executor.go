@@ -8,9 +8,8 @@ import (
 
 	"yunwei/global"
 	"yunwei/model/server"
+	"yunwei/service/event"
 	"yunwei/service/security"
-
-	"gorm.io/gorm"
 )
 
 // ExecutionStatus 执行状态
@@ -266,6 +265,22 @@ func (e *Executor) Execute(record *ExecutionRecord, runner CommandRunner) ([]Com
 	record.Output = string(resultsJSON)
 	global.DB.Save(record)
 
+	action, severity := "succeeded", event.SeverityInfo
+	if hasError {
+		action, severity = "failed", event.SeverityWarning
+	}
+	event.Publish(&event.Event{
+		Type:     event.TypeCommand,
+		Action:   action,
+		Severity: severity,
+		Title:    fmt.Sprintf("执行 %d 条命令（%s）", len(results), record.Source),
+		Detail:   strings.Join(validation.SafeCommands[:len(results)], "\n"),
+		Labels:   event.MakeLabels("source", record.Source),
+		Servers:  []uint{record.ServerID},
+		Source:   "execution_record",
+		SourceID: record.ID,
+	})
+
 	return results, nil
 }
 
@@ -0,0 +1,480 @@
+package ha
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/model/ha"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Agent 路由错误
+var (
+	ErrAgentNotConnected = errors.New("Agent 未连接到任何控制节点")
+	ErrAgentDisconnected = errors.New("Agent 连接已断开")
+	ErrOwnerNodeDown     = errors.New("Agent 所在控制节点已离线，等待 Agent 重连")
+	ErrNoDispatcher      = errors.New("本节点未启动 Agent gRPC 服务")
+)
+
+// 节点间请求头
+const (
+	ClusterHeaderNode      = "X-Cluster-Node"
+	ClusterHeaderTimestamp = "X-Cluster-Timestamp"
+	ClusterHeaderSignature = "X-Cluster-Signature"
+)
+
+// AgentCommandPath 节点间转发命令的内部接口
+const AgentCommandPath = "/api/v1/internal/cluster/agents/%s/commands"
+
+// defaultCommandTimeout 命令默认超时
+const defaultCommandTimeout = 60 * time.Second
+
+// 命令类型
+const (
+	CommandTypeShell = ""      // Shell 命令
+	CommandTypeProbe = "probe" // 拨测，Command 为拨测参数(JSON)，Output 为观测结果(JSON)
+)
+
+// AgentCommand 下发到 Agent 的命令
+type AgentCommand struct {
+	CommandID string `json:"commandId"`
+	AgentID   string `json:"agentId"`
+	Type      string `json:"type,omitempty"`
+	Command   string `json:"command"`
+	Timeout   int    `json:"timeout"` // 秒
+}
+
+// AgentCommandResult 命令执行结果
+type AgentCommandResult struct {
+	CommandID string `json:"commandId"`
+	AgentID   string `json:"agentId"`
+	NodeID    string `json:"nodeId"` // 实际下发命令的控制节点
+	Forwarded bool   `json:"forwarded"`
+	Status    string `json:"status"` // success, failed, timeout
+	Output    string `json:"output"`
+	ExitCode  int    `json:"exitCode"`
+	Duration  int64  `json:"duration"` // 毫秒
+}
+
+// CommandDispatcher 向本节点上连接的 Agent 下发命令，由 gRPC 服务实现
+type CommandDispatcher interface {
+	DispatchCommand(ctx context.Context, cmd *AgentCommand) (*AgentCommandResult, error)
+}
+
+// AgentLocationBackend Agent 位置存储
+type AgentLocationBackend interface {
+	Put(loc *ha.AgentLocation) error
+	Get(agentID string) (*ha.AgentLocation, error)
+	Remove(agentID, sessionID string) error
+	ListByNode(nodeID string) ([]ha.AgentLocation, error)
+	RemoveByNode(nodeID string) (int64, error)
+}
+
+// AgentRouter Agent 路由
+// 记录每个 Agent 的命令流连接在哪个控制节点，命令请求落在其他节点时转发到所在节点执行
+type AgentRouter struct {
+	mu         sync.Mutex
+	nodeID     string
+	addr       string
+	backend    AgentLocationBackend
+	clusterMgr *ClusterManager
+	dispatcher CommandDispatcher
+	client     *http.Client
+
+	// forwards 正在转发中的请求，按目标节点分组，节点故障时立即取消
+	forwards map[string]map[uint64]context.CancelCauseFunc
+	seq      uint64
+}
+
+// NewAgentRouter 创建 Agent 路由
+func NewAgentRouter(nodeID, addr string, backend AgentLocationBackend, clusterMgr *ClusterManager) *AgentRouter {
+	return &AgentRouter{
+		nodeID:     nodeID,
+		addr:       addr,
+		backend:    backend,
+		clusterMgr: clusterMgr,
+		client:     &http.Client{},
+		forwards:   make(map[string]map[uint64]context.CancelCauseFunc),
+	}
+}
+
+// SetDispatcher 设置本节点的命令下发实现
+func (r *AgentRouter) SetDispatcher(d CommandDispatcher) {
+	r.mu.Lock()
+	r.dispatcher = d
+	r.mu.Unlock()
+}
+
+// NodeID 本节点 ID
+func (r *AgentRouter) NodeID() string {
+	return r.nodeID
+}
+
+// ==================== 会话登记 ====================
+
+// RegisterSession Agent 命令流接入本节点
+func (r *AgentRouter) RegisterSession(agentID, sessionID string) error {
+	now := time.Now()
+	return r.backend.Put(&ha.AgentLocation{
+		AgentID:     agentID,
+		NodeID:      r.nodeID,
+		NodeAddr:    r.addr,
+		SessionID:   sessionID,
+		ConnectedAt: now,
+		LastSeenAt:  now,
+	})
+}
+
+// UnregisterSession Agent 命令流断开，会话已被其他节点接管时不做处理
+func (r *AgentRouter) UnregisterSession(agentID, sessionID string) error {
+	return r.backend.Remove(agentID, sessionID)
+}
+
+// Locate 查询 Agent 所在节点
+func (r *AgentRouter) Locate(agentID string) (*ha.AgentLocation, error) {
+	loc, err := r.backend.Get(agentID)
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		return nil, ErrAgentNotConnected
+	}
+	return loc, nil
+}
+
+// ListLocations 列出 Agent 位置，nodeID 为空时返回全部
+func (r *AgentRouter) ListLocations(nodeID string) ([]ha.AgentLocation, error) {
+	return r.backend.ListByNode(nodeID)
+}
+
+// Reset 清除本节点遗留的位置记录，节点启动和停止时调用
+func (r *AgentRouter) Reset() {
+	r.backend.RemoveByNode(r.nodeID)
+}
+
+// ==================== 命令执行 ====================
+
+// ExecuteCommand 在 Agent 上执行命令，Agent 不在本节点时转发到所在节点
+func (r *AgentRouter) ExecuteCommand(ctx context.Context, cmd *AgentCommand) (*AgentCommandResult, error) {
+	if cmd.CommandID == "" {
+		cmd.CommandID = fmt.Sprintf("%s-%d", r.nodeID, time.Now().UnixNano())
+	}
+
+	loc, err := r.Locate(cmd.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	if loc.NodeID == r.nodeID {
+		return r.ExecuteLocal(ctx, cmd)
+	}
+	if r.clusterMgr != nil && !r.clusterMgr.IsNodeOnline(loc.NodeID) {
+		return nil, ErrOwnerNodeDown
+	}
+	return r.forward(ctx, loc, cmd)
+}
+
+// ExecuteLocal 在本节点连接的 Agent 上执行命令
+func (r *AgentRouter) ExecuteLocal(ctx context.Context, cmd *AgentCommand) (*AgentCommandResult, error) {
+	r.mu.Lock()
+	d := r.dispatcher
+	r.mu.Unlock()
+	if d == nil {
+		return nil, ErrNoDispatcher
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout(cmd))
+	defer cancel()
+
+	result, err := d.DispatchCommand(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	result.NodeID = r.nodeID
+	return result, nil
+}
+
+// forward 转发命令到 Agent 所在节点
+func (r *AgentRouter) forward(ctx context.Context, loc *ha.AgentLocation, cmd *AgentCommand) (*AgentCommandResult, error) {
+	if loc.NodeAddr == "" {
+		return nil, fmt.Errorf("节点 %s 未登记访问地址", loc.NodeID)
+	}
+
+	// 多留出转发开销，由所在节点负责命令本身的超时
+	ctx, cancelTimeout := context.WithTimeout(ctx, commandTimeout(cmd)+10*time.Second)
+	defer cancelTimeout()
+	ctx, done := r.trackForward(ctx, loc.NodeID)
+	defer done()
+
+	body, _ := json.Marshal(cmd)
+	endpoint := "http://" + loc.NodeAddr + fmt.Sprintf(AgentCommandPath, url.PathEscape(cmd.AgentID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ClusterHeaderNode, r.nodeID)
+	req.Header.Set(ClusterHeaderTimestamp, ts)
+	req.Header.Set(ClusterHeaderSignature, SignClusterRequest(r.nodeID, ts, body))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, ErrOwnerNodeDown) {
+			return nil, ErrOwnerNodeDown
+		}
+		return nil, fmt.Errorf("转发到节点 %s 失败: %w", loc.NodeID, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取节点 %s 响应失败: %w", loc.NodeID, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e ForwardError
+		if json.Unmarshal(data, &e) == nil && e.Code != "" {
+			return nil, e.toError()
+		}
+		return nil, fmt.Errorf("节点 %s 返回 %d", loc.NodeID, resp.StatusCode)
+	}
+
+	var result AgentCommandResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("解析节点 %s 响应失败: %w", loc.NodeID, err)
+	}
+	result.Forwarded = true
+	return &result, nil
+}
+
+// trackForward 登记转发请求，返回可被节点故障取消的上下文
+func (r *AgentRouter) trackForward(ctx context.Context, nodeID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	r.mu.Lock()
+	r.seq++
+	id := r.seq
+	if r.forwards[nodeID] == nil {
+		r.forwards[nodeID] = make(map[uint64]context.CancelCauseFunc)
+	}
+	r.forwards[nodeID][id] = cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.forwards[nodeID], id)
+		if len(r.forwards[nodeID]) == 0 {
+			delete(r.forwards, nodeID)
+		}
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// ==================== 节点故障 ====================
+
+// HandleNodeFailure 节点故障时立即取消发往该节点的命令，并释放其上的 Agent 位置，
+// Agent 重连到存活节点后会重新登记
+func (r *AgentRouter) HandleNodeFailure(nodeID string) {
+	if nodeID == r.nodeID {
+		return
+	}
+
+	r.mu.Lock()
+	pending := r.forwards[nodeID]
+	delete(r.forwards, nodeID)
+	r.mu.Unlock()
+	for _, cancel := range pending {
+		cancel(ErrOwnerNodeDown)
+	}
+
+	released, err := r.backend.RemoveByNode(nodeID)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("释放节点 %s 的 Agent 位置失败: %v", nodeID, err))
+		return
+	}
+	if released > 0 || len(pending) > 0 {
+		global.DB.Create(&ha.ClusterEvent{
+			EventType: "agents_rehomed",
+			NodeID:    nodeID,
+			Title:     fmt.Sprintf("Node %s down, %d agents released", nodeID, released),
+			Detail:    fmt.Sprintf("%d in-flight commands failed", len(pending)),
+			Level:     "warning",
+			Source:    "agent_router",
+		})
+	}
+}
+
+// ==================== 节点间认证 ====================
+
+// ForwardError 转发接口的错误响应
+type ForwardError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// 转发错误码
+const (
+	ForwardCodeNotConnected = "agent_not_connected"
+	ForwardCodeDisconnected = "agent_disconnected"
+	ForwardCodeTimeout      = "timeout"
+	ForwardCodeFailed       = "failed"
+)
+
+// NewForwardError 将命令执行错误转换为转发响应
+func NewForwardError(err error) ForwardError {
+	code := ForwardCodeFailed
+	switch {
+	case errors.Is(err, ErrAgentNotConnected), errors.Is(err, ErrNoDispatcher):
+		code = ForwardCodeNotConnected
+	case errors.Is(err, ErrAgentDisconnected):
+		code = ForwardCodeDisconnected
+	case errors.Is(err, context.DeadlineExceeded):
+		code = ForwardCodeTimeout
+	}
+	return ForwardError{Code: code, Message: err.Error()}
+}
+
+func (e ForwardError) toError() error {
+	switch e.Code {
+	case ForwardCodeNotConnected:
+		return ErrAgentNotConnected
+	case ForwardCodeDisconnected:
+		return ErrAgentDisconnected
+	case ForwardCodeTimeout:
+		return context.DeadlineExceeded
+	}
+	return errors.New(e.Message)
+}
+
+// SignClusterRequest 节点间请求签名，各节点共用 JWT 签名密钥
+func SignClusterRequest(nodeID, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(config.CONFIG.JWT.SigningKey))
+	mac.Write([]byte(nodeID + "\n" + timestamp + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyClusterRequest 校验节点间请求签名
+func VerifyClusterRequest(nodeID, timestamp, signature string, body []byte) error {
+	if nodeID == "" || timestamp == "" || signature == "" {
+		return errors.New("缺少节点签名")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("时间戳无效")
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > time.Minute || d < -time.Minute {
+		return errors.New("签名已过期")
+	}
+	if !hmac.Equal([]byte(SignClusterRequest(nodeID, timestamp, body)), []byte(signature)) {
+		return errors.New("签名校验失败")
+	}
+	return nil
+}
+
+// ==================== 工具函数 ====================
+
+func commandTimeout(cmd *AgentCommand) time.Duration {
+	if cmd.Timeout > 0 {
+		return time.Duration(cmd.Timeout) * time.Second
+	}
+	return defaultCommandTimeout
+}
+
+// advertiseAddr 本节点对集群暴露的 API 地址
+func advertiseAddr() string {
+	if addr := config.CONFIG.System.AdvertiseAddr; addr != "" {
+		return addr
+	}
+	port := config.CONFIG.System.Port
+	if port == "" {
+		port = "8080"
+	}
+	return net.JoinHostPort(internalIP(), port)
+}
+
+// internalIP 第一个非回环 IPv4 地址
+func internalIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+				return ipNet.IP.String()
+			}
+		}
+	}
+	return "127.0.0.1"
+}
+
+// ==================== 数据库位置后端 ====================
+
+// DatabaseAgentLocationBackend 数据库 Agent 位置后端
+type DatabaseAgentLocationBackend struct {
+	db *gorm.DB
+}
+
+// NewDatabaseAgentLocationBackend 创建数据库 Agent 位置后端
+func NewDatabaseAgentLocationBackend(db *gorm.DB) *DatabaseAgentLocationBackend {
+	return &DatabaseAgentLocationBackend{db: db}
+}
+
+// Put 登记位置，已存在时由新会话接管
+func (b *DatabaseAgentLocationBackend) Put(loc *ha.AgentLocation) error {
+	return b.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "agent_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"node_id", "node_addr", "session_id", "connected_at", "last_seen_at", "updated_at"}),
+	}).Create(loc).Error
+}
+
+// Get 查询位置，不存在时返回 nil
+func (b *DatabaseAgentLocationBackend) Get(agentID string) (*ha.AgentLocation, error) {
+	var loc ha.AgentLocation
+	err := b.db.Where("agent_id = ?", agentID).First(&loc).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &loc, nil
+}
+
+// Remove 删除位置，仅当仍属于该会话时
+func (b *DatabaseAgentLocationBackend) Remove(agentID, sessionID string) error {
+	return b.db.Where("agent_id = ? AND session_id = ?", agentID, sessionID).
+		Delete(&ha.AgentLocation{}).Error
+}
+
+// ListByNode 列出节点上的 Agent
+func (b *DatabaseAgentLocationBackend) ListByNode(nodeID string) ([]ha.AgentLocation, error) {
+	query := b.db.Model(&ha.AgentLocation{})
+	if nodeID != "" {
+		query = query.Where("node_id = ?", nodeID)
+	}
+	var locs []ha.AgentLocation
+	err := query.Order("agent_id").Find(&locs).Error
+	return locs, err
+}
+
+// RemoveByNode 删除节点上的全部位置
+func (b *DatabaseAgentLocationBackend) RemoveByNode(nodeID string) (int64, error) {
+	result := b.db.Where("node_id = ?", nodeID).Delete(&ha.AgentLocation{})
+	return result.RowsAffected, result.Error
+}
@@ -19,15 +19,27 @@ type ClusterManager struct {
 	leaderService   *LeaderElectionService
 	config          *ha.HAClusterConfig
 	heartbeatCancel context.CancelFunc
+	nodeID          string
+
+	// failureHandlers 节点离线回调
+	failureHandlers []func(nodeID string)
 }
 
 // NewClusterManager 创建集群管理器
 func NewClusterManager(nodeID string) *ClusterManager {
 	return &ClusterManager{
-		nodes: make(map[string]*ha.ClusterNode),
+		nodeID: nodeID,
+		nodes:  make(map[string]*ha.ClusterNode),
 	}
 }
 
+// OnNodeFailure 注册节点离线回调
+func (m *ClusterManager) OnNodeFailure(fn func(nodeID string)) {
+	m.mu.Lock()
+	m.failureHandlers = append(m.failureHandlers, fn)
+	m.mu.Unlock()
+}
+
 // SetLeaderService 设置 Leader 选举服务
 func (m *ClusterManager) SetLeaderService(ls *LeaderElectionService) {
 	m.leaderService = ls
@@ -273,6 +285,7 @@ func (m *ClusterManager) StartHeartbeatMonitor(ctx context.Context) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
+				m.syncNodes()
 				m.checkHeartbeats()
 			}
 		}
@@ -286,6 +299,63 @@ func (m *ClusterManager) StopHeartbeatMonitor() {
 	}
 }
 
+// syncNodes 从数据库同步其他节点的心跳状态
+func (m *ClusterManager) syncNodes() {
+	var nodes []ha.ClusterNode
+	if err := global.DB.Where("enabled = ?", true).Find(&nodes).Error; err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range nodes {
+		node := nodes[i]
+		if node.NodeID == m.nodeID {
+			continue
+		}
+		if existing, ok := m.nodes[node.NodeID]; ok {
+			existing.LastHeartbeat = node.LastHeartbeat
+			existing.InternalIP = node.InternalIP
+			existing.APIPort = node.APIPort
+			existing.IsLeader = node.IsLeader
+			// 离线状态由本节点判定，避免重复触发故障处理
+			if node.Status != ha.NodeStatusOffline {
+				existing.Status = node.Status
+			}
+			continue
+		}
+		m.nodes[node.NodeID] = &node
+	}
+}
+
+// IsNodeOnline 节点是否在线
+func (m *ClusterManager) IsNodeOnline(nodeID string) bool {
+	if nodeID == m.nodeID {
+		return true
+	}
+
+	m.mu.RLock()
+	node, ok := m.nodes[nodeID]
+	m.mu.RUnlock()
+	if !ok {
+		var dbNode ha.ClusterNode
+		if err := global.DB.Where("node_id = ?", nodeID).First(&dbNode).Error; err != nil {
+			return false
+		}
+		node = &dbNode
+	}
+
+	if node.Status == ha.NodeStatusOffline || node.LastHeartbeat == nil {
+		return false
+	}
+	timeout := 30 * time.Second
+	if m.config != nil && m.config.HeartbeatTimeout > 0 {
+		timeout = time.Duration(m.config.HeartbeatTimeout) * time.Second
+	}
+	return time.Since(*node.LastHeartbeat) <= timeout
+}
+
 // checkHeartbeats 检查心跳
 func (m *ClusterManager) checkHeartbeats() {
 	m.mu.Lock()
@@ -299,14 +369,13 @@ func (m *ClusterManager) checkHeartbeats() {
 	now := time.Now()
 
 	for nodeID, node := range m.nodes {
-		if node.LastHeartbeat == nil {
+		if node.LastHeartbeat == nil || nodeID == m.nodeID {
 			continue
 		}
 
-		// 检查是否超时
-		if now.Sub(*node.LastHeartbeat) > timeout {
+		// 检查是否超时，只在状态变化时处理一次
+		if now.Sub(*node.LastHeartbeat) > timeout && node.Status != ha.NodeStatusOffline {
 			// 节点离线
-			oldStatus := node.Status
 			node.Status = ha.NodeStatusOffline
 
 			// 更新数据库
@@ -322,7 +391,9 @@ func (m *ClusterManager) checkHeartbeats() {
 				go m.handleFailover(node)
 			}
 
-			_ = oldStatus
+			for _, fn := range m.failureHandlers {
+				go fn(nodeID)
+			}
 		}
 	}
 }
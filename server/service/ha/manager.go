@@ -4,9 +4,11 @@ import (
         "context"
         "fmt"
         "os"
+        "strconv"
         "sync"
         "time"
 
+        "yunwei/config"
         "yunwei/global"
         "yunwei/model/ha"
 )
@@ -21,11 +23,25 @@ type HAManager struct {
         clusterManager *ClusterManager
         sessionManager *SessionManager
         taskHAManager  *TaskHAManager
+        agentRouter    *AgentRouter
 
         started bool
         stopCh  chan struct{}
 }
 
+var (
+        globalManager     *HAManager
+        globalManagerOnce sync.Once
+)
+
+// GetHAManager 获取本进程的 HA 管理器
+func GetHAManager() *HAManager {
+        globalManagerOnce.Do(func() {
+                globalManager = NewHAManager()
+        })
+        return globalManager
+}
+
 // HAOption HA 选项
 type HAOption func(*HAManager)
 
@@ -97,6 +113,15 @@ func (m *HAManager) initServices() {
 
         // 创建任务 HA 管理器
         m.taskHAManager = NewTaskHAManager(m.nodeID, m.lockService, m.clusterManager)
+
+        // 创建 Agent 路由
+        m.agentRouter = NewAgentRouter(m.nodeID, advertiseAddr(), NewDatabaseAgentLocationBackend(global.DB), m.clusterManager)
+
+        // 节点离线时接管其任务和 Agent
+        m.clusterManager.OnNodeFailure(func(nodeID string) {
+                m.taskHAManager.HandleNodeFailure(nodeID)
+        })
+        m.clusterManager.OnNodeFailure(m.agentRouter.HandleNodeFailure)
 }
 
 // loadConfig 加载配置
@@ -141,6 +166,9 @@ func (m *HAManager) Start(ctx context.Context) error {
         // 注册本节点
         m.registerSelf()
 
+        // 清理上次运行遗留的 Agent 位置
+        m.agentRouter.Reset()
+
         // 启动 Leader 选举
         if err := m.leaderService.Start(ctx); err != nil {
                 return fmt.Errorf("failed to start leader election: %w", err)
@@ -178,7 +206,8 @@ func (m *HAManager) Stop() {
         m.clusterManager.StopHeartbeatMonitor()
         m.sessionManager.StopCleanup()
 
-        // 注销本节点
+        // 释放本节点上的 Agent，注销本节点
+        m.agentRouter.Reset()
         m.unregisterSelf()
 
         m.started = false
@@ -186,10 +215,15 @@ func (m *HAManager) Stop() {
 
 // registerSelf 注册本节点
 func (m *HAManager) registerSelf() error {
+        apiPort, _ := strconv.Atoi(config.CONFIG.System.Port)
+        grpcPort, _ := strconv.Atoi(config.CONFIG.System.GrpcPort)
         node := &ha.ClusterNode{
                 NodeID:     m.nodeID,
                 NodeName:   m.nodeID,
                 Hostname:   getHostname(),
+                InternalIP: internalIP(),
+                APIPort:    apiPort,
+                GRPCPort:   grpcPort,
                 Status:     ha.NodeStatusOnline,
                 Role:       "follower",
                 Enabled:    true,
@@ -291,6 +325,11 @@ func (m *HAManager) GetTaskHAManager() *TaskHAManager {
         return m.taskHAManager
 }
 
+// GetAgentRouter 获取 Agent 路由
+func (m *HAManager) GetAgentRouter() *AgentRouter {
+        return m.agentRouter
+}
+
 // ==================== 配置管理 ====================
 
 // UpdateConfig 更新配置
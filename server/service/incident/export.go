@@ -0,0 +1,131 @@
+package incident
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 文档块类型，Markdown 和 PDF 共用同一份文档结构
+const (
+	blockTitle = iota
+	blockHeading
+	blockParagraph
+	blockBullet
+)
+
+type block struct {
+	kind int
+	text string
+}
+
+// document 复盘报告的文档结构
+func (s *Service) document(inc *Incident, pm *Postmortem, timeline []Entry) []block {
+	doc := []block{{blockTitle, "故障复盘：" + inc.Title}}
+
+	meta := []string{
+		fmt.Sprintf("故障编号：#%d", inc.ID),
+		"级别：" + severityText[inc.Severity],
+		"状态：" + statusText[inc.Status],
+		"开始时间：" + inc.StartedAt.Format("2006-01-02 15:04:05"),
+	}
+	if inc.ResolvedAt != nil {
+		meta = append(meta, "恢复时间："+inc.ResolvedAt.Format("2006-01-02 15:04:05"))
+	}
+	meta = append(meta, "持续时间："+formatDuration(inc.Duration(time.Now())))
+	for _, r := range s.Roles(inc) {
+		meta = append(meta, roleText[r.Role]+"："+r.Username)
+	}
+	if names := s.serverNames(inc); len(names) > 0 {
+		meta = append(meta, "涉及服务器："+strings.Join(names, "、"))
+	}
+	for _, m := range meta {
+		doc = append(doc, block{blockBullet, m})
+	}
+
+	sections := []struct{ title, body string }{
+		{"概述", pm.Summary},
+		{"影响", pm.Impact},
+		{"根因分析", pm.RootCause},
+		{"处理过程", pm.ActionsTaken},
+		{"后续改进", pm.FollowUps},
+	}
+	for _, sec := range sections {
+		doc = append(doc, block{blockHeading, sec.title})
+		doc = append(doc, textBlocks(sec.body)...)
+	}
+
+	doc = append(doc, block{blockHeading, "时间线"})
+	for _, e := range timeline {
+		line := fmt.Sprintf("%s [%s] %s", e.At.Format("01-02 15:04:05"), TypeText(e.Kind), e.Title)
+		if e.Actor != "" {
+			line += "（" + e.Actor + "）"
+		}
+		if e.Before {
+			line += "（故障开始前）"
+		}
+		doc = append(doc, block{blockBullet, line})
+	}
+
+	footer := fmt.Sprintf("导出时间：%s", time.Now().Format("2006-01-02 15:04:05"))
+	if pm.EditedBy != "" {
+		footer += "，最后编辑：" + pm.EditedBy
+	}
+	return append(doc, block{blockParagraph, footer})
+}
+
+// textBlocks 把各部分的 Markdown 文本拆成段落和列表项，空内容显示「待补充」
+func textBlocks(body string) []block {
+	var out []block
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "- "), strings.HasPrefix(line, "* "):
+			out = append(out, block{blockBullet, strings.TrimSpace(line[2:])})
+		default:
+			out = append(out, block{blockParagraph, strings.TrimLeft(line, "# ")})
+		}
+	}
+	if len(out) == 0 {
+		out = append(out, block{blockParagraph, "待补充"})
+	}
+	return out
+}
+
+// Markdown 导出复盘报告为 Markdown
+func (s *Service) Markdown(inc *Incident, pm *Postmortem) ([]byte, error) {
+	timeline, err := s.Timeline(inc)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	prev := -1
+	for _, b := range s.document(inc, pm, timeline) {
+		// 列表项连续排列，其余块之间空一行
+		if prev != -1 && !(prev == blockBullet && b.kind == blockBullet) {
+			sb.WriteString("\n")
+		}
+		switch b.kind {
+		case blockTitle:
+			sb.WriteString("# " + b.text + "\n")
+		case blockHeading:
+			sb.WriteString("## " + b.text + "\n")
+		case blockBullet:
+			sb.WriteString("- " + b.text + "\n")
+		default:
+			sb.WriteString(b.text + "\n")
+		}
+		prev = b.kind
+	}
+	return []byte(sb.String()), nil
+}
+
+// PDF 导出复盘报告为 PDF
+func (s *Service) PDF(inc *Incident, pm *Postmortem) ([]byte, error) {
+	timeline, err := s.Timeline(inc)
+	if err != nil {
+		return nil, err
+	}
+	return renderPDF(s.document(inc, pm, timeline)), nil
+}
@@ -0,0 +1,248 @@
+package incident
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"yunwei/service/detector"
+)
+
+// 故障状态。resolved 表示影响已消除，closed 表示处理完毕，关闭后起草复盘报告
+const (
+	StatusInvestigating = "investigating"
+	StatusIdentified    = "identified"
+	StatusMonitoring    = "monitoring"
+	StatusResolved      = "resolved"
+	StatusClosed        = "closed"
+)
+
+var statusText = map[string]string{
+	StatusInvestigating: "调查中",
+	StatusIdentified:    "已定位",
+	StatusMonitoring:    "观察中",
+	StatusResolved:      "已恢复",
+	StatusClosed:        "已关闭",
+}
+
+// 故障级别，sev1 最严重
+const (
+	Sev1 = "sev1" // 核心业务不可用
+	Sev2 = "sev2" // 核心功能受损或大范围性能下降
+	Sev3 = "sev3" // 部分用户或非核心功能受影响
+	Sev4 = "sev4" // 轻微影响
+)
+
+var severityText = map[string]string{
+	Sev1: "SEV1 严重",
+	Sev2: "SEV2 高",
+	Sev3: "SEV3 中",
+	Sev4: "SEV4 低",
+}
+
+// levelSeverity 告警级别对应的故障级别
+var levelSeverity = map[detector.AlertLevel]string{
+	detector.AlertLevelEmergency: Sev1,
+	detector.AlertLevelCritical:  Sev2,
+	detector.AlertLevelWarning:   Sev3,
+	detector.AlertLevelInfo:      Sev4,
+}
+
+// 故障角色。指挥官记在故障上，其余角色记在 incident_roles
+const (
+	RoleCommander      = "commander"      // 指挥官，统筹处理和决策
+	RoleCommunications = "communications" // 对外沟通，更新状态页和通知相关方
+	RoleOperations     = "operations"     // 操作负责人，执行止损和修复
+	RoleScribe         = "scribe"         // 记录员，整理时间线
+)
+
+var roleText = map[string]string{
+	RoleCommander:      "指挥官",
+	RoleCommunications: "沟通负责人",
+	RoleOperations:     "操作负责人",
+	RoleScribe:         "记录员",
+}
+
+// Incident 故障：需要人处理的一次线上问题，可由告警事件自动创建，也可手动创建。
+// 与 detector.Incident 不同，后者只是告警的分组通知单元
+type Incident struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"`
+	Title    string `json:"title" gorm:"type:varchar(255);not null"`
+	Severity string `json:"severity" gorm:"type:varchar(8)"`
+	Status   string `json:"status" gorm:"type:varchar(16);index"`
+	Summary  string `json:"summary" gorm:"type:text"`          // 影响和现状描述
+	Servers  string `json:"servers" gorm:"type:varchar(1024)"` // 涉及的服务器 ID(JSON 数组)
+
+	AlertGroupID uint `json:"alertGroupId" gorm:"index"` // 自动创建时对应的告警事件
+
+	CommanderID uint   `json:"commanderId"`
+	Commander   string `json:"commander" gorm:"type:varchar(64)"`
+
+	StartedAt  time.Time  `json:"startedAt"` // 故障开始时间，自动创建时为首个告警的触发时间
+	ResolvedAt *time.Time `json:"resolvedAt"`
+	ClosedAt   *time.Time `json:"closedAt"`
+
+	CreatedBy uint   `json:"createdBy"`
+	Creator   string `json:"creator" gorm:"type:varchar(64)"` // 自动创建时为空
+}
+
+func (Incident) TableName() string {
+	return "incident_records"
+}
+
+// Open 故障是否仍在处理中
+func (i *Incident) Open() bool {
+	return i.Status != StatusResolved && i.Status != StatusClosed
+}
+
+// ServerIDs 涉及的服务器
+func (i *Incident) ServerIDs() []uint {
+	var ids []uint
+	json.Unmarshal([]byte(i.Servers), &ids)
+	return ids
+}
+
+// AddServers 追加涉及的服务器，返回是否有变化
+func (i *Incident) AddServers(ids ...uint) bool {
+	current := i.ServerIDs()
+	seen := make(map[uint]bool, len(current))
+	for _, id := range current {
+		seen[id] = true
+	}
+	changed := false
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			current = append(current, id)
+			changed = true
+		}
+	}
+	if changed {
+		b, _ := json.Marshal(current)
+		i.Servers = string(b)
+	}
+	return changed
+}
+
+// Duration 故障持续时间，未恢复时算到 now
+func (i *Incident) Duration(now time.Time) time.Duration {
+	end := now
+	if i.ResolvedAt != nil {
+		end = *i.ResolvedAt
+	}
+	if end.Before(i.StartedAt) {
+		return 0
+	}
+	return end.Sub(i.StartedAt)
+}
+
+// Validate 校验故障并补全默认值
+func (i *Incident) Validate() error {
+	i.Title = strings.TrimSpace(i.Title)
+	if i.Title == "" {
+		return errors.New("缺少标题")
+	}
+	if i.Severity == "" {
+		i.Severity = Sev3
+	}
+	if err := ValidateSeverity(i.Severity); err != nil {
+		return err
+	}
+	if i.Status == "" {
+		i.Status = StatusInvestigating
+	}
+	if _, ok := statusText[i.Status]; !ok {
+		return fmt.Errorf("不支持的故障状态 %s", i.Status)
+	}
+	if i.Servers != "" {
+		var ids []uint
+		if err := json.Unmarshal([]byte(i.Servers), &ids); err != nil {
+			return errors.New("servers 应为服务器 ID 数组")
+		}
+	}
+	return nil
+}
+
+// ValidateSeverity 校验故障级别
+func ValidateSeverity(severity string) error {
+	if _, ok := severityText[severity]; !ok {
+		return fmt.Errorf("不支持的故障级别 %s", severity)
+	}
+	return nil
+}
+
+// ValidateRole 校验故障角色
+func ValidateRole(role string) error {
+	if _, ok := roleText[role]; !ok {
+		return fmt.Errorf("不支持的角色 %s", role)
+	}
+	return nil
+}
+
+// 进展类型
+const (
+	UpdateStatus   = "status"   // 状态变化，可附说明
+	UpdateNote     = "note"     // 处理记录
+	UpdateSeverity = "severity" // 级别调整
+	UpdateRole     = "role"     // 角色指派
+	UpdateLink     = "link"     // 关联告警、自愈、决策、命令等
+	UpdateSystem   = "system"   // 系统自动记录，如由告警创建、关联告警全部恢复
+)
+
+// Update 故障的一条进展，和关联记录一起构成故障时间线
+type Update struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	IncidentID uint   `json:"incidentId" gorm:"index"`
+	Kind       string `json:"kind" gorm:"type:varchar(16)"`
+	Status     string `json:"status" gorm:"type:varchar(16)"` // 这条进展之后的故障状态
+	Message    string `json:"message" gorm:"type:text"`
+
+	CreatedBy uint   `json:"createdBy"`
+	Creator   string `json:"creator" gorm:"type:varchar(64)"`
+}
+
+func (Update) TableName() string {
+	return "incident_updates"
+}
+
+// Role 指挥官以外的故障角色，每个角色一人
+type Role struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	IncidentID uint   `json:"incidentId" gorm:"uniqueIndex:idx_incident_role"`
+	Role       string `json:"role" gorm:"type:varchar(16);uniqueIndex:idx_incident_role"`
+	UserID     uint   `json:"userId"`
+	Username   string `json:"username" gorm:"type:varchar(64)"`
+}
+
+func (Role) TableName() string {
+	return "incident_roles"
+}
+
+// Link 故障关联的记录，取自事件流：告警、自愈、AI 决策、命令执行、部署等
+type Link struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	IncidentID uint      `json:"incidentId" gorm:"index"`
+	Kind       string    `json:"kind" gorm:"type:varchar(32)"` // 事件类型，如 alert, heal, ai_decision, command
+	SourceID   uint      `json:"sourceId"`                     // 对应记录的 ID，如告警 ID
+	Title      string    `json:"title" gorm:"type:varchar(255)"`
+	OccurredAt time.Time `json:"occurredAt"`
+
+	LinkedBy string `json:"linkedBy" gorm:"type:varchar(64)"` // 手动关联的用户，自动关联时为空
+}
+
+func (Link) TableName() string {
+	return "incident_links"
+}
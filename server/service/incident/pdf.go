@@ -0,0 +1,176 @@
+package incident
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDF 页面尺寸(A4)和边距，单位为点
+const (
+	pageWidth   = 595.28
+	pageHeight  = 841.89
+	pageMargin  = 56.0
+	bulletShift = 14.0
+)
+
+// pdfStyle 各类文档块的字号、行距和段前间距
+var pdfStyle = map[int]struct{ size, leading, before float64 }{
+	blockTitle:     {18, 28, 0},
+	blockHeading:   {14, 22, 12},
+	blockParagraph: {10.5, 16, 4},
+	blockBullet:    {10.5, 16, 2},
+}
+
+// pdfLine 排版后的一行
+type pdfLine struct {
+	x, y, size float64
+	text       string
+}
+
+// renderPDF 把文档排版为 PDF。使用 PDF 阅读器内置的 Adobe 中文字体 STSong-Light，不嵌入字体文件，
+// 文本按 UCS-2 编码，基本多文种平面以外的字符显示为问号
+func renderPDF(doc []block) []byte {
+	var pages [][]pdfLine
+	var page []pdfLine
+	y := pageHeight - pageMargin
+
+	for _, b := range doc {
+		st := pdfStyle[b.kind]
+		x, width := pageMargin, pageWidth-2*pageMargin
+		text := b.text
+		if b.kind == blockBullet {
+			x, width = pageMargin+bulletShift, width-bulletShift
+		}
+		y -= st.before
+		for i, line := range wrapText(text, width, st.size) {
+			if y-st.leading < pageMargin {
+				pages = append(pages, page)
+				page, y = nil, pageHeight-pageMargin
+			}
+			y -= st.leading
+			if i == 0 && b.kind == blockBullet {
+				page = append(page, pdfLine{x: pageMargin + 2, y: y, size: st.size, text: "·"})
+			}
+			page = append(page, pdfLine{x: x, y: y, size: st.size, text: line})
+		}
+	}
+	pages = append(pages, page)
+	return writePDF(pages)
+}
+
+// runeWidth 字符宽度(以字号为单位)：ASCII 为半角，其余按全角
+func runeWidth(r rune) float64 {
+	if r < 0x80 {
+		return 0.5
+	}
+	return 1
+}
+
+// wrapText 按可用宽度折行，英文单词尽量不拆开
+func wrapText(text string, width, size float64) []string {
+	var lines []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		w, end, lastSpace := 0.0, 0, -1
+		for end < len(runes) {
+			w += runeWidth(runes[end]) * size
+			if w > width {
+				break
+			}
+			if runes[end] == ' ' {
+				lastSpace = end
+			}
+			end++
+		}
+		if end == len(runes) {
+			lines = append(lines, string(runes))
+			break
+		}
+		if end == 0 {
+			end = 1
+		}
+		cut := end
+		if lastSpace > 0 && runes[end] < 0x80 && runes[end] != ' ' && runes[end-1] < 0x80 {
+			cut = lastSpace + 1
+		}
+		lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+		runes = runes[cut:]
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// pdfHex 把文本编码为 UCS-2 大端序的十六进制字符串
+func pdfHex(text string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('<')
+	for _, r := range text {
+		if r > 0xFFFF || utf16.IsSurrogate(r) {
+			r = '?'
+		}
+		fmt.Fprintf(&buf, "%04X", r)
+	}
+	buf.WriteByte('>')
+	return buf.String()
+}
+
+// writePDF 输出 PDF 文件：目录、页树、字体以及每页的页面和内容流
+func writePDF(pages [][]pdfLine) []byte {
+	const fontObjects = 5 // 1 目录，2 页树，3-5 字体
+	var buf bytes.Buffer
+	var offsets []int
+	begin := func() {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n", len(offsets))
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	begin()
+	buf.WriteString("<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+
+	begin()
+	buf.WriteString("<< /Type /Pages /Kids [")
+	for i := range pages {
+		fmt.Fprintf(&buf, " %d 0 R", fontObjects+1+2*i)
+	}
+	fmt.Fprintf(&buf, " ] /Count %d >>\nendobj\n", len(pages))
+
+	begin()
+	buf.WriteString("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>\nendobj\n")
+	begin()
+	buf.WriteString("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> " +
+		"/FontDescriptor 5 0 R /DW 1000 /W [1 95 500 814 907 500] >>\nendobj\n")
+	begin()
+	buf.WriteString("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>\nendobj\n")
+
+	for i, lines := range pages {
+		var content bytes.Buffer
+		for _, l := range lines {
+			fmt.Fprintf(&content, "BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n", l.size, l.x, l.y, pdfHex(l.text))
+		}
+
+		begin()
+		fmt.Fprintf(&buf, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			pageWidth, pageHeight, fontObjects+2+2*i)
+		begin()
+		fmt.Fprintf(&buf, "<< /Length %d >>\nstream\n", content.Len())
+		buf.Write(content.Bytes())
+		buf.WriteString("endstream\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
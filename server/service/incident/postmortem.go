@@ -0,0 +1,354 @@
+package incident
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"yunwei/global"
+	"yunwei/model/server"
+	"yunwei/service/ai/llm"
+	"yunwei/service/event"
+)
+
+// 复盘报告状态
+const (
+	PostmortemGenerating = "generating"
+	PostmortemDraft      = "draft"
+	PostmortemFailed     = "failed" // 模型起草失败，保留基于时间线的草稿，可重新生成
+)
+
+const (
+	// generateTimeout 起草超过该时长仍未完成时允许重新生成
+	generateTimeout = 10 * time.Minute
+	// promptTimelineEntries 提示词中最多包含的时间线记录数，超出时保留最早和最近的
+	promptTimelineEntries = 150
+	// promptDetailRunes 提示词中每条记录详情保留的字符数
+	promptDetailRunes = 200
+)
+
+// Postmortem 故障复盘报告。关闭故障时由 AI 根据时间线起草，之后可人工编辑，各部分为 Markdown 文本
+type Postmortem struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	IncidentID uint   `json:"incidentId" gorm:"uniqueIndex"`
+	Status     string `json:"status" gorm:"type:varchar(16)"`
+	Error      string `json:"error" gorm:"type:varchar(512)"`
+
+	Summary      string `json:"summary" gorm:"type:text"`      // 概述
+	Impact       string `json:"impact" gorm:"type:text"`       // 影响范围和程度
+	RootCause    string `json:"rootCause" gorm:"type:text"`    // 根因假设
+	ActionsTaken string `json:"actionsTaken" gorm:"type:text"` // 处理过程
+	FollowUps    string `json:"followUps" gorm:"type:text"`    // 后续改进项
+
+	GeneratedAt *time.Time `json:"generatedAt"`
+	EditedBy    string     `json:"editedBy" gorm:"type:varchar(64)"`
+	EditedAt    *time.Time `json:"editedAt"`
+}
+
+func (Postmortem) TableName() string {
+	return "incident_postmortems"
+}
+
+// GetPostmortem 故障的复盘报告，尚未起草时返回 nil
+func (s *Service) GetPostmortem(inc *Incident) *Postmortem {
+	var pm Postmortem
+	if err := s.db.Where("incident_id = ?", inc.ID).First(&pm).Error; err != nil {
+		return nil
+	}
+	return &pm
+}
+
+// SavePostmortem 保存人工编辑的复盘报告
+func (s *Service) SavePostmortem(inc *Incident, edit *Postmortem, username string) (*Postmortem, error) {
+	pm := s.GetPostmortem(inc)
+	if pm == nil {
+		pm = &Postmortem{IncidentID: inc.ID}
+	}
+	if pm.Status == PostmortemGenerating && time.Since(pm.UpdatedAt) < generateTimeout {
+		return nil, errors.New("复盘报告正在起草中，请稍后再编辑")
+	}
+	now := time.Now()
+	pm.Status = PostmortemDraft
+	pm.Error = ""
+	pm.Summary, pm.Impact, pm.RootCause = edit.Summary, edit.Impact, edit.RootCause
+	pm.ActionsTaken, pm.FollowUps = edit.ActionsTaken, edit.FollowUps
+	pm.EditedBy, pm.EditedAt = username, &now
+	return pm, s.db.Save(pm).Error
+}
+
+// DraftPostmortem 在后台起草复盘报告。force 为 false 时已有报告的故障不再起草（如重新关闭），
+// 为 true 时覆盖已有内容
+func (s *Service) DraftPostmortem(inc *Incident, force bool) (*Postmortem, error) {
+	pm := s.GetPostmortem(inc)
+	switch {
+	case pm == nil:
+		pm = &Postmortem{IncidentID: inc.ID}
+	case pm.Status == PostmortemGenerating && time.Since(pm.UpdatedAt) < generateTimeout:
+		return nil, errors.New("复盘报告正在起草中")
+	case !force:
+		return pm, nil
+	}
+	pm.Status, pm.Error = PostmortemGenerating, ""
+	if err := s.db.Save(pm).Error; err != nil {
+		return nil, err
+	}
+	// 重新读取库中的 updated_at，起草结束时用它确认报告未被编辑或重新起草
+	if err := s.db.First(pm, pm.ID).Error; err != nil {
+		return nil, err
+	}
+
+	incCopy, pmCopy := *inc, *pm
+	go s.generate(&incCopy, &pmCopy)
+	return pm, nil
+}
+
+// generate 起草复盘报告：先用时间线生成基础草稿，再由模型补全；模型不可用或失败时保留基础草稿
+func (s *Service) generate(inc *Incident, pm *Postmortem) {
+	timeline, err := s.Timeline(inc)
+	if err != nil {
+		s.finish(pm, fmt.Errorf("读取时间线失败: %w", err))
+		return
+	}
+	s.baseDraft(inc, pm, timeline)
+
+	s.mu.Lock()
+	client := s.llm
+	s.mu.Unlock()
+	if client == nil {
+		client = llm.For(llm.FeatureIncident, inc.TenantID)
+	}
+	if client == nil {
+		s.finish(pm, errors.New("未配置 AI，已根据时间线生成草稿"))
+		return
+	}
+
+	resp, err := client.QuickChat(s.buildPrompt(inc, timeline))
+	if err != nil {
+		s.finish(pm, fmt.Errorf("AI 起草失败: %w", err))
+		return
+	}
+	s.finish(pm, applyDraft(pm, resp))
+}
+
+// finish 保存起草结果，err 不为空时标记为失败并记录原因。
+// 起草超时后报告可能已被人工编辑或重新起草，只有仍是本次起草的记录才会被更新
+func (s *Service) finish(pm *Postmortem, err error) {
+	now := time.Now()
+	pm.Status, pm.Error, pm.GeneratedAt = PostmortemDraft, "", &now
+	if err != nil {
+		pm.Status, pm.Error = PostmortemFailed, truncateRunes(err.Error(), 500)
+		global.Logger.Warn(fmt.Sprintf("故障 %d 复盘报告: %v", pm.IncidentID, err))
+	}
+	res := s.db.Model(&Postmortem{}).
+		Where("id = ? AND status = ? AND updated_at = ?", pm.ID, PostmortemGenerating, pm.UpdatedAt).
+		Updates(map[string]interface{}{
+			"status":        pm.Status,
+			"error":         pm.Error,
+			"generated_at":  now,
+			"summary":       pm.Summary,
+			"impact":        pm.Impact,
+			"root_cause":    pm.RootCause,
+			"actions_taken": pm.ActionsTaken,
+			"follow_ups":    pm.FollowUps,
+		})
+	if res.Error == nil && res.RowsAffected == 0 {
+		global.Logger.Warn(fmt.Sprintf("故障 %d 复盘报告已被编辑或重新起草，丢弃本次起草结果", pm.IncidentID))
+	}
+}
+
+// baseDraft 不依赖模型的草稿：概述取故障描述，处理过程取时间线中的人工进展和处理动作
+func (s *Service) baseDraft(inc *Incident, pm *Postmortem, timeline []Entry) {
+	pm.Summary = inc.Summary
+	if pm.Summary == "" {
+		pm.Summary = inc.Title
+	}
+	pm.Impact = fmt.Sprintf("持续 %s，级别 %s", formatDuration(inc.Duration(time.Now())), severityText[inc.Severity])
+	if names := s.serverNames(inc); len(names) > 0 {
+		pm.Impact += "，涉及服务器: " + strings.Join(names, "、")
+	}
+
+	var actions []string
+	for _, e := range timeline {
+		if e.Before || !isAction(e) {
+			continue
+		}
+		line := fmt.Sprintf("- %s %s", e.At.Format("01-02 15:04"), e.Title)
+		if e.Actor != "" {
+			line += "（" + e.Actor + "）"
+		}
+		actions = append(actions, line)
+	}
+	pm.ActionsTaken = strings.Join(actions, "\n")
+	pm.RootCause, pm.FollowUps = "", ""
+}
+
+// isAction 时间线记录是否属于处理动作
+func isAction(e Entry) bool {
+	switch e.Kind {
+	case UpdateStatus, UpdateNote, UpdateSeverity, UpdateRole:
+		return true
+	}
+	return e.Linked && e.Kind != event.TypeAlert
+}
+
+// serverNames 涉及的服务器名称
+func (s *Service) serverNames(inc *Incident) []string {
+	ids := inc.ServerIDs()
+	if len(ids) == 0 {
+		return nil
+	}
+	var names []string
+	s.db.Model(&server.Server{}).Where("id IN ?", ids).Order("id").Pluck("name", &names)
+	return names
+}
+
+// buildPrompt 构建起草复盘报告的提示词
+func (s *Service) buildPrompt(inc *Incident, timeline []Entry) string {
+	var sb strings.Builder
+	sb.WriteString("你是一名资深 SRE，请根据下面的故障信息和时间线起草一份无责复盘报告。")
+	sb.WriteString("只依据给出的记录推断，不确定的根因写成假设并说明依据，不要编造记录中没有的操作。\n\n")
+
+	sb.WriteString("## 故障信息\n")
+	sb.WriteString(fmt.Sprintf("- 标题: %s\n", inc.Title))
+	sb.WriteString(fmt.Sprintf("- 级别: %s\n", severityText[inc.Severity]))
+	sb.WriteString(fmt.Sprintf("- 开始时间: %s\n", inc.StartedAt.Format("2006-01-02 15:04:05")))
+	if inc.ResolvedAt != nil {
+		sb.WriteString(fmt.Sprintf("- 恢复时间: %s\n", inc.ResolvedAt.Format("2006-01-02 15:04:05")))
+	}
+	sb.WriteString(fmt.Sprintf("- 持续时间: %s\n", formatDuration(inc.Duration(time.Now()))))
+	if names := s.serverNames(inc); len(names) > 0 {
+		sb.WriteString(fmt.Sprintf("- 涉及服务器: %s\n", strings.Join(names, "、")))
+	}
+	if inc.Summary != "" {
+		sb.WriteString(fmt.Sprintf("- 描述: %s\n", inc.Summary))
+	}
+	for _, r := range s.Roles(inc) {
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", roleText[r.Role], r.Username))
+	}
+
+	sb.WriteString("\n## 时间线（标注「开始前」的是故障开始前的变更，标注「已关联」的是处理人确认相关的记录）\n")
+	entries := timeline
+	if len(entries) > promptTimelineEntries {
+		head := promptTimelineEntries / 3
+		entries = append(append([]Entry{}, timeline[:head]...), timeline[len(timeline)-(promptTimelineEntries-head):]...)
+	}
+	for i, e := range entries {
+		if len(entries) < len(timeline) && i == promptTimelineEntries/3 {
+			sb.WriteString(fmt.Sprintf("- ……省略 %d 条……\n", len(timeline)-len(entries)))
+		}
+		sb.WriteString(fmt.Sprintf("- %s [%s]", e.At.Format("01-02 15:04:05"), TypeText(e.Kind)))
+		if e.Before {
+			sb.WriteString("[开始前]")
+		}
+		if e.Linked {
+			sb.WriteString("[已关联]")
+		}
+		sb.WriteString(" " + e.Title)
+		if e.Actor != "" {
+			sb.WriteString("（" + e.Actor + "）")
+		}
+		if d := strings.TrimSpace(e.Detail); d != "" {
+			sb.WriteString("：" + truncateRunes(strings.ReplaceAll(d, "\n", " "), promptDetailRunes))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n## 请按以下 JSON 格式回复，各字段使用中文\n")
+	sb.WriteString("```json\n")
+	sb.WriteString(`{
+  "summary": "两三句话概述发生了什么、如何恢复",
+  "impact": "影响的服务、用户和持续时间",
+  "rootCauses": ["根因假设及依据，按可能性从高到低"],
+  "actionsTaken": ["按时间顺序的关键处理动作"],
+  "followUps": [{"title": "改进项", "owner": "建议负责角色", "priority": "P0/P1/P2"}]
+}` + "\n")
+	sb.WriteString("```\n")
+	return sb.String()
+}
+
+// applyDraft 把模型回复填入报告，无法解析时保留基础草稿并返回错误
+func applyDraft(pm *Postmortem, response string) error {
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start == -1 || end <= start {
+		return errors.New("AI 回复中没有 JSON，已根据时间线生成草稿")
+	}
+	var result struct {
+		Summary      string   `json:"summary"`
+		Impact       string   `json:"impact"`
+		RootCauses   []string `json:"rootCauses"`
+		ActionsTaken []string `json:"actionsTaken"`
+		FollowUps    []struct {
+			Title    string `json:"title"`
+			Owner    string `json:"owner"`
+			Priority string `json:"priority"`
+		} `json:"followUps"`
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &result); err != nil {
+		return fmt.Errorf("解析 AI 回复失败: %w，已根据时间线生成草稿", err)
+	}
+
+	if result.Summary != "" {
+		pm.Summary = result.Summary
+	}
+	if result.Impact != "" {
+		pm.Impact = result.Impact
+	}
+	var lines []string
+	for i, c := range result.RootCauses {
+		lines = append(lines, fmt.Sprintf("%d. %s", i+1, c))
+	}
+	pm.RootCause = strings.Join(lines, "\n")
+	if len(result.ActionsTaken) > 0 {
+		lines = lines[:0]
+		for _, a := range result.ActionsTaken {
+			lines = append(lines, "- "+a)
+		}
+		pm.ActionsTaken = strings.Join(lines, "\n")
+	}
+	lines = lines[:0]
+	for _, f := range result.FollowUps {
+		line := "- [ ] " + f.Title
+		var meta []string
+		if f.Owner != "" {
+			meta = append(meta, "负责: "+f.Owner)
+		}
+		if f.Priority != "" {
+			meta = append(meta, "优先级: "+f.Priority)
+		}
+		if len(meta) > 0 {
+			line += "（" + strings.Join(meta, "，") + "）"
+		}
+		lines = append(lines, line)
+	}
+	pm.FollowUps = strings.Join(lines, "\n")
+	return nil
+}
+
+// formatDuration 按天、小时、分钟显示时长
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	days, hours, minutes := int(d/(24*time.Hour)), int(d%(24*time.Hour)/time.Hour), int(d%time.Hour/time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d 天 %d 小时 %d 分钟", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%d 小时 %d 分钟", hours, minutes)
+	}
+	return fmt.Sprintf("%d 分钟", minutes)
+}
+
+// truncateRunes 按字符截断
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
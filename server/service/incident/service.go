@@ -0,0 +1,630 @@
+package incident
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/service/ai/llm"
+	"yunwei/service/detector"
+	"yunwei/service/event"
+	"yunwei/service/metrics/query"
+	"yunwei/service/oncall"
+
+	"gorm.io/gorm"
+)
+
+// autoLinkTypes 关闭故障时自动关联的事件类型：涉及服务器在故障期间的处理动作
+var autoLinkTypes = []string{event.TypeHeal, event.TypeAIDecision, event.TypeCommand}
+
+// Service 故障管理
+type Service struct {
+	db            *gorm.DB
+	autoOpenLevel detector.AlertLevel // 为空时不自动创建
+	contacts      *oncall.Service
+
+	mu   sync.Mutex // 串行化由告警创建故障，避免同一告警事件建出两个故障
+	next detector.AlertNotifier
+	llm  llm.Provider
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局故障管理
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB, config.CONFIG.Incidents)
+	})
+	return globalService
+}
+
+// NewService 创建故障管理
+func NewService(db *gorm.DB, cfg config.Incidents) *Service {
+	s := &Service{
+		db:            db,
+		autoOpenLevel: detector.AlertLevel(cfg.AutoOpenLevel),
+		contacts:      oncall.NewService(db),
+	}
+	switch cfg.AutoOpenLevel {
+	case "":
+		s.autoOpenLevel = detector.AlertLevelCritical
+	case "none":
+		s.autoOpenLevel = ""
+	}
+	return s
+}
+
+// SetNext 设置告警事件通知的下一环，故障管理处理完后继续交给它通知
+func (s *Service) SetNext(n detector.AlertNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next = n
+}
+
+// SetLLMClient 指定起草复盘报告的模型，未指定时按故障所属租户选择
+func (s *Service) SetLLMClient(client llm.Provider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.llm = client
+}
+
+// NotifyIncident 实现 detector.AlertNotifier：达到级别的告警事件自动创建故障并关联告警，
+// 确认和恢复记入故障进展。故障处理失败只记日志，不影响告警通知
+func (s *Service) NotifyIncident(ev detector.AlertEvent, group *detector.Incident, alerts []detector.Alert) error {
+	if err := s.onAlertEvent(ev, group, alerts); err != nil {
+		global.Logger.Warn(fmt.Sprintf("告警事件 %d 同步到故障失败: %v", group.ID, err))
+	}
+	s.mu.Lock()
+	next := s.next
+	s.mu.Unlock()
+	if next == nil {
+		return nil
+	}
+	return next.NotifyIncident(ev, group, alerts)
+}
+
+// onAlertEvent 按告警事件创建或更新故障
+func (s *Service) onAlertEvent(ev detector.AlertEvent, group *detector.Incident, alerts []detector.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 一个告警事件只创建一次故障，人工标记恢复后告警仍在重复提醒时不再新建
+	var inc Incident
+	err := s.db.Where("alert_group_id = ?", group.ID).Order("id DESC").First(&inc).Error
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if found && !inc.Open() {
+		return nil
+	}
+
+	switch ev {
+	case detector.AlertEventFiring, detector.AlertEventRepeat:
+		if !found {
+			if !s.shouldOpen(group.Level) {
+				return nil
+			}
+			inc = Incident{
+				TenantID:     group.TenantID,
+				Title:        group.Title,
+				Severity:     levelSeverity[group.Level],
+				Status:       StatusInvestigating,
+				AlertGroupID: group.ID,
+				StartedAt:    group.FiredAt,
+			}
+			msg := fmt.Sprintf("由告警事件 #%d 自动创建", group.ID)
+			if err := s.create(&inc, UpdateSystem, msg, 0, ""); err != nil {
+				return err
+			}
+		}
+		return s.linkAlerts(&inc, alerts)
+
+	case detector.AlertEventAcknowledged:
+		if !found {
+			return nil
+		}
+		// 确认告警的人默认担任指挥官
+		if inc.CommanderID == 0 && group.AcknowledgedBy > 0 {
+			if err := s.assignCommander(&inc, group.AcknowledgedBy, 0, ""); err != nil {
+				return err
+			}
+		}
+		return s.addUpdate(&inc, UpdateSystem, "关联的告警已被确认", 0, "")
+
+	case detector.AlertEventResolved:
+		if !found {
+			return nil
+		}
+		return s.addUpdate(&inc, UpdateSystem, "关联的告警已全部恢复，确认影响消除后请将故障标记为已恢复", 0, "")
+	}
+	return nil
+}
+
+// shouldOpen 告警级别是否达到自动创建故障的级别
+func (s *Service) shouldOpen(level detector.AlertLevel) bool {
+	if s.autoOpenLevel == "" {
+		return false
+	}
+	sev, ok := levelSeverity[level]
+	return ok && sev <= levelSeverity[s.autoOpenLevel]
+}
+
+// Filter 故障列表的查询条件
+type Filter struct {
+	TenantID string
+	Status   string // open 表示未恢复的故障
+	Severity string
+	ServerID uint
+	Page     int
+	PageSize int
+}
+
+// List 按条件分页查询故障，最近开始的在前
+func (s *Service) List(f Filter) ([]Incident, int64, error) {
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	if f.PageSize <= 0 || f.PageSize > 100 {
+		f.PageSize = 20
+	}
+	db := s.db.Model(&Incident{})
+	if f.TenantID != "" {
+		db = db.Where("tenant_id = ?", f.TenantID)
+	}
+	switch f.Status {
+	case "":
+	case "open":
+		db = db.Where("status NOT IN ?", []string{StatusResolved, StatusClosed})
+	default:
+		db = db.Where("status = ?", f.Status)
+	}
+	if f.Severity != "" {
+		db = db.Where("severity = ?", f.Severity)
+	}
+	if f.ServerID > 0 {
+		// servers 为 JSON 数组，如 [1,12,3]
+		id := fmt.Sprint(f.ServerID)
+		db = db.Where("servers = ? OR servers LIKE ? OR servers LIKE ? OR servers LIKE ?",
+			"["+id+"]", "["+id+",%", "%,"+id+",%", "%,"+id+"]")
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var list []Incident
+	err := db.Order("started_at DESC, id DESC").Offset((f.Page - 1) * f.PageSize).Limit(f.PageSize).Find(&list).Error
+	return list, total, err
+}
+
+// Create 手动创建故障，message 作为第一条进展；未指定指挥官时由创建人担任
+func (s *Service) Create(inc *Incident, message string, userID uint, username string) error {
+	inc.ID, inc.AlertGroupID, inc.ResolvedAt, inc.ClosedAt = 0, 0, nil, nil
+	if err := inc.Validate(); err != nil {
+		return err
+	}
+	if !inc.Open() {
+		return errors.New("新建故障的状态不能是已恢复或已关闭")
+	}
+	if inc.StartedAt.IsZero() {
+		inc.StartedAt = time.Now()
+	}
+	if inc.CommanderID == 0 {
+		inc.CommanderID = userID
+	}
+	if c := s.contacts.Contact(inc.CommanderID); c != nil {
+		inc.Commander = c.Name
+	} else if inc.CommanderID == userID {
+		inc.Commander = username
+	} else {
+		return errors.New("指挥官不存在或已禁用")
+	}
+	inc.CreatedBy, inc.Creator = userID, username
+	return s.create(inc, UpdateStatus, message, userID, username)
+}
+
+// create 写入故障和第一条进展
+func (s *Service) create(inc *Incident, kind, message string, userID uint, username string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(inc).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Update{
+			IncidentID: inc.ID,
+			Kind:       kind,
+			Status:     inc.Status,
+			Message:    message,
+			CreatedBy:  userID,
+			Creator:    username,
+		}).Error
+	})
+}
+
+// addUpdate 记录一条不改变状态的进展
+func (s *Service) addUpdate(inc *Incident, kind, message string, userID uint, username string) error {
+	return s.db.Create(&Update{
+		IncidentID: inc.ID,
+		Kind:       kind,
+		Status:     inc.Status,
+		Message:    message,
+		CreatedBy:  userID,
+		Creator:    username,
+	}).Error
+}
+
+// AddNote 记录处理过程
+func (s *Service) AddNote(inc *Incident, message string, userID uint, username string) (*Update, error) {
+	if inc.Status == StatusClosed {
+		return nil, errors.New("故障已关闭")
+	}
+	u := &Update{IncidentID: inc.ID, Kind: UpdateNote, Status: inc.Status, Message: message, CreatedBy: userID, Creator: username}
+	return u, s.db.Create(u).Error
+}
+
+// PostStatus 更新故障状态。resolved 记录恢复时间；closed 后不能再修改，
+// 关闭时自动关联故障期间的自愈、决策和命令，并起草复盘报告
+func (s *Service) PostStatus(inc *Incident, status, message string, userID uint, username string) (*Update, error) {
+	if _, ok := statusText[status]; !ok {
+		return nil, fmt.Errorf("不支持的故障状态 %s", status)
+	}
+	if inc.Status == StatusClosed {
+		return nil, errors.New("故障已关闭")
+	}
+	if status == inc.Status {
+		return nil, fmt.Errorf("故障已是%s状态", statusText[status])
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": status}
+	switch status {
+	case StatusResolved:
+		updates["resolved_at"] = now
+	case StatusClosed:
+		if inc.ResolvedAt == nil {
+			updates["resolved_at"] = now
+		}
+		updates["closed_at"] = now
+	default:
+		// 恢复后再次出现问题，重新开始处理
+		updates["resolved_at"] = nil
+	}
+
+	u := &Update{IncidentID: inc.ID, Kind: UpdateStatus, Status: status, Message: message, CreatedBy: userID, Creator: username}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		return tx.Model(inc).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.First(inc, inc.ID).Error; err != nil {
+		return nil, err
+	}
+
+	if status == StatusClosed {
+		if err := s.autoLink(inc); err != nil {
+			global.Logger.Warn(fmt.Sprintf("故障 %d 自动关联处理记录失败: %v", inc.ID, err))
+		}
+		s.DraftPostmortem(inc, false)
+	}
+	return u, nil
+}
+
+// SetSeverity 调整故障级别
+func (s *Service) SetSeverity(inc *Incident, severity string, userID uint, username string) error {
+	if err := ValidateSeverity(severity); err != nil {
+		return err
+	}
+	if severity == inc.Severity {
+		return nil
+	}
+	msg := fmt.Sprintf("级别由 %s 调整为 %s", severityText[inc.Severity], severityText[severity])
+	inc.Severity = severity
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(inc).Update("severity", severity).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Update{IncidentID: inc.ID, Kind: UpdateSeverity, Status: inc.Status, Message: msg, CreatedBy: userID, Creator: username}).Error
+	})
+}
+
+// AssignRole 指派故障角色，userID 为 0 时取消该角色
+func (s *Service) AssignRole(inc *Incident, role string, assignee, userID uint, username string) error {
+	if err := ValidateRole(role); err != nil {
+		return err
+	}
+	if role == RoleCommander {
+		return s.assignCommander(inc, assignee, userID, username)
+	}
+
+	if assignee == 0 {
+		return s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("incident_id = ? AND role = ?", inc.ID, role).Delete(&Role{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&Update{IncidentID: inc.ID, Kind: UpdateRole, Status: inc.Status,
+				Message: "取消" + roleText[role], CreatedBy: userID, Creator: username}).Error
+		})
+	}
+	c := s.contacts.Contact(assignee)
+	if c == nil {
+		return errors.New("用户不存在或已禁用")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var r Role
+		err := tx.Where("incident_id = ? AND role = ?", inc.ID, role).First(&r).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		r.IncidentID, r.Role, r.UserID, r.Username = inc.ID, role, c.UserID, c.Name
+		if err := tx.Save(&r).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Update{IncidentID: inc.ID, Kind: UpdateRole, Status: inc.Status,
+			Message: fmt.Sprintf("%s由 %s 担任", roleText[role], c.Name), CreatedBy: userID, Creator: username}).Error
+	})
+}
+
+// assignCommander 指派指挥官，userID 为操作人，系统指派时为 0
+func (s *Service) assignCommander(inc *Incident, assignee, userID uint, username string) error {
+	if assignee == 0 {
+		return errors.New("故障必须有指挥官")
+	}
+	c := s.contacts.Contact(assignee)
+	if c == nil {
+		return errors.New("用户不存在或已禁用")
+	}
+	inc.CommanderID, inc.Commander = c.UserID, c.Name
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(inc).Updates(map[string]interface{}{"commander_id": c.UserID, "commander": c.Name}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Update{IncidentID: inc.ID, Kind: UpdateRole, Status: inc.Status,
+			Message: "指挥官由 " + c.Name + " 担任", CreatedBy: userID, Creator: username}).Error
+	})
+}
+
+// Roles 故障的角色，指挥官排在最前
+func (s *Service) Roles(inc *Incident) []Role {
+	var roles []Role
+	if inc.CommanderID > 0 {
+		roles = append(roles, Role{IncidentID: inc.ID, Role: RoleCommander, UserID: inc.CommanderID, Username: inc.Commander})
+	}
+	var others []Role
+	s.db.Where("incident_id = ?", inc.ID).Order("id").Find(&others)
+	return append(roles, others...)
+}
+
+// linkAlerts 关联告警并记录涉及的服务器，已关联的跳过
+func (s *Service) linkAlerts(inc *Incident, alerts []detector.Alert) error {
+	var linked []uint
+	s.db.Model(&Link{}).Where("incident_id = ? AND kind = ?", inc.ID, event.TypeAlert).Pluck("source_id", &linked)
+	seen := make(map[uint]bool, len(linked))
+	for _, id := range linked {
+		seen[id] = true
+	}
+
+	var servers []uint
+	for i := range alerts {
+		a := &alerts[i]
+		if seen[a.ID] {
+			continue
+		}
+		at := a.CreatedAt
+		if a.FiredAt != nil {
+			at = *a.FiredAt
+		}
+		if err := s.db.Create(&Link{IncidentID: inc.ID, Kind: event.TypeAlert, SourceID: a.ID, Title: a.Title, OccurredAt: at}).Error; err != nil {
+			return err
+		}
+		servers = append(servers, a.ServerID)
+		if inc.TenantID == "" {
+			inc.TenantID = a.MatchLabels()[query.LabelTenant]
+		}
+	}
+	if inc.AddServers(servers...) {
+		return s.db.Model(inc).Updates(map[string]interface{}{"servers": inc.Servers, "tenant_id": inc.TenantID}).Error
+	}
+	return nil
+}
+
+// LinkEvent 手动关联事件流中的记录，同一来源记录只关联一次
+func (s *Service) LinkEvent(inc *Incident, ev *event.Event, username string) (*Link, error) {
+	var count int64
+	s.db.Model(&Link{}).Where("incident_id = ? AND kind = ? AND source_id = ?", inc.ID, ev.Type, ev.SourceID).Count(&count)
+	if count > 0 {
+		return nil, errors.New("该记录已关联")
+	}
+	l := &Link{IncidentID: inc.ID, Kind: ev.Type, SourceID: ev.SourceID, Title: ev.Title, OccurredAt: ev.OccurredAt, LinkedBy: username}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(l).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Update{IncidentID: inc.ID, Kind: UpdateLink, Status: inc.Status,
+			Message: fmt.Sprintf("关联%s: %s", ev.TypeText(), ev.Title), Creator: username}).Error
+	})
+	return l, err
+}
+
+// FindEvent 按类型和来源记录 ID 查找事件流中的记录
+func (s *Service) FindEvent(kind string, sourceID uint) (*event.Event, error) {
+	var ev event.Event
+	if err := s.db.Where("type = ? AND source_id = ?", kind, sourceID).Order("id").First(&ev).Error; err != nil {
+		return nil, err
+	}
+	return &ev, nil
+}
+
+// Links 故障关联的记录，按发生时间排序
+func (s *Service) Links(inc *Incident) []Link {
+	var links []Link
+	s.db.Where("incident_id = ?", inc.ID).Order("occurred_at, id").Find(&links)
+	return links
+}
+
+// autoLink 关联涉及的服务器在故障期间的自愈、AI 决策和命令执行
+func (s *Service) autoLink(inc *Incident) error {
+	end := time.Now()
+	if inc.ResolvedAt != nil {
+		end = *inc.ResolvedAt
+	}
+	seen := make(map[string]bool)
+	for _, l := range s.Links(inc) {
+		seen[fmt.Sprintf("%s/%d", l.Kind, l.SourceID)] = true
+	}
+	for _, serverID := range inc.ServerIDs() {
+		events, _, err := event.GetService().Timeline(event.Filter{
+			ServerID: serverID,
+			Types:    autoLinkTypes,
+			Start:    inc.StartedAt,
+			End:      end,
+			PageSize: 500,
+		})
+		if err != nil {
+			return err
+		}
+		for i := len(events) - 1; i >= 0; i-- {
+			ev := &events[i]
+			key := fmt.Sprintf("%s/%d", ev.Type, ev.SourceID)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if err := s.db.Create(&Link{IncidentID: inc.ID, Kind: ev.Type, SourceID: ev.SourceID, Title: ev.Title, OccurredAt: ev.OccurredAt}).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Entry 故障时间线上的一条记录
+type Entry struct {
+	At     time.Time `json:"at"`
+	Kind   string    `json:"kind"`   // 进展类型或事件类型
+	Action string    `json:"action"` // 事件动作，进展为空
+	Title  string    `json:"title"`
+	Detail string    `json:"detail"`
+	Actor  string    `json:"actor"`
+	Before bool      `json:"before"` // 发生在故障开始之前，如此前的部署和配置变更
+	Linked bool      `json:"linked"` // 是已关联的记录
+}
+
+// Timeline 故障时间线：故障进展、已关联记录在事件流中的事件，以及涉及的服务器从故障开始前的变更窗口到恢复期间的事件
+func (s *Service) Timeline(inc *Incident) ([]Entry, error) {
+	var updates []Update
+	if err := s.db.Where("incident_id = ?", inc.ID).Order("id").Find(&updates).Error; err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(updates))
+	for _, u := range updates {
+		title := u.Message
+		if u.Kind == UpdateStatus {
+			title = "状态变为" + statusText[u.Status]
+		}
+		e := Entry{At: u.CreatedAt, Kind: u.Kind, Title: title, Actor: u.Creator}
+		if u.Kind == UpdateStatus {
+			e.Detail = u.Message
+		}
+		entries = append(entries, e)
+	}
+
+	links := s.Links(inc)
+	linked := make(map[string]bool, len(links))
+	for _, l := range links {
+		linked[fmt.Sprintf("%s/%d", l.Kind, l.SourceID)] = true
+	}
+
+	events := make(map[uint]event.Event)
+	start := inc.StartedAt.Add(-event.GetService().ChangeWindow())
+	end := time.Now()
+	if inc.ResolvedAt != nil {
+		end = *inc.ResolvedAt
+	}
+	for _, serverID := range inc.ServerIDs() {
+		list, _, err := event.GetService().Timeline(event.Filter{ServerID: serverID, Start: start, End: end, PageSize: 500})
+		if err != nil {
+			return nil, err
+		}
+		for _, ev := range list {
+			events[ev.ID] = ev
+		}
+	}
+	// 手动关联的记录可能不在上述服务器和时间范围内
+	found := make(map[string]bool)
+	for _, ev := range events {
+		found[fmt.Sprintf("%s/%d", ev.Type, ev.SourceID)] = true
+	}
+	for _, l := range links {
+		key := fmt.Sprintf("%s/%d", l.Kind, l.SourceID)
+		if found[key] {
+			continue
+		}
+		var list []event.Event
+		s.db.Where("type = ? AND source_id = ?", l.Kind, l.SourceID).Find(&list)
+		for _, ev := range list {
+			events[ev.ID] = ev
+		}
+		if len(list) == 0 {
+			// 事件流之前的记录只有关联时保存的标题
+			entries = append(entries, Entry{At: l.OccurredAt, Kind: l.Kind, Title: l.Title, Linked: true, Before: l.OccurredAt.Before(inc.StartedAt)})
+		}
+	}
+
+	for _, ev := range events {
+		entries = append(entries, Entry{
+			At:     ev.OccurredAt,
+			Kind:   ev.Type,
+			Action: ev.Action,
+			Title:  ev.Title,
+			Detail: ev.Detail,
+			Actor:  ev.Actor,
+			Before: ev.OccurredAt.Before(inc.StartedAt),
+			Linked: linked[fmt.Sprintf("%s/%d", ev.Type, ev.SourceID)],
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	return entries, nil
+}
+
+// Delete 删除故障及其进展、角色、关联和复盘报告
+func (s *Service) Delete(inc *Incident) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, m := range []interface{}{&Update{}, &Role{}, &Link{}, &Postmortem{}} {
+			if err := tx.Where("incident_id = ?", inc.ID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&Incident{}, inc.ID).Error
+	})
+}
+
+// TypeText 时间线记录类型的中文名
+func TypeText(kind string) string {
+	switch kind {
+	case UpdateStatus:
+		return "状态"
+	case UpdateNote:
+		return "记录"
+	case UpdateSeverity:
+		return "级别"
+	case UpdateRole:
+		return "角色"
+	case UpdateLink:
+		return "关联"
+	case UpdateSystem:
+		return "系统"
+	}
+	ev := event.Event{Type: kind}
+	return ev.TypeText()
+}
@@ -7,8 +7,9 @@ import (
 
 	"yunwei/global"
 	"yunwei/model/server"
+	"yunwei/service/metrics"
 	"yunwei/service/ai/llm"
-	"yunwei/service/notifier"
+	"yunwei/service/notify"
 )
 
 // InspectionType 巡检类型
@@ -95,15 +96,15 @@ type ServerInspectionResult struct {
 
 // Inspector 巡检机器人
 type Inspector struct {
-	llmClient  *llm.GLM5Client
-	notifier   *notifier.NotifierService
+	llmClient  llm.Provider
+	notifier   *notify.TenantNotifier
 }
 
-// NewInspector 创建巡检机器人
-func NewInspector(llmClient *llm.GLM5Client) *Inspector {
+// NewInspector 创建巡检机器人，llmClient 为 nil 时每次分析按 inspector 路由选择模型
+func NewInspector(llmClient llm.Provider) *Inspector {
 	return &Inspector{
 		llmClient: llmClient,
-		notifier:  notifier.NewNotifierService(),
+		notifier:  notify.Default(),
 	}
 }
 
@@ -168,9 +169,7 @@ func (i *Inspector) RunDailyInspection() (*InspectionReport, error) {
 	report.Issues = string(issuesJSON)
 
 	// AI 分析
-	if i.llmClient != nil {
-		report.AIAnalysis = i.aiAnalyze(report, results)
-	}
+	report.AIAnalysis = i.aiAnalyze(report, results)
 
 	// 生成建议
 	report.Recommendations = i.generateRecommendations(report)
@@ -205,8 +204,7 @@ func (i *Inspector) inspectServer(srv *server.Server) ServerInspectionResult {
 	result.Status = "online"
 
 	// 获取最新指标
-	var metric server.ServerMetric
-	if err := global.DB.Where("server_id = ?", srv.ID).Order("created_at DESC").First(&metric).Error; err == nil {
+	if metric, err := metrics.LatestServerMetric(srv.ID); err == nil {
 		result.CPUUsage = metric.CPUUsage
 		result.MemoryUsage = metric.MemoryUsage
 		result.DiskUsage = metric.DiskUsage
@@ -290,7 +288,12 @@ func (i *Inspector) checkService(srv *server.Server, serviceName string) string
 
 // aiAnalyze AI分析巡检结果
 func (i *Inspector) aiAnalyze(report *InspectionReport, results []ServerInspectionResult) string {
-	if i.llmClient == nil {
+	// 巡检覆盖全部服务器，使用全局路由
+	client := i.llmClient
+	if client == nil {
+		client = llm.For(llm.FeatureInspector, "")
+	}
+	if client == nil {
 		return ""
 	}
 
@@ -324,7 +327,7 @@ func (i *Inspector) aiAnalyze(report *InspectionReport, results []ServerInspecti
 
 简要回复(300字以内)。`, summary, criticalIssues)
 
-	response, err := i.llmClient.QuickChat(prompt)
+	response, err := client.QuickChat(prompt)
 	if err != nil {
 		return ""
 	}
@@ -379,17 +382,14 @@ func (i *Inspector) sendNotification(report *InspectionReport) {
 	title := fmt.Sprintf("📊 服务器每日巡检报告 - %s", report.CreatedAt.Format("2006-01-02"))
 	content := i.formatReport(report)
 
-	// 发送到各渠道
-	var channels []string
-
-	// Telegram
-	if err := i.notifier.SendTelegram(title, content); err == nil {
-		channels = append(channels, "telegram")
+	// 发送到默认通道
+	if err := i.notifier.SendMessage(title, content); err != nil {
+		global.Logger.Warn(fmt.Sprintf("巡检报告 #%d 通知发送失败: %v", report.ID, err))
+		return
 	}
-
-	// 企业微信
-	if err := i.notifier.SendWechat(title, content); err == nil {
-		channels = append(channels, "wechat")
+	var channels []string
+	for _, ch := range i.notifier.Channels() {
+		channels = append(channels, ch.Type())
 	}
 
 	// 更新通知状态
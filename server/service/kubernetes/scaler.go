@@ -14,7 +14,7 @@ import (
 
 // AutoScaler 自动扩容器
 type AutoScaler struct {
-        llmClient *llm.GLM5Client
+        llmClient llm.Provider
         notifier  notify.Notifier
         executor  K8sExecutor
 }
@@ -29,11 +29,11 @@ type K8sExecutor interface {
 
 // NewAutoScaler 创建自动扩容器
 func NewAutoScaler() *AutoScaler {
-        return &AutoScaler{}
+        return &AutoScaler{notifier: notify.Default(), llmClient: llm.For(llm.FeatureScaler, "")}
 }
 
 // SetLLMClient 设置 LLM 客户端
-func (s *AutoScaler) SetLLMClient(client *llm.GLM5Client) {
+func (s *AutoScaler) SetLLMClient(client llm.Provider) {
         s.llmClient = client
 }
 
@@ -106,6 +106,9 @@ type ScaleDecision struct {
 
 // analyzeWithAI AI 分析
 func (s *AutoScaler) analyzeWithAI(cluster *kubernetes.Cluster, status *kubernetes.DeploymentStatus, metrics map[string]float64) (*ScaleDecision, error) {
+        if s.llmClient == nil {
+                return nil, fmt.Errorf("未配置可用的 AI 模型")
+        }
         prompt := fmt.Sprintf(`你是一个 Kubernetes 运维专家。请分析以下 Deployment 状态并给出扩容建议。
 
 ## 当前状态
@@ -198,7 +198,7 @@ func (AlgorithmConfig) TableName() string {
 
 // LBOptimizer 负载均衡优化器
 type LBOptimizer struct {
-	llmClient *llm.GLM5Client
+	llmClient llm.Provider
 	notifier  notify.Notifier
 	executor  LBExecutor
 }
@@ -248,11 +248,11 @@ type BackendStatus struct {
 
 // NewLBOptimizer 创建负载均衡优化器
 func NewLBOptimizer() *LBOptimizer {
-	return &LBOptimizer{}
+	return &LBOptimizer{notifier: notify.Default(), llmClient: llm.For(llm.FeatureLoadBalancer, "")}
 }
 
 // SetLLMClient 设置 LLM 客户端
-func (o *LBOptimizer) SetLLMClient(client *llm.GLM5Client) {
+func (o *LBOptimizer) SetLLMClient(client llm.Provider) {
 	o.llmClient = client
 }
 
@@ -323,6 +323,9 @@ type OptimizeAction struct {
 
 // analyzeWithAI AI 分析
 func (o *LBOptimizer) analyzeWithAI(lb *LoadBalancer, status *LoadBalancerStatus, backends []BackendServer) (*OptimizeDecision, error) {
+	if o.llmClient == nil {
+		return nil, fmt.Errorf("未配置可用的 AI 模型")
+	}
 	backendsJSON, _ := json.Marshal(backends)
 	statusJSON, _ := json.Marshal(status)
 
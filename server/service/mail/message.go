@@ -0,0 +1,243 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Attachment 邮件附件
+type Attachment struct {
+	Filename    string
+	ContentType string // 为空时按扩展名推断
+	Data        []byte
+}
+
+// Message 邮件，Text 和 HTML 至少填一个，都有时客户端优先显示 HTML
+type Message struct {
+	To          []string
+	Cc          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+func (m *Message) recipients() []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, list := range [][]string{m.To, m.Cc} {
+		for _, addr := range list {
+			if addr = strings.TrimSpace(addr); addr != "" && !seen[addr] {
+				seen[addr] = true
+				out = append(out, addr)
+			}
+		}
+	}
+	return out
+}
+
+// Build 生成 MIME 格式的邮件内容：正文为 text/plain 与 text/html 的 multipart/alternative，
+// 有附件时外层再包一层 multipart/mixed
+func (m *Message) Build(from, fromName string) ([]byte, error) {
+	if m.Text == "" && m.HTML == "" {
+		return nil, errors.New("邮件正文为空")
+	}
+	for _, addr := range m.recipients() {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return nil, fmt.Errorf("收件人地址无效: %s", addr)
+		}
+	}
+
+	var buf bytes.Buffer
+	sender := (&mail.Address{Name: fromName, Address: from}).String()
+	writeHeader(&buf, "From", sender)
+	writeHeader(&buf, "To", strings.Join(m.To, ", "))
+	if len(m.Cc) > 0 {
+		writeHeader(&buf, "Cc", strings.Join(m.Cc, ", "))
+	}
+	writeHeader(&buf, "Subject", mime.BEncoding.Encode("UTF-8", m.Subject))
+	writeHeader(&buf, "Date", time.Now().Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID(from))
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	contentType, encoding, content, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Attachments) == 0 {
+		writeHeader(&buf, "Content-Type", contentType)
+		if encoding != "" {
+			writeHeader(&buf, "Content-Transfer-Encoding", encoding)
+		}
+		buf.WriteString("\r\n")
+		buf.Write(content)
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	buf.WriteString("\r\n")
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType)
+	if encoding != "" {
+		h.Set("Content-Transfer-Encoding", encoding)
+	}
+	part, err := mixed.CreatePart(h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(content); err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": a.Filename}))
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+		h.Set("Content-Transfer-Encoding", "base64")
+		part, err := mixed.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.Data)
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// body 正文部分：只有一种格式时为单个 quoted-printable 部分，两种都有时为 multipart/alternative
+func (m *Message) body() (contentType, encoding string, content []byte, err error) {
+	if m.HTML == "" || m.Text == "" {
+		contentType, text := "text/plain; charset=UTF-8", m.Text
+		if m.HTML != "" {
+			contentType, text = "text/html; charset=UTF-8", m.HTML
+		}
+		var buf bytes.Buffer
+		if err := writeQuotedPrintable(&buf, text); err != nil {
+			return "", "", nil, err
+		}
+		return contentType, "quoted-printable", buf.Bytes(), nil
+	}
+
+	var buf bytes.Buffer
+	alt := multipart.NewWriter(&buf)
+	for _, p := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", p.contentType)
+		h.Set("Content-Transfer-Encoding", "quoted-printable")
+		part, err := alt.CreatePart(h)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if err := writeQuotedPrintable(part, p.content); err != nil {
+			return "", "", nil, err
+		}
+	}
+	if err := alt.Close(); err != nil {
+		return "", "", nil, err
+	}
+	return "multipart/alternative; boundary=" + alt.Boundary(), "", buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(dst io.Writer, content string) error {
+	w := quotedprintable.NewWriter(dst)
+	if _, err := w.Write([]byte(content)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// writeBase64 按每行 76 个字符写入 base64 内容
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+func messageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 {
+		domain = from[i+1:]
+	}
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// ==================== HTML 模板 ====================
+
+var layout = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>{{.Title}}</title></head>
+<body style="margin:0;padding:24px;background:#f5f6f8;font-family:-apple-system,'PingFang SC','Microsoft YaHei',sans-serif;font-size:14px;color:#1f2329">
+<div style="max-width:720px;margin:0 auto;background:#fff;border-radius:6px;overflow:hidden">
+<div style="padding:16px 24px;background:{{.Color}};color:#fff;font-size:18px;font-weight:600">{{.Title}}</div>
+<div style="padding:16px 24px;line-height:1.6">{{.Body}}</div>
+<div style="padding:12px 24px;border-top:1px solid #eee;color:#8f959e;font-size:12px">此邮件由运维平台自动发送，请勿直接回复</div>
+</div>
+</body>
+</html>`))
+
+// 页眉颜色
+const (
+	ColorInfo    = "#3370ff"
+	ColorWarning = "#ff8800"
+	ColorDanger  = "#f54a45"
+	ColorSuccess = "#34c724"
+)
+
+// RenderPage 把已渲染的正文套入统一的邮件页面
+func RenderPage(title, color string, body template.HTML) (string, error) {
+	if color == "" {
+		color = ColorInfo
+	}
+	var buf bytes.Buffer
+	err := layout.Execute(&buf, map[string]interface{}{"Title": title, "Color": color, "Body": body})
+	return buf.String(), err
+}
+
+// Render 用模板渲染正文，再套入邮件页面
+func Render(t *template.Template, title, color string, data interface{}) (string, error) {
+	var body bytes.Buffer
+	if err := t.Execute(&body, data); err != nil {
+		return "", err
+	}
+	return RenderPage(title, color, template.HTML(body.String()))
+}
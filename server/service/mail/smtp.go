@@ -0,0 +1,239 @@
+package mail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"yunwei/config"
+)
+
+// 加密方式
+const (
+	SecurityStartTLS = "starttls" // 明文连接后升级，通常为 587 端口
+	SecurityTLS      = "tls"      // 隐式 TLS，通常为 465 端口
+	SecurityNone     = "none"
+)
+
+const (
+	maxAttempts = 3
+	dialTimeout = 15 * time.Second
+	sendTimeout = 60 * time.Second
+	// idleTimeout 连接空闲超过此时间后重新建立，多数服务器会主动断开空闲连接
+	idleTimeout = 60 * time.Second
+)
+
+// Config SMTP 服务器配置
+type Config struct {
+	Host               string
+	Port               int
+	Username           string
+	Password           string
+	From               string
+	FromName           string
+	Security           string // starttls, tls, none；为空时 465 端口用 tls，其他用 starttls
+	InsecureSkipVerify bool
+}
+
+// Sender SMTP 发送器：复用同一连接连续发送，发送失败时重建连接重试
+type Sender struct {
+	cfg Config
+
+	mu       sync.Mutex
+	conn     net.Conn
+	client   *smtp.Client
+	lastUsed time.Time
+}
+
+var (
+	globalSender *Sender
+	senderOnce   sync.Once
+)
+
+// GetSender 获取按配置文件 smtp 段创建的全局发送器
+func GetSender() *Sender {
+	senderOnce.Do(func() {
+		c := config.CONFIG.Smtp
+		globalSender = NewSender(Config{
+			Host:               c.Host,
+			Port:               c.Port,
+			Username:           c.Username,
+			Password:           c.Password,
+			From:               c.From,
+			FromName:           c.FromName,
+			Security:           c.Security,
+			InsecureSkipVerify: c.InsecureSkipVerify,
+		})
+	})
+	return globalSender
+}
+
+// NewSender 创建 SMTP 发送器
+func NewSender(cfg Config) *Sender {
+	if cfg.Port == 0 {
+		if cfg.Security == SecurityTLS {
+			cfg.Port = 465
+		} else {
+			cfg.Port = 587
+		}
+	}
+	if cfg.From == "" {
+		cfg.From = cfg.Username
+	}
+	return &Sender{cfg: cfg}
+}
+
+// Configured 是否已配置 SMTP 服务器
+func (s *Sender) Configured() bool {
+	return s.cfg.Host != "" && s.cfg.From != ""
+}
+
+func (s *Sender) security() string {
+	if s.cfg.Security != "" {
+		return s.cfg.Security
+	}
+	if s.cfg.Port == 465 {
+		return SecurityTLS
+	}
+	return SecurityStartTLS
+}
+
+// Send 发送邮件。连接或临时错误（4xx）最多尝试 3 次，永久错误（5xx，如收件人不存在）直接返回
+func (s *Sender) Send(msg *Message) error {
+	if !s.Configured() {
+		return errors.New("SMTP 未配置")
+	}
+	rcpts := msg.recipients()
+	if len(rcpts) == 0 {
+		return errors.New("收件人为空")
+	}
+	data, err := msg.Build(s.cfg.From, s.cfg.FromName)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for attempt := 1; ; attempt++ {
+		err = s.send(rcpts, data)
+		if err == nil {
+			return nil
+		}
+		s.closeLocked()
+
+		var protoErr *textproto.Error
+		if attempt >= maxAttempts || (errors.As(err, &protoErr) && protoErr.Code >= 500) {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * 2 * time.Second)
+	}
+}
+
+func (s *Sender) send(rcpts []string, data []byte) error {
+	c, err := s.connect()
+	if err != nil {
+		return err
+	}
+	s.conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	if err := c.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	for _, r := range rcpts {
+		if err := c.Rcpt(r); err != nil {
+			return fmt.Errorf("收件人 %s: %w", r, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	s.lastUsed = time.Now()
+	return nil
+}
+
+// connect 返回可用的连接：空闲未超时且 RSET 成功时复用，否则重新建立
+func (s *Sender) connect() (*smtp.Client, error) {
+	if s.client != nil {
+		if time.Since(s.lastUsed) < idleTimeout {
+			s.conn.SetDeadline(time.Now().Add(dialTimeout))
+			if s.client.Reset() == nil {
+				return s.client, nil
+			}
+		}
+		s.closeLocked()
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host, InsecureSkipVerify: s.cfg.InsecureSkipVerify}
+	security := s.security()
+
+	var conn net.Conn
+	var err error
+	if security == SecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接 SMTP 服务器失败: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(sendTimeout))
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, errors.New("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("STARTTLS 失败: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SMTP 认证失败: %w", err)
+		}
+	}
+
+	s.conn = conn
+	s.client = c
+	return c, nil
+}
+
+// Close 关闭复用的连接
+func (s *Sender) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *Sender) closeLocked() {
+	if s.client == nil {
+		return
+	}
+	s.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := s.client.Quit(); err != nil {
+		s.client.Close()
+	}
+	s.client = nil
+	s.conn = nil
+}
@@ -0,0 +1,172 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/model/server"
+)
+
+var (
+	// GlobalStore 全局时序存储
+	GlobalStore MetricStore
+	// GlobalPipeline 全局写入管道
+	GlobalPipeline *IngestPipeline
+	// GlobalRetention 全局保留策略执行器
+	GlobalRetention *RetentionEnforcer
+)
+
+// InitMetricStore 按配置初始化存储、写入管道和保留策略
+func InitMetricStore() error {
+	cfg := config.CONFIG.Metrics
+
+	store, err := NewStore(cfg)
+	if err != nil {
+		return err
+	}
+
+	GlobalStore = store
+	GlobalPipeline = NewIngestPipeline(store, PipelineOptions{
+		QueueSize:     cfg.QueueSize,
+		BatchSize:     cfg.BatchSize,
+		FlushInterval: time.Duration(cfg.FlushInterval) * time.Second,
+	})
+	GlobalPipeline.Start()
+
+	policy := RetentionPolicy{
+		RawHours:             cfg.RawRetentionHours,
+		Rollup1mDays:         cfg.Rollup1mRetentionDays,
+		Rollup5mDays:         cfg.Rollup5mRetentionDays,
+		DefaultRetentionDays: cfg.DefaultRetentionDays,
+	}
+	if policy.RawHours <= 0 {
+		policy.RawHours = 48
+	}
+	if policy.Rollup1mDays <= 0 {
+		policy.Rollup1mDays = 7
+	}
+	if policy.Rollup5mDays <= 0 {
+		policy.Rollup5mDays = 30
+	}
+	if policy.DefaultRetentionDays <= 0 {
+		policy.DefaultRetentionDays = 30
+	}
+	GlobalRetention = NewRetentionEnforcer(store, global.DB, policy, time.Hour)
+	GlobalRetention.Start()
+
+	return nil
+}
+
+// NewStore 按配置创建存储后端
+func NewStore(cfg config.Metrics) (MetricStore, error) {
+	switch cfg.Store {
+	case "", "sql":
+		return NewSQLStore(global.DB), nil
+	case "tsdb":
+		dir := cfg.DataDir
+		if dir == "" {
+			dir = "data/tsdb"
+		}
+		return NewTSDBStore(dir)
+	}
+	return nil, fmt.Errorf("不支持的指标存储: %s", cfg.Store)
+}
+
+// StopMetricStore 停止写入管道并关闭存储
+func StopMetricStore() {
+	if GlobalRetention != nil {
+		GlobalRetention.Stop()
+	}
+	if GlobalPipeline != nil {
+		GlobalPipeline.Stop()
+	}
+	if GlobalStore != nil {
+		GlobalStore.Close()
+	}
+}
+
+// GetStore 获取全局存储，未初始化时回退到 SQL 存储
+func GetStore() MetricStore {
+	if GlobalStore == nil {
+		return NewSQLStore(global.DB)
+	}
+	return GlobalStore
+}
+
+// GetPipeline 获取全局写入管道
+func GetPipeline() *IngestPipeline {
+	return GlobalPipeline
+}
+
+// IngestServerMetric 写入一条服务器指标，管道未初始化时直接写库
+func IngestServerMetric(m *server.ServerMetric) error {
+	if GlobalPipeline == nil {
+		return global.DB.Create(m).Error
+	}
+	return GlobalPipeline.IngestServerMetric(m)
+}
+
+// ErrNoMetric 存储中没有服务器的近期指标
+var ErrNoMetric = errors.New("暂无指标数据")
+
+// latestLookback 管道缓存未命中时，在存储中查找最新指标的时间范围
+const latestLookback = 15 * time.Minute
+
+// LatestServerMetric 获取服务器最新指标，优先读取管道缓存
+func LatestServerMetric(serverID uint) (*server.ServerMetric, error) {
+	if GlobalPipeline != nil {
+		if m, ok := GlobalPipeline.Latest(serverID); ok {
+			return m, nil
+		}
+	}
+
+	list, err := RecentServerMetrics(serverID, latestLookback, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNoMetric
+	}
+	return &list[0], nil
+}
+
+// RecentServerMetrics 从存储加载服务器最近 lookback 内的原始指标，按时间倒序，最多 limit 条
+func RecentServerMetrics(serverID uint, lookback time.Duration, limit int) ([]server.ServerMetric, error) {
+	end := time.Now()
+	series, err := GetStore().Query(Query{
+		ServerIDs:  []uint{serverID},
+		Metrics:    BuiltinMetricNames(),
+		Start:      end.Add(-lookback),
+		End:        end,
+		Resolution: ResolutionRaw,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := ServerMetricsFromSeries(serverID, series)
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+// LoadServerMetrics 加载服务器历史指标，长时间范围自动使用聚合数据
+func LoadServerMetrics(serverID uint, start, end time.Time) ([]server.ServerMetric, error) {
+	series, err := GetStore().Query(Query{
+		ServerIDs: []uint{serverID},
+		Metrics:   BuiltinMetricNames(),
+		Start:     start,
+		End:       end,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ServerMetricsFromSeries(serverID, series), nil
+}
@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"yunwei/model/server"
+)
+
+// ErrQueueFull 写入队列已满
+var ErrQueueFull = errors.New("指标写入队列已满")
+
+// PipelineOptions 写入管道参数
+type PipelineOptions struct {
+	QueueSize     int           // 缓冲队列长度
+	BatchSize     int           // 单次批量写入样本数
+	FlushInterval time.Duration // 最长刷盘间隔
+	RollupGrace   time.Duration // 聚合桶等待迟到样本的时间
+}
+
+// PipelineStats 写入管道统计
+type PipelineStats struct {
+	Store         string    `json:"store"`
+	QueueLength   int       `json:"queueLength"`
+	QueueCapacity int       `json:"queueCapacity"`
+	Received      uint64    `json:"received"`
+	Written       uint64    `json:"written"`
+	Dropped       uint64    `json:"dropped"`
+	Rollups       uint64    `json:"rollups"`
+	WriteErrors   uint64    `json:"writeErrors"`
+	OpenBuckets   int       `json:"openBuckets"`
+	LastFlush     time.Time `json:"lastFlush"`
+	LastError     string    `json:"lastError"`
+}
+
+// IngestPipeline 缓冲批量写入管道，同时负责生成聚合数据
+type IngestPipeline struct {
+	store   MetricStore
+	opts    PipelineOptions
+	queue   chan Sample
+	rollups *RollupAggregator
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+
+	received    uint64
+	written     uint64
+	dropped     uint64
+	rollupCount uint64
+	writeErrors uint64
+
+	mu          sync.RWMutex
+	lastFlush   time.Time
+	lastError   string
+	openBuckets int
+	latest      map[uint]*server.ServerMetric
+}
+
+// NewIngestPipeline 创建写入管道
+func NewIngestPipeline(store MetricStore, opts PipelineOptions) *IngestPipeline {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.RollupGrace <= 0 {
+		opts.RollupGrace = 30 * time.Second
+	}
+
+	return &IngestPipeline{
+		store:   store,
+		opts:    opts,
+		queue:   make(chan Sample, opts.QueueSize),
+		rollups: NewRollupAggregator(opts.RollupGrace),
+		stopCh:  make(chan struct{}),
+		latest:  make(map[uint]*server.ServerMetric),
+	}
+}
+
+// Start 启动写入协程
+func (p *IngestPipeline) Start() {
+	p.wg.Add(1)
+	go p.run()
+}
+
+// Stop 停止管道，写完队列中剩余的数据
+func (p *IngestPipeline) Stop() {
+	close(p.stopCh)
+	p.wg.Wait()
+}
+
+// Store 获取底层存储
+func (p *IngestPipeline) Store() MetricStore {
+	return p.store
+}
+
+// Ingest 非阻塞写入样本，队列满时丢弃并返回 ErrQueueFull
+func (p *IngestPipeline) Ingest(samples ...Sample) error {
+	for i, s := range samples {
+		select {
+		case p.queue <- s:
+			atomic.AddUint64(&p.received, 1)
+		default:
+			atomic.AddUint64(&p.dropped, uint64(len(samples)-i))
+			return ErrQueueFull
+		}
+	}
+	return nil
+}
+
+// IngestServerMetric 写入一条宽表指标，并更新最新值缓存
+func (p *IngestPipeline) IngestServerMetric(m *server.ServerMetric) error {
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+
+	p.mu.Lock()
+	if prev, ok := p.latest[m.ServerID]; !ok || !prev.CreatedAt.After(m.CreatedAt) {
+		latest := *m
+		p.latest[m.ServerID] = &latest
+	}
+	p.mu.Unlock()
+
+	return p.Ingest(SamplesFromServerMetric(m)...)
+}
+
+// Latest 获取服务器最近一次上报的指标
+func (p *IngestPipeline) Latest(serverID uint) (*server.ServerMetric, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	m, ok := p.latest[serverID]
+	if !ok {
+		return nil, false
+	}
+	latest := *m
+	return &latest, true
+}
+
+// Stats 获取统计信息
+func (p *IngestPipeline) Stats() PipelineStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return PipelineStats{
+		Store:         p.store.Name(),
+		QueueLength:   len(p.queue),
+		QueueCapacity: cap(p.queue),
+		Received:      atomic.LoadUint64(&p.received),
+		Written:       atomic.LoadUint64(&p.written),
+		Dropped:       atomic.LoadUint64(&p.dropped),
+		Rollups:       atomic.LoadUint64(&p.rollupCount),
+		WriteErrors:   atomic.LoadUint64(&p.writeErrors),
+		OpenBuckets:   p.openBuckets,
+		LastFlush:     p.lastFlush,
+		LastError:     p.lastError,
+	}
+}
+
+// run 写入主循环
+func (p *IngestPipeline) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Sample, 0, p.opts.BatchSize)
+	var closed []RollupPoint
+
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			closed = append(closed, p.rollups.Add(s)...)
+			if len(batch) >= p.opts.BatchSize {
+				p.flush(batch, closed)
+				batch = batch[:0]
+				closed = nil
+			}
+
+		case now := <-ticker.C:
+			closed = append(closed, p.rollups.FlushExpired(now)...)
+			p.flush(batch, closed)
+			batch = batch[:0]
+			closed = nil
+
+		case <-p.stopCh:
+			// 写完队列剩余数据
+		drain:
+			for {
+				select {
+				case s := <-p.queue:
+					batch = append(batch, s)
+					closed = append(closed, p.rollups.Add(s)...)
+				default:
+					break drain
+				}
+			}
+			closed = append(closed, p.rollups.FlushAll()...)
+			p.flush(batch, closed)
+			return
+		}
+	}
+}
+
+// flush 批量写入原始数据和聚合数据
+func (p *IngestPipeline) flush(batch []Sample, closed []RollupPoint) {
+	var errs []string
+
+	if len(batch) > 0 {
+		if err := p.store.WriteSamples(batch); err != nil {
+			atomic.AddUint64(&p.writeErrors, 1)
+			errs = append(errs, fmt.Sprintf("写入样本失败: %v", err))
+		} else {
+			atomic.AddUint64(&p.written, uint64(len(batch)))
+		}
+	}
+
+	if len(closed) > 0 {
+		if err := p.store.WriteRollups(closed); err != nil {
+			atomic.AddUint64(&p.writeErrors, 1)
+			errs = append(errs, fmt.Sprintf("写入聚合失败: %v", err))
+		} else {
+			atomic.AddUint64(&p.rollupCount, uint64(len(closed)))
+		}
+	}
+
+	p.mu.Lock()
+	p.lastFlush = time.Now()
+	p.openBuckets = p.rollups.OpenBuckets()
+	if len(errs) > 0 {
+		p.lastError = errs[len(errs)-1]
+	}
+	p.mu.Unlock()
+}
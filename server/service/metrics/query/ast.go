@@ -0,0 +1,253 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ValueType 表达式结果类型
+type ValueType string
+
+const (
+	ValueTypeScalar ValueType = "scalar"
+	ValueTypeVector ValueType = "vector"
+	ValueTypeMatrix ValueType = "matrix"
+	ValueTypeString ValueType = "string"
+)
+
+// Expr 表达式节点
+type Expr interface {
+	// Type 表达式求值后的类型
+	Type() ValueType
+	String() string
+}
+
+// MatchType 标签匹配方式
+type MatchType string
+
+const (
+	MatchEqual     MatchType = "="
+	MatchNotEqual  MatchType = "!="
+	MatchRegexp    MatchType = "=~"
+	MatchNotRegexp MatchType = "!~"
+)
+
+// Matcher 标签匹配器
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewMatcher 创建匹配器，正则按全匹配处理
+func NewMatcher(t MatchType, name, value string) (*Matcher, error) {
+	m := &Matcher{Name: name, Type: t, Value: value}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("无效的正则 %q: %v", value, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// Matches 判断取值是否匹配
+func (m *Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	}
+	return false
+}
+
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// NumberLiteral 数字常量
+type NumberLiteral struct {
+	Val float64
+}
+
+func (*NumberLiteral) Type() ValueType { return ValueTypeScalar }
+func (n *NumberLiteral) String() string {
+	return formatFloat(n.Val)
+}
+
+// StringLiteral 字符串常量
+type StringLiteral struct {
+	Val string
+}
+
+func (*StringLiteral) Type() ValueType  { return ValueTypeString }
+func (s *StringLiteral) String() string { return fmt.Sprintf("%q", s.Val) }
+
+// VectorSelector 瞬时向量选择器，如 cpu_usage{group="prod"}
+type VectorSelector struct {
+	Name     string
+	Matchers []*Matcher
+	Offset   time.Duration
+}
+
+func (*VectorSelector) Type() ValueType { return ValueTypeVector }
+func (v *VectorSelector) String() string {
+	var parts []string
+	for _, m := range v.Matchers {
+		if m.Name == labelMetricName && m.Type == MatchEqual {
+			continue
+		}
+		parts = append(parts, m.String())
+	}
+	s := v.Name
+	if len(parts) > 0 || s == "" {
+		s += "{" + strings.Join(parts, ",") + "}"
+	}
+	if v.Offset > 0 {
+		s += " offset " + FormatDuration(v.Offset)
+	}
+	return s
+}
+
+// MatrixSelector 区间向量选择器，如 cpu_usage[5m]
+type MatrixSelector struct {
+	Vector *VectorSelector
+	Range  time.Duration
+}
+
+func (*MatrixSelector) Type() ValueType { return ValueTypeMatrix }
+func (m *MatrixSelector) String() string {
+	s := m.Vector.String()
+	offset := ""
+	if i := strings.Index(s, " offset "); i >= 0 {
+		s, offset = s[:i], s[i:]
+	}
+	return s + "[" + FormatDuration(m.Range) + "]" + offset
+}
+
+// Call 函数调用
+type Call struct {
+	Func *Function
+	Args []Expr
+}
+
+func (c *Call) Type() ValueType { return c.Func.ReturnType }
+func (c *Call) String() string {
+	args := make([]string, 0, len(c.Args))
+	for _, a := range c.Args {
+		args = append(args, a.String())
+	}
+	return c.Func.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// AggregateExpr 聚合表达式，如 avg by (group) (cpu_usage)
+type AggregateExpr struct {
+	Op       string
+	Expr     Expr
+	Param    Expr // topk/bottomk/quantile 的参数
+	Grouping []string
+	Without  bool
+}
+
+func (*AggregateExpr) Type() ValueType { return ValueTypeVector }
+func (a *AggregateExpr) String() string {
+	s := a.Op
+	if a.Without {
+		s += " without (" + strings.Join(a.Grouping, ", ") + ") "
+	} else if len(a.Grouping) > 0 {
+		s += " by (" + strings.Join(a.Grouping, ", ") + ") "
+	}
+	s += "("
+	if a.Param != nil {
+		s += a.Param.String() + ", "
+	}
+	return s + a.Expr.String() + ")"
+}
+
+// VectorMatching 向量间运算的标签匹配方式
+type VectorMatching struct {
+	On       bool
+	Labels   []string
+	Ignoring bool
+}
+
+// BinaryExpr 二元运算
+type BinaryExpr struct {
+	Op         string
+	LHS, RHS   Expr
+	ReturnBool bool
+	Matching   *VectorMatching
+}
+
+func (b *BinaryExpr) Type() ValueType {
+	if b.LHS.Type() == ValueTypeScalar && b.RHS.Type() == ValueTypeScalar {
+		return ValueTypeScalar
+	}
+	return ValueTypeVector
+}
+
+func (b *BinaryExpr) String() string {
+	op := b.Op
+	if b.ReturnBool {
+		op += " bool"
+	}
+	if b.Matching != nil {
+		if b.Matching.On {
+			op += " on (" + strings.Join(b.Matching.Labels, ", ") + ")"
+		} else if b.Matching.Ignoring {
+			op += " ignoring (" + strings.Join(b.Matching.Labels, ", ") + ")"
+		}
+	}
+	return b.LHS.String() + " " + op + " " + b.RHS.String()
+}
+
+// ParenExpr 括号表达式
+type ParenExpr struct {
+	Expr Expr
+}
+
+func (p *ParenExpr) Type() ValueType { return p.Expr.Type() }
+func (p *ParenExpr) String() string  { return "(" + p.Expr.String() + ")" }
+
+// UnaryExpr 一元负号
+type UnaryExpr struct {
+	Expr Expr
+}
+
+func (u *UnaryExpr) Type() ValueType { return u.Expr.Type() }
+func (u *UnaryExpr) String() string  { return "-" + u.Expr.String() }
+
+// Inspect 深度优先遍历表达式树
+func Inspect(e Expr, fn func(Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch n := e.(type) {
+	case *MatrixSelector:
+		Inspect(n.Vector, fn)
+	case *Call:
+		for _, a := range n.Args {
+			Inspect(a, fn)
+		}
+	case *AggregateExpr:
+		Inspect(n.Param, fn)
+		Inspect(n.Expr, fn)
+	case *BinaryExpr:
+		Inspect(n.LHS, fn)
+		Inspect(n.RHS, fn)
+	case *ParenExpr:
+		Inspect(n.Expr, fn)
+	case *UnaryExpr:
+		Inspect(n.Expr, fn)
+	}
+}
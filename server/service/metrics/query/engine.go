@@ -0,0 +1,692 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"yunwei/service/metrics"
+)
+
+const (
+	// DefaultLookbackDelta 瞬时向量向前查找最近样本的时长
+	DefaultLookbackDelta = 5 * time.Minute
+	// DefaultMaxSteps 区间查询最大步数
+	DefaultMaxSteps = 11000
+)
+
+// Options 单次查询选项
+type Options struct {
+	TenantID   string             // 非空时只查询该租户的服务器
+	Resolution metrics.Resolution // 为空时按时间范围自动选择
+}
+
+// Engine 指标查询引擎
+type Engine struct {
+	store  metrics.MetricStore
+	labels LabelSource
+
+	LookbackDelta time.Duration
+	MaxSteps      int
+}
+
+// NewEngine 创建查询引擎
+func NewEngine(store metrics.MetricStore, labels LabelSource) *Engine {
+	return &Engine{
+		store:         store,
+		labels:        labels,
+		LookbackDelta: DefaultLookbackDelta,
+		MaxSteps:      DefaultMaxSteps,
+	}
+}
+
+// Instant 在指定时间点求值
+func (e *Engine) Instant(qs string, ts time.Time, opts Options) (Value, error) {
+	expr, err := Parse(qs)
+	if err != nil {
+		return nil, err
+	}
+	return e.InstantExpr(expr, ts, opts)
+}
+
+// InstantExpr 对已解析的表达式在指定时间点求值
+func (e *Engine) InstantExpr(expr Expr, ts time.Time, opts Options) (Value, error) {
+	ev, err := e.prepare(expr, ts, ts, opts)
+	if err != nil {
+		return nil, err
+	}
+	v, err := ev.eval(expr, ts)
+	if err != nil {
+		return nil, err
+	}
+	if vec, ok := v.(Vector); ok {
+		sortVector(vec)
+	}
+	return v, nil
+}
+
+// ScalarValue 对只产生单个结果的表达式求值，如 avg(avg_over_time(cpu_usage[24h]))
+// 结果为空时 ok 为 false，结果多于一个时返回错误
+func (e *Engine) ScalarValue(qs string, ts time.Time, opts Options) (v float64, ok bool, err error) {
+	val, err := e.Instant(qs, ts, opts)
+	if err != nil {
+		return 0, false, err
+	}
+	switch r := val.(type) {
+	case Scalar:
+		return r.V, true, nil
+	case Vector:
+		switch len(r) {
+		case 0:
+			return 0, false, nil
+		case 1:
+			return r[0].V, true, nil
+		}
+		return 0, false, fmt.Errorf("查询返回了%d个序列，期望1个", len(r))
+	}
+	return 0, false, fmt.Errorf("查询结果类型 %s 不是数值", val.Type())
+}
+
+// Range 在 [start, end] 内按步长求值，返回区间向量
+func (e *Engine) Range(qs string, start, end time.Time, step time.Duration, opts Options) (Matrix, error) {
+	expr, err := Parse(qs)
+	if err != nil {
+		return nil, err
+	}
+	return e.RangeExpr(expr, start, end, step, opts)
+}
+
+// RangeExpr 对已解析的表达式做区间求值
+func (e *Engine) RangeExpr(expr Expr, start, end time.Time, step time.Duration, opts Options) (Matrix, error) {
+	if step <= 0 {
+		return nil, errors.New("步长必须大于0")
+	}
+	if end.Before(start) {
+		return nil, errors.New("结束时间不能早于开始时间")
+	}
+	if expr.Type() != ValueTypeScalar && expr.Type() != ValueTypeVector {
+		return nil, fmt.Errorf("区间查询的表达式必须返回标量或瞬时向量，实际为 %s", expr.Type())
+	}
+	if steps := int(end.Sub(start)/step) + 1; e.MaxSteps > 0 && steps > e.MaxSteps {
+		return nil, fmt.Errorf("查询点数过多(%d)，请增大步长或缩小时间范围", steps)
+	}
+
+	ev, err := e.prepare(expr, start, end, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesBySig := make(map[string]*Series)
+	var order []string
+	for ts := start; !ts.After(end); ts = ts.Add(step) {
+		v, err := ev.eval(expr, ts)
+		if err != nil {
+			return nil, err
+		}
+
+		var samples Vector
+		switch r := v.(type) {
+		case Scalar:
+			samples = Vector{{Metric: Labels{}, T: ts, V: r.V}}
+		case Vector:
+			samples = r
+		}
+		for _, s := range samples {
+			sig := s.Metric.signature()
+			series, ok := seriesBySig[sig]
+			if !ok {
+				series = &Series{Metric: s.Metric}
+				seriesBySig[sig] = series
+				order = append(order, sig)
+			}
+			series.Points = append(series.Points, metrics.Point{Timestamp: ts, Value: s.V})
+		}
+	}
+
+	result := make(Matrix, 0, len(order))
+	for _, sig := range order {
+		result = append(result, *seriesBySig[sig])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Metric.String() < result[j].Metric.String()
+	})
+	return result, nil
+}
+
+// Targets 返回租户可见的服务器标签
+func (e *Engine) Targets(tenantID string) ([]Target, error) {
+	all, err := e.labels.Targets()
+	if err != nil {
+		return nil, err
+	}
+	if tenantID == "" {
+		return all, nil
+	}
+	var out []Target
+	for _, t := range all {
+		if t.Labels[LabelTenant] == tenantID {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// storedSeries 预取的原始序列
+type storedSeries struct {
+	labels Labels
+	points []metrics.Point
+}
+
+// evaluator 一次查询的求值上下文
+type evaluator struct {
+	lookback time.Duration
+	data     map[*VectorSelector][]storedSeries
+}
+
+// prepare 解析需要的时间窗口并一次性从存储预取数据
+func (e *Engine) prepare(expr Expr, start, end time.Time, opts Options) (*evaluator, error) {
+	windows := make(map[*VectorSelector]time.Duration)
+	Inspect(expr, func(n Expr) {
+		switch s := n.(type) {
+		case *MatrixSelector:
+			windows[s.Vector] = s.Range
+		case *VectorSelector:
+			if _, ok := windows[s]; !ok {
+				windows[s] = 0
+			}
+		}
+	})
+
+	ev := &evaluator{lookback: e.LookbackDelta, data: make(map[*VectorSelector][]storedSeries)}
+	if len(windows) == 0 {
+		return ev, nil
+	}
+
+	// 所有选择器共用一个精度，保证同一查询内的数据可比
+	var earliest time.Time
+	for vs, window := range windows {
+		from := start.Add(-vs.Offset - window - e.LookbackDelta)
+		if earliest.IsZero() || from.Before(earliest) {
+			earliest = from
+		}
+	}
+	res := opts.Resolution
+	if res == "" {
+		res = metrics.AutoResolution(earliest, end)
+	}
+	if d := 2 * res.Duration(); d > ev.lookback {
+		ev.lookback = d
+	}
+
+	targets, err := e.Targets(opts.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("获取服务器标签失败: %v", err)
+	}
+
+	for vs, window := range windows {
+		lookback := window
+		if lookback == 0 {
+			lookback = ev.lookback
+		}
+		series, err := e.fetch(vs, targets, start.Add(-vs.Offset-lookback), end.Add(-vs.Offset), res)
+		if err != nil {
+			return nil, err
+		}
+		ev.data[vs] = series
+	}
+	return ev, nil
+}
+
+// fetch 查询选择器匹配的序列
+func (e *Engine) fetch(vs *VectorSelector, targets []Target, start, end time.Time, res metrics.Resolution) ([]storedSeries, error) {
+	names := metricNames(vs)
+
+	byServer := make(map[uint]*Target)
+	var serverIDs []uint
+	for i := range targets {
+		if targets[i].matches(vs.Matchers) {
+			byServer[targets[i].ServerID] = &targets[i]
+			serverIDs = append(serverIDs, targets[i].ServerID)
+		}
+	}
+	// 存储层把空列表视为全部服务器，这里必须提前返回
+	if len(names) == 0 || len(serverIDs) == 0 {
+		return nil, nil
+	}
+
+	raw, err := e.store.Query(metrics.Query{
+		ServerIDs:  serverIDs,
+		Metrics:    names,
+		Start:      start,
+		End:        end,
+		Resolution: res,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询指标失败: %v", err)
+	}
+
+	out := make([]storedSeries, 0, len(raw))
+	for _, s := range raw {
+		t, ok := byServer[s.ServerID]
+		if !ok || len(s.Points) == 0 {
+			continue
+		}
+		labels := t.Labels.copyLabels()
+		labels[labelMetricName] = s.Metric
+		points := s.Points
+		sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+		out = append(out, storedSeries{labels: labels, points: points})
+	}
+	return out, nil
+}
+
+// ==================== 求值 ====================
+
+func (ev *evaluator) eval(expr Expr, ts time.Time) (Value, error) {
+	switch n := expr.(type) {
+	case *NumberLiteral:
+		return Scalar{T: ts, V: n.Val}, nil
+	case *StringLiteral:
+		return String{T: ts, V: n.Val}, nil
+	case *ParenExpr:
+		return ev.eval(n.Expr, ts)
+	case *UnaryExpr:
+		v, err := ev.eval(n.Expr, ts)
+		if err != nil {
+			return nil, err
+		}
+		switch r := v.(type) {
+		case Scalar:
+			return Scalar{T: ts, V: -r.V}, nil
+		case Vector:
+			out := make(Vector, 0, len(r))
+			for _, s := range r {
+				out = append(out, Sample{Metric: s.Metric.dropName(), T: ts, V: -s.V})
+			}
+			return out, nil
+		}
+		return nil, fmt.Errorf("一元运算不支持 %s", v.Type())
+	case *VectorSelector:
+		return ev.evalVector(n, ts), nil
+	case *MatrixSelector:
+		return ev.evalMatrix(n, ts), nil
+	case *Call:
+		args := make([]Value, 0, len(n.Args))
+		for _, a := range n.Args {
+			v, err := ev.eval(a, ts)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+		}
+		return n.Func.call(ev, args, ts)
+	case *AggregateExpr:
+		return ev.evalAggregate(n, ts)
+	case *BinaryExpr:
+		return ev.evalBinary(n, ts)
+	}
+	return nil, fmt.Errorf("不支持的表达式 %T", expr)
+}
+
+// evalVector 取每个序列在 ts 之前 lookback 内的最新样本
+func (ev *evaluator) evalVector(vs *VectorSelector, ts time.Time) Vector {
+	ref := ts.Add(-vs.Offset)
+	var out Vector
+	for _, s := range ev.data[vs] {
+		i := sort.Search(len(s.points), func(i int) bool { return s.points[i].Timestamp.After(ref) }) - 1
+		if i < 0 || !s.points[i].Timestamp.After(ref.Add(-ev.lookback)) {
+			continue
+		}
+		out = append(out, Sample{Metric: s.labels, T: ts, V: s.points[i].Value})
+	}
+	return out
+}
+
+// evalMatrix 取每个序列在 (ts-range, ts] 内的样本
+func (ev *evaluator) evalMatrix(ms *MatrixSelector, ts time.Time) Matrix {
+	ref := ts.Add(-ms.Vector.Offset)
+	from := ref.Add(-ms.Range)
+	var out Matrix
+	for _, s := range ev.data[ms.Vector] {
+		lo := sort.Search(len(s.points), func(i int) bool { return s.points[i].Timestamp.After(from) })
+		hi := sort.Search(len(s.points), func(i int) bool { return s.points[i].Timestamp.After(ref) })
+		if lo >= hi {
+			continue
+		}
+		out = append(out, Series{Metric: s.labels, Points: s.points[lo:hi], window: ms.Range})
+	}
+	return out
+}
+
+// evalAggregate 按分组标签聚合瞬时向量
+func (ev *evaluator) evalAggregate(agg *AggregateExpr, ts time.Time) (Value, error) {
+	v, err := ev.eval(agg.Expr, ts)
+	if err != nil {
+		return nil, err
+	}
+	in := v.(Vector)
+
+	var param float64
+	if agg.Param != nil {
+		pv, err := ev.eval(agg.Param, ts)
+		if err != nil {
+			return nil, err
+		}
+		param = pv.(Scalar).V
+	}
+
+	type group struct {
+		labels  Labels
+		samples Vector
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for _, s := range in {
+		var key Labels
+		if agg.Without {
+			key = s.Metric.without(agg.Grouping)
+		} else {
+			key = s.Metric.keep(agg.Grouping)
+		}
+		sig := key.signature()
+		g, ok := groups[sig]
+		if !ok {
+			g = &group{labels: key}
+			groups[sig] = g
+			order = append(order, sig)
+		}
+		g.samples = append(g.samples, s)
+	}
+
+	var out Vector
+	for _, sig := range order {
+		g := groups[sig]
+		values := make([]float64, len(g.samples))
+		for i, s := range g.samples {
+			values[i] = s.V
+		}
+
+		switch agg.Op {
+		case "topk", "bottomk":
+			// 先按序列数截断再转换，过大的 k 转 int 会溢出；NaN 视为 0
+			if !(param >= 1) {
+				continue
+			}
+			k := len(g.samples)
+			if param < float64(k) {
+				k = int(param)
+			}
+			sorted := make(Vector, len(g.samples))
+			copy(sorted, g.samples)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				if agg.Op == "topk" {
+					return sorted[i].V > sorted[j].V
+				}
+				return sorted[i].V < sorted[j].V
+			})
+			if k < len(sorted) {
+				sorted = sorted[:k]
+			}
+			for _, s := range sorted {
+				out = append(out, Sample{Metric: s.Metric, T: ts, V: s.V})
+			}
+			continue
+		}
+
+		var r float64
+		switch agg.Op {
+		case "sum":
+			for _, x := range values {
+				r += x
+			}
+		case "avg":
+			for _, x := range values {
+				r += x
+			}
+			r /= float64(len(values))
+		case "min":
+			r = values[0]
+			for _, x := range values[1:] {
+				r = math.Min(r, x)
+			}
+		case "max":
+			r = values[0]
+			for _, x := range values[1:] {
+				r = math.Max(r, x)
+			}
+		case "count":
+			r = float64(len(values))
+		case "stddev":
+			r = stddev(values)
+		case "quantile":
+			r = quantile(param, values)
+		default:
+			return nil, fmt.Errorf("不支持的聚合操作 %s", agg.Op)
+		}
+		out = append(out, Sample{Metric: g.labels, T: ts, V: r})
+	}
+	return out, nil
+}
+
+// evalBinary 二元运算
+func (ev *evaluator) evalBinary(be *BinaryExpr, ts time.Time) (Value, error) {
+	lv, err := ev.eval(be.LHS, ts)
+	if err != nil {
+		return nil, err
+	}
+	rv, err := ev.eval(be.RHS, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	switch l := lv.(type) {
+	case Scalar:
+		switch r := rv.(type) {
+		case Scalar:
+			v, keep := binaryOp(be.Op, l.V, r.V)
+			if isComparison(be.Op) {
+				v = boolValue(keep)
+			}
+			return Scalar{T: ts, V: v}, nil
+		case Vector:
+			return vectorScalarOp(be, r, l.V, true, ts), nil
+		}
+	case Vector:
+		switch r := rv.(type) {
+		case Scalar:
+			return vectorScalarOp(be, l, r.V, false, ts), nil
+		case Vector:
+			if isSetOperator(be.Op) {
+				return vectorSetOp(be, l, r), nil
+			}
+			return vectorVectorOp(be, l, r, ts)
+		}
+	}
+	return nil, fmt.Errorf("运算符 %s 不支持 %s 与 %s", be.Op, lv.Type(), rv.Type())
+}
+
+// vectorScalarOp 向量与标量运算，scalarLeft 表示标量在左侧
+func vectorScalarOp(be *BinaryExpr, vec Vector, scalar float64, scalarLeft bool, ts time.Time) Vector {
+	out := make(Vector, 0, len(vec))
+	for _, s := range vec {
+		l, r := s.V, scalar
+		if scalarLeft {
+			l, r = scalar, s.V
+		}
+		v, keep := binaryOp(be.Op, l, r)
+		if isComparison(be.Op) {
+			if be.ReturnBool {
+				out = append(out, Sample{Metric: s.Metric.dropName(), T: ts, V: boolValue(keep)})
+			} else if keep {
+				// 比较过滤保留向量一侧的原值
+				out = append(out, Sample{Metric: s.Metric, T: ts, V: s.V})
+			}
+			continue
+		}
+		out = append(out, Sample{Metric: s.Metric.dropName(), T: ts, V: v})
+	}
+	return out
+}
+
+// matchKey 向量匹配时使用的标签
+func matchKey(l Labels, m *VectorMatching) Labels {
+	if m != nil && m.On {
+		return l.keep(m.Labels)
+	}
+	if m != nil && m.Ignoring {
+		return l.without(m.Labels)
+	}
+	return l.without(nil)
+}
+
+// vectorVectorOp 一对一向量运算
+func vectorVectorOp(be *BinaryExpr, lhs, rhs Vector, ts time.Time) (Vector, error) {
+	right := make(map[string]Sample, len(rhs))
+	for _, s := range rhs {
+		sig := matchKey(s.Metric, be.Matching).signature()
+		if _, dup := right[sig]; dup {
+			return nil, fmt.Errorf("运算符 %s 右侧存在多个标签相同的序列 %s，请使用 on/ignoring 或先聚合", be.Op, s.Metric)
+		}
+		right[sig] = s
+	}
+
+	var out Vector
+	seen := make(map[string]bool, len(lhs))
+	for _, ls := range lhs {
+		key := matchKey(ls.Metric, be.Matching)
+		sig := key.signature()
+		rs, ok := right[sig]
+		if !ok {
+			continue
+		}
+		if seen[sig] {
+			return nil, fmt.Errorf("运算符 %s 左侧存在多个标签相同的序列 %s，请使用 on/ignoring 或先聚合", be.Op, ls.Metric)
+		}
+		seen[sig] = true
+
+		v, keep := binaryOp(be.Op, ls.V, rs.V)
+		// 比较过滤保留左侧原标签，其余运算结果只保留参与匹配的标签
+		metric := ls.Metric
+		if !isComparison(be.Op) || be.ReturnBool {
+			metric = key
+		}
+		if isComparison(be.Op) {
+			if be.ReturnBool {
+				v = boolValue(keep)
+			} else if !keep {
+				continue
+			} else {
+				v = ls.V
+			}
+		}
+		out = append(out, Sample{Metric: metric, T: ts, V: v})
+	}
+	return out, nil
+}
+
+// vectorSetOp and/or/unless 集合运算
+func vectorSetOp(be *BinaryExpr, lhs, rhs Vector) Vector {
+	rightSigs := make(map[string]bool, len(rhs))
+	for _, s := range rhs {
+		rightSigs[matchKey(s.Metric, be.Matching).signature()] = true
+	}
+
+	var out Vector
+	switch be.Op {
+	case "and":
+		for _, s := range lhs {
+			if rightSigs[matchKey(s.Metric, be.Matching).signature()] {
+				out = append(out, s)
+			}
+		}
+	case "unless":
+		for _, s := range lhs {
+			if !rightSigs[matchKey(s.Metric, be.Matching).signature()] {
+				out = append(out, s)
+			}
+		}
+	case "or":
+		leftSigs := make(map[string]bool, len(lhs))
+		for _, s := range lhs {
+			leftSigs[matchKey(s.Metric, be.Matching).signature()] = true
+			out = append(out, s)
+		}
+		for _, s := range rhs {
+			if !leftSigs[matchKey(s.Metric, be.Matching).signature()] {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// binaryOp 计算运算结果，比较运算返回比较是否成立
+func binaryOp(op string, l, r float64) (float64, bool) {
+	switch op {
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	case "/":
+		return l / r, true
+	case "%":
+		return math.Mod(l, r), true
+	case "^":
+		return math.Pow(l, r), true
+	case "==":
+		return l, l == r
+	case "!=":
+		return l, l != r
+	case ">":
+		return l, l > r
+	case "<":
+		return l, l < r
+	case ">=":
+		return l, l >= r
+	case "<=":
+		return l, l <= r
+	}
+	return math.NaN(), false
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// sortVector 按标签排序，保证输出稳定
+func sortVector(v Vector) {
+	sort.SliceStable(v, func(i, j int) bool {
+		return v[i].Metric.String() < v[j].Metric.String()
+	})
+}
+
+// ParseTime 解析 Prometheus API 的时间参数，支持秒级时间戳（可带小数）和 RFC3339
+func ParseTime(s string) (time.Time, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Round(frac*1000))*int64(time.Millisecond)), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("无效的时间: %s", s)
+}
+
+// ParseStep 解析步长，支持秒数和时长字符串
+func ParseStep(s string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f <= 0 {
+			return 0, fmt.Errorf("步长必须大于0")
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	return ParseDuration(s)
+}
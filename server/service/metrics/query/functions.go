@@ -0,0 +1,275 @@
+package query
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"yunwei/service/metrics"
+)
+
+// Function 内置函数定义
+type Function struct {
+	Name       string
+	ArgTypes   []ValueType
+	ReturnType ValueType
+	call       func(ev *evaluator, args []Value, ts time.Time) (Value, error)
+}
+
+// functions 支持的函数
+var functions = map[string]*Function{}
+
+func init() {
+	overTime := func(name string, fn func(points []metrics.Point) float64) {
+		functions[name] = &Function{
+			Name:       name,
+			ArgTypes:   []ValueType{ValueTypeMatrix},
+			ReturnType: ValueTypeVector,
+			call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+				return aggrOverTime(args[0].(Matrix), ts, fn), nil
+			},
+		}
+	}
+
+	overTime("avg_over_time", func(points []metrics.Point) float64 {
+		var sum float64
+		for _, p := range points {
+			sum += p.Value
+		}
+		return sum / float64(len(points))
+	})
+	overTime("sum_over_time", func(points []metrics.Point) float64 {
+		var sum float64
+		for _, p := range points {
+			sum += p.Value
+		}
+		return sum
+	})
+	overTime("min_over_time", func(points []metrics.Point) float64 {
+		v := points[0].Value
+		for _, p := range points[1:] {
+			v = math.Min(v, p.Value)
+		}
+		return v
+	})
+	overTime("max_over_time", func(points []metrics.Point) float64 {
+		v := points[0].Value
+		for _, p := range points[1:] {
+			v = math.Max(v, p.Value)
+		}
+		return v
+	})
+	overTime("count_over_time", func(points []metrics.Point) float64 {
+		return float64(len(points))
+	})
+	overTime("last_over_time", func(points []metrics.Point) float64 {
+		return points[len(points)-1].Value
+	})
+	overTime("stddev_over_time", func(points []metrics.Point) float64 {
+		values := make([]float64, len(points))
+		for i, p := range points {
+			values[i] = p.Value
+		}
+		return stddev(values)
+	})
+
+	functions["quantile_over_time"] = &Function{
+		Name:       "quantile_over_time",
+		ArgTypes:   []ValueType{ValueTypeScalar, ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+			q := args[0].(Scalar).V
+			return aggrOverTime(args[1].(Matrix), ts, func(points []metrics.Point) float64 {
+				values := make([]float64, len(points))
+				for i, p := range points {
+					values[i] = p.Value
+				}
+				return quantile(q, values)
+			}), nil
+		},
+	}
+
+	functions["rate"] = &Function{
+		Name:       "rate",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+			return counterRate(args[0].(Matrix), ts, true), nil
+		},
+	}
+	functions["increase"] = &Function{
+		Name:       "increase",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+			return counterRate(args[0].(Matrix), ts, false), nil
+		},
+	}
+	functions["delta"] = &Function{
+		Name:       "delta",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+			var out Vector
+			for _, s := range args[0].(Matrix) {
+				if len(s.Points) < 2 {
+					continue
+				}
+				first, last := s.Points[0], s.Points[len(s.Points)-1]
+				out = append(out, Sample{Metric: s.Metric.dropName(), T: ts, V: last.Value - first.Value})
+			}
+			return out, nil
+		},
+	}
+
+	mathFunc := func(name string, fn func(float64) float64) {
+		functions[name] = &Function{
+			Name:       name,
+			ArgTypes:   []ValueType{ValueTypeVector},
+			ReturnType: ValueTypeVector,
+			call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+				in := args[0].(Vector)
+				out := make(Vector, 0, len(in))
+				for _, s := range in {
+					out = append(out, Sample{Metric: s.Metric.dropName(), T: s.T, V: fn(s.V)})
+				}
+				return out, nil
+			},
+		}
+	}
+	mathFunc("abs", math.Abs)
+	mathFunc("ceil", math.Ceil)
+	mathFunc("floor", math.Floor)
+	mathFunc("round", math.Round)
+
+	clamp := func(name string, fn func(v, limit float64) float64) {
+		functions[name] = &Function{
+			Name:       name,
+			ArgTypes:   []ValueType{ValueTypeVector, ValueTypeScalar},
+			ReturnType: ValueTypeVector,
+			call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+				in := args[0].(Vector)
+				limit := args[1].(Scalar).V
+				out := make(Vector, 0, len(in))
+				for _, s := range in {
+					out = append(out, Sample{Metric: s.Metric.dropName(), T: s.T, V: fn(s.V, limit)})
+				}
+				return out, nil
+			},
+		}
+	}
+	clamp("clamp_min", math.Max)
+	clamp("clamp_max", math.Min)
+
+	functions["time"] = &Function{
+		Name:       "time",
+		ReturnType: ValueTypeScalar,
+		call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+			return Scalar{T: ts, V: float64(ts.UnixMilli()) / 1000}, nil
+		},
+	}
+	functions["vector"] = &Function{
+		Name:       "vector",
+		ArgTypes:   []ValueType{ValueTypeScalar},
+		ReturnType: ValueTypeVector,
+		call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+			return Vector{{Metric: Labels{}, T: ts, V: args[0].(Scalar).V}}, nil
+		},
+	}
+	functions["scalar"] = &Function{
+		Name:       "scalar",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeScalar,
+		call: func(ev *evaluator, args []Value, ts time.Time) (Value, error) {
+			in := args[0].(Vector)
+			if len(in) != 1 {
+				return Scalar{T: ts, V: math.NaN()}, nil
+			}
+			return Scalar{T: ts, V: in[0].V}, nil
+		},
+	}
+}
+
+// aggrOverTime 对区间向量的每个序列求值
+func aggrOverTime(m Matrix, ts time.Time, fn func(points []metrics.Point) float64) Vector {
+	out := make(Vector, 0, len(m))
+	for _, s := range m {
+		if len(s.Points) == 0 {
+			continue
+		}
+		out = append(out, Sample{Metric: s.Metric.dropName(), T: ts, V: fn(s.Points)})
+	}
+	return out
+}
+
+// counterRate 计算计数器增长，遇到计数器重置时累加重置前的值
+// perSecond 为 true 时返回每秒增长率，否则返回整个区间的增量
+func counterRate(m Matrix, ts time.Time, perSecond bool) Vector {
+	out := make(Vector, 0, len(m))
+	for _, s := range m {
+		if len(s.Points) < 2 {
+			continue
+		}
+		var increase float64
+		prev := s.Points[0].Value
+		for _, p := range s.Points[1:] {
+			if p.Value < prev {
+				increase += p.Value
+			} else {
+				increase += p.Value - prev
+			}
+			prev = p.Value
+		}
+
+		elapsed := s.Points[len(s.Points)-1].Timestamp.Sub(s.Points[0].Timestamp).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		v := increase / elapsed
+		if !perSecond {
+			// 按采样区间外推到整个窗口
+			v *= s.window.Seconds()
+		}
+		out = append(out, Sample{Metric: s.Metric.dropName(), T: ts, V: v})
+	}
+	return out
+}
+
+// quantile 线性插值分位数，q 超出 [0,1] 时返回 ±Inf
+func quantile(q float64, values []float64) float64 {
+	if len(values) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+// stddev 总体标准差
+func stddev(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sq / float64(len(values)))
+}
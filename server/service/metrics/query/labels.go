@@ -0,0 +1,184 @@
+package query
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/model/agent"
+	"yunwei/model/server"
+	"yunwei/service/metrics"
+
+	"gorm.io/gorm"
+)
+
+// Target 可查询的服务器及其标签
+type Target struct {
+	ServerID uint
+	Labels   Labels
+	Tags     []string
+}
+
+// matches 判断服务器是否满足全部非指标名匹配器
+func (t *Target) matches(matchers []*Matcher) bool {
+	for _, m := range matchers {
+		if m.Name == labelMetricName {
+			continue
+		}
+		if m.Name == LabelTag {
+			if !t.matchTag(m) {
+				return false
+			}
+			continue
+		}
+		if !m.Matches(t.Labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTag 标签是多值的：= 和 =~ 要求任一标签匹配，!= 和 !~ 要求所有标签都不匹配
+func (t *Target) matchTag(m *Matcher) bool {
+	switch m.Type {
+	case MatchEqual, MatchRegexp:
+		for _, tag := range t.Tags {
+			if m.Matches(tag) {
+				return true
+			}
+		}
+		return len(t.Tags) == 0 && m.Matches("")
+	default:
+		for _, tag := range t.Tags {
+			if !m.Matches(tag) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// metricNames 选择器可能匹配的指标名，未指定确切名称时只在内置指标中匹配
+func metricNames(vs *VectorSelector) []string {
+	candidates := metrics.BuiltinMetricNames()
+	if vs.Name != "" {
+		candidates = []string{vs.Name}
+	}
+	var names []string
+	for _, n := range candidates {
+		ok := true
+		for _, m := range vs.Matchers {
+			if m.Name == labelMetricName && !m.Matches(n) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// SelectSeries 列出选择器可能匹配的序列标签（不检查是否有数据）
+func SelectSeries(vs *VectorSelector, targets []Target) []Labels {
+	names := metricNames(vs)
+	var out []Labels
+	for i := range targets {
+		if !targets[i].matches(vs.Matchers) {
+			continue
+		}
+		for _, n := range names {
+			l := targets[i].Labels.copyLabels()
+			l[labelMetricName] = n
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// LabelSource 提供服务器标签
+type LabelSource interface {
+	Targets() ([]Target, error)
+}
+
+// DBLabelSource 从服务器、分组和 Agent 标签表读取标签，带短期缓存
+type DBLabelSource struct {
+	db  *gorm.DB
+	ttl time.Duration
+
+	mu       sync.Mutex
+	cached   []Target
+	cachedAt time.Time
+}
+
+// NewDBLabelSource 创建数据库标签源
+func NewDBLabelSource(db *gorm.DB, ttl time.Duration) *DBLabelSource {
+	return &DBLabelSource{db: db, ttl: ttl}
+}
+
+// Targets 获取全部服务器标签
+func (s *DBLabelSource) Targets() ([]Target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Since(s.cachedAt) < s.ttl {
+		return s.cached, nil
+	}
+
+	var servers []server.Server
+	if err := s.db.Preload("Group").Find(&servers).Error; err != nil {
+		return nil, err
+	}
+
+	var agents []agent.Agent
+	s.db.Select("server_id", "tags").Where("tags <> ''").Find(&agents)
+	tagsByServer := make(map[uint][]string, len(agents))
+	for _, a := range agents {
+		tagsByServer[a.ServerID] = parseTags(a.Tags)
+	}
+
+	targets := make([]Target, 0, len(servers))
+	for _, srv := range servers {
+		labels := Labels{
+			LabelServer:   srv.Name,
+			LabelServerID: strconv.FormatUint(uint64(srv.ID), 10),
+			LabelHost:     srv.Host,
+		}
+		if srv.Group != nil {
+			labels[LabelGroup] = srv.Group.Name
+		}
+		if srv.TenantID != "" {
+			labels[LabelTenant] = srv.TenantID
+		}
+		targets = append(targets, Target{
+			ServerID: srv.ID,
+			Labels:   labels,
+			Tags:     tagsByServer[srv.ID],
+		})
+	}
+
+	s.cached = targets
+	s.cachedAt = time.Now()
+	return targets, nil
+}
+
+// parseTags 解析 Agent 标签，兼容 JSON 数组和逗号分隔两种格式
+func parseTags(raw string) []string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil
+	}
+	var tags []string
+	if strings.HasPrefix(raw, "[") && json.Unmarshal([]byte(raw), &tags) == nil {
+		return tags
+	}
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
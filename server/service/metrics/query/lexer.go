@@ -0,0 +1,244 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// tokenKind 词法单元类型
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokDuration
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokOp // 运算符及匹配符
+)
+
+// token 词法单元
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "结尾"
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+// lex 将查询语句切分为词法单元
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(input) && input[i] != '\n' {
+				i++
+			}
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '{':
+			tokens = append(tokens, token{tokLBrace, "{", i})
+			i++
+		case c == '}':
+			tokens = append(tokens, token{tokRBrace, "}", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokRBracket, "]", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'' || c == '`':
+			s, n, err := lexString(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("位置%d: %v", i, err)
+			}
+			tokens = append(tokens, token{tokString, s, i})
+			i += n
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			start := i
+			for i < len(input) && (isDigit(input[i]) || input[i] == '.') {
+				i++
+			}
+			// 数字后紧跟时间单位则为时长，如 5m、1h30m
+			if i < len(input) && strings.IndexByte("smhdwy", input[i]) >= 0 {
+				for i < len(input) && (isDigit(input[i]) || isAlpha(input[i])) {
+					i++
+				}
+				tokens = append(tokens, token{tokDuration, input[start:i], start})
+				continue
+			}
+			if i < len(input) && (input[i] == 'e' || input[i] == 'E') {
+				i++
+				if i < len(input) && (input[i] == '+' || input[i] == '-') {
+					i++
+				}
+				for i < len(input) && isDigit(input[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{tokNumber, input[start:i], start})
+		case isAlpha(c) || c == '_' || c == ':':
+			start := i
+			for i < len(input) && (isAlpha(input[i]) || isDigit(input[i]) || input[i] == '_' || input[i] == ':') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, input[start:i], start})
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", ">=", "<=", "=~", "!~", "+", "-", "*", "/", "%", "^", ">", "<", "="} {
+				if strings.HasPrefix(input[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("位置%d: 无法识别的字符 %q", i, c)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	tokens = append(tokens, token{tokEOF, "", len(input)})
+	return tokens, nil
+}
+
+// lexString 解析引号字符串，返回内容和消耗的字节数
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			raw := s[:i+1]
+			if quote == '`' {
+				return raw[1 : len(raw)-1], i + 1, nil
+			}
+			if quote == '\'' {
+				raw = "\"" + strings.ReplaceAll(raw[1:len(raw)-1], "\"", "\\\"") + "\""
+			}
+			v, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", 0, fmt.Errorf("无效的字符串 %s", s[:i+1])
+			}
+			return v, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("字符串未闭合")
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isAlpha(c byte) bool { return unicode.IsLetter(rune(c)) && c < 0x80 }
+
+// ParseDuration 解析时长，支持 ms/s/m/h/d/w/y 组合，如 1h30m、7d
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("时长为空")
+	}
+	units := map[string]time.Duration{
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+		"w":  7 * 24 * time.Hour,
+		"y":  365 * 24 * time.Hour,
+	}
+
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := 0
+		for i < len(rest) && isDigit(rest[i]) {
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("无效的时长: %s", s)
+		}
+		n, err := strconv.ParseInt(rest[:i], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的时长: %s", s)
+		}
+		rest = rest[i:]
+
+		j := 0
+		for j < len(rest) && isAlpha(rest[j]) {
+			j++
+		}
+		unit, ok := units[rest[:j]]
+		if !ok {
+			return 0, fmt.Errorf("无效的时长单位: %s", s)
+		}
+		rest = rest[j:]
+		total += time.Duration(n) * unit
+	}
+	return total, nil
+}
+
+// FormatDuration 将时长格式化为查询语法，如 1d2h
+func FormatDuration(d time.Duration) string {
+	if d == 0 {
+		return "0s"
+	}
+	var b strings.Builder
+	for _, u := range []struct {
+		unit string
+		d    time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+	} {
+		if d >= u.d {
+			fmt.Fprintf(&b, "%d%s", d/u.d, u.unit)
+			d %= u.d
+		}
+	}
+	return b.String()
+}
+
+// formatFloat 按 Prometheus 习惯格式化浮点数
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,22 @@
+package query
+
+import (
+	"sync"
+	"time"
+
+	"yunwei/global"
+	"yunwei/service/metrics"
+)
+
+var (
+	globalEngine *Engine
+	engineOnce   sync.Once
+)
+
+// GetEngine 获取全局查询引擎，基于全局指标存储
+func GetEngine() *Engine {
+	engineOnce.Do(func() {
+		globalEngine = NewEngine(metrics.GetStore(), NewDBLabelSource(global.DB, 30*time.Second))
+	})
+	return globalEngine
+}
@@ -0,0 +1,555 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// aggregateOps 支持的聚合操作，值表示是否需要参数
+var aggregateOps = map[string]bool{
+	"sum":      false,
+	"avg":      false,
+	"min":      false,
+	"max":      false,
+	"count":    false,
+	"stddev":   false,
+	"topk":     true,
+	"bottomk":  true,
+	"quantile": true,
+}
+
+// binaryPrecedence 二元运算符优先级，数值越大越先结合
+var binaryPrecedence = map[string]int{
+	"or":     1,
+	"and":    2,
+	"unless": 2,
+	"==":     3,
+	"!=":     3,
+	">":      3,
+	"<":      3,
+	">=":     3,
+	"<=":     3,
+	"+":      4,
+	"-":      4,
+	"*":      5,
+	"/":      5,
+	"%":      5,
+	"^":      6,
+}
+
+// isComparison 是否为比较运算符
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", ">", "<", ">=", "<=":
+		return true
+	}
+	return false
+}
+
+// isSetOperator 是否为集合运算符
+func isSetOperator(op string) bool {
+	return op == "and" || op == "or" || op == "unless"
+}
+
+// ParseError 语法错误
+type ParseError struct {
+	Pos int
+	Msg string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("查询语法错误(位置%d): %s", e.Pos, e.Msg)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+
+	// rangeAggregates 允许 avg(cpu_usage[5m]) 这类直接聚合区间选择器的写法，
+	// 按 avg_over_time 对每条序列分别求值
+	rangeAggregates bool
+}
+
+// Parse 解析查询语句
+func Parse(input string) (Expr, error) {
+	return parse(input, false)
+}
+
+// ParseRuleExpr 解析告警规则表达式，在 Parse 的基础上允许 avg(cpu_usage[5m]) 作为
+// avg_over_time(cpu_usage[5m]) 的简写，sum/min/max/count/stddev 同理
+func ParseRuleExpr(input string) (Expr, error) {
+	return parse(input, true)
+}
+
+// ParseMatchers 解析标签匹配条件列表，如 group="web",tag=~"prod.*"
+func ParseMatchers(input string) ([]*Matcher, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	tokens, err := lex("{" + input + "}")
+	if err != nil {
+		return nil, &ParseError{Msg: err.Error()}
+	}
+	p := &parser{tokens: tokens}
+	p.next()
+	matchers, err := p.parseMatchers()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "多余的内容 %s", t)
+	}
+	return matchers, nil
+}
+
+func parse(input string, rangeAggregates bool) (Expr, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, &ParseError{Msg: "查询语句为空"}
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, &ParseError{Msg: err.Error()}
+	}
+
+	p := &parser{tokens: tokens, rangeAggregates: rangeAggregates}
+	expr, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "多余的内容 %s", t)
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, p.errorf(t, "期望 %s，实际为 %s", what, t)
+	}
+	return t, nil
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &ParseError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// binaryOp 当前位置的二元运算符
+func (p *parser) binaryOp() (string, bool) {
+	t := p.peek()
+	if t.kind == tokOp || t.kind == tokIdent {
+		if _, ok := binaryPrecedence[t.val]; ok {
+			return t.val, true
+		}
+	}
+	return "", false
+}
+
+// parseExpr 按运算符优先级解析二元表达式
+func (p *parser) parseExpr(minPrec int) (Expr, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.binaryOp()
+		if !ok || binaryPrecedence[op] < minPrec {
+			return lhs, nil
+		}
+		opTok := p.next()
+		prec := binaryPrecedence[op]
+
+		be := &BinaryExpr{Op: op}
+		if t := p.peek(); t.kind == tokIdent && t.val == "bool" {
+			if !isComparison(op) {
+				return nil, p.errorf(t, "bool 只能用于比较运算")
+			}
+			p.next()
+			be.ReturnBool = true
+		}
+		if t := p.peek(); t.kind == tokIdent && (t.val == "on" || t.val == "ignoring") {
+			p.next()
+			labels, err := p.parseLabelList()
+			if err != nil {
+				return nil, err
+			}
+			be.Matching = &VectorMatching{On: t.val == "on", Ignoring: t.val == "ignoring", Labels: labels}
+		}
+
+		// ^ 右结合，其余左结合
+		nextMin := prec + 1
+		if op == "^" {
+			nextMin = prec
+		}
+		rhs, err := p.parseExpr(nextMin)
+		if err != nil {
+			return nil, err
+		}
+		be.LHS, be.RHS = lhs, rhs
+
+		if err := checkBinary(be); err != nil {
+			return nil, p.errorf(opTok, "%v", err)
+		}
+		lhs = be
+	}
+}
+
+// checkBinary 校验二元运算的操作数类型
+func checkBinary(be *BinaryExpr) error {
+	lt, rt := be.LHS.Type(), be.RHS.Type()
+	if lt != ValueTypeScalar && lt != ValueTypeVector || rt != ValueTypeScalar && rt != ValueTypeVector {
+		return fmt.Errorf("运算符 %s 的操作数必须是标量或瞬时向量", be.Op)
+	}
+	if isSetOperator(be.Op) && (lt != ValueTypeVector || rt != ValueTypeVector) {
+		return fmt.Errorf("集合运算 %s 只能用于瞬时向量", be.Op)
+	}
+	if isComparison(be.Op) && lt == ValueTypeScalar && rt == ValueTypeScalar && !be.ReturnBool {
+		return fmt.Errorf("标量之间的比较必须使用 bool")
+	}
+	if be.Matching != nil && (lt != ValueTypeVector || rt != ValueTypeVector) {
+		return fmt.Errorf("on/ignoring 只能用于向量之间的运算")
+	}
+	return nil
+}
+
+// parseUnary 解析一元正负号
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	if t.kind == tokOp && (t.val == "-" || t.val == "+") {
+		p.next()
+		// 一元运算优先级高于除 ^ 以外的二元运算
+		e, err := p.parseExpr(binaryPrecedence["^"])
+		if err != nil {
+			return nil, err
+		}
+		if e.Type() != ValueTypeScalar && e.Type() != ValueTypeVector {
+			return nil, p.errorf(t, "一元运算只能用于标量或瞬时向量")
+		}
+		if t.val == "+" {
+			return e, nil
+		}
+		if n, ok := e.(*NumberLiteral); ok {
+			return &NumberLiteral{Val: -n.Val}, nil
+		}
+		return &UnaryExpr{Expr: e}, nil
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix 解析基础表达式及其后的 [区间] 与 offset
+func (p *parser) parsePostfix() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind == tokLBracket {
+		vs, ok := expr.(*VectorSelector)
+		if !ok {
+			return nil, p.errorf(t, "只有指标选择器才能指定时间区间")
+		}
+		p.next()
+		dt, err := p.expect(tokDuration, "时间区间")
+		if err != nil {
+			return nil, err
+		}
+		d, err := ParseDuration(dt.val)
+		if err != nil || d <= 0 {
+			return nil, p.errorf(dt, "无效的时间区间 %s", dt.val)
+		}
+		if _, err := p.expect(tokRBracket, "]"); err != nil {
+			return nil, err
+		}
+		expr = &MatrixSelector{Vector: vs, Range: d}
+	}
+
+	if t := p.peek(); t.kind == tokIdent && t.val == "offset" {
+		p.next()
+		dt, err := p.expect(tokDuration, "偏移时长")
+		if err != nil {
+			return nil, err
+		}
+		d, err := ParseDuration(dt.val)
+		if err != nil {
+			return nil, p.errorf(dt, "无效的偏移时长 %s", dt.val)
+		}
+		switch n := expr.(type) {
+		case *VectorSelector:
+			n.Offset = d
+		case *MatrixSelector:
+			n.Vector.Offset = d
+		default:
+			return nil, p.errorf(t, "offset 只能用于指标选择器")
+		}
+	}
+	return expr, nil
+}
+
+// parsePrimary 解析数字、字符串、括号、函数、聚合和选择器
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, p.errorf(t, "无效的数字 %s", t.val)
+		}
+		return &NumberLiteral{Val: v}, nil
+
+	case tokString:
+		p.next()
+		return &StringLiteral{Val: t.val}, nil
+
+	case tokLParen:
+		p.next()
+		e, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return &ParenExpr{Expr: e}, nil
+
+	case tokLBrace:
+		return p.parseSelector("")
+
+	case tokIdent:
+		p.next()
+		switch strings.ToLower(t.val) {
+		case "nan":
+			return &NumberLiteral{Val: math.NaN()}, nil
+		case "inf":
+			return &NumberLiteral{Val: math.Inf(1)}, nil
+		}
+		if _, ok := aggregateOps[t.val]; ok {
+			if n := p.peek(); n.kind == tokLParen || n.kind == tokIdent && (n.val == "by" || n.val == "without") {
+				return p.parseAggregate(t)
+			}
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(t)
+		}
+		return p.parseSelector(t.val)
+	}
+	return nil, p.errorf(t, "意外的 %s", t)
+}
+
+// parseAggregate 解析 op [by|without (labels)] (args) [by|without (labels)]
+func (p *parser) parseAggregate(opTok token) (Expr, error) {
+	agg := &AggregateExpr{Op: opTok.val}
+
+	parseGrouping := func() error {
+		t := p.peek()
+		if t.kind != tokIdent || t.val != "by" && t.val != "without" {
+			return nil
+		}
+		if agg.Grouping != nil || agg.Without {
+			return p.errorf(t, "重复的分组子句")
+		}
+		p.next()
+		labels, err := p.parseLabelList()
+		if err != nil {
+			return err
+		}
+		agg.Without = t.val == "without"
+		agg.Grouping = labels
+		return nil
+	}
+
+	if err := parseGrouping(); err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	if aggregateOps[agg.Op] {
+		param, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if param.Type() != ValueTypeScalar {
+			return nil, p.errorf(opTok, "%s 的第一个参数必须是标量", agg.Op)
+		}
+		agg.Param = param
+		if _, err := p.expect(tokComma, ","); err != nil {
+			return nil, err
+		}
+	}
+	e, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if ms, ok := e.(*MatrixSelector); ok && p.rangeAggregates && agg.Param == nil {
+		if fn, ok := functions[agg.Op+"_over_time"]; ok {
+			if _, err := p.expect(tokRParen, ")"); err != nil {
+				return nil, err
+			}
+			if t := p.peek(); t.kind == tokIdent && (t.val == "by" || t.val == "without") || agg.Grouping != nil || agg.Without {
+				return nil, p.errorf(opTok, "区间聚合简写 %s(...[d]) 不能带分组子句", agg.Op)
+			}
+			return &Call{Func: fn, Args: []Expr{ms}}, nil
+		}
+	}
+	if e.Type() != ValueTypeVector {
+		return nil, p.errorf(opTok, "%s 只能聚合瞬时向量，区间数据请先使用 *_over_time 函数", agg.Op)
+	}
+	agg.Expr = e
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+	if err := parseGrouping(); err != nil {
+		return nil, err
+	}
+	return agg, nil
+}
+
+// parseCall 解析函数调用
+func (p *parser) parseCall(nameTok token) (Expr, error) {
+	fn, ok := functions[nameTok.val]
+	if !ok {
+		return nil, p.errorf(nameTok, "未知函数 %s", nameTok.val)
+	}
+	p.next() // (
+
+	var args []Expr
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+
+	if len(args) != len(fn.ArgTypes) {
+		return nil, p.errorf(nameTok, "函数 %s 需要 %d 个参数，实际 %d 个", fn.Name, len(fn.ArgTypes), len(args))
+	}
+	for i, arg := range args {
+		if arg.Type() != fn.ArgTypes[i] {
+			return nil, p.errorf(nameTok, "函数 %s 第%d个参数应为 %s，实际为 %s", fn.Name, i+1, fn.ArgTypes[i], arg.Type())
+		}
+	}
+	return &Call{Func: fn, Args: args}, nil
+}
+
+// parseMatchers 解析 { 之后的 label="v",... }，消费结尾的 }
+func (p *parser) parseMatchers() ([]*Matcher, error) {
+	var matchers []*Matcher
+	for p.peek().kind != tokRBrace {
+		lt, err := p.expect(tokIdent, "标签名")
+		if err != nil {
+			return nil, err
+		}
+		opTok := p.next()
+		if opTok.kind != tokOp || opTok.val != "=" && opTok.val != "!=" && opTok.val != "=~" && opTok.val != "!~" {
+			return nil, p.errorf(opTok, "期望标签匹配符，实际为 %s", opTok)
+		}
+		vt, err := p.expect(tokString, "标签值")
+		if err != nil {
+			return nil, err
+		}
+		m, err := NewMatcher(MatchType(opTok.val), lt.val, vt.val)
+		if err != nil {
+			return nil, p.errorf(vt, "%v", err)
+		}
+		matchers = append(matchers, m)
+
+		if p.peek().kind == tokComma {
+			p.next()
+			continue
+		}
+		if p.peek().kind != tokRBrace {
+			return nil, p.errorf(p.peek(), "期望 , 或 }")
+		}
+	}
+	p.next()
+	return matchers, nil
+}
+
+// parseSelector 解析 name{label="v",...}
+func (p *parser) parseSelector(name string) (Expr, error) {
+	vs := &VectorSelector{Name: name}
+	if name != "" {
+		m, _ := NewMatcher(MatchEqual, labelMetricName, name)
+		vs.Matchers = append(vs.Matchers, m)
+	}
+
+	if p.peek().kind == tokLBrace {
+		braceTok := p.next()
+		matchers, err := p.parseMatchers()
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matchers {
+			if m.Name == labelMetricName {
+				if name != "" {
+					return nil, p.errorf(braceTok, "指标名重复指定")
+				}
+				if m.Type == MatchEqual {
+					vs.Name = m.Value
+				}
+			}
+		}
+		vs.Matchers = append(vs.Matchers, matchers...)
+	}
+
+	hasName := false
+	for _, m := range vs.Matchers {
+		if m.Name == labelMetricName && !m.Matches("") {
+			hasName = true
+		}
+	}
+	if !hasName {
+		return nil, &ParseError{Pos: p.peek().pos, Msg: "选择器必须指定指标名或 __name__ 匹配条件"}
+	}
+	return vs, nil
+}
+
+// parseLabelList 解析 (label, label, ...)
+func (p *parser) parseLabelList() ([]string, error) {
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	labels := []string{}
+	for p.peek().kind != tokRParen {
+		t, err := p.expect(tokIdent, "标签名")
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, t.val)
+		if p.peek().kind == tokComma {
+			p.next()
+			continue
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.errorf(p.peek(), "期望 , 或 )")
+		}
+	}
+	p.next()
+	return labels, nil
+}
@@ -0,0 +1,210 @@
+package query
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"yunwei/service/metrics"
+)
+
+// 内置标签名
+const (
+	labelMetricName = "__name__"
+	LabelServer     = "server"
+	LabelServerID   = "server_id"
+	LabelHost       = "host"
+	LabelGroup      = "group"
+	LabelTenant     = "tenant"
+	// LabelTag 只用于匹配，服务器任一标签满足即视为匹配，不出现在结果标签中
+	LabelTag = "tag"
+)
+
+// Labels 序列标签
+type Labels map[string]string
+
+// copyLabels 复制标签
+func (l Labels) copyLabels() Labels {
+	out := make(Labels, len(l))
+	for k, v := range l {
+		out[k] = v
+	}
+	return out
+}
+
+// dropName 去掉指标名，函数和运算结果不再属于原指标
+func (l Labels) dropName() Labels {
+	if _, ok := l[labelMetricName]; !ok {
+		return l
+	}
+	out := l.copyLabels()
+	delete(out, labelMetricName)
+	return out
+}
+
+// keep 只保留指定标签
+func (l Labels) keep(names []string) Labels {
+	out := make(Labels, len(names))
+	for _, n := range names {
+		if v, ok := l[n]; ok {
+			out[n] = v
+		}
+	}
+	return out
+}
+
+// without 去掉指定标签及指标名
+func (l Labels) without(names []string) Labels {
+	out := l.copyLabels()
+	delete(out, labelMetricName)
+	for _, n := range names {
+		delete(out, n)
+	}
+	return out
+}
+
+// signature 标签集合的唯一键
+func (l Labels) signature() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0xff)
+		b.WriteString(l[k])
+		b.WriteByte(0xfe)
+	}
+	return b.String()
+}
+
+// String 以 {k="v"} 形式输出
+func (l Labels) String() string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"=\""+l[k]+"\"")
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+// Value 求值结果
+type Value interface {
+	Type() ValueType
+}
+
+// Scalar 标量
+type Scalar struct {
+	T time.Time
+	V float64
+}
+
+func (Scalar) Type() ValueType { return ValueTypeScalar }
+
+// MarshalJSON 输出 [时间戳, "值"]
+func (s Scalar) MarshalJSON() ([]byte, error) {
+	return json.Marshal(samplePair(s.T, s.V))
+}
+
+// String 字符串结果
+type String struct {
+	T time.Time
+	V string
+}
+
+func (String) Type() ValueType { return ValueTypeString }
+
+// MarshalJSON 输出 [时间戳, "值"]
+func (s String) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{unixSeconds(s.T), s.V})
+}
+
+// Sample 瞬时向量中的一个样本
+type Sample struct {
+	Metric Labels
+	T      time.Time
+	V      float64
+}
+
+// MarshalJSON 输出 {"metric":{...},"value":[时间戳,"值"]}
+func (s Sample) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"metric": labelsOrEmpty(s.Metric),
+		"value":  samplePair(s.T, s.V),
+	})
+}
+
+// Vector 瞬时向量
+type Vector []Sample
+
+func (Vector) Type() ValueType { return ValueTypeVector }
+
+// Series 区间向量中的一条序列
+type Series struct {
+	Metric Labels
+	Points []metrics.Point
+	window time.Duration // 区间选择器的窗口长度
+}
+
+// MarshalJSON 输出 {"metric":{...},"values":[[时间戳,"值"],...]}
+func (s Series) MarshalJSON() ([]byte, error) {
+	values := make([][]interface{}, 0, len(s.Points))
+	for _, p := range s.Points {
+		values = append(values, samplePair(p.Timestamp, p.Value))
+	}
+	return json.Marshal(map[string]interface{}{
+		"metric": labelsOrEmpty(s.Metric),
+		"values": values,
+	})
+}
+
+// Matrix 区间向量
+type Matrix []Series
+
+func (Matrix) Type() ValueType { return ValueTypeMatrix }
+
+// samplePair Prometheus 格式的 [秒级时间戳, "值"]
+func samplePair(t time.Time, v float64) []interface{} {
+	return []interface{}{unixSeconds(t), formatFloat(v)}
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+func labelsOrEmpty(l Labels) Labels {
+	if l == nil {
+		return Labels{}
+	}
+	return l
+}
+
+// QueryData Prometheus HTTP API 的 data 字段
+type QueryData struct {
+	ResultType ValueType   `json:"resultType"`
+	Result     interface{} `json:"result"`
+}
+
+// NewQueryData 将求值结果包装为 API 响应数据
+func NewQueryData(v Value) QueryData {
+	switch r := v.(type) {
+	case Vector:
+		if r == nil {
+			r = Vector{}
+		}
+		return QueryData{ResultType: ValueTypeVector, Result: r}
+	case Matrix:
+		if r == nil {
+			r = Matrix{}
+		}
+		return QueryData{ResultType: ValueTypeMatrix, Result: r}
+	}
+	return QueryData{ResultType: v.Type(), Result: v}
+}
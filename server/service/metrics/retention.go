@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"yunwei/model/server"
+	"yunwei/model/tenant"
+
+	"gorm.io/gorm"
+)
+
+// RetentionPolicy 分层保留策略
+// 各精度实际保留时间 = min(该层上限, 租户 MetricsRetention)，1h 聚合直接使用租户配额
+type RetentionPolicy struct {
+	RawHours             int // 原始数据保留小时数
+	Rollup1mDays         int // 1分钟聚合保留天数
+	Rollup5mDays         int // 5分钟聚合保留天数
+	DefaultRetentionDays int // 服务器未关联租户或租户无配额时使用
+}
+
+// RetentionReport 一次保留策略执行结果
+type RetentionReport struct {
+	StartedAt time.Time            `json:"startedAt"`
+	Duration  time.Duration        `json:"duration"`
+	Servers   int                  `json:"servers"`
+	Deleted   map[Resolution]int64 `json:"deleted"`
+	Errors    []string             `json:"errors"`
+}
+
+// RetentionEnforcer 按租户配额清理过期指标
+type RetentionEnforcer struct {
+	store    MetricStore
+	db       *gorm.DB
+	policy   RetentionPolicy
+	interval time.Duration
+
+	mu         sync.RWMutex
+	lastReport *RetentionReport
+	stopCh     chan struct{}
+	running    bool
+}
+
+// NewRetentionEnforcer 创建保留策略执行器
+func NewRetentionEnforcer(store MetricStore, db *gorm.DB, policy RetentionPolicy, interval time.Duration) *RetentionEnforcer {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &RetentionEnforcer{
+		store:    store,
+		db:       db,
+		policy:   policy,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start 启动定时清理
+func (e *RetentionEnforcer) Start() {
+	e.mu.Lock()
+	if e.running {
+		e.mu.Unlock()
+		return
+	}
+	e.running = true
+	e.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				e.RunOnce()
+			case <-e.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止定时清理
+func (e *RetentionEnforcer) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running {
+		close(e.stopCh)
+		e.running = false
+	}
+}
+
+// LastReport 最近一次执行结果
+func (e *RetentionEnforcer) LastReport() *RetentionReport {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.lastReport
+}
+
+// RunOnce 执行一次清理
+func (e *RetentionEnforcer) RunOnce() *RetentionReport {
+	report := &RetentionReport{
+		StartedAt: time.Now(),
+		Deleted:   make(map[Resolution]int64),
+	}
+
+	var servers []server.Server
+	if err := e.db.Select("id", "tenant_id").Find(&servers).Error; err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("获取服务器失败: %v", err))
+		e.finish(report)
+		return report
+	}
+
+	var quotas []tenant.TenantQuota
+	if err := e.db.Select("tenant_id", "metrics_retention").Find(&quotas).Error; err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("获取租户配额失败: %v", err))
+	}
+	retentionByTenant := make(map[string]int, len(quotas))
+	for _, q := range quotas {
+		retentionByTenant[q.TenantID] = q.MetricsRetention
+	}
+
+	now := time.Now()
+	for _, srv := range servers {
+		days, ok := retentionByTenant[srv.TenantID]
+		if srv.TenantID == "" || !ok {
+			days = e.policy.DefaultRetentionDays
+		}
+
+		for res, keep := range e.tierRetention(days) {
+			if keep <= 0 {
+				continue
+			}
+			n, err := e.store.DeleteBefore(srv.ID, res, now.Add(-keep))
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("服务器%d清理%s失败: %v", srv.ID, res, err))
+				continue
+			}
+			report.Deleted[res] += n
+		}
+		report.Servers++
+	}
+
+	e.finish(report)
+	return report
+}
+
+// RetentionFor 计算某个租户配额下各精度的保留时长（<=0 表示不清理）
+func (e *RetentionEnforcer) RetentionFor(retentionDays int) map[Resolution]time.Duration {
+	return e.tierRetention(retentionDays)
+}
+
+// tierRetention 按分层上限截断租户保留天数
+func (e *RetentionEnforcer) tierRetention(retentionDays int) map[Resolution]time.Duration {
+	tenantKeep := time.Duration(retentionDays) * 24 * time.Hour
+	capAt := func(limit time.Duration) time.Duration {
+		if retentionDays <= 0 {
+			return limit
+		}
+		if limit <= 0 || tenantKeep < limit {
+			return tenantKeep
+		}
+		return limit
+	}
+
+	return map[Resolution]time.Duration{
+		ResolutionRaw: capAt(time.Duration(e.policy.RawHours) * time.Hour),
+		Resolution1m:  capAt(time.Duration(e.policy.Rollup1mDays) * 24 * time.Hour),
+		Resolution5m:  capAt(time.Duration(e.policy.Rollup5mDays) * 24 * time.Hour),
+		Resolution1h:  tenantKeep,
+	}
+}
+
+// finish 记录执行结果
+func (e *RetentionEnforcer) finish(report *RetentionReport) {
+	report.Duration = time.Since(report.StartedAt)
+	e.mu.Lock()
+	e.lastReport = report
+	e.mu.Unlock()
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"time"
+)
+
+// rollupKey 聚合桶标识
+type rollupKey struct {
+	serverID   uint
+	metric     string
+	resolution Resolution
+}
+
+// rollupBucket 聚合桶，关闭后保留起始时间，用于丢弃落入已写出时间桶的迟到样本
+type rollupBucket struct {
+	start  time.Time
+	values []float64
+	closed bool
+}
+
+// RollupAggregator 按 1m/5m/1h 对样本做滚动聚合
+// 非并发安全，由 IngestPipeline 的写入协程独占使用
+type RollupAggregator struct {
+	grace   time.Duration
+	buckets map[rollupKey]*rollupBucket
+}
+
+// NewRollupAggregator 创建聚合器，grace 为桶结束后等待迟到样本的时间
+func NewRollupAggregator(grace time.Duration) *RollupAggregator {
+	return &RollupAggregator{
+		grace:   grace,
+		buckets: make(map[rollupKey]*rollupBucket),
+	}
+}
+
+// Add 加入样本，返回因时间推进而关闭的聚合结果
+func (a *RollupAggregator) Add(s Sample) []RollupPoint {
+	var closed []RollupPoint
+
+	for _, res := range RollupResolutions {
+		key := rollupKey{serverID: s.ServerID, metric: s.Metric, resolution: res}
+		start := s.Timestamp.Truncate(res.Duration())
+
+		b, ok := a.buckets[key]
+		if ok && start.After(b.start) {
+			if !b.closed {
+				closed = append(closed, summarize(key, b))
+			}
+			b = nil
+		} else if ok && (start.Before(b.start) || b.closed) {
+			// 所属时间桶已经写出，迟到样本只保留原始数据，避免同一时间桶写出两条聚合
+			continue
+		}
+
+		if b == nil {
+			b = &rollupBucket{start: start}
+			a.buckets[key] = b
+		}
+		b.values = append(b.values, s.Value)
+	}
+
+	return closed
+}
+
+// FlushExpired 关闭结束时间早于 now-grace 的桶
+func (a *RollupAggregator) FlushExpired(now time.Time) []RollupPoint {
+	var closed []RollupPoint
+	for key, b := range a.buckets {
+		if b.closed {
+			// 长时间没有新样本的序列不再保留
+			if b.start.Add(key.resolution.Duration()).Add(a.grace).Add(key.resolution.Duration()).Before(now) {
+				delete(a.buckets, key)
+			}
+			continue
+		}
+		if b.start.Add(key.resolution.Duration()).Add(a.grace).Before(now) {
+			closed = append(closed, summarize(key, b))
+			b.values = nil
+			b.closed = true
+		}
+	}
+	return closed
+}
+
+// FlushAll 关闭全部桶（停止时调用）
+func (a *RollupAggregator) FlushAll() []RollupPoint {
+	closed := make([]RollupPoint, 0, len(a.buckets))
+	for key, b := range a.buckets {
+		if !b.closed {
+			closed = append(closed, summarize(key, b))
+		}
+		delete(a.buckets, key)
+	}
+	return closed
+}
+
+// OpenBuckets 当前未关闭的桶数量
+func (a *RollupAggregator) OpenBuckets() int {
+	n := 0
+	for _, b := range a.buckets {
+		if !b.closed {
+			n++
+		}
+	}
+	return n
+}
+
+// summarize 计算桶内 min/max/avg/p95
+func summarize(key rollupKey, b *rollupBucket) RollupPoint {
+	p := RollupPoint{
+		ServerID:   key.serverID,
+		Metric:     key.metric,
+		Resolution: key.resolution,
+		Timestamp:  b.start,
+		Count:      len(b.values),
+	}
+	if len(b.values) == 0 {
+		return p
+	}
+
+	p.Min, p.Max = b.values[0], b.values[0]
+	sum := 0.0
+	for _, v := range b.values {
+		if v < p.Min {
+			p.Min = v
+		}
+		if v > p.Max {
+			p.Max = v
+		}
+		sum += v
+	}
+	p.Avg = sum / float64(len(b.values))
+	p.P95 = Percentile(b.values, 0.95)
+	return p
+}
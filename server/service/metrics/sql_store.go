@@ -0,0 +1,209 @@
+package metrics
+
+import (
+	"time"
+
+	"yunwei/model/server"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SQLStore 基于 MySQL 的存储
+// 原始数据沿用 server_metrics 宽表（仅支持内置指标），聚合数据写入 metric_rollups
+type SQLStore struct {
+	db        *gorm.DB
+	batchSize int
+}
+
+// NewSQLStore 创建 SQL 存储
+func NewSQLStore(db *gorm.DB) *SQLStore {
+	return &SQLStore{db: db, batchSize: 500}
+}
+
+// Name 存储后端名称
+func (s *SQLStore) Name() string {
+	return "sql"
+}
+
+// WriteSamples 按服务器和时间点合并为宽表行后批量写入
+func (s *SQLStore) WriteSamples(samples []Sample) error {
+	type rowKey struct {
+		serverID uint
+		ts       int64
+	}
+
+	rows := make(map[rowKey]*server.ServerMetric)
+	order := make([]rowKey, 0)
+	for _, sample := range samples {
+		var field *builtinField
+		for i := range builtinFields {
+			if builtinFields[i].name == sample.Metric {
+				field = &builtinFields[i]
+				break
+			}
+		}
+		if field == nil {
+			continue
+		}
+
+		key := rowKey{serverID: sample.ServerID, ts: sample.Timestamp.UnixMilli()}
+		row, ok := rows[key]
+		if !ok {
+			row = &server.ServerMetric{ServerID: sample.ServerID, CreatedAt: sample.Timestamp}
+			rows[key] = row
+			order = append(order, key)
+		}
+		field.set(row, sample.Value)
+	}
+
+	if len(order) == 0 {
+		return nil
+	}
+
+	records := make([]server.ServerMetric, 0, len(order))
+	for _, key := range order {
+		records = append(records, *rows[key])
+	}
+	return s.db.CreateInBatches(records, s.batchSize).Error
+}
+
+// WriteRollups 批量写入聚合数据
+func (s *SQLStore) WriteRollups(points []RollupPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	records := make([]server.MetricRollup, 0, len(points))
+	for _, p := range points {
+		records = append(records, server.MetricRollup{
+			ServerID:   p.ServerID,
+			Metric:     p.Metric,
+			Resolution: string(p.Resolution),
+			BucketTime: p.Timestamp,
+			Min:        p.Min,
+			Max:        p.Max,
+			Avg:        p.Avg,
+			P95:        p.P95,
+			Count:      p.Count,
+		})
+	}
+	// 同一时间桶已有聚合时保留先写入的一条，重启后迟到样本生成的不完整聚合不会覆盖或重复计入
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(records, s.batchSize).Error
+}
+
+// Query 查询时间序列
+func (s *SQLStore) Query(q Query) ([]Series, error) {
+	q = normalizeQuery(q)
+	if q.Resolution == ResolutionRaw {
+		return s.queryRaw(q)
+	}
+	return s.queryRollups(q)
+}
+
+// queryRaw 从 server_metrics 查询原始数据
+func (s *SQLStore) queryRaw(q Query) ([]Series, error) {
+	metrics := q.Metrics
+	if len(metrics) == 0 {
+		metrics = BuiltinMetricNames()
+	}
+
+	columns := []string{"server_id", "created_at"}
+	var fields []builtinField
+	for _, name := range metrics {
+		for _, f := range builtinFields {
+			if f.name == name {
+				columns = append(columns, f.name)
+				fields = append(fields, f)
+				break
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	query := s.db.Model(&server.ServerMetric{}).
+		Select(columns).
+		Where("created_at >= ? AND created_at <= ?", q.Start, q.End)
+	if len(q.ServerIDs) > 0 {
+		query = query.Where("server_id IN ?", q.ServerIDs)
+	}
+
+	var rows []server.ServerMetric
+	if err := query.Order("created_at ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	type seriesKey struct {
+		serverID uint
+		metric   string
+	}
+	index := make(map[seriesKey]int)
+	var result []Series
+	for i := range rows {
+		for _, f := range fields {
+			key := seriesKey{serverID: rows[i].ServerID, metric: f.name}
+			idx, ok := index[key]
+			if !ok {
+				idx = len(result)
+				index[key] = idx
+				result = append(result, Series{ServerID: key.serverID, Metric: key.metric, Resolution: ResolutionRaw})
+			}
+			result[idx].Points = append(result[idx].Points, Point{Timestamp: rows[i].CreatedAt, Value: f.get(&rows[i])})
+		}
+	}
+	return result, nil
+}
+
+// queryRollups 从 metric_rollups 查询聚合数据
+func (s *SQLStore) queryRollups(q Query) ([]Series, error) {
+	query := s.db.Model(&server.MetricRollup{}).
+		Where("resolution = ? AND bucket_time >= ? AND bucket_time <= ?", string(q.Resolution), q.Start, q.End)
+	if len(q.ServerIDs) > 0 {
+		query = query.Where("server_id IN ?", q.ServerIDs)
+	}
+	if len(q.Metrics) > 0 {
+		query = query.Where("metric IN ?", q.Metrics)
+	}
+
+	var rows []server.MetricRollup
+	if err := query.Order("bucket_time ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	type seriesKey struct {
+		serverID uint
+		metric   string
+	}
+	index := make(map[seriesKey]int)
+	var result []Series
+	for _, r := range rows {
+		key := seriesKey{serverID: r.ServerID, metric: r.Metric}
+		idx, ok := index[key]
+		if !ok {
+			idx = len(result)
+			index[key] = idx
+			result = append(result, Series{ServerID: r.ServerID, Metric: r.Metric, Resolution: q.Resolution})
+		}
+		p := RollupPoint{Min: r.Min, Max: r.Max, Avg: r.Avg, P95: r.P95}
+		result[idx].Points = append(result[idx].Points, Point{Timestamp: r.BucketTime, Value: p.Value(q.Aggregator)})
+	}
+	return result, nil
+}
+
+// DeleteBefore 删除早于 before 的数据
+func (s *SQLStore) DeleteBefore(serverID uint, res Resolution, before time.Time) (int64, error) {
+	var result *gorm.DB
+	if res == ResolutionRaw {
+		result = s.db.Where("server_id = ? AND created_at < ?", serverID, before).Delete(&server.ServerMetric{})
+	} else {
+		result = s.db.Where("server_id = ? AND resolution = ? AND bucket_time < ?", serverID, string(res), before).Delete(&server.MetricRollup{})
+	}
+	return result.RowsAffected, result.Error
+}
+
+// Close 关闭存储（数据库连接由 global 管理）
+func (s *SQLStore) Close() error {
+	return nil
+}
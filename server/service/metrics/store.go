@@ -0,0 +1,311 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"yunwei/model/server"
+)
+
+// Resolution 数据精度
+type Resolution string
+
+const (
+	ResolutionRaw Resolution = "raw"
+	Resolution1m  Resolution = "1m"
+	Resolution5m  Resolution = "5m"
+	Resolution1h  Resolution = "1h"
+)
+
+// RollupResolutions 需要自动聚合的精度（从细到粗）
+var RollupResolutions = []Resolution{Resolution1m, Resolution5m, Resolution1h}
+
+// Duration 精度对应的时间桶长度，原始数据返回 0
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case Resolution1m:
+		return time.Minute
+	case Resolution5m:
+		return 5 * time.Minute
+	case Resolution1h:
+		return time.Hour
+	}
+	return 0
+}
+
+// ParseResolution 解析精度字符串
+func ParseResolution(s string) (Resolution, error) {
+	switch Resolution(s) {
+	case ResolutionRaw, Resolution1m, Resolution5m, Resolution1h:
+		return Resolution(s), nil
+	case "":
+		return "", nil
+	}
+	return "", errors.New("不支持的精度: " + s)
+}
+
+// AutoResolution 根据查询时间范围选择合适的精度
+func AutoResolution(start, end time.Time) Resolution {
+	d := end.Sub(start)
+	switch {
+	case d <= 6*time.Hour:
+		return ResolutionRaw
+	case d <= 48*time.Hour:
+		return Resolution1m
+	case d <= 14*24*time.Hour:
+		return Resolution5m
+	}
+	return Resolution1h
+}
+
+// Aggregator 聚合数据的取值方式
+type Aggregator string
+
+const (
+	AggregatorAvg Aggregator = "avg"
+	AggregatorMin Aggregator = "min"
+	AggregatorMax Aggregator = "max"
+	AggregatorP95 Aggregator = "p95"
+)
+
+// Sample 单个指标样本
+type Sample struct {
+	ServerID  uint      `json:"serverId"`
+	Metric    string    `json:"metric"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// RollupPoint 一个时间桶内的聚合结果
+type RollupPoint struct {
+	ServerID   uint       `json:"serverId"`
+	Metric     string     `json:"metric"`
+	Resolution Resolution `json:"resolution"`
+	Timestamp  time.Time  `json:"timestamp"` // 桶起始时间
+	Min        float64    `json:"min"`
+	Max        float64    `json:"max"`
+	Avg        float64    `json:"avg"`
+	P95        float64    `json:"p95"`
+	Count      int        `json:"count"`
+}
+
+// Value 按聚合方式取值
+func (p RollupPoint) Value(agg Aggregator) float64 {
+	switch agg {
+	case AggregatorMin:
+		return p.Min
+	case AggregatorMax:
+		return p.Max
+	case AggregatorP95:
+		return p.P95
+	}
+	return p.Avg
+}
+
+// Query 查询条件
+type Query struct {
+	ServerIDs  []uint   // 为空表示全部服务器
+	Metrics    []string // 为空表示全部指标
+	Start      time.Time
+	End        time.Time
+	Resolution Resolution // 为空时按时间范围自动选择
+	Aggregator Aggregator // 聚合数据取值方式，默认 avg
+}
+
+// Point 数据点
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Series 时间序列
+type Series struct {
+	ServerID   uint       `json:"serverId"`
+	Metric     string     `json:"metric"`
+	Resolution Resolution `json:"resolution"`
+	Points     []Point    `json:"points"`
+}
+
+// MetricStore 时序存储接口
+type MetricStore interface {
+	// Name 存储后端名称
+	Name() string
+	// WriteSamples 批量写入原始样本
+	WriteSamples(samples []Sample) error
+	// WriteRollups 批量写入聚合结果
+	WriteRollups(points []RollupPoint) error
+	// Query 查询时间序列，Resolution 必须已确定
+	Query(q Query) ([]Series, error)
+	// DeleteBefore 删除指定服务器某精度下早于 before 的数据
+	DeleteBefore(serverID uint, res Resolution, before time.Time) (int64, error)
+	// Close 关闭存储
+	Close() error
+}
+
+// normalizeQuery 补全查询默认值
+func normalizeQuery(q Query) Query {
+	if q.End.IsZero() {
+		q.End = time.Now()
+	}
+	if q.Start.IsZero() {
+		q.Start = q.End.Add(-time.Hour)
+	}
+	if q.Resolution == "" {
+		q.Resolution = AutoResolution(q.Start, q.End)
+	}
+	if q.Aggregator == "" {
+		q.Aggregator = AggregatorAvg
+	}
+	return q
+}
+
+// Percentile 计算分位数（最近秩法），q 取值 0-1
+func Percentile(values []float64, q float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// ==================== 内置指标 ====================
+
+// 内置指标名称，对应 server.ServerMetric 字段
+const (
+	MetricCPUUsage     = "cpu_usage"
+	MetricCPUUser      = "cpu_user"
+	MetricCPUSystem    = "cpu_system"
+	MetricCPUIdle      = "cpu_idle"
+	MetricMemoryUsage  = "memory_usage"
+	MetricMemoryUsed   = "memory_used"
+	MetricMemoryFree   = "memory_free"
+	MetricMemoryCache  = "memory_cache"
+	MetricDiskUsage    = "disk_usage"
+	MetricDiskUsed     = "disk_used"
+	MetricDiskFree     = "disk_free"
+	MetricDiskIORead   = "disk_io_read"
+	MetricDiskIOWrite  = "disk_io_write"
+	MetricNetIn        = "net_in"
+	MetricNetOut       = "net_out"
+	MetricLoad1        = "load1"
+	MetricLoad5        = "load5"
+	MetricLoad15       = "load15"
+	MetricProcessCount = "process_count"
+)
+
+// builtinField 内置指标与 ServerMetric 字段的映射
+type builtinField struct {
+	name string
+	get  func(m *server.ServerMetric) float64
+	set  func(m *server.ServerMetric, v float64)
+}
+
+var builtinFields = []builtinField{
+	{MetricCPUUsage, func(m *server.ServerMetric) float64 { return m.CPUUsage }, func(m *server.ServerMetric, v float64) { m.CPUUsage = v }},
+	{MetricCPUUser, func(m *server.ServerMetric) float64 { return m.CPUUser }, func(m *server.ServerMetric, v float64) { m.CPUUser = v }},
+	{MetricCPUSystem, func(m *server.ServerMetric) float64 { return m.CPUSystem }, func(m *server.ServerMetric, v float64) { m.CPUSystem = v }},
+	{MetricCPUIdle, func(m *server.ServerMetric) float64 { return m.CPUIdle }, func(m *server.ServerMetric, v float64) { m.CPUIdle = v }},
+	{MetricMemoryUsage, func(m *server.ServerMetric) float64 { return m.MemoryUsage }, func(m *server.ServerMetric, v float64) { m.MemoryUsage = v }},
+	{MetricMemoryUsed, func(m *server.ServerMetric) float64 { return float64(m.MemoryUsed) }, func(m *server.ServerMetric, v float64) { m.MemoryUsed = uint64(v) }},
+	{MetricMemoryFree, func(m *server.ServerMetric) float64 { return float64(m.MemoryFree) }, func(m *server.ServerMetric, v float64) { m.MemoryFree = uint64(v) }},
+	{MetricMemoryCache, func(m *server.ServerMetric) float64 { return float64(m.MemoryCache) }, func(m *server.ServerMetric, v float64) { m.MemoryCache = uint64(v) }},
+	{MetricDiskUsage, func(m *server.ServerMetric) float64 { return m.DiskUsage }, func(m *server.ServerMetric, v float64) { m.DiskUsage = v }},
+	{MetricDiskUsed, func(m *server.ServerMetric) float64 { return float64(m.DiskUsed) }, func(m *server.ServerMetric, v float64) { m.DiskUsed = uint64(v) }},
+	{MetricDiskFree, func(m *server.ServerMetric) float64 { return float64(m.DiskFree) }, func(m *server.ServerMetric, v float64) { m.DiskFree = uint64(v) }},
+	{MetricDiskIORead, func(m *server.ServerMetric) float64 { return float64(m.DiskIORead) }, func(m *server.ServerMetric, v float64) { m.DiskIORead = uint64(v) }},
+	{MetricDiskIOWrite, func(m *server.ServerMetric) float64 { return float64(m.DiskIOWrite) }, func(m *server.ServerMetric, v float64) { m.DiskIOWrite = uint64(v) }},
+	{MetricNetIn, func(m *server.ServerMetric) float64 { return float64(m.NetIn) }, func(m *server.ServerMetric, v float64) { m.NetIn = uint64(v) }},
+	{MetricNetOut, func(m *server.ServerMetric) float64 { return float64(m.NetOut) }, func(m *server.ServerMetric, v float64) { m.NetOut = uint64(v) }},
+	{MetricLoad1, func(m *server.ServerMetric) float64 { return m.Load1 }, func(m *server.ServerMetric, v float64) { m.Load1 = v }},
+	{MetricLoad5, func(m *server.ServerMetric) float64 { return m.Load5 }, func(m *server.ServerMetric, v float64) { m.Load5 = v }},
+	{MetricLoad15, func(m *server.ServerMetric) float64 { return m.Load15 }, func(m *server.ServerMetric, v float64) { m.Load15 = v }},
+	{MetricProcessCount, func(m *server.ServerMetric) float64 { return float64(m.ProcessCount) }, func(m *server.ServerMetric, v float64) { m.ProcessCount = int(v) }},
+}
+
+// BuiltinMetricNames 返回所有内置指标名称
+func BuiltinMetricNames() []string {
+	names := make([]string, 0, len(builtinFields))
+	for _, f := range builtinFields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// IsBuiltinMetric 是否为内置指标
+func IsBuiltinMetric(name string) bool {
+	for _, f := range builtinFields {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SamplesFromServerMetric 将一条宽表指标拆分为样本
+func SamplesFromServerMetric(m *server.ServerMetric) []Sample {
+	ts := m.CreatedAt
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	samples := make([]Sample, 0, len(builtinFields))
+	for _, f := range builtinFields {
+		samples = append(samples, Sample{
+			ServerID:  m.ServerID,
+			Metric:    f.name,
+			Timestamp: ts,
+			Value:     f.get(m),
+		})
+	}
+	return samples
+}
+
+// ServerMetricsFromSeries 将同一服务器的多个序列按时间点合并为宽表指标
+// 非内置指标会被忽略，结果按时间升序排列
+func ServerMetricsFromSeries(serverID uint, series []Series) []server.ServerMetric {
+	byTime := make(map[int64]*server.ServerMetric)
+	for _, s := range series {
+		if s.ServerID != serverID {
+			continue
+		}
+		var field *builtinField
+		for i := range builtinFields {
+			if builtinFields[i].name == s.Metric {
+				field = &builtinFields[i]
+				break
+			}
+		}
+		if field == nil {
+			continue
+		}
+		for _, p := range s.Points {
+			key := p.Timestamp.UnixMilli()
+			m, ok := byTime[key]
+			if !ok {
+				m = &server.ServerMetric{ServerID: serverID, CreatedAt: p.Timestamp}
+				byTime[key] = m
+			}
+			field.set(m, p.Value)
+		}
+	}
+
+	result := make([]server.ServerMetric, 0, len(byTime))
+	for _, m := range byTime {
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
@@ -0,0 +1,298 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TSDBStore 嵌入式磁盘时序存储
+//
+// 数据按 服务器/精度/UTC日期 分块追加写入:
+//
+//	<dir>/<serverID>/<resolution>/<20060102>.blk
+//
+// 保留策略以整块为单位删除，查询只读取时间范围覆盖的数据块。
+type TSDBStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+const tsdbBlockSuffix = ".blk"
+
+// NewTSDBStore 创建 TSDB 存储
+func NewTSDBStore(dir string) (*TSDBStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建TSDB目录失败: %w", err)
+	}
+	return &TSDBStore{dir: dir}, nil
+}
+
+// Name 存储后端名称
+func (s *TSDBStore) Name() string {
+	return "tsdb"
+}
+
+// WriteSamples 追加写入原始样本
+func (s *TSDBStore) WriteSamples(samples []Sample) error {
+	blocks := make(map[string]*bytes.Buffer)
+	for _, sample := range samples {
+		path := s.blockPath(sample.ServerID, ResolutionRaw, sample.Timestamp)
+		buf, ok := blocks[path]
+		if !ok {
+			buf = &bytes.Buffer{}
+			blocks[path] = buf
+		}
+		encodeRecord(buf, sample.Metric, sample.Timestamp, sample.Value)
+	}
+	return s.appendBlocks(blocks)
+}
+
+// WriteRollups 追加写入聚合数据
+func (s *TSDBStore) WriteRollups(points []RollupPoint) error {
+	blocks := make(map[string]*bytes.Buffer)
+	for _, p := range points {
+		path := s.blockPath(p.ServerID, p.Resolution, p.Timestamp)
+		buf, ok := blocks[path]
+		if !ok {
+			buf = &bytes.Buffer{}
+			blocks[path] = buf
+		}
+		encodeRecord(buf, p.Metric, p.Timestamp, p.Min, p.Max, p.Avg, p.P95, float64(p.Count))
+	}
+	return s.appendBlocks(blocks)
+}
+
+// Query 查询时间序列
+func (s *TSDBStore) Query(q Query) ([]Series, error) {
+	q = normalizeQuery(q)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	serverIDs := q.ServerIDs
+	if len(serverIDs) == 0 {
+		ids, err := s.listServers()
+		if err != nil {
+			return nil, err
+		}
+		serverIDs = ids
+	}
+
+	metricSet := make(map[string]bool, len(q.Metrics))
+	for _, m := range q.Metrics {
+		metricSet[m] = true
+	}
+
+	valueCount := 1
+	if q.Resolution != ResolutionRaw {
+		valueCount = 5
+	}
+
+	var result []Series
+	for _, serverID := range serverIDs {
+		index := make(map[string]int)
+		var series []Series
+
+		for day := dayStart(q.Start); !day.After(q.End); day = day.Add(24 * time.Hour) {
+			data, err := os.ReadFile(s.blockPath(serverID, q.Resolution, day))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			err = decodeRecords(data, valueCount, func(metric string, ts time.Time, values []float64) {
+				if len(metricSet) > 0 && !metricSet[metric] {
+					return
+				}
+				if ts.Before(q.Start) || ts.After(q.End) {
+					return
+				}
+				idx, ok := index[metric]
+				if !ok {
+					idx = len(series)
+					index[metric] = idx
+					series = append(series, Series{ServerID: serverID, Metric: metric, Resolution: q.Resolution})
+				}
+
+				value := values[0]
+				if valueCount > 1 {
+					p := RollupPoint{Min: values[0], Max: values[1], Avg: values[2], P95: values[3]}
+					value = p.Value(q.Aggregator)
+				}
+				series[idx].Points = append(series[idx].Points, Point{Timestamp: ts, Value: value})
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for i := range series {
+			points := series[i].Points
+			sort.SliceStable(points, func(a, b int) bool {
+				return points[a].Timestamp.Before(points[b].Timestamp)
+			})
+		}
+		result = append(result, series...)
+	}
+
+	return result, nil
+}
+
+// DeleteBefore 删除整块早于 before 的数据，返回删除的数据块数
+func (s *TSDBStore) DeleteBefore(serverID uint, res Resolution, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dir, strconv.FormatUint(uint64(serverID), 10), string(res))
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, tsdbBlockSuffix) {
+			continue
+		}
+		day, err := time.ParseInLocation("20060102", strings.TrimSuffix(name, tsdbBlockSuffix), time.UTC)
+		if err != nil {
+			continue
+		}
+		if !day.Add(24 * time.Hour).After(before) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return deleted, err
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Close 关闭存储
+func (s *TSDBStore) Close() error {
+	return nil
+}
+
+// blockPath 数据块路径
+func (s *TSDBStore) blockPath(serverID uint, res Resolution, ts time.Time) string {
+	return filepath.Join(s.dir,
+		strconv.FormatUint(uint64(serverID), 10),
+		string(res),
+		ts.UTC().Format("20060102")+tsdbBlockSuffix)
+}
+
+// appendBlocks 将缓冲区追加到对应数据块
+func (s *TSDBStore) appendBlocks(blocks map[string]*bytes.Buffer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for path, buf := range blocks {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(buf.Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listServers 列出已有数据的服务器
+func (s *TSDBStore) listServers() ([]uint, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseUint(entry.Name(), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// dayStart UTC 日期起点
+func dayStart(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// encodeRecord 编码一条记录: [名称长度 1B][名称][时间戳 8B][值 8B * n]
+func encodeRecord(buf *bytes.Buffer, metric string, ts time.Time, values ...float64) {
+	if len(metric) > math.MaxUint8 {
+		metric = metric[:math.MaxUint8]
+	}
+	buf.WriteByte(byte(len(metric)))
+	buf.WriteString(metric)
+
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(ts.UnixMilli()))
+	buf.Write(b[:])
+	for _, v := range values {
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+		buf.Write(b[:])
+	}
+}
+
+// decodeRecords 顺序解码数据块，末尾不完整的记录（写入中断）会被忽略
+func decodeRecords(data []byte, valueCount int, fn func(metric string, ts time.Time, values []float64)) error {
+	r := bytes.NewReader(data)
+	values := make([]float64, valueCount)
+	var b [8]byte
+
+	for {
+		n, err := r.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := make([]byte, n)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil
+		}
+		ts := time.UnixMilli(int64(binary.LittleEndian.Uint64(b[:])))
+
+		for i := 0; i < valueCount; i++ {
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return nil
+			}
+			values[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[:]))
+		}
+		fn(string(name), ts, values)
+	}
+}
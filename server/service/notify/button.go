@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"yunwei/config"
+	"yunwei/service/ai/decision"
+	"yunwei/service/chatops"
+	"yunwei/service/detector"
+	executorService "yunwei/service/executor"
+)
+
+// Button 消息按钮，点击后由 ChatOps 回调执行签名的动作。
+// Telegram 为内联按钮，钉钉为以用户身份发回机器人的消息链接，飞书为卡片按钮（需以应用机器人发送）
+type Button struct {
+	Label string
+	Data  string // 签名后的动作
+	Style string // primary, danger，飞书按钮样式
+}
+
+// newButtons 签名各按钮的动作，未启用 ChatOps 时返回空
+func newButtons(specs ...buttonSpec) []Button {
+	if !chatops.Enabled() {
+		return nil
+	}
+	buttons := make([]Button, 0, len(specs))
+	for _, s := range specs {
+		data, err := s.action.Sign()
+		if err != nil {
+			return nil
+		}
+		buttons = append(buttons, Button{Label: s.label, Data: data, Style: s.style})
+	}
+	return buttons
+}
+
+type buttonSpec struct {
+	label  string
+	style  string
+	action chatops.Action
+}
+
+// silenceLabel 静默按钮的文字，如「静默1小时」
+func silenceLabel() string {
+	minutes := config.CONFIG.ChatOps.SilenceMinutes
+	if minutes <= 0 {
+		minutes = 60
+	}
+	if minutes%60 == 0 {
+		return fmt.Sprintf("静默%d小时", minutes/60)
+	}
+	return fmt.Sprintf("静默%d分钟", minutes)
+}
+
+// alertButtons 未恢复的事件或告警可确认和静默，已确认的只能静默
+func alertButtons(kind string, id uint, status string) []Button {
+	if id == 0 {
+		return nil
+	}
+	silence := buttonSpec{label: silenceLabel(), action: chatops.NewAction(chatops.VerbSilence, kind, id)}
+	switch status {
+	case detector.AlertStatusFiring:
+		return newButtons(
+			buttonSpec{label: "确认", style: "primary", action: chatops.NewAction(chatops.VerbAck, kind, id)},
+			silence,
+		)
+	case detector.AlertStatusAcknowledged:
+		return newButtons(silence)
+	}
+	return nil
+}
+
+// NewApprovalNotification 待审批的 AI 决策（chatops.KindDecision）或执行记录（chatops.KindExecution），
+// 启用 ChatOps 时带批准和拒绝按钮
+func NewApprovalNotification(kind string, id uint, title, content string) *Notification {
+	n := NewMessage(title, content)
+	n.Kind = "approval"
+	n.Level = detector.AlertLevelWarning
+	n.Buttons = newButtons(
+		buttonSpec{label: "批准", style: "primary", action: chatops.NewAction(chatops.VerbApprove, kind, id)},
+		buttonSpec{label: "拒绝", style: "danger", action: chatops.NewAction(chatops.VerbReject, kind, id)},
+	)
+	return n
+}
+
+// NewDecisionApproval 待审批 AI 决策的通知，正文为结论摘要和拟执行的命令
+func NewDecisionApproval(dec *decision.AIDecision, serverName string) *Notification {
+	var b strings.Builder
+	fmt.Fprintf(&b, "服务器: %s\n%s", serverName, dec.Summary)
+	writeCommands(&b, dec.Commands)
+	return NewApprovalNotification(chatops.KindDecision, dec.ID, fmt.Sprintf("AI 决策 #%d 待审批", dec.ID), b.String())
+}
+
+// NewExecutionApproval 待审批执行记录的通知，reason 为需要审批的原因
+func NewExecutionApproval(record *executorService.ExecutionRecord, serverName, reason string) *Notification {
+	var b strings.Builder
+	fmt.Fprintf(&b, "服务器: %s\n来源: %s", serverName, record.Source)
+	if reason != "" {
+		b.WriteString("\n" + reason)
+	}
+	writeCommands(&b, record.Commands)
+	return NewApprovalNotification(chatops.KindExecution, record.ID, fmt.Sprintf("执行记录 #%d 待审批", record.ID), b.String())
+}
+
+// writeCommands 列出 JSON 数组形式的命令
+func writeCommands(b *strings.Builder, commandsJSON string) {
+	var commands []string
+	if json.Unmarshal([]byte(commandsJSON), &commands) != nil || len(commands) == 0 {
+		return
+	}
+	b.WriteString("\n\n命令:")
+	for _, cmd := range commands {
+		b.WriteString("\n" + cmd)
+	}
+}
+
+// telegramKeyboard Telegram 内联键盘，按钮排成一行
+func telegramKeyboard(buttons []Button) map[string]interface{} {
+	row := make([]map[string]string, 0, len(buttons))
+	for _, b := range buttons {
+		row = append(row, map[string]string{"text": b.Label, "callback_data": b.Data})
+	}
+	return map[string]interface{}{"inline_keyboard": [][]map[string]string{row}}
+}
+
+// dingtalkLinks 钉钉消息链接：点击后以用户身份向机器人发送「/act 动作」，由机器人回调执行
+func dingtalkLinks(buttons []Button) string {
+	links := make([]string, 0, len(buttons))
+	for _, b := range buttons {
+		links = append(links, fmt.Sprintf("[%s](dtmd://dingtalkclient/sendMessage?content=%s)", b.Label, url.QueryEscape("/act "+b.Data)))
+	}
+	return strings.Join(links, " | ")
+}
+
+// feishuActions 飞书卡片的按钮组
+func feishuActions(buttons []Button) map[string]interface{} {
+	actions := make([]map[string]interface{}, 0, len(buttons))
+	for _, b := range buttons {
+		style := b.Style
+		if style == "" {
+			style = "default"
+		}
+		actions = append(actions, map[string]interface{}{
+			"tag":   "button",
+			"text":  map[string]string{"tag": "plain_text", "content": b.Label},
+			"type":  style,
+			"value": map[string]string{"action": b.Data},
+		})
+	}
+	return map[string]interface{}{"tag": "action", "actions": actions}
+}
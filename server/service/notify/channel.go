@@ -0,0 +1,126 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"yunwei/service/detector"
+	"yunwei/service/oncall"
+	"yunwei/service/routing"
+)
+
+// Channel 通知通道插件。Send 只负责按通道格式渲染并写入发件箱，不等待发送结果
+type Channel interface {
+	Type() string
+	Send(n *Notification) error
+}
+
+// ChannelFactory 按通道配置创建通道，配置有误时返回错误
+type ChannelFactory func(cfg routing.Channel) (Channel, error)
+
+// ErrSkipped 通道不接收此类通知，如 PagerDuty 不接收巡检报告，不计为发送失败
+var ErrSkipped = errors.New("通道不接收此类通知")
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]ChannelFactory)
+)
+
+// RegisterChannel 注册通道类型，与内置类型同名时替换内置实现。
+// 注册后接收人和通道实例即可使用该类型，字段由 factory 自行校验
+func RegisterChannel(typ string, factory ChannelFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[typ] = factory
+	routing.RegisterChannelType(typ)
+}
+
+// NewChannel 按配置创建通道，引用通道实例的配置需经 Registry.Resolve 解析
+func NewChannel(cfg routing.Channel) (Channel, error) {
+	if cfg.Ref != "" {
+		return nil, fmt.Errorf("通道引用 %s 未解析", cfg.Ref)
+	}
+	factoriesMu.RLock()
+	factory, ok := factories[cfg.Type]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的通道类型: %s", cfg.Type)
+	}
+	return factory(cfg)
+}
+
+// ChannelTypes 已注册的通道类型
+func ChannelTypes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	types := make([]string, 0, len(factories))
+	for typ := range factories {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Notification 发给各通道的一条通知。Data 不为空时各通道按通知模板渲染正文，
+// 否则按通道格式拼接 Title 和 Content
+type Notification struct {
+	Kind     string // alert, patrol, message, approval，写入通知记录
+	TenantID string
+	Title    string
+	Content  string // 纯文本正文，模板通知为 text 模板的渲染结果
+	Level    detector.AlertLevel
+	Data     *TemplateData
+	Contacts []oncall.Contact // 被通知的值班人
+	Buttons  []Button         // 支持交互的通道附带的操作按钮
+}
+
+// NewMessage 普通消息
+func NewMessage(title, content string) *Notification {
+	return &Notification{Kind: "message", Title: title, Content: content, Level: detector.AlertLevelInfo}
+}
+
+func newTemplateNotification(kind string, level detector.AlertLevel, data *TemplateData, to []oncall.Contact) *Notification {
+	title, text := GetTemplateService().RenderText(data.TenantID, data.Event, data)
+	return &Notification{
+		Kind:     kind,
+		TenantID: data.TenantID,
+		Title:    title,
+		Content:  text,
+		Level:    level,
+		Data:     data,
+		Contacts: to,
+	}
+}
+
+// body 渲染通道正文，普通消息按 format 拼接标题和正文
+func (n *Notification) body(channel, format string) string {
+	if n.Data == nil {
+		return fmt.Sprintf(format, n.Title, n.Content)
+	}
+	_, body := GetTemplateService().Render(n.TenantID, n.Data.Event, channel, n.Data)
+	return body
+}
+
+// mobiles 被通知人的手机号，用于钉钉、企业微信 @
+func (n *Notification) mobiles() []string {
+	var out []string
+	for _, c := range n.Contacts {
+		if c.Phone != "" {
+			out = append(out, c.Phone)
+		}
+	}
+	return out
+}
+
+// emails 被通知人的邮箱，邮件抄送
+func (n *Notification) emails() []string {
+	var out []string
+	for _, c := range n.Contacts {
+		if c.Email != "" {
+			out = append(out, c.Email)
+		}
+	}
+	return out
+}
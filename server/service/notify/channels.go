@@ -0,0 +1,399 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	patrolModel "yunwei/model/patrol"
+	"yunwei/service/detector"
+	"yunwei/service/mail"
+	"yunwei/service/oncall"
+	"yunwei/service/outbox"
+	"yunwei/service/routing"
+)
+
+func init() {
+	RegisterChannel(routing.ChannelTelegram, newTelegramChannel)
+	RegisterChannel(routing.ChannelWeChat, newWeChatChannel)
+	RegisterChannel(routing.ChannelDingTalk, newDingTalkChannel)
+	RegisterChannel(routing.ChannelFeishu, newFeishuChannel)
+	RegisterChannel(routing.ChannelEmail, newEmailChannel)
+	RegisterChannel(routing.ChannelSlack, newSlackChannel)
+	RegisterChannel(routing.ChannelTeams, newTeamsChannel)
+	RegisterChannel(routing.ChannelWebhook, newWebhookChannel)
+	RegisterChannel(routing.ChannelPagerDuty, newPagerDutyChannel)
+}
+
+// ==================== Telegram ====================
+
+type telegramChannel struct {
+	token  string
+	chatID string
+}
+
+func newTelegramChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &telegramChannel{token: cfg.Token, chatID: cfg.ChatID}, nil
+}
+
+func (t *telegramChannel) Type() string { return routing.ChannelTelegram }
+
+// Send 带按钮的消息以内联键盘发送，不参与摘要合并
+func (t *telegramChannel) Send(n *Notification) error {
+	msg := &outbox.Message{
+		Channel: outbox.ChannelTelegram,
+		Target:  t.chatID,
+		Secret:  t.token,
+		Format:  "Markdown",
+		Kind:    n.Kind,
+		Title:   n.Title,
+		Content: n.body(routing.ChannelTelegram, "*%s*\n\n%s"),
+		Digest:  true,
+	}
+	if len(n.Buttons) > 0 {
+		data, err := json.Marshal(map[string]interface{}{
+			"chat_id":      t.chatID,
+			"text":         msg.Content,
+			"parse_mode":   msg.Format,
+			"reply_markup": telegramKeyboard(n.Buttons),
+		})
+		if err != nil {
+			return err
+		}
+		msg.Payload = string(data)
+		msg.Digest = false
+	}
+	return outbox.Enqueue(msg)
+}
+
+// ==================== 企业微信 ====================
+
+type wechatChannel struct {
+	webhook string
+}
+
+func newWeChatChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &wechatChannel{webhook: cfg.Webhook}, nil
+}
+
+func (w *wechatChannel) Type() string { return routing.ChannelWeChat }
+
+// Send 群机器人无法单独发给某人，按手机号 @ 被通知人；
+// markdown 消息不支持 @手机号，发件箱会另发一条文本消息提醒
+func (w *wechatChannel) Send(n *Notification) error {
+	return outbox.Enqueue(&outbox.Message{
+		Channel:  outbox.ChannelWeChat,
+		Target:   w.webhook,
+		Kind:     n.Kind,
+		Title:    n.Title,
+		Content:  n.body(routing.ChannelWeChat, "## %s\n\n%s"),
+		Mentions: strings.Join(n.mobiles(), ","),
+		Digest:   true,
+	})
+}
+
+// ==================== 钉钉 ====================
+
+type dingtalkChannel struct {
+	webhook string
+}
+
+func newDingTalkChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &dingtalkChannel{webhook: cfg.Webhook}, nil
+}
+
+func (d *dingtalkChannel) Type() string { return routing.ChannelDingTalk }
+
+// Send 钉钉要求正文中同时出现 @手机号，由发件箱补上。按钮以消息链接附在正文末尾，
+// 需要机器人开启消息接收并把地址指向 ChatOps 回调
+func (d *dingtalkChannel) Send(n *Notification) error {
+	content := n.body(routing.ChannelDingTalk, "### %s\n\n%s")
+	if len(n.Buttons) > 0 {
+		content += "\n\n" + dingtalkLinks(n.Buttons)
+	}
+	return outbox.Enqueue(&outbox.Message{
+		Channel:  outbox.ChannelDingTalk,
+		Target:   d.webhook,
+		Kind:     n.Kind,
+		Title:    n.Title,
+		Content:  content,
+		Mentions: strings.Join(n.mobiles(), ","),
+		Digest:   len(n.Buttons) == 0,
+	})
+}
+
+// ==================== 飞书 ====================
+
+type feishuChannel struct {
+	webhook string
+	// 应用机器人，设置后通过开放平台接口发到 chatID 所在的群
+	appID     string
+	appSecret string
+	chatID    string
+}
+
+func newFeishuChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &feishuChannel{webhook: cfg.Webhook, appID: cfg.AppID, appSecret: cfg.AppSecret, chatID: cfg.ChatID}, nil
+}
+
+func (f *feishuChannel) Type() string { return routing.ChannelFeishu }
+
+// Send 以卡片的 markdown 元素发送。自定义机器人发送的卡片不能回调，
+// 只有应用机器人的消息附带按钮
+func (f *feishuChannel) Send(n *Notification) error {
+	msg := &outbox.Message{
+		Channel: outbox.ChannelFeishu,
+		Target:  f.webhook,
+		Kind:    n.Kind,
+		Title:   n.Title,
+		Content: n.body(routing.ChannelFeishu, "**%s**\n\n%s"),
+		Digest:  true,
+	}
+	if f.appID == "" {
+		return outbox.Enqueue(msg)
+	}
+
+	msg.Target, msg.Secret = f.chatID, f.appID+":"+f.appSecret
+	if len(n.Buttons) > 0 {
+		data, err := json.Marshal(map[string]interface{}{
+			"msg_type": "interactive",
+			"card": map[string]interface{}{
+				"elements": []map[string]interface{}{
+					{"tag": "markdown", "content": msg.Content},
+					feishuActions(n.Buttons),
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		msg.Payload = string(data)
+		msg.Digest = false
+	}
+	return outbox.Enqueue(msg)
+}
+
+// ==================== Slack ====================
+
+type slackChannel struct {
+	webhook string
+}
+
+func newSlackChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &slackChannel{webhook: cfg.Webhook}, nil
+}
+
+func (s *slackChannel) Type() string { return routing.ChannelSlack }
+
+func (s *slackChannel) Send(n *Notification) error {
+	return outbox.Enqueue(&outbox.Message{
+		Channel: outbox.ChannelSlack,
+		Target:  s.webhook,
+		Kind:    n.Kind,
+		Title:   n.Title,
+		Content: n.body(routing.ChannelSlack, "*%s*\n\n%s"),
+		Digest:  true,
+	})
+}
+
+// ==================== Microsoft Teams ====================
+
+type teamsChannel struct {
+	webhook string
+}
+
+func newTeamsChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &teamsChannel{webhook: cfg.Webhook}, nil
+}
+
+func (t *teamsChannel) Type() string { return routing.ChannelTeams }
+
+// Send 标题作为卡片标题，卡片颜色与邮件页眉一致
+func (t *teamsChannel) Send(n *Notification) error {
+	color := mail.ColorInfo
+	if n.Data != nil {
+		color = emailColor(n.Data)
+	}
+	return outbox.Enqueue(&outbox.Message{
+		Channel: outbox.ChannelTeams,
+		Target:  t.webhook,
+		Format:  color,
+		Kind:    n.Kind,
+		Title:   n.Title,
+		Content: n.body(routing.ChannelTeams, "%[2]s"),
+		Digest:  true,
+	})
+}
+
+// ==================== 自定义 Webhook ====================
+
+type webhookChannel struct {
+	url    string
+	secret string
+}
+
+func newWebhookChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &webhookChannel{url: cfg.Webhook, secret: cfg.Secret}, nil
+}
+
+func (w *webhookChannel) Type() string { return routing.ChannelWebhook }
+
+// WebhookPayload 自定义 Webhook 的请求体，content 按 webhook 通道模板渲染（默认为纯文本模板）
+type WebhookPayload struct {
+	Kind      string                    `json:"kind"`
+	Event     string                    `json:"event,omitempty"`
+	TenantID  string                    `json:"tenantId,omitempty"`
+	Level     string                    `json:"level,omitempty"`
+	Title     string                    `json:"title"`
+	Content   string                    `json:"content"`
+	Incident  *detector.Incident        `json:"incident,omitempty"`
+	Alerts    []TemplateAlert           `json:"alerts,omitempty"`
+	Alert     *TemplateAlert            `json:"alert,omitempty"`
+	Patrol    *patrolModel.PatrolRecord `json:"patrol,omitempty"`
+	Contacts  []oncall.Contact          `json:"contacts,omitempty"`
+	Timestamp time.Time                 `json:"timestamp"`
+}
+
+// Send 请求体带完整的结构化数据；配置了密钥时发件箱按 HMAC-SHA256 签名
+func (w *webhookChannel) Send(n *Notification) error {
+	payload := WebhookPayload{
+		Kind:      n.Kind,
+		TenantID:  n.TenantID,
+		Level:     string(n.Level),
+		Title:     n.Title,
+		Content:   n.body(routing.ChannelWebhook, "%[2]s"),
+		Contacts:  n.Contacts,
+		Timestamp: time.Now(),
+	}
+	if n.Data != nil {
+		payload.Event = n.Data.Event
+		payload.Incident = n.Data.Incident
+		payload.Alerts = n.Data.Alerts
+		payload.Alert = n.Data.Alert
+		payload.Patrol = n.Data.Patrol
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(&outbox.Message{
+		Channel: outbox.ChannelWebhook,
+		Target:  w.url,
+		Secret:  w.secret,
+		Kind:    n.Kind,
+		Title:   n.Title,
+		Content: n.Content,
+		Payload: string(data),
+	})
+}
+
+// ==================== PagerDuty ====================
+
+type pagerDutyChannel struct {
+	url        string
+	routingKey string
+}
+
+func newPagerDutyChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	url := cfg.Webhook
+	if url == "" {
+		url = outbox.PagerDutyEventsURL
+	}
+	return &pagerDutyChannel{url: url, routingKey: cfg.RoutingKey}, nil
+}
+
+func (p *pagerDutyChannel) Type() string { return routing.ChannelPagerDuty }
+
+// pagerDutySeverity 告警级别对应的 PagerDuty severity
+var pagerDutySeverity = map[detector.AlertLevel]string{
+	detector.AlertLevelInfo:      "info",
+	detector.AlertLevelWarning:   "warning",
+	detector.AlertLevelCritical:  "error",
+	detector.AlertLevelEmergency: "critical",
+}
+
+// Send 只发送事件和单条告警，巡检报告和普通消息不适合触发 PagerDuty 事件。
+// 同一事件使用相同的 dedup_key，事件确认和恢复时相应地 acknowledge、resolve
+func (p *pagerDutyChannel) Send(n *Notification) error {
+	if n.Data == nil || (n.Data.Incident == nil && n.Data.Alert == nil) {
+		return ErrSkipped
+	}
+
+	event := map[string]interface{}{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+	}
+	source := "yunwei"
+	if n.Data.Incident != nil {
+		event["dedup_key"] = fmt.Sprintf("yunwei-incident-%d", n.Data.Incident.ID)
+		switch detector.AlertEvent(n.Data.Event) {
+		case detector.AlertEventResolved:
+			event["event_action"] = "resolve"
+		case detector.AlertEventAcknowledged:
+			event["event_action"] = "acknowledge"
+		}
+		if len(n.Data.Alerts) > 0 && n.Data.Alerts[0].Server != "" {
+			source = n.Data.Alerts[0].Server
+		}
+	} else {
+		event["dedup_key"] = fmt.Sprintf("yunwei-alert-%d", n.Data.Alert.ID)
+		if n.Data.Alert.Server != "" {
+			source = n.Data.Alert.Server
+		}
+	}
+	if event["event_action"] == "trigger" {
+		severity := pagerDutySeverity[n.Level]
+		if severity == "" {
+			severity = "warning"
+		}
+		summary := []rune(n.Title)
+		if len(summary) > 1000 {
+			summary = summary[:1000]
+		}
+		event["payload"] = map[string]interface{}{
+			"summary":        string(summary),
+			"source":         source,
+			"severity":       severity,
+			"timestamp":      time.Now().Format(time.RFC3339),
+			"custom_details": map[string]string{"content": n.body(routing.ChannelPagerDuty, "%[2]s")},
+		}
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(&outbox.Message{
+		Channel: outbox.ChannelPagerDuty,
+		Target:  p.url,
+		Kind:    n.Kind,
+		Title:   n.Title,
+		Content: n.Content,
+		Payload: string(data),
+	})
+}
@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"html/template"
+	"strings"
+
+	"yunwei/service/detector"
+	"yunwei/service/mail"
+	"yunwei/service/outbox"
+	"yunwei/service/routing"
+)
+
+// emailChannel 邮件通道，经发件箱使用配置文件 smtp 段的服务器发送，正文同时带 HTML 和纯文本
+type emailChannel struct {
+	to []string
+}
+
+func newEmailChannel(cfg routing.Channel) (Channel, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &emailChannel{to: cfg.To}, nil
+}
+
+func (e *emailChannel) Type() string { return routing.ChannelEmail }
+
+// Send 模板通知按邮件模板渲染 HTML 正文，纯文本部分使用 text 模板；被通知的值班人加入抄送
+func (e *emailChannel) Send(n *Notification) error {
+	title := n.Title
+	var html string
+	var err error
+	if n.Data == nil {
+		html, err = mail.Render(messageTemplate, title, mail.ColorInfo, n.Content)
+	} else {
+		var body string
+		title, body = GetTemplateService().Render(n.TenantID, n.Data.Event, routing.ChannelEmail, n.Data)
+		html, err = mail.RenderPage(title, emailColor(n.Data), template.HTML(body))
+	}
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(&outbox.Message{
+		Channel:  outbox.ChannelEmail,
+		Target:   strings.Join(e.to, ","),
+		Mentions: strings.Join(n.emails(), ","),
+		Kind:     n.Kind,
+		Title:    title,
+		Content:  n.Content,
+		HTML:     html,
+	})
+}
+
+// emailColor 邮件页眉颜色：恢复为绿色，确认为蓝色，其他按级别
+func emailColor(data *TemplateData) string {
+	switch {
+	case data.Incident != nil:
+		switch detector.AlertEvent(data.Event) {
+		case detector.AlertEventResolved:
+			return mail.ColorSuccess
+		case detector.AlertEventAcknowledged:
+			return mail.ColorInfo
+		}
+		return levelColor(data.Incident.Level)
+	case data.Alert != nil:
+		return data.Alert.Color
+	case data.Patrol != nil:
+		switch {
+		case data.Patrol.CriticalCount > 0 || data.Patrol.OfflineServers > 0:
+			return mail.ColorDanger
+		case data.Patrol.WarningCount > 0:
+			return mail.ColorWarning
+		}
+		return mail.ColorSuccess
+	}
+	return mail.ColorInfo
+}
+
+func levelColor(level detector.AlertLevel) string {
+	switch level {
+	case detector.AlertLevelCritical, detector.AlertLevelEmergency:
+		return mail.ColorDanger
+	case detector.AlertLevelWarning:
+		return mail.ColorWarning
+	}
+	return mail.ColorInfo
+}
+
+// ==================== 邮件模板 ====================
+
+var messageTemplate = template.Must(template.New("message").Parse(
+	`<div style="white-space:pre-wrap">{{.}}</div>`))
+
+const alertEmailBody = `<table style="border-collapse:collapse;width:100%">
+<tr><td style="padding:4px 0;color:#8f959e;width:80px">级别</td><td style="color:{{.Alert.Color}};font-weight:600">{{.Alert.Level}}</td></tr>
+{{if .Alert.Server}}<tr><td style="padding:4px 0;color:#8f959e">服务器</td><td>{{.Alert.Server}}</td></tr>{{end}}
+<tr><td style="padding:4px 0;color:#8f959e">时间</td><td>{{datetime .Alert.FiredAt}}</td></tr>
+<tr><td style="padding:4px 0;color:#8f959e;vertical-align:top">详情</td><td style="white-space:pre-wrap">{{.Alert.Message}}</td></tr>
+</table>`
+
+const incidentEmailBody = `<p style="margin:0 0 12px">
+事件 #{{.Incident.ID}}，触发于 {{datetime .Incident.FiredAt}}{{if and (eq .Event "resolved") .Duration}}，持续 {{.Duration}}{{end}}，共 {{.AlertCount}} 条告警
+</p>
+<table style="border-collapse:collapse;width:100%;font-size:13px">
+<tr style="background:#f5f6f8;text-align:left">
+<th style="padding:6px 8px">告警</th><th style="padding:6px 8px">级别</th><th style="padding:6px 8px">服务器</th><th style="padding:6px 8px">触发时间</th>
+</tr>
+{{range .Alerts}}<tr style="border-top:1px solid #eee;vertical-align:top">
+<td style="padding:6px 8px"><div style="font-weight:600">{{.Title}}{{if gt .Occurrences 1}} ×{{.Occurrences}}{{end}}</div><div style="color:#646a73;white-space:pre-wrap">{{.Message}}</div></td>
+<td style="padding:6px 8px;color:{{.Color}}">{{.Level}}</td>
+<td style="padding:6px 8px">{{.Server}}</td>
+<td style="padding:6px 8px;white-space:nowrap">{{datetime .FiredAt}}</td>
+</tr>{{end}}
+</table>
+{{if .MoreAlerts}}<p style="color:#8f959e">另有 {{.MoreAlerts}} 条告警未列出</p>{{end}}
+{{if .Mentions}}<p>通知: {{join .Mentions " "}}</p>{{end}}`
+
+const patrolEmailBody = `<p style="margin:0 0 12px">类型: {{.Patrol.Type}}，耗时 {{.Patrol.Duration}}ms</p>
+<table style="border-collapse:collapse;font-size:13px;margin-bottom:12px">
+<tr><td style="padding:4px 16px 4px 0;color:#8f959e">服务器总数</td><td>{{.Patrol.TotalServers}}</td></tr>
+<tr><td style="padding:4px 16px 4px 0;color:#8f959e">在线</td><td style="color:#34c724">{{.Patrol.OnlineServers}}</td></tr>
+<tr><td style="padding:4px 16px 4px 0;color:#8f959e">离线</td><td style="color:#f54a45">{{.Patrol.OfflineServers}}</td></tr>
+<tr><td style="padding:4px 16px 4px 0;color:#8f959e">警告</td><td style="color:#ff8800">{{.Patrol.WarningCount}}</td></tr>
+<tr><td style="padding:4px 16px 4px 0;color:#8f959e">严重</td><td style="color:#f54a45">{{.Patrol.CriticalCount}}</td></tr>
+<tr><td style="padding:4px 16px 4px 0;color:#8f959e">告警</td><td>{{.Patrol.AlertCount}}</td></tr>
+</table>
+{{if .Patrol.Summary}}<h4 style="margin:12px 0 4px">摘要</h4><div style="white-space:pre-wrap">{{.Patrol.Summary}}</div>{{end}}
+{{if .Patrol.Suggestions}}<h4 style="margin:12px 0 4px">建议</h4><div style="white-space:pre-wrap">{{.Patrol.Suggestions}}</div>{{end}}
+{{if .Patrol.ReportURL}}<p><a href="{{.Patrol.ReportURL}}">查看完整报告</a></p>{{end}}`
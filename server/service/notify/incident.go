@@ -0,0 +1,41 @@
+package notify
+
+import (
+	"yunwei/service/chatops"
+	"yunwei/service/detector"
+	"yunwei/service/oncall"
+)
+
+// maxIncidentAlerts 单条事件通知中列出的告警数上限
+const maxIncidentAlerts = 10
+
+var incidentEventTitle = map[detector.AlertEvent]string{
+	detector.AlertEventFiring:       "🔥 告警",
+	detector.AlertEventRepeat:       "🔁 告警未处理",
+	detector.AlertEventAcknowledged: "👀 告警已确认",
+	detector.AlertEventResolved:     "✅ 告警已恢复",
+	detector.AlertEventEscalated:    "⏫ 告警升级",
+}
+
+// NotifyIncident 发送事件通知，实现 detector.AlertNotifier。
+// 任一通道发送成功即视为已通知，全部失败时返回错误以便重试
+func (n *MultiNotifier) NotifyIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert) error {
+	return n.Send(newIncidentNotification(event, incident, alerts, nil))
+}
+
+// PageIncident 通知值班人，实现 oncall.Pager。
+// 群机器人无法单独发给某人，消息仍发到群里，并按手机号 @ 被通知人（钉钉、企业微信）；
+// 邮件同时抄送被通知人
+func (n *MultiNotifier) PageIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert, to []oncall.Contact) error {
+	return n.Send(newIncidentNotification(event, incident, alerts, to))
+}
+
+func newIncidentNotification(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert, to []oncall.Contact) *Notification {
+	var mentions []string
+	for _, c := range to {
+		mentions = append(mentions, "@"+c.Name)
+	}
+	n := newTemplateNotification("alert", incident.Level, newIncidentData(event, incident, alerts, mentions), to)
+	n.Buttons = alertButtons(chatops.KindIncident, incident.ID, incident.Status)
+	return n
+}
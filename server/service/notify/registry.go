@@ -0,0 +1,280 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	patrolModel "yunwei/model/patrol"
+	"yunwei/service/detector"
+	"yunwei/service/oncall"
+	"yunwei/service/routing"
+
+	"gorm.io/gorm"
+)
+
+// registryCacheTTL 通道实例的缓存时间，其他节点上的修改最迟在此时间后生效
+const registryCacheTTL = 30 * time.Second
+
+// ChannelInstance 保存的通知通道实例。接收人按名称引用（{"ref": "名称"}），
+// 默认实例接收系统通知和未命中路由的事件
+type ChannelInstance struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID  string `json:"tenantId" gorm:"type:varchar(36);uniqueIndex:idx_notify_channels_tenant_name"` // 为空为全局通道，各租户都可引用
+	Name      string `json:"name" gorm:"type:varchar(64);not null;uniqueIndex:idx_notify_channels_tenant_name"`
+	Type      string `json:"type" gorm:"type:varchar(16);not null"`
+	Config    string `json:"config" gorm:"type:text"` // 通道参数(JSON)，字段同接收人的通知通道
+	IsDefault bool   `json:"isDefault"`
+	Enabled   bool   `json:"enabled" gorm:"default:true"`
+	Comment   string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (ChannelInstance) TableName() string {
+	return "notify_channels"
+}
+
+// ChannelConfig 解析通道参数
+func (c *ChannelInstance) ChannelConfig() (routing.Channel, error) {
+	var cfg routing.Channel
+	if c.Config != "" {
+		if err := json.Unmarshal([]byte(c.Config), &cfg); err != nil {
+			return cfg, fmt.Errorf("通道参数格式错误: %w", err)
+		}
+	}
+	cfg.Type = c.Type
+	cfg.Ref = ""
+	return cfg, nil
+}
+
+// Validate 校验通道实例，按通道类型创建一次以检查参数
+func (c *ChannelInstance) Validate() error {
+	if c.Name == "" {
+		return errors.New("通道名称不能为空")
+	}
+	cfg, err := c.ChannelConfig()
+	if err != nil {
+		return err
+	}
+	_, err = NewChannel(cfg)
+	return err
+}
+
+// Registry 通知通道注册表，管理租户的通道实例和默认通道
+type Registry struct {
+	db       *gorm.DB
+	fallback []Channel // 配置文件 alerting.notify 中的通道
+
+	mu        sync.Mutex
+	loadedAt  time.Time
+	instances map[string]Channel   // 租户|名称 → 通道
+	defaults  map[string][]Channel // 租户 → 默认通道
+}
+
+var (
+	globalRegistry *Registry
+	registryOnce   sync.Once
+)
+
+// GetRegistry 获取全局通道注册表
+func GetRegistry() *Registry {
+	registryOnce.Do(func() {
+		globalRegistry = NewRegistry(global.DB, config.CONFIG.Alerting.Notify)
+	})
+	return globalRegistry
+}
+
+// NewRegistry 创建通道注册表，cfg 中的通道在没有任何默认通道实例时使用
+func NewRegistry(db *gorm.DB, cfg config.Notify) *Registry {
+	r := &Registry{db: db}
+	for _, ch := range configChannels(cfg) {
+		c, err := NewChannel(ch)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("配置文件中的 %s 通知通道无效: %v", ch.Type, err))
+			continue
+		}
+		r.fallback = append(r.fallback, c)
+	}
+	return r
+}
+
+// configChannels 配置文件中的通道，留空的不启用
+func configChannels(cfg config.Notify) []routing.Channel {
+	var channels []routing.Channel
+	if cfg.TelegramToken != "" {
+		channels = append(channels, routing.Channel{Type: routing.ChannelTelegram, Token: cfg.TelegramToken, ChatID: cfg.TelegramChatID})
+	}
+	if cfg.WeChatWebhook != "" {
+		channels = append(channels, routing.Channel{Type: routing.ChannelWeChat, Webhook: cfg.WeChatWebhook})
+	}
+	if cfg.DingTalkWebhook != "" {
+		channels = append(channels, routing.Channel{Type: routing.ChannelDingTalk, Webhook: cfg.DingTalkWebhook})
+	}
+	if cfg.FeishuWebhook != "" {
+		channels = append(channels, routing.Channel{Type: routing.ChannelFeishu, Webhook: cfg.FeishuWebhook})
+	}
+	if len(cfg.EmailTo) > 0 {
+		channels = append(channels, routing.Channel{Type: routing.ChannelEmail, To: cfg.EmailTo})
+	}
+	return channels
+}
+
+// Invalidate 通道实例修改后清除缓存
+func (r *Registry) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loadedAt = time.Time{}
+}
+
+func (r *Registry) load() {
+	if time.Since(r.loadedAt) < registryCacheTTL {
+		return
+	}
+	r.loadedAt = time.Now()
+	r.instances = make(map[string]Channel)
+	r.defaults = make(map[string][]Channel)
+	if r.db == nil {
+		return
+	}
+
+	var list []ChannelInstance
+	r.db.Where("enabled = ?", true).Order("id").Find(&list)
+	for _, inst := range list {
+		cfg, err := inst.ChannelConfig()
+		if err == nil {
+			var ch Channel
+			if ch, err = NewChannel(cfg); err == nil {
+				r.instances[instanceKey(inst.TenantID, inst.Name)] = ch
+				if inst.IsDefault {
+					r.defaults[inst.TenantID] = append(r.defaults[inst.TenantID], ch)
+				}
+				continue
+			}
+		}
+		global.Logger.Warn(fmt.Sprintf("通知通道 %s 无效，已跳过: %v", inst.Name, err))
+	}
+}
+
+func instanceKey(tenantID, name string) string {
+	return tenantID + "|" + name
+}
+
+// Lookup 按名称查找通道实例，先找租户的再找全局的
+func (r *Registry) Lookup(tenantID, name string) (Channel, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.load()
+	if ch, ok := r.instances[instanceKey(tenantID, name)]; ok {
+		return ch, true
+	}
+	ch, ok := r.instances[instanceKey("", name)]
+	return ch, ok
+}
+
+// Resolve 按通道配置创建通道，引用通道实例时按租户查找
+func (r *Registry) Resolve(tenantID string, cfg routing.Channel) (Channel, error) {
+	if cfg.Ref == "" {
+		return NewChannel(cfg)
+	}
+	ch, ok := r.Lookup(tenantID, cfg.Ref)
+	if !ok {
+		return nil, fmt.Errorf("通知通道 %s 不存在或已停用", cfg.Ref)
+	}
+	return ch, nil
+}
+
+// Notifier 租户的默认通知器：依次使用租户的默认通道、全局默认通道和配置文件中的通道
+func (r *Registry) Notifier(tenantID string) *MultiNotifier {
+	r.mu.Lock()
+	r.load()
+	channels := r.defaults[tenantID]
+	if len(channels) == 0 && tenantID != "" {
+		channels = r.defaults[""]
+	}
+	r.mu.Unlock()
+	if len(channels) == 0 {
+		channels = r.fallback
+	}
+	return NewMultiNotifier(channels...)
+}
+
+// ReceiverNotifier 接收人的通知器，无效的通道记录日志后跳过
+func (r *Registry) ReceiverNotifier(tenantID string, rc *routing.Receiver) *MultiNotifier {
+	configs, err := rc.ParseChannels()
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("接收人 %s 的通知通道无效: %v", rc.Name, err))
+	}
+	var channels []Channel
+	for _, cfg := range configs {
+		ch, err := r.Resolve(tenantID, cfg)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("接收人 %s 的通知通道无效: %v", rc.Name, err))
+			continue
+		}
+		channels = append(channels, ch)
+	}
+	return NewMultiNotifier(channels...)
+}
+
+// ==================== 默认通知器 ====================
+
+// TenantNotifier 按租户默认通道发送的通知器。每次发送时从注册表取通道，
+// 通道实例修改后无需重新设置
+type TenantNotifier struct {
+	tenantID string
+}
+
+// Default 全局默认通知器，供告警、自愈、部署等子系统发送系统通知
+func Default() *TenantNotifier {
+	return ForTenant("")
+}
+
+// ForTenant 租户的默认通知器
+func ForTenant(tenantID string) *TenantNotifier {
+	return &TenantNotifier{tenantID: tenantID}
+}
+
+func (t *TenantNotifier) notifier() *MultiNotifier {
+	return GetRegistry().Notifier(t.tenantID)
+}
+
+// SendPatrolReport 发送巡检报告
+func (t *TenantNotifier) SendPatrolReport(record *patrolModel.PatrolRecord) error {
+	return t.notifier().SendPatrolReport(record)
+}
+
+// SendAlert 发送告警
+func (t *TenantNotifier) SendAlert(alert *detector.Alert) error {
+	return t.notifier().SendAlert(alert)
+}
+
+// SendMessage 发送普通消息
+func (t *TenantNotifier) SendMessage(title, content string) error {
+	return t.notifier().SendMessage(title, content)
+}
+
+// Send 发送通知
+func (t *TenantNotifier) Send(n *Notification) error {
+	return t.notifier().Send(n)
+}
+
+// NotifyIncident 发送事件通知
+func (t *TenantNotifier) NotifyIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert) error {
+	return t.notifier().NotifyIncident(event, incident, alerts)
+}
+
+// PageIncident 通知值班人
+func (t *TenantNotifier) PageIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert, to []oncall.Contact) error {
+	return t.notifier().PageIncident(event, incident, alerts, to)
+}
+
+// Channels 当前使用的默认通道
+func (t *TenantNotifier) Channels() []Channel {
+	return t.notifier().Channels()
+}
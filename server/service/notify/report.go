@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"yunwei/config"
+	"yunwei/service/mail"
+	"yunwei/service/routing"
+)
+
+// ReportTemplate 报告内容，用于成本报告、灾备演练报告等邮件
+type ReportTemplate struct {
+	Title           string
+	Summary         string
+	Details         []string
+	Recommendations []string
+	Timestamp       time.Time
+}
+
+// FormatReport 格式化为纯文本
+func FormatReport(t ReportTemplate) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📅 %s\n\n", t.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "📊 %s\n\n", t.Summary)
+
+	if len(t.Details) > 0 {
+		b.WriteString("📋 详情:\n")
+		for _, d := range t.Details {
+			fmt.Fprintf(&b, "  • %s\n", d)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(t.Recommendations) > 0 {
+		b.WriteString("💡 建议:\n")
+		for _, r := range t.Recommendations {
+			fmt.Fprintf(&b, "  • %s\n", r)
+		}
+	}
+
+	return b.String()
+}
+
+// SendEmailReport 发送报告邮件，可附带报表文件；to 为空时发给 alerting.notify.email-to。
+// 附件不落库，因此报告邮件直接同步发送，不经过发件箱
+func SendEmailReport(to []string, t ReportTemplate, attachments ...mail.Attachment) error {
+	if len(to) == 0 {
+		to = config.CONFIG.Alerting.Notify.EmailTo
+	}
+	if len(to) == 0 {
+		return errors.New("未指定收件人")
+	}
+	html, err := mail.Render(reportEmailTemplate, t.Title, mail.ColorInfo, t)
+	if err == nil {
+		err = mail.GetSender().Send(&mail.Message{
+			To:          to,
+			Subject:     t.Title,
+			Text:        FormatReport(t),
+			HTML:        html,
+			Attachments: attachments,
+		})
+	}
+
+	if err != nil {
+		logNotify("report", routing.ChannelEmail, t.Title, t.Summary, "failed", err.Error())
+		return err
+	}
+	logNotify("report", routing.ChannelEmail, t.Title, t.Summary, "sent", "")
+	return nil
+}
+
+var reportEmailTemplate = template.Must(template.New("report").Parse(`<p style="margin:0 0 12px;color:#8f959e">{{.Timestamp.Format "2006-01-02 15:04:05"}}</p>
+<div style="white-space:pre-wrap;margin-bottom:12px">{{.Summary}}</div>
+{{if .Details}}<h4 style="margin:12px 0 4px">详情</h4><ul style="margin:0;padding-left:20px">{{range .Details}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Recommendations}}<h4 style="margin:12px 0 4px">建议</h4><ul style="margin:0;padding-left:20px">{{range .Recommendations}}<li>{{.}}</li>{{end}}</ul>{{end}}`))
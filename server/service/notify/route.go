@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"yunwei/global"
+	"yunwei/service/detector"
+	"yunwei/service/oncall"
+	"yunwei/service/routing"
+)
+
+// RouteNotifier 按通知路由把事件发给命中的接收人，实现 oncall.Pager。
+// 没有配置路由树、或命中的接收人都不存在时发给事件所属租户的默认通道
+type RouteNotifier struct {
+	registry *Registry
+	routes   *routing.Service
+}
+
+// NewRouteNotifier 创建按路由分发的通知器
+func NewRouteNotifier() *RouteNotifier {
+	return &RouteNotifier{registry: GetRegistry(), routes: routing.GetService()}
+}
+
+// NotifyIncident 发送事件通知
+func (r *RouteNotifier) NotifyIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert) error {
+	return r.dispatch(incident, alerts, func(n *MultiNotifier) error {
+		return n.NotifyIncident(event, incident, alerts)
+	})
+}
+
+// PageIncident 通知值班人，消息发到路由命中的接收人
+func (r *RouteNotifier) PageIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert, to []oncall.Contact) error {
+	return r.dispatch(incident, alerts, func(n *MultiNotifier) error {
+		return n.PageIncident(event, incident, alerts, to)
+	})
+}
+
+// dispatch 任一接收人发送成功即视为已通知，全部失败时返回错误以便重试
+func (r *RouteNotifier) dispatch(incident *detector.Incident, alerts []detector.Alert, send func(*MultiNotifier) error) error {
+	receivers := r.Receivers(incident, alerts)
+	if len(receivers) == 0 {
+		return send(r.registry.Notifier(incident.TenantID))
+	}
+
+	var errs []string
+	for _, rc := range receivers {
+		if err := send(r.registry.ReceiverNotifier(incident.TenantID, rc)); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", rc.Name, err))
+		}
+	}
+	if len(errs) == len(receivers) {
+		return fmt.Errorf("所有接收人发送失败: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Receivers 事件内各告警命中的接收人（去重），未配置路由树时为空
+func (r *RouteNotifier) Receivers(incident *detector.Incident, alerts []detector.Alert) []*routing.Receiver {
+	seen := make(map[string]bool)
+	var receivers []*routing.Receiver
+	for i := range alerts {
+		for _, m := range r.routes.Match(incident.TenantID, alerts[i].MatchLabels(), string(alerts[i].Level)) {
+			if seen[m.Receiver] {
+				continue
+			}
+			seen[m.Receiver] = true
+			rc := r.routes.Receiver(incident.TenantID, m.Receiver)
+			if rc == nil {
+				global.Logger.Warn(fmt.Sprintf("通知路由 %s 引用的接收人 %s 不存在", strings.Join(m.Path, " > "), m.Receiver))
+				continue
+			}
+			receivers = append(receivers, rc)
+		}
+	}
+	return receivers
+}
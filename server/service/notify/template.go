@@ -0,0 +1,611 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"yunwei/global"
+	patrolModel "yunwei/model/patrol"
+	"yunwei/service/detector"
+	"yunwei/service/mail"
+	"yunwei/service/metrics/query"
+	"yunwei/service/routing"
+
+	"gorm.io/gorm"
+)
+
+// templateCacheTTL 模板的缓存时间，其他节点上的修改最迟在此时间后生效
+const templateCacheTTL = 30 * time.Second
+
+// 模板事件类型。事件通知还可以按 firing、repeat、acknowledged、resolved、escalated 单独配置，
+// 未单独配置时使用 incident 模板
+const (
+	TemplateEventIncident = "incident"
+	TemplateEventAlert    = "alert"  // 单条告警
+	TemplateEventPatrol   = "patrol" // 巡检报告
+)
+
+// TemplateChannelText 纯文本模板，通道没有自己的模板时使用，也是邮件的纯文本部分
+const TemplateChannelText = "text"
+
+var incidentEvents = []detector.AlertEvent{
+	detector.AlertEventFiring,
+	detector.AlertEventRepeat,
+	detector.AlertEventAcknowledged,
+	detector.AlertEventResolved,
+	detector.AlertEventEscalated,
+}
+
+// Template 通知模板，按租户、事件类型和通道配置。
+// 标题和正文都是 Go 模板，可用字段见 TemplateData；邮件正文按 HTML 模板解析，其他通道按文本模板解析
+type Template struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"` // 为空为全局模板
+	Event    string `json:"event" gorm:"type:varchar(32);not null"`
+	Channel  string `json:"channel" gorm:"type:varchar(16);not null"` // telegram, wechat, dingtalk, feishu, email, slack, teams, webhook, pagerduty, text
+	Title    string `json:"title" gorm:"type:text"`                   // 为空时使用内置标题
+	Body     string `json:"body" gorm:"type:text"`
+
+	Enabled bool   `json:"enabled" gorm:"default:true"`
+	Comment string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (Template) TableName() string {
+	return "notify_templates"
+}
+
+// Validate 检查事件类型和通道，并用示例数据试渲染
+func (t *Template) Validate() error {
+	if !validTemplateEvent(t.Event) {
+		return fmt.Errorf("未知的事件类型: %s", t.Event)
+	}
+	if !validTemplateChannel(t.Channel) {
+		return fmt.Errorf("未知的通道: %s", t.Channel)
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return errors.New("模板正文不能为空")
+	}
+	_, _, err := PreviewTemplate(t)
+	return err
+}
+
+func validTemplateEvent(event string) bool {
+	switch event {
+	case TemplateEventIncident, TemplateEventAlert, TemplateEventPatrol:
+		return true
+	}
+	return isIncidentEvent(event)
+}
+
+// isIncidentEvent 是否为 firing、repeat 等具体的事件通知类型
+func isIncidentEvent(event string) bool {
+	for _, e := range incidentEvents {
+		if event == string(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func validTemplateChannel(channel string) bool {
+	switch channel {
+	case routing.ChannelTelegram, routing.ChannelWeChat, routing.ChannelDingTalk,
+		routing.ChannelFeishu, routing.ChannelEmail, routing.ChannelSlack, routing.ChannelTeams,
+		routing.ChannelWebhook, routing.ChannelPagerDuty, TemplateChannelText:
+		return true
+	}
+	return false
+}
+
+// TemplateData 模板数据。事件通知填充 Incident、Alerts，单条告警填充 Alert，巡检报告填充 Patrol
+type TemplateData struct {
+	Title      string // 渲染后的标题，只能在正文中使用
+	Event      string // firing, repeat, acknowledged, resolved, escalated, alert, patrol
+	EventTitle string // 事件的默认标题前缀，如「🔥 告警」
+	TenantID   string
+	Now        time.Time
+
+	Incident   *detector.Incident
+	Alerts     []TemplateAlert // 事件内的告警，最多 10 条
+	AlertCount int             // 事件内的告警总数
+	MoreAlerts int             // 未列出的告警数
+	Duration   string          // 恢复时为事件总时长，其他事件为已持续时间
+	Mentions   []string        // 被通知的值班人，如「@张三」
+
+	Alert  *TemplateAlert
+	Patrol *patrolModel.PatrolRecord
+}
+
+// TemplateAlert 模板中的告警
+type TemplateAlert struct {
+	ID          uint
+	Title       string
+	Level       detector.AlertLevel
+	Emoji       string // 级别图标
+	Color       string // 级别颜色，邮件中使用
+	Server      string
+	Message     string
+	Value       float64
+	Threshold   float64
+	Occurrences int
+	FiredAt     time.Time
+	Labels      map[string]string
+}
+
+var levelEmoji = map[detector.AlertLevel]string{
+	detector.AlertLevelInfo:      "ℹ️",
+	detector.AlertLevelWarning:   "⚠️",
+	detector.AlertLevelCritical:  "🔥",
+	detector.AlertLevelEmergency: "🚨",
+}
+
+func newTemplateAlert(a *detector.Alert) TemplateAlert {
+	labels := a.MatchLabels()
+	t := TemplateAlert{
+		ID:          a.ID,
+		Title:       a.Title,
+		Level:       a.Level,
+		Emoji:       levelEmoji[a.Level],
+		Color:       levelColor(a.Level),
+		Server:      labels[query.LabelServer],
+		Message:     a.Message,
+		Value:       a.MetricValue,
+		Threshold:   a.Threshold,
+		Occurrences: a.Occurrences,
+		FiredAt:     a.CreatedAt,
+		Labels:      labels,
+	}
+	if a.FiredAt != nil {
+		t.FiredAt = *a.FiredAt
+	}
+	return t
+}
+
+func newIncidentData(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert, mentions []string) *TemplateData {
+	data := &TemplateData{
+		Event:      string(event),
+		EventTitle: incidentEventTitle[event],
+		TenantID:   incident.TenantID,
+		Now:        time.Now(),
+		Incident:   incident,
+		AlertCount: len(alerts),
+		Mentions:   mentions,
+	}
+	for i := range alerts {
+		if i == maxIncidentAlerts {
+			data.MoreAlerts = len(alerts) - maxIncidentAlerts
+			break
+		}
+		data.Alerts = append(data.Alerts, newTemplateAlert(&alerts[i]))
+	}
+	if event == detector.AlertEventResolved {
+		if incident.ResolvedAt != nil {
+			data.Duration = incident.ResolvedAt.Sub(incident.FiredAt).Round(time.Second).String()
+		}
+	} else {
+		data.Duration = time.Since(incident.FiredAt).Round(time.Minute).String()
+	}
+	return data
+}
+
+func newAlertData(alert *detector.Alert) *TemplateData {
+	a := newTemplateAlert(alert)
+	return &TemplateData{Event: TemplateEventAlert, TenantID: a.Labels[query.LabelTenant], Now: time.Now(), Alert: &a}
+}
+
+func newPatrolData(record *patrolModel.PatrolRecord) *TemplateData {
+	return &TemplateData{Event: TemplateEventPatrol, Now: time.Now(), Patrol: record}
+}
+
+// ==================== 模板渲染 ====================
+
+var templateFuncs = map[string]interface{}{
+	"datetime": func(t time.Time) string { return t.Format("2006-01-02 15:04:05") },
+	"join":     strings.Join,
+	"add":      func(a, b int) int { return a + b },
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+}
+
+// executor 文本模板和 HTML 模板的共同接口
+type executor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+type compiledTemplate struct {
+	title executor
+	body  executor
+}
+
+// compileTemplate 解析模板，邮件正文按 HTML 模板解析以转义告警内容
+func compileTemplate(channel, title, body string) (*compiledTemplate, error) {
+	t, err := template.New("title").Funcs(templateFuncs).Option("missingkey=zero").Parse(title)
+	if err != nil {
+		return nil, fmt.Errorf("标题模板: %w", err)
+	}
+	c := &compiledTemplate{title: t}
+	if channel == routing.ChannelEmail {
+		c.body, err = htmltemplate.New("body").Funcs(templateFuncs).Option("missingkey=zero").Parse(body)
+	} else {
+		c.body, err = template.New("body").Funcs(templateFuncs).Option("missingkey=zero").Parse(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("正文模板: %w", err)
+	}
+	return c, nil
+}
+
+func (c *compiledTemplate) execute(data *TemplateData) (string, string, error) {
+	var title bytes.Buffer
+	if err := c.title.Execute(&title, data); err != nil {
+		return "", "", fmt.Errorf("标题模板: %w", err)
+	}
+	// 正文可以引用渲染后的标题，用副本避免影响其他通道
+	d := *data
+	d.Title = strings.TrimSpace(title.String())
+	var body bytes.Buffer
+	if err := c.body.Execute(&body, &d); err != nil {
+		return "", "", fmt.Errorf("正文模板: %w", err)
+	}
+	return d.Title, body.String(), nil
+}
+
+// TemplateService 通知模板，按租户缓存已解析的模板
+type TemplateService struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	loadedAt  time.Time
+	templates map[string]*compiledTemplate // 租户ID|事件|通道 → 模板
+}
+
+var (
+	globalTemplateService *TemplateService
+	templateServiceOnce   sync.Once
+)
+
+// GetTemplateService 获取全局通知模板服务
+func GetTemplateService() *TemplateService {
+	templateServiceOnce.Do(func() {
+		globalTemplateService = NewTemplateService(global.DB)
+	})
+	return globalTemplateService
+}
+
+// NewTemplateService 创建通知模板服务
+func NewTemplateService(db *gorm.DB) *TemplateService {
+	return &TemplateService{db: db}
+}
+
+// Invalidate 模板变更后清空缓存
+func (s *TemplateService) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadedAt = time.Time{}
+}
+
+// Render 渲染通知标题和正文。依次查找租户模板、全局模板和内置模板，
+// 每一级先找具体事件再找 incident，先找通道模板再找纯文本模板（邮件不使用纯文本模板）；
+// 自定义模板渲染失败时记录日志并使用内置模板，保证通知一定能发出
+func (s *TemplateService) Render(tenantID, event, channel string, data *TemplateData) (string, string) {
+	events, channels := templateCandidates(event, channel)
+
+	s.mu.Lock()
+	s.load()
+	templates := s.templates
+	s.mu.Unlock()
+
+	tenants := []string{tenantID}
+	if tenantID != "" {
+		tenants = append(tenants, "")
+	}
+	for _, tenant := range tenants {
+		for _, ev := range events {
+			for _, ch := range channels {
+				c, ok := templates[templateKey(tenant, ev, ch)]
+				if !ok {
+					continue
+				}
+				title, body, err := c.execute(data)
+				if err == nil {
+					return title, body
+				}
+				global.Logger.Warn(fmt.Sprintf("通知模板 %s 渲染失败，使用内置模板: %v", templateKey(tenant, ev, ch), err))
+			}
+		}
+	}
+	return renderBuiltin(events, channels, data)
+}
+
+// RenderText 渲染纯文本标题和正文，用于邮件的纯文本部分和通知记录
+func (s *TemplateService) RenderText(tenantID, event string, data *TemplateData) (string, string) {
+	return s.Render(tenantID, event, TemplateChannelText, data)
+}
+
+func (s *TemplateService) load() {
+	if time.Since(s.loadedAt) < templateCacheTTL {
+		return
+	}
+	s.loadedAt = time.Now()
+	s.templates = make(map[string]*compiledTemplate)
+	if s.db == nil {
+		return
+	}
+
+	var list []Template
+	s.db.Where("enabled = ?", true).Find(&list)
+	for _, t := range list {
+		c, err := compileTemplate(t.Channel, titleOrBuiltin(&t), t.Body)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("通知模板 %d 无效，已跳过: %v", t.ID, err))
+			continue
+		}
+		s.templates[templateKey(t.TenantID, t.Event, t.Channel)] = c
+	}
+}
+
+func templateKey(tenantID, event, channel string) string {
+	return tenantID + "|" + event + "|" + channel
+}
+
+func templateCandidates(event, channel string) ([]string, []string) {
+	events := []string{event}
+	if isIncidentEvent(event) {
+		events = append(events, TemplateEventIncident)
+	}
+	channels := []string{channel}
+	if channel != routing.ChannelEmail && channel != TemplateChannelText {
+		channels = append(channels, TemplateChannelText)
+	}
+	return events, channels
+}
+
+// titleOrBuiltin 自定义模板未填写标题时使用内置标题
+func titleOrBuiltin(t *Template) string {
+	if strings.TrimSpace(t.Title) != "" {
+		return t.Title
+	}
+	events, _ := templateCandidates(t.Event, t.Channel)
+	return builtinTitles[events[len(events)-1]]
+}
+
+// PreviewTemplate 用示例数据渲染模板，用于保存前检查和预览
+func PreviewTemplate(t *Template) (string, string, error) {
+	c, err := compileTemplate(t.Channel, titleOrBuiltin(t), t.Body)
+	if err != nil {
+		return "", "", err
+	}
+	data := SampleTemplateData(t.Event)
+	title, body, err := c.execute(data)
+	if err != nil {
+		return "", "", err
+	}
+	if t.Channel == routing.ChannelEmail {
+		body, err = mail.RenderPage(title, emailColor(data), htmltemplate.HTML(body))
+	}
+	return title, body, err
+}
+
+// BuiltinTemplate 内置模板，用于在界面上作为编辑的起点
+func BuiltinTemplate(event, channel string) Template {
+	events, channels := templateCandidates(event, channel)
+	for _, ev := range events {
+		for _, ch := range channels {
+			if body, ok := builtinBodies[ev][ch]; ok {
+				return Template{Event: event, Channel: channel, Title: builtinTitles[ev], Body: body, Enabled: true}
+			}
+		}
+	}
+	return Template{Event: event, Channel: channel}
+}
+
+// ==================== 内置模板 ====================
+
+var builtinTitles = map[string]string{
+	TemplateEventIncident: `{{.EventTitle}} [{{.Incident.Level}}] {{.Incident.Title}}`,
+	TemplateEventAlert:    `[{{.Alert.Level}}] {{.Alert.Title}}`,
+	TemplateEventPatrol:   `服务器巡检报告 {{.Patrol.CreatedAt.Format "2006-01-02 15:04"}}`,
+}
+
+const incidentTextBody = `事件: #{{.Incident.ID}}
+触发时间: {{datetime .Incident.FiredAt}}
+{{if eq .Event "resolved"}}{{if .Duration}}持续: {{.Duration}}
+{{end}}{{else if eq .Event "repeat"}}已持续: {{.Duration}}，第 {{add .Incident.NotifyCount 1}} 次提醒
+{{end}}告警数: {{.AlertCount}}
+{{range .Alerts}}
+• {{.Title}}: {{.Message}}{{if gt .Occurrences 1}} (×{{.Occurrences}}){{end}}{{end}}{{if .MoreAlerts}}
+
+... 另有 {{.MoreAlerts}} 条告警{{end}}{{if .Mentions}}
+
+通知: {{join .Mentions " "}}{{end}}`
+
+const alertTextBody = `{{.Alert.Emoji}} 告警通知
+
+标题: {{.Alert.Title}}
+级别: {{.Alert.Level}}
+时间: {{datetime .Alert.FiredAt}}
+
+详情:
+{{.Alert.Message}}`
+
+const alertTelegramBody = `{{.Alert.Emoji}} *告警通知*
+
+*标题*: {{.Alert.Title}}
+*级别*: {{.Alert.Level}}
+*时间*: {{datetime .Alert.FiredAt}}
+
+*详情*:
+{{.Alert.Message}}`
+
+const alertMarkdownBody = `# 🚨 告警通知
+
+> 级别: <font color="{{.Alert.Color}}">{{.Alert.Level}}</font>
+
+**标题**: {{.Alert.Title}}
+
+**时间**: {{datetime .Alert.FiredAt}}
+
+**详情**:
+{{.Alert.Message}}`
+
+const patrolTextBody = `🤖 *服务器巡检报告*
+
+📅 时间: {{.Patrol.CreatedAt.Format "2006-01-02 15:04"}}
+📊 类型: {{.Patrol.Type}}
+
+*服务器状态*
+• 总数: {{.Patrol.TotalServers}}
+• 🟢 在线: {{.Patrol.OnlineServers}}
+• 🔴 离线: {{.Patrol.OfflineServers}}
+• ⚠️ 警告: {{.Patrol.WarningCount}}
+• 🔥 严重: {{.Patrol.CriticalCount}}
+
+*告警统计*
+• 总计: {{.Patrol.AlertCount}}
+
+⏱ 耗时: {{.Patrol.Duration}}ms`
+
+const patrolMarkdownBody = `# 🤖 服务器巡检报告
+
+> 时间: {{.Patrol.CreatedAt.Format "2006-01-02 15:04"}} | 类型: {{.Patrol.Type}}
+
+## 服务器状态
+
+| 指标 | 数量 |
+| --- | --- |
+| 总数 | {{.Patrol.TotalServers}} |
+| 🟢 在线 | {{.Patrol.OnlineServers}} |
+| 🔴 离线 | {{.Patrol.OfflineServers}} |
+| ⚠️ 警告 | {{.Patrol.WarningCount}} |
+| 🔥 严重 | {{.Patrol.CriticalCount}} |
+
+## 告警统计
+
+总计: **{{.Patrol.AlertCount}}** 条
+
+---
+⏱ 耗时: {{.Patrol.Duration}}ms`
+
+// builtinBodies 事件类型 → 通道 → 内置正文，通道没有内置正文时使用 text
+var builtinBodies = map[string]map[string]string{
+	TemplateEventIncident: {
+		TemplateChannelText:     incidentTextBody,
+		routing.ChannelTelegram: "*{{.Title}}*\n\n" + incidentTextBody,
+		routing.ChannelWeChat:   "## {{.Title}}\n\n" + incidentTextBody,
+		routing.ChannelDingTalk: "### {{.Title}}\n\n" + incidentTextBody,
+		routing.ChannelFeishu:   "{{.Title}}\n\n" + incidentTextBody,
+		routing.ChannelSlack:    "*{{.Title}}*\n\n" + incidentTextBody,
+		routing.ChannelEmail:    incidentEmailBody,
+	},
+	TemplateEventAlert: {
+		TemplateChannelText:     alertTextBody,
+		routing.ChannelTelegram: alertTelegramBody,
+		routing.ChannelWeChat:   alertMarkdownBody,
+		routing.ChannelDingTalk: alertMarkdownBody,
+		routing.ChannelFeishu:   alertMarkdownBody,
+		routing.ChannelSlack:    alertTelegramBody,
+		routing.ChannelEmail:    alertEmailBody,
+	},
+	TemplateEventPatrol: {
+		TemplateChannelText:     patrolTextBody,
+		routing.ChannelWeChat:   patrolMarkdownBody,
+		routing.ChannelDingTalk: patrolMarkdownBody,
+		routing.ChannelFeishu:   patrolMarkdownBody,
+		routing.ChannelEmail:    patrolEmailBody,
+	},
+}
+
+var builtinTemplates = func() map[string]*compiledTemplate {
+	out := make(map[string]*compiledTemplate)
+	for event, bodies := range builtinBodies {
+		for channel, body := range bodies {
+			c, err := compileTemplate(channel, builtinTitles[event], body)
+			if err != nil {
+				panic(fmt.Sprintf("内置通知模板 %s/%s 无效: %v", event, channel, err))
+			}
+			out[templateKey("", event, channel)] = c
+		}
+	}
+	return out
+}()
+
+func renderBuiltin(events, channels []string, data *TemplateData) (string, string) {
+	for _, ev := range events {
+		for _, ch := range channels {
+			c, ok := builtinTemplates[templateKey("", ev, ch)]
+			if !ok {
+				continue
+			}
+			title, body, err := c.execute(data)
+			if err != nil {
+				global.Logger.Warn(fmt.Sprintf("内置通知模板 %s/%s 渲染失败: %v", ev, ch, err))
+				continue
+			}
+			return title, body
+		}
+	}
+	return "", ""
+}
+
+// ==================== 示例数据 ====================
+
+// SampleTemplateData 预览用的示例数据
+func SampleTemplateData(event string) *TemplateData {
+	now := time.Now()
+	firedAt := now.Add(-25 * time.Minute)
+	alerts := []detector.Alert{
+		{
+			ID: 101, CreatedAt: firedAt, FiredAt: &firedAt, Level: detector.AlertLevelCritical,
+			Title: "CPU 使用率过高", Message: "web-01 CPU 使用率 96.5%，超过阈值 90%",
+			MetricValue: 96.5, Threshold: 90, Occurrences: 3,
+			Labels: `{"server":"web-01","group":"web","tenant":"demo"}`,
+		},
+		{
+			ID: 102, CreatedAt: firedAt, FiredAt: &firedAt, Level: detector.AlertLevelWarning,
+			Title: "负载过高", Message: "web-02 1 分钟负载 12.3",
+			MetricValue: 12.3, Threshold: 8, Occurrences: 1,
+			Labels: `{"server":"web-02","group":"web","tenant":"demo"}`,
+		},
+	}
+
+	switch event {
+	case TemplateEventAlert:
+		return newAlertData(&alerts[0])
+	case TemplateEventPatrol:
+		return newPatrolData(&patrolModel.PatrolRecord{
+			Type: "daily", TotalServers: 42, OnlineServers: 40, OfflineServers: 2,
+			WarningCount: 5, CriticalCount: 1, AlertCount: 8, Duration: 5230,
+			Summary: "2 台服务器离线，1 台磁盘使用率超过 95%", Suggestions: "清理 db-03 的归档日志",
+			CreatedAt: now,
+		})
+	}
+
+	ev := detector.AlertEvent(event)
+	if event == TemplateEventIncident {
+		ev = detector.AlertEventFiring
+	}
+	incident := &detector.Incident{
+		ID: 2024, Title: "web 组 CPU 使用率过高", Level: detector.AlertLevelCritical, Status: "firing",
+		TenantID: "demo", FiredAt: firedAt, AlertCount: len(alerts), ActiveCount: len(alerts), NotifyCount: 2,
+	}
+	var mentions []string
+	switch ev {
+	case detector.AlertEventResolved:
+		incident.Status, incident.ResolvedAt, incident.ActiveCount = "resolved", &now, 0
+	case detector.AlertEventAcknowledged:
+		incident.Status, incident.AcknowledgedAt = "acknowledged", &now
+	case detector.AlertEventEscalated:
+		mentions = []string{"@张三", "@李四"}
+	}
+	return newIncidentData(ev, incident, alerts, mentions)
+}
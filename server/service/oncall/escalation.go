@@ -0,0 +1,483 @@
+package oncall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/global"
+	"yunwei/service/detector"
+	"yunwei/service/metrics/query"
+
+	"gorm.io/gorm"
+)
+
+// escalationTick 升级检查间隔
+const escalationTick = 30 * time.Second
+
+// 升级目标类型
+const (
+	TargetPrimary   = "primary"   // 值班表当前主值班
+	TargetSecondary = "secondary" // 值班表当前副值班
+	TargetManager   = "manager"   // 值班表负责人
+	TargetUser      = "user"      // 指定用户
+)
+
+// 升级状态，确认和恢复与事件状态同名
+const (
+	EscalationActive       = "active"
+	EscalationAcknowledged = detector.AlertStatusAcknowledged
+	EscalationResolved     = detector.AlertStatusResolved
+)
+
+// Target 通知对象
+type Target struct {
+	Type string `json:"type"` // primary, secondary, manager, user
+	ID   uint   `json:"id"`   // 值班表ID，type=user 时为用户ID
+}
+
+// Step 升级级别
+type Step struct {
+	Delay   int      `json:"delay"` // 上一级通知后多少分钟仍未确认则升级到本级，第一级忽略
+	Targets []Target `json:"targets"`
+}
+
+// EscalationPolicy 升级策略：按告警级别和标签匹配事件，逐级通知值班人
+type EscalationPolicy struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Name     string `json:"name" gorm:"type:varchar(64);not null"`
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"` // 为空对所有租户生效
+	Priority int    `json:"priority"`                               // 越小越先匹配
+	Levels   string `json:"levels" gorm:"type:varchar(64)"`         // 逗号分隔，如 critical,emergency，为空匹配全部级别
+	Matchers string `json:"matchers" gorm:"type:text"`              // 标签匹配条件，为空匹配全部
+	Steps    string `json:"steps" gorm:"type:text"`                 // 升级级别(JSON)
+	Enabled  bool   `json:"enabled" gorm:"default:true"`
+	Comment  string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (EscalationPolicy) TableName() string {
+	return "escalation_policies"
+}
+
+// Escalation 事件的升级进度
+type Escalation struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	IncidentID  uint       `json:"incidentId" gorm:"uniqueIndex"`
+	PolicyID    uint       `json:"policyId"`
+	Step        int        `json:"step"`                                 // 已通知到的级别，从 0 开始
+	Status      string     `json:"status" gorm:"type:varchar(16);index"` // active, acknowledged, resolved
+	NextAt      *time.Time `json:"nextAt" gorm:"index"`                  // 下一次升级时间，已到最后一级时为空
+	LastPagedAt *time.Time `json:"lastPagedAt"`
+	Notified    string     `json:"notified" gorm:"type:varchar(255)"` // 当前级别通知到的人
+}
+
+func (Escalation) TableName() string {
+	return "incident_escalations"
+}
+
+// ParseSteps 解析升级级别
+func (p *EscalationPolicy) ParseSteps() ([]Step, error) {
+	var steps []Step
+	if err := json.Unmarshal([]byte(p.Steps), &steps); err != nil {
+		return nil, fmt.Errorf("升级级别格式错误: %w", err)
+	}
+	return steps, nil
+}
+
+// Validate 校验升级策略
+func (p *EscalationPolicy) Validate() error {
+	if p.Name == "" {
+		return errors.New("策略名称不能为空")
+	}
+	if _, err := query.ParseMatchers(p.Matchers); err != nil {
+		return err
+	}
+	for _, l := range p.levels() {
+		if _, ok := validLevels[detector.AlertLevel(l)]; !ok {
+			return fmt.Errorf("未知的告警级别 %s", l)
+		}
+	}
+	steps, err := p.ParseSteps()
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return errors.New("至少需要一个升级级别")
+	}
+	for i, s := range steps {
+		if len(s.Targets) == 0 {
+			return fmt.Errorf("第 %d 级没有通知对象", i+1)
+		}
+		if i > 0 && s.Delay <= 0 {
+			return fmt.Errorf("第 %d 级的升级等待时间必须大于 0", i+1)
+		}
+		for _, t := range s.Targets {
+			switch t.Type {
+			case TargetPrimary, TargetSecondary, TargetManager, TargetUser:
+			default:
+				return fmt.Errorf("第 %d 级的通知对象类型 %s 无效", i+1, t.Type)
+			}
+			if t.ID == 0 {
+				return fmt.Errorf("第 %d 级的通知对象缺少ID", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+var validLevels = map[detector.AlertLevel]struct{}{
+	detector.AlertLevelInfo:      {},
+	detector.AlertLevelWarning:   {},
+	detector.AlertLevelCritical:  {},
+	detector.AlertLevelEmergency: {},
+}
+
+func (p *EscalationPolicy) levels() []string {
+	var levels []string
+	for _, l := range strings.Split(p.Levels, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			levels = append(levels, l)
+		}
+	}
+	return levels
+}
+
+// Matches 事件是否由该策略处理：级别符合，且任一告警的标签满足匹配条件
+func (p *EscalationPolicy) Matches(incident *detector.Incident, alerts []detector.Alert) bool {
+	if p.TenantID != "" && p.TenantID != incident.TenantID {
+		return false
+	}
+	if levels := p.levels(); len(levels) > 0 {
+		found := false
+		for _, l := range levels {
+			if detector.AlertLevel(l) == incident.Level {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	matchers, err := query.ParseMatchers(p.Matchers)
+	if err != nil {
+		return false
+	}
+	if len(matchers) == 0 {
+		return true
+	}
+	for i := range alerts {
+		labels := alerts[i].MatchLabels()
+		matched := true
+		for _, m := range matchers {
+			if !m.Matches(labels[m.Name]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ==================== 升级 ====================
+
+// Pager 事件通知出口：既能广播，也能只通知指定的人
+type Pager interface {
+	detector.AlertNotifier
+	PageIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert, to []Contact) error
+}
+
+// Escalator 按升级策略通知值班人，未确认时逐级升级；未匹配策略的事件仍广播到所有通道。
+// 实现 detector.AlertNotifier，包装在通知模块外层注入告警生命周期
+type Escalator struct {
+	db     *gorm.DB
+	oncall *Service
+
+	mu       sync.Mutex
+	pager    Pager
+	isLeader func() bool
+	cancel   context.CancelFunc
+}
+
+var (
+	globalEscalator *Escalator
+	escalatorOnce   sync.Once
+)
+
+// GetEscalator 获取全局升级管理器
+func GetEscalator() *Escalator {
+	escalatorOnce.Do(func() {
+		globalEscalator = NewEscalator(global.DB)
+	})
+	return globalEscalator
+}
+
+// NewEscalator 创建升级管理器
+func NewEscalator(db *gorm.DB) *Escalator {
+	return &Escalator{
+		db:       db,
+		oncall:   NewService(db),
+		isLeader: func() bool { return true },
+	}
+}
+
+// SetPager 设置通知出口
+func (e *Escalator) SetPager(p Pager) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pager = p
+}
+
+// SetLeaderCheck 设置 Leader 判断，升级只由 Leader 执行
+func (e *Escalator) SetLeaderCheck(fn func() bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if fn != nil {
+		e.isLeader = fn
+	}
+}
+
+// Start 启动升级检查
+func (e *Escalator) Start(ctx context.Context) {
+	e.mu.Lock()
+	if e.cancel != nil {
+		e.mu.Unlock()
+		return
+	}
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(escalationTick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				e.mu.Lock()
+				leader := e.isLeader()
+				e.mu.Unlock()
+				if leader {
+					e.escalateDue(now)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止升级检查
+func (e *Escalator) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+}
+
+// Route 为事件选择升级策略，没有匹配时返回 nil
+func (e *Escalator) Route(incident *detector.Incident, alerts []detector.Alert) *EscalationPolicy {
+	var policies []EscalationPolicy
+	e.db.Where("enabled = ?", true).Order("priority, id").Find(&policies)
+	for i := range policies {
+		if policies[i].Matches(incident, alerts) {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+// NotifyIncident 新事件通知第一级，重复提醒通知当前级别，确认或恢复后停止升级
+func (e *Escalator) NotifyIncident(event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert) error {
+	e.mu.Lock()
+	pager := e.pager
+	e.mu.Unlock()
+	if pager == nil {
+		return nil
+	}
+	now := time.Now()
+
+	switch event {
+	case detector.AlertEventFiring, detector.AlertEventRepeat:
+		var esc Escalation
+		if err := e.db.Where("incident_id = ?", incident.ID).First(&esc).Error; err == nil && esc.Status == EscalationActive {
+			var policy EscalationPolicy
+			if err := e.db.First(&policy, esc.PolicyID).Error; err == nil {
+				if steps, err := policy.ParseSteps(); err == nil && esc.Step < len(steps) {
+					names, err := e.page(pager, steps[esc.Step], event, incident, alerts, now)
+					if err != nil {
+						return err
+					}
+					e.db.Model(&esc).Updates(map[string]interface{}{"last_paged_at": now, "notified": names})
+					return nil
+				}
+			}
+		}
+
+		// 新事件，或已确认/恢复的事件再次触发，从第一级开始
+		policy := e.Route(incident, alerts)
+		if policy == nil {
+			return pager.NotifyIncident(event, incident, alerts)
+		}
+		steps, err := policy.ParseSteps()
+		if err != nil || len(steps) == 0 {
+			return pager.NotifyIncident(event, incident, alerts)
+		}
+		names, err := e.page(pager, steps[0], event, incident, alerts, now)
+		if err != nil {
+			return err
+		}
+		esc = Escalation{
+			ID:          esc.ID,
+			CreatedAt:   esc.CreatedAt,
+			IncidentID:  incident.ID,
+			PolicyID:    policy.ID,
+			Step:        0,
+			Status:      EscalationActive,
+			NextAt:      nextAt(steps, 0, now),
+			LastPagedAt: &now,
+			Notified:    names,
+		}
+		if err := e.db.Save(&esc).Error; err != nil {
+			global.Logger.Warn(fmt.Sprintf("保存事件 %d 升级进度失败: %v", incident.ID, err))
+		}
+		return nil
+
+	case detector.AlertEventAcknowledged, detector.AlertEventResolved:
+		e.db.Model(&Escalation{}).Where("incident_id = ? AND status = ?", incident.ID, EscalationActive).
+			Updates(map[string]interface{}{"status": string(event), "next_at": nil})
+	}
+	return pager.NotifyIncident(event, incident, alerts)
+}
+
+// escalateDue 将到期仍未确认的事件升级到下一级
+func (e *Escalator) escalateDue(now time.Time) {
+	e.mu.Lock()
+	pager := e.pager
+	e.mu.Unlock()
+	if pager == nil {
+		return
+	}
+
+	var due []Escalation
+	e.db.Where("status = ? AND next_at <= ?", EscalationActive, now).Find(&due)
+	for i := range due {
+		e.escalate(pager, &due[i], now)
+	}
+}
+
+func (e *Escalator) escalate(pager Pager, esc *Escalation, now time.Time) {
+	var incident detector.Incident
+	if err := e.db.First(&incident, esc.IncidentID).Error; err != nil {
+		e.db.Model(esc).Updates(map[string]interface{}{"status": EscalationResolved, "next_at": nil})
+		return
+	}
+	// 确认或恢复的通知可能发生在其他节点，以事件状态为准
+	if incident.Status != detector.AlertStatusFiring {
+		e.db.Model(esc).Updates(map[string]interface{}{"status": incident.Status, "next_at": nil})
+		return
+	}
+
+	var alerts []detector.Alert
+	e.db.Where("incident_id = ? AND status <> ?", incident.ID, detector.AlertStatusResolved).Order("id").Find(&alerts)
+	// 静默或被根因告警抑制期间暂停升级，结束后继续
+	if detector.GetAlertManager().Suppressed(alerts, now) {
+		return
+	}
+
+	var policy EscalationPolicy
+	if err := e.db.First(&policy, esc.PolicyID).Error; err != nil {
+		e.db.Model(esc).Update("next_at", nil)
+		return
+	}
+	steps, err := policy.ParseSteps()
+	step := esc.Step + 1
+	if err != nil || step >= len(steps) {
+		e.db.Model(esc).Update("next_at", nil)
+		return
+	}
+
+	names, err := e.page(pager, steps[step], detector.AlertEventEscalated, &incident, alerts, now)
+	if err != nil {
+		global.Logger.Warn(fmt.Sprintf("事件 %d 升级到第 %d 级失败: %v", incident.ID, step+1, err))
+		return
+	}
+	e.db.Model(esc).Updates(map[string]interface{}{
+		"step":          step,
+		"next_at":       nextAt(steps, step, now),
+		"last_paged_at": now,
+		"notified":      names,
+	})
+}
+
+// page 通知某一级的所有对象，一个人也解析不到时退回广播，避免事件无人知晓
+func (e *Escalator) page(pager Pager, step Step, event detector.AlertEvent, incident *detector.Incident, alerts []detector.Alert, now time.Time) (string, error) {
+	contacts := e.Contacts(step, now)
+	if len(contacts) == 0 {
+		return "所有通道", pager.NotifyIncident(event, incident, alerts)
+	}
+	names := make([]string, 0, len(contacts))
+	for _, c := range contacts {
+		names = append(names, c.Name)
+	}
+	joined := []rune(strings.Join(names, ","))
+	if len(joined) > 255 {
+		joined = joined[:255]
+	}
+	return string(joined), pager.PageIncident(event, incident, alerts, contacts)
+}
+
+// Contacts 解析某一级当前要通知的人，去重
+func (e *Escalator) Contacts(step Step, now time.Time) []Contact {
+	seen := make(map[uint]bool)
+	var contacts []Contact
+	add := func(c *Contact) {
+		if c != nil && !seen[c.UserID] {
+			seen[c.UserID] = true
+			contacts = append(contacts, *c)
+		}
+	}
+	for _, t := range step.Targets {
+		if t.Type == TargetUser {
+			add(e.oncall.Contact(t.ID))
+			continue
+		}
+		oc, err := e.oncall.OnCallAt(t.ID, now)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("查询值班表 %d 失败: %v", t.ID, err))
+			continue
+		}
+		switch t.Type {
+		case TargetPrimary:
+			add(oc.Primary)
+		case TargetSecondary:
+			add(oc.Secondary)
+		case TargetManager:
+			add(oc.Manager)
+		}
+	}
+	return contacts
+}
+
+// nextAt 当前级别之后的升级时间，已是最后一级时返回 nil
+func nextAt(steps []Step, current int, now time.Time) *time.Time {
+	if current+1 >= len(steps) {
+		return nil
+	}
+	t := now.Add(time.Duration(steps[current+1].Delay) * time.Minute)
+	return &t
+}
@@ -0,0 +1,306 @@
+package oncall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	securityModel "yunwei/model/security"
+
+	"gorm.io/gorm"
+)
+
+// 轮换方式
+const (
+	RotationDaily  = "daily"  // 每天交接
+	RotationWeekly = "weekly" // 每周交接
+	RotationCustom = "custom" // 每 RotationHours 小时交接
+)
+
+// Schedule 值班表：参与人按顺序轮换，在交接时间换班
+type Schedule struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Name     string `json:"name" gorm:"type:varchar(64);not null"`
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"`
+	Timezone string `json:"timezone" gorm:"type:varchar(64)"` // 如 Asia/Shanghai，为空使用服务器时区
+
+	Participants  string    `json:"participants" gorm:"type:text"`                         // 轮换顺序，用户ID数组(JSON)
+	RotationType  string    `json:"rotationType" gorm:"type:varchar(16);default:'weekly'"` // daily, weekly, custom
+	RotationHours int       `json:"rotationHours"`                                         // custom 时每班时长(小时)
+	HandoffTime   string    `json:"handoffTime" gorm:"type:varchar(5);default:'09:00'"`    // 交接时间 HH:MM
+	StartDate     time.Time `json:"startDate"`                                             // 第一位参与人开始值班的日期
+
+	ManagerID uint   `json:"managerId"` // 升级的最后一级
+	Comment   string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (Schedule) TableName() string {
+	return "oncall_schedules"
+}
+
+// Override 临时替班：时间段内由指定用户替代轮换中的主值班人
+type Override struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	ScheduleID uint      `json:"scheduleId" gorm:"index"`
+	UserID     uint      `json:"userId"`
+	StartsAt   time.Time `json:"startsAt"`
+	EndsAt     time.Time `json:"endsAt" gorm:"index"`
+	Comment    string    `json:"comment" gorm:"type:varchar(255)"`
+	CreatedBy  uint      `json:"createdBy"`
+}
+
+func (Override) TableName() string {
+	return "oncall_overrides"
+}
+
+// Contact 被通知人
+type Contact struct {
+	UserID uint   `json:"userId"`
+	Name   string `json:"name"`
+	Phone  string `json:"phone"`
+	Email  string `json:"email"`
+}
+
+// OnCall 某一时刻的值班情况
+type OnCall struct {
+	ScheduleID   uint      `json:"scheduleId"`
+	ScheduleName string    `json:"scheduleName"`
+	Primary      *Contact  `json:"primary"`
+	Secondary    *Contact  `json:"secondary"` // 轮换中的下一位
+	Manager      *Contact  `json:"manager"`
+	ShiftStart   time.Time `json:"shiftStart"`
+	ShiftEnd     time.Time `json:"shiftEnd"`
+	OverrideID   uint      `json:"overrideId,omitempty"` // 主值班人来自替班时非 0
+}
+
+// ParticipantIDs 解析参与人
+func (s *Schedule) ParticipantIDs() ([]uint, error) {
+	if strings.TrimSpace(s.Participants) == "" {
+		return nil, nil
+	}
+	var ids []uint
+	if err := json.Unmarshal([]byte(s.Participants), &ids); err != nil {
+		return nil, fmt.Errorf("参与人格式错误: %w", err)
+	}
+	return ids, nil
+}
+
+// Location 值班表时区
+func (s *Schedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区 %s", s.Timezone)
+	}
+	return loc, nil
+}
+
+// Validate 校验值班表
+func (s *Schedule) Validate() error {
+	if s.Name == "" {
+		return errors.New("值班表名称不能为空")
+	}
+	ids, err := s.ParticipantIDs()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return errors.New("至少需要一位参与人")
+	}
+	if _, err := s.Location(); err != nil {
+		return err
+	}
+	if s.HandoffTime == "" {
+		s.HandoffTime = "09:00"
+	}
+	if _, _, err := parseHandoff(s.HandoffTime); err != nil {
+		return err
+	}
+	switch s.RotationType {
+	case "":
+		s.RotationType = RotationWeekly
+	case RotationDaily, RotationWeekly:
+	case RotationCustom:
+		if s.RotationHours <= 0 {
+			return errors.New("自定义轮换需要指定每班时长")
+		}
+	default:
+		return fmt.Errorf("不支持的轮换方式 %s", s.RotationType)
+	}
+	if s.StartDate.IsZero() {
+		return errors.New("开始日期不能为空")
+	}
+	return nil
+}
+
+// Shift 计算 at 所在的班次：轮换序号及起止时间
+func (s *Schedule) Shift(at time.Time) (int, time.Time, time.Time, error) {
+	loc, err := s.Location()
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, err
+	}
+	hour, minute, err := parseHandoff(s.HandoffTime)
+	if err != nil {
+		return 0, time.Time{}, time.Time{}, err
+	}
+	sd := s.StartDate.In(loc)
+	anchor := time.Date(sd.Year(), sd.Month(), sd.Day(), hour, minute, 0, 0, loc)
+	local := at.In(loc)
+
+	if s.RotationType == RotationCustom {
+		period := time.Duration(s.RotationHours) * time.Hour
+		n := floorDiv(int64(local.Sub(anchor)), int64(period))
+		start := anchor.Add(time.Duration(n) * period)
+		return int(n), start, start.Add(period), nil
+	}
+
+	// 按日历天计算，避免夏令时切换时交接时间漂移
+	today := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+	if local.Before(today) {
+		today = today.AddDate(0, 0, -1)
+	}
+	days := civilDays(today) - civilDays(anchor)
+	step := 1
+	if s.RotationType == RotationWeekly {
+		step = 7
+	}
+	n := int(floorDiv(days, int64(step)))
+	start := anchor.AddDate(0, 0, n*step)
+	return n, start, start.AddDate(0, 0, step), nil
+}
+
+// parseHandoff 解析 HH:MM
+func parseHandoff(v string) (int, int, error) {
+	parts := strings.Split(v, ":")
+	if len(parts) == 2 {
+		h, err1 := strconv.Atoi(parts[0])
+		m, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && h >= 0 && h < 24 && m >= 0 && m < 60 {
+			return h, m, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("无效的交接时间 %s，格式为 HH:MM", v)
+}
+
+// civilDays 日期距 1970-01-01 的天数，与时区无关
+func civilDays(t time.Time) int64 {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func mod(a, n int) int {
+	return ((a % n) + n) % n
+}
+
+// ==================== 值班查询 ====================
+
+// Service 值班查询
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService 创建值班查询服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// OnCallAt 查询值班表在 at 时刻的主值班、副值班和负责人
+func (s *Service) OnCallAt(scheduleID uint, at time.Time) (*OnCall, error) {
+	var sch Schedule
+	if err := s.db.First(&sch, scheduleID).Error; err != nil {
+		return nil, fmt.Errorf("值班表 %d 不存在", scheduleID)
+	}
+	return s.resolve(&sch, at)
+}
+
+// Current 查询所有值班表当前的值班人，tenantID 为空时不过滤
+func (s *Service) Current(tenantID string, at time.Time) ([]*OnCall, error) {
+	var schedules []Schedule
+	q := s.db.Order("id")
+	if tenantID != "" {
+		q = q.Where("tenant_id = ?", tenantID)
+	}
+	if err := q.Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*OnCall, 0, len(schedules))
+	for i := range schedules {
+		oc, err := s.resolve(&schedules[i], at)
+		if err != nil {
+			continue
+		}
+		result = append(result, oc)
+	}
+	return result, nil
+}
+
+func (s *Service) resolve(sch *Schedule, at time.Time) (*OnCall, error) {
+	ids, err := sch.ParticipantIDs()
+	if err != nil {
+		return nil, err
+	}
+	n, start, end, err := sch.Shift(at)
+	if err != nil {
+		return nil, err
+	}
+	oc := &OnCall{ScheduleID: sch.ID, ScheduleName: sch.Name, ShiftStart: start, ShiftEnd: end}
+
+	var primaryID, secondaryID uint
+	if len(ids) > 0 {
+		primaryID = ids[mod(n, len(ids))]
+		if len(ids) > 1 {
+			secondaryID = ids[mod(n+1, len(ids))]
+		}
+	}
+
+	// 多个替班重叠时以最后创建的为准
+	var ov Override
+	if err := s.db.Where("schedule_id = ? AND starts_at <= ? AND ends_at > ?", sch.ID, at, at).
+		Order("id DESC").First(&ov).Error; err == nil {
+		oc.OverrideID = ov.ID
+		if ov.UserID == secondaryID {
+			secondaryID = primaryID
+		}
+		primaryID = ov.UserID
+	}
+
+	oc.Primary = s.Contact(primaryID)
+	if secondaryID != primaryID {
+		oc.Secondary = s.Contact(secondaryID)
+	}
+	oc.Manager = s.Contact(sch.ManagerID)
+	return oc, nil
+}
+
+// Contact 查询用户联系方式，用户不存在或已禁用时返回 nil
+func (s *Service) Contact(userID uint) *Contact {
+	if userID == 0 {
+		return nil
+	}
+	var u securityModel.User
+	if err := s.db.Where("id = ? AND status = ?", userID, 1).First(&u).Error; err != nil {
+		return nil
+	}
+	name := u.Nickname
+	if name == "" {
+		name = u.Username
+	}
+	return &Contact{UserID: u.ID, Name: name, Phone: u.Phone, Email: u.Email}
+}
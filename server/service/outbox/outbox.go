@@ -0,0 +1,544 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"yunwei/config"
+	"yunwei/global"
+
+	"gorm.io/gorm"
+)
+
+// 消息状态
+const (
+	StatusPending = "pending" // 等待发送或等待重试
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusDead    = "dead"   // 重试耗尽或永久错误，需人工处理
+	StatusMerged  = "merged" // 积压时已合并到摘要消息
+)
+
+const (
+	dispatchTick  = time.Second
+	dispatchBatch = 500
+	sendTimeout   = 30 * time.Second
+	// lockTimeout 发送中的消息超过此时间未完成（如节点宕机）时重新发送
+	lockTimeout = 5 * time.Minute
+
+	minBackoff = 10 * time.Second
+	maxBackoff = time.Hour
+
+	// digestItemRunes 摘要中每条消息保留的最大字符数
+	digestItemRunes = 300
+
+	cleanupInterval = time.Hour
+)
+
+// Message 发件箱中的一条通知。调用方只负责写入，由 Leader 上的发送协程按目标限流发送，
+// 失败时指数退避重试，重试耗尽后进入死信
+type Message struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Channel  string `json:"channel" gorm:"type:varchar(16);index"` // telegram, wechat, dingtalk, feishu, email, webhook, slack, teams, pagerduty
+	Target   string `json:"-" gorm:"type:varchar(512)"`            // webhook 地址、Telegram chatId 或逗号分隔的收件人，地址中可能带令牌，接口通过 View 脱敏返回
+	Secret   string `json:"-" gorm:"type:varchar(255)"`            // Telegram bot token、Webhook 签名密钥或飞书应用的 appId:appSecret
+	Format   string `json:"format" gorm:"type:varchar(16)"`        // Telegram parse_mode 或 Teams 卡片颜色
+	Kind     string `json:"kind" gorm:"type:varchar(16)"`          // alert, patrol, message, digest 等，仅用于查询
+	Title    string `json:"title" gorm:"type:varchar(255)"`
+	Content  string `json:"content" gorm:"type:mediumtext"` // 可直接发送的正文，已包含标题
+	HTML     string `json:"-" gorm:"type:mediumtext"`       // 邮件 HTML 正文
+	Payload  string `json:"-" gorm:"type:mediumtext"`       // 原样发送的 JSON 请求体，如带按钮的消息、自定义 Webhook
+	Mentions string `json:"mentions" gorm:"type:text"`      // 逗号分隔：钉钉、企业微信为 @ 的手机号，邮件为抄送地址
+	Digest   bool   `json:"digest"`                         // 积压时允许合并为摘要
+
+	Status        string     `json:"status" gorm:"type:varchar(16);index:idx_notify_outbox_status_next"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"index:idx_notify_outbox_status_next"`
+	LockedUntil   *time.Time `json:"lockedUntil"`
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"maxAttempts"`
+	LastError     string     `json:"lastError" gorm:"type:text"` // 已去掉其中的 URL，见 errorText
+	SentAt        *time.Time `json:"sentAt"`
+	MergedInto    uint       `json:"mergedInto" gorm:"index"` // 合并到的摘要消息
+}
+
+func (Message) TableName() string {
+	return "notify_outbox"
+}
+
+// MessageView 接口返回的发件箱消息，Target 中的 URL 只保留协议和主机
+type MessageView struct {
+	Message
+	Target string `json:"target"`
+}
+
+// View 脱敏后的消息，早期写入的 LastError 可能仍带 URL，一并处理
+func (m Message) View() MessageView {
+	m.LastError = redactURLs(m.LastError)
+	return MessageView{Message: m, Target: redactURLs(m.Target)}
+}
+
+// urlPattern 匹配文本中的 URL。Webhook 地址的路径和参数、Telegram 接口路径中都带有令牌
+var urlPattern = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s"'<>]+`)
+
+// redactURLs 把文本中的 URL 替换为 scheme://host/***
+func redactURLs(s string) string {
+	return urlPattern.ReplaceAllStringFunc(s, func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return "***"
+		}
+		return u.Scheme + "://" + u.Host + "/***"
+	})
+}
+
+// errorText 写入 LastError 和日志的错误信息。net/http 的错误会带上完整请求地址，
+// 如 Post "https://api.telegram.org/bot<token>/sendMessage": ...，需要先去掉
+func errorText(err error) string {
+	return redactURLs(err.Error())
+}
+
+// destination 限流和合并的单位：同一通道的同一目标
+func (m *Message) destination() string {
+	return m.Channel + "|" + m.Secret + "|" + m.Target + "|" + m.Format
+}
+
+// Outbox 通知发件箱
+type Outbox struct {
+	db              *gorm.DB
+	workers         int
+	attempts        int
+	digestThreshold int
+	digestMax       int
+	retention       time.Duration
+	limits          map[string]int // 通道 → 每个目标每分钟条数
+
+	mu       sync.Mutex
+	isLeader func() bool
+	cancel   context.CancelFunc
+	buckets  map[string]*tokenBucket
+	inFlight map[string]bool
+	jobs     chan *Message
+	wake     chan struct{}
+}
+
+var (
+	globalOutbox *Outbox
+	outboxOnce   sync.Once
+)
+
+// GetOutbox 获取按配置文件 notify-outbox 段创建的全局发件箱
+func GetOutbox() *Outbox {
+	outboxOnce.Do(func() {
+		globalOutbox = NewOutbox(global.DB, config.CONFIG.NotifyOutbox)
+	})
+	return globalOutbox
+}
+
+// NewOutbox 创建发件箱，未配置的参数使用默认值
+func NewOutbox(db *gorm.DB, cfg config.NotifyOutbox) *Outbox {
+	o := &Outbox{
+		db:              db,
+		workers:         cfg.Workers,
+		attempts:        cfg.MaxAttempts,
+		digestThreshold: cfg.DigestThreshold,
+		digestMax:       cfg.DigestMax,
+		retention:       time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		limits:          make(map[string]int),
+		isLeader:        func() bool { return true },
+		buckets:         make(map[string]*tokenBucket),
+		inFlight:        make(map[string]bool),
+		wake:            make(chan struct{}, 1),
+	}
+	if o.workers <= 0 {
+		o.workers = 4
+	}
+	if o.attempts <= 0 {
+		o.attempts = 8
+	}
+	if o.digestThreshold <= 0 {
+		o.digestThreshold = 10
+	}
+	if o.digestMax <= 0 {
+		o.digestMax = 30
+	}
+	if o.retention <= 0 {
+		o.retention = 7 * 24 * time.Hour
+	}
+	for channel, limit := range defaultRateLimits {
+		o.limits[channel] = limit
+	}
+	for channel, limit := range cfg.RateLimits {
+		o.limits[channel] = limit
+	}
+	o.jobs = make(chan *Message, o.workers)
+	return o
+}
+
+// SetLeaderCheck 设置 Leader 判断，只有 Leader 发送，限流才能在集群内生效
+func (o *Outbox) SetLeaderCheck(fn func() bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if fn != nil {
+		o.isLeader = fn
+	}
+}
+
+// Enqueue 写入发件箱，写入成功即返回，不等待发送
+func Enqueue(m *Message) error {
+	return GetOutbox().Enqueue(m)
+}
+
+// Enqueue 写入发件箱，写入成功即返回，不等待发送
+func (o *Outbox) Enqueue(m *Message) error {
+	if o.db == nil {
+		return errors.New("发件箱未初始化")
+	}
+	if _, ok := transports[m.Channel]; !ok {
+		return fmt.Errorf("不支持的通道: %s", m.Channel)
+	}
+	m.ID = 0
+	m.Status = StatusPending
+	m.NextAttemptAt = time.Now()
+	m.Attempts = 0
+	if m.MaxAttempts <= 0 {
+		m.MaxAttempts = o.attempts
+	}
+	if err := o.db.Create(m).Error; err != nil {
+		return fmt.Errorf("写入发件箱失败: %w", err)
+	}
+	o.notify()
+	return nil
+}
+
+// notify 唤醒发送协程，不必等到下一个周期
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start 启动发送协程
+func (o *Outbox) Start(ctx context.Context) {
+	o.mu.Lock()
+	if o.cancel != nil {
+		o.mu.Unlock()
+		return
+	}
+	ctx, o.cancel = context.WithCancel(ctx)
+	o.mu.Unlock()
+
+	for i := 0; i < o.workers; i++ {
+		go o.work(ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(dispatchTick)
+		defer ticker.Stop()
+		var lastCleanup time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-o.wake:
+			}
+			o.mu.Lock()
+			leader := o.isLeader()
+			o.mu.Unlock()
+			if !leader {
+				continue
+			}
+			now := time.Now()
+			o.dispatch(ctx, now)
+			if now.Sub(lastCleanup) >= cleanupInterval {
+				o.Cleanup(now.Add(-o.retention))
+				lastCleanup = now
+			}
+		}
+	}()
+}
+
+// Stop 停止发送，未发送的消息留在发件箱中
+func (o *Outbox) Stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.cancel != nil {
+		o.cancel()
+		o.cancel = nil
+	}
+}
+
+// dispatch 取出到期的消息，每个目标同时只发一条并按限流放行；积压达到阈值时合并为摘要
+func (o *Outbox) dispatch(ctx context.Context, now time.Time) {
+	o.db.Model(&Message{}).
+		Where("status = ? AND locked_until < ?", StatusSending, now).
+		Updates(map[string]interface{}{"status": StatusPending, "locked_until": nil})
+
+	var due []Message
+	o.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+		Order("id").Limit(dispatchBatch).Find(&due)
+
+	var order []string
+	queues := make(map[string][]*Message)
+	for i := range due {
+		dest := due[i].destination()
+		if _, ok := queues[dest]; !ok {
+			order = append(order, dest)
+		}
+		queues[dest] = append(queues[dest], &due[i])
+	}
+
+	for _, dest := range order {
+		queue := queues[dest]
+		o.mu.Lock()
+		busy := o.inFlight[dest]
+		o.mu.Unlock()
+		if busy || !o.bucket(queue[0].Channel, dest).allow(now) {
+			continue
+		}
+
+		m := queue[0]
+		if digest := digestible(queue); len(digest) >= o.digestThreshold {
+			if len(digest) > o.digestMax {
+				digest = digest[:o.digestMax]
+			}
+			merged, err := o.merge(digest, now)
+			if err != nil {
+				global.Logger.Warn(fmt.Sprintf("合并通知失败: %v", err))
+				continue
+			}
+			m = merged
+		} else if !o.claim(m, now) {
+			continue
+		}
+
+		o.mu.Lock()
+		o.inFlight[dest] = true
+		o.mu.Unlock()
+		select {
+		case o.jobs <- m:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// claim 把消息标记为发送中，其他节点已取走时返回 false
+func (o *Outbox) claim(m *Message, now time.Time) bool {
+	lockedUntil := now.Add(lockTimeout)
+	res := o.db.Model(&Message{}).Where("id = ? AND status = ?", m.ID, StatusPending).
+		Updates(map[string]interface{}{"status": StatusSending, "locked_until": lockedUntil})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false
+	}
+	m.Status, m.LockedUntil = StatusSending, &lockedUntil
+	return true
+}
+
+func digestible(queue []*Message) []*Message {
+	var out []*Message
+	for _, m := range queue {
+		if m.Digest && m.Payload == "" {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// merge 把同一目标积压的消息合并为一条摘要，原消息标记为已合并
+func (o *Outbox) merge(msgs []*Message, now time.Time) (*Message, error) {
+	first := msgs[0]
+	lockedUntil := now.Add(lockTimeout)
+	digest := &Message{
+		Channel:       first.Channel,
+		Target:        first.Target,
+		Secret:        first.Secret,
+		Format:        first.Format,
+		Kind:          "digest",
+		Title:         fmt.Sprintf("📦 %d 条通知合并发送", len(msgs)),
+		Status:        StatusSending,
+		NextAttemptAt: now,
+		LockedUntil:   &lockedUntil,
+		MaxAttempts:   o.attempts,
+	}
+
+	ids := make([]uint, 0, len(msgs))
+	seen := make(map[string]bool)
+	var items, mentions []string
+	for _, m := range msgs {
+		ids = append(ids, m.ID)
+		items = append(items, truncateRunes(m.Content, digestItemRunes))
+		for _, mention := range strings.Split(m.Mentions, ",") {
+			if mention = strings.TrimSpace(mention); mention != "" && !seen[mention] {
+				seen[mention] = true
+				mentions = append(mentions, mention)
+			}
+		}
+	}
+	digest.Mentions = strings.Join(mentions, ",")
+	digest.Content = truncateBytes(digest.Title+"\n\n"+strings.Join(items, "\n\n---\n\n"), maxContentBytes(first.Channel))
+
+	err := o.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(digest).Error; err != nil {
+			return err
+		}
+		res := tx.Model(&Message{}).Where("id IN ? AND status = ?", ids, StatusPending).
+			Updates(map[string]interface{}{"status": StatusMerged, "merged_into": digest.ID})
+		if res.Error != nil {
+			return res.Error
+		}
+		if int(res.RowsAffected) != len(ids) {
+			return errors.New("消息已被其他节点取走")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return digest, nil
+}
+
+func (o *Outbox) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-o.jobs:
+			o.deliver(ctx, m)
+		}
+	}
+}
+
+// deliver 发送一条消息并记录结果：限流错误按服务端要求的时间重试且不计入次数，
+// 永久错误直接进入死信，其他错误指数退避
+func (o *Outbox) deliver(ctx context.Context, m *Message) {
+	defer func() {
+		o.mu.Lock()
+		delete(o.inFlight, m.destination())
+		o.mu.Unlock()
+		o.notify()
+	}()
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	err := transports[m.Channel](sendCtx, m)
+	cancel()
+
+	now := time.Now()
+	updates := map[string]interface{}{"locked_until": nil}
+	var rateLimited *RateLimitError
+	var permanent *PermanentError
+	switch {
+	case err == nil:
+		updates["status"] = StatusSent
+		updates["sent_at"] = now
+		updates["attempts"] = m.Attempts + 1
+		updates["last_error"] = ""
+	case errors.As(err, &rateLimited):
+		o.bucket(m.Channel, m.destination()).pause(now, rateLimited.RetryAfter)
+		updates["status"] = StatusPending
+		updates["next_attempt_at"] = now.Add(rateLimited.RetryAfter)
+		updates["last_error"] = errorText(err)
+	case errors.As(err, &permanent) || m.Attempts+1 >= m.MaxAttempts:
+		updates["status"] = StatusDead
+		updates["attempts"] = m.Attempts + 1
+		updates["last_error"] = errorText(err)
+		global.Logger.Warn(fmt.Sprintf("通知 #%d（%s %s）发送失败，已进入死信: %s", m.ID, m.Channel, m.Title, errorText(err)))
+	default:
+		updates["status"] = StatusPending
+		updates["attempts"] = m.Attempts + 1
+		updates["next_attempt_at"] = now.Add(backoff(m.Attempts + 1))
+		updates["last_error"] = errorText(err)
+	}
+	o.db.Model(&Message{}).Where("id = ?", m.ID).Updates(updates)
+}
+
+// backoff 第 n 次失败后的等待时间：10s、20s、40s……最长 1 小时，加 ±20% 抖动避免集中重试
+func backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(d)*2/5)) - d/5
+	return d + jitter
+}
+
+// Retry 重新发送死信消息，重置重试次数
+func (o *Outbox) Retry(id uint) error {
+	res := o.db.Model(&Message{}).Where("id = ? AND status = ?", id, StatusDead).
+		Updates(map[string]interface{}{"status": StatusPending, "attempts": 0, "next_attempt_at": time.Now(), "last_error": ""})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("消息不存在或不在死信中")
+	}
+	o.notify()
+	return nil
+}
+
+// Discard 丢弃死信消息
+func (o *Outbox) Discard(id uint) error {
+	res := o.db.Where("id = ? AND status = ?", id, StatusDead).Delete(&Message{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return errors.New("消息不存在或不在死信中")
+	}
+	return nil
+}
+
+// Stats 各状态的消息数
+func (o *Outbox) Stats() map[string]int64 {
+	type row struct {
+		Status string
+		Count  int64
+	}
+	var rows []row
+	o.db.Model(&Message{}).Select("status, count(*) AS count").Group("status").Scan(&rows)
+	stats := map[string]int64{StatusPending: 0, StatusSending: 0, StatusSent: 0, StatusDead: 0, StatusMerged: 0}
+	for _, r := range rows {
+		stats[r.Status] = r.Count
+	}
+	return stats
+}
+
+// Cleanup 删除早于 before 的已发送和已合并消息，死信保留到人工处理
+func (o *Outbox) Cleanup(before time.Time) int64 {
+	return o.db.Where("status IN ? AND updated_at < ?", []string{StatusSent, StatusMerged}, before).Delete(&Message{}).RowsAffected
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+// truncateBytes 按字节截断，不截断多字节字符
+func truncateBytes(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	const ellipsis = "\n…"
+	cut := n - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
@@ -0,0 +1,596 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/service/mail"
+)
+
+// 通道
+const (
+	ChannelTelegram  = "telegram"
+	ChannelWeChat    = "wechat"
+	ChannelDingTalk  = "dingtalk"
+	ChannelFeishu    = "feishu"
+	ChannelEmail     = "email"
+	ChannelWebhook   = "webhook"
+	ChannelSlack     = "slack"
+	ChannelTeams     = "teams"
+	ChannelPagerDuty = "pagerduty"
+)
+
+// defaultRateLimits 每个目标每分钟最多发送的条数，按各平台机器人的限制设置：
+// Telegram 群组 20 条/分钟，企业微信、钉钉机器人 20 条/分钟，飞书机器人 100 条/分钟，
+// Slack incoming webhook 1 条/秒，PagerDuty 每个集成 120 条/分钟
+var defaultRateLimits = map[string]int{
+	ChannelTelegram:  20,
+	ChannelWeChat:    20,
+	ChannelDingTalk:  20,
+	ChannelFeishu:    100,
+	ChannelEmail:     60,
+	ChannelWebhook:   60,
+	ChannelSlack:     60,
+	ChannelTeams:     60,
+	ChannelPagerDuty: 120,
+}
+
+// maxContentBytes 各通道单条消息的长度上限，合并摘要时按此截断
+func maxContentBytes(channel string) int {
+	switch channel {
+	case ChannelTelegram, ChannelWeChat:
+		return 4000
+	case ChannelDingTalk:
+		return 18000
+	case ChannelFeishu, ChannelTeams:
+		return 28000
+	case ChannelSlack:
+		return 39000
+	}
+	return 0
+}
+
+// RateLimitError 服务端限流，RetryAfter 后重试，不计入重试次数
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Message    string
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("触发限流，%s 后重试: %s", e.RetryAfter, e.Message)
+}
+
+// PermanentError 重试也不会成功的错误，如 webhook 地址或 token 无效，直接进入死信
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+type transport func(ctx context.Context, m *Message) error
+
+var transports = map[string]transport{
+	ChannelTelegram:  sendTelegram,
+	ChannelWeChat:    sendWeChat,
+	ChannelDingTalk:  sendDingTalk,
+	ChannelFeishu:    sendFeishu,
+	ChannelEmail:     sendEmail,
+	ChannelWebhook:   sendWebhook,
+	ChannelSlack:     sendSlack,
+	ChannelTeams:     sendTeams,
+	ChannelPagerDuty: sendPagerDuty,
+}
+
+var httpClient = &http.Client{Timeout: sendTimeout}
+
+// postJSON 发送 JSON 请求，返回响应体。429 视为限流，其他 4xx 视为永久错误
+func postJSON(ctx context.Context, url string, payload interface{}) ([]byte, error) {
+	body, err := encodePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	return post(ctx, url, body, nil)
+}
+
+// encodePayload string 类型的请求体原样发送，其他类型编码为 JSON
+func encodePayload(payload interface{}) ([]byte, error) {
+	if p, ok := payload.(string); ok {
+		return []byte(p), nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, &PermanentError{err}
+	}
+	return body, nil
+}
+
+func post(ctx context.Context, url string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, &PermanentError{err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		retryAfter := time.Minute
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			retryAfter = time.Duration(s) * time.Second
+		}
+		return data, &RateLimitError{RetryAfter: retryAfter, Message: string(data)}
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return data, &PermanentError{fmt.Errorf("HTTP %d: %s", resp.StatusCode, data)}
+	case resp.StatusCode >= 500:
+		return data, fmt.Errorf("HTTP %d: %s", resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// sendTelegram Payload 不为空时为完整的 sendMessage 请求体，如带内联按钮的消息
+func sendTelegram(ctx context.Context, m *Message) error {
+	var payload interface{} = m.Payload
+	if m.Payload == "" {
+		body := map[string]interface{}{
+			"chat_id": m.Target,
+			"text":    m.Content,
+		}
+		if m.Format != "" {
+			body["parse_mode"] = m.Format
+		}
+		payload = body
+	}
+	data, err := postJSON(ctx, fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", m.Secret), payload)
+	if err == nil {
+		return nil
+	}
+	// 限流时 Telegram 在响应体中给出等待秒数
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		var resp struct {
+			Parameters struct {
+				RetryAfter int `json:"retry_after"`
+			} `json:"parameters"`
+		}
+		if json.Unmarshal(data, &resp) == nil && resp.Parameters.RetryAfter > 0 {
+			rl.RetryAfter = time.Duration(resp.Parameters.RetryAfter) * time.Second
+		}
+	}
+	return err
+}
+
+// robotResult 企业微信和钉钉机器人的响应，HTTP 状态码总是 200，错误在 errcode 中
+type robotResult struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (r *robotResult) err(rateLimited int, permanent ...int) error {
+	if r.ErrCode == 0 {
+		return nil
+	}
+	err := fmt.Errorf("错误码 %d: %s", r.ErrCode, r.ErrMsg)
+	if r.ErrCode == rateLimited {
+		return &RateLimitError{RetryAfter: time.Minute, Message: err.Error()}
+	}
+	for _, code := range permanent {
+		if r.ErrCode == code {
+			return &PermanentError{err}
+		}
+	}
+	return err
+}
+
+func postRobot(ctx context.Context, url string, payload interface{}, rateLimited int, permanent ...int) error {
+	data, err := postJSON(ctx, url, payload)
+	if err != nil {
+		return err
+	}
+	var result robotResult
+	if json.Unmarshal(data, &result) != nil {
+		return nil
+	}
+	return result.err(rateLimited, permanent...)
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// 企业微信：45009 接口调用超过限制，93000 webhook 无效
+func sendWeChat(ctx context.Context, m *Message) error {
+	if m.Payload != "" {
+		return postRobot(ctx, m.Target, m.Payload, 45009, 93000)
+	}
+	err := postRobot(ctx, m.Target, map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"content": m.Content},
+	}, 45009, 93000)
+	if err != nil {
+		return err
+	}
+	// markdown 消息不支持 @手机号，另发一条文本消息提醒
+	mobiles := splitList(m.Mentions)
+	if len(mobiles) == 0 {
+		return nil
+	}
+	return postRobot(ctx, m.Target, map[string]interface{}{
+		"msgtype": "text",
+		"text": map[string]interface{}{
+			"content":               "请值班人尽快处理上述告警",
+			"mentioned_mobile_list": mobiles,
+		},
+	}, 45009, 93000)
+}
+
+// 钉钉：130101 发送太快，300001 token 无效，310000 关键词或签名校验失败；正文中需同时出现 @手机号
+func sendDingTalk(ctx context.Context, m *Message) error {
+	if m.Payload != "" {
+		return postRobot(ctx, m.Target, m.Payload, 130101, 300001, 310000)
+	}
+	mobiles := splitList(m.Mentions)
+	content := m.Content
+	for _, mobile := range mobiles {
+		content += " @" + mobile
+	}
+	title := m.Title
+	if title == "" {
+		title = "运维通知"
+	}
+	payload := map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": title, "text": content},
+	}
+	if len(mobiles) > 0 {
+		payload["at"] = map[string]interface{}{"atMobiles": mobiles}
+	}
+	return postRobot(ctx, m.Target, payload, 130101, 300001, 310000)
+}
+
+// feishuResult 飞书接口的响应
+type feishuResult struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// 飞书：9499 请求过于频繁，19021 签名校验失败，19024 关键词校验失败。
+// Secret 不为空时以应用机器人身份发送（Secret 为 "appId:appSecret"，Target 为群 chat_id），
+// 只有应用发送的卡片才能回调按钮
+func sendFeishu(ctx context.Context, m *Message) error {
+	var payload interface{} = m.Payload
+	if m.Payload == "" {
+		payload = map[string]interface{}{
+			"msg_type": "interactive",
+			"card": map[string]interface{}{
+				"elements": []map[string]interface{}{
+					{"tag": "markdown", "content": m.Content},
+				},
+			},
+		}
+	}
+	if m.Secret != "" {
+		return sendFeishuApp(ctx, m, payload)
+	}
+	data, err := postJSON(ctx, m.Target, payload)
+	if err != nil {
+		return err
+	}
+	var result feishuResult
+	if json.Unmarshal(data, &result) != nil || result.Code == 0 {
+		return nil
+	}
+	return (&robotResult{ErrCode: result.Code, ErrMsg: result.Msg}).err(9499, 19021, 19024)
+}
+
+const (
+	feishuTokenURL   = "https://open.feishu.cn/open-apis/auth/v3/tenant_access_token/internal"
+	feishuMessageURL = "https://open.feishu.cn/open-apis/im/v1/messages?receive_id_type=chat_id"
+)
+
+// feishuTokens 飞书应用的 tenant_access_token 缓存，按 appId 区分
+var feishuTokens = struct {
+	sync.Mutex
+	m map[string]feishuToken
+}{m: make(map[string]feishuToken)}
+
+type feishuToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// feishuTenantToken 获取 tenant_access_token，过期前 5 分钟刷新
+func feishuTenantToken(ctx context.Context, appID, appSecret string) (string, error) {
+	feishuTokens.Lock()
+	t, ok := feishuTokens.m[appID]
+	feishuTokens.Unlock()
+	if ok && time.Until(t.expiresAt) > 5*time.Minute {
+		return t.token, nil
+	}
+
+	data, err := postJSON(ctx, feishuTokenURL, map[string]string{"app_id": appID, "app_secret": appSecret})
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		feishuResult
+		TenantAccessToken string `json:"tenant_access_token"`
+		Expire            int    `json:"expire"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	if resp.Code != 0 {
+		// 10003 app_id 无效，10014 app_secret 无效
+		return "", (&robotResult{ErrCode: resp.Code, ErrMsg: resp.Msg}).err(99991400, 10003, 10014)
+	}
+
+	feishuTokens.Lock()
+	feishuTokens.m[appID] = feishuToken{
+		token:     resp.TenantAccessToken,
+		expiresAt: time.Now().Add(time.Duration(resp.Expire) * time.Second),
+	}
+	feishuTokens.Unlock()
+	return resp.TenantAccessToken, nil
+}
+
+// sendFeishuApp 以应用机器人发送卡片。99991400 请求过于频繁，
+// 99991663 token 失效（清除缓存后重试），230002 机器人不在群中
+func sendFeishuApp(ctx context.Context, m *Message, payload interface{}) error {
+	appID, appSecret, _ := strings.Cut(m.Secret, ":")
+	token, err := feishuTenantToken(ctx, appID, appSecret)
+	if err != nil {
+		return err
+	}
+
+	body, err := encodePayload(payload)
+	if err != nil {
+		return &PermanentError{err}
+	}
+	var webhookBody struct {
+		Card json.RawMessage `json:"card"`
+	}
+	if err := json.Unmarshal(body, &webhookBody); err != nil {
+		return &PermanentError{err}
+	}
+	body, err = json.Marshal(map[string]string{
+		"receive_id": m.Target,
+		"msg_type":   "interactive",
+		"content":    string(webhookBody.Card),
+	})
+	if err != nil {
+		return &PermanentError{err}
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	data, err := post(ctx, feishuMessageURL, body, header)
+	var result feishuResult
+	if json.Unmarshal(data, &result) != nil || result.Code == 0 {
+		return err
+	}
+	if result.Code == 99991663 {
+		feishuTokens.Lock()
+		delete(feishuTokens.m, appID)
+		feishuTokens.Unlock()
+		return fmt.Errorf("错误码 %d: %s", result.Code, result.Msg)
+	}
+	return (&robotResult{ErrCode: result.Code, ErrMsg: result.Msg}).err(99991400, 230002)
+}
+
+// sendEmail 使用配置文件 smtp 段的发送器，SMTP 5xx 错误（如收件人不存在）不重试
+func sendEmail(ctx context.Context, m *Message) error {
+	html := m.HTML
+	if html == "" && m.Kind == "digest" {
+		var err error
+		if html, err = mail.Render(digestTemplate, m.Title, mail.ColorWarning, m.Content); err != nil {
+			return &PermanentError{err}
+		}
+	}
+	err := mail.GetSender().Send(&mail.Message{
+		To:      splitList(m.Target),
+		Cc:      splitList(m.Mentions),
+		Subject: m.Title,
+		Text:    m.Content,
+		HTML:    html,
+	})
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return &PermanentError{err}
+	}
+	return err
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(
+	`<div style="white-space:pre-wrap">{{.}}</div>`))
+
+// sendWebhook 自定义 Webhook，Payload 原样 POST 到目标地址。
+// 配置了密钥时带签名头，接收方用同一密钥对「时间戳.请求体」计算 HMAC-SHA256 校验，
+// 每次重试使用新的时间戳，接收方可据此拒绝重放的请求
+func sendWebhook(ctx context.Context, m *Message) error {
+	payload := m.Payload
+	if payload == "" {
+		data, _ := json.Marshal(map[string]string{"title": m.Title, "content": m.Content})
+		payload = string(data)
+	}
+	var header http.Header
+	if m.Secret != "" {
+		header = SignWebhook(m.Secret, time.Now(), []byte(payload))
+	}
+	_, err := post(ctx, m.Target, []byte(payload), header)
+	return err
+}
+
+// 自定义 Webhook 的签名请求头
+const (
+	HeaderWebhookTimestamp = "X-Yunwei-Timestamp"
+	HeaderWebhookSignature = "X-Yunwei-Signature"
+)
+
+// SignWebhook 计算签名请求头，签名为 sha256=hex(HMAC-SHA256(secret, "时间戳.请求体"))
+func SignWebhook(secret string, now time.Time, body []byte) http.Header {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	header := http.Header{}
+	header.Set(HeaderWebhookTimestamp, ts)
+	header.Set(HeaderWebhookSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+// sendSlack Slack incoming webhook，正文为 mrkdwn；错误时返回 4xx 和错误码文本（如 invalid_token）
+func sendSlack(ctx context.Context, m *Message) error {
+	var payload interface{} = m.Payload
+	if m.Payload == "" {
+		payload = map[string]interface{}{"text": m.Content}
+	}
+	_, err := postJSON(ctx, m.Target, payload)
+	return err
+}
+
+// sendTeams Microsoft Teams incoming webhook，以 MessageCard 发送。
+// Teams 被限流时可能返回 200，错误信息在响应体中
+func sendTeams(ctx context.Context, m *Message) error {
+	var payload interface{} = m.Payload
+	if m.Payload == "" {
+		card := map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  m.Title,
+			// Teams 的 Markdown 中单个换行不换行
+			"text": strings.ReplaceAll(m.Content, "\n", "\n\n"),
+		}
+		if m.Title != "" && m.Kind != "digest" {
+			card["title"] = m.Title
+		}
+		if m.Format != "" {
+			card["themeColor"] = strings.TrimPrefix(m.Format, "#")
+		}
+		payload = card
+	}
+	data, err := postJSON(ctx, m.Target, payload)
+	if err != nil {
+		return err
+	}
+	if body := string(data); strings.Contains(body, "HTTP error 429") {
+		return &RateLimitError{RetryAfter: time.Minute, Message: body}
+	}
+	return nil
+}
+
+// PagerDutyEventsURL PagerDuty Events API v2 的默认地址
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// sendPagerDuty 发送 PagerDuty 事件，Payload 为完整的事件（含 routing_key），由调用方构造。
+// 成功返回 202，400 为事件格式或集成密钥错误
+func sendPagerDuty(ctx context.Context, m *Message) error {
+	if m.Payload == "" {
+		return &PermanentError{errors.New("PagerDuty 事件缺少请求体")}
+	}
+	target := m.Target
+	if target == "" {
+		target = PagerDutyEventsURL
+	}
+	_, err := postJSON(ctx, target, m.Payload)
+	return err
+}
+
+// ==================== 限流 ====================
+
+// tokenBucket 每个目标一个令牌桶，服务端返回限流时暂停到指定时间
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒补充令牌数
+	burst  float64
+	tokens float64
+	last   time.Time
+	paused time.Time
+}
+
+// bucket 获取目标的令牌桶，通道未限流时返回 nil
+func (o *Outbox) bucket(channel, dest string) *tokenBucket {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	b, ok := o.buckets[dest]
+	if !ok {
+		limit := o.limits[channel]
+		if limit > 0 {
+			// 突发量取每分钟限额的 1/4，避免任意一分钟窗口内超出限额太多
+			burst := float64(limit) / 4
+			if burst < 1 {
+				burst = 1
+			}
+			b = &tokenBucket{rate: float64(limit) / 60, burst: burst, tokens: burst, last: time.Now()}
+		}
+		o.buckets[dest] = b
+	}
+	return b
+}
+
+// allow 取一个令牌，没有令牌或处于暂停期时返回 false
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if now.Before(b.paused) {
+		return false
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// pause 服务端限流时暂停该目标，并清空令牌
+func (b *tokenBucket) pause(now time.Time, d time.Duration) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.paused = now.Add(d)
+	b.tokens = 0
+	b.last = b.paused
+}
@@ -10,6 +10,8 @@ import (
         patrolModel "yunwei/model/patrol"
         "yunwei/model/server"
         "yunwei/service/detector"
+        "yunwei/service/metrics"
+        "yunwei/service/metrics/query"
         "yunwei/service/notify"
         "yunwei/service/prediction"
 )
@@ -62,7 +64,9 @@ type PatrolRobot struct {
 // NewPatrolRobot 创建巡检机器人
 func NewPatrolRobot() *PatrolRobot {
         return &PatrolRobot{
-                detector: detector.NewDetector(),
+                detector:  detector.NewDetector(),
+                predictor: prediction.NewPredictor(nil),
+                notifier:  notify.Default(),
         }
 }
 
@@ -94,7 +98,7 @@ func (r *PatrolRobot) RunPatrol(patrolType PatrolType) (*PatrolRecord, error) {
 
         // 获取所有服务器
         var servers []server.Server
-        global.DB.Find(&servers)
+        global.DB.Preload("Group").Find(&servers)
         record.TotalServers = len(servers)
 
         var healthyServers, warningServers, criticalServers, offlineServerList []ServerCheckResult
@@ -166,7 +170,8 @@ func (r *PatrolRobot) CheckServer(srv *server.Server) ServerCheckResult {
                 Status:     "healthy",
         }
 
-        // 检查服务器是否在线
+        // 检查服务器是否在线，离线时产生 host_down 根因告警，抑制该服务器及其下游的其他告警
+        detector.GetAlertManager().SyncHost(srv, srv.AgentOnline, time.Now())
         if !srv.AgentOnline {
                 result.Status = "offline"
                 result.Checks = append(result.Checks, CheckItem{
@@ -179,8 +184,8 @@ func (r *PatrolRobot) CheckServer(srv *server.Server) ServerCheckResult {
         }
 
         // 获取最新指标
-        var metric server.ServerMetric
-        if err := global.DB.Where("server_id = ?", srv.ID).Order("created_at DESC").First(&metric).Error; err != nil {
+        metric, err := metrics.LatestServerMetric(srv.ID)
+        if err != nil {
                 result.Status = "warning"
                 result.Checks = append(result.Checks, CheckItem{
                         Name:    "指标采集",
@@ -190,7 +195,7 @@ func (r *PatrolRobot) CheckServer(srv *server.Server) ServerCheckResult {
                 })
                 return result
         }
-        result.Metrics = &metric
+        result.Metrics = metric
 
         // CPU 检查
         cpuStatus := "pass"
@@ -250,6 +255,26 @@ func (r *PatrolRobot) CheckServer(srv *server.Server) ServerCheckResult {
                 Message: r.getDiskMessage(metric.DiskUsage),
         })
 
+        // 磁盘容量预测，基于时序存储中最近一周的数据
+        if pred, err := r.predictor.PredictFromStore(srv.ID, prediction.PredictionDisk); err == nil {
+                predStatus := "pass"
+                switch pred.Level {
+                case prediction.PredictionLevelCritical:
+                        predStatus = "fail"
+                case prediction.PredictionLevelWarning:
+                        predStatus = "warning"
+                }
+                if predStatus != "pass" && result.Status == "healthy" {
+                        result.Status = "warning"
+                }
+                result.Checks = append(result.Checks, CheckItem{
+                        Name:    "磁盘容量预测",
+                        Status:  predStatus,
+                        Value:   fmt.Sprintf("%.1f%%", pred.PredictedValue),
+                        Message: pred.Summary,
+                })
+        }
+
         // 负载检查
         loadStatus := "pass"
         if metric.Load1 > float64(srv.CPUCores) {
@@ -270,9 +295,12 @@ func (r *PatrolRobot) CheckServer(srv *server.Server) ServerCheckResult {
         containers := []server.DockerContainer{}
         ports := []server.PortInfo{}
 
-        detectionResults := r.detector.Detect(srv, &metric, processes, containers, ports)
+        detectionResults := r.detector.Detect(srv, metric, processes, containers, ports)
         result.Alerts = detectionResults
 
+        // 写入告警：同一问题持续存在时不重复生成，已消失的自动恢复
+        detector.GetAlertManager().Sync(srv, detectionResults, time.Now())
+
         // 生成建议
         result.Suggestions = r.generateServerSuggestions(result)
 
@@ -302,23 +330,13 @@ func (r *PatrolRobot) GenerateDailyReport() (*DailyReport, error) {
                 report.OnlineRate = float64(onlineCount) / float64(len(servers)) * 100
         }
 
-        // 获取最近24小时指标
-        yesterday := time.Now().Add(-24 * time.Hour)
-        var metrics []server.ServerMetric
-        global.DB.Where("created_at > ?", yesterday).Find(&metrics)
-
-        // 计算平均值
-        if len(metrics) > 0 {
-                var cpuSum, memSum, diskSum float64
-                for _, m := range metrics {
-                        cpuSum += m.CPUUsage
-                        memSum += m.MemoryUsage
-                        diskSum += m.DiskUsage
-                }
-                report.AvgCPUUsage = cpuSum / float64(len(metrics))
-                report.AvgMemoryUsage = memSum / float64(len(metrics))
-                report.AvgDiskUsage = diskSum / float64(len(metrics))
-        }
+        // 最近24小时平均值（先按服务器求时间平均，再求整体平均）
+        now := time.Now()
+        yesterday := now.Add(-24 * time.Hour)
+        engine := query.GetEngine()
+        report.AvgCPUUsage, _, _ = engine.ScalarValue("avg(avg_over_time(cpu_usage[24h]))", now, query.Options{})
+        report.AvgMemoryUsage, _, _ = engine.ScalarValue("avg(avg_over_time(memory_usage[24h]))", now, query.Options{})
+        report.AvgDiskUsage, _, _ = engine.ScalarValue("avg(avg_over_time(disk_usage[24h]))", now, query.Options{})
 
         // 获取告警统计
         var alerts []detector.Alert
@@ -500,12 +518,31 @@ func (r *PatrolRobot) getTopUsageServers(servers []server.Server, metricType str
         return usages
 }
 
+// analyzeTrends 对比 since 之后与之前同等时长的平均使用率
 func (r *PatrolRobot) analyzeTrends(since time.Time) TrendAnalysis {
-        // 简化的趋势分析
+        now := time.Now()
+        window := query.FormatDuration(now.Sub(since).Truncate(time.Second))
+        engine := query.GetEngine()
+
+        trend := func(metric string) string {
+                q := fmt.Sprintf("avg(avg_over_time(%s[%s])) - avg(avg_over_time(%s[%s] offset %s))", metric, window, metric, window, window)
+                diff, ok, err := engine.ScalarValue(q, now, query.Options{})
+                if err != nil || !ok {
+                        return "stable"
+                }
+                switch {
+                case diff > 5:
+                        return "rising"
+                case diff < -5:
+                        return "falling"
+                }
+                return "stable"
+        }
+
         return TrendAnalysis{
-                CPUTrend:    "stable",
-                MemoryTrend: "stable",
-                DiskTrend:   "stable",
+                CPUTrend:    trend("cpu_usage"),
+                MemoryTrend: trend("memory_usage"),
+                DiskTrend:   trend("disk_usage"),
                 AlertTrend:  "stable",
         }
 }
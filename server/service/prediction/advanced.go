@@ -88,11 +88,11 @@ func (AutoScaleRecommendation) TableName() string {
 
 // AdvancedPredictor 高级预测器
 type AdvancedPredictor struct {
-        llmClient *llm.GLM5Client
+        llmClient llm.Provider
 }
 
 // NewAdvancedPredictor 创建高级预测器
-func NewAdvancedPredictor(llmClient *llm.GLM5Client) *AdvancedPredictor {
+func NewAdvancedPredictor(llmClient llm.Provider) *AdvancedPredictor {
         return &AdvancedPredictor{
                 llmClient: llmClient,
         }
@@ -157,10 +157,7 @@ func (p *AdvancedPredictor) DetectAnomaly(serverID uint, history []server.Server
         }
 
         // AI 分析
-        aiAnalysis := ""
-        if p.llmClient != nil {
-                aiAnalysis = p.aiAnalyzeAnomaly(serverID, history, anomalies)
-        }
+        aiAnalysis := p.aiAnalyzeAnomaly(serverID, history, anomalies)
 
         indicatorsJSON, _ := json.Marshal(map[string]interface{}{
                 "cpu":  cpuStats,
@@ -395,9 +392,7 @@ func (p *AdvancedPredictor) RecommendAutoScale(srv *server.Server, history []ser
         }
 
         // AI 分析
-        if p.llmClient != nil {
-                recommendation.AIRecommendation = p.aiAnalyzeScale(srv, history)
-        }
+        recommendation.AIRecommendation = p.aiAnalyzeScale(srv, history)
 
         // 保存
         global.DB.Create(recommendation)
@@ -407,7 +402,8 @@ func (p *AdvancedPredictor) RecommendAutoScale(srv *server.Server, history []ser
 
 // aiAnalyzeAnomaly AI分析异常
 func (p *AdvancedPredictor) aiAnalyzeAnomaly(serverID uint, history []server.ServerMetric, anomalies []string) string {
-        if p.llmClient == nil {
+        client := clientFor(p.llmClient, serverID)
+        if client == nil {
                 return ""
         }
 
@@ -434,7 +430,7 @@ func (p *AdvancedPredictor) aiAnalyzeAnomaly(serverID uint, history []server.Ser
 
 简要回复(200字以内)。`, anomalies, historyStr)
 
-        response, err := p.llmClient.QuickChat(prompt)
+        response, err := client.QuickChat(prompt)
         if err != nil {
                 return ""
         }
@@ -444,7 +440,11 @@ func (p *AdvancedPredictor) aiAnalyzeAnomaly(serverID uint, history []server.Ser
 
 // aiAnalyzeScale AI分析扩容需求
 func (p *AdvancedPredictor) aiAnalyzeScale(srv *server.Server, history []server.ServerMetric) string {
-        if p.llmClient == nil {
+        client := p.llmClient
+        if client == nil {
+                client = llm.For(llm.FeaturePrediction, srv.TenantID)
+        }
+        if client == nil {
                 return ""
         }
 
@@ -473,7 +473,7 @@ CPU核心: %d
                 history[len(history)-1].Load1,
         )
 
-        response, err := p.llmClient.QuickChat(prompt)
+        response, err := client.QuickChat(prompt)
         if err != nil {
                 return ""
         }
@@ -0,0 +1,272 @@
+package prediction
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"yunwei/service/metrics"
+)
+
+// Seasonality 基线的季节周期，按本地时间分桶
+type Seasonality string
+
+const (
+	SeasonHourOfDay  Seasonality = "hour_of_day"  // 一天中的小时，24 个分桶
+	SeasonHourOfWeek Seasonality = "hour_of_week" // 星期几 + 小时，168 个分桶
+)
+
+// Buckets 分桶数
+func (s Seasonality) Buckets() int {
+	if s == SeasonHourOfWeek {
+		return 7 * 24
+	}
+	return 24
+}
+
+// Bucket 时间所在的分桶
+func (s Seasonality) Bucket(t time.Time) int {
+	t = t.Local()
+	if s == SeasonHourOfWeek {
+		return int(t.Weekday())*24 + t.Hour()
+	}
+	return t.Hour()
+}
+
+// 基线评分算法
+const (
+	AlgorithmMAD         = "mad"          // 同一分桶历史值的中位数和 MAD
+	AlgorithmHoltWinters = "holt_winters" // 加法 Holt-Winters 的预测残差
+)
+
+const (
+	// madScale 正态分布下 MAD 换算为标准差的系数
+	madScale = 1.4826
+	// minBucketSamples 分桶样本少于该数时不评分
+	minBucketSamples = 5
+	// maxScore 波动幅度为 0 时偏离的封顶分数
+	maxScore = 100
+
+	// Holt-Winters 平滑系数：水平、趋势、季节
+	hwAlpha = 0.3
+	hwBeta  = 0.01
+	hwGamma = 0.2
+)
+
+// Deviation 当前值相对基线的偏离
+type Deviation struct {
+	Expected float64 `json:"expected"` // 基线期望值
+	Scale    float64 `json:"scale"`    // 正常波动幅度（稳健标准差）
+	Score    float64 `json:"score"`    // 偏离了几倍波动幅度，负数表示低于基线
+}
+
+// Baseline 单条序列学习到的季节基线
+type Baseline struct {
+	Seasonality Seasonality
+	Algorithm   string
+	Since       time.Time // 最早样本时间
+	Until       time.Time // 最后样本时间
+
+	buckets []bucketStats
+	hw      *holtWinters
+}
+
+// bucketStats 分桶的中位数和波动幅度
+type bucketStats struct {
+	median float64
+	scale  float64
+	n      int
+}
+
+// holtWinters 加法 Holt-Winters 模型的末状态
+type holtWinters struct {
+	level  float64
+	trend  float64
+	season []float64
+	step   time.Duration
+	scale  float64 // 一步预测残差的稳健标准差
+}
+
+// LearnBaseline 从按时间升序的历史样本学习基线
+// Holt-Winters 要求样本按 step 等间隔（缺失的点可以跳过），且至少覆盖两个完整周期
+func LearnBaseline(points []metrics.Point, season Seasonality, algorithm string, step time.Duration) (*Baseline, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("没有历史数据")
+	}
+	b := &Baseline{
+		Seasonality: season,
+		Algorithm:   algorithm,
+		Since:       points[0].Timestamp,
+		Until:       points[len(points)-1].Timestamp,
+	}
+	switch algorithm {
+	case AlgorithmMAD:
+		b.buckets = learnBuckets(points, season)
+	case AlgorithmHoltWinters:
+		hw, err := learnHoltWinters(points, season, step)
+		if err != nil {
+			return nil, err
+		}
+		b.hw = hw
+	default:
+		return nil, fmt.Errorf("不支持的算法 %s", algorithm)
+	}
+	return b, nil
+}
+
+// Span 历史数据覆盖的时长，用于判断是否度过预热期
+func (b *Baseline) Span() time.Duration {
+	return b.Until.Sub(b.Since)
+}
+
+// Score 计算 t 时刻的值 v 相对基线的偏离，分桶样本不足时 ok 为 false
+func (b *Baseline) Score(t time.Time, v float64) (Deviation, bool) {
+	var expected, scale float64
+	switch {
+	case b.hw != nil:
+		expected = b.hw.forecast(b.Until, t, b.Seasonality)
+		scale = b.hw.scale
+	case b.buckets != nil:
+		s := b.buckets[b.Seasonality.Bucket(t)]
+		if s.n < minBucketSamples {
+			return Deviation{}, false
+		}
+		expected, scale = s.median, s.scale
+	default:
+		return Deviation{}, false
+	}
+
+	d := Deviation{Expected: expected, Scale: scale}
+	diff := v - expected
+	switch {
+	case scale > 0:
+		d.Score = math.Max(-maxScore, math.Min(maxScore, diff/scale))
+	case diff != 0:
+		d.Score = math.Copysign(maxScore, diff)
+	}
+	return d, true
+}
+
+// learnBuckets 按分桶统计中位数和 MAD
+func learnBuckets(points []metrics.Point, season Seasonality) []bucketStats {
+	values := make([][]float64, season.Buckets())
+	for _, p := range points {
+		if math.IsNaN(p.Value) {
+			continue
+		}
+		i := season.Bucket(p.Timestamp)
+		values[i] = append(values[i], p.Value)
+	}
+
+	out := make([]bucketStats, len(values))
+	for i, vs := range values {
+		if len(vs) == 0 {
+			continue
+		}
+		med := median(vs)
+		out[i] = bucketStats{median: med, scale: robustScale(vs, med), n: len(vs)}
+	}
+	return out
+}
+
+// learnHoltWinters 用等间隔样本拟合加法 Holt-Winters，季节分量按分桶对齐
+func learnHoltWinters(points []metrics.Point, season Seasonality, step time.Duration) (*holtWinters, error) {
+	if step != time.Hour {
+		return nil, fmt.Errorf("Holt-Winters 需要按小时采样，实际步长 %s", step)
+	}
+	period := season.Buckets()
+	first, last := points[0].Timestamp, points[len(points)-1].Timestamp
+	if last.Sub(first) < 2*time.Duration(period)*step {
+		return nil, fmt.Errorf("历史数据不足两个周期")
+	}
+
+	// 第一个周期的均值作为初始水平，前两个周期均值之差作为初始趋势
+	byIndex := make(map[int64]float64, len(points))
+	for _, p := range points {
+		if !math.IsNaN(p.Value) {
+			byIndex[int64(p.Timestamp.Sub(first)/step)] = p.Value
+		}
+	}
+	cycleMean := func(k int) (float64, bool) {
+		var sum float64
+		var n int
+		for i := k * period; i < (k+1)*period; i++ {
+			if v, ok := byIndex[int64(i)]; ok {
+				sum += v
+				n++
+			}
+		}
+		if n < period/2 {
+			return 0, false
+		}
+		return sum / float64(n), true
+	}
+	m1, ok1 := cycleMean(0)
+	m2, ok2 := cycleMean(1)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("前两个周期的数据缺失过多")
+	}
+
+	hw := &holtWinters{level: m1, trend: (m2 - m1) / float64(period), season: make([]float64, period), step: step}
+	for i := 0; i < period; i++ {
+		if v, ok := byIndex[int64(i)]; ok {
+			hw.season[season.Bucket(first.Add(time.Duration(i)*step))] = v - m1
+		}
+	}
+
+	// 从第二个周期开始逐点更新，记录一步预测残差；缺失的点只推进趋势
+	total := int(last.Sub(first) / step)
+	residuals := make([]float64, 0, total)
+	for i := period; i <= total; i++ {
+		t := first.Add(time.Duration(i) * step)
+		s := season.Bucket(t)
+		v, ok := byIndex[int64(i)]
+		if !ok {
+			hw.level += hw.trend
+			continue
+		}
+		residuals = append(residuals, v-(hw.level+hw.trend+hw.season[s]))
+
+		prevLevel := hw.level
+		hw.level = hwAlpha*(v-hw.season[s]) + (1-hwAlpha)*(hw.level+hw.trend)
+		hw.trend = hwBeta*(hw.level-prevLevel) + (1-hwBeta)*hw.trend
+		hw.season[s] = hwGamma*(v-hw.level) + (1-hwGamma)*hw.season[s]
+	}
+	if len(residuals) < minBucketSamples {
+		return nil, fmt.Errorf("历史数据不足")
+	}
+	hw.scale = robustScale(residuals, median(residuals))
+	return hw, nil
+}
+
+// forecast 预测 t 时刻的值，until 为拟合的最后一个样本时间
+func (hw *holtWinters) forecast(until, t time.Time, season Seasonality) float64 {
+	h := math.Max(0, math.Round(float64(t.Sub(until))/float64(hw.step)))
+	return hw.level + h*hw.trend + hw.season[season.Bucket(t)]
+}
+
+// median 中位数，会打乱 values 的顺序
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// robustScale 稳健标准差：1.4826 × MAD；超过一半的值相同时 MAD 为 0，退化为平均绝对偏差
+func robustScale(values []float64, med float64) float64 {
+	dev := make([]float64, len(values))
+	var sum float64
+	for i, v := range values {
+		dev[i] = math.Abs(v - med)
+		sum += dev[i]
+	}
+	if mad := median(dev); mad > 0 {
+		return madScale * mad
+	}
+	// 正态分布下平均绝对偏差换算为标准差的系数为 sqrt(pi/2)
+	return sum / float64(len(values)) * math.Sqrt(math.Pi/2)
+}
@@ -9,6 +9,7 @@ import (
         "yunwei/global"
         "yunwei/model/server"
         "yunwei/service/ai/llm"
+        "yunwei/service/metrics"
 )
 
 // PredictionType 预测类型
@@ -74,16 +75,65 @@ type HistoryData struct {
 
 // Predictor 预测器
 type Predictor struct {
-        llmClient *llm.GLM5Client
+        llmClient llm.Provider
 }
 
-// NewPredictor 创建预测器
-func NewPredictor(llmClient *llm.GLM5Client) *Predictor {
+// NewPredictor 创建预测器，llmClient 为 nil 时按服务器所属租户的路由选择模型
+func NewPredictor(llmClient llm.Provider) *Predictor {
         return &Predictor{
                 llmClient: llmClient,
         }
 }
 
+// clientFor 预测使用的模型：优先用创建时指定的客户端，否则按服务器租户解析 prediction 路由
+func clientFor(fixed llm.Provider, serverID uint) llm.Provider {
+        if fixed != nil {
+                return fixed
+        }
+        var tenantID string
+        global.DB.Model(&server.Server{}).Where("id = ?", serverID).Pluck("tenant_id", &tenantID)
+        return llm.For(llm.FeaturePrediction, tenantID)
+}
+
+// historyWindows 各预测类型从时序存储加载的历史窗口
+// 磁盘按天增长，使用更长的窗口，时序存储会自动改用聚合数据
+var historyWindows = map[PredictionType]time.Duration{
+        PredictionCPU:     6 * time.Hour,
+        PredictionMemory:  6 * time.Hour,
+        PredictionNetwork: 6 * time.Hour,
+        PredictionDisk:    7 * 24 * time.Hour,
+}
+
+// LoadHistory 从时序存储加载历史指标
+func (p *Predictor) LoadHistory(serverID uint, lookback time.Duration) ([]server.ServerMetric, error) {
+        end := time.Now()
+        return metrics.LoadServerMetrics(serverID, end.Add(-lookback), end)
+}
+
+// PredictFromStore 按预测类型加载历史数据并预测
+func (p *Predictor) PredictFromStore(serverID uint, predictionType PredictionType) (*PredictionResult, error) {
+        lookback, ok := historyWindows[predictionType]
+        if !ok {
+                return nil, fmt.Errorf("不支持的预测类型: %s", predictionType)
+        }
+
+        history, err := p.LoadHistory(serverID, lookback)
+        if err != nil {
+                return nil, fmt.Errorf("加载历史数据失败: %w", err)
+        }
+
+        switch predictionType {
+        case PredictionCPU:
+                return p.PredictCPU(serverID, history)
+        case PredictionMemory:
+                return p.PredictMemory(serverID, history)
+        case PredictionDisk:
+                return p.PredictDisk(serverID, history)
+        default:
+                return p.PredictNetwork(serverID, history)
+        }
+}
+
 // PredictCPU 预测CPU使用率
 func (p *Predictor) PredictCPU(serverID uint, history []server.ServerMetric) (*PredictionResult, error) {
         if len(history) < 10 {
@@ -282,7 +332,8 @@ func (p *Predictor) PredictNetwork(serverID uint, history []server.ServerMetric)
 
 // AIPredict AI预测分析
 func (p *Predictor) AIPredict(serverID uint, history []server.ServerMetric) (*PredictionResult, error) {
-        if p.llmClient == nil {
+        client := clientFor(p.llmClient, serverID)
+        if client == nil {
                 return nil, fmt.Errorf("AI客户端未配置")
         }
 
@@ -316,7 +367,7 @@ func (p *Predictor) AIPredict(serverID uint, history []server.ServerMetric) (*Pr
   "actions": ["操作1", "操作2"]
 }`, dataStr)
 
-        response, err := p.llmClient.QuickChat(prompt)
+        response, err := client.QuickChat(prompt)
         if err != nil {
                 return nil, fmt.Errorf("AI分析失败: %w", err)
         }
@@ -0,0 +1,468 @@
+package routing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/global"
+	"yunwei/service/metrics/query"
+
+	"gorm.io/gorm"
+)
+
+// cacheTTL 路由树的缓存时间，其他节点上的修改最迟在此时间后生效
+const cacheTTL = 30 * time.Second
+
+// DefaultGroupInterval 根路由未配置 groupInterval 时的默认值
+const DefaultGroupInterval = 5 * time.Minute
+
+// 通道类型
+const (
+	ChannelTelegram  = "telegram"
+	ChannelWeChat    = "wechat"
+	ChannelDingTalk  = "dingtalk"
+	ChannelFeishu    = "feishu"
+	ChannelEmail     = "email"
+	ChannelSlack     = "slack"
+	ChannelTeams     = "teams"
+	ChannelWebhook   = "webhook"
+	ChannelPagerDuty = "pagerduty"
+)
+
+// Route 通知路由节点：根节点匹配全部告警，子节点按标签和级别继续细分。
+// 分组、时间和接收人留空时继承上级
+type Route struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"` // 为空为全局路由树，租户没有自己的路由树时使用
+	ParentID uint   `json:"parentId" gorm:"index"`                  // 0 为根节点
+	Name     string `json:"name" gorm:"type:varchar(64);not null"`
+	Sort     int    `json:"sort"` // 同级路由的匹配顺序
+
+	Matchers string `json:"matchers" gorm:"type:text"`      // 标签匹配条件，如 group="db"
+	Levels   string `json:"levels" gorm:"type:varchar(64)"` // 逗号分隔，为空匹配全部级别
+	Continue bool   `json:"continue"`                       // 匹配后继续尝试后面的同级路由
+
+	Receiver       string `json:"receiver" gorm:"type:varchar(64)"`       // 接收人名称
+	GroupBy        string `json:"groupBy" gorm:"type:varchar(255)"`       // 逗号分隔的分组维度，如 rule,server
+	GroupWait      string `json:"groupWait" gorm:"type:varchar(16)"`      // 新事件等待多久再发首次通知，如 30s
+	GroupInterval  string `json:"groupInterval" gorm:"type:varchar(16)"`  // 事件有新告警加入时两次通知的最小间隔，如 5m
+	RepeatInterval string `json:"repeatInterval" gorm:"type:varchar(16)"` // 未确认事件的重复提醒间隔，如 4h
+
+	Enabled bool   `json:"enabled" gorm:"default:true"`
+	Comment string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (Route) TableName() string {
+	return "notify_routes"
+}
+
+// Channel 一个通知通道的配置，用于接收人和租户的通道实例
+type Channel struct {
+	Type       string   `json:"type,omitempty"` // telegram, wechat, dingtalk, feishu, email, slack, teams, webhook, pagerduty
+	Ref        string   `json:"ref,omitempty"`  // 引用已保存的通道实例名称，设置后忽略其他字段
+	Webhook    string   `json:"webhook,omitempty"`
+	Token      string   `json:"token,omitempty"`      // Telegram Bot Token
+	ChatID     string   `json:"chatId,omitempty"`     // Telegram Chat ID，飞书应用机器人发送时为群的 chat_id
+	To         []string `json:"to,omitempty"`         // 邮件收件人，使用配置文件中的 SMTP 服务器
+	Secret     string   `json:"secret,omitempty"`     // 自定义 Webhook 的 HMAC 签名密钥
+	RoutingKey string   `json:"routingKey,omitempty"` // PagerDuty Events API v2 的集成密钥
+	AppID      string   `json:"appId,omitempty"`      // 飞书应用机器人，卡片按钮回调需要以应用身份发送
+	AppSecret  string   `json:"appSecret,omitempty"`
+}
+
+// Validate 校验通道配置
+func (ch *Channel) Validate() error {
+	if ch.Ref != "" {
+		return nil
+	}
+	switch ch.Type {
+	case ChannelTelegram:
+		if ch.Token == "" || ch.ChatID == "" {
+			return errors.New("Telegram 需要 token 和 chatId")
+		}
+	case ChannelFeishu:
+		if ch.AppID != "" || ch.AppSecret != "" {
+			if ch.AppID == "" || ch.AppSecret == "" || ch.ChatID == "" {
+				return errors.New("飞书应用机器人需要 appId、appSecret 和 chatId")
+			}
+		} else if ch.Webhook == "" {
+			return errors.New("缺少 webhook")
+		}
+	case ChannelWeChat, ChannelDingTalk, ChannelSlack, ChannelTeams, ChannelWebhook:
+		if ch.Webhook == "" {
+			return errors.New("缺少 webhook")
+		}
+	case ChannelEmail:
+		if len(ch.To) == 0 {
+			return errors.New("缺少收件人")
+		}
+	case ChannelPagerDuty:
+		// webhook 为空时使用 PagerDuty 的默认地址
+		if ch.RoutingKey == "" {
+			return errors.New("PagerDuty 需要 routingKey")
+		}
+	default:
+		extraTypesMu.RLock()
+		ok := extraTypes[ch.Type]
+		extraTypesMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("不支持的类型 %s", ch.Type)
+		}
+	}
+	return nil
+}
+
+var (
+	extraTypesMu sync.RWMutex
+	extraTypes   = make(map[string]bool)
+)
+
+// RegisterChannelType 登记插件注册的通道类型，其字段由插件创建通道时校验
+func RegisterChannelType(typ string) {
+	extraTypesMu.Lock()
+	defer extraTypesMu.Unlock()
+	extraTypes[typ] = true
+}
+
+// Receiver 接收人：一组通知通道，由路由按名称引用
+type Receiver struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"` // 为空为全局接收人，各租户的路由都可引用
+	Name     string `json:"name" gorm:"type:varchar(64);not null"`
+	Channels string `json:"channels" gorm:"type:text"` // 通知通道(JSON)
+	Comment  string `json:"comment" gorm:"type:varchar(255)"`
+}
+
+func (Receiver) TableName() string {
+	return "notify_receivers"
+}
+
+// ParseChannels 解析通知通道
+func (r *Receiver) ParseChannels() ([]Channel, error) {
+	var channels []Channel
+	if r.Channels == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(r.Channels), &channels); err != nil {
+		return nil, fmt.Errorf("通知通道格式错误: %w", err)
+	}
+	return channels, nil
+}
+
+// Validate 校验接收人
+func (r *Receiver) Validate() error {
+	if r.Name == "" {
+		return errors.New("接收人名称不能为空")
+	}
+	channels, err := r.ParseChannels()
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return errors.New("至少需要一个通知通道")
+	}
+	seen := make(map[string]bool)
+	for i, ch := range channels {
+		key := ch.Type
+		if ch.Ref != "" {
+			key = "ref:" + ch.Ref
+		}
+		if seen[key] {
+			return fmt.Errorf("第 %d 个通道: 同一接收人下每种类型只能配置一个，同一通道实例只能引用一次", i+1)
+		}
+		seen[key] = true
+		if err := ch.Validate(); err != nil {
+			return fmt.Errorf("第 %d 个通道: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+var validLevels = map[string]struct{}{
+	"info":      {},
+	"warning":   {},
+	"critical":  {},
+	"emergency": {},
+}
+
+// Validate 校验路由节点本身，父子关系由调用方检查
+func (r *Route) Validate() error {
+	if r.Name == "" {
+		return errors.New("路由名称不能为空")
+	}
+	if r.ParentID == 0 {
+		if r.Matchers != "" || r.Levels != "" {
+			return errors.New("根路由匹配全部告警，不能设置匹配条件")
+		}
+		if r.Receiver == "" {
+			return errors.New("根路由必须指定接收人")
+		}
+	}
+	if _, err := query.ParseMatchers(r.Matchers); err != nil {
+		return errors.New("匹配条件: " + err.Error())
+	}
+	for _, l := range splitList(r.Levels) {
+		if _, ok := validLevels[l]; !ok {
+			return fmt.Errorf("未知的告警级别 %s", l)
+		}
+	}
+	for name, v := range map[string]string{
+		"groupWait":      r.GroupWait,
+		"groupInterval":  r.GroupInterval,
+		"repeatInterval": r.RepeatInterval,
+	} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			return fmt.Errorf("%s 格式错误，应为 30s、5m、4h 这样的时长", name)
+		}
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Match 告警命中的路由，分组、时间和接收人已按上级补全。
+// RepeatInterval 为 0 表示使用告警配置中的默认值
+type Match struct {
+	RouteID        uint          `json:"routeId"`
+	Path           []string      `json:"path"` // 从根路由到命中路由的名称
+	Receiver       string        `json:"receiver"`
+	GroupBy        []string      `json:"groupBy"`
+	GroupWait      time.Duration `json:"groupWait"`
+	GroupInterval  time.Duration `json:"groupInterval"`
+	RepeatInterval time.Duration `json:"repeatInterval"`
+}
+
+type node struct {
+	route    Route
+	matchers []*query.Matcher
+	levels   []string
+	children []*node
+	resolved Match
+}
+
+func (n *node) matches(labels map[string]string, level string) bool {
+	for _, m := range n.matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	if len(n.levels) == 0 {
+		return true
+	}
+	for _, l := range n.levels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// match 深度优先匹配子路由，没有子路由命中时由当前节点接收。
+// 子路由命中后，除非设置了 continue，不再尝试后面的同级路由
+func (n *node) match(labels map[string]string, level string) []Match {
+	var out []Match
+	for _, c := range n.children {
+		if !c.matches(labels, level) {
+			continue
+		}
+		out = append(out, c.match(labels, level)...)
+		if !c.route.Continue {
+			break
+		}
+	}
+	if len(out) == 0 {
+		out = []Match{n.resolved}
+	}
+	return out
+}
+
+// resolve 按上级补全分组、时间和接收人
+func (n *node) resolve(parent Match) {
+	r := &n.route
+	m := parent
+	m.RouteID = r.ID
+	m.Path = append(append([]string(nil), parent.Path...), r.Name)
+	if r.Receiver != "" {
+		m.Receiver = r.Receiver
+	}
+	if groupBy := splitList(r.GroupBy); len(groupBy) > 0 {
+		m.GroupBy = groupBy
+	}
+	if d, err := time.ParseDuration(r.GroupWait); err == nil {
+		m.GroupWait = d
+	}
+	if d, err := time.ParseDuration(r.GroupInterval); err == nil {
+		m.GroupInterval = d
+	}
+	if d, err := time.ParseDuration(r.RepeatInterval); err == nil {
+		m.RepeatInterval = d
+	}
+	n.resolved = m
+	for _, c := range n.children {
+		c.resolve(m)
+	}
+}
+
+// Service 通知路由，按租户缓存路由树和接收人
+type Service struct {
+	db *gorm.DB
+
+	mu        sync.Mutex
+	loadedAt  time.Time
+	roots     map[string]*node // 租户ID → 根节点，"" 为全局
+	nodes     map[uint]*node
+	receivers map[string]map[string]*Receiver // 租户ID → 名称 → 接收人
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局通知路由服务
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB)
+	})
+	return globalService
+}
+
+// NewService 创建通知路由服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Invalidate 路由或接收人变更后清空缓存
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadedAt = time.Time{}
+}
+
+// Match 按租户的路由树匹配告警，租户没有自己的路由树时使用全局路由树；都没有配置时返回 nil
+func (s *Service) Match(tenantID string, labels map[string]string, level string) []Match {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+
+	root, ok := s.roots[tenantID]
+	if !ok {
+		root, ok = s.roots[""]
+	}
+	if !ok {
+		return nil
+	}
+	return root.match(labels, level)
+}
+
+// Route 按ID查询补全后的路由，路由已删除或停用时返回 false
+func (s *Service) Route(id uint) (Match, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+
+	n, ok := s.nodes[id]
+	if !ok {
+		return Match{}, false
+	}
+	return n.resolved, true
+}
+
+// Receiver 按名称查询接收人，先找租户自己的，再找全局的
+func (s *Service) Receiver(tenantID, name string) *Receiver {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.load()
+
+	if r, ok := s.receivers[tenantID][name]; ok {
+		return r
+	}
+	if r, ok := s.receivers[""][name]; ok {
+		return r
+	}
+	return nil
+}
+
+// load 缓存过期时重新加载，调用方持有锁
+func (s *Service) load() {
+	if time.Since(s.loadedAt) < cacheTTL {
+		return
+	}
+	s.loadedAt = time.Now()
+	s.roots = make(map[string]*node)
+	s.nodes = make(map[uint]*node)
+	s.receivers = make(map[string]map[string]*Receiver)
+
+	var receivers []Receiver
+	s.db.Find(&receivers)
+	for i := range receivers {
+		r := &receivers[i]
+		if s.receivers[r.TenantID] == nil {
+			s.receivers[r.TenantID] = make(map[string]*Receiver)
+		}
+		s.receivers[r.TenantID][r.Name] = r
+	}
+
+	var routes []Route
+	s.db.Where("enabled = ?", true).Order("sort, id").Find(&routes)
+	for _, r := range routes {
+		matchers, err := query.ParseMatchers(r.Matchers)
+		if err != nil {
+			global.Logger.Warn(fmt.Sprintf("通知路由 %d 匹配条件无效，已跳过: %v", r.ID, err))
+			continue
+		}
+		s.nodes[r.ID] = &node{route: r, matchers: matchers, levels: splitList(r.Levels)}
+	}
+	// 停用节点的子路由随之失效
+	for _, r := range routes {
+		n, ok := s.nodes[r.ID]
+		if !ok {
+			continue
+		}
+		if r.ParentID == 0 {
+			if _, dup := s.roots[r.TenantID]; !dup {
+				s.roots[r.TenantID] = n
+			}
+			continue
+		}
+		if parent, ok := s.nodes[r.ParentID]; ok {
+			parent.children = append(parent.children, n)
+		}
+	}
+
+	reachable := make(map[uint]*node)
+	for _, root := range s.roots {
+		root.resolve(Match{GroupInterval: DefaultGroupInterval})
+		collect(root, reachable)
+	}
+	s.nodes = reachable
+}
+
+// collect 收集从根节点可达的路由，父路由已停用或已删除的子路由不会出现
+func collect(n *node, out map[uint]*node) {
+	out[n.route.ID] = n
+	for _, c := range n.children {
+		collect(c, out)
+	}
+}
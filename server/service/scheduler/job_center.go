@@ -45,6 +45,7 @@ func NewJobCenter() *JobCenter {
                 cron:       cronScheduler,
                 ctx:        ctx,
                 cancel:     cancel,
+                notifier:   notify.Default(),
         }
 }
 
@@ -2,9 +2,11 @@ package security
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"yunwei/global"
+	"yunwei/service/event"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -74,7 +76,11 @@ func (s *AuditService) Log(params LogParams) error {
 		log.Result = string(detailsJSON)
 	}
 
-	return global.DB.Create(&log).Error
+	if err := global.DB.Create(&log).Error; err != nil {
+		return err
+	}
+	publishChange(&log)
+	return nil
 }
 
 // LogFromGin 从Gin上下文记录日志
@@ -110,7 +116,43 @@ func (s *AuditService) LogFromGin(c *gin.Context, params LogParams) error {
 		UserAgent:  c.GetHeader("User-Agent"),
 	}
 
-	return global.DB.Create(&log).Error
+	if err := global.DB.Create(&log).Error; err != nil {
+		return err
+	}
+	publishChange(&log)
+	return nil
+}
+
+// changeActions 审计动作中属于配置变更、需要进入事件时间线的动作
+var changeActions = map[string]string{
+	string(AuditActionCreate): "新增",
+	string(AuditActionUpdate): "修改",
+	string(AuditActionDelete): "删除",
+	string(AuditActionImport): "导入",
+	string(AuditActionConfig): "配置",
+}
+
+// publishChange 把增删改类的审计日志作为配置变更写入事件流
+func publishChange(log *AuditLog) {
+	verb, ok := changeActions[log.Action]
+	if !ok {
+		return
+	}
+	ev := &event.Event{
+		Type:     event.TypeConfig,
+		Action:   log.Action,
+		Severity: event.SeverityInfo,
+		Title:    fmt.Sprintf("%s %s", verb, log.Resource),
+		Detail:   log.Command,
+		Labels:   event.MakeLabels("resource", log.Resource),
+		Source:   "audit_log",
+		SourceID: log.ID,
+		Actor:    log.Username,
+	}
+	if log.ServerID > 0 {
+		ev.Servers = []uint{log.ServerID}
+	}
+	event.Publish(ev)
 }
 
 // LogLogin 记录登录
@@ -148,20 +190,20 @@ func (s *AuditService) LogCommand(userID uint, username string, serverID uint, s
 	return global.DB.Create(&log).Error
 }
 
-// LogApproval 记录审批
-func (s *AuditService) LogApproval(userID uint, username string, executionID uint, approved bool, reason string) error {
-	result := "approved"
+// LogApproval 记录审批，resource 为审批对象类型，如 execution、decision
+func (s *AuditService) LogApproval(userID uint, username string, resource string, resourceID uint, approved bool, reason string) error {
+	action, result := AuditActionApprove, "approved"
 	if !approved {
-		result = "rejected"
+		action, result = AuditActionReject, "rejected"
 	}
 
 	log := AuditLog{
 		UserID:   userID,
 		Username: username,
-		Action:   string(AuditActionApprove),
-		Resource: "execution",
+		Action:   string(action),
+		Resource: resource,
 		Result:   result,
-		Command:  reason,
+		Command:  fmt.Sprintf("#%d %s", resourceID, reason),
 	}
 
 	return global.DB.Create(&log).Error
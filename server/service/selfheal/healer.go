@@ -9,6 +9,7 @@ import (
 	"yunwei/global"
 	"yunwei/model/server"
 	"yunwei/service/notify"
+	"yunwei/service/silence"
 )
 
 // HealStatus 自愈状态
@@ -20,6 +21,7 @@ const (
 	HealStatusSuccess   HealStatus = "success"
 	HealStatusFailed    HealStatus = "failed"
 	HealStatusTimeout   HealStatus = "timeout"
+	HealStatusSkipped   HealStatus = "skipped"
 )
 
 // ServiceType 服务类型
@@ -154,7 +156,8 @@ type CommandExecutor interface {
 // NewSelfHealer 创建自愈系统
 func NewSelfHealer() *SelfHealer {
 	return &SelfHealer{
-		rules: GetDefaultHealRules(),
+		rules:    GetDefaultHealRules(),
+		notifier: notify.Default(),
 	}
 }
 
@@ -528,6 +531,29 @@ func (h *SelfHealer) checkAndTriggerHeal(srv *server.Server, serviceType Service
 			}
 
 			problemDesc := fmt.Sprintf("服务 %s %s，连续失败 %d 次", serviceType, health.Status, health.FailCount)
+
+			// 静默或维护窗口内不自动自愈，同一窗口只记录一次跳过；手动 ForceHeal 不受影响
+			if m := silence.GetService().HealSuppressed(srv.ID, time.Now()); m != nil {
+				reason := "处于" + m.String()
+				var last HealAction
+				err := global.DB.Where("server_id = ? AND service_type = ?", srv.ID, serviceType).
+					Order("created_at DESC").First(&last).Error
+				if err != nil || last.Status != HealStatusSkipped || last.ErrorMessage != reason {
+					global.DB.Create(&HealAction{
+						ServerID:     srv.ID,
+						ServiceType:  serviceType,
+						ServiceName:  string(serviceType),
+						ProblemType:  problemType,
+						ProblemDesc:  problemDesc,
+						DetectedAt:   time.Now(),
+						Status:       HealStatusSkipped,
+						ActionType:   rule.ActionType,
+						ErrorMessage: reason,
+					})
+				}
+				break
+			}
+
 			h.TriggerHeal(srv, serviceType, problemType, problemDesc)
 			break
 		}
@@ -8,7 +8,9 @@ import (
 
 	"yunwei/global"
 	"yunwei/model/server"
-	"yunwei/service/notifier"
+	"yunwei/service/event"
+	"yunwei/service/notify"
+	"yunwei/service/silence"
 )
 
 // ServiceType 服务类型
@@ -121,7 +123,7 @@ func (HealRecord) TableName() string {
 // SelfHealingEngine 自愈引擎
 type SelfHealingEngine struct {
 	rules      []ServiceRule
-	notifier   *notifier.NotifierService
+	notifier   notify.Notifier
 	executor   CommandExecutor
 	healCounts map[uint]map[time.Time]int // 每小时自愈计数
 }
@@ -135,7 +137,7 @@ type CommandExecutor interface {
 func NewSelfHealingEngine() *SelfHealingEngine {
 	return &SelfHealingEngine{
 		rules:      getDefaultRules(),
-		notifier:   notifier.NewNotifierService(),
+		notifier:   notify.Default(),
 		healCounts: make(map[uint]map[time.Time]int),
 	}
 }
@@ -146,7 +148,7 @@ func (e *SelfHealingEngine) SetExecutor(executor CommandExecutor) {
 }
 
 // SetNotifier 设置通知服务
-func (e *SelfHealingEngine) SetNotifier(n *notifier.NotifierService) {
+func (e *SelfHealingEngine) SetNotifier(n notify.Notifier) {
 	e.notifier = n
 }
 
@@ -273,6 +275,14 @@ func (e *SelfHealingEngine) HealService(serverID uint, rule ServiceRule, issueDe
 		RetryCount:  0,
 	}
 
+	// 静默或维护窗口内暂停自愈，避免与计划内操作冲突
+	if m := silence.GetService().HealSuppressed(serverID, time.Now()); m != nil {
+		record.Status = HealStatusSkipped
+		record.Error = "处于" + m.String()
+		global.DB.Create(record)
+		return record, fmt.Errorf("处于%s，暂停自愈", m)
+	}
+
 	// 检查自愈次数限制
 	if !e.canHeal(serverID, rule) {
 		record.Status = HealStatusSkipped
@@ -329,6 +339,7 @@ func (e *SelfHealingEngine) HealService(serverID uint, rule ServiceRule, issueDe
 
 	// 保存记录
 	global.DB.Save(record)
+	publishHeal(record)
 
 	// 发送通知
 	go e.sendNotification(record, rule)
@@ -336,6 +347,25 @@ func (e *SelfHealingEngine) HealService(serverID uint, rule ServiceRule, issueDe
 	return record, nil
 }
 
+// publishHeal 执行过的自愈写入事件流，跳过的不算变更
+func publishHeal(record *HealRecord) {
+	action, severity := "succeeded", event.SeverityInfo
+	if record.Status != HealStatusSuccess {
+		action, severity = "failed", event.SeverityWarning
+	}
+	event.Publish(&event.Event{
+		Type:     event.TypeHeal,
+		Action:   action,
+		Severity: severity,
+		Title:    fmt.Sprintf("自愈 %s: %s", record.ServiceName, record.Action),
+		Detail:   strings.TrimSpace(record.Command + "\n" + record.Error),
+		Labels:   event.MakeLabels("service", record.ServiceName, "action", string(record.Action)),
+		Servers:  []uint{record.ServerID},
+		Source:   "heal_record",
+		SourceID: record.ID,
+	})
+}
+
 // executeHeal 执行自愈命令
 func (e *SelfHealingEngine) executeHeal(serverID uint, rule ServiceRule) (string, error) {
 	if e.executor == nil {
@@ -387,7 +417,7 @@ func (e *SelfHealingEngine) sendNotification(record *HealRecord, rule ServiceRul
 			"服务器: %s\n服务: %s\n动作: %s\n问题: %s\n耗时: %dms",
 			serverName, record.ServiceName, record.Action, record.IssueDetail, record.Duration,
 		)
-		e.notifier.Broadcast(title, content)
+		e.notifier.SendMessage(title, content)
 		record.Notified = true
 	} else if record.Status == HealStatusFailed && rule.NotifyOnFail {
 		title := fmt.Sprintf("❌ 服务自愈失败 - %s", record.ServiceName)
@@ -395,7 +425,7 @@ func (e *SelfHealingEngine) sendNotification(record *HealRecord, rule ServiceRul
 			"服务器: %s\n服务: %s\n动作: %s\n问题: %s\n错误: %s\n重试次数: %d",
 			serverName, record.ServiceName, record.Action, record.IssueDetail, record.Error, record.RetryCount,
 		)
-		e.notifier.Broadcast(title, content)
+		e.notifier.SendMessage(title, content)
 		record.Notified = true
 	}
 
@@ -531,6 +561,7 @@ func (e *SelfHealingEngine) DockerContainerHeal(serverID uint, containerName str
 	}
 
 	global.DB.Save(record)
+	publishHeal(record)
 	go e.sendNotification(record, rule)
 
 	return record, err
@@ -0,0 +1,347 @@
+package silence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"yunwei/global"
+	"yunwei/service/metrics/query"
+
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// LabelRule 告警规则名，其余可用标签与指标查询相同（server、server_id、group、tenant 等）
+const LabelRule = "rule"
+
+// cacheTTL 静默和维护窗口的缓存时间，其他节点上的修改最迟在此时间后生效
+const cacheTTL = 30 * time.Second
+
+// 命中类型
+const (
+	KindSilence     = "silence"
+	KindMaintenance = "maintenance"
+)
+
+// Silence 静默：在指定时间段内屏蔽匹配标签的告警通知
+type Silence struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Matchers string    `json:"matchers" gorm:"type:text;not null"` // 如 server="web-01", rule=~"磁盘.*"
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt" gorm:"index"`
+	Comment  string    `json:"comment" gorm:"type:varchar(255)"`
+
+	CreatedBy uint   `json:"createdBy"`
+	Creator   string `json:"creator" gorm:"type:varchar(64)"`
+
+	SuppressHeal     bool `json:"suppressHeal"`     // 同时暂停匹配主机的自愈
+	SuppressAutoExec bool `json:"suppressAutoExec"` // 同时暂停匹配主机的 AI 自动执行
+}
+
+func (Silence) TableName() string {
+	return "alert_silences"
+}
+
+// MaintenanceWindow 周期性维护窗口：按 cron 表达式开始，持续 Duration 分钟
+type MaintenanceWindow struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Name     string `json:"name" gorm:"type:varchar(64);not null"`
+	Matchers string `json:"matchers" gorm:"type:text;not null"` // 作用范围，如 group="db"
+	Schedule string `json:"schedule" gorm:"type:varchar(128)"`  // 开始时间，如 "0 2 * * 0" 每周日 02:00，可加 CRON_TZ= 前缀
+	Duration int    `json:"duration"`                           // 持续时间(分钟)
+	Enabled  bool   `json:"enabled" gorm:"default:true"`
+	Comment  string `json:"comment" gorm:"type:varchar(255)"`
+
+	CreatedBy uint   `json:"createdBy"`
+	Creator   string `json:"creator" gorm:"type:varchar(64)"`
+
+	SuppressHeal     bool `json:"suppressHeal" gorm:"default:true"`
+	SuppressAutoExec bool `json:"suppressAutoExec" gorm:"default:true"`
+}
+
+func (MaintenanceWindow) TableName() string {
+	return "maintenance_windows"
+}
+
+// Match 命中的静默或维护窗口
+type Match struct {
+	Kind   string    `json:"kind"` // silence, maintenance
+	ID     uint      `json:"id"`
+	Name   string    `json:"name"`
+	EndsAt time.Time `json:"endsAt"`
+}
+
+func (m *Match) String() string {
+	if m.Kind == KindMaintenance {
+		return fmt.Sprintf("维护窗口 %s（至 %s）", m.Name, m.EndsAt.Format("2006-01-02 15:04"))
+	}
+	return fmt.Sprintf("静默 #%d %s（至 %s）", m.ID, m.Name, m.EndsAt.Format("2006-01-02 15:04"))
+}
+
+// purpose 检查用途
+type purpose int
+
+const (
+	purposeNotify purpose = iota
+	purposeHeal
+	purposeAutoExec
+)
+
+type activeSilence struct {
+	silence  Silence
+	matchers []*query.Matcher
+}
+
+type activeWindow struct {
+	window   MaintenanceWindow
+	matchers []*query.Matcher
+	schedule cron.Schedule
+}
+
+// Service 静默与维护窗口判断
+type Service struct {
+	db      *gorm.DB
+	targets func(tenantID string) ([]query.Target, error)
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	silences []*activeSilence
+	windows  []*activeWindow
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局静默服务
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB, query.GetEngine().Targets)
+	})
+	return globalService
+}
+
+// NewService 创建静默服务，targets 用于按服务器ID查标签
+func NewService(db *gorm.DB, targets func(tenantID string) ([]query.Target, error)) *Service {
+	return &Service{db: db, targets: targets}
+}
+
+// Invalidate 静默或维护窗口变更后清空缓存
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadedAt = time.Time{}
+}
+
+// Silenced 告警标签是否被静默或处于维护窗口，命中时不发送通知
+func (s *Service) Silenced(labels map[string]string, now time.Time) *Match {
+	return s.match(labels, now, purposeNotify)
+}
+
+// HealSuppressed 服务器是否处于暂停自愈的静默或维护窗口
+func (s *Service) HealSuppressed(serverID uint, now time.Time) *Match {
+	return s.match(s.ServerLabels(serverID), now, purposeHeal)
+}
+
+// AutoExecSuppressed 服务器是否处于暂停 AI 自动执行的静默或维护窗口
+func (s *Service) AutoExecSuppressed(serverID uint, now time.Time) *Match {
+	return s.match(s.ServerLabels(serverID), now, purposeAutoExec)
+}
+
+// ServerLabels 服务器的标签，查询失败时只有 server_id
+func (s *Service) ServerLabels(serverID uint) map[string]string {
+	id := strconv.FormatUint(uint64(serverID), 10)
+	targets, err := s.targets("")
+	if err == nil {
+		for _, t := range targets {
+			if t.ServerID == serverID {
+				return t.Labels
+			}
+		}
+	}
+	return map[string]string{query.LabelServerID: id}
+}
+
+func (s *Service) match(labels map[string]string, now time.Time, p purpose) *Match {
+	s.load(now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.silences {
+		sl := &a.silence
+		if now.Before(sl.StartsAt) || !now.Before(sl.EndsAt) {
+			continue
+		}
+		if p == purposeHeal && !sl.SuppressHeal || p == purposeAutoExec && !sl.SuppressAutoExec {
+			continue
+		}
+		if matchAll(a.matchers, labels) {
+			return &Match{Kind: KindSilence, ID: sl.ID, Name: sl.Comment, EndsAt: sl.EndsAt}
+		}
+	}
+	for _, a := range s.windows {
+		w := &a.window
+		if p == purposeHeal && !w.SuppressHeal || p == purposeAutoExec && !w.SuppressAutoExec {
+			continue
+		}
+		_, end, ok := activeAt(a.schedule, time.Duration(w.Duration)*time.Minute, now)
+		if ok && matchAll(a.matchers, labels) {
+			return &Match{Kind: KindMaintenance, ID: w.ID, Name: w.Name, EndsAt: end}
+		}
+	}
+	return nil
+}
+
+// load 按需从数据库加载生效中的静默和启用的维护窗口，失败时沿用旧数据
+func (s *Service) load(now time.Time) {
+	s.mu.Lock()
+	fresh := !s.loadedAt.IsZero() && now.Sub(s.loadedAt) < cacheTTL
+	s.mu.Unlock()
+	if fresh {
+		return
+	}
+
+	var silences []Silence
+	if err := s.db.Where("ends_at > ?", now).Find(&silences).Error; err != nil {
+		global.Logger.Warn(fmt.Sprintf("加载静默失败: %v", err))
+		return
+	}
+	var windows []MaintenanceWindow
+	if err := s.db.Where("enabled = ?", true).Find(&windows).Error; err != nil {
+		global.Logger.Warn(fmt.Sprintf("加载维护窗口失败: %v", err))
+		return
+	}
+
+	activeSilences := make([]*activeSilence, 0, len(silences))
+	for _, sl := range silences {
+		matchers, err := ParseMatchers(sl.Matchers)
+		if err != nil {
+			continue
+		}
+		activeSilences = append(activeSilences, &activeSilence{silence: sl, matchers: matchers})
+	}
+	activeWindows := make([]*activeWindow, 0, len(windows))
+	for _, w := range windows {
+		matchers, err := ParseMatchers(w.Matchers)
+		if err != nil {
+			continue
+		}
+		schedule, err := ParseSchedule(w.Schedule)
+		if err != nil {
+			continue
+		}
+		activeWindows = append(activeWindows, &activeWindow{window: w, matchers: matchers, schedule: schedule})
+	}
+
+	s.mu.Lock()
+	s.silences = activeSilences
+	s.windows = activeWindows
+	s.loadedAt = now
+	s.mu.Unlock()
+}
+
+// ==================== 校验 ====================
+
+// ParseMatchers 解析标签匹配条件，至少要有一个不匹配空值的条件，避免误静默全部告警
+func ParseMatchers(text string) ([]*query.Matcher, error) {
+	matchers, err := query.ParseMatchers(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matchers {
+		if !m.Matches("") {
+			return matchers, nil
+		}
+	}
+	return nil, errors.New("至少需要一个不匹配空值的条件，如 server=\"web-01\"")
+}
+
+// ParseSchedule 解析维护窗口的 cron 表达式（分 时 日 月 周）
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 cron 表达式: %w", err)
+	}
+	return schedule, nil
+}
+
+// Validate 校验静默
+func (sl *Silence) Validate() error {
+	if _, err := ParseMatchers(sl.Matchers); err != nil {
+		return err
+	}
+	if !sl.EndsAt.After(sl.StartsAt) {
+		return errors.New("结束时间必须晚于开始时间")
+	}
+	return nil
+}
+
+// Validate 校验维护窗口
+func (w *MaintenanceWindow) Validate() error {
+	if w.Name == "" {
+		return errors.New("维护窗口名称不能为空")
+	}
+	if _, err := ParseMatchers(w.Matchers); err != nil {
+		return err
+	}
+	if _, err := ParseSchedule(w.Schedule); err != nil {
+		return err
+	}
+	if w.Duration <= 0 {
+		return errors.New("持续时间必须大于 0")
+	}
+	return nil
+}
+
+// NextRuns 维护窗口接下来 n 次的开始和结束时间，正在进行的窗口排在最前
+func (w *MaintenanceWindow) NextRuns(now time.Time, n int) ([][2]time.Time, error) {
+	schedule, err := ParseSchedule(w.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	d := time.Duration(w.Duration) * time.Minute
+	var runs [][2]time.Time
+	if start, end, ok := activeAt(schedule, d, now); ok {
+		runs = append(runs, [2]time.Time{start, end})
+	}
+	for t := now; len(runs) < n; {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		runs = append(runs, [2]time.Time{t, t.Add(d)})
+	}
+	return runs, nil
+}
+
+// activeAt now 是否落在某次窗口内：即 (now-d, now] 之间有一次开始时间
+func activeAt(schedule cron.Schedule, d time.Duration, now time.Time) (time.Time, time.Time, bool) {
+	if d <= 0 {
+		return time.Time{}, time.Time{}, false
+	}
+	start := schedule.Next(now.Add(-d))
+	if start.IsZero() || start.After(now) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, start.Add(d), true
+}
+
+func matchAll(matchers []*query.Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+package slo
+
+import (
+	"time"
+)
+
+// DailyPoint 报告中一天的统计，预算为窗口开始到当天结束的累计值
+type DailyPoint struct {
+	Date            string  `json:"date"`
+	Good            float64 `json:"good"`
+	Total           float64 `json:"total"`
+	SLI             float64 `json:"sli"`             // 当天达标比例(%)，没有事件时为 0
+	BudgetRemaining float64 `json:"budgetRemaining"` // 截至当天结束的剩余预算(%)
+}
+
+// Report SLO 报告
+type Report struct {
+	SLO         *SLO         `json:"slo"`
+	WindowStart time.Time    `json:"windowStart"`
+	WindowEnd   time.Time    `json:"windowEnd"`
+	Evaluation  *Evaluation  `json:"evaluation"`
+	Daily       []DailyPoint `json:"daily"` // 预算消耗曲线，最后一天截止到 WindowEnd
+}
+
+// Report 生成 SLO 在当前滚动窗口内的报告，包括燃烧率和按天的预算消耗
+func (s *Service) Report(o *SLO, now time.Time) (*Report, error) {
+	ev, err := s.Evaluate(o, now)
+	if err != nil {
+		return nil, err
+	}
+	start := now.Add(-o.Window())
+	report := &Report{SLO: o, WindowStart: start, WindowEnd: now, Evaluation: ev}
+
+	var cumulative Ratio
+	for dayStart := start; dayStart.Before(now); dayStart = dayStart.Add(24 * time.Hour) {
+		dayEnd := dayStart.Add(24 * time.Hour)
+		if dayEnd.After(now) {
+			dayEnd = now
+		}
+		r, err := s.Ratio(o, dayStart, dayEnd)
+		if err != nil {
+			return nil, err
+		}
+		cumulative.Good += r.Good
+		cumulative.Total += r.Total
+
+		p := DailyPoint{Date: dayEnd.Format("2006-01-02"), Good: r.Good, Total: r.Total, BudgetRemaining: 100}
+		if e, ok := r.errorRate(); ok {
+			p.SLI = round((1 - e) * 100)
+		}
+		if e, ok := cumulative.errorRate(); ok {
+			p.BudgetRemaining = round(100 - e/o.budget()*100)
+		}
+		report.Daily = append(report.Daily, p)
+	}
+	return report, nil
+}
@@ -0,0 +1,342 @@
+package slo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"yunwei/global"
+	"yunwei/service/detector"
+	"yunwei/service/metrics/query"
+	"yunwei/service/synthetic"
+
+	"gorm.io/gorm"
+)
+
+// evalInterval SLO 求值间隔
+const evalInterval = time.Minute
+
+// burnRule 多窗口燃烧率告警规则：长短两个窗口的燃烧率都达到阈值时触发。
+// 阈值由长窗口内消耗的预算比例换算，30 天窗口下依次为 14.4、6、3、1
+type burnRule struct {
+	Long, Short time.Duration
+	Budget      float64 // 长窗口内消耗的预算比例
+	Level       detector.AlertLevel
+}
+
+var burnRules = []burnRule{
+	{time.Hour, 5 * time.Minute, 0.02, detector.AlertLevelCritical},
+	{6 * time.Hour, 30 * time.Minute, 0.05, detector.AlertLevelCritical},
+	{24 * time.Hour, 2 * time.Hour, 0.10, detector.AlertLevelWarning},
+	{72 * time.Hour, 6 * time.Hour, 0.10, detector.AlertLevelWarning},
+}
+
+// threshold 规则在给定滚动窗口下的燃烧率阈值，不低于 1，低于 1 时预算在窗口内不会耗尽
+func (r burnRule) threshold(window time.Duration) float64 {
+	return math.Max(r.Budget*float64(window)/float64(r.Long), 1)
+}
+
+// Ratio 一段时间内的达标事件数和总事件数
+type Ratio struct {
+	Good  float64 `json:"good"`
+	Total float64 `json:"total"`
+}
+
+// errorRate 失败比例，没有事件时 ok 为 false
+func (r Ratio) errorRate() (float64, bool) {
+	if r.Total <= 0 {
+		return 0, false
+	}
+	rate := 1 - r.Good/r.Total
+	return math.Min(math.Max(rate, 0), 1), true
+}
+
+// BurnRate 燃烧率告警规则的求值结果
+type BurnRate struct {
+	LongWindow  string              `json:"longWindow"`
+	ShortWindow string              `json:"shortWindow"`
+	LongRate    float64             `json:"longRate"`  // 长窗口燃烧率，1 表示恰好在窗口结束时耗尽预算
+	ShortRate   float64             `json:"shortRate"` // 短窗口燃烧率
+	Threshold   float64             `json:"threshold"`
+	Level       detector.AlertLevel `json:"level"`
+	Firing      bool                `json:"firing"`
+}
+
+// Evaluation 一次 SLO 求值的结果
+type Evaluation struct {
+	Ratio
+	SLI             float64    `json:"sli"`             // 达标比例(%)
+	AllowedFailures float64    `json:"allowedFailures"` // 窗口内允许的失败事件数
+	BudgetConsumed  float64    `json:"budgetConsumed"`  // 已消耗的错误预算(%)
+	BudgetRemaining float64    `json:"budgetRemaining"` // 剩余错误预算(%)，超支时为负
+	BurnRates       []BurnRate `json:"burnRates"`
+	Status          string     `json:"status"`
+}
+
+// Service SLO 服务，由 Leader 定时求值并同步燃烧率告警，同时为发布流程提供错误预算检查
+type Service struct {
+	db     *gorm.DB
+	engine *query.Engine
+
+	mu       sync.Mutex
+	isLeader func() bool
+	cancel   context.CancelFunc
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局 SLO 服务
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB, query.GetEngine())
+	})
+	return globalService
+}
+
+// NewService 创建 SLO 服务
+func NewService(db *gorm.DB, engine *query.Engine) *Service {
+	return &Service{
+		db:       db,
+		engine:   engine,
+		isLeader: func() bool { return true },
+	}
+}
+
+// SetLeaderCheck 设置 Leader 判断，集群中只有 Leader 求值，避免重复告警
+func (s *Service) SetLeaderCheck(fn func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn != nil {
+		s.isLeader = fn
+	}
+}
+
+// Start 启动定时求值
+func (s *Service) Start(ctx context.Context) {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(evalInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.mu.Lock()
+				leader := s.isLeader()
+				s.mu.Unlock()
+				if leader {
+					s.evaluateAll(now)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止定时求值
+func (s *Service) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+func (s *Service) evaluateAll(now time.Time) {
+	var items []SLO
+	s.db.Where("enabled = ?", true).Find(&items)
+	for i := range items {
+		if _, err := s.Sync(&items[i], now); err != nil {
+			global.Logger.Warn(fmt.Sprintf("SLO %s 求值失败: %v", items[i].Name, err))
+		}
+	}
+}
+
+// Sync 求值并保存状态、同步燃烧率告警
+func (s *Service) Sync(o *SLO, now time.Time) (*Evaluation, error) {
+	ev, err := s.Evaluate(o, now)
+	if err != nil {
+		s.db.Model(&SLO{}).Where("id = ?", o.ID).Updates(map[string]interface{}{
+			"last_eval_at": now,
+			"last_error":   truncate(err.Error(), 500),
+		})
+		return nil, err
+	}
+
+	o.Status, o.SLI, o.BudgetRemaining, o.LastEvalAt, o.LastError = ev.Status, ev.SLI, ev.BudgetRemaining, &now, ""
+	s.db.Model(&SLO{}).Where("id = ?", o.ID).Updates(map[string]interface{}{
+		"status":           o.Status,
+		"sli":              o.SLI,
+		"budget_remaining": o.BudgetRemaining,
+		"last_eval_at":     now,
+		"last_error":       "",
+	})
+
+	var burns []detector.SLOBurn
+	for _, b := range ev.BurnRates {
+		if b.Firing {
+			burns = append(burns, detector.SLOBurn{
+				Level:       b.Level,
+				LongWindow:  b.LongWindow,
+				ShortWindow: b.ShortWindow,
+				Rate:        math.Min(b.LongRate, b.ShortRate),
+				Threshold:   b.Threshold,
+			})
+		}
+	}
+	detector.GetAlertManager().SyncSLO(sloInfo(o), burns, now)
+	return ev, nil
+}
+
+// Evaluate 计算滚动窗口内的 SLI、错误预算和各燃烧率规则，不保存结果
+func (s *Service) Evaluate(o *SLO, now time.Time) (*Evaluation, error) {
+	window := o.Window()
+	total, err := s.Ratio(o, now.Add(-window), now)
+	if err != nil {
+		return nil, err
+	}
+	ev := &Evaluation{Ratio: total, Status: StatusNoData}
+	errRate, ok := total.errorRate()
+	if !ok {
+		return ev, nil
+	}
+	ev.SLI = round((1 - errRate) * 100)
+	ev.AllowedFailures = round(total.Total * o.budget())
+	ev.BudgetConsumed = round(errRate / o.budget() * 100)
+	ev.BudgetRemaining = round(100 - ev.BudgetConsumed)
+
+	rates := make(map[time.Duration]float64)
+	burnRate := func(d time.Duration) (float64, error) {
+		if r, ok := rates[d]; ok {
+			return r, nil
+		}
+		ratio, err := s.Ratio(o, now.Add(-d), now)
+		if err != nil {
+			return 0, err
+		}
+		e, _ := ratio.errorRate()
+		rates[d] = round(e / o.budget())
+		return rates[d], nil
+	}
+	firing := false
+	for _, rule := range burnRules {
+		long, err := burnRate(rule.Long)
+		if err != nil {
+			return nil, err
+		}
+		short, err := burnRate(rule.Short)
+		if err != nil {
+			return nil, err
+		}
+		threshold := round(rule.threshold(window))
+		b := BurnRate{
+			LongWindow:  query.FormatDuration(rule.Long),
+			ShortWindow: query.FormatDuration(rule.Short),
+			LongRate:    long,
+			ShortRate:   short,
+			Threshold:   threshold,
+			Level:       rule.Level,
+			Firing:      long >= threshold && short >= threshold,
+		}
+		firing = firing || b.Firing
+		ev.BurnRates = append(ev.BurnRates, b)
+	}
+
+	switch {
+	case ev.BudgetRemaining <= 0:
+		ev.Status = StatusExhausted
+	case firing:
+		ev.Status = StatusBurning
+	default:
+		ev.Status = StatusOK
+	}
+	return ev, nil
+}
+
+// Ratio 统计 (start, end] 内的达标事件数和总事件数
+func (s *Service) Ratio(o *SLO, start, end time.Time) (Ratio, error) {
+	switch o.Source {
+	case SourceSynthetic:
+		var r Ratio
+		var total, good int64
+		base := s.db.Model(&synthetic.Result{}).Where("check_id = ? AND created_at > ? AND created_at <= ?", o.CheckID, start, end)
+		if err := base.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return r, err
+		}
+		if err := base.Session(&gorm.Session{}).Where("success = ?", true).Count(&good).Error; err != nil {
+			return r, err
+		}
+		r.Good, r.Total = float64(good), float64(total)
+		return r, nil
+	case SourceMetric:
+		window := end.Sub(start)
+		opts := query.Options{TenantID: o.TenantID}
+		good, _, err := s.engine.ScalarValue(expand(o.GoodQuery, window), end, opts)
+		if err != nil {
+			return Ratio{}, fmt.Errorf("达标事件查询: %w", err)
+		}
+		total, _, err := s.engine.ScalarValue(expand(o.TotalQuery, window), end, opts)
+		if err != nil {
+			return Ratio{}, fmt.Errorf("总事件查询: %w", err)
+		}
+		return Ratio{Good: good, Total: total}, nil
+	}
+	return Ratio{}, fmt.Errorf("不支持的 SLI 来源 %s", o.Source)
+}
+
+// CheckRelease 检查租户的服务能否发布：该租户或全局开启了阻止发布的 SLO 错误预算耗尽时返回 ErrBudgetExhausted，
+// 其他租户的同名服务不影响
+func (s *Service) CheckRelease(tenantID, service string) error {
+	if service == "" {
+		return nil
+	}
+	var exhausted []SLO
+	s.db.Where("tenant_id IN ? AND service = ? AND block_deploys = ? AND enabled = ? AND status = ?",
+		[]string{tenantID, ""}, service, true, true, StatusExhausted).
+		Find(&exhausted)
+	if len(exhausted) == 0 {
+		return nil
+	}
+	o := exhausted[0]
+	return fmt.Errorf("%w: 服务 %s 的 SLO %s 在 %d 天内达标 %.3f%%，剩余预算 %.2f%%",
+		ErrBudgetExhausted, service, o.Name, o.WindowDays, o.SLI, o.BudgetRemaining)
+}
+
+func sloInfo(o *SLO) detector.SLOInfo {
+	return detector.SLOInfo{
+		ID:              o.ID,
+		Name:            o.Name,
+		Service:         o.Service,
+		TenantID:        o.TenantID,
+		Objective:       strconv.FormatFloat(o.Objective, 'f', -1, 64),
+		WindowDays:      o.WindowDays,
+		SLI:             o.SLI,
+		BudgetRemaining: o.BudgetRemaining,
+	}
+}
+
+// round 保留 4 位小数
+func round(v float64) float64 {
+	return math.Round(v*1e4) / 1e4
+}
+
+func truncate(s string, n int) string {
+	if len([]rune(s)) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,128 @@
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"yunwei/service/metrics/query"
+)
+
+// SLI 来源
+const (
+	SourceSynthetic = "synthetic" // 拨测结果，每个地点的一次结果为一个事件
+	SourceMetric    = "metric"    // 达标事件数与总事件数两个指标查询
+)
+
+// WindowPlaceholder 指标查询中的时间窗口占位符，求值时替换为具体时长，如 increase(http_requests_total[$window])
+const WindowPlaceholder = "$window"
+
+// SLO 状态
+const (
+	StatusOK        = "ok"
+	StatusBurning   = "burning"   // 触发了燃烧率告警
+	StatusExhausted = "exhausted" // 错误预算已耗尽
+	StatusNoData    = "no_data"
+)
+
+// windowDays 支持的滚动窗口天数
+var windowDays = []int{7, 28, 30}
+
+// ErrBudgetExhausted 错误预算耗尽时发布被阻止
+var ErrBudgetExhausted = errors.New("错误预算已耗尽")
+
+// SLO 服务等级目标，在滚动窗口内统计达标事件比例和错误预算
+type SLO struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID    string `json:"tenantId" gorm:"type:varchar(36);index"`
+	Name        string `json:"name" gorm:"type:varchar(64);not null"`
+	Service     string `json:"service" gorm:"type:varchar(128);index"` // 服务名，与灰度发布的 serviceName、部署方案中的服务名对应
+	Description string `json:"description" gorm:"type:varchar(255)"`
+
+	Source     string `json:"source" gorm:"type:varchar(16);not null"` // synthetic, metric
+	CheckID    uint   `json:"checkId"`                                 // source 为 synthetic 时的拨测检查
+	GoodQuery  string `json:"goodQuery" gorm:"type:text"`              // source 为 metric 时的达标事件数查询，需包含 $window
+	TotalQuery string `json:"totalQuery" gorm:"type:text"`             // source 为 metric 时的总事件数查询，需包含 $window
+
+	Objective  float64 `json:"objective"`  // 目标达标比例(%)，如 99.9
+	WindowDays int     `json:"windowDays"` // 滚动窗口：7、28、30 天
+
+	BlockDeploys bool `json:"blockDeploys"` // 错误预算耗尽时阻止该服务的灰度发布和部署
+	Enabled      bool `json:"enabled" gorm:"default:true"`
+
+	// 运行状态
+	Status          string     `json:"status" gorm:"type:varchar(16)"` // ok, burning, exhausted, no_data，未求值时为空
+	SLI             float64    `json:"sli"`                            // 窗口内达标比例(%)
+	BudgetRemaining float64    `json:"budgetRemaining"`                // 剩余错误预算(%)，超支时为负
+	LastEvalAt      *time.Time `json:"lastEvalAt"`
+	LastError       string     `json:"lastError" gorm:"type:varchar(512)"`
+}
+
+func (SLO) TableName() string {
+	return "slos"
+}
+
+// Window 滚动窗口时长
+func (s *SLO) Window() time.Duration {
+	return time.Duration(s.WindowDays) * 24 * time.Hour
+}
+
+// budget 允许的失败比例，如目标 99.9% 时为 0.001
+func (s *SLO) budget() float64 {
+	return 1 - s.Objective/100
+}
+
+// Validate 校验 SLO 配置
+func (s *SLO) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("缺少名称")
+	}
+	s.Service = strings.TrimSpace(s.Service)
+	if s.BlockDeploys && s.Service == "" {
+		return errors.New("阻止发布需要指定服务名")
+	}
+	if s.Objective <= 0 || s.Objective >= 100 {
+		return errors.New("目标需在 0~100 之间，如 99.9")
+	}
+	if s.WindowDays == 0 {
+		s.WindowDays = 30
+	}
+	valid := false
+	for _, d := range windowDays {
+		valid = valid || d == s.WindowDays
+	}
+	if !valid {
+		return fmt.Errorf("滚动窗口只支持 %v 天", windowDays)
+	}
+
+	switch s.Source {
+	case SourceSynthetic:
+		if s.CheckID == 0 {
+			return errors.New("缺少拨测检查")
+		}
+		s.GoodQuery, s.TotalQuery = "", ""
+	case SourceMetric:
+		s.CheckID = 0
+		queries := []struct{ name, q string }{{"达标事件", s.GoodQuery}, {"总事件", s.TotalQuery}}
+		for _, q := range queries {
+			if !strings.Contains(q.q, WindowPlaceholder) {
+				return fmt.Errorf("%s查询需包含 %s", q.name, WindowPlaceholder)
+			}
+			if _, err := query.Parse(expand(q.q, time.Hour)); err != nil {
+				return fmt.Errorf("%s查询错误: %w", q.name, err)
+			}
+		}
+	default:
+		return fmt.Errorf("不支持的 SLI 来源 %s", s.Source)
+	}
+	return nil
+}
+
+// expand 将查询中的 $window 替换为时长
+func expand(q string, window time.Duration) string {
+	return strings.ReplaceAll(q, WindowPlaceholder, query.FormatDuration(window))
+}
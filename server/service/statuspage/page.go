@@ -0,0 +1,228 @@
+package statuspage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 组件状态，按严重程度从低到高排列
+const (
+	StatusOperational = "operational"
+	StatusMaintenance = "under_maintenance"
+	StatusDegraded    = "degraded_performance"
+	StatusPartial     = "partial_outage"
+	StatusMajor       = "major_outage"
+)
+
+var statusRank = map[string]int{
+	StatusOperational: 0,
+	StatusMaintenance: 1,
+	StatusDegraded:    2,
+	StatusPartial:     3,
+	StatusMajor:       4,
+}
+
+var statusText = map[string]string{
+	StatusOperational: "正常",
+	StatusMaintenance: "维护中",
+	StatusDegraded:    "性能下降",
+	StatusPartial:     "部分中断",
+	StatusMajor:       "严重中断",
+}
+
+// worse 返回两个状态中更严重的一个
+func worse(a, b string) string {
+	if statusRank[b] > statusRank[a] {
+		return b
+	}
+	return a
+}
+
+// 组件来源
+const (
+	SourceSynthetic   = "synthetic"    // 拨测检查
+	SourceServerGroup = "server_group" // 服务器分组
+)
+
+// 事件状态
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+var incidentText = map[string]string{
+	IncidentInvestigating: "调查中",
+	IncidentIdentified:    "已定位",
+	IncidentMonitoring:    "观察中",
+	IncidentResolved:      "已解决",
+}
+
+// 事件影响程度，对应受影响组件的状态
+var impactStatus = map[string]string{
+	"minor":    StatusDegraded,
+	"major":    StatusPartial,
+	"critical": StatusMajor,
+}
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,62}$`)
+
+// Page 状态页，公开页通过 /status/:slug 或自定义域名访问，内部页只能登录后查看
+type Page struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID     string `json:"tenantId" gorm:"type:varchar(36);index"`
+	Name         string `json:"name" gorm:"type:varchar(64);not null"`
+	Slug         string `json:"slug" gorm:"type:varchar(64);uniqueIndex"`
+	Description  string `json:"description" gorm:"type:varchar(255)"`
+	Public       bool   `json:"public"`                                      // 是否允许匿名访问
+	CustomDomain string `json:"customDomain" gorm:"type:varchar(255);index"` // 自定义域名，解析到平台后直接访问根路径
+	Enabled      bool   `json:"enabled" gorm:"default:true"`
+}
+
+func (Page) TableName() string {
+	return "status_pages"
+}
+
+// Validate 校验状态页配置
+func (p *Page) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("缺少名称")
+	}
+	p.Slug = strings.ToLower(strings.TrimSpace(p.Slug))
+	if !slugPattern.MatchString(p.Slug) {
+		return errors.New("标识只能包含小写字母、数字和连字符，长度 2~63")
+	}
+	p.CustomDomain = strings.ToLower(strings.TrimSpace(p.CustomDomain))
+	if strings.ContainsAny(p.CustomDomain, "/: ") {
+		return errors.New("自定义域名只填写主机名，如 status.example.com")
+	}
+	return nil
+}
+
+// Component 状态页上的组件，状态由关联的拨测检查或服务器分组的告警自动得出
+type Component struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	PageID      uint   `json:"pageId" gorm:"index"`
+	Name        string `json:"name" gorm:"type:varchar(64);not null"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	Source      string `json:"source" gorm:"type:varchar(16)"` // synthetic, server_group
+	CheckID     uint   `json:"checkId"`
+	GroupID     uint   `json:"groupId"`
+	SortOrder   int    `json:"sortOrder"`
+}
+
+func (Component) TableName() string {
+	return "status_page_components"
+}
+
+// Validate 校验组件配置
+func (c *Component) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("缺少名称")
+	}
+	switch c.Source {
+	case SourceSynthetic:
+		if c.CheckID == 0 {
+			return errors.New("缺少拨测检查")
+		}
+		c.GroupID = 0
+	case SourceServerGroup:
+		if c.GroupID == 0 {
+			return errors.New("缺少服务器分组")
+		}
+		c.CheckID = 0
+	default:
+		return fmt.Errorf("不支持的组件来源 %s", c.Source)
+	}
+	return nil
+}
+
+// Incident 手动发布的事件，影响的组件状态取事件影响程度和告警状态中更严重的一个
+type Incident struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	PageID     uint       `json:"pageId" gorm:"index"`
+	Title      string     `json:"title" gorm:"type:varchar(128);not null"`
+	Status     string     `json:"status" gorm:"type:varchar(16);index"` // investigating, identified, monitoring, resolved
+	Impact     string     `json:"impact" gorm:"type:varchar(16)"`       // minor, major, critical
+	Components string     `json:"components" gorm:"type:varchar(255)"`  // 逗号分隔的受影响组件 ID
+	ResolvedAt *time.Time `json:"resolvedAt"`
+
+	CreatedBy uint   `json:"createdBy"`
+	Creator   string `json:"creator" gorm:"type:varchar(64)"`
+
+	Updates []IncidentUpdate `json:"updates,omitempty" gorm:"foreignKey:IncidentID"`
+}
+
+func (Incident) TableName() string {
+	return "status_page_incidents"
+}
+
+// ComponentIDs 受影响的组件
+func (i *Incident) ComponentIDs() []uint {
+	var ids []uint
+	for _, s := range strings.Split(i.Components, ",") {
+		if id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32); err == nil && id > 0 {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// Validate 校验事件
+func (i *Incident) Validate() error {
+	if strings.TrimSpace(i.Title) == "" {
+		return errors.New("缺少标题")
+	}
+	if i.Status == "" {
+		i.Status = IncidentInvestigating
+	}
+	if _, ok := incidentText[i.Status]; !ok {
+		return fmt.Errorf("不支持的事件状态 %s", i.Status)
+	}
+	if i.Impact == "" {
+		i.Impact = "minor"
+	}
+	if _, ok := impactStatus[i.Impact]; !ok {
+		return fmt.Errorf("不支持的影响程度 %s", i.Impact)
+	}
+	return nil
+}
+
+// IncidentUpdate 事件的一条进展，发布时同时更新事件状态
+type IncidentUpdate struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	IncidentID uint   `json:"incidentId" gorm:"index"`
+	Status     string `json:"status" gorm:"type:varchar(16)"`
+	Message    string `json:"message" gorm:"type:text"`
+
+	CreatedBy uint   `json:"createdBy"`
+	Creator   string `json:"creator" gorm:"type:varchar(64)"`
+}
+
+func (IncidentUpdate) TableName() string {
+	return "status_page_incident_updates"
+}
+
+// ValidateStatus 校验事件状态
+func ValidateStatus(status string) error {
+	if _, ok := incidentText[status]; !ok {
+		return fmt.Errorf("不支持的事件状态 %s", status)
+	}
+	return nil
+}
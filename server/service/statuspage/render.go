@@ -0,0 +1,90 @@
+package statuspage
+
+import (
+	"bytes"
+	"html/template"
+	"time"
+)
+
+// 状态对应的颜色
+var statusColor = map[string]string{
+	StatusOperational: "#34c724",
+	StatusMaintenance: "#3370ff",
+	StatusDegraded:    "#ffc60a",
+	StatusPartial:     "#ff8800",
+	StatusMajor:       "#f54a45",
+}
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"color": func(status string) string { return statusColor[status] },
+	"time":  func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"deref": func(v *float64) float64 { return *v },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width,initial-scale=1">
+<meta http-equiv="refresh" content="60">
+<title>{{.Name}}</title>
+<style>
+body{margin:0;padding:24px;background:#f5f6f8;font-family:-apple-system,'PingFang SC','Microsoft YaHei',sans-serif;font-size:14px;color:#1f2329}
+.wrap{max-width:760px;margin:0 auto}
+.card{background:#fff;border-radius:6px;margin-bottom:16px;overflow:hidden}
+.banner{padding:16px 24px;color:#fff;font-size:18px;font-weight:600}
+.row{display:flex;justify-content:space-between;padding:12px 24px;border-top:1px solid #eee}
+.row:first-child{border-top:none}
+.muted{color:#8f959e;font-size:12px}
+.title{padding:12px 24px;font-weight:600;border-bottom:1px solid #eee}
+.item{padding:12px 24px;border-top:1px solid #eee;line-height:1.6}
+.item:first-of-type{border-top:none}
+</style>
+</head>
+<body>
+<div class="wrap">
+<h1 style="font-size:22px">{{.Name}}</h1>
+{{if .Description}}<p class="muted">{{.Description}}</p>{{end}}
+<div class="card"><div class="banner" style="background:{{color .Status}}">{{if eq .Status "operational"}}所有服务运行正常{{else}}当前状态：{{.StatusText}}{{end}}</div></div>
+
+{{range .Incidents}}
+<div class="card">
+<div class="title" style="color:{{if eq .Impact "critical"}}#f54a45{{else if eq .Impact "major"}}#ff8800{{else}}#d4a000{{end}}">{{.Title}}</div>
+{{range .Updates}}<div class="item"><b>{{.StatusText}}</b> - {{.Message}}<div class="muted">{{time .CreatedAt}}</div></div>{{end}}
+</div>
+{{end}}
+
+{{range .Maintenances}}
+<div class="card">
+<div class="title" style="color:#3370ff">{{if .Active}}维护进行中{{else}}计划维护{{end}}：{{.Name}}</div>
+<div class="item">{{time .StartsAt}} ~ {{time .EndsAt}}{{if .Comment}}<br>{{.Comment}}{{end}}<div class="muted">影响：{{range $i, $c := .Components}}{{if $i}}、{{end}}{{$c}}{{end}}</div></div>
+</div>
+{{end}}
+
+<div class="card">
+{{range .Components}}
+<div class="row"><div>{{.Name}}{{if .Description}}<div class="muted">{{.Description}}</div>{{end}}</div>
+<div style="text-align:right"><span style="color:{{color .Status}}">{{.StatusText}}</span>{{if .Uptime}}<div class="muted">30 天可用率 {{printf "%.2f" (deref .Uptime)}}%</div>{{end}}</div></div>
+{{else}}
+<div class="row muted">暂无组件</div>
+{{end}}
+</div>
+
+{{if .PastIncidents}}
+<div class="card">
+<div class="title">最近 7 天的事件</div>
+{{range .PastIncidents}}<div class="item">{{.Title}}<div class="muted">{{time .CreatedAt}}{{if .ResolvedAt}} ~ {{.ResolvedAt.Format "2006-01-02 15:04"}}{{end}}</div></div>{{end}}
+</div>
+{{end}}
+
+<p class="muted" style="text-align:center">更新于 {{time .UpdatedAt}}</p>
+</div>
+</body>
+</html>`))
+
+// Render 把状态页汇总渲染为 HTML
+func Render(s *Summary) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
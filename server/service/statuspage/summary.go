@@ -0,0 +1,408 @@
+package statuspage
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"yunwei/global"
+	"yunwei/model/server"
+	"yunwei/service/detector"
+	"yunwei/service/metrics/query"
+	"yunwei/service/silence"
+	"yunwei/service/synthetic"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// cacheTTL 状态汇总的缓存时间，公开页可能被频繁访问
+	cacheTTL = 30 * time.Second
+	// uptimeWindow 拨测组件可用率的统计时长
+	uptimeWindow = 30 * 24 * time.Hour
+	// pastIncidentWindow 已解决事件在页面上保留的时长
+	pastIncidentWindow = 7 * 24 * time.Hour
+	// maintenanceHorizon 提前展示的维护计划
+	maintenanceHorizon = 7 * 24 * time.Hour
+)
+
+// ComponentStatus 组件的当前状态
+type ComponentStatus struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Status      string   `json:"status"`
+	StatusText  string   `json:"statusText"`
+	Uptime      *float64 `json:"uptime,omitempty"` // 最近 30 天可用率(%)，仅拨测组件
+}
+
+// UpdateView 事件进展
+type UpdateView struct {
+	Status     string    `json:"status"`
+	StatusText string    `json:"statusText"`
+	Message    string    `json:"message"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// IncidentView 页面上展示的事件
+type IncidentView struct {
+	ID         uint         `json:"id"`
+	Title      string       `json:"title"`
+	Status     string       `json:"status"`
+	StatusText string       `json:"statusText"`
+	Impact     string       `json:"impact"`
+	Components []string     `json:"components"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	ResolvedAt *time.Time   `json:"resolvedAt,omitempty"`
+	Updates    []UpdateView `json:"updates"`
+}
+
+// MaintenanceView 进行中或计划中的维护，来自作用范围覆盖页面组件的维护窗口
+type MaintenanceView struct {
+	Name       string    `json:"name"`
+	Comment    string    `json:"comment,omitempty"`
+	StartsAt   time.Time `json:"startsAt"`
+	EndsAt     time.Time `json:"endsAt"`
+	Active     bool      `json:"active"`
+	Components []string  `json:"components"`
+}
+
+// Summary 状态页汇总，公开页的 HTML 和 JSON 都由它生成，不包含告警详情
+type Summary struct {
+	Name          string            `json:"name"`
+	Slug          string            `json:"slug"`
+	Description   string            `json:"description,omitempty"`
+	Status        string            `json:"status"` // 最严重的组件状态
+	StatusText    string            `json:"statusText"`
+	Components    []ComponentStatus `json:"components"`
+	Incidents     []IncidentView    `json:"incidents"`     // 未解决的事件
+	PastIncidents []IncidentView    `json:"pastIncidents"` // 最近 7 天内解决的事件
+	Maintenances  []MaintenanceView `json:"maintenances"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+type cachedSummary struct {
+	summary *Summary
+	at      time.Time
+}
+
+// Service 状态页服务，汇总组件状态并缓存
+type Service struct {
+	db *gorm.DB
+
+	mu    sync.Mutex
+	cache map[uint]*cachedSummary
+}
+
+var (
+	globalService *Service
+	serviceOnce   sync.Once
+)
+
+// GetService 获取全局状态页服务
+func GetService() *Service {
+	serviceOnce.Do(func() {
+		globalService = NewService(global.DB)
+	})
+	return globalService
+}
+
+// NewService 创建状态页服务
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db, cache: make(map[uint]*cachedSummary)}
+}
+
+// Invalidate 状态页、组件或事件变更后清除缓存
+func (s *Service) Invalidate(pageID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cache, pageID)
+}
+
+// FindPublic 按标识或自定义域名查找启用的公开页
+func (s *Service) FindPublic(slug, domain string) (*Page, error) {
+	db := s.db.Where("public = ? AND enabled = ?", true, true)
+	if domain != "" {
+		db = db.Where("custom_domain = ?", strings.ToLower(domain))
+	} else {
+		db = db.Where("slug = ?", slug)
+	}
+	var p Page
+	if err := db.First(&p).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Summary 获取状态页汇总，30 秒内的重复请求使用缓存
+func (s *Service) Summary(p *Page, now time.Time) (*Summary, error) {
+	s.mu.Lock()
+	if c, ok := s.cache[p.ID]; ok && now.Sub(c.at) < cacheTTL {
+		s.mu.Unlock()
+		return c.summary, nil
+	}
+	s.mu.Unlock()
+
+	summary, err := s.build(p, now)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.cache[p.ID] = &cachedSummary{summary: summary, at: now}
+	s.mu.Unlock()
+	return summary, nil
+}
+
+// componentState 汇总时组件的中间状态
+type componentState struct {
+	component *Component
+	status    string
+	labels    []map[string]string // 用于匹配维护窗口的标签，拨测组件为告警标签，分组组件为各服务器的标签
+}
+
+func (s *Service) build(p *Page, now time.Time) (*Summary, error) {
+	var components []Component
+	if err := s.db.Where("page_id = ?", p.ID).Order("sort_order, id").Find(&components).Error; err != nil {
+		return nil, err
+	}
+	summary := &Summary{
+		Name:          p.Name,
+		Slug:          p.Slug,
+		Description:   p.Description,
+		Status:        StatusOperational,
+		Components:    []ComponentStatus{},
+		Incidents:     []IncidentView{},
+		PastIncidents: []IncidentView{},
+		Maintenances:  []MaintenanceView{},
+		UpdatedAt:     now,
+	}
+
+	states := make([]*componentState, len(components))
+	byID := make(map[uint]*componentState, len(components))
+	for i := range components {
+		c := &components[i]
+		var st *componentState
+		switch c.Source {
+		case SourceSynthetic:
+			st = s.checkState(c)
+		default:
+			st = s.groupState(c, p.TenantID)
+		}
+		states[i] = st
+		byID[c.ID] = st
+	}
+
+	// 维护窗口：作用范围覆盖任一组件的窗口展示在页面上，进行中时组件显示维护中
+	var windows []silence.MaintenanceWindow
+	s.db.Where("enabled = ?", true).Find(&windows)
+	for _, w := range windows {
+		matchers, err := silence.ParseMatchers(w.Matchers)
+		if err != nil {
+			continue
+		}
+		runs, err := w.NextRuns(now, 1)
+		if err != nil || len(runs) == 0 || runs[0][0].Sub(now) > maintenanceHorizon {
+			continue
+		}
+		active := !runs[0][0].After(now)
+		var names []string
+		for _, st := range states {
+			if matchAny(matchers, st.labels) {
+				names = append(names, st.component.Name)
+				if active && st.status == StatusOperational {
+					st.status = StatusMaintenance
+				}
+			}
+		}
+		if len(names) > 0 {
+			summary.Maintenances = append(summary.Maintenances, MaintenanceView{
+				Name:       w.Name,
+				Comment:    w.Comment,
+				StartsAt:   runs[0][0],
+				EndsAt:     runs[0][1],
+				Active:     active,
+				Components: names,
+			})
+		}
+	}
+
+	// 手动发布的事件
+	var incidents []Incident
+	s.db.Preload("Updates", func(db *gorm.DB) *gorm.DB { return db.Order("id DESC") }).
+		Where("page_id = ? AND (status <> ? OR resolved_at > ?)", p.ID, IncidentResolved, now.Add(-pastIncidentWindow)).
+		Order("id DESC").Find(&incidents)
+	for i := range incidents {
+		inc := &incidents[i]
+		view := IncidentView{
+			ID:         inc.ID,
+			Title:      inc.Title,
+			Status:     inc.Status,
+			StatusText: incidentText[inc.Status],
+			Impact:     inc.Impact,
+			Components: []string{},
+			CreatedAt:  inc.CreatedAt,
+			ResolvedAt: inc.ResolvedAt,
+			Updates:    make([]UpdateView, 0, len(inc.Updates)),
+		}
+		for _, id := range inc.ComponentIDs() {
+			if st, ok := byID[id]; ok {
+				view.Components = append(view.Components, st.component.Name)
+				if inc.Status != IncidentResolved {
+					st.status = worse(st.status, impactStatus[inc.Impact])
+				}
+			}
+		}
+		for _, u := range inc.Updates {
+			view.Updates = append(view.Updates, UpdateView{
+				Status:     u.Status,
+				StatusText: incidentText[u.Status],
+				Message:    u.Message,
+				CreatedAt:  u.CreatedAt,
+			})
+		}
+		if inc.Status == IncidentResolved {
+			summary.PastIncidents = append(summary.PastIncidents, view)
+		} else {
+			summary.Incidents = append(summary.Incidents, view)
+		}
+	}
+
+	for _, st := range states {
+		c := st.component
+		cs := ComponentStatus{
+			ID:          c.ID,
+			Name:        c.Name,
+			Description: c.Description,
+			Status:      st.status,
+			StatusText:  statusText[st.status],
+		}
+		if c.Source == SourceSynthetic {
+			cs.Uptime = s.uptime(c.CheckID, now)
+		}
+		summary.Components = append(summary.Components, cs)
+		summary.Status = worse(summary.Status, st.status)
+	}
+	summary.StatusText = statusText[summary.Status]
+	return summary, nil
+}
+
+// levelStatus 告警级别对应的组件状态
+func levelStatus(level detector.AlertLevel) string {
+	switch level {
+	case detector.AlertLevelCritical, detector.AlertLevelEmergency:
+		return StatusMajor
+	case detector.AlertLevelWarning:
+		return StatusPartial
+	}
+	return StatusDegraded
+}
+
+// checkState 拨测组件的状态取检查未恢复告警的级别，检查失败但未达到告警条件时为性能下降
+func (s *Service) checkState(c *Component) *componentState {
+	st := &componentState{component: c, status: StatusOperational}
+	var check synthetic.Check
+	if err := s.db.First(&check, c.CheckID).Error; err != nil {
+		return st
+	}
+	st.labels = []map[string]string{{
+		"alertname":  string(detector.AlertTypeSyntheticFailed),
+		"type":       string(detector.AlertTypeSyntheticFailed),
+		"check":      check.Name,
+		"check_id":   strconv.FormatUint(uint64(check.ID), 10),
+		"check_type": check.Type,
+		"target":     check.Target,
+	}}
+	if check.TenantID != "" {
+		st.labels[0][query.LabelTenant] = check.TenantID
+	}
+	if !check.Enabled {
+		return st
+	}
+
+	var open []detector.Alert
+	s.db.Select("level").Where("fingerprint = ? AND status <> ?", detector.SyntheticFingerprint(check.ID), detector.AlertStatusResolved).
+		Find(&open)
+	for _, a := range open {
+		st.status = worse(st.status, levelStatus(a.Level))
+	}
+	if check.Status == synthetic.StatusDown {
+		st.status = worse(st.status, StatusDegraded)
+	}
+	return st
+}
+
+// groupState 分组组件的状态：全部服务器都有严重告警时为严重中断，部分服务器有严重告警时为部分中断，
+// 只有警告及以下告警时为性能下降
+func (s *Service) groupState(c *Component, tenantID string) *componentState {
+	st := &componentState{component: c, status: StatusOperational}
+	var ids []uint
+	db := s.db.Model(&server.Server{}).Where("group_id = ?", c.GroupID)
+	if tenantID != "" {
+		db = db.Where("tenant_id = ?", tenantID)
+	}
+	db.Pluck("id", &ids)
+	if len(ids) == 0 {
+		return st
+	}
+
+	inGroup := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		inGroup[id] = true
+	}
+	if targets, err := query.GetEngine().Targets(tenantID); err == nil {
+		for _, t := range targets {
+			if inGroup[t.ServerID] {
+				st.labels = append(st.labels, t.Labels)
+			}
+		}
+	}
+
+	var open []detector.Alert
+	s.db.Select("server_id", "level").Where("server_id IN ? AND status <> ?", ids, detector.AlertStatusResolved).Find(&open)
+	critical := make(map[uint]bool)
+	for _, a := range open {
+		if levelStatus(a.Level) == StatusMajor {
+			critical[a.ServerID] = true
+		} else {
+			st.status = worse(st.status, StatusDegraded)
+		}
+	}
+	switch {
+	case len(critical) == len(ids):
+		st.status = StatusMajor
+	case len(critical) > 0:
+		st.status = worse(st.status, StatusPartial)
+	}
+	return st
+}
+
+// uptime 拨测检查最近 30 天的可用率，没有结果时为空
+func (s *Service) uptime(checkID uint, now time.Time) *float64 {
+	var total, success int64
+	base := s.db.Model(&synthetic.Result{}).Where("check_id = ? AND created_at > ?", checkID, now.Add(-uptimeWindow))
+	base.Session(&gorm.Session{}).Count(&total)
+	if total == 0 {
+		return nil
+	}
+	base.Session(&gorm.Session{}).Where("success = ?", true).Count(&success)
+	v := float64(success*10000/total) / 100
+	return &v
+}
+
+// matchAny 任一组标签满足全部匹配条件
+func matchAny(matchers []*query.Matcher, labelSets []map[string]string) bool {
+	for _, labels := range labelSets {
+		ok := true
+		for _, m := range matchers {
+			if !m.Matches(labels[m.Name]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package synthetic
+
+import (
+	"time"
+
+	"yunwei/service/metrics"
+)
+
+const (
+	// maxPoints 可用率历史最多返回的分桶数
+	maxPoints = 500
+	// minCompareSamples 对比前后任一窗口的结果少于此数时不做判断
+	minCompareSamples = 5
+	// 判定优化前后有变化的阈值：可用率相差 1 个百分点，或 P95 延迟相差 20%
+	availabilityDelta = 1.0
+	latencyRatio      = 0.2
+)
+
+// 对比结论
+const (
+	VerdictImproved     = "improved"
+	VerdictDegraded     = "degraded"
+	VerdictUnchanged    = "unchanged"
+	VerdictInsufficient = "insufficient"
+)
+
+// Window 一段时间内的拨测统计
+type Window struct {
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Total        int       `json:"total"`
+	Success      int       `json:"success"`
+	Availability float64   `json:"availability"` // 百分比，没有结果时为 0
+	AvgLatency   float64   `json:"avgLatency"`   // 毫秒，只统计成功的拨测
+	P95Latency   float64   `json:"p95Latency"`
+
+	latencies []float64
+}
+
+func (w *Window) add(r *Result) {
+	w.Total++
+	if r.Success {
+		w.Success++
+		w.latencies = append(w.latencies, float64(r.Latency))
+	}
+}
+
+func (w *Window) finish() {
+	if w.Total > 0 {
+		w.Availability = float64(w.Success) * 100 / float64(w.Total)
+	}
+	if len(w.latencies) > 0 {
+		var sum float64
+		for _, l := range w.latencies {
+			sum += l
+		}
+		w.AvgLatency = sum / float64(len(w.latencies))
+		w.P95Latency = metrics.Percentile(w.latencies, 0.95)
+	}
+	w.latencies = nil
+}
+
+// Availability 一个检查的可用率历史
+type Availability struct {
+	CheckID   uint               `json:"checkId"`
+	Step      int64              `json:"step"` // 分桶间隔(秒)
+	Overall   *Window            `json:"overall"`
+	Locations map[string]*Window `json:"locations"`
+	Points    []*Window          `json:"points"`
+}
+
+// loadResults 加载检查在 [start, end) 内的结果
+func (r *Runner) loadResults(checkID uint, start, end time.Time) []Result {
+	var results []Result
+	r.db.Select("location", "success", "latency", "created_at").
+		Where("check_id = ? AND created_at >= ? AND created_at < ?", checkID, start, end).
+		Order("created_at").Find(&results)
+	return results
+}
+
+// Availability 统计检查在 [start, end) 内的可用率：总体、各地点以及按 step 分桶的历史，
+// step 为 0 或分桶过多时自动放大
+func (r *Runner) Availability(checkID uint, start, end time.Time, step time.Duration) *Availability {
+	if minStep := end.Sub(start) / maxPoints; step < minStep {
+		step = minStep
+	}
+	if step < time.Minute {
+		step = time.Minute
+	}
+
+	a := &Availability{
+		CheckID:   checkID,
+		Step:      int64(step / time.Second),
+		Overall:   &Window{Start: start, End: end},
+		Locations: make(map[string]*Window),
+	}
+	for t := start; t.Before(end); t = t.Add(step) {
+		bucketEnd := t.Add(step)
+		if bucketEnd.After(end) {
+			bucketEnd = end
+		}
+		a.Points = append(a.Points, &Window{Start: t, End: bucketEnd})
+	}
+
+	results := r.loadResults(checkID, start, end)
+	for i := range results {
+		res := &results[i]
+		a.Overall.add(res)
+		loc := a.Locations[res.Location]
+		if loc == nil {
+			loc = &Window{Start: start, End: end}
+			a.Locations[res.Location] = loc
+		}
+		loc.add(res)
+		if idx := int(res.CreatedAt.Sub(start) / step); idx >= 0 && idx < len(a.Points) {
+			a.Points[idx].add(res)
+		}
+	}
+
+	a.Overall.finish()
+	for _, w := range a.Locations {
+		w.finish()
+	}
+	for _, w := range a.Points {
+		w.finish()
+	}
+	return a
+}
+
+// ==================== 优化前后对比 ====================
+
+// Comparison 一个检查在某时间点前后相同时长内的拨测对比
+type Comparison struct {
+	CheckID uint    `json:"checkId"`
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Target  string  `json:"target"`
+	Before  *Window `json:"before"`
+	After   *Window `json:"after"`
+	Verdict string  `json:"verdict"` // improved, degraded, unchanged, insufficient
+}
+
+// Compare 对比关联到资源的检查在 at 前后各 window 时长内的结果，
+// 用真实的用户侧拨测验证 CDN、负载均衡等优化的效果
+func (r *Runner) Compare(resource string, resourceID uint, at time.Time, window time.Duration) []*Comparison {
+	var checks []Check
+	r.db.Where("resource = ? AND resource_id = ?", resource, resourceID).Order("id").Find(&checks)
+
+	end := at.Add(window)
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	comparisons := make([]*Comparison, 0, len(checks))
+	for _, c := range checks {
+		cmp := &Comparison{
+			CheckID: c.ID,
+			Name:    c.Name,
+			Type:    c.Type,
+			Target:  c.Target,
+			Before:  r.window(c.ID, at.Add(-window), at),
+			After:   r.window(c.ID, at, end),
+		}
+		cmp.Verdict = verdict(cmp.Before, cmp.After)
+		comparisons = append(comparisons, cmp)
+	}
+	return comparisons
+}
+
+func (r *Runner) window(checkID uint, start, end time.Time) *Window {
+	w := &Window{Start: start, End: end}
+	if end.After(start) {
+		results := r.loadResults(checkID, start, end)
+		for i := range results {
+			w.add(&results[i])
+		}
+	}
+	w.finish()
+	return w
+}
+
+// verdict 可用率优先，可用率无明显变化时看 P95 延迟
+func verdict(before, after *Window) string {
+	if before.Total < minCompareSamples || after.Total < minCompareSamples {
+		return VerdictInsufficient
+	}
+	switch diff := after.Availability - before.Availability; {
+	case diff <= -availabilityDelta:
+		return VerdictDegraded
+	case diff >= availabilityDelta:
+		return VerdictImproved
+	}
+	if before.P95Latency > 0 {
+		switch change := (after.P95Latency - before.P95Latency) / before.P95Latency; {
+		case change >= latencyRatio:
+			return VerdictDegraded
+		case change <= -latencyRatio:
+			return VerdictImproved
+		}
+	}
+	return VerdictUnchanged
+}
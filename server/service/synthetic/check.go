@@ -0,0 +1,339 @@
+package synthetic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"yunwei/service/detector"
+)
+
+// 检查类型
+const (
+	TypeHTTP = "http"
+	TypeTCP  = "tcp"
+	TypeDNS  = "dns"
+	TypeTLS  = "tls"
+)
+
+// LocationServer 在控制节点上拨测，其余拨测地点为 Agent ID
+const LocationServer = "server"
+
+// 检查状态
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// 关联的资源类型，用于对比 CDN、负载均衡优化前后的拨测结果
+const (
+	ResourceCDNDomain    = "cdn_domain"
+	ResourceLoadBalancer = "load_balancer"
+)
+
+const (
+	defaultInterval = 60
+	minInterval     = 10
+	defaultTimeout  = 10
+	maxTimeout      = 60
+	// defaultCertDays TLS 检查未配置断言时，证书剩余有效期少于此天数视为失败
+	defaultCertDays = 14
+)
+
+// Check 拨测检查，在控制节点和选定的 Agent 上按间隔执行
+type Check struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	TenantID string `json:"tenantId" gorm:"type:varchar(36);index"`
+	Name     string `json:"name" gorm:"type:varchar(64);not null"`
+	Type     string `json:"type" gorm:"type:varchar(8);not null"`     // http, tcp, dns, tls
+	Target   string `json:"target" gorm:"type:varchar(512);not null"` // URL、host:port 或域名
+
+	Interval      int    `json:"interval"`                      // 执行间隔(秒)
+	Timeout       int    `json:"timeout"`                       // 单次超时(秒)
+	Locations     string `json:"locations" gorm:"type:text"`    // 逗号分隔的拨测地点：server 或 Agent ID，为空为 server
+	FailThreshold int    `json:"failThreshold"`                 // 失败地点数达到此值时告警，默认 1
+	Level         string `json:"level" gorm:"type:varchar(16)"` // 告警级别，默认 warning
+	Assertions    string `json:"assertions" gorm:"type:text"`   // 断言(JSON)，见 Assertion
+
+	// HTTP
+	Method      string `json:"method" gorm:"type:varchar(8)"`
+	Headers     string `json:"headers" gorm:"type:text"` // 请求头(JSON 对象)
+	Body        string `json:"body" gorm:"type:text"`
+	NoRedirects bool   `json:"noRedirects"` // 不跟随重定向，直接对 3xx 响应做断言
+	SkipVerify  bool   `json:"skipVerify"`  // 不校验证书，HTTPS 和 TLS 检查有效
+
+	// DNS
+	RecordType string `json:"recordType" gorm:"type:varchar(8)"` // A, AAAA, CNAME, MX, TXT, NS，默认 A
+	Resolver   string `json:"resolver" gorm:"type:varchar(64)"`  // 如 8.8.8.8:53，为空使用系统配置
+
+	// 关联资源，优化记录前后的拨测结果可在 /synthetic/validate 中对比
+	Resource   string `json:"resource" gorm:"type:varchar(32);index:idx_synthetic_checks_resource"` // cdn_domain, load_balancer
+	ResourceID uint   `json:"resourceId" gorm:"index:idx_synthetic_checks_resource"`
+
+	Enabled bool   `json:"enabled" gorm:"default:true"`
+	Comment string `json:"comment" gorm:"type:varchar(255)"`
+
+	// 运行状态
+	Status    string     `json:"status" gorm:"type:varchar(8)"` // up, down，未执行时为空
+	LastRunAt *time.Time `json:"lastRunAt"`
+	LastError string     `json:"lastError" gorm:"type:varchar(512)"`
+}
+
+func (Check) TableName() string {
+	return "synthetic_checks"
+}
+
+// Result 一次拨测在一个地点的结果，用于可用率统计
+type Result struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"createdAt" gorm:"index:idx_synthetic_results_check_time,priority:2"`
+
+	CheckID    uint   `json:"checkId" gorm:"index:idx_synthetic_results_check_time,priority:1"`
+	Location   string `json:"location" gorm:"type:varchar(64)"`
+	Success    bool   `json:"success"`
+	Latency    int64  `json:"latency"` // 毫秒
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error" gorm:"type:varchar(512)"` // 连接错误或未通过的断言
+}
+
+func (Result) TableName() string {
+	return "synthetic_results"
+}
+
+// Assertion 对拨测结果的断言
+type Assertion struct {
+	Source   string `json:"source"`             // status_code, latency, body, header, cert_expiry_days, answer
+	Property string `json:"property,omitempty"` // source 为 header 时的请求头名称
+	Operator string `json:"operator"`           // eq, ne, lt, le, gt, ge, contains, not_contains, matches
+	Target   string `json:"target"`
+}
+
+// 断言来源
+const (
+	SourceStatusCode = "status_code"
+	SourceLatency    = "latency"
+	SourceBody       = "body"
+	SourceHeader     = "header"
+	SourceCertExpiry = "cert_expiry_days"
+	SourceAnswer     = "answer"
+)
+
+// numericSources 按数值比较的断言来源
+var numericSources = map[string]bool{SourceStatusCode: true, SourceLatency: true, SourceCertExpiry: true}
+
+// sourceTypes 各断言来源适用的检查类型
+var sourceTypes = map[string][]string{
+	SourceStatusCode: {TypeHTTP},
+	SourceLatency:    {TypeHTTP, TypeTCP, TypeDNS, TypeTLS},
+	SourceBody:       {TypeHTTP},
+	SourceHeader:     {TypeHTTP},
+	SourceCertExpiry: {TypeHTTP, TypeTLS},
+	SourceAnswer:     {TypeDNS},
+}
+
+var operators = map[string]bool{
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"contains": true, "not_contains": true, "matches": true,
+}
+
+// ParseAssertions 解析断言
+func (c *Check) ParseAssertions() ([]Assertion, error) {
+	if strings.TrimSpace(c.Assertions) == "" {
+		return nil, nil
+	}
+	var assertions []Assertion
+	if err := json.Unmarshal([]byte(c.Assertions), &assertions); err != nil {
+		return nil, fmt.Errorf("断言格式错误: %w", err)
+	}
+	return assertions, nil
+}
+
+// ParseHeaders 解析 HTTP 请求头
+func (c *Check) ParseHeaders() (map[string]string, error) {
+	if strings.TrimSpace(c.Headers) == "" {
+		return nil, nil
+	}
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(c.Headers), &headers); err != nil {
+		return nil, fmt.Errorf("请求头格式错误: %w", err)
+	}
+	return headers, nil
+}
+
+// LocationList 拨测地点，未配置时只在控制节点执行
+func (c *Check) LocationList() []string {
+	var locations []string
+	seen := make(map[string]bool)
+	for _, l := range strings.Split(c.Locations, ",") {
+		l = strings.TrimSpace(l)
+		if l != "" && !seen[l] {
+			seen[l] = true
+			locations = append(locations, l)
+		}
+	}
+	if len(locations) == 0 {
+		return []string{LocationServer}
+	}
+	return locations
+}
+
+// interval 执行间隔
+func (c *Check) interval() time.Duration {
+	if c.Interval <= 0 {
+		return defaultInterval * time.Second
+	}
+	return time.Duration(c.Interval) * time.Second
+}
+
+// timeout 单次超时
+func (c *Check) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return defaultTimeout * time.Second
+	}
+	return time.Duration(c.Timeout) * time.Second
+}
+
+// failThreshold 触发告警的失败地点数，不超过地点总数
+func (c *Check) failThreshold() int {
+	n := c.FailThreshold
+	if n <= 0 {
+		n = 1
+	}
+	if total := len(c.LocationList()); n > total {
+		n = total
+	}
+	return n
+}
+
+// Validate 校验检查配置
+func (c *Check) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("缺少名称")
+	}
+	c.Target = strings.TrimSpace(c.Target)
+	if c.Target == "" {
+		return errors.New("缺少拨测目标")
+	}
+	switch c.Type {
+	case TypeHTTP:
+		u, err := url.Parse(c.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("HTTP 检查的目标需为 http:// 或 https:// 开头的地址")
+		}
+		if c.Method == "" {
+			c.Method = "GET"
+		}
+		c.Method = strings.ToUpper(c.Method)
+		if _, err := c.ParseHeaders(); err != nil {
+			return err
+		}
+	case TypeTCP, TypeTLS:
+		if _, port, err := net.SplitHostPort(c.Target); err != nil || port == "" {
+			return errors.New("TCP、TLS 检查的目标需为 host:port")
+		}
+	case TypeDNS:
+		if c.RecordType == "" {
+			c.RecordType = "A"
+		}
+		c.RecordType = strings.ToUpper(c.RecordType)
+		switch c.RecordType {
+		case "A", "AAAA", "CNAME", "MX", "TXT", "NS":
+		default:
+			return fmt.Errorf("不支持的记录类型 %s", c.RecordType)
+		}
+		if c.Resolver != "" {
+			if _, _, err := net.SplitHostPort(c.Resolver); err != nil {
+				return errors.New("DNS 服务器需为 host:port，如 8.8.8.8:53")
+			}
+		}
+	default:
+		return fmt.Errorf("不支持的检查类型 %s", c.Type)
+	}
+
+	if c.Interval == 0 {
+		c.Interval = defaultInterval
+	}
+	if c.Interval < minInterval {
+		return fmt.Errorf("执行间隔不能小于 %d 秒", minInterval)
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultTimeout
+	}
+	if c.Timeout < 0 || c.Timeout > maxTimeout || c.Timeout > c.Interval {
+		return fmt.Errorf("超时需在 1~%d 秒之间且不超过执行间隔", maxTimeout)
+	}
+	if c.FailThreshold < 0 || c.FailThreshold > len(c.LocationList()) {
+		return errors.New("告警的失败地点数不能超过拨测地点数")
+	}
+	switch detector.AlertLevel(c.Level) {
+	case "":
+		c.Level = string(detector.AlertLevelWarning)
+	case detector.AlertLevelInfo, detector.AlertLevelWarning, detector.AlertLevelCritical, detector.AlertLevelEmergency:
+	default:
+		return fmt.Errorf("不支持的告警级别 %s", c.Level)
+	}
+	switch c.Resource {
+	case "":
+		c.ResourceID = 0
+	case ResourceCDNDomain, ResourceLoadBalancer:
+		if c.ResourceID == 0 {
+			return errors.New("缺少关联资源 ID")
+		}
+	default:
+		return fmt.Errorf("不支持的关联资源 %s", c.Resource)
+	}
+
+	assertions, err := c.ParseAssertions()
+	if err != nil {
+		return err
+	}
+	for i, a := range assertions {
+		if err := a.validate(c.Type); err != nil {
+			return fmt.Errorf("第 %d 条断言: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (a *Assertion) validate(checkType string) error {
+	types, ok := sourceTypes[a.Source]
+	if !ok {
+		return fmt.Errorf("不支持的断言来源 %s", a.Source)
+	}
+	applicable := false
+	for _, t := range types {
+		applicable = applicable || t == checkType
+	}
+	if !applicable {
+		return fmt.Errorf("%s 检查不支持断言 %s", checkType, a.Source)
+	}
+	if !operators[a.Operator] {
+		return fmt.Errorf("不支持的比较方式 %s", a.Operator)
+	}
+	if a.Source == SourceHeader && a.Property == "" {
+		return errors.New("响应头断言需指定 property")
+	}
+	if numericSources[a.Source] {
+		switch a.Operator {
+		case "contains", "not_contains", "matches":
+			return fmt.Errorf("%s 只能按数值比较", a.Source)
+		}
+		if _, err := parseNumber(a.Target); err != nil {
+			return fmt.Errorf("%s 的目标值需为数字", a.Source)
+		}
+	}
+	if a.Operator == "matches" {
+		if _, err := regexp.Compile(a.Target); err != nil {
+			return fmt.Errorf("正则表达式错误: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package synthetic
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxBodyBytes 响应体最多读取的字节数，断言只作用于这部分内容
+const maxBodyBytes = 64 << 10
+
+// Spec 一次拨测的参数，也是下发给 Agent 的 probe 命令内容，字段需与 Agent 端保持一致
+type Spec struct {
+	Type            string            `json:"type"`
+	Target          string            `json:"target"`
+	Timeout         int               `json:"timeout"` // 秒
+	Method          string            `json:"method,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body,omitempty"`
+	FollowRedirects bool              `json:"followRedirects,omitempty"`
+	SkipVerify      bool              `json:"skipVerify,omitempty"`
+	RecordType      string            `json:"recordType,omitempty"`
+	Resolver        string            `json:"resolver,omitempty"`
+}
+
+// Observation 拨测观测到的原始结果，断言在控制节点上统一判断
+type Observation struct {
+	Error        string            `json:"error,omitempty"` // 连接、解析等错误，有错误时不再判断断言
+	Latency      int64             `json:"latency"`         // 毫秒
+	StatusCode   int               `json:"statusCode,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	Answers      []string          `json:"answers,omitempty"`
+	CertNotAfter *time.Time        `json:"certNotAfter,omitempty"`
+	CertSubject  string            `json:"certSubject,omitempty"`
+}
+
+// spec 由检查配置生成拨测参数
+func (c *Check) spec() (*Spec, error) {
+	headers, err := c.ParseHeaders()
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{
+		Type:            c.Type,
+		Target:          c.Target,
+		Timeout:         int(c.timeout() / time.Second),
+		Method:          c.Method,
+		Headers:         headers,
+		Body:            c.Body,
+		FollowRedirects: !c.NoRedirects,
+		SkipVerify:      c.SkipVerify,
+		RecordType:      c.RecordType,
+		Resolver:        c.Resolver,
+	}, nil
+}
+
+// Probe 在本机执行一次拨测
+func Probe(ctx context.Context, s *Spec) *Observation {
+	timeout := time.Duration(s.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	obs := &Observation{}
+	var err error
+	switch s.Type {
+	case TypeHTTP:
+		err = probeHTTP(ctx, s, obs)
+	case TypeTCP:
+		var conn net.Conn
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", s.Target)
+		if err == nil {
+			conn.Close()
+		}
+	case TypeTLS:
+		err = probeTLS(ctx, s, obs)
+	case TypeDNS:
+		err = probeDNS(ctx, s, obs)
+	default:
+		err = fmt.Errorf("不支持的检查类型 %s", s.Type)
+	}
+	obs.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		obs.Error = err.Error()
+	}
+	return obs
+}
+
+func probeHTTP(ctx context.Context, s *Spec, obs *Observation) error {
+	method := s.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if s.Body != "" {
+		body = strings.NewReader(s.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.Target, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range s.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: s.SkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+	if !s.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return fmt.Errorf("读取响应失败: %w", err)
+	}
+	obs.StatusCode = resp.StatusCode
+	obs.Body = string(data)
+	obs.Headers = make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		obs.Headers[k] = resp.Header.Get(k)
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		cert := resp.TLS.PeerCertificates[0]
+		obs.CertNotAfter = &cert.NotAfter
+		obs.CertSubject = cert.Subject.CommonName
+	}
+	return nil
+}
+
+func probeTLS(ctx context.Context, s *Spec, obs *Observation) error {
+	host, _, _ := net.SplitHostPort(s.Target)
+	dialer := &tls.Dialer{Config: &tls.Config{ServerName: host, InsecureSkipVerify: s.SkipVerify}}
+	conn, err := dialer.DialContext(ctx, "tcp", s.Target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	state := conn.(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("服务端未提供证书")
+	}
+	cert := state.PeerCertificates[0]
+	obs.CertNotAfter = &cert.NotAfter
+	obs.CertSubject = cert.Subject.CommonName
+	return nil
+}
+
+func probeDNS(ctx context.Context, s *Spec, obs *Observation) error {
+	resolver := &net.Resolver{}
+	if s.Resolver != "" {
+		resolver.PreferGo = true
+		resolver.Dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, s.Resolver)
+		}
+	}
+
+	var answers []string
+	switch s.RecordType {
+	case "", "A", "AAAA":
+		network := "ip4"
+		if s.RecordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := resolver.LookupIP(ctx, network, s.Target)
+		if err != nil {
+			return err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		records, err := resolver.LookupMX(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			answers = append(answers, r.Host)
+		}
+	case "TXT":
+		records, err := resolver.LookupTXT(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		answers = records
+	case "NS":
+		records, err := resolver.LookupNS(ctx, s.Target)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			answers = append(answers, r.Host)
+		}
+	default:
+		return fmt.Errorf("不支持的记录类型 %s", s.RecordType)
+	}
+	if len(answers) == 0 {
+		return errors.New("没有解析结果")
+	}
+	obs.Answers = answers
+	return nil
+}
+
+// ==================== 断言 ====================
+
+// Evaluate 判断拨测结果，返回失败原因；HTTP 检查未配置状态码断言时要求状态码小于 400，
+// TLS 检查未配置证书断言时要求证书剩余有效期不少于 14 天
+func Evaluate(checkType string, assertions []Assertion, obs *Observation, now time.Time) error {
+	if obs.Error != "" {
+		return errors.New(obs.Error)
+	}
+
+	hasStatus, hasCert := false, false
+	for _, a := range assertions {
+		hasStatus = hasStatus || a.Source == SourceStatusCode
+		hasCert = hasCert || a.Source == SourceCertExpiry
+	}
+	if checkType == TypeHTTP && !hasStatus && obs.StatusCode >= 400 {
+		return fmt.Errorf("HTTP 状态码 %d", obs.StatusCode)
+	}
+	if checkType == TypeTLS && !hasCert {
+		assertions = append(assertions, Assertion{Source: SourceCertExpiry, Operator: "ge", Target: strconv.Itoa(defaultCertDays)})
+	}
+
+	for _, a := range assertions {
+		if err := a.check(obs, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check 判断一条断言，DNS 解析结果有任一条满足即可，ne 和 not_contains 需全部满足
+func (a *Assertion) check(obs *Observation, now time.Time) error {
+	var actual []string
+	switch a.Source {
+	case SourceStatusCode:
+		actual = []string{strconv.Itoa(obs.StatusCode)}
+	case SourceLatency:
+		actual = []string{strconv.FormatInt(obs.Latency, 10)}
+	case SourceCertExpiry:
+		if obs.CertNotAfter == nil {
+			return errors.New("断言失败: 未获取到证书")
+		}
+		days := obs.CertNotAfter.Sub(now).Hours() / 24
+		actual = []string{strconv.FormatFloat(days, 'f', 1, 64)}
+	case SourceBody:
+		actual = []string{obs.Body}
+	case SourceHeader:
+		actual = []string{obs.Headers[http.CanonicalHeaderKey(a.Property)]}
+	case SourceAnswer:
+		actual = obs.Answers
+	}
+
+	negative := a.Operator == "ne" || a.Operator == "not_contains"
+	passed := negative
+	for _, v := range actual {
+		ok, err := compare(v, a.Operator, a.Target)
+		if err != nil {
+			return fmt.Errorf("断言失败: %s", err)
+		}
+		if negative && !ok {
+			passed = false
+			break
+		}
+		if !negative && ok {
+			passed = true
+			break
+		}
+	}
+	if passed {
+		return nil
+	}
+
+	name := a.Source
+	if a.Source == SourceHeader {
+		name = "header " + a.Property
+	}
+	return fmt.Errorf("断言失败: %s %s %s，实际为 %s", name, a.Operator, a.Target, excerpt(strings.Join(actual, ", "), 64))
+}
+
+func compare(actual, operator, target string) (bool, error) {
+	switch operator {
+	case "contains":
+		return strings.Contains(actual, target), nil
+	case "not_contains":
+		return !strings.Contains(actual, target), nil
+	case "matches":
+		re, err := regexp.Compile(target)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(actual), nil
+	}
+
+	// 两边都是数字时按数值比较，否则 eq、ne 按字符串比较
+	x, errX := parseNumber(actual)
+	y, errY := parseNumber(target)
+	if errX != nil || errY != nil {
+		switch operator {
+		case "eq":
+			return actual == target, nil
+		case "ne":
+			return actual != target, nil
+		}
+		return false, fmt.Errorf("%q 无法按数值比较", excerpt(actual, 32))
+	}
+	switch operator {
+	case "eq":
+		return x == y, nil
+	case "ne":
+		return x != y, nil
+	case "lt":
+		return x < y, nil
+	case "le":
+		return x <= y, nil
+	case "gt":
+		return x > y, nil
+	case "ge":
+		return x >= y, nil
+	}
+	return false, fmt.Errorf("不支持的比较方式 %s", operator)
+}
+
+func parseNumber(s string) (float64, error) {
+	return strconv.ParseFloat(strings.TrimSpace(s), 64)
+}
+
+// excerpt 按字符截断
+func excerpt(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
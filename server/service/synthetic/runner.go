@@ -0,0 +1,269 @@
+package synthetic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"yunwei/config"
+	"yunwei/global"
+	"yunwei/service/detector"
+	haService "yunwei/service/ha"
+
+	"gorm.io/gorm"
+)
+
+const (
+	scheduleTick    = 5 * time.Second
+	cleanupInterval = time.Hour
+	// agentOverhead Agent 执行拨测的命令超时在拨测超时之外多留的时间
+	agentOverhead = 5 * time.Second
+)
+
+// Runner 拨测调度器，由 Leader 按各检查的间隔执行，结果写入历史并同步告警
+type Runner struct {
+	db        *gorm.DB
+	retention time.Duration
+	slots     chan struct{}
+
+	mu       sync.Mutex
+	isLeader func() bool
+	cancel   context.CancelFunc
+	running  map[uint]bool
+}
+
+var (
+	globalRunner *Runner
+	runnerOnce   sync.Once
+)
+
+// GetRunner 获取按配置文件 synthetic 段创建的全局调度器
+func GetRunner() *Runner {
+	runnerOnce.Do(func() {
+		globalRunner = NewRunner(global.DB, config.CONFIG.Synthetic)
+	})
+	return globalRunner
+}
+
+// NewRunner 创建拨测调度器，未配置的参数使用默认值
+func NewRunner(db *gorm.DB, cfg config.Synthetic) *Runner {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 10
+	}
+	retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	if retention <= 0 {
+		retention = 30 * 24 * time.Hour
+	}
+	return &Runner{
+		db:        db,
+		retention: retention,
+		slots:     make(chan struct{}, workers),
+		isLeader:  func() bool { return true },
+		running:   make(map[uint]bool),
+	}
+}
+
+// SetLeaderCheck 设置 Leader 判断，集群中只有 Leader 调度，同一检查不会被多个节点重复执行
+func (r *Runner) SetLeaderCheck(fn func() bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if fn != nil {
+		r.isLeader = fn
+	}
+}
+
+// Start 启动调度
+func (r *Runner) Start(ctx context.Context) {
+	r.mu.Lock()
+	if r.cancel != nil {
+		r.mu.Unlock()
+		return
+	}
+	ctx, r.cancel = context.WithCancel(ctx)
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(scheduleTick)
+		defer ticker.Stop()
+		var lastCleanup time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			r.mu.Lock()
+			leader := r.isLeader()
+			r.mu.Unlock()
+			if !leader {
+				continue
+			}
+			now := time.Now()
+			r.schedule(ctx, now)
+			if now.Sub(lastCleanup) >= cleanupInterval {
+				r.db.Where("created_at < ?", now.Add(-r.retention)).Delete(&Result{})
+				lastCleanup = now
+			}
+		}
+	}()
+}
+
+// Stop 停止调度，执行中的拨测随之取消
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+// schedule 执行到期的检查，上一轮仍未结束的检查跳过
+func (r *Runner) schedule(ctx context.Context, now time.Time) {
+	var checks []Check
+	r.db.Where("enabled = ?", true).Find(&checks)
+	for i := range checks {
+		c := &checks[i]
+		if c.LastRunAt != nil && now.Sub(*c.LastRunAt) < c.interval() {
+			continue
+		}
+		r.mu.Lock()
+		if r.running[c.ID] {
+			r.mu.Unlock()
+			continue
+		}
+		r.running[c.ID] = true
+		r.mu.Unlock()
+
+		go func() {
+			defer func() {
+				r.mu.Lock()
+				delete(r.running, c.ID)
+				r.mu.Unlock()
+			}()
+			select {
+			case r.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-r.slots }()
+			if _, err := r.Run(ctx, c, time.Now()); err != nil {
+				global.Logger.Warn(fmt.Sprintf("拨测 %s 执行失败: %v", c.Name, err))
+			}
+		}()
+	}
+}
+
+// Run 在各地点执行一次检查，保存结果、更新检查状态并同步告警。
+// 返回各地点的结果，Agent 不可用的地点不计入可用率，其结果未保存（ID 为 0）
+func (r *Runner) Run(ctx context.Context, c *Check, now time.Time) ([]Result, error) {
+	spec, err := c.spec()
+	if err != nil {
+		return nil, err
+	}
+	assertions, err := c.ParseAssertions()
+	if err != nil {
+		return nil, err
+	}
+
+	locations := c.LocationList()
+	results := make([]Result, len(locations))
+	available := make([]bool, len(locations))
+	var wg sync.WaitGroup
+	for i, loc := range locations {
+		wg.Add(1)
+		go func(i int, loc string) {
+			defer wg.Done()
+			results[i] = Result{CreatedAt: now, CheckID: c.ID, Location: loc}
+			obs, err := probeAt(ctx, loc, spec)
+			if err != nil {
+				results[i].Error = excerpt("拨测地点不可用: "+err.Error(), 500)
+				return
+			}
+			available[i] = true
+			results[i].Latency = obs.Latency
+			results[i].StatusCode = obs.StatusCode
+			results[i].Success = true
+			if err := Evaluate(c.Type, assertions, obs, time.Now()); err != nil {
+				results[i].Success = false
+				results[i].Error = excerpt(err.Error(), 500)
+			}
+		}(i, loc)
+	}
+	wg.Wait()
+
+	var recorded []*Result
+	failures := make(map[string]string)
+	lastError := ""
+	for i := range results {
+		if available[i] {
+			recorded = append(recorded, &results[i])
+			if !results[i].Success {
+				failures[results[i].Location] = results[i].Error
+			}
+		}
+		if !results[i].Success && lastError == "" {
+			lastError = results[i].Location + ": " + results[i].Error
+		}
+	}
+
+	updates := map[string]interface{}{"last_run_at": now, "last_error": excerpt(lastError, 500)}
+	if len(recorded) > 0 {
+		if err := r.db.Create(recorded).Error; err != nil {
+			return results, fmt.Errorf("保存拨测结果失败: %w", err)
+		}
+		// 部分地点不可用时阈值按可用地点数计算，避免因缺少结果而漏报
+		threshold := c.failThreshold()
+		if threshold > len(recorded) {
+			threshold = len(recorded)
+		}
+		status := StatusUp
+		if len(failures) >= threshold {
+			status = StatusDown
+		}
+		updates["status"] = status
+		detector.GetAlertManager().SyncSynthetic(detector.SyntheticCheck{
+			ID:       c.ID,
+			Name:     c.Name,
+			Type:     c.Type,
+			Target:   c.Target,
+			TenantID: c.TenantID,
+			Level:    detector.AlertLevel(c.Level),
+		}, failures, threshold, now)
+	}
+	r.db.Model(&Check{}).Where("id = ?", c.ID).Updates(updates)
+	return results, nil
+}
+
+// probeAt 在指定地点执行拨测，返回的错误表示地点不可用而非拨测失败
+func probeAt(ctx context.Context, location string, s *Spec) (*Observation, error) {
+	if location == LocationServer {
+		return Probe(ctx, s), nil
+	}
+	return probeAgent(ctx, location, s)
+}
+
+// probeAgent 通过 Agent 命令流在 Agent 上执行拨测，Agent 可能连接在集群中任一节点
+func probeAgent(ctx context.Context, agentID string, s *Spec) (*Observation, error) {
+	data, _ := json.Marshal(s)
+	result, err := haService.GetHAManager().GetAgentRouter().ExecuteCommand(ctx, &haService.AgentCommand{
+		AgentID: agentID,
+		Type:    haService.CommandTypeProbe,
+		Command: string(data),
+		Timeout: s.Timeout + int(agentOverhead/time.Second),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("Agent 返回 %s: %s", result.Status, excerpt(result.Output, 200))
+	}
+	var obs Observation
+	if err := json.Unmarshal([]byte(result.Output), &obs); err != nil {
+		return nil, fmt.Errorf("无法解析 Agent 返回的结果，Agent 版本可能不支持拨测")
+	}
+	return &obs, nil
+}
@@ -3,6 +3,7 @@ package tenant
 import (
         "errors"
         "fmt"
+        "strconv"
         "strings"
 
         tenantModel "yunwei/model/tenant"
@@ -121,6 +122,52 @@ func (s *IsolationService) TenantMiddleware() gin.HandlerFunc {
         }
 }
 
+// UserTenantMiddleware 按登录用户所属租户设置租户上下文（需要在 JWT 认证之后使用）
+// 只属于一个租户时直接使用，属于多个租户时须通过 X-Tenant-ID 或 tenantId 参数指定其中之一；
+// 超级管理员和未加入租户的平台用户不设置租户上下文
+func (s *IsolationService) UserTenantMiddleware() gin.HandlerFunc {
+        return func(c *gin.Context) {
+                if isAdmin, _ := c.Get("isAdmin"); isAdmin == true {
+                        c.Next()
+                        return
+                }
+
+                var members []tenantModel.TenantUser
+                userID := strconv.FormatUint(uint64(c.GetUint("userID")), 10)
+                s.db.Where("user_id = ? AND status = ?", userID, "active").Find(&members)
+                if len(members) == 0 {
+                        c.Next()
+                        return
+                }
+
+                want := c.GetHeader("X-Tenant-ID")
+                if want == "" {
+                        want = c.Query("tenantId")
+                }
+                var member *tenantModel.TenantUser
+                for i := range members {
+                        if members[i].TenantID == want || (want == "" && len(members) == 1) {
+                                member = &members[i]
+                                break
+                        }
+                }
+                if member == nil {
+                        c.JSON(403, gin.H{"error": "请通过 X-Tenant-ID 指定所属租户"})
+                        c.Abort()
+                        return
+                }
+
+                SetTenantContext(c, &TenantContext{
+                        TenantID: member.TenantID,
+                        UserID:   member.UserID,
+                        UserRole: member.RoleName,
+                        IsOwner:  member.IsOwner,
+                        IsAdmin:  member.IsAdmin,
+                })
+                c.Next()
+        }
+}
+
 // AuthMiddleware 认证中间件（需要配合租户中间件使用）
 func (s *IsolationService) AuthMiddleware() gin.HandlerFunc {
         return func(c *gin.Context) {
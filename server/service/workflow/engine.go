@@ -13,8 +13,10 @@ import (
 	"yunwei/service/ai/llm"
 	"yunwei/service/detector"
 	"yunwei/service/executor"
+	"yunwei/service/metrics"
 	"yunwei/service/notify"
 	"yunwei/service/security"
+	"yunwei/service/silence"
 )
 
 // WorkflowStatus 工作流状态
@@ -25,6 +27,7 @@ const (
 	WorkflowStatusRunning   WorkflowStatus = "running"
 	WorkflowStatusCompleted WorkflowStatus = "completed"
 	WorkflowStatusFailed    WorkflowStatus = "failed"
+	WorkflowStatusSkipped   WorkflowStatus = "skipped"
 )
 
 // WorkflowType 工作流类型
@@ -69,7 +72,7 @@ type WorkflowEngine struct {
 	decision   *decision.Engine
 	security   *security.SecurityChecker
 	notifier   notify.Notifier
-	llmClient  *llm.GLM5Client
+	llmClient  llm.Provider
 	runningWorkflows sync.Map
 }
 
@@ -79,11 +82,12 @@ func NewWorkflowEngine() *WorkflowEngine {
 		detector: detector.NewDetector(),
 		executor: executor.NewExecutor(),
 		security: security.NewSecurityChecker(),
+		notifier: notify.Default(),
 	}
 }
 
-// SetLLMClient 设置LLM客户端
-func (e *WorkflowEngine) SetLLMClient(client *llm.GLM5Client) {
+// SetLLMClient 设置LLM客户端，未设置时每次分析按服务器租户的 workflow 路由选择模型
+func (e *WorkflowEngine) SetLLMClient(client llm.Provider) {
 	e.llmClient = client
 	e.decision = decision.NewEngine(client)
 }
@@ -153,6 +157,24 @@ func (e *WorkflowEngine) Execute(workflow *WorkflowRecord) error {
 	}
 	workflow.NeedApprove = result.RequiresApproval
 
+	// 静默或维护窗口内不自动执行，保留分析结果和命令供人工处理
+	if workflow.AutoMode {
+		if m := silence.GetService().AutoExecSuppressed(srv.ID, time.Now()); m != nil {
+			completedAt := time.Now()
+			workflow.Status = WorkflowStatusSkipped
+			workflow.CompletedAt = &completedAt
+			workflow.Commands = aiDecision.Commands
+			workflow.NeedApprove = true
+			workflow.Result = "处于" + m.String() + "，暂停自动执行"
+			return global.DB.Save(workflow).Error
+		}
+	}
+
+	// 需要审批的命令转为待审批执行记录，审批通过后由执行器执行
+	if result.RequiresApproval {
+		return e.awaitApproval(workflow, &srv, commands, aiDecision.Commands, result.Message)
+	}
+
 	// 4. 执行命令
 	output, err := e.stepExecute(&srv, commands)
 	if err != nil {
@@ -180,18 +202,22 @@ func (e *WorkflowEngine) Execute(workflow *WorkflowRecord) error {
 }
 
 func (e *WorkflowEngine) stepDetect(srv *server.Server) (*server.ServerMetric, error) {
-	var metric server.ServerMetric
-	if err := global.DB.Where("server_id = ?", srv.ID).Order("created_at DESC").First(&metric).Error; err != nil {
+	metric, err := metrics.LatestServerMetric(srv.ID)
+	if err != nil {
 		return nil, fmt.Errorf("无法获取指标")
 	}
-	return &metric, nil
+	return metric, nil
 }
 
 func (e *WorkflowEngine) stepAnalyze(srv *server.Server, metric *server.ServerMetric) (*decision.AIDecision, error) {
-	if e.llmClient == nil {
+	if e.llmClient != nil {
+		return e.decision.QuickAnalyze(srv, metric)
+	}
+	client := llm.For(llm.FeatureWorkflow, srv.TenantID)
+	if client == nil {
 		return nil, fmt.Errorf("AI客户端未配置")
 	}
-	return e.decision.QuickAnalyze(srv, metric)
+	return decision.NewEngine(client).QuickAnalyze(srv, metric)
 }
 
 func (e *WorkflowEngine) stepExecute(srv *server.Server, commands []string) (string, error) {
@@ -222,6 +248,24 @@ func (e *WorkflowEngine) failWorkflow(workflow *WorkflowRecord, reason string) e
 	return fmt.Errorf(reason)
 }
 
+// awaitApproval 创建待审批执行记录并通知审批人，工作流以跳过结束
+func (e *WorkflowEngine) awaitApproval(workflow *WorkflowRecord, srv *server.Server, commands []string, commandsJSON, reason string) error {
+	record, err := e.executor.CreateExecutionRecord(srv.ID, commands, "workflow", 0)
+	if err != nil {
+		return e.failWorkflow(workflow, err.Error())
+	}
+	if err := notify.ForTenant(srv.TenantID).Send(notify.NewExecutionApproval(record, srv.Name, reason)); err != nil {
+		global.Logger.Warn(fmt.Sprintf("发送执行记录 #%d 审批通知失败: %v", record.ID, err))
+	}
+
+	now := time.Now()
+	workflow.Status = WorkflowStatusSkipped
+	workflow.CompletedAt = &now
+	workflow.Commands = commandsJSON
+	workflow.Result = fmt.Sprintf("等待审批，执行记录 #%d", record.ID)
+	return global.DB.Save(workflow).Error
+}
+
 func (e *WorkflowEngine) completeWorkflow(workflow *WorkflowRecord) error {
 	now := time.Now()
 	workflow.Status = WorkflowStatusCompleted
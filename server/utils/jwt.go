@@ -4,6 +4,7 @@ import (
         "errors"
         "time"
 
+        "github.com/gin-gonic/gin"
         "github.com/golang-jwt/jwt/v5"
 )
 
@@ -47,3 +48,13 @@ func ParseToken(tokenString string) (*CustomClaims, error) {
 
         return nil, errors.New("invalid token")
 }
+
+// CurrentUser 从请求上下文中取当前登录用户的 ID 和用户名，由 JWTAuth 中间件写入
+func CurrentUser(c *gin.Context) (uint, string) {
+        if claims, ok := c.Get("claims"); ok {
+                if cc, ok := claims.(*CustomClaims); ok {
+                        return cc.ID, cc.Username
+                }
+        }
+        return c.GetUint("userID"), ""
+}
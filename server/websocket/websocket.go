@@ -9,6 +9,7 @@ import (
 
         "yunwei/global"
         "yunwei/model/server"
+        "yunwei/service/metrics"
 
         "github.com/gin-gonic/gin"
         "github.com/gorilla/websocket"
@@ -374,15 +375,13 @@ func (s *WebSocketService) MonitorAndPush() {
 
                 for _, srv := range servers {
                         // 获取最新指标
-                        var metric server.ServerMetric
-                        if err := global.DB.Where("server_id = ?", srv.ID).
-                                Order("created_at DESC").
-                                First(&metric).Error; err != nil {
+                        metric, err := metrics.LatestServerMetric(srv.ID)
+                        if err != nil {
                                 continue
                         }
 
                         // 推送指标
-                        s.PushMetric(srv.ID, &metric, srv.Name)
+                        s.PushMetric(srv.ID, metric, srv.Name)
                 }
         }
 }